@@ -0,0 +1,168 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"config"
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	accessPrefix = "access-"
+)
+
+// AccessBackend tuple, the rewritten query executed on the backend.
+type AccessBackend struct {
+	Backend string        `json:"backend"` // Backend name.
+	Query   string        `json:"query"`   // Rewritten query.
+	Cost    time.Duration `json:"cost"`    // Cost on the backend.
+}
+
+// AccessRecord tuple, which physical backends served the logical query.
+type AccessRecord struct {
+	Start    time.Time       `json:"start"`           // Time the query was start.
+	Cost     time.Duration   `json:"cost"`            // Cost.
+	User     string          `json:"user"`            // User.
+	UserHost string          `json:"user_host"`       // User and host combination.
+	ThreadID uint32          `json:"thread_id"`       // Thread id.
+	Database string          `json:"database"`        // Current database.
+	Tables   []string        `json:"tables"`          // Logical tables in the 'db.table' form.
+	Query    string          `json:"query"`           // Full query.
+	Backends []AccessBackend `json:"backends"`        // Querys executed on the backends.
+	Error    string          `json:"error,omitempty"` // Error of the query, empty if succeed.
+}
+
+// Access tuple, the access log is separate from the audit log and rotated independently.
+type Access struct {
+	log     *xlog.Log
+	conf    *config.AccessConfig
+	ticker  *time.Ticker
+	queue   chan *AccessRecord
+	rotates chan chan error
+	done    chan bool
+	rfile   xbase.RotateFile
+	wg      sync.WaitGroup
+}
+
+// NewAccess creates the new access log.
+func NewAccess(log *xlog.Log, conf *config.AccessConfig) *Access {
+	return &Access{
+		log:     log,
+		conf:    conf,
+		done:    make(chan bool),
+		queue:   make(chan *AccessRecord, 1024),
+		rotates: make(chan chan error),
+		ticker:  time.NewTicker(time.Duration(time.Second * 300)), // 5 minutes
+		rfile:   xbase.NewRotateFile(conf.LogDir, accessPrefix, extension, conf.MaxSize),
+	}
+}
+
+// Init used to create the log dir, if EXISTS we do onthing.
+func (a *Access) Init() error {
+	log := a.log
+
+	log.Info("access.init.conf:%+v", a.conf)
+	if err := os.MkdirAll(a.conf.LogDir, 0744); err != nil {
+		return err
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.recordConsumer()
+	}()
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.purge()
+	}()
+	log.Info("access.init.done")
+	return nil
+}
+
+// LogRecord used to queue the record to write.
+func (a *Access) LogRecord(r *AccessRecord) {
+	a.queue <- r
+}
+
+// Close used to close the access log.
+func (a *Access) Close() {
+	// wait the queue record flush to file.
+	close(a.done)
+	close(a.queue)
+	a.wg.Wait()
+	a.rfile.Sync()
+	a.rfile.Close()
+	a.log.Info("access.closed")
+}
+
+// Rotate used to switch the access log to a new file, the records queued before are written to the old one.
+func (a *Access) Rotate() error {
+	done := make(chan error, 1)
+	select {
+	case a.rotates <- done:
+		return <-done
+	case <-a.done:
+		return errors.New("access.closed")
+	}
+}
+
+func (a *Access) recordConsumer() {
+	for {
+		select {
+		case r, ok := <-a.queue:
+			if !ok {
+				return
+			}
+			a.writeRecord(r)
+		case done := <-a.rotates:
+			// Drain the queued records first.
+			for n := len(a.queue); n > 0; n-- {
+				if r, ok := <-a.queue; ok {
+					a.writeRecord(r)
+				}
+			}
+			done <- a.rfile.Rotate()
+		}
+	}
+}
+
+func (a *Access) writeRecord(r *AccessRecord) {
+	log := a.log
+	b, err := json.Marshal(r)
+	if err != nil {
+		b = []byte(err.Error())
+	}
+	b = append(b, '\n')
+
+	if _, err := a.rfile.Write(b); err != nil {
+		log.Error("access.write.file.error:%v", err)
+	}
+}
+
+func (a *Access) purge() {
+	defer a.ticker.Stop()
+	for {
+		select {
+		case <-a.ticker.C:
+			purgeLogs(a.log, a.rfile, a.conf.LogDir, a.conf.ExpireHours)
+		case <-a.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestAccess(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_access_", log)
+	defer os.RemoveAll(tmpDir)
+	conf := &config.AccessConfig{
+		MaxSize: 102400,
+		LogDir:  tmpDir,
+	}
+
+	access := NewAccess(log, conf)
+	err := access.Init()
+	assert.Nil(t, err)
+
+	record := &AccessRecord{
+		Start:    time.Now(),
+		User:     "mock",
+		UserHost: "127.0.0.1:8899",
+		Database: "db1",
+		Tables:   []string{"db1.t1"},
+		Query:    "select * from t1",
+		Backends: []AccessBackend{
+			{Backend: "backend0", Query: "select * from db1.t1_0000 as t1", Cost: time.Millisecond},
+			{Backend: "backend1", Query: "select * from db1.t1_0001 as t1", Cost: time.Millisecond},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		record.ThreadID = uint32(i)
+		access.LogRecord(record)
+		err = access.Rotate()
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Each record is in its own file.
+	logs, err := filepath.Glob(filepath.Join(tmpDir, accessPrefix+"*"+extension))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(logs))
+
+	data, err := ioutil.ReadFile(logs[0])
+	assert.Nil(t, err)
+	got := &AccessRecord{}
+	err = json.Unmarshal([]byte(strings.TrimSpace(string(data))), got)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db1.t1"}, got.Tables)
+	assert.Equal(t, record.Backends, got.Backends)
+
+	access.Close()
+	err = access.Rotate()
+	assert.NotNil(t, err)
+}
@@ -9,6 +9,7 @@
 package audit
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"sync"
@@ -56,24 +57,26 @@ type event struct {
 
 // Audit tuple.
 type Audit struct {
-	log    *xlog.Log
-	conf   *config.AuditConfig
-	ticker *time.Ticker
-	queue  chan *event
-	done   chan bool
-	rfile  xbase.RotateFile
-	wg     sync.WaitGroup
+	log     *xlog.Log
+	conf    *config.AuditConfig
+	ticker  *time.Ticker
+	queue   chan *event
+	rotates chan chan error
+	done    chan bool
+	rfile   xbase.RotateFile
+	wg      sync.WaitGroup
 }
 
 // NewAudit creates the new audit.
 func NewAudit(log *xlog.Log, conf *config.AuditConfig) *Audit {
 	return &Audit{
-		log:    log,
-		conf:   conf,
-		done:   make(chan bool),
-		queue:  make(chan *event, 1024),
-		ticker: time.NewTicker(time.Duration(time.Second * 300)), // 5 minutes
-		rfile:  xbase.NewRotateFile(conf.LogDir, prefix, extension, conf.MaxSize),
+		log:     log,
+		conf:    conf,
+		done:    make(chan bool),
+		queue:   make(chan *event, 1024),
+		rotates: make(chan chan error),
+		ticker:  time.NewTicker(time.Duration(time.Second * 300)), // 5 minutes
+		rfile:   xbase.NewRotateFile(conf.LogDir, prefix, extension, conf.MaxSize),
 	}
 }
 
@@ -148,9 +151,34 @@ func (a *Audit) Close() {
 	a.log.Info("audit.closed")
 }
 
+// Rotate used to switch the audit log to a new file, the events queued before are written to the old one.
+func (a *Audit) Rotate() error {
+	done := make(chan error, 1)
+	select {
+	case a.rotates <- done:
+		return <-done
+	case <-a.done:
+		return errors.New("audit.closed")
+	}
+}
+
 func (a *Audit) eventConsumer() {
-	for e := range a.queue {
-		a.writeEvent(e)
+	for {
+		select {
+		case e, ok := <-a.queue:
+			if !ok {
+				return
+			}
+			a.writeEvent(e)
+		case done := <-a.rotates:
+			// Drain the queued events first.
+			for n := len(a.queue); n > 0; n-- {
+				if e, ok := <-a.queue; ok {
+					a.writeEvent(e)
+				}
+			}
+			done <- a.rfile.Rotate()
+		}
 	}
 }
 
@@ -182,12 +210,16 @@ func (a *Audit) purge() {
 }
 
 func (a *Audit) doPurge() {
-	log := a.log
-	if a.conf.ExpireHours == 0 {
+	purgeLogs(a.log, a.rfile, a.conf.LogDir, a.conf.ExpireHours)
+}
+
+// purgeLogs used to remove the old logs of the rotate file expired, 0 expireHours means never.
+func purgeLogs(log *xlog.Log, rfile xbase.RotateFile, dir string, expireHours int) {
+	if expireHours == 0 {
 		return
 	}
 
-	oldLogs, err := a.rfile.GetOldLogInfos()
+	oldLogs, err := rfile.GetOldLogInfos()
 	if err != nil {
 		log.Error("audit.get.old.loginfos.error:%v", err)
 		return
@@ -195,8 +227,8 @@ func (a *Audit) doPurge() {
 
 	for _, old := range oldLogs {
 		diff := time.Now().UTC().Sub(time.Unix(0, old.Ts))
-		if int(diff.Hours()) > a.conf.ExpireHours {
-			os.Remove(filepath.Join(a.conf.LogDir, old.Name))
+		if int(diff.Hours()) > expireHours {
+			os.Remove(filepath.Join(dir, old.Name))
 		}
 	}
 }
@@ -56,6 +56,39 @@ func TestAudit(t *testing.T) {
 	}
 }
 
+func TestAuditRotate(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_audit_", log)
+	defer os.RemoveAll(tmpDir)
+	conf := &config.AuditConfig{
+		Mode:        ALL,
+		MaxSize:     102400,
+		ExpireHours: 1,
+		LogDir:      tmpDir,
+	}
+
+	audit := NewAudit(log, conf)
+	err := audit.Init()
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		audit.LogWriteEvent("DDL", "mock", "127.0.0.1:8899", uint32(i), "create table t1(a int)", 0, time.Now())
+		err = audit.Rotate()
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Each event is in its own file.
+	logs, err := filepath.Glob(filepath.Join(tmpDir, prefix+"*"+extension))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(logs))
+
+	audit.Close()
+	err = audit.Rotate()
+	assert.NotNil(t, err)
+}
+
 func TestAuditMultiThread(t *testing.T) {
 	defer leaktest.Check(t)()
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
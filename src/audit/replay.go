@@ -0,0 +1,180 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"xbase/sync2"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// ReplayConfig tuple.
+type ReplayConfig struct {
+	// Address is the radon endpoint to replay to.
+	Address  string
+	User     string
+	Password string
+	// Database is the default database of the sessions, the audit log doesn't record it.
+	Database string
+	// Speed is the pace factor, 1 is the recorded pace, 2 is twice as fast, 0 means no waiting.
+	Speed float64
+}
+
+// ReplayStats tuple.
+type ReplayStats struct {
+	Sessions int64
+	Querys   int64
+	Errors   int64
+	Elapsed  time.Duration
+}
+
+// Replayer used to re-execute the audit log querys against the cluster.
+// The querys of one thread id are executed in order on one connection, so the session boundaries are kept.
+type Replayer struct {
+	log  *xlog.Log
+	conf *ReplayConfig
+}
+
+// NewReplayer creates the new replayer.
+func NewReplayer(log *xlog.Log, conf *ReplayConfig) *Replayer {
+	return &Replayer{
+		log:  log,
+		conf: conf,
+	}
+}
+
+// readEvents used to read all the events from the audit log files under the dir, sorted by the start time.
+func readEvents(dir string) ([]*event, error) {
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"*"+extension))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// The file name is the timestamp, sort it as the write order.
+	sort.Strings(files)
+
+	var events []*event
+	for _, file := range files {
+		fd, err := os.Open(file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		scanner := bufio.NewScanner(fd)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			e := &event{}
+			if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+				fd.Close()
+				return nil, errors.Errorf("audit.replay.file[%s].bad.event[%s]:%v", file, scanner.Text(), err)
+			}
+			events = append(events, e)
+		}
+		err = scanner.Err()
+		fd.Close()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	return events, nil
+}
+
+// Replay used to replay the audit logs under the dir.
+func (r *Replayer) Replay(dir string) (*ReplayStats, error) {
+	events, err := readEvents(dir)
+	if err != nil {
+		return nil, err
+	}
+	return r.replay(events), nil
+}
+
+func (r *Replayer) replay(events []*event) *ReplayStats {
+	var wg sync.WaitGroup
+	var sessions, querys, errs sync2.AtomicInt64
+	log := r.log
+	conf := r.conf
+
+	// One worker per thread id.
+	workers := make(map[uint32]chan *event)
+	worker := func(id uint32, ch chan *event) {
+		defer wg.Done()
+		sessions.Add(1)
+		conn, err := driver.NewConn(conf.User, conf.Password, conf.Address, conf.Database, "utf8")
+		if err != nil {
+			log.Error("audit.replay.thread[%v].connect.error:%v", id, err)
+		}
+		for e := range ch {
+			if conn == nil {
+				errs.Add(1)
+				continue
+			}
+			querys.Add(1)
+			if _, err := conn.FetchAll(e.Argument, -1); err != nil {
+				errs.Add(1)
+				log.Warning("audit.replay.thread[%v].query[%s].error:%v", id, e.Argument, err)
+			}
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+
+	// The session is closed after its last event.
+	last := make(map[uint32]int)
+	for i, e := range events {
+		last[e.ThreadID] = i
+	}
+
+	start := time.Now()
+	if len(events) > 0 {
+		first := events[0].Start
+		for i, e := range events {
+			// Wait for the recorded offset.
+			if conf.Speed > 0 {
+				offset := time.Duration(float64(e.Start.Sub(first)) / conf.Speed)
+				if wait := offset - time.Since(start); wait > 0 {
+					time.Sleep(wait)
+				}
+			}
+			ch, ok := workers[e.ThreadID]
+			if !ok {
+				ch = make(chan *event, 1024)
+				workers[e.ThreadID] = ch
+				wg.Add(1)
+				go worker(e.ThreadID, ch)
+			}
+			ch <- e
+			if last[e.ThreadID] == i {
+				close(ch)
+				delete(workers, e.ThreadID)
+			}
+		}
+	}
+	wg.Wait()
+
+	stats := &ReplayStats{
+		Sessions: sessions.Get(),
+		Querys:   querys.Get(),
+		Errors:   errs.Get(),
+		Elapsed:  time.Since(start),
+	}
+	log.Info("audit.replay.done:%+v", stats)
+	return stats
+}
@@ -0,0 +1,92 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestAuditReplay(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_audit_", log)
+	defer os.RemoveAll(tmpDir)
+
+	fakedbs := fakedb.New(log, 1)
+	defer fakedbs.Close()
+	fakedbs.AddQuery("select * from t1", fakedb.Result1)
+	fakedbs.AddQuery("insert into t1 values(1)", &sqltypes.Result{})
+	fakedbs.AddQueryError("select * from t2", errors.New("mock.query.error"))
+
+	// Write the audit log.
+	{
+		conf := &config.AuditConfig{
+			Mode:        ALL,
+			MaxSize:     102400,
+			ExpireHours: 1,
+			LogDir:      tmpDir,
+		}
+		audit := NewAudit(log, conf)
+		err := audit.Init()
+		assert.Nil(t, err)
+
+		now := time.Now()
+		host := "127.0.0.1:8899"
+		for i := 0; i < 10; i++ {
+			audit.LogReadEvent("SELECT", "mock", host, 1, "select * from t1", 2, now.Add(time.Duration(i)*time.Millisecond))
+			audit.LogWriteEvent("INSERT", "mock", host, 2, "insert into t1 values(1)", 1, now.Add(time.Duration(i)*time.Millisecond))
+		}
+		audit.LogReadEvent("SELECT", "mock", host, 3, "select * from t2", 0, now.Add(10*time.Millisecond))
+		audit.Close()
+	}
+
+	conf := &ReplayConfig{
+		Address:  fakedbs.Addrs()[0],
+		User:     "mock",
+		Password: "pwd",
+		Speed:    2,
+	}
+	replayer := NewReplayer(log, conf)
+	stats, err := replayer.Replay(tmpDir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), stats.Sessions)
+	assert.Equal(t, int64(21), stats.Querys)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, 10, fakedbs.GetQueryCalledNum("select * from t1"))
+	assert.Equal(t, 10, fakedbs.GetQueryCalledNum("insert into t1 values(1)"))
+
+	// Connect error.
+	{
+		conf.Address = "127.0.0.1:1"
+		conf.Speed = 0
+		stats, err := replayer.Replay(tmpDir)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), stats.Querys)
+		assert.Equal(t, int64(21), stats.Errors)
+	}
+
+	// Bad event.
+	{
+		err := ioutil.WriteFile(filepath.Join(tmpDir, "audit-bad.log"), []byte("xx\n"), 0644)
+		assert.Nil(t, err)
+		_, err = replayer.Replay(tmpDir)
+		assert.NotNil(t, err)
+	}
+}
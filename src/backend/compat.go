@@ -0,0 +1,83 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// CompatMySQL57 is the default compatibility mode, the rewritten querys are sent as is.
+	CompatMySQL57 = "5.7"
+	// CompatMySQL80 adjusts the rewritten querys for the MySQL 8.0 backends.
+	CompatMySQL80 = "8.0"
+	// CompatMariaDB adjusts the rewritten querys for the MariaDB backends.
+	CompatMariaDB = "mariadb"
+)
+
+var (
+	compatDDLPrefix   = regexp.MustCompile(`(?i)^\s*(create|alter)\s`)
+	compatCharset     = regexp.MustCompile(`(?i)\b(charset|character\s+set)(\s*=?\s*)utf8\b`)
+	compatCollate     = regexp.MustCompile(`(?i)\b(collate)(\s*=?\s*)utf8_`)
+	compatIntWidth    = regexp.MustCompile(`(?i)\b(tinyint|smallint|mediumint|int|integer|bigint)\s*\(\s*(\d+)\s*\)`)
+	compatSelectCache = regexp.MustCompile(`(?i)^(\s*select\s+(/\*.*?\*/\s*)*)sql_cache\s+`)
+	compatAuthPrefix  = "select authentication_string from mysql.user "
+)
+
+// compatMode returns the compatibility mode of the server version, such as '8.0.16' returns '8.0'.
+func compatMode(version string) string {
+	if strings.Contains(version, "MariaDB") {
+		return CompatMariaDB
+	}
+	if strings.HasPrefix(version, "8.") {
+		return CompatMySQL80
+	}
+	return CompatMySQL57
+}
+
+// compatRewrite used to adjust the query for the backend compatibility mode.
+// For the 8.0 backends:
+// 1. DDL: utf8 is renamed to utf8mb3 and the deprecated integer display widths are removed, except tinyint(1).
+// 2. DML: the removed SQL_CACHE modifier is stripped.
+// The GROUP BY results are sorted by radon(explicit ORDER BY or the merge sort), the 5.7 implicit sorting is not relied on.
+// For the MariaDB backends:
+// 1. The mysql_native_password users created before 10.4 keep the hash in the mysql.user.password column.
+func compatRewrite(mode string, query string) string {
+	switch mode {
+	case CompatMySQL80:
+		return compatRewrite80(query)
+	case CompatMariaDB:
+		return compatRewriteMariaDB(query)
+	}
+	return query
+}
+
+func compatRewrite80(query string) string {
+	if compatDDLPrefix.MatchString(query) {
+		query = compatCharset.ReplaceAllString(query, "${1}${2}utf8mb3")
+		query = compatCollate.ReplaceAllString(query, "${1}${2}utf8mb3_")
+		query = compatIntWidth.ReplaceAllStringFunc(query, func(typ string) string {
+			m := compatIntWidth.FindStringSubmatch(typ)
+			if strings.ToLower(m[1]) == "tinyint" && m[2] == "1" {
+				return typ
+			}
+			return m[1]
+		})
+		return query
+	}
+	return compatSelectCache.ReplaceAllString(query, "${1}")
+}
+
+func compatRewriteMariaDB(query string) string {
+	if strings.HasPrefix(query, compatAuthPrefix) {
+		return "select if(authentication_string = '', password, authentication_string) as authentication_string from mysql.user " + query[len(compatAuthPrefix):]
+	}
+	return query
+}
@@ -0,0 +1,141 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCompatMode(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"5.7.25-log", CompatMySQL57},
+		{"8.0.16", CompatMySQL80},
+		{"5.5.5-10.5.8-MariaDB-log", CompatMariaDB},
+		{"10.3.27-MariaDB", CompatMariaDB},
+		{"FakeDB", CompatMySQL57},
+		{"", CompatMySQL57},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, compatMode(test.version))
+	}
+}
+
+func TestCompatRewrite(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"create table db.t1_0000 (\n\t`id` int(11),\n\t`b` tinyint(1),\n\t`c` bigint(20) unsigned\n) engine=InnoDB default charset=utf8",
+			"create table db.t1_0000 (\n\t`id` int,\n\t`b` tinyint(1),\n\t`c` bigint unsigned\n) engine=InnoDB default charset=utf8mb3",
+		},
+		{
+			"create table db.t1_0000 (`name` varchar(10) character set utf8 collate utf8_bin) default charset=utf8mb4",
+			"create table db.t1_0000 (`name` varchar(10) character set utf8mb3 collate utf8mb3_bin) default charset=utf8mb4",
+		},
+		{
+			"alter table db.t1_0000 add column(`a` int(10))",
+			"alter table db.t1_0000 add column(`a` int)",
+		},
+		{
+			"select sql_cache a from db.t1_0000 where b = 'int(11)'",
+			"select a from db.t1_0000 where b = 'int(11)'",
+		},
+		{
+			"select /* comment */ SQL_CACHE a from db.t1_0000",
+			"select /* comment */ a from db.t1_0000",
+		},
+		{
+			"select sql_no_cache a from db.t1_0000",
+			"select sql_no_cache a from db.t1_0000",
+		},
+		{
+			"insert into db.t1_0000(a) values ('charset=utf8')",
+			"insert into db.t1_0000(a) values ('charset=utf8')",
+		},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, compatRewrite(CompatMySQL80, test.query))
+		assert.Equal(t, test.query, compatRewrite(CompatMySQL57, test.query))
+		assert.Equal(t, test.query, compatRewrite(CompatMariaDB, test.query))
+	}
+}
+
+func TestCompatRewriteMariaDB(t *testing.T) {
+	query := "select authentication_string from mysql.user where user='mock'"
+	want := "select if(authentication_string = '', password, authentication_string) as authentication_string from mysql.user where user='mock'"
+	assert.Equal(t, want, compatRewrite(CompatMariaDB, query))
+	assert.Equal(t, query, compatRewrite(CompatMySQL57, query))
+	assert.Equal(t, query, compatRewrite(CompatMySQL80, query))
+}
+
+func TestPoolCompatMode(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb := fakedb.New(log, 1)
+	defer fakedb.Close()
+	addr := fakedb.Addrs()[0]
+
+	// Detected at greeting.
+	{
+		pool := NewPool(log, MockBackendConfigDefault("node1", addr))
+		defer pool.Close()
+		assert.Equal(t, "", pool.ServerVersion())
+
+		conn, err := pool.Get()
+		assert.Nil(t, err)
+		conn.Recycle()
+		assert.Equal(t, "FakeDB", pool.ServerVersion())
+		assert.Equal(t, CompatMySQL57, pool.CompatMode())
+	}
+
+	// Config override.
+	{
+		conf := MockBackendConfigDefault("node2", addr)
+		conf.CompatMode = CompatMySQL80
+		pool := NewPool(log, conf)
+		defer pool.Close()
+		assert.Equal(t, CompatMySQL80, pool.CompatMode())
+
+		fakedb.AddQuery("create table t1 (`id` int) default charset=utf8mb3", result1)
+		conn, err := pool.Get()
+		assert.Nil(t, err)
+		defer conn.Recycle()
+		_, err = conn.Execute("create table t1 (`id` int(11)) default charset=utf8")
+		assert.Nil(t, err)
+	}
+}
+
+func TestPoolCompatModeMariaDB(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb := fakedb.NewMariaDB(log, 1)
+	defer fakedb.Close()
+	addr := fakedb.Addrs()[0]
+
+	pool := NewPool(log, MockBackendConfigDefault("node1", addr))
+	defer pool.Close()
+
+	conn, err := pool.Get()
+	assert.Nil(t, err)
+	defer conn.Recycle()
+	assert.Equal(t, "5.5.5-10.5.8-MariaDB-log", pool.ServerVersion())
+	assert.Equal(t, CompatMariaDB, pool.CompatMode())
+
+	// The auth query is rewritten for the MariaDB password column.
+	qr, err := conn.Execute("select authentication_string from mysql.user where user='mock'")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(qr.Rows))
+}
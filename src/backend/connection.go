@@ -17,10 +17,12 @@ import (
 	"time"
 
 	"monitor"
+	"xbase"
 	"xbase/stats"
 	"xbase/sync2"
 
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -41,13 +43,32 @@ type Connection interface {
 	LastErr() error
 	UseDB(string) error
 	Kill(string) error
+	KillQuery(string) error
 	Recycle()
 	Address() string
 	SetTimestamp(int64)
 	Timestamp() int64
+	SetSessionID(uint32)
+	SessionID() uint32
+	LastQuery() string
+	IdleTime() int64
 	Execute(string) (*sqltypes.Result, error)
 	ExecuteStreamFetch(string) (driver.Rows, error)
 	ExecuteWithLimits(query string, timeout int, maxmem int) (*sqltypes.Result, error)
+	ExecuteRawWithLimits(query string, timeout int, maxmem int) (*sqltypes.Result, error)
+	Info() ConnectionInfo
+}
+
+// ConnectionInfo tuple, the state of the backend connection.
+type ConnectionInfo struct {
+	Backend string
+	Address string
+	// ID is the thread id of the connection on the backend.
+	ID        uint32
+	Executing bool
+	// Time is the seconds the query has been executing, or the connection has been idle if it's not executing.
+	Time  int64
+	Query string
 }
 
 type connection struct {
@@ -61,9 +82,16 @@ type connection struct {
 	pool         *Pool
 	lastErr      error // If lastErr is not nil, this connection should be closed.
 	killed       sync2.AtomicBool
+	cancelled    sync2.AtomicBool
 	driver       driver.Conn
 	timestamp    int64 // Recycle timestamp, in seconds.
 	counters     *stats.Counters
+
+	// For the leak detection.
+	sessionID  sync2.AtomicInt32 // The session which owns the connection.
+	lastQuery  sync2.AtomicString
+	lastActive sync2.AtomicInt64 // Last active timestamp, in seconds.
+	executing  sync2.AtomicBool
 }
 
 // NewConnection creates a new connection.
@@ -80,7 +108,7 @@ func NewConnection(log *xlog.Log, pool *Pool) Connection {
 	}
 }
 
-// Dial used to create a new driver conn.
+// Dial used to create a new driver conn, the conn is inited by the pool init query in one round trip.
 func (c *connection) Dial() error {
 	var err error
 	defer mysqlStats.Record("conn.dial", time.Now())
@@ -89,15 +117,48 @@ func (c *connection) Dial() error {
 		c.log.Error("conn[%s].dial.error:%+v", c.address, err)
 		c.counters.Add(poolCounterBackendDialError, 1)
 		c.Close()
-		return errors.New("Server maybe lost, please try again")
+		return xbase.NewRadonError(xbase.ER_RADON_BACKEND_UNAVAILABLE, "Server maybe lost, please try again")
 	}
 	c.connectionID = c.driver.ConnectionID()
+	c.pool.setServerVersion(c.driver.ServerVersion())
 	monitor.BackendConnectionInc(c.address)
+	if query := c.pool.initQuery; query != "" {
+		if err = c.driver.Exec(query); err != nil {
+			c.log.Error("conn[%s].init.query[%s].error:%+v", c.address, query, err)
+			c.counters.Add(poolCounterBackendDialError, 1)
+			c.Close()
+			return err
+		}
+	}
+	if s := c.pool.getSettings(); s != nil {
+		if err = c.applySettings(s); err != nil {
+			c.log.Error("conn[%s].settings.error:%+v", c.address, err)
+			c.counters.Add(poolCounterBackendDialError, 1)
+			c.Close()
+			return err
+		}
+	}
+	c.lastActive.Set(c.pool.Clock().Now().Unix())
 	return nil
 }
 
+// applySettings used to set the declared session variables in the enforce mode and check all the variables.
+func (c *connection) applySettings(s *settings) error {
+	if s.setQuery != "" {
+		if err := c.driver.Exec(s.setQuery); err != nil {
+			return err
+		}
+	}
+	qr, err := c.driver.FetchAll(s.checkQuery, -1)
+	if err != nil {
+		return err
+	}
+	return s.check(qr)
+}
+
 // Ping used to do ping.
 func (c *connection) Ping() error {
+	c.lastActive.Set(c.pool.Clock().Now().Unix())
 	return c.driver.Ping()
 }
 
@@ -110,7 +171,7 @@ func (c *connection) ID() uint32 {
 // This is SQLCOM_CHANGE_DB command not COM_INIT_DB.
 func (c *connection) UseDB(db string) error {
 	if db != "" {
-		query := fmt.Sprintf("use %s", db)
+		query := fmt.Sprintf("use %s", sqlparser.Backtick(db))
 		if _, err := c.Execute(query); err != nil {
 			return err
 		}
@@ -128,23 +189,58 @@ func (c *connection) Timestamp() int64 {
 	return c.timestamp
 }
 
+// SetSessionID used to set the session id which owns the connection.
+func (c *connection) SetSessionID(id uint32) {
+	c.sessionID.Set(int32(id))
+}
+
+// SessionID returns the session id which owns the connection.
+func (c *connection) SessionID() uint32 {
+	return uint32(c.sessionID.Get())
+}
+
+// LastQuery returns the last query executed by the connection.
+func (c *connection) LastQuery() string {
+	return c.lastQuery.Get()
+}
+
+// IdleTime returns the seconds since the connection was last active, 0 if it is executing.
+func (c *connection) IdleTime() int64 {
+	if c.executing.Get() {
+		return 0
+	}
+	return c.pool.Clock().Now().Unix() - c.lastActive.Get()
+}
+
+// active used to mark the connection active for the leak detection.
+func (c *connection) active(query string) func() {
+	q := query
+	if len(q) > 128 {
+		q = q[:128]
+	}
+	c.lastQuery.Set(q)
+	c.executing.Set(true)
+	c.lastActive.Set(c.pool.Clock().Now().Unix())
+	return func() {
+		c.lastActive.Set(c.pool.Clock().Now().Unix())
+		c.executing.Set(false)
+	}
+}
+
 // setDeadline used to set deadline for a query.
 func (c *connection) setDeadline(timeout int) (chan bool, *sync.WaitGroup) {
 	var wg sync.WaitGroup
 	done := make(chan bool, 1)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
+	timer := c.pool.Clock().After(time.Duration(timeout) * time.Millisecond)
 	wg.Add(1)
 	go func() {
-		defer func() {
-			wg.Done()
-			cancel()
-		}()
+		defer wg.Done()
 		select {
-		case <-ctx.Done():
+		case <-timer:
 			c.counters.Add(poolCounterBackendExecuteTimeout, 1)
 			c.killed.Set(true)
-			reason := ctx.Err().Error()
+			reason := context.DeadlineExceeded.Error()
 			c.Kill(reason)
 		case <-done:
 			return
@@ -161,11 +257,25 @@ func (c *connection) Execute(query string) (*sqltypes.Result, error) {
 // Execute used to execute a query through this connection.
 // if timeout or memlimits is 0, means there is not limits.
 func (c *connection) ExecuteWithLimits(query string, timeout int, memlimits int) (*sqltypes.Result, error) {
+	return c.executeWithLimits(query, timeout, memlimits, false)
+}
+
+// ExecuteRawWithLimits same as ExecuteWithLimits, but the row packets are also kept in the result RawRows,
+// so the rows can be written to the client without encoding again.
+func (c *connection) ExecuteRawWithLimits(query string, timeout int, memlimits int) (*sqltypes.Result, error) {
+	return c.executeWithLimits(query, timeout, memlimits, true)
+}
+
+func (c *connection) executeWithLimits(query string, timeout int, memlimits int, raw bool) (*sqltypes.Result, error) {
 	var err error
 	var qr *sqltypes.Result
+	var raws [][]byte
 	log := c.log
 	defer mysqlStats.Record("Connection.Execute", time.Now())
 
+	query = compatRewrite(c.pool.CompatMode(), query)
+	defer c.active(query)()
+
 	// Query details.
 	qd := NewQueryDetail(c, query)
 	qz.Add(qd)
@@ -187,9 +297,13 @@ func (c *connection) ExecuteWithLimits(query string, timeout int, memlimits int)
 		if memlimits > 0 {
 			if rows.Bytes() > memlimits {
 				c.counters.Add(poolCounterBackendExecuteMaxresult, 1)
-				return fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", memlimits)
+				return xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, max memory usage[%d bytes] exceeded", memlimits)
 			}
 		}
+		// The row values are decoded as the slices of this packet, keeping it adds no copy of the row.
+		if raw {
+			raws = append(raws, rows.Datas())
+		}
 		return nil
 	}
 
@@ -198,6 +312,7 @@ func (c *connection) ExecuteWithLimits(query string, timeout int, memlimits int)
 	defer c.mu.Unlock()
 
 	// execute.
+	c.cancelled.Set(false)
 	if qr, err = c.driver.FetchAllWithFunc(query, -1, checkFunc); err != nil {
 		c.counters.Add(poolCounterBackendExecuteAllError, 1)
 		if len(query) > queryLogMaxLen {
@@ -206,22 +321,61 @@ func (c *connection) ExecuteWithLimits(query string, timeout int, memlimits int)
 		log.Error("conn[%s].execute[%s].len[%d].error:%+v", c.address, query, len(query), err)
 		c.lastErr = err
 
+		// Query is cancelled.
+		if c.cancelled.Get() {
+			return nil, errQueryCancelled()
+		}
+
 		// Connection is killed.
 		if c.killed.Get() {
-			return nil, fmt.Errorf("Query execution was interrupted, timeout[%dms] exceeded", timeout)
+			return nil, xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, timeout[%dms] exceeded", timeout)
 		}
 
 		// Connection is broken(closed by server).
 		if err == io.EOF {
-			return nil, errors.New("Server maybe lost, please try again")
+			return nil, xbase.NewRadonError(xbase.ER_RADON_BACKEND_UNAVAILABLE, "Server maybe lost, please try again")
 		}
 		return nil, err
 	}
+	if len(raws) == len(qr.Rows) {
+		qr.RawRows = raws
+	}
 	return qr, nil
 }
 
+// ExecuteStreamFetch used to execute the query and returns the rows cursor, the connection is executing until
+// the rows are all read or the cursor is closed.
 func (c *connection) ExecuteStreamFetch(query string) (driver.Rows, error) {
-	return c.driver.Query(query)
+	query = compatRewrite(c.pool.CompatMode(), query)
+	done := c.active(query)
+	rows, err := c.driver.Query(query)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	return &streamRows{Rows: rows, done: done}, nil
+}
+
+// streamRows is the rows cursor of the stream fetch, the done is called once the stream is finished.
+type streamRows struct {
+	driver.Rows
+	once sync.Once
+	done func()
+}
+
+// Next impl.
+func (r *streamRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.once.Do(r.done)
+	return false
+}
+
+// Close impl.
+func (r *streamRows) Close() error {
+	r.once.Do(r.done)
+	return r.Rows.Close()
 }
 
 // Kill used to kill current connection.
@@ -242,6 +396,33 @@ func (c *connection) Kill(reason string) error {
 	return nil
 }
 
+// KillQuery used to kill the executing query of the connection, the connection is kept.
+func (c *connection) KillQuery(reason string) error {
+	if !c.executing.Get() {
+		return nil
+	}
+	c.counters.Add(poolCounterBackendCancelled, 1)
+	c.cancelled.Set(true)
+	kill, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer kill.Recycle()
+
+	c.log.Warning("conn[%s, ID:%v].query.be.killed.by[%v].reason[%s]", c.address, c.ID(), kill.ID(), reason)
+	query := fmt.Sprintf("KILL QUERY %d", c.connectionID)
+	if _, err = kill.Execute(query); err != nil {
+		c.log.Warning("conn[%s, ID:%v].kill.query.error:%+v", c.address, c.ID(), err)
+		return err
+	}
+	return nil
+}
+
+// errQueryCancelled returns the error of the query cancelled by the KillQuery or the txn Cancel.
+func errQueryCancelled() error {
+	return xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, the query is cancelled")
+}
+
 // Recycle used to put current to pool.
 func (c *connection) Recycle() {
 	defer mysqlStats.Record("conn.recycle", time.Now())
@@ -250,6 +431,18 @@ func (c *connection) Recycle() {
 	}
 }
 
+// Info returns the state of the connection, the query is the executing or the last one.
+func (c *connection) Info() ConnectionInfo {
+	return ConnectionInfo{
+		Backend:   c.pool.conf.Name,
+		Address:   c.address,
+		ID:        c.connectionID,
+		Executing: c.executing.Get(),
+		Time:      c.pool.Clock().Now().Unix() - c.lastActive.Get(),
+		Query:     c.lastQuery.Get(),
+	}
+}
+
 // Address returns the backend address of the connection.
 func (c *connection) Address() string {
 	return c.address
@@ -259,6 +452,7 @@ func (c *connection) Address() string {
 func (c *connection) Close() {
 	defer mysqlStats.Record("conn.close", time.Now())
 	c.lastErr = errors.New("I.am.closed")
+	c.pool.checkin(c)
 	if c.driver != nil {
 		c.driver.Close()
 		monitor.BackendConnectionDec(c.address)
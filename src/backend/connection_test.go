@@ -12,12 +12,15 @@ import (
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"fakedb"
+	"xbase"
 
 	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -41,7 +44,7 @@ func TestConnection(t *testing.T) {
 
 	// usedb
 	{
-		fakedb.AddQuery("USE MOCKDB", result2)
+		fakedb.AddQuery("USE `MOCKDB`", result2)
 		err := conn.UseDB("MOCKDB")
 		assert.Nil(t, err)
 	}
@@ -49,7 +52,7 @@ func TestConnection(t *testing.T) {
 	sqlErr := sqldb.NewSQLError(sqldb.ER_UNKNOWN_ERROR, "query.error")
 	// usedb error
 	{
-		fakedb.AddQueryError("USE USEDBERROR", sqlErr)
+		fakedb.AddQueryError("USE `USEDBERROR`", sqlErr)
 		err := conn.UseDB("USEDBERROR")
 		want := "query.error (errno 1105) (sqlstate HY000)"
 		got := err.Error()
@@ -57,7 +60,7 @@ func TestConnection(t *testing.T) {
 	}
 	// again
 	{
-		fakedb.AddQueryError("USE USEDBERROR", sqlErr)
+		fakedb.AddQueryError("USE `USEDBERROR`", sqlErr)
 		err := conn.UseDB("USEDBERROR")
 		want := "query.error (errno 1105) (sqlstate HY000)"
 		got := err.Error()
@@ -71,6 +74,41 @@ func TestConnection(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, result1, r)
 	}
+
+	// execute raw
+	{
+		fakedb.AddQuery("SELECT1", result1)
+		r, err := conn.ExecuteRawWithLimits("SELECT1", 0, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, result1.Rows, r.Rows)
+		assert.True(t, r.HasRawRows())
+		for i, row := range r.Rows {
+			buf := common.NewBuffer(16)
+			for _, val := range row {
+				buf.WriteLenEncodeBytes(val.Raw())
+			}
+			assert.Equal(t, buf.Datas(), r.RawRows[i])
+		}
+		// The values are the slices of the packets, not the copies.
+		raw, val := r.RawRows[0], r.Rows[0][0].Raw()
+		assert.True(t, &val[0] == &raw[1])
+		assert.Equal(t, int64(len(r.RawRows[0])+len(r.RawRows[1])), resultBytes(r))
+	}
+
+	// stream fetch, the connection is executing until the rows are all read.
+	{
+		fakedb.AddQueryStream("SELECT2", result1)
+		cursor, err := conn.ExecuteStreamFetch("SELECT2")
+		assert.Nil(t, err)
+		assert.True(t, conn.Info().Executing)
+		rows := 0
+		for cursor.Next() {
+			rows++
+		}
+		assert.Equal(t, len(result1.Rows), rows)
+		assert.False(t, conn.Info().Executing)
+		assert.Nil(t, cursor.Close())
+	}
 }
 
 func TestConnectionRecyle(t *testing.T) {
@@ -87,7 +125,7 @@ func TestConnectionRecyle(t *testing.T) {
 
 	// usedb
 	{
-		fakedb.AddQuery("USE MOCKDB", result2)
+		fakedb.AddQuery("USE `MOCKDB`", result2)
 		err := conn.UseDB("MOCKDB")
 		assert.Nil(t, err)
 		conn.Recycle()
@@ -114,7 +152,7 @@ func TestConnectionKill(t *testing.T) {
 
 	// check
 	{
-		fakedb.AddQuery("USE MOCKDB", result2)
+		fakedb.AddQuery("USE `MOCKDB`", result2)
 		err := conn.UseDB("MOCKDB")
 		assert.NotNil(t, err)
 	}
@@ -162,6 +200,57 @@ func TestConnectionExecuteTimeout(t *testing.T) {
 	}
 }
 
+func TestConnectionExecuteTimeoutClock(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+
+	// MySQL Server starts...
+	fakedb := fakedb.New(log, 1)
+	defer fakedb.Close()
+	fakedb.SetClock(clock)
+
+	pool := NewPool(log, fakedb.BackendConfs()[0])
+	defer pool.Close()
+	pool.SetClock(clock)
+	conn, err := pool.Get()
+	assert.Nil(t, err)
+	defer conn.Recycle()
+
+	// The deadline is reached before the delay.
+	{
+		fakedb.AddQueryDelay("SELECT2", result2, 1000)
+		errc := make(chan error, 1)
+		go func() {
+			_, err := conn.ExecuteWithLimits("SELECT2", 100, 0)
+			errc <- err
+		}()
+		// The deadline and the delay.
+		assert.True(t, clock.WaitForWaiters(2, time.Second))
+		clock.Advance(100 * time.Millisecond)
+		err := <-errc
+		assert.NotNil(t, err)
+		assert.Equal(t, "Query execution was interrupted, timeout[100ms] exceeded (errno 9002) (sqlstate HY000)", err.Error())
+	}
+
+	// The delay is done before the deadline.
+	{
+		conn, err := pool.Get()
+		assert.Nil(t, err)
+		defer conn.Recycle()
+		fakedb.AddQueryDelay("SELECT3", result2, 100)
+		waiters := clock.Waiters()
+		errc := make(chan error, 1)
+		go func() {
+			_, err := conn.ExecuteWithLimits("SELECT3", 1000, 0)
+			errc <- err
+		}()
+		assert.True(t, clock.WaitForWaiters(waiters+2, time.Second))
+		clock.Advance(100 * time.Millisecond)
+		assert.Nil(t, <-errc)
+	}
+}
+
 func TestConnectionMemoryCheck(t *testing.T) {
 	defer leaktest.Check(t)()
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -176,7 +265,7 @@ func TestConnectionMemoryCheck(t *testing.T) {
 	{
 		fakedb.AddQuery("SELECT2", result2)
 		_, err := conn.ExecuteWithLimits("SELECT2", 0, 5)
-		want := "Query execution was interrupted, max memory usage[5 bytes] exceeded"
+		want := "Query execution was interrupted, max memory usage[5 bytes] exceeded (errno 9002) (sqlstate HY000)"
 		got := err.Error()
 		assert.Equal(t, want, got)
 	}
@@ -0,0 +1,62 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"fmt"
+	"strings"
+
+	"monitor"
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/sqldb"
+)
+
+// The phases of the backend errors.
+const (
+	phaseConnect = "connect"
+	phaseExecute = "execute"
+)
+
+var xaPhases = map[txnXAState]string{
+	txnXAStateStart:    "xa start",
+	txnXAStateEnd:      "xa end",
+	txnXAStatePrepare:  "xa prepare",
+	txnXAStateCommit:   "xa commit",
+	txnXAStateRollback: "xa rollback",
+}
+
+// shardError used to attach the shard context to the backend error, the context is rendered into
+// the message such as '... (backend:node1, table:db.t1_0002, phase:execute)', the errno and sqlstate are kept.
+// The errors without the errno are unknown, or unavailable if the backend can't be connected.
+func (txn *Txn) shardError(backend string, table string, phase string, err error) error {
+	se, ok := err.(*sqldb.SQLError)
+	if !ok {
+		num := uint16(sqldb.ER_UNKNOWN_ERROR)
+		if phase == phaseConnect {
+			num = xbase.ER_RADON_BACKEND_UNAVAILABLE
+		}
+		se = xbase.NewRadonError(num, "%v", err)
+	}
+
+	ctx := []string{"backend:" + backend}
+	if table != "" {
+		ctx = append(ctx, "table:"+table)
+	}
+	ctx = append(ctx, "phase:"+phase)
+
+	txn.log.Error("txn.shard.error[%s].errno[%d]:%s", strings.Join(ctx, ", "), se.Num, se.Message)
+	monitor.BackendErrorInc(backend, phase, se.Num)
+	return &sqldb.SQLError{
+		Num:     se.Num,
+		State:   se.State,
+		Message: fmt.Sprintf("%s (%s)", se.Message, strings.Join(ctx, ", ")),
+		Query:   se.Query,
+	}
+}
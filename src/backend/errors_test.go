@@ -0,0 +1,71 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"xcontext"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestTxnShardError(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from test.t1_0000", Backend: addrs[0], Table: "test.t1_0000"},
+		xcontext.QueryTuple{Query: "select * from test.t1_0001", Backend: addrs[0], Table: "test.t1_0001"},
+	}
+	fakedb.AddQuery(querys[0].Query, result1)
+	fakedb.AddQueryError(querys[1].Query, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, "test.t1_0001"))
+
+	// The errno is kept, the failed segment is in the message.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		rctx := &xcontext.RequestContext{
+			Mode:   xcontext.ReqNormal,
+			Querys: querys,
+		}
+		_, err = txn.Execute(rctx)
+		want := fmt.Sprintf("Table 'test.t1_0001' doesn't exist (backend:%s, table:test.t1_0001, phase:execute) (errno 1146) (sqlstate 42S02)", addrs[0])
+		assert.Equal(t, want, err.Error())
+		sqlErr, ok := err.(*sqldb.SQLError)
+		assert.True(t, ok)
+		assert.Equal(t, uint16(sqldb.ER_NO_SUCH_TABLE), sqlErr.Num)
+	}
+
+	// The xa phase.
+	{
+		fakedb.AddQueryPattern("XA START .*", result1)
+		fakedb.AddQueryPattern("XA END .*", result1)
+		fakedb.AddQueryErrorPattern("XA PREPARE .*", errors.New("mock.xa.prepare.error"))
+		fakedb.AddQueryPattern("XA ROLLBACK .*", result1)
+
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		err = txn.BeginScatter()
+		assert.Nil(t, err)
+		err = txn.CommitScatter()
+		assert.Regexp(t, `^mock.xa.prepare.error \(backend:.*, phase:xa prepare\) \(errno 1105\) \(sqlstate HY000\)$`, err.Error())
+	}
+}
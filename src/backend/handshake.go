@@ -0,0 +1,66 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"bytes"
+	"strings"
+
+	"config"
+
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// handshake tuple, the server data detected at greeting and cached by the pool,
+// it's rebuilt only if the server version changed, such as the backend upgraded.
+type handshake struct {
+	version string
+	compat  string
+}
+
+func newHandshake(version string) *handshake {
+	return &handshake{
+		version: version,
+		compat:  compatMode(version),
+	}
+}
+
+// initQuery returns the query to init the new connections of the backend in one round trip,
+// empty means nothing to do.
+// The known charset is set by the handshake collation, the others fall back to utf8 there and are set by NAMES.
+func initQuery(conf *config.BackendConfig) string {
+	var vars []string
+	if charset := strings.ToLower(conf.Charset); charset != "" {
+		if _, ok := sqldb.CharacterSetMap[charset]; !ok {
+			vars = append(vars, "NAMES "+quote(charset))
+		}
+	}
+	if conf.SQLMode != "" {
+		vars = append(vars, "sql_mode = "+quote(conf.SQLMode))
+	}
+	if conf.Autocommit != nil {
+		if *conf.Autocommit {
+			vars = append(vars, "autocommit = 1")
+		} else {
+			vars = append(vars, "autocommit = 0")
+		}
+	}
+	if len(vars) == 0 {
+		return ""
+	}
+	return "SET " + strings.Join(vars, ", ")
+}
+
+func quote(s string) string {
+	buf := &bytes.Buffer{}
+	sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(s)).EncodeSQL(buf)
+	return buf.String()
+}
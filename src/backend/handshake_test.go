@@ -0,0 +1,88 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestInitQuery(t *testing.T) {
+	on := true
+	off := false
+	tests := []struct {
+		charset    string
+		sqlMode    string
+		autocommit *bool
+		want       string
+	}{
+		{"utf8", "", nil, ""},
+		{"UTF8MB4", "", nil, ""},
+		{"", "", nil, ""},
+		{"utf8mb3", "", nil, "SET NAMES 'utf8mb3'"},
+		{"utf8", "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", nil, "SET sql_mode = 'STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION'"},
+		{"utf8", "", &on, "SET autocommit = 1"},
+		{"gb18030", "ANSI'", &off, "SET NAMES 'gb18030', sql_mode = 'ANSI\\'', autocommit = 0"},
+	}
+	for _, test := range tests {
+		conf := MockBackendConfigDefault("node1", "")
+		conf.Charset = test.charset
+		conf.SQLMode = test.sqlMode
+		conf.Autocommit = test.autocommit
+		assert.Equal(t, test.want, initQuery(conf))
+	}
+}
+
+func TestPoolInitQuery(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb := fakedb.New(log, 1)
+	defer fakedb.Close()
+	addr := fakedb.Addrs()[0]
+
+	on := true
+	query := "SET sql_mode = 'ANSI', autocommit = 1"
+	conf := MockBackendConfigDefault("node1", addr)
+	conf.SQLMode = "ANSI"
+	conf.Autocommit = &on
+	pool := NewPool(log, conf)
+	defer pool.Close()
+
+	// The init query is sent once per new connection.
+	{
+		fakedb.AddQuery(query, result1)
+		conn1, err := pool.Get()
+		assert.Nil(t, err)
+		conn2, err := pool.Get()
+		assert.Nil(t, err)
+		hs := pool.getHandshake()
+		conn1.Close()
+		conn2.Close()
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(query))
+
+		// The handshake is cached if the server version not changed.
+		conn3, err := pool.Get()
+		assert.Nil(t, err)
+		conn3.Close()
+		assert.Equal(t, 3, fakedb.GetQueryCalledNum(query))
+		assert.True(t, hs == pool.getHandshake())
+		assert.Equal(t, "FakeDB", pool.ServerVersion())
+	}
+
+	// The init query error.
+	{
+		fakedb.AddQueryError(query, errors.New("mock.init.error"))
+		_, err := pool.Get()
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"sync"
+	"time"
+
+	"xbase"
+)
+
+// Hedge is the limits of the hedged reads.
+// The point select to the replicas is sent to the fastest replica first, and also to a second target
+// if it's not done in the delay(in millisecond), the first response wins and the other is killed.
+// The hedges are capped by the max-rate per second.
+type Hedge struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	maxRate int
+	// The hedges sent in the second starts from the since.
+	since time.Time
+	sent  int
+	clock xbase.AtomicClock
+}
+
+// NewHedge creates the new Hedge, the reads are not hedged.
+func NewHedge() *Hedge {
+	return &Hedge{}
+}
+
+// SetClock used to set the clock of the delay and the rate.
+func (h *Hedge) SetClock(clock xbase.Clock) {
+	h.clock.Set(clock)
+}
+
+// SetLimits used to set the delay(in millisecond) and the max hedges per second,
+// 0 delay disables the hedged reads and 0 max-rate means no limits.
+func (h *Hedge) SetLimits(delay int, maxRate int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delay = time.Duration(delay) * time.Millisecond
+	h.maxRate = maxRate
+}
+
+// Delay returns the delay of the hedges, 0 if the hedged reads are disabled.
+func (h *Hedge) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+// after returns the channel fired when the delay passed.
+func (h *Hedge) after() <-chan time.Time {
+	return h.clock.Get().After(h.Delay())
+}
+
+// acquire returns true if the hedge can be sent under the max-rate.
+func (h *Hedge) acquire() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.maxRate <= 0 {
+		return true
+	}
+	now := h.clock.Get().Now()
+	if now.Sub(h.since) >= time.Second {
+		h.since = now
+		h.sent = 0
+	}
+	if h.sent >= h.maxRate {
+		return false
+	}
+	h.sent++
+	return true
+}
@@ -0,0 +1,161 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"fakedb"
+	"xbase"
+	"xcontext"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestHedgeAcquire(t *testing.T) {
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	hedge := NewHedge()
+	hedge.SetClock(clock)
+	assert.Equal(t, time.Duration(0), hedge.Delay())
+
+	// No limits.
+	for i := 0; i < 10; i++ {
+		assert.True(t, hedge.acquire())
+	}
+
+	// 2 hedges per second.
+	hedge.SetLimits(5, 2)
+	assert.Equal(t, 5*time.Millisecond, hedge.Delay())
+	clock.Advance(time.Second)
+	assert.True(t, hedge.acquire())
+	assert.True(t, hedge.acquire())
+	assert.False(t, hedge.acquire())
+	clock.Advance(999 * time.Millisecond)
+	assert.False(t, hedge.acquire())
+	clock.Advance(time.Millisecond)
+	assert.True(t, hedge.acquire())
+}
+
+func TestHedgeTargets(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	pool := NewPool(log, MockBackendConfigDefault("node1", "127.0.0.1:3306"))
+	first, second := pool.hedgeTargets()
+	assert.Nil(t, first)
+	assert.Nil(t, second)
+
+	// One replica, the second is the primary.
+	conf := MockBackendConfigDefault("node1", "127.0.0.1:3306")
+	conf.Replicas = []string{"127.0.0.1:3307"}
+	pool = NewPool(log, conf)
+	first, second = pool.hedgeTargets()
+	assert.Equal(t, "127.0.0.1:3307", first.conf.Address)
+	assert.Equal(t, pool, second)
+
+	// The fastest replicas.
+	conf.Replicas = []string{"127.0.0.1:3307", "127.0.0.1:3308", "127.0.0.1:3309"}
+	pool = NewPool(log, conf)
+	pool.replicas[0].observeLatency(30 * time.Millisecond)
+	pool.replicas[1].observeLatency(10 * time.Millisecond)
+	pool.replicas[2].observeLatency(20 * time.Millisecond)
+	first, second = pool.hedgeTargets()
+	assert.Equal(t, "127.0.0.1:3308", first.conf.Address)
+	assert.Equal(t, "127.0.0.1:3309", second.conf.Address)
+
+	// The moving average.
+	pool.replicas[1].observeLatency(170 * time.Millisecond)
+	assert.Equal(t, 30*time.Millisecond, pool.replicas[1].Latency())
+	first, _ = pool.hedgeTargets()
+	assert.Equal(t, "127.0.0.1:3309", first.conf.Address)
+}
+
+func TestTxnHedgedRead(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	fakedbs, txnMgr, _, addrs, cleanup := MockTxnMgr(log, 1)
+	defer cleanup()
+	replicas := fakedb.New(log, 1)
+	defer replicas.Close()
+
+	// The replica is slow, the primary is fast.
+	conf := MockBackendConfigDefault("backend", addrs[0])
+	conf.Replicas = replicas.Addrs()
+	backends := map[string]*Pool{"backend": NewPool(log, conf)}
+	defer backends["backend"].Close()
+
+	querys := []xcontext.QueryTuple{
+		{Query: "select * from node1 where id=1", Backend: "backend"},
+		{Query: "select * from node1 where id=2", Backend: "backend"},
+		{Query: "select * from node1 where id=3", Backend: "backend"},
+	}
+	fakedbs.AddQuery(querys[0].Query, result1)
+	replicas.AddQueryDelay(querys[0].Query, result2, 1000)
+	fakedbs.AddQuery(querys[1].Query, result1)
+	replicas.AddQuery(querys[1].Query, result2)
+	fakedbs.AddQuery(querys[2].Query, result1)
+	replicas.AddQueryError(querys[2].Query, errors.New("mock.replica.error"))
+
+	execute := func(tuple xcontext.QueryTuple) (*sqltypes.Result, error) {
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+		txn.SetReplica(true)
+		return txn.Execute(&xcontext.RequestContext{TxnMode: xcontext.TxnRead, Querys: []xcontext.QueryTuple{tuple}})
+	}
+
+	// Not hedged.
+	{
+		got, err := execute(querys[1])
+		assert.Nil(t, err)
+		assert.Equal(t, result2, got)
+	}
+
+	// The replica is done before the delay.
+	txnMgr.hedge.SetLimits(1000, 0)
+	{
+		got, err := execute(querys[1])
+		assert.Nil(t, err)
+		assert.Equal(t, result2, got)
+	}
+
+	// The replica fails, the hedge is sent at once.
+	{
+		got, err := execute(querys[2])
+		assert.Nil(t, err)
+		assert.Equal(t, result1, got)
+	}
+
+	// The primary wins after the delay.
+	txnMgr.hedge.SetLimits(10, 0)
+	{
+		won := txnCounters.Counts()[txnCounterHedgeWon]
+		latency := backends["backend"].replicas[0].Latency()
+		got, err := execute(querys[0])
+		assert.Nil(t, err)
+		assert.Equal(t, result1, got)
+		assert.Equal(t, won+1, txnCounters.Counts()[txnCounterHedgeWon])
+		// The lost replica is slower.
+		assert.True(t, backends["backend"].replicas[0].Latency() > latency)
+	}
+
+	// The hedges are throttled.
+	{
+		txnMgr.hedge.SetLimits(10, 1)
+		assert.True(t, txnMgr.hedge.acquire())
+		_, err := execute(querys[2])
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "mock.replica.error")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"monitor"
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	memoryBackoffQueued   = "queued"
+	memoryBackoffRejected = "rejected"
+)
+
+// Memory is the accountant of the result bytes held by the in-flight querys.
+// Once the high-water is reached, the new scatter querys wait for the bytes released
+// for the queue-time(in millisecond), or fail at once if the queue-time is 0.
+type Memory struct {
+	log       *xlog.Log
+	mu        sync.Mutex
+	used      int64
+	highWater int64
+	queueTime int
+	// released is closed and renewed once some bytes are released.
+	released chan struct{}
+	clock    xbase.AtomicClock
+}
+
+// NewMemory creates the new Memory without limits.
+func NewMemory(log *xlog.Log) *Memory {
+	return &Memory{
+		log:      log,
+		released: make(chan struct{}),
+	}
+}
+
+// SetClock used to set the clock of the queue-time.
+func (m *Memory) SetClock(clock xbase.Clock) {
+	m.clock.Set(clock)
+}
+
+// SetLimits used to set the high-water(in bytes) and the queue-time(in millisecond), 0 high-water means no limits.
+func (m *Memory) SetLimits(highWater int, queueTime int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.highWater = int64(highWater)
+	m.queueTime = queueTime
+}
+
+// Used returns the bytes held by the in-flight querys.
+func (m *Memory) Used() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// Admit used to wait for the memory below the high-water before the scatter query runs.
+func (m *Memory) Admit(ctx context.Context) error {
+	m.mu.Lock()
+	if m.highWater <= 0 || m.used < m.highWater {
+		m.mu.Unlock()
+		return nil
+	}
+
+	highWater, queueTime := m.highWater, m.queueTime
+	if queueTime <= 0 {
+		m.mu.Unlock()
+		return m.reject(highWater)
+	}
+
+	monitor.MemoryBackoffInc(memoryBackoffQueued)
+	timeout := m.clock.Get().After(time.Duration(queueTime) * time.Millisecond)
+	for m.highWater > 0 && m.used >= m.highWater {
+		released := m.released
+		m.mu.Unlock()
+		select {
+		case <-released:
+		case <-timeout:
+			return m.reject(highWater)
+		case <-ctx.Done():
+			return xbase.NewContextError(ctx)
+		}
+		m.mu.Lock()
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) reject(highWater int64) error {
+	monitor.MemoryBackoffInc(memoryBackoffRejected)
+	m.log.Warning("memory.high.water[%d].reached.the.scatter.query.rejected", highWater)
+	return xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, memory high water[%d bytes] reached", highWater)
+}
+
+// Grow used to account the bytes held by the query.
+func (m *Memory) Grow(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used += bytes
+	monitor.MemoryUsedSet(float64(m.used))
+}
+
+// Shrink used to release the bytes accounted by the Grow, the waiting querys are woken up.
+func (m *Memory) Shrink(bytes int64) {
+	if bytes == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used -= bytes
+	monitor.MemoryUsedSet(float64(m.used))
+	close(m.released)
+	m.released = make(chan struct{})
+}
+
+// resultBytes returns the bytes held by the rows of the result.
+// The values of the rows with the packets are slices of the packets, so the packets are counted instead of the values.
+func resultBytes(qr *sqltypes.Result) int64 {
+	var bytes int64
+	if qr.HasRawRows() {
+		for _, raw := range qr.RawRows {
+			bytes += int64(len(raw))
+		}
+		return bytes
+	}
+	for _, row := range qr.Rows {
+		bytes += int64(sqltypes.Values(row).Len())
+	}
+	return bytes
+}
@@ -0,0 +1,110 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"xbase"
+	"xcontext"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestMemoryAdmit(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+
+	memory := NewMemory(log)
+	memory.SetClock(clock)
+
+	// No limits.
+	memory.Grow(100)
+	assert.Nil(t, memory.Admit(context.Background()))
+	assert.Equal(t, int64(100), memory.Used())
+
+	// Fail fast.
+	memory.SetLimits(100, 0)
+	err := memory.Admit(context.Background())
+	assert.Equal(t, "Query execution was interrupted, memory high water[100 bytes] reached (errno 9002) (sqlstate HY000)", err.Error())
+
+	// Queued until the memory released.
+	memory.SetLimits(100, 1000)
+	done := make(chan error)
+	go func() {
+		done <- memory.Admit(context.Background())
+	}()
+	assert.True(t, clock.WaitForWaiters(1, time.Second))
+	memory.Shrink(50)
+	assert.Nil(t, <-done)
+	assert.Equal(t, int64(50), memory.Used())
+
+	// Queued until the queue time exceeded, the timer of the last wait is still there.
+	memory.Grow(50)
+	go func() {
+		done <- memory.Admit(context.Background())
+	}()
+	assert.True(t, clock.WaitForWaiters(2, time.Second))
+	clock.Advance(time.Second)
+	err = <-done
+	assert.Equal(t, "Query execution was interrupted, memory high water[100 bytes] reached (errno 9002) (sqlstate HY000)", err.Error())
+
+	// Queued until the request cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- memory.Admit(ctx)
+	}()
+	assert.True(t, clock.WaitForWaiters(1, time.Second))
+	cancel()
+	err = <-done
+	assert.Contains(t, err.Error(), "Query execution was interrupted, the query is cancelled")
+	memory.Shrink(100)
+	assert.Equal(t, int64(0), memory.Used())
+}
+
+func TestMemoryTxn(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+	}
+	fakedb.AddQuery(querys[0].Query, result1)
+	fakedb.AddQuery(querys[1].Query, result1)
+	txnMgr.memory.SetLimits(40, 0)
+	defer txnMgr.memory.SetLimits(0, 0)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	_, err = txn.Execute(&xcontext.RequestContext{Querys: querys})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(50), txnMgr.memory.Used())
+
+	// The scatter query is rejected once the high water reached, the point query isn't.
+	txn1, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	_, err = txn1.Execute(&xcontext.RequestContext{Querys: querys})
+	assert.Contains(t, err.Error(), "Query execution was interrupted, memory high water[40 bytes] reached")
+	_, err = txn1.Execute(&xcontext.RequestContext{Querys: querys[:1]})
+	assert.Nil(t, err)
+	txn1.Finish()
+	assert.Equal(t, int64(50), txnMgr.memory.Used())
+
+	// The results are released by the txn finished.
+	txn.Finish()
+	assert.Equal(t, int64(0), txnMgr.memory.Used())
+}
@@ -12,30 +12,38 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"config"
+	"monitor"
+	"xbase"
 	"xbase/stats"
 
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
 var (
-	poolCounterPing       = "#pool.ping"
-	poolCounterPingBroken = "#pool.ping.broken"
-	poolCounterHit        = "#pool.hit"
-	poolCounterMiss       = "#pool.miss"
-	poolCounterGet        = "#pool.get"
-	poolCounterPut        = "#pool.put"
-	poolCounterClose      = "#pool.close"
+	poolCounterPing           = "#pool.ping"
+	poolCounterPingBroken     = "#pool.ping.broken"
+	poolCounterHit            = "#pool.hit"
+	poolCounterMiss           = "#pool.miss"
+	poolCounterGet            = "#pool.get"
+	poolCounterPut            = "#pool.put"
+	poolCounterClose          = "#pool.close"
+	poolCounterLeak           = "#pool.leak"
+	poolCounterReclaim        = "#pool.leak.reclaim"
+	poolCounterValidate       = "#pool.validate"
+	poolCounterValidateBroken = "#pool.validate.broken"
 
 	poolCounterBackendDialError        = "#backend.dial.error"
 	poolCounterBackendExecuteTimeout   = "#backend.execute.timeout"
 	poolCounterBackendExecuteMaxresult = "#backend.execute.maxresult"
 	poolCounterBackendExecuteAllError  = "#backend.execute.all.error"
 	poolCounterBackendKilled           = "#backend.killed"
+	poolCounterBackendCancelled        = "#backend.cancelled"
 )
 
 var (
@@ -51,8 +59,34 @@ type Pool struct {
 	counters    *stats.Counters
 	connections chan Connection
 
+	// The connections checked out from the pool.
+	inuseMu sync.Mutex
+	inuse   map[Connection]struct{}
+
 	// If maxIdleTime reached, the connection will be closed by get.
 	maxIdleTime int64
+
+	// The *handshake detected at greeting.
+	handshake atomic.Value
+
+	// The query to init the new connections, built once from the conf.
+	initQuery string
+
+	// The *settings of the declared variables checked on the new connections.
+	settings atomic.Value
+
+	// The xbase.Clock of the timestamps, the idle times and the query deadlines.
+	clock xbase.AtomicClock
+
+	// The pools of the read replicas and the round robin counter of them.
+	replicas    []*Pool
+	replicaNext uint32
+
+	// The moving average of the hedged read latencys(in nanosecond), 0 means not measured.
+	latency int64
+
+	// 1 if the idle connections are being validated, the validator skips the pool still validating.
+	validating int32
 }
 
 // NewPool creates the new Pool.
@@ -62,11 +96,89 @@ func NewPool(log *xlog.Log, conf *config.BackendConfig) *Pool {
 		conf:        conf,
 		connections: make(chan Connection, conf.MaxConnections),
 		counters:    stats.NewCounters(conf.Name + "@" + conf.Address),
+		inuse:       make(map[Connection]struct{}),
 		maxIdleTime: int64(maxIdleTime),
+		initQuery:   initQuery(conf),
+	}
+	for _, address := range conf.Replicas {
+		replica := *conf
+		replica.Address = address
+		replica.Replicas = nil
+		p.replicas = append(p.replicas, NewPool(log, &replica))
 	}
 	return p
 }
 
+// Replica returns the pool of the next read replica in the round robin, nil if the backend has no replica.
+func (p *Pool) Replica() *Pool {
+	if len(p.replicas) == 0 {
+		return nil
+	}
+	next := atomic.AddUint32(&p.replicaNext, 1)
+	return p.replicas[next%uint32(len(p.replicas))]
+}
+
+// hedgeTargets returns the fastest replica and the second target of the hedged read,
+// the second is the next fastest replica, or the primary if the backend has one replica.
+func (p *Pool) hedgeTargets() (*Pool, *Pool) {
+	switch len(p.replicas) {
+	case 0:
+		return nil, nil
+	case 1:
+		return p.replicas[0], p
+	}
+	replicas := append([]*Pool(nil), p.replicas...)
+	sort.SliceStable(replicas, func(i, j int) bool {
+		return replicas[i].Latency() < replicas[j].Latency()
+	})
+	return replicas[0], replicas[1]
+}
+
+// Latency returns the moving average of the hedged read latencys, the unmeasured pool is 0 and tried first.
+func (p *Pool) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.latency))
+}
+
+// observeLatency used to move the average latency by the cost of the hedged read.
+func (p *Pool) observeLatency(cost time.Duration) {
+	for {
+		old := atomic.LoadInt64(&p.latency)
+		latency := int64(cost)
+		if old > 0 {
+			latency = old + (latency-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&p.latency, old, latency) {
+			return
+		}
+	}
+}
+
+// SetClock used to set the clock of the pool, the tests use the xbase.FakeClock to move the time.
+func (p *Pool) SetClock(clock xbase.Clock) {
+	p.clock.Set(clock)
+	for _, replica := range p.replicas {
+		replica.SetClock(clock)
+	}
+}
+
+// setSettings used to set the settings of the pool and its replicas, nil means the variables are not checked.
+func (p *Pool) setSettings(s *settings) {
+	p.settings.Store(s)
+	for _, replica := range p.replicas {
+		replica.setSettings(s)
+	}
+}
+
+func (p *Pool) getSettings() *settings {
+	s, _ := p.settings.Load().(*settings)
+	return s
+}
+
+// Clock returns the clock of the pool.
+func (p *Pool) Clock() xbase.Clock {
+	return p.clock.Get()
+}
+
 func (p *Pool) reconnect() (Connection, error) {
 	log := p.log
 	c := NewConnection(log, p)
@@ -74,12 +186,53 @@ func (p *Pool) reconnect() (Connection, error) {
 		log.Error("pool.reconnect.dial.error:%+v", err)
 		return nil, err
 	}
-	c.SetTimestamp(time.Now().Unix())
+	c.SetTimestamp(p.Clock().Now().Unix())
 	return c, nil
 }
 
+// setServerVersion used to cache the handshake of the server version detected at greeting.
+func (p *Pool) setServerVersion(version string) {
+	if hs := p.getHandshake(); hs == nil || hs.version != version {
+		p.handshake.Store(newHandshake(version))
+	}
+}
+
+func (p *Pool) getHandshake() *handshake {
+	hs, _ := p.handshake.Load().(*handshake)
+	return hs
+}
+
+// ServerVersion returns the backend server version detected at greeting.
+func (p *Pool) ServerVersion() string {
+	if hs := p.getHandshake(); hs != nil {
+		return hs.version
+	}
+	return ""
+}
+
+// CompatMode returns the compatibility mode of the backend,
+// the config compat-mode takes precedence over the detected server version.
+func (p *Pool) CompatMode() string {
+	if p.conf.CompatMode != "" {
+		return p.conf.CompatMode
+	}
+	if hs := p.getHandshake(); hs != nil {
+		return hs.compat
+	}
+	return CompatMySQL57
+}
+
 // Get used to get a connection from the pool.
 func (p *Pool) Get() (Connection, error) {
+	conn, err := p.get()
+	if err != nil {
+		return nil, err
+	}
+	p.checkout(conn)
+	return conn, nil
+}
+
+func (p *Pool) get() (Connection, error) {
 	counters := p.counters
 	counters.Add(poolCounterGet, 1)
 
@@ -95,7 +248,7 @@ func (p *Pool) Get() (Connection, error) {
 		}
 		// If the idle time more than 1s,
 		// we will do a ping to check the connection is OK or NOT.
-		now := time.Now().Unix()
+		now := p.Clock().Now().Unix()
 		elapsed := (now - conn.Timestamp())
 		if elapsed > 1 {
 			// If elapsed time more than 20s, we create new one.
@@ -125,14 +278,22 @@ func (p *Pool) Put(conn Connection) {
 
 func (p *Pool) put(conn Connection, updateTs bool) {
 	p.counters.Add(poolCounterPut, 1)
+	p.checkin(conn)
+	p.release(conn, updateTs)
+}
+
+// release used to send the idle connection back to the pool, it's closed if the pool is closed or full.
+func (p *Pool) release(conn Connection, updateTs bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if p.connections == nil {
+		// The pool is closed, such as the backend removed or its primary switched.
+		conn.Close()
 		return
 	}
 
 	if updateTs {
-		conn.SetTimestamp(time.Now().Unix())
+		conn.SetTimestamp(p.Clock().Now().Unix())
 	}
 	select {
 	case p.connections <- conn:
@@ -143,6 +304,9 @@ func (p *Pool) put(conn Connection, updateTs bool) {
 
 // Close used to close the pool.
 func (p *Pool) Close() {
+	for _, replica := range p.replicas {
+		replica.Close()
+	}
 	p.counters.Add(poolCounterClose, 1)
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -156,6 +320,119 @@ func (p *Pool) Close() {
 	p.connections = nil
 }
 
+// ValidateIdle used to validate the connections idle in the pool for more than the validate-idle-time by the
+// validate-strategy of the backend, the broken ones are closed and the others are sent back to the pool.
+// It returns the number of the connections validated and broken, the replicas included.
+func (p *Pool) ValidateIdle() (validated int, broken int) {
+	for _, replica := range p.replicas {
+		v, b := replica.ValidateIdle()
+		validated, broken = validated+v, broken+b
+	}
+
+	strategy := p.conf.ValidateStrategy
+	switch strategy {
+	case ValidateNone:
+		return
+	case "":
+		strategy = ValidatePing
+	}
+	if !atomic.CompareAndSwapInt32(&p.validating, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&p.validating, 0)
+
+	idleTime := int64(p.conf.ValidateIdleTime)
+	if idleTime <= 0 {
+		idleTime = defaultValidateIdleTime
+	}
+	conns := p.getConns()
+	if conns == nil {
+		return
+	}
+
+	log := p.log
+	now := p.Clock().Now().Unix()
+	// The connections are taken in turn and the rest are sent back to the tail, so each one is checked once.
+	for i, n := 0, len(conns); i < n; i++ {
+		var conn Connection
+		select {
+		case c, more := <-conns:
+			if !more {
+				return
+			}
+			conn = c
+		default:
+			return
+		}
+		if now-conn.Timestamp() < idleTime {
+			p.release(conn, false)
+			continue
+		}
+
+		var err error
+		switch strategy {
+		case ValidatePing:
+			err = conn.Ping()
+		case ValidateSelect1:
+			_, err = conn.Execute("select 1")
+		}
+		validated++
+		if err != nil {
+			broken++
+			p.counters.Add(poolCounterValidateBroken, 1)
+			monitor.BackendConnectionValidateInc(p.conf.Address, "broken")
+			log.Warning("pool[%s].validate.conn[ID:%v].idle[%ds].by[%s].broken:%v", p.conf.Address, conn.ID(), now-conn.Timestamp(), strategy, err)
+			conn.Close()
+			continue
+		}
+		p.counters.Add(poolCounterValidate, 1)
+		monitor.BackendConnectionValidateInc(p.conf.Address, "ok")
+		p.release(conn, true)
+	}
+	return
+}
+
+func (p *Pool) checkout(conn Connection) {
+	p.inuseMu.Lock()
+	defer p.inuseMu.Unlock()
+	p.inuse[conn] = struct{}{}
+}
+
+func (p *Pool) checkin(conn Connection) {
+	p.inuseMu.Lock()
+	defer p.inuseMu.Unlock()
+	delete(p.inuse, conn)
+}
+
+// CheckLeaks used to find the checked out connections which are idle for more than timeout seconds.
+// If reclaim is true, the leaked connections will be closed.
+// The leaks of the replicas are counted and reclaimed by the replica pools, they're only returned here.
+func (p *Pool) CheckLeaks(timeout int64, reclaim bool) []Connection {
+	var leaks, replicaLeaks []Connection
+	log := p.log
+	for _, replica := range p.replicas {
+		replicaLeaks = append(replicaLeaks, replica.CheckLeaks(timeout, reclaim)...)
+	}
+
+	p.inuseMu.Lock()
+	for conn := range p.inuse {
+		if conn.IdleTime() > timeout {
+			leaks = append(leaks, conn)
+		}
+	}
+	p.inuseMu.Unlock()
+
+	for _, conn := range leaks {
+		p.counters.Add(poolCounterLeak, 1)
+		log.Warning("pool.conn[%s, ID:%v].leaked.by.session[%v].idle[%ds].last.query[%s]", conn.Address(), conn.ID(), conn.SessionID(), conn.IdleTime(), conn.LastQuery())
+		if reclaim {
+			p.counters.Add(poolCounterReclaim, 1)
+			conn.Close()
+		}
+	}
+	return append(leaks, replicaLeaks...)
+}
+
 func (p *Pool) getConns() chan Connection {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -166,6 +443,6 @@ func (p *Pool) getConns() chan Connection {
 // available is the number of currently unused connections.
 func (p *Pool) JSON() string {
 	b := bytes.NewBuffer(make([]byte, 0, 256))
-	fmt.Fprintf(b, `{"name": "%s","capacity": %d, "counters":"%s"}`, p.conf.Name, p.conf.MaxConnections, p.counters.String())
+	fmt.Fprintf(b, `{"name": "%s","capacity": %d, "version": "%s", "compat": "%s", "counters":"%s"}`, p.conf.Name, p.conf.MaxConnections, p.ServerVersion(), p.CompatMode(), p.counters.String())
 	return b.String()
 }
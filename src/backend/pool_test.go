@@ -9,14 +9,19 @@
 package backend
 
 import (
+	"errors"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"fakedb"
+	"xbase"
+
 	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -50,7 +55,7 @@ func TestPool(t *testing.T) {
 			assert.Nil(t, err)
 			pool.Put(conn)
 		}
-		want := "{\"name\": \"node1\",\"capacity\": 64, \"counters\":\"{\"#pool.get\": 1, \"#pool.miss\": 1, \"#pool.put\": 164}\"}"
+		want := "{\"name\": \"node1\",\"capacity\": 64, \"version\": \"FakeDB\", \"compat\": \"5.7\", \"counters\":\"{\"#pool.get\": 1, \"#pool.miss\": 1, \"#pool.put\": 164}\"}"
 		got := pool.JSON()
 		assert.Equal(t, want, got)
 	}
@@ -178,3 +183,196 @@ func TestPoolTimeout(t *testing.T) {
 	close(ch2)
 	wg.Wait()
 }
+
+func TestPoolCheckLeaks(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// MySQL Server starts...
+	th := driver.NewTestHandler(log)
+	svr, err := driver.MockMysqlServer(log, th)
+	assert.Nil(t, err)
+	defer svr.Close()
+	addr := svr.Addr()
+
+	// Connection
+	conf := MockBackendConfigDefault("node1", addr)
+	pool := NewPool(log, conf)
+	defer pool.Close()
+
+	// leak.
+	{
+		conn, err := pool.Get()
+		assert.Nil(t, err)
+		conn.SetSessionID(1)
+		assert.Equal(t, 0, len(pool.CheckLeaks(1, false)))
+
+		time.Sleep(time.Second * 2)
+		leaks := pool.CheckLeaks(1, false)
+		assert.Equal(t, 1, len(leaks))
+		assert.Equal(t, uint32(1), leaks[0].SessionID())
+		assert.False(t, conn.Closed())
+
+		conn.Recycle()
+		assert.Equal(t, 0, len(pool.CheckLeaks(1, false)))
+	}
+
+	// reclaim.
+	{
+		conn, err := pool.Get()
+		assert.Nil(t, err)
+		time.Sleep(time.Second * 2)
+		leaks := pool.CheckLeaks(1, true)
+		assert.Equal(t, 1, len(leaks))
+		assert.True(t, conn.Closed())
+		assert.Equal(t, 0, len(pool.CheckLeaks(1, true)))
+		conn.Recycle()
+	}
+
+	// The leaks of the replicas are counted and reclaimed once.
+	{
+		conf := MockBackendConfigDefault("node2", addr)
+		conf.Replicas = []string{addr}
+		pool := NewPool(log, conf)
+		defer pool.Close()
+		replica := pool.Replica()
+
+		conn, err := replica.Get()
+		assert.Nil(t, err)
+		time.Sleep(time.Second * 2)
+		leaks := pool.CheckLeaks(1, true)
+		assert.Equal(t, 1, len(leaks))
+		assert.True(t, conn.Closed())
+		assert.Equal(t, int64(1), replica.counters.Counts()[poolCounterLeak])
+		assert.Equal(t, int64(1), replica.counters.Counts()[poolCounterReclaim])
+		assert.Equal(t, int64(0), pool.counters.Counts()[poolCounterLeak])
+		assert.Equal(t, int64(0), pool.counters.Counts()[poolCounterReclaim])
+		conn.Recycle()
+	}
+}
+
+func TestPoolCheckLeaksClock(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+
+	// MySQL Server starts...
+	th := driver.NewTestHandler(log)
+	svr, err := driver.MockMysqlServer(log, th)
+	assert.Nil(t, err)
+	defer svr.Close()
+	addr := svr.Addr()
+
+	// Connection
+	conf := MockBackendConfigDefault("node1", addr)
+	pool := NewPool(log, conf)
+	defer pool.Close()
+	pool.SetClock(clock)
+
+	conn, err := pool.Get()
+	assert.Nil(t, err)
+	conn.SetSessionID(1)
+	assert.Equal(t, 0, len(pool.CheckLeaks(1, false)))
+
+	clock.Advance(time.Second)
+	assert.Equal(t, 0, len(pool.CheckLeaks(1, false)))
+
+	clock.Advance(time.Second)
+	leaks := pool.CheckLeaks(1, false)
+	assert.Equal(t, 1, len(leaks))
+	assert.Equal(t, int64(2), leaks[0].IdleTime())
+	conn.Recycle()
+
+	// The idle connection in the pool is reconnected after the max idle time.
+	clock.Advance(time.Duration(maxIdleTime+1) * time.Second)
+	conn1, err := pool.Get()
+	assert.Nil(t, err)
+	assert.NotEqual(t, conn.ID(), conn1.ID())
+	conn1.Recycle()
+}
+
+func TestPoolValidateIdle(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	fakedb := fakedb.New(log, 1)
+	defer fakedb.Close()
+
+	conf := fakedb.BackendConfs()[0]
+	pool := NewPool(log, conf)
+	defer pool.Close()
+	pool.SetClock(clock)
+
+	// putIdle used to put n new connections to the pool.
+	putIdle := func(n int) {
+		var conns []Connection
+		for i := 0; i < n; i++ {
+			conn, err := pool.Get()
+			assert.Nil(t, err)
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			pool.Put(conn)
+		}
+	}
+	putIdle(2)
+
+	// Not idle for long enough.
+	{
+		validated, broken := pool.ValidateIdle()
+		assert.Equal(t, 0, validated)
+		assert.Equal(t, 0, broken)
+		assert.Equal(t, 2, len(pool.connections))
+	}
+
+	// Ping.
+	{
+		clock.Advance(time.Duration(defaultValidateIdleTime) * time.Second)
+		validated, broken := pool.ValidateIdle()
+		assert.Equal(t, 2, validated)
+		assert.Equal(t, 0, broken)
+		assert.Equal(t, 2, len(pool.connections))
+		assert.Equal(t, int64(2), pool.counters.Counts()[poolCounterValidate])
+
+		// The validated connections are fresh.
+		validated, _ = pool.ValidateIdle()
+		assert.Equal(t, 0, validated)
+	}
+
+	// None.
+	{
+		conf.ValidateStrategy = ValidateNone
+		clock.Advance(time.Minute)
+		validated, broken := pool.ValidateIdle()
+		assert.Equal(t, 0, validated)
+		assert.Equal(t, 0, broken)
+	}
+
+	// Select 1, the broken connections are discarded.
+	{
+		conf.ValidateStrategy = ValidateSelect1
+		conf.ValidateIdleTime = 30
+		fakedb.AddQuery("select 1", &sqltypes.Result{})
+		validated, broken := pool.ValidateIdle()
+		assert.Equal(t, 2, validated)
+		assert.Equal(t, 0, broken)
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum("select 1"))
+
+		fakedb.AddQueryError("select 1", errors.New("mock.select.1.broken"))
+		clock.Advance(time.Second * 30)
+		validated, broken = pool.ValidateIdle()
+		assert.Equal(t, 2, validated)
+		assert.Equal(t, 2, broken)
+		assert.Equal(t, 0, len(pool.connections))
+		assert.Equal(t, int64(2), pool.counters.Counts()[poolCounterValidateBroken])
+	}
+
+	// The pool validating is skipped.
+	{
+		putIdle(1)
+		clock.Advance(time.Minute)
+		pool.validating = 1
+		validated, _ := pool.ValidateIdle()
+		assert.Equal(t, 0, validated)
+		pool.validating = 0
+	}
+}
@@ -17,6 +17,7 @@ import (
 
 	"config"
 	"monitor"
+	"xbase"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -33,6 +34,11 @@ type Scatter struct {
 	txnMgr   *TxnManager
 	metadir  string
 	backends map[string]*Pool
+	clock    xbase.Clock
+	settings *settings
+
+	// validator validates the idle connections of the pools, nil means disabled.
+	validator *Validator
 }
 
 // NewScatter creates a new scatter.
@@ -42,12 +48,51 @@ func NewScatter(log *xlog.Log, metadir string) *Scatter {
 		txnMgr:   NewTxnManager(log),
 		metadir:  metadir,
 		backends: make(map[string]*Pool),
+		clock:    xbase.SystemClock,
+	}
+}
+
+// SetClock used to set the clock of the pools and the pools added later.
+func (scatter *Scatter) SetClock(clock xbase.Clock) {
+	scatter.mu.Lock()
+	defer scatter.mu.Unlock()
+	scatter.clock = clock
+	scatter.txnMgr.memory.SetClock(clock)
+	scatter.txnMgr.hedge.SetClock(clock)
+	scatter.txnMgr.watermarks.SetClock(clock)
+	for _, pool := range scatter.backends {
+		pool.SetClock(clock)
+	}
+}
+
+// SetSettings used to set the declared variables checked on the new connections of the pools and the pools added later.
+func (scatter *Scatter) SetSettings(conf *config.SettingsConfig) error {
+	s, err := newSettings(conf)
+	if err != nil {
+		return err
+	}
+	scatter.mu.Lock()
+	defer scatter.mu.Unlock()
+	scatter.settings = s
+	for _, pool := range scatter.backends {
+		pool.setSettings(s)
 	}
+	return nil
 }
 
-// Init is used to init the xaCheck and start the xaCheck thread.
+// Init is used to init the settings and the xaCheck and start the xaCheck and the validator threads.
 func (scatter *Scatter) Init(scatterConf *config.ScatterConfig) error {
-	return scatter.txnMgr.Init(scatter, scatterConf)
+	if err := scatter.SetSettings(scatterConf.Settings); err != nil {
+		return err
+	}
+	if err := scatter.txnMgr.Init(scatter, scatterConf); err != nil {
+		return err
+	}
+	if scatterConf.ValidateInterval > 0 && scatter.validator == nil {
+		scatter.validator = NewValidator(scatter, scatterConf)
+		scatter.validator.Init()
+	}
+	return nil
 }
 
 // Add backend node.
@@ -59,6 +104,8 @@ func (scatter *Scatter) add(config *config.BackendConfig) error {
 		return errors.Errorf("scatter.backend[%v].duplicate", config.Name)
 	}
 	pool := NewPool(scatter.log, config)
+	pool.SetClock(scatter.clock)
+	pool.setSettings(scatter.settings)
 	scatter.backends[config.Name] = pool
 	monitor.BackendInc("backend")
 	return nil
@@ -94,6 +141,11 @@ func (scatter *Scatter) Remove(config *config.BackendConfig) error {
 
 // Close used to clean the pools connections.
 func (scatter *Scatter) Close() {
+	// The validator clones the pools with the lock, it's stopped first.
+	if scatter.validator != nil {
+		scatter.validator.Close()
+		scatter.validator = nil
+	}
 	scatter.mu.Lock()
 	defer scatter.mu.Unlock()
 
@@ -112,11 +164,104 @@ func (scatter *Scatter) clear() {
 	scatter.backends = make(map[string]*Pool)
 }
 
+// Promote used to make the replica of the backend the primary, the writes and the reads of the new transactions
+// are routed to the new pool at once, and the backends config is flushed with the switch in the lock.
+// The old primary becomes a replica of the switchover, and it's dropped from the replicas of the failover.
+// The transactions in flight go on with the old pool, their connections are closed when they're done.
+func (scatter *Scatter) Promote(name string, address string, failover bool) error {
+	scatter.mu.Lock()
+	defer scatter.mu.Unlock()
+
+	old, ok := scatter.backends[name]
+	if !ok {
+		return errors.Errorf("scatter.backend[%v].can.not.be.found", name)
+	}
+	conf := *old.conf
+	conf.Replicas = nil
+	found := false
+	for _, replica := range old.conf.Replicas {
+		if replica == address {
+			found = true
+			continue
+		}
+		conf.Replicas = append(conf.Replicas, replica)
+	}
+	if !found {
+		return errors.Errorf("scatter.backend[%v].replica[%v].can.not.be.found", name, address)
+	}
+	if !failover {
+		conf.Replicas = append(conf.Replicas, old.conf.Address)
+	}
+	conf.Address = address
+	return scatter.switchPool(&conf)
+}
+
+// Repoint used to point the backend to the new primary address and credentials by the failover managers,
+// the empty user or password keeps the old one. The address is dropped from the replicas if it's one of them.
+// It's switched as the Promote.
+func (scatter *Scatter) Repoint(name string, address string, user string, password string) error {
+	scatter.mu.Lock()
+	defer scatter.mu.Unlock()
+
+	old, ok := scatter.backends[name]
+	if !ok {
+		return errors.Errorf("scatter.backend[%v].can.not.be.found", name)
+	}
+	if address == "" {
+		return errors.Errorf("scatter.backend[%v].address.can.not.be.empty", name)
+	}
+	conf := *old.conf
+	conf.Address = address
+	if user != "" {
+		conf.User = user
+	}
+	if password != "" {
+		conf.Password = password
+	}
+	conf.Replicas = nil
+	for _, replica := range old.conf.Replicas {
+		if replica != address {
+			conf.Replicas = append(conf.Replicas, replica)
+		}
+	}
+	return scatter.switchPool(&conf)
+}
+
+// BackendByAddress returns the name of the backend whose primary is the address, empty if not found.
+func (scatter *Scatter) BackendByAddress(address string) string {
+	scatter.mu.RLock()
+	defer scatter.mu.RUnlock()
+	for name, pool := range scatter.backends {
+		if pool.conf.Address == address {
+			return name
+		}
+	}
+	return ""
+}
+
+// switchPool used to replace the pool of the backend by the new one of the conf and flush the config,
+// the old pool is closed. It must be called with the lock held.
+func (scatter *Scatter) switchPool(conf *config.BackendConfig) error {
+	log := scatter.log
+	old := scatter.backends[conf.Name]
+	log.Warning("scatter.switch.backend[%v].primary[%v->%v].replicas[%v->%v]", conf.Name, old.conf.Address, conf.Address, old.conf.Replicas, conf.Replicas)
+
+	pool := NewPool(scatter.log, conf)
+	pool.SetClock(scatter.clock)
+	pool.setSettings(scatter.settings)
+	scatter.backends[conf.Name] = pool
+	old.Close()
+	return scatter.flushConfig()
+}
+
 // FlushConfig used to write the backends to file.
 func (scatter *Scatter) FlushConfig() error {
 	scatter.mu.Lock()
 	defer scatter.mu.Unlock()
+	return scatter.flushConfig()
+}
 
+func (scatter *Scatter) flushConfig() error {
 	log := scatter.log
 	file := path.Join(scatter.metadir, backendjson)
 
@@ -217,6 +362,15 @@ func (scatter *Scatter) PoolClone() map[string]*Pool {
 	return poolMap
 }
 
+// CheckLeaks used to check the connection leaks of all backends, returns the number of leaked connections.
+func (scatter *Scatter) CheckLeaks(timeout int64, reclaim bool) int {
+	var n int
+	for _, pool := range scatter.PoolClone() {
+		n += len(pool.CheckLeaks(timeout, reclaim))
+	}
+	return n
+}
+
 // BackendConfigsClone used to clone all the backend configs.
 func (scatter *Scatter) BackendConfigsClone() []*config.BackendConfig {
 	scatter.mu.RLock()
@@ -228,6 +382,18 @@ func (scatter *Scatter) BackendConfigsClone() []*config.BackendConfig {
 	return beConfigs
 }
 
+// CaptureWatermark used to capture the GTID watermark of the backends at once.
+func (scatter *Scatter) CaptureWatermark() (*Watermark, error) {
+	return scatter.txnMgr.CaptureWatermark(scatter.PoolClone())
+}
+
+// CommitReadLocked used to run the fn holding the commit read-lock, no distributed transaction commits during it.
+func (scatter *Scatter) CommitReadLocked(fn func() error) error {
+	scatter.txnMgr.CommitRLock()
+	defer scatter.txnMgr.CommitRUnlock()
+	return fn()
+}
+
 // CreateTransaction used to create a transaction.
 func (scatter *Scatter) CreateTransaction() (*Txn, error) {
 	return scatter.txnMgr.CreateTxn(scatter.PoolClone())
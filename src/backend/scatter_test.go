@@ -9,10 +9,13 @@
 package backend
 
 import (
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"fakedb"
+	"xbase/sync2"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -156,6 +159,24 @@ func TestScatter(t *testing.T) {
 		_, err := scatter.CreateTransaction()
 		assert.Nil(t, err)
 	}
+
+	// The fn of the commit read-lock waits for the committing distributed transaction.
+	{
+		scatter.txnMgr.CommitLock()
+		var ran sync2.AtomicBool
+		done := make(chan error, 1)
+		go func() {
+			done <- scatter.CommitReadLocked(func() error {
+				ran.Set(true)
+				return errors.New("mock.error")
+			})
+		}()
+		time.Sleep(50 * time.Millisecond)
+		assert.False(t, ran.Get())
+		scatter.txnMgr.CommitUnlock()
+		assert.Equal(t, "mock.error", (<-done).Error())
+		assert.True(t, ran.Get())
+	}
 }
 
 func TestScatterLoadNotExists(t *testing.T) {
@@ -204,3 +225,114 @@ func TestScatterNormalBackends(t *testing.T) {
 		assert.Equal(t, "node1", backends[0])
 	}
 }
+
+func TestScatterPromote(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_backend_", log)
+	defer os.RemoveAll(tmpDir)
+
+	scatter := NewScatter(log, tmpDir)
+	defer scatter.Close()
+	fakedb := fakedb.New(log, 3)
+	defer fakedb.Close()
+	addrs := fakedb.Addrs()
+	config1 := MockBackendConfigDefault("node1", addrs[0])
+	config1.Replicas = []string{addrs[1], addrs[2]}
+	err := scatter.Add(config1)
+	assert.Nil(t, err)
+
+	// The connection in flight.
+	old := scatter.PoolClone()["node1"]
+	conn, err := old.Get()
+	assert.Nil(t, err)
+
+	// Switchover.
+	{
+		err := scatter.Promote("node1", addrs[1], false)
+		assert.Nil(t, err)
+		pool := scatter.PoolClone()["node1"]
+		assert.Equal(t, addrs[1], pool.conf.Address)
+		assert.Equal(t, []string{addrs[2], addrs[0]}, pool.conf.Replicas)
+		assert.Equal(t, 2, len(pool.replicas))
+
+		// The old pool is closed with the connection returned.
+		old.Put(conn)
+		assert.True(t, conn.Closed())
+	}
+
+	// Failover.
+	{
+		err := scatter.Promote("node1", addrs[2], true)
+		assert.Nil(t, err)
+		pool := scatter.PoolClone()["node1"]
+		assert.Equal(t, addrs[2], pool.conf.Address)
+		assert.Equal(t, []string{addrs[0]}, pool.conf.Replicas)
+	}
+
+	// The metadata.
+	{
+		err := scatter.LoadConfig()
+		assert.Nil(t, err)
+		pool := scatter.PoolClone()["node1"]
+		assert.Equal(t, addrs[2], pool.conf.Address)
+		assert.Equal(t, []string{addrs[0]}, pool.conf.Replicas)
+	}
+
+	// Errors.
+	{
+		err := scatter.Promote("node2", addrs[1], true)
+		assert.Equal(t, "scatter.backend[node2].can.not.be.found", err.Error())
+		err = scatter.Promote("node1", addrs[1], true)
+		assert.Equal(t, "scatter.backend[node1].replica["+addrs[1]+"].can.not.be.found", err.Error())
+	}
+}
+
+func TestScatterRepoint(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_backend_", log)
+	defer os.RemoveAll(tmpDir)
+
+	scatter := NewScatter(log, tmpDir)
+	defer scatter.Close()
+	fakedb := fakedb.New(log, 3)
+	defer fakedb.Close()
+	addrs := fakedb.Addrs()
+	config1 := MockBackendConfigDefault("node1", addrs[0])
+	config1.Replicas = []string{addrs[1]}
+	err := scatter.Add(config1)
+	assert.Nil(t, err)
+	assert.Equal(t, "node1", scatter.BackendByAddress(addrs[0]))
+	assert.Equal(t, "", scatter.BackendByAddress(addrs[2]))
+
+	// The new primary out of the replicas, the credentials kept.
+	{
+		err := scatter.Repoint("node1", addrs[2], "", "")
+		assert.Nil(t, err)
+		pool := scatter.PoolClone()["node1"]
+		assert.Equal(t, addrs[2], pool.conf.Address)
+		assert.Equal(t, config1.User, pool.conf.User)
+		assert.Equal(t, []string{addrs[1]}, pool.conf.Replicas)
+		assert.Equal(t, "node1", scatter.BackendByAddress(addrs[2]))
+	}
+
+	// The replica with the new credentials.
+	{
+		err := scatter.Repoint("node1", addrs[1], "root", "pwd")
+		assert.Nil(t, err)
+		err = scatter.LoadConfig()
+		assert.Nil(t, err)
+		pool := scatter.PoolClone()["node1"]
+		assert.Equal(t, addrs[1], pool.conf.Address)
+		assert.Equal(t, "root", pool.conf.User)
+		assert.Equal(t, "pwd", pool.conf.Password)
+		assert.Equal(t, 0, len(pool.conf.Replicas))
+	}
+
+	// Errors.
+	{
+		err := scatter.Repoint("node2", addrs[1], "", "")
+		assert.Equal(t, "scatter.backend[node2].can.not.be.found", err.Error())
+		err = scatter.Repoint("node1", "", "", "")
+		assert.Equal(t, "scatter.backend[node1].address.can.not.be.empty", err.Error())
+	}
+}
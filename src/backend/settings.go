@@ -0,0 +1,125 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	globalSettingPrefix = "global."
+)
+
+var (
+	settingNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+)
+
+// settings tuple, the declared variables of the config.SettingsConfig built once for the pools.
+type settings struct {
+	// setQuery sets the session variables in the enforce mode, empty if nothing to set.
+	setQuery string
+	// checkQuery selects the variables in the order of the names.
+	checkQuery string
+	names      []string
+	values     []string
+}
+
+// newSettings returns the settings of the conf, nil if the conf is nil or has no variables.
+func newSettings(conf *config.SettingsConfig) (*settings, error) {
+	if conf == nil || len(conf.Variables) == 0 {
+		return nil, nil
+	}
+	if conf.Mode != config.SettingsModeVerify && conf.Mode != config.SettingsModeEnforce {
+		return nil, errors.Errorf("backend.settings.mode[%s].must.be.verify.or.enforce", conf.Mode)
+	}
+
+	names := make([]string, 0, len(conf.Variables))
+	for name := range conf.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := &settings{}
+	var sets, selects []string
+	for _, name := range names {
+		value := conf.Variables[name]
+		variable := strings.TrimPrefix(strings.ToLower(name), globalSettingPrefix)
+		global := len(variable) != len(name)
+		if !settingNameRegexp.MatchString(variable) {
+			return nil, errors.Errorf("backend.settings.variable[%s].name.is.invalid", name)
+		}
+		s.names = append(s.names, name)
+		s.values = append(s.values, value)
+		if global {
+			selects = append(selects, "@@global."+variable)
+			continue
+		}
+		selects = append(selects, "@@session."+variable)
+		if conf.Mode == config.SettingsModeEnforce {
+			sets = append(sets, variable+" = "+settingValue(value))
+		}
+	}
+	if len(sets) > 0 {
+		s.setQuery = "SET " + strings.Join(sets, ", ")
+	}
+	s.checkQuery = "SELECT " + strings.Join(selects, ", ")
+	return s, nil
+}
+
+// check returns the error of the first variable which is not the declared value.
+func (s *settings) check(qr *sqltypes.Result) error {
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) != len(s.names) {
+		return errors.Errorf("backend.settings.check.query[%s].returns.unexpected.result", s.checkQuery)
+	}
+	for i, name := range s.names {
+		got := qr.Rows[0][i].String()
+		if !settingEqual(name, got, s.values[i]) {
+			return errors.Errorf("backend.settings.variable[%s].is[%s].but.declared[%s]", name, got, s.values[i])
+		}
+	}
+	return nil
+}
+
+// settingValue returns the value in the SET, the integers are unquoted for the numeric variables.
+func settingValue(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value
+	}
+	return quote(value)
+}
+
+// settingEqual returns true if the value of the variable is the declared one, the values are case-insensitive
+// and the modes of the sql_mode are compared in any order.
+func settingEqual(name, got, want string) bool {
+	if strings.EqualFold(got, want) {
+		return true
+	}
+	if !strings.HasSuffix(strings.ToLower(name), "sql_mode") {
+		return false
+	}
+	modes := func(v string) string {
+		var list []string
+		for _, mode := range strings.Split(strings.ToUpper(v), ",") {
+			if mode = strings.TrimSpace(mode); mode != "" {
+				list = append(list, mode)
+			}
+		}
+		sort.Strings(list)
+		return strings.Join(list, ",")
+	}
+	return modes(got) == modes(want)
+}
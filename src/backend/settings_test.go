@@ -0,0 +1,148 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func mockSettingsResult(values ...string) *sqltypes.Result {
+	qr := &sqltypes.Result{}
+	row := make([]sqltypes.Value, 0, len(values))
+	for i, value := range values {
+		qr.Fields = append(qr.Fields, &querypb.Field{Name: string(rune('a' + i)), Type: querypb.Type_VARCHAR})
+		row = append(row, sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(value)))
+	}
+	qr.Rows = [][]sqltypes.Value{row}
+	return qr
+}
+
+func TestNewSettings(t *testing.T) {
+	variables := map[string]string{
+		"sql_mode":                      "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION",
+		"time_zone":                     "+00:00",
+		"wait_timeout":                  "28800",
+		"global.lower_case_table_names": "1",
+	}
+
+	// Nil.
+	{
+		s, err := newSettings(nil)
+		assert.Nil(t, err)
+		assert.Nil(t, s)
+		s, err = newSettings(&config.SettingsConfig{Mode: config.SettingsModeEnforce})
+		assert.Nil(t, err)
+		assert.Nil(t, s)
+	}
+
+	// Enforce.
+	{
+		s, err := newSettings(&config.SettingsConfig{Mode: config.SettingsModeEnforce, Variables: variables})
+		assert.Nil(t, err)
+		assert.Equal(t, "SET sql_mode = 'STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION', time_zone = '+00:00', wait_timeout = 28800", s.setQuery)
+		assert.Equal(t, "SELECT @@global.lower_case_table_names, @@session.sql_mode, @@session.time_zone, @@session.wait_timeout", s.checkQuery)
+	}
+
+	// Verify.
+	{
+		s, err := newSettings(&config.SettingsConfig{Mode: config.SettingsModeVerify, Variables: variables})
+		assert.Nil(t, err)
+		assert.Equal(t, "", s.setQuery)
+		assert.Equal(t, "SELECT @@global.lower_case_table_names, @@session.sql_mode, @@session.time_zone, @@session.wait_timeout", s.checkQuery)
+	}
+
+	// Errors.
+	{
+		_, err := newSettings(&config.SettingsConfig{Mode: "xx", Variables: variables})
+		assert.Equal(t, "backend.settings.mode[xx].must.be.verify.or.enforce", err.Error())
+		_, err = newSettings(&config.SettingsConfig{Mode: config.SettingsModeVerify, Variables: map[string]string{"a=1,b": "1"}})
+		assert.Equal(t, "backend.settings.variable[a=1,b].name.is.invalid", err.Error())
+	}
+}
+
+func TestSettingsCheck(t *testing.T) {
+	s, err := newSettings(&config.SettingsConfig{
+		Mode:      config.SettingsModeVerify,
+		Variables: map[string]string{"sql_mode": "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", "time_zone": "SYSTEM"},
+	})
+	assert.Nil(t, err)
+
+	// The sql_mode in other order and the value in other case.
+	assert.Nil(t, s.check(mockSettingsResult("NO_ENGINE_SUBSTITUTION,STRICT_TRANS_TABLES", "system")))
+
+	// Mismatched.
+	err = s.check(mockSettingsResult("STRICT_TRANS_TABLES", "SYSTEM"))
+	assert.Equal(t, "backend.settings.variable[sql_mode].is[STRICT_TRANS_TABLES].but.declared[STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION]", err.Error())
+	err = s.check(mockSettingsResult("STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", "+08:00"))
+	assert.Equal(t, "backend.settings.variable[time_zone].is[+08:00].but.declared[SYSTEM]", err.Error())
+
+	// Unexpected result.
+	err = s.check(mockSettingsResult("SYSTEM"))
+	assert.NotNil(t, err)
+}
+
+func TestScatterSettings(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	scatter, fakedb, cleanup := MockScatter(log, 2)
+	defer cleanup()
+
+	setQuery := "SET time_zone = '+00:00', wait_timeout = 600"
+	checkQuery := "SELECT @@session.time_zone, @@session.wait_timeout"
+	conf := &config.SettingsConfig{
+		Mode:      config.SettingsModeEnforce,
+		Variables: map[string]string{"time_zone": "+00:00", "wait_timeout": "600"},
+	}
+	err := scatter.SetSettings(conf)
+	assert.Nil(t, err)
+
+	// Enforced on the existing pools and the pools added later.
+	{
+		fakedb.AddQuery(setQuery, &sqltypes.Result{})
+		fakedb.AddQuery(checkQuery, mockSettingsResult("+00:00", "600"))
+		for _, name := range []string{"backend0", "backend1"} {
+			conn, err := scatter.backends[name].Get()
+			assert.Nil(t, err)
+			conn.Close()
+		}
+
+		addr := fakedb.Addrs()[0]
+		err := scatter.Add(MockBackendConfigDefault("backend2", addr))
+		assert.Nil(t, err)
+		conn, err := scatter.backends["backend2"].Get()
+		assert.Nil(t, err)
+		conn.Close()
+		assert.Equal(t, 3, fakedb.GetQueryCalledNum(setQuery))
+
+		// The mismatched connection is refused.
+		fakedb.AddQuery(checkQuery, mockSettingsResult("+08:00", "600"))
+		_, err = scatter.backends["backend2"].Get()
+		assert.Equal(t, "backend.settings.variable[time_zone].is[+08:00].but.declared[+00:00]", err.Error())
+	}
+
+	// The invalid settings are not set.
+	{
+		err := scatter.SetSettings(&config.SettingsConfig{Mode: "xx", Variables: conf.Variables})
+		assert.NotNil(t, err)
+		assert.NotNil(t, scatter.backends["backend0"].getSettings())
+	}
+
+	// Unset.
+	{
+		err := scatter.SetSettings(nil)
+		assert.Nil(t, err)
+		assert.Nil(t, scatter.backends["backend0"].getSettings())
+	}
+}
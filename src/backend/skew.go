@@ -0,0 +1,156 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"xcontext"
+)
+
+var (
+	hashRange = regexp.MustCompile(`^\[(\d+)-(\d+)\)$`)
+)
+
+// SegmentStat tuple, the read/write volume of a segment.
+type SegmentStat struct {
+	Table   string
+	Backend string
+	Range   string
+	Reads   uint64
+	Writes  uint64
+	Rows    uint64
+}
+
+// HotShard tuple.
+type HotShard struct {
+	SegmentStat
+	// Ratio is the segment volume divided by the average volume of the table segments.
+	Ratio float64
+	// SplitPoint is the suggested split point of the hash range.
+	SplitPoint string `json:",omitempty"`
+}
+
+// Skew used to track the per-segment read/write volume.
+type Skew struct {
+	mu sync.Mutex
+	// Key is the segment table name.
+	segments map[string]*SegmentStat
+}
+
+// NewSkew creates the new Skew.
+func NewSkew() *Skew {
+	return &Skew{
+		segments: make(map[string]*SegmentStat),
+	}
+}
+
+// Record used to record the query executed on the segment.
+func (s *Skew) Record(tuple xcontext.QueryTuple, write bool, rows uint64) {
+	if tuple.Table == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat, ok := s.segments[tuple.Table]
+	if !ok {
+		stat = &SegmentStat{
+			Table:   tuple.Table,
+			Backend: tuple.Backend,
+			Range:   tuple.Range,
+		}
+		s.segments[tuple.Table] = stat
+	}
+	if write {
+		stat.Writes++
+	} else {
+		stat.Reads++
+	}
+	stat.Rows += rows
+}
+
+// Reset used to clear all the stats.
+func (s *Skew) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segments = make(map[string]*SegmentStat)
+}
+
+// HotShards returns the segments whose volume exceeds threshold times the average of the table segments.
+// The tableOf returns the table of the segment by its segment naming and the number of the table segments,
+// the segments without querys are counted in the average, so the only segment queried of a table can be hot.
+// The segment of the unknown table is a table itself, it's never hot.
+func (s *Skew) HotShards(threshold float64, tableOf func(segment string) (string, int)) []HotShard {
+	var hots []HotShard
+
+	s.mu.Lock()
+	stats := make([]SegmentStat, 0, len(s.segments))
+	for _, stat := range s.segments {
+		stats = append(stats, *stat)
+	}
+	s.mu.Unlock()
+
+	tables := make(map[string][]SegmentStat)
+	segments := make(map[string]int)
+	for _, stat := range stats {
+		table, n := tableOf(stat.Table)
+		if table == "" {
+			table = stat.Table
+		}
+		tables[table] = append(tables[table], stat)
+		segments[table] = n
+	}
+
+	for table, stats := range tables {
+		n := segments[table]
+		if n < len(stats) {
+			n = len(stats)
+		}
+		if n < 2 {
+			continue
+		}
+
+		var total uint64
+		for _, stat := range stats {
+			total += stat.Reads + stat.Writes
+		}
+		avg := float64(total) / float64(n)
+		for _, stat := range stats {
+			ratio := float64(stat.Reads+stat.Writes) / avg
+			if ratio > threshold {
+				hots = append(hots, HotShard{
+					SegmentStat: stat,
+					Ratio:       ratio,
+					SplitPoint:  splitPoint(stat.Range),
+				})
+			}
+		}
+	}
+	sort.Slice(hots, func(i, j int) bool { return hots[i].Ratio > hots[j].Ratio })
+	return hots
+}
+
+// splitPoint returns the middle of the hash range, such as '[0-128)' returns '64'.
+func splitPoint(rangi string) string {
+	m := hashRange.FindStringSubmatch(rangi)
+	if len(m) != 3 {
+		return ""
+	}
+	start, _ := strconv.Atoi(m[1])
+	end, _ := strconv.Atoi(m[2])
+	if end-start < 2 {
+		return ""
+	}
+	return fmt.Sprintf("%d", start+(end-start)/2)
+}
@@ -0,0 +1,78 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"strings"
+	"testing"
+
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkewHotShards(t *testing.T) {
+	skew := NewSkew()
+	tuples := []xcontext.QueryTuple{
+		{Backend: "backend0", Range: "[0-128)", Table: "db.t1_0000"},
+		{Backend: "backend0", Range: "[128-256)", Table: "db.t1_0001"},
+		{Backend: "backend1", Range: "[256-384)", Table: "db.t1_0002"},
+		{Backend: "backend1", Range: "[384-512)", Table: "db.t1_0003"},
+	}
+	for _, tuple := range tuples {
+		skew.Record(tuple, false, 1)
+	}
+	for i := 0; i < 10; i++ {
+		skew.Record(tuples[0], true, 2)
+	}
+	// No table.
+	skew.Record(xcontext.QueryTuple{Backend: "backend0"}, false, 1)
+
+	// tableOf returns the table db.t1 with 4 segments.
+	tableOf := func(segment string) (string, int) {
+		if strings.HasPrefix(segment, "db.t1_") {
+			return "db.t1", 4
+		}
+		return "", 0
+	}
+	hots := skew.HotShards(2, tableOf)
+	assert.Equal(t, 1, len(hots))
+	hot := hots[0]
+	assert.Equal(t, "db.t1_0000", hot.Table)
+	assert.Equal(t, "backend0", hot.Backend)
+	assert.Equal(t, uint64(1), hot.Reads)
+	assert.Equal(t, uint64(10), hot.Writes)
+	assert.Equal(t, uint64(21), hot.Rows)
+	assert.Equal(t, "64", hot.SplitPoint)
+	assert.InDelta(t, 3.14, hot.Ratio, 0.01)
+
+	assert.Equal(t, 0, len(skew.HotShards(4, tableOf)))
+
+	// The only segment queried of the table is hot.
+	skew.Reset()
+	skew.Record(tuples[1], false, 1)
+	hots = skew.HotShards(2, tableOf)
+	assert.Equal(t, 1, len(hots))
+	assert.Equal(t, "db.t1_0001", hots[0].Table)
+	assert.InDelta(t, 4, hots[0].Ratio, 0.01)
+
+	// The segment of the unknown table is never hot.
+	skew.Reset()
+	skew.Record(xcontext.QueryTuple{Backend: "backend0", Table: "db.g1"}, false, 1)
+	assert.Equal(t, 0, len(skew.HotShards(2, tableOf)))
+
+	skew.Reset()
+	assert.Equal(t, 0, len(skew.HotShards(2, tableOf)))
+}
+
+func TestSkewSplitPoint(t *testing.T) {
+	assert.Equal(t, "64", splitPoint("[0-128)"))
+	assert.Equal(t, "", splitPoint("[0-1)"))
+	assert.Equal(t, "", splitPoint(""))
+}
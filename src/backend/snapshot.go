@@ -0,0 +1,108 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"context"
+	"sync"
+
+	"xbase"
+)
+
+const (
+	snapshotStartQuery = "START TRANSACTION WITH CONSISTENT SNAPSHOT"
+	snapshotEndQuery   = "ROLLBACK"
+)
+
+// snapshotable returns true if the read of the request to the backends starts the consistent snapshots,
+// the read as of the watermark always starts them.
+func (txn *Txn) snapshotable(backends int) bool {
+	if txn.twopc {
+		return false
+	}
+	return txn.watermark != nil || (txn.consistentRead && backends > 1)
+}
+
+// startSnapshots used to fetch the connections of the backends and start the consistent snapshots on them in parallel,
+// the snapshots are started under the commit read-lock, so no XA commit lands on the shards in the middle of the cut.
+// The snapshots of the read as of the watermark are started after its GTID sets are executed, the waits don't hold the lock.
+// The connections are returned in the order of the backends, they must be ended by endSnapshots even if the error is returned.
+func (txn *Txn) startSnapshots(ctx context.Context, backends []string) ([]Connection, error) {
+	var mu sync.Mutex
+	var allErrors []error
+
+	txnCounters.Add(txnCounterConsistentRead, 1)
+	conns := make([]Connection, len(backends))
+	for i, back := range backends {
+		conn, err := txn.fetchOneConnection(back)
+		if err != nil {
+			allErrors = append(allErrors, txn.shardError(back, "", phaseConnect, err))
+			break
+		}
+		conns[i] = conn
+	}
+	if len(allErrors) > 0 {
+		return conns, allErrors[0]
+	}
+
+	// parallel runs the fn on all the connections and collects the errors.
+	parallel := func(fn func(back string, conn Connection) error) {
+		var wg sync.WaitGroup
+		for i := range conns {
+			wg.Add(1)
+			go func(back string, conn Connection) {
+				defer wg.Done()
+				stop := watchContext(ctx, conn)
+				x := fn(back, conn)
+				if stop() {
+					x = xbase.NewContextError(ctx)
+				}
+				if x != nil {
+					txn.log.Error("txn.start.snapshot.on[%v].error:%+v", conn.Address(), x)
+					mu.Lock()
+					allErrors = append(allErrors, txn.shardError(back, "", phaseExecute, x))
+					mu.Unlock()
+				}
+			}(backends[i], conns[i])
+		}
+		wg.Wait()
+	}
+
+	if txn.watermark != nil {
+		parallel(txn.waitWatermark)
+		if len(allErrors) > 0 {
+			return conns, allErrors[0]
+		}
+	}
+
+	txn.mgr.CommitRLock()
+	parallel(func(back string, conn Connection) error {
+		_, x := conn.ExecuteWithLimits(txn.queryTag+snapshotStartQuery, txn.timeout, 0)
+		return x
+	})
+	txn.mgr.CommitRUnlock()
+	if len(allErrors) > 0 {
+		return conns, allErrors[0]
+	}
+	return conns, nil
+}
+
+// endSnapshots used to end the consistent snapshots before the connections are recycled, the connections
+// are closed by the Finish if one of the snapshots can't be ended.
+func (txn *Txn) endSnapshots(conns []Connection) {
+	for _, conn := range conns {
+		if conn == nil {
+			continue
+		}
+		if _, err := conn.Execute(snapshotEndQuery); err != nil {
+			txn.log.Error("txn.end.snapshot.on[%v].error:%+v", conn.Address(), err)
+			txn.incErrors()
+		}
+	}
+}
@@ -10,7 +10,18 @@ package backend
 
 import (
 	"time"
+
+	"monitor"
 	"xbase/stats"
+	"xcontext"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	planTypePointSelect   = "point_select"
+	planTypeScatterSelect = "scatter_select"
+	planType2PCCommit     = "2pc_commit"
 )
 
 var (
@@ -28,6 +39,7 @@ var (
 
 	tz = NewTxnz()
 	qz = NewQueryz()
+	sk = NewSkew()
 )
 
 // Queryz returns the queryz.
@@ -40,6 +52,26 @@ func (scatter *Scatter) Txnz() *Txnz {
 	return tz
 }
 
+// Skew returns the segments skew stats.
+func (scatter *Scatter) Skew() *Skew {
+	return sk
+}
+
+// Memory returns the accountant of the result bytes held by the in-flight querys.
+func (scatter *Scatter) Memory() *Memory {
+	return scatter.txnMgr.memory
+}
+
+// Hedge returns the limits of the hedged reads.
+func (scatter *Scatter) Hedge() *Hedge {
+	return scatter.txnMgr.hedge
+}
+
+// Watermarks returns the GTID watermarks of the backends.
+func (scatter *Scatter) Watermarks() *Watermarks {
+	return scatter.txnMgr.watermarks
+}
+
 // MySQLStats returns the mysql stats.
 func (scatter *Scatter) MySQLStats() *stats.Timings {
 	return mysqlStats
@@ -59,3 +91,60 @@ func (scatter *Scatter) QueryRates() *stats.Rates {
 func (scatter *Scatter) TxnCounters() *stats.Counters {
 	return txnCounters
 }
+
+// planObserve used to record the plan metrics with the backends number touched by the request.
+func planObserve(req *xcontext.RequestContext, backends int, err error) {
+	if req.PlanType == "" {
+		return
+	}
+
+	ptype := string(req.PlanType)
+	if req.PlanType == xcontext.PlanSelect {
+		ptype = planTypeScatterSelect
+		if backends <= 1 {
+			ptype = planTypePointSelect
+		}
+	}
+	result := "OK"
+	if err != nil {
+		result = "Error"
+	}
+	monitor.PlanObserve(ptype, result, backends)
+}
+
+// ExecStat tuple, the execution statistics of a query on the backend.
+type ExecStat struct {
+	Backend string
+	Query   string
+	Cost    time.Duration
+	Rows    int
+	Bytes   int
+}
+
+// ExecStats tuple.
+type ExecStats struct {
+	// Cost is the wall time spent on the backends.
+	Cost  time.Duration
+	Stats []ExecStat
+}
+
+func (es *ExecStats) add(backend string, query string, cost time.Duration, qr *sqltypes.Result) {
+	es.Stats = append(es.Stats, ExecStat{
+		Backend: backend,
+		Query:   query,
+		Cost:    cost,
+		Rows:    len(qr.Rows),
+		Bytes:   ResultBytes(qr),
+	})
+}
+
+// ResultBytes returns the bytes of the result rows.
+func ResultBytes(qr *sqltypes.Result) int {
+	bytes := 0
+	for _, row := range qr.Rows {
+		for _, v := range row {
+			bytes += v.Len()
+		}
+	}
+	return bytes
+}
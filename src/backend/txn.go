@@ -9,16 +9,22 @@
 package backend
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 	"xcontext"
 
 	"config"
+	"monitor"
+	"xbase"
 	"xbase/sync2"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -30,6 +36,18 @@ var (
 	txnCounterTxnBegin              = "#txn.begin"
 	txnCounterTxnFinish             = "#txn.finish"
 	txnCounterTxnAbort              = "#txn.abort"
+	txnCounterTxnCancel             = "#txn.cancel"
+	txnCounterMaxResultRows         = "#txn.max.result.rows"
+	txnCounterPartialResult         = "#txn.partial.result"
+	txnCounterReplicaRead           = "#txn.replica.read"
+	txnCounterReplicaFallback       = "#txn.replica.fallback"
+	txnCounterHedgeSent             = "#txn.hedge.sent"
+	txnCounterHedgeWon              = "#txn.hedge.won"
+	txnCounterHedgeThrottled        = "#txn.hedge.throttled"
+	txnCounterLimitSatisfied        = "#txn.limit.satisfied"
+	txnCounterConsistentRead        = "#txn.consistent.read"
+	txnCounterWatermarkCapture      = "#txn.watermark.capture"
+	txnCounterWatermarkTimeout      = "#txn.watermark.timeout"
 )
 
 type txnState int32
@@ -53,6 +71,8 @@ type Transaction interface {
 	State() int32
 	XaState() int32
 	Abort() error
+	Cancel(reason string) error
+	Connections() []ConnectionInfo
 
 	Begin() error
 	Rollback() error
@@ -64,11 +84,23 @@ type Transaction interface {
 	RollbackScatter() error
 	SetMultiStmtTxn()
 	SetSessionID(id uint32)
+	SetQueryTag(tag string)
 
 	SetTimeout(timeout int)
 	SetMaxResult(max int)
+	SetMaxResultRows(max int)
+	MaxResultRows() int
 	SetMaxJoinRows(max int)
 	MaxJoinRows() int
+	SetMaxDMLRows(max int)
+	MaxDMLRows() int
+	SetPartialResult(partial bool)
+	SetReplica(replica bool)
+	SetAnalyze(analyze bool)
+	SetConsistentRead(consistent bool)
+	SetWatermark(watermark *Watermark)
+	SetQueryDone(fn func(backend string, query string, err error))
+	ExecStats() *ExecStats
 
 	Execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 	ExecuteRaw(database string, query string) (*sqltypes.Result, error)
@@ -80,6 +112,7 @@ type Txn struct {
 	id                uint64
 	xid               string
 	sessionID         uint32
+	queryTag          string // comment prefix of the backend querys.
 	mu                sync.Mutex
 	mgr               *TxnManager
 	req               *xcontext.RequestContext
@@ -88,12 +121,23 @@ type Txn struct {
 	isMultiStmtTxn    bool
 	start             time.Time
 	state             sync2.AtomicInt32
+	cancelled         sync2.AtomicBool
+	memBytes          sync2.AtomicInt64 // result bytes accounted in the mgr memory.
 	xaState           sync2.AtomicInt32
 	backends          map[string]*Pool
 	timeout           int
 	maxResult         int
+	maxResultRows     int
 	maxJoinRows       int
+	maxDMLRows        int
+	partialResult     bool
+	replica           bool       // the reads go to the replicas of the backends.
+	consistentRead    bool       // the reads of the multiple backends start the consistent snapshots first.
+	watermark         *Watermark // the reads wait for the backends to execute the watermark first.
+	queryDone         func(backend string, query string, err error)
 	errors            int
+	analyze           bool
+	execStats         ExecStats
 	twopcConnections  map[string]Connection
 	normalConnections []Connection
 	twopcConnMu       sync.RWMutex
@@ -129,6 +173,17 @@ func (txn *Txn) SetMaxResult(max int) {
 	txn.maxResult = max
 }
 
+// SetMaxResultRows used to set the txn max result rows.
+// If max is 0, means there is no limits.
+func (txn *Txn) SetMaxResultRows(max int) {
+	txn.maxResultRows = max
+}
+
+// MaxResultRows returns txn maxResultRows.
+func (txn *Txn) MaxResultRows() int {
+	return txn.maxResultRows
+}
+
 // SetMaxJoinRows used to set the txn max join rows.
 func (txn *Txn) SetMaxJoinRows(max int) {
 	txn.maxJoinRows = max
@@ -139,6 +194,57 @@ func (txn *Txn) MaxJoinRows() int {
 	return txn.maxJoinRows
 }
 
+// SetMaxDMLRows used to set the max rows matched by the scatter UPDATE and DELETE.
+// If max is 0, means there is no limits.
+func (txn *Txn) SetMaxDMLRows(max int) {
+	txn.maxDMLRows = max
+}
+
+// MaxDMLRows returns txn maxDMLRows.
+func (txn *Txn) MaxDMLRows() int {
+	return txn.maxDMLRows
+}
+
+// SetPartialResult used to make the reads skip the failed backends if any backend succeeded,
+// the Warnings of the result is the number of the skipped ones.
+func (txn *Txn) SetPartialResult(partial bool) {
+	txn.partialResult = partial
+}
+
+// SetReplica used to send the reads of the non-twopc txn to the replicas of the backends,
+// the backend without replica or whose replica can't be connected serves them.
+func (txn *Txn) SetReplica(replica bool) {
+	txn.replica = replica
+}
+
+// SetAnalyze used to enable the execution statistics collection.
+func (txn *Txn) SetAnalyze(analyze bool) {
+	txn.analyze = analyze
+}
+
+// SetConsistentRead used to start the consistent snapshots on all the backends of the non-twopc read before
+// any query of it is sent, so the shards are read at a transactionally consistent cut.
+func (txn *Txn) SetConsistentRead(consistent bool) {
+	txn.consistentRead = consistent
+}
+
+// SetWatermark used to read as of the GTID watermark, the non-twopc read waits for each backend to execute
+// the GTID set of the watermark before its consistent snapshot is started, nil means not.
+func (txn *Txn) SetWatermark(watermark *Watermark) {
+	txn.watermark = watermark
+}
+
+// SetQueryDone used to set the fn called once each query of the request is executed on the backend, with the error
+// of the query. The querys not sent, such as the connection can't be fetched, aren't called.
+func (txn *Txn) SetQueryDone(fn func(backend string, query string, err error)) {
+	txn.queryDone = fn
+}
+
+// ExecStats returns the execution statistics collected by the txn.
+func (txn *Txn) ExecStats() *ExecStats {
+	return &txn.execStats
+}
+
 // TxID returns txn id.
 func (txn *Txn) TxID() uint64 {
 	return txn.id
@@ -199,7 +305,7 @@ func (txn *Txn) reFetchTwopcConnection(backend string) (Connection, error) {
 	return txn.twopcConnection(backend)
 }
 
-// normalConnection used to get a connection via backend name from pool.
+// normalConnection used to get a connection via backend name from pool, or from the replica pool of the backend if the txn reads the replicas.
 // The Connection is stored in normalConnections for recycling.
 func (txn *Txn) normalConnection(backend string) (Connection, error) {
 	pool, ok := txn.backends[backend]
@@ -207,6 +313,20 @@ func (txn *Txn) normalConnection(backend string) (Connection, error) {
 		txnCounters.Add(txnCounterNormalConnectionError, 1)
 		return nil, errors.Errorf("txn.can.not.get.normal.connection.by.backend[%+v].from.pool", backend)
 	}
+	if txn.replica {
+		if replica := pool.Replica(); replica != nil {
+			conn, err := replica.Get()
+			if err == nil {
+				txnCounters.Add(txnCounterReplicaRead, 1)
+				txn.normalConnMu.Lock()
+				txn.normalConnections = append(txn.normalConnections, conn)
+				txn.normalConnMu.Unlock()
+				return conn, nil
+			}
+			txnCounters.Add(txnCounterReplicaFallback, 1)
+			txn.log.Warning("txn.get.connection.from.replica[%s].of.backend[%s].error:%+v, fallback.to.the.primary", replica.conf.Address, backend, err)
+		}
+	}
 	conn, err := pool.Get()
 	if err != nil {
 		return nil, err
@@ -229,6 +349,7 @@ func (txn *Txn) fetchOneConnection(back string) (Connection, error) {
 			return nil, err
 		}
 	}
+	conn.SetSessionID(txn.sessionID)
 	return conn, nil
 }
 
@@ -264,6 +385,7 @@ func (txn *Txn) Commit() error {
 
 		// 3. XA COMMIT
 		txn.xaCommit()
+		monitor.PlanObserve(planType2PCCommit, "OK", len(txn.twopcConnections))
 	}
 	return nil
 }
@@ -356,6 +478,15 @@ func (txn *Txn) SetMultiStmtTxn() {
 	txn.isMultiStmtTxn = true
 }
 
+// SetQueryTag used to prepend the tag comment to the backend querys of the txn,
+// so the backend slow logs and processlist can be traced back, empty means no tag.
+func (txn *Txn) SetQueryTag(tag string) {
+	txn.queryTag = ""
+	if tag != "" {
+		txn.queryTag = "/* " + strings.Replace(tag, "*/", "* /", -1) + " */ "
+	}
+}
+
 // SetSessionID -- bind the txn to session id, for debug.
 func (txn *Txn) SetSessionID(id uint32) {
 	txn.sessionID = id
@@ -369,6 +500,8 @@ func (txn *Txn) ExecuteRaw(database string, query string) (*sqltypes.Result, err
 // Execute used to execute the query.
 // If the txn is in twopc mode, we do the xaStart before the real query execute.
 func (txn *Txn) Execute(req *xcontext.RequestContext) (*sqltypes.Result, error) {
+	// The results of the previous statement are released.
+	txn.releaseMemory()
 	if txn.twopc {
 		txn.req = req
 		switch req.TxnMode {
@@ -401,7 +534,14 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 
 	log := txn.log
 	qr := &sqltypes.Result{}
-	allErrors := make([]error, 0, 8)
+	var allErrors []error
+	touched := 0
+
+	if txn.analyze {
+		defer func(start time.Time) {
+			txn.execStats.Cost += time.Since(start)
+		}(time.Now())
+	}
 
 	if txn.twopc {
 		defer queryStats.Record("txn.2pc.execute", time.Now())
@@ -411,31 +551,161 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 		txn.state.Set(int32(txnStateExecutingNormal))
 	}
 
+	// The querys still running are cancelled once the rows of the limit are received.
+	ctx := req.Context()
+	var satisfied sync2.AtomicBool
+	cancel := func() {}
+	if req.Limit > 0 {
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+	}
+
+	// merge used to merge the result of the backend query into the qr.
+	merge := func(back string, address string, tuple xcontext.QueryTuple, innerqr *sqltypes.Result, cost time.Duration) error {
+		mu.Lock()
+		if txn.analyze {
+			txn.execStats.add(back, tuple.Query, cost, innerqr)
+		}
+		if req.TxnMode == xcontext.TxnWrite {
+			sk.Record(tuple, true, innerqr.RowsAffected)
+		} else {
+			sk.Record(tuple, false, uint64(len(innerqr.Rows)))
+		}
+		// The rows after the limit satisfied are useless.
+		if satisfied.Get() {
+			mu.Unlock()
+			return nil
+		}
+		qr.AppendResult(innerqr)
+		rows := len(qr.Rows)
+		if req.Limit > 0 && rows >= req.Limit {
+			satisfied.Set(true)
+			txnCounters.Add(txnCounterLimitSatisfied, 1)
+			cancel()
+		}
+		mu.Unlock()
+		bytes := resultBytes(innerqr)
+		txn.mgr.memory.Grow(bytes)
+		txn.memBytes.Add(bytes)
+
+		// Abort the merge if the max result rows exceeded, the rows of the normal request are reduced by
+		// the executor(LIMIT, aggregation and so on), they are checked on its final result instead.
+		if req.Mode != xcontext.ReqNormal && txn.maxResultRows > 0 && rows > txn.maxResultRows {
+			txnCounters.Add(txnCounterMaxResultRows, 1)
+			x := xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, max result rows[%d] exceeded", txn.maxResultRows)
+			log.Error("txn.execute.on[%v].query[%v].error:%+v", address, tuple.Query, x)
+			return x
+		}
+		return nil
+	}
+
+	// snapshots are the connections of the backends which start the consistent snapshots.
+	var snapshots map[string]Connection
+	snapshot := func(backs []string) error {
+		if !txn.snapshotable(len(backs)) {
+			return nil
+		}
+		conns, x := txn.startSnapshots(ctx, backs)
+		if x != nil {
+			txn.endSnapshots(conns)
+			return x
+		}
+		snapshots = make(map[string]Connection, len(backs))
+		for i, back := range backs {
+			snapshots[back] = conns[i]
+		}
+		return nil
+	}
+	defer func() {
+		if snapshots != nil {
+			conns := make([]Connection, 0, len(snapshots))
+			for _, conn := range snapshots {
+				conns = append(conns, conn)
+			}
+			txn.endSnapshots(conns)
+		}
+	}()
+	fetch := func(back string) (Connection, error) {
+		if c, ok := snapshots[back]; ok {
+			return c, nil
+		}
+		return txn.fetchOneConnection(back)
+	}
+
 	// Execute backend-querys.
-	oneShard := func(back string, txn *Txn, querys []string) {
+	oneShard := func(back string, txn *Txn, querys []xcontext.QueryTuple) {
 		var x error
 		var c Connection
 		defer wg.Done()
 
-		if c, x = txn.fetchOneConnection(back); x != nil {
+		phase, table := phaseConnect, querys[0].Table
+		if c, x = fetch(back); x != nil {
 			log.Error("txn.fetch.connection.on[%s].querys[%v].error:%+v", back, querys, x)
 		} else {
-			log.Debug("conn[%v].txn.sessid[%v].execute[%v]", c.ID(), txn.sessionID, querys[0])
-			for _, query := range querys {
+			log.Debug("conn[%v].txn.sessid[%v].execute[%v]", c.ID(), txn.sessionID, querys[0].Query)
+			phase = phaseExecute
+			for _, tuple := range querys {
 				var innerqr *sqltypes.Result
+				query := tuple.Query
+				table = tuple.Table
+
+				// The querys not started yet of the cancelled txn.
+				if txn.cancelled.Get() {
+					x = errQueryCancelled()
+					break
+				}
+				if x = xbase.NewContextError(ctx); x != nil {
+					break
+				}
 
-				// Execute to backends.
-				if innerqr, x = c.ExecuteWithLimits(query, txn.timeout, txn.maxResult); x != nil {
+				// Execute to backends, the query is killed once the request is done.
+				start := time.Now()
+				stop := watchContext(ctx, c)
+				if req.RawRows {
+					innerqr, x = c.ExecuteRawWithLimits(txn.queryTag+query, txn.timeout, txn.maxResult)
+				} else {
+					innerqr, x = c.ExecuteWithLimits(txn.queryTag+query, txn.timeout, txn.maxResult)
+				}
+				if stop() {
+					x = xbase.NewContextError(ctx)
+				}
+				if txn.queryDone != nil {
+					txn.queryDone(back, query, x)
+				}
+				if x != nil {
 					log.Error("txn.execute.on[%v].query[%v].error:%+v", c.Address(), query, x)
 					break
 				}
-				mu.Lock()
-				qr.AppendResult(innerqr)
-				mu.Unlock()
+				if x = merge(back, c.Address(), tuple, innerqr, time.Since(start)); x != nil {
+					break
+				}
 			}
 		}
 
+		// The querys cancelled by the limit satisfied aren't errors.
+		if x != nil && !satisfied.Get() {
+			x = txn.shardError(back, table, phase, x)
+			mu.Lock()
+			allErrors = append(allErrors, x)
+			mu.Unlock()
+		}
+	}
+
+	// hedgeShard executes the point select on the replicas of the backend with the hedged reads.
+	hedgeShard := func(tuple xcontext.QueryTuple) {
+		defer wg.Done()
+
+		start := time.Now()
+		innerqr, address, x := txn.executeHedged(ctx, tuple.Backend, tuple.Query, req.RawRows)
+		if x == nil {
+			x = merge(tuple.Backend, address, tuple, innerqr, time.Since(start))
+		}
 		if x != nil {
+			phase := phaseExecute
+			if address == "" {
+				phase = phaseConnect
+			}
+			x = txn.shardError(tuple.Backend, tuple.Table, phase, x)
 			mu.Lock()
 			allErrors = append(allErrors, x)
 			mu.Unlock()
@@ -446,26 +716,38 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 	// ReqSingle mode: execute on one of the txn.backends,
 	// it is random sometimes, be careful.
 	case xcontext.ReqSingle:
-		qs := []string{req.RawQuery}
+		qs := []xcontext.QueryTuple{{Query: req.RawQuery}}
 		for back, pool := range txn.backends {
 			if pool.conf.Role != config.NormalBackend {
 				continue
 			}
 
 			wg.Add(1)
+			touched++
 			oneShard(back, txn, qs)
 			break
 		}
 	// ReqScatter mode: execute on the all shards of txn.backends.
 	case xcontext.ReqScatter:
-		qs := []string{req.RawQuery}
+		qs := []xcontext.QueryTuple{{Query: req.RawQuery}}
 		beLen := len(txn.backends)
+		if beLen > 1 {
+			if err = txn.mgr.memory.Admit(ctx); err != nil {
+				return nil, err
+			}
+		}
+		backs := make([]string, 0, beLen)
 		for back, pool := range txn.backends {
-			if pool.conf.Role != config.NormalBackend {
-				continue
+			if pool.conf.Role == config.NormalBackend {
+				backs = append(backs, back)
 			}
-
+		}
+		if err = snapshot(backs); err != nil {
+			return nil, err
+		}
+		for _, back := range backs {
 			wg.Add(1)
+			touched++
 			if beLen > 1 {
 				go oneShard(back, txn, qs)
 			} else {
@@ -474,20 +756,47 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 		}
 	// ReqNormal mode: execute on the some shards of txn.backends.
 	case xcontext.ReqNormal:
-		queryMap := make(map[string][]string)
+		// Point query, no need to group the querys by backend.
+		if len(req.Querys) == 1 {
+			wg.Add(1)
+			touched++
+			if txn.hedgeable(req) {
+				hedgeShard(req.Querys[0])
+			} else {
+				if err = snapshot([]string{req.Querys[0].Backend}); err != nil {
+					return nil, err
+				}
+				oneShard(req.Querys[0].Backend, txn, req.Querys)
+			}
+			break
+		}
+		queryMap := make(map[string][]xcontext.QueryTuple)
 		for _, query := range req.Querys {
 			v, ok := queryMap[query.Backend]
 			if !ok {
-				v = make([]string, 0, 4)
-				v = append(v, query.Query)
+				v = make([]xcontext.QueryTuple, 0, 4)
+				v = append(v, query)
 			} else {
-				v = append(v, query.Query)
+				v = append(v, query)
 			}
 			queryMap[query.Backend] = v
 		}
 		beLen := len(queryMap)
+		if beLen > 1 {
+			if err = txn.mgr.memory.Admit(ctx); err != nil {
+				return nil, err
+			}
+		}
+		backs := make([]string, 0, beLen)
+		for back := range queryMap {
+			backs = append(backs, back)
+		}
+		if err = snapshot(backs); err != nil {
+			return nil, err
+		}
 		for back, qs := range queryMap {
 			wg.Add(1)
+			touched++
 			if beLen > 1 {
 				go oneShard(back, txn, qs)
 			} else {
@@ -499,10 +808,202 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 	wg.Wait()
 	if len(allErrors) > 0 {
 		err = allErrors[0]
+		if txn.partialResult && req.TxnMode == xcontext.TxnRead && len(allErrors) < touched && !limitsExceeded(allErrors) {
+			log.Warning("txn.execute.partial.result.skips[%d].of[%d].backends.error:%v", len(allErrors), touched, err)
+			txnCounters.Add(txnCounterPartialResult, 1)
+			qr.Warnings = uint16(len(allErrors))
+			err = nil
+		}
 	}
+	planObserve(req, touched, err)
 	return qr, err
 }
 
+// hedgeRead is the hedged read of the point select on one target.
+type hedgeRead struct {
+	target *Pool
+	conn   Connection
+	start  time.Time
+	qr     *sqltypes.Result
+	err    error
+	cost   time.Duration
+	done   bool // the read is received.
+}
+
+// hedgeable returns true if the request is the point select to the replicas and the hedged reads are enabled.
+func (txn *Txn) hedgeable(req *xcontext.RequestContext) bool {
+	if !txn.replica || txn.twopc || txn.watermark != nil || req.TxnMode != xcontext.TxnRead || len(req.Querys) != 1 {
+		return false
+	}
+	pool, ok := txn.backends[req.Querys[0].Backend]
+	return ok && len(pool.replicas) > 0 && txn.mgr.hedge.Delay() > 0
+}
+
+// executeHedged used to execute the point select on the fastest replica of the backend, the query is also sent
+// to the second target if it's not done in the hedge delay or it fails, the first succeeded response wins.
+// The second target falls back at once without the hedge if the fastest replica can't be connected.
+// The address of the response is returned, it's empty if no target can be connected.
+func (txn *Txn) executeHedged(ctx context.Context, back string, query string, raw bool) (*sqltypes.Result, string, error) {
+	log := txn.log
+	hedge := txn.mgr.hedge
+	first, second := txn.backends[back].hedgeTargets()
+	if txn.cancelled.Get() {
+		return nil, "", errQueryCancelled()
+	}
+
+	var running []*hedgeRead
+	reads := make(chan *hedgeRead, 2)
+	send := func(target *Pool) error {
+		conn, err := target.Get()
+		if err != nil {
+			log.Warning("txn.hedge.get.connection.from[%s].of.backend[%s].error:%+v", target.conf.Address, back, err)
+			return err
+		}
+		read := &hedgeRead{target: target, conn: conn, start: time.Now()}
+		running = append(running, read)
+		go func() {
+			if raw {
+				read.qr, read.err = conn.ExecuteRawWithLimits(txn.queryTag+query, txn.timeout, txn.maxResult)
+			} else {
+				read.qr, read.err = conn.ExecuteWithLimits(txn.queryTag+query, txn.timeout, txn.maxResult)
+			}
+			read.cost = time.Since(read.start)
+			reads <- read
+		}()
+		return nil
+	}
+
+	// The second target is sent once, by the delay or the failure of the first.
+	hedged := false
+	sendHedge := func() {
+		hedged = true
+		if !hedge.acquire() {
+			txnCounters.Add(txnCounterHedgeThrottled, 1)
+			return
+		}
+		txnCounters.Add(txnCounterHedgeSent, 1)
+		send(second)
+	}
+
+	var timer <-chan time.Time
+	if err := send(first); err != nil {
+		hedged = true
+		txnCounters.Add(txnCounterReplicaFallback, 1)
+		if err := send(second); err != nil {
+			return nil, "", err
+		}
+	} else {
+		timer = hedge.after()
+	}
+
+	var err error
+	var address string
+	for received := 0; received < len(running); {
+		select {
+		case read := <-reads:
+			received++
+			read.done = true
+			address = read.conn.Address()
+			if read.err == nil {
+				read.target.observeLatency(read.cost)
+				if read.target != first {
+					txnCounters.Add(txnCounterHedgeWon, 1)
+				}
+				txn.normalConnMu.Lock()
+				txn.normalConnections = append(txn.normalConnections, read.conn)
+				txn.normalConnMu.Unlock()
+				abandonHedged(running, reads, "hedged.read.lost")
+				return read.qr, address, nil
+			}
+			log.Error("txn.hedge.execute.on[%v].query[%v].error:%+v", address, query, read.err)
+			read.conn.Close()
+			if err == nil {
+				err = read.err
+			}
+			if !hedged {
+				timer = nil
+				sendHedge()
+			}
+		case <-timer:
+			timer = nil
+			if !hedged {
+				sendHedge()
+			}
+		case <-ctx.Done():
+			abandonHedged(running, reads, ctx.Err().Error())
+			return nil, first.conf.Address, xbase.NewContextError(ctx)
+		}
+	}
+	return nil, address, err
+}
+
+// abandonHedged used to kill the hedged reads still running, their connections are closed once the querys return.
+// The latencys of the targets are moved by the time they took at least.
+func abandonHedged(running []*hedgeRead, reads <-chan *hedgeRead, reason string) {
+	var abandoned []*hedgeRead
+	for _, read := range running {
+		if !read.done {
+			read.target.observeLatency(time.Since(read.start))
+			abandoned = append(abandoned, read)
+		}
+	}
+	if len(abandoned) == 0 {
+		return
+	}
+	go func() {
+		for _, read := range abandoned {
+			read.conn.KillQuery(reason)
+		}
+		for range abandoned {
+			read := <-reads
+			read.conn.Close()
+		}
+	}()
+}
+
+// releaseMemory used to release the result bytes of the txn accounted in the mgr memory.
+func (txn *Txn) releaseMemory() {
+	bytes := txn.memBytes.Get()
+	txn.memBytes.Add(-bytes)
+	txn.mgr.memory.Shrink(bytes)
+}
+
+// limitsExceeded returns true if any error is the query interrupted by the limits, the partial result can't skip it.
+func limitsExceeded(errs []error) bool {
+	for _, err := range errs {
+		if se, ok := err.(*sqldb.SQLError); ok && se.Num == xbase.ER_RADON_QUERY_INTERRUPTED {
+			return true
+		}
+	}
+	return false
+}
+
+// watchContext used to kill the executing query of the connection once the ctx is done,
+// the stop waits for the watcher exits and returns true if the query is killed.
+func watchContext(ctx context.Context, c Connection) (stop func() bool) {
+	if ctx.Done() == nil {
+		return func() bool { return false }
+	}
+
+	var killed sync2.AtomicBool
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			killed.Set(true)
+			c.KillQuery(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+	return func() bool {
+		close(done)
+		<-exited
+		return killed.Get()
+	}
+}
+
 // ExecuteStreamFetch used to execute stream fetch query.
 func (txn *Txn) ExecuteStreamFetch(req *xcontext.RequestContext, callback func(*sqltypes.Result) error, streamBufferSize int) error {
 	var err error
@@ -513,16 +1014,27 @@ func (txn *Txn) ExecuteStreamFetch(req *xcontext.RequestContext, callback func(*
 	cursors := make([]driver.Rows, 0, 8)
 	allErrors := make([]error, 0, 8)
 
+	// The snapshots are ended after the cursors are closed.
+	var snapshots []Connection
+	defer func() {
+		txn.endSnapshots(snapshots)
+	}()
 	defer func() {
 		for _, cursor := range cursors {
 			cursor.Close()
 		}
 	}()
 
-	oneShard := func(c Connection, query string) {
+	ctx := req.Context()
+	oneShard := func(c Connection, qt xcontext.QueryTuple) {
 		defer wg.Done()
-		cursor, x := c.ExecuteStreamFetch(query)
+		stop := watchContext(ctx, c)
+		cursor, x := c.ExecuteStreamFetch(txn.queryTag + qt.Query)
+		if stop() {
+			x = xbase.NewContextError(ctx)
+		}
 		if x != nil {
+			x = txn.shardError(qt.Backend, qt.Table, phaseExecute, x)
 			mu.Lock()
 			allErrors = append(allErrors, x)
 			mu.Unlock()
@@ -533,13 +1045,28 @@ func (txn *Txn) ExecuteStreamFetch(req *xcontext.RequestContext, callback func(*
 		mu.Unlock()
 	}
 
-	for _, qt := range req.Querys {
+	// Each query has its own connection, the snapshot is started on each of them.
+	if txn.snapshotable(len(req.Querys)) {
+		backs := make([]string, 0, len(req.Querys))
+		for _, qt := range req.Querys {
+			backs = append(backs, qt.Backend)
+		}
+		if snapshots, err = txn.startSnapshots(ctx, backs); err != nil {
+			return err
+		}
+	}
+	for i, qt := range req.Querys {
 		var conn Connection
-		if conn, err = txn.fetchOneConnection(qt.Backend); err != nil {
+		if err = xbase.NewContextError(ctx); err != nil {
 			return err
 		}
+		if snapshots != nil {
+			conn = snapshots[i]
+		} else if conn, err = txn.fetchOneConnection(qt.Backend); err != nil {
+			return txn.shardError(qt.Backend, qt.Table, phaseConnect, err)
+		}
 		wg.Add(1)
-		go oneShard(conn, qt.Query)
+		go oneShard(conn, qt)
 	}
 	wg.Wait()
 	if len(allErrors) > 0 {
@@ -608,7 +1135,19 @@ func (txn *Txn) ExecuteStreamFetch(req *xcontext.RequestContext, callback func(*
 			wg.Done()
 		}()
 		for {
-			if row, ok := <-rows; ok {
+			var row []sqltypes.Value
+			var ok bool
+			select {
+			case row, ok = <-rows:
+			case <-ctx.Done():
+				x := xbase.NewContextError(ctx)
+				log.Error("txn.stream.cursor.recv.error:%+v", x)
+				mu.Lock()
+				allErrors = append(allErrors, x)
+				mu.Unlock()
+				return
+			}
+			if ok {
 				rowLen := sqltypes.Values(row).Len()
 				allRowCount++
 				byteCount += rowLen
@@ -687,6 +1226,7 @@ func (txn *Txn) ExecuteOnThisBackend(backend string, query string) (*sqltypes.Re
 // otherwise we wil close all of the them.
 func (txn *Txn) Finish() error {
 	txnCounters.Add(txnCounterTxnFinish, 1)
+	txn.releaseMemory()
 
 	txn.mu.Lock()
 	defer txn.mu.Unlock()
@@ -764,6 +1304,62 @@ func (txn *Txn) Abort() error {
 	return nil
 }
 
+// Cancel used to cancel the executing querys of the txn by KILL QUERY, the connections are kept
+// for the rollback, the querys not started yet fail at once.
+// The txn.mu is held until the kills are sent, so the connections can't be recycled to the other sessions
+// by the Finish or Abort meanwhile, it's a no-op once the txn is finished or aborted.
+func (txn *Txn) Cancel(reason string) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	switch txn.state.Get() {
+	case int32(txnStateFinshing), int32(txnStateAborting):
+		return nil
+	}
+	txnCounters.Add(txnCounterTxnCancel, 1)
+	txn.cancelled.Set(true)
+
+	var conns []Connection
+	txn.twopcConnMu.RLock()
+	for _, conn := range txn.twopcConnections {
+		conns = append(conns, conn)
+	}
+	txn.twopcConnMu.RUnlock()
+	txn.normalConnMu.RLock()
+	conns = append(conns, txn.normalConnections...)
+	txn.normalConnMu.RUnlock()
+
+	var err error
+	for _, conn := range conns {
+		if x := conn.KillQuery(reason); x != nil {
+			err = x
+		}
+	}
+	return err
+}
+
+// Connections returns the backend connections held by the txn, ordered by the backend.
+func (txn *Txn) Connections() []ConnectionInfo {
+	var infos []ConnectionInfo
+	txn.twopcConnMu.RLock()
+	for _, conn := range txn.twopcConnections {
+		infos = append(infos, conn.Info())
+	}
+	txn.twopcConnMu.RUnlock()
+	txn.normalConnMu.RLock()
+	for _, conn := range txn.normalConnections {
+		infos = append(infos, conn.Info())
+	}
+	txn.normalConnMu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Backend != infos[j].Backend {
+			return infos[i].Backend < infos[j].Backend
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
 // WriteXaCommitErrLog used to write the error xaid to the log.
 func (txn *Txn) WriteXaCommitErrLog(state string) error {
 	return txn.mgr.xaCheck.WriteXaCommitErrLog(txn, state)
@@ -9,9 +9,11 @@
 package backend
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"xcontext"
 
@@ -95,6 +97,266 @@ func TestTxnNormalExecute(t *testing.T) {
 	}
 }
 
+func TestTxnCancel(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+		xcontext.QueryTuple{Query: "select * from node3", Backend: addrs[1]},
+	}
+	fakedb.AddQueryDelay(querys[0].Query, result1, 10000)
+	fakedb.AddQueryDelay(querys[1].Query, result2, 10000)
+	fakedb.AddQuery(querys[2].Query, result2)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	// Nothing is executing.
+	err = txn.Cancel("test")
+	assert.Nil(t, err)
+
+	// Cancel the executing querys.
+	txn, err = txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		txn.Cancel("test")
+	}()
+	start := time.Now()
+	_, err = txn.Execute(&xcontext.RequestContext{Querys: querys})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Query execution was interrupted, the query is cancelled")
+	assert.True(t, time.Since(start) < time.Second*5)
+	assert.Equal(t, 0, fakedb.GetQueryCalledNum(querys[2].Query))
+
+	// The querys not started yet fail at once.
+	_, err = txn.Execute(&xcontext.RequestContext{Querys: querys[2:]})
+	assert.Contains(t, err.Error(), "Query execution was interrupted, the query is cancelled")
+
+	// The finished txn doesn't kill the query of its recycled connection.
+	{
+		fakedb.AddQuery("select * from node4", result1)
+		fakedb.AddQueryDelay("select * from node5", result1, 500)
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		_, err = txn.Execute(&xcontext.RequestContext{Querys: []xcontext.QueryTuple{{Query: "select * from node4", Backend: addrs[0]}}})
+		assert.Nil(t, err)
+		txn.Finish()
+
+		conn, err := backends[addrs[0]].Get()
+		assert.Nil(t, err)
+		defer conn.Recycle()
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			txn.Cancel("test")
+		}()
+		_, err = conn.Execute("select * from node5")
+		assert.Nil(t, err)
+		assert.False(t, txn.cancelled.Get())
+	}
+}
+
+func TestTxnQueryTag(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+	}
+	tagged := []string{
+		"/* radon=127.0.0.1:8080 session=1 user=mock* / */ select * from node1",
+		"/* radon=127.0.0.1:8080 session=1 user=mock* / */ select * from node2",
+	}
+	fakedb.AddQuery(querys[0].Query, result1)
+	fakedb.AddQuery(querys[1].Query, result1)
+	fakedb.AddQuery(tagged[0], result1)
+	fakedb.AddQuery(tagged[1], result1)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	// The '*/' in the tag is escaped.
+	txn.SetQueryTag("radon=127.0.0.1:8080 session=1 user=mock*/")
+	_, err = txn.Execute(&xcontext.RequestContext{Querys: querys})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum(tagged[0]))
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum(tagged[1]))
+	assert.Equal(t, 0, fakedb.GetQueryCalledNum(querys[0].Query))
+
+	// No tag.
+	txn.SetQueryTag("")
+	_, err = txn.Execute(&xcontext.RequestContext{Querys: querys})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum(querys[0].Query))
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum(querys[1].Query))
+}
+
+func TestTxnReplica(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	fakedb, txnMgr, _, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	// The replica of the backend is addrs[1], the replica of the backend2 can't be connected.
+	conf := MockBackendConfigDefault("backend", addrs[0])
+	conf.Replicas = []string{addrs[1]}
+	conf2 := MockBackendConfigDefault("backend2", addrs[0])
+	conf2.Replicas = []string{"127.0.0.1:1"}
+	backends := map[string]*Pool{
+		"backend":  NewPool(log, conf),
+		"backend2": NewPool(log, conf2),
+	}
+	defer func() {
+		for _, pool := range backends {
+			pool.Close()
+		}
+	}()
+	assert.Nil(t, NewPool(log, MockBackendConfigDefault("backend3", addrs[0])).Replica())
+
+	query := xcontext.QueryTuple{Query: "select * from node1", Backend: "backend"}
+	fakedb.AddQuery(query.Query, result1)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	// Primary.
+	conn, err := txn.normalConnection("backend")
+	assert.Nil(t, err)
+	assert.Equal(t, addrs[0], conn.Address())
+
+	// Replica.
+	txn.SetReplica(true)
+	conn, err = txn.normalConnection("backend")
+	assert.Nil(t, err)
+	assert.Equal(t, addrs[1], conn.Address())
+	got, err := txn.Execute(&xcontext.RequestContext{Querys: []xcontext.QueryTuple{query}})
+	assert.Nil(t, err)
+	assert.Equal(t, result1, got)
+
+	// Fallback to the primary.
+	conn, err = txn.normalConnection("backend2")
+	assert.Nil(t, err)
+	assert.Equal(t, addrs[0], conn.Address())
+}
+
+func TestTxnExecuteContext(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+		xcontext.QueryTuple{Query: "select * from node3", Backend: addrs[1]},
+	}
+	fakedb.AddQueryDelay(querys[0].Query, result1, 10000)
+	fakedb.AddQueryDelay(querys[1].Query, result2, 10000)
+	fakedb.AddQuery(querys[2].Query, result2)
+
+	// The querys are killed once the deadline exceeded.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+		defer cancel()
+		start := time.Now()
+		_, err = txn.Execute(&xcontext.RequestContext{Querys: querys, Ctx: ctx})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Query execution was interrupted, the deadline exceeded")
+		assert.True(t, time.Since(start) < time.Second*5)
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum(querys[2].Query))
+	}
+
+	// The cancelled request executes nothing.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = txn.Execute(&xcontext.RequestContext{Querys: querys[2:], Ctx: ctx})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "Query execution was interrupted, the query is cancelled")
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum(querys[2].Query))
+	}
+
+	// The request is done after the query.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		qr, err := txn.Execute(&xcontext.RequestContext{Querys: querys[2:], Ctx: ctx})
+		cancel()
+		assert.Nil(t, err)
+		assert.Equal(t, result2, qr)
+	}
+}
+
+func TestTxnExecuteLimit(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+		xcontext.QueryTuple{Query: "select * from node3", Backend: addrs[1]},
+	}
+	fakedb.AddQuery(querys[0].Query, result1)
+	fakedb.AddQueryDelay(querys[1].Query, result2, 10000)
+	fakedb.AddQuery(querys[2].Query, result2)
+
+	// The querys still running are cancelled once the limit satisfied.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		satisfied := txnCounters.Counts()[txnCounterLimitSatisfied]
+		start := time.Now()
+		qr, err := txn.Execute(&xcontext.RequestContext{Querys: querys, Limit: len(result1.Rows)})
+		assert.Nil(t, err)
+		assert.Equal(t, result1, qr)
+		assert.True(t, time.Since(start) < time.Second*5)
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum(querys[2].Query))
+		assert.Equal(t, satisfied+1, txnCounters.Counts()[txnCounterLimitSatisfied])
+	}
+
+	// The limit isn't satisfied, all the rows are read.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		qr, err := txn.Execute(&xcontext.RequestContext{Querys: querys[2:], Limit: len(result2.Rows) + 1})
+		assert.Nil(t, err)
+		assert.Equal(t, result2, qr)
+	}
+}
+
 func TestTxnNormalExecuteWithAttach(t *testing.T) {
 	defer leaktest.Check(t)()
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -245,7 +507,7 @@ func TestTxnExecuteStreamFetch(t *testing.T) {
 			callbackQr.AppendResult(qr)
 			return nil
 		}, 1024*1024)
-		want := "mock.stream.query.error (errno 1105) (sqlstate HY000)"
+		want := fmt.Sprintf("mock.stream.query.error (backend:%s, phase:execute) (errno 1105) (sqlstate HY000)", querys[0].Backend)
 		got := err.Error()
 		assert.Equal(t, want, got)
 	}
@@ -278,6 +540,186 @@ func TestTxnNormalError(t *testing.T) {
 	}
 }
 
+func TestTxnPartialResult(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 3)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+	}
+	fakedb.AddQueryError("select * from node1", errors.New("mock.execute.error"))
+	fakedb.AddQuery("select * from node2", result1)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetPartialResult(true)
+
+	// The failed backend is skipped.
+	{
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnRead,
+		}
+		got, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, result1.Rows, got.Rows)
+		assert.Equal(t, uint16(1), got.Warnings)
+	}
+
+	// All backends failed.
+	{
+		rctx := &xcontext.RequestContext{
+			Querys:  querys[:1],
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.NotNil(t, err)
+	}
+
+	// The writes are not partial.
+	{
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnWrite,
+		}
+		_, err := txn.Execute(rctx)
+		assert.NotNil(t, err)
+	}
+
+	// The limits exceeded, the rows of the normal request are checked by the executor.
+	{
+		txn.SetMaxResultRows(1)
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+
+		rctx = &xcontext.RequestContext{
+			RawQuery: "select * from node2",
+			Mode:     xcontext.ReqScatter,
+			TxnMode:  xcontext.TxnRead,
+		}
+		_, err = txn.Execute(rctx)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestTxnConsistentRead(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+	}
+	fakedb.AddQuery("select * from node1", result1)
+	fakedb.AddQuery("select * from node2", result2)
+	fakedb.AddQuery(snapshotStartQuery, &sqltypes.Result{})
+	fakedb.AddQuery(snapshotEndQuery, &sqltypes.Result{})
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetConsistentRead(true)
+
+	// The snapshots are started on the backends and ended after the read.
+	{
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnRead,
+		}
+		got, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, len(result1.Rows)+len(result2.Rows), len(got.Rows))
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(snapshotStartQuery))
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(snapshotEndQuery))
+	}
+
+	// The read of one backend starts no snapshot.
+	{
+		rctx := &xcontext.RequestContext{
+			Querys:  querys[:1],
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(snapshotStartQuery))
+	}
+
+	// The scatter read.
+	{
+		fakedb.AddQuery("select 1", result1)
+		rctx := &xcontext.RequestContext{
+			Mode:     xcontext.ReqScatter,
+			RawQuery: "select 1",
+			TxnMode:  xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, fakedb.GetQueryCalledNum(snapshotStartQuery))
+		assert.Equal(t, 4, fakedb.GetQueryCalledNum(snapshotEndQuery))
+	}
+
+	// The stream fetch.
+	{
+		fakedb.AddQueryStream("select * from node1", result1)
+		fakedb.AddQueryStream("select * from node2", result2)
+		rctx := &xcontext.RequestContext{
+			Querys: querys,
+		}
+		rows := 0
+		err := txn.ExecuteStreamFetch(rctx, func(qr *sqltypes.Result) error {
+			rows += len(qr.Rows)
+			return nil
+		}, 1024)
+		assert.Nil(t, err)
+		assert.Equal(t, len(result1.Rows)+len(result2.Rows), rows)
+		assert.Equal(t, 6, fakedb.GetQueryCalledNum(snapshotStartQuery))
+		assert.Equal(t, 6, fakedb.GetQueryCalledNum(snapshotEndQuery))
+	}
+
+	// The snapshots wait for the XA commit holding the commit lock.
+	{
+		txnMgr.CommitLock()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			rctx := &xcontext.RequestContext{
+				Querys:  querys,
+				TxnMode: xcontext.TxnRead,
+			}
+			_, err := txn.Execute(rctx)
+			assert.Nil(t, err)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, 6, fakedb.GetQueryCalledNum(snapshotStartQuery))
+		txnMgr.CommitUnlock()
+		<-done
+		assert.Equal(t, 8, fakedb.GetQueryCalledNum(snapshotStartQuery))
+		assert.Equal(t, 8, fakedb.GetQueryCalledNum(snapshotEndQuery))
+	}
+
+	// The read fails if the snapshot can't be started, the started ones are ended.
+	{
+		fakedb.AddQueryError(snapshotStartQuery, errors.New("mock.snapshot.error"))
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.NotNil(t, err)
+		assert.Equal(t, 10, fakedb.GetQueryCalledNum(snapshotEndQuery))
+	}
+}
+
 func TestTxnErrorBackendNotExists(t *testing.T) {
 	defer leaktest.Check(t)()
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -300,7 +742,7 @@ func TestTxnErrorBackendNotExists(t *testing.T) {
 		assert.Nil(t, err)
 		defer txn.Finish()
 		_, err = txn.Execute(rctx)
-		want := "txn.can.not.get.normal.connection.by.backend[xx].from.pool"
+		want := "txn.can.not.get.normal.connection.by.backend[xx].from.pool (backend:xx, phase:connect) (errno 9001) (sqlstate HY000)"
 		got := err.Error()
 		assert.Equal(t, want, got)
 	}
@@ -410,9 +852,40 @@ func TestTxnSetting(t *testing.T) {
 		{
 			_, err := txn.ExecuteScatter(query)
 			got := err.Error()
-			want := "Query execution was interrupted, max memory usage[10 bytes] exceeded"
-			assert.Equal(t, want, got)
+			want := `^Query execution was interrupted, max memory usage\[10 bytes\] exceeded \(backend:.*, phase:execute\) \(errno 9002\) \(sqlstate HY000\)$`
+			assert.Regexp(t, want, got)
+		}
+	}
+
+	// max result rows.
+	{
+		txn.SetMaxResult(0)
+		txn.SetMaxResultRows(3)
+		// scatter execute.
+		{
+			_, err := txn.ExecuteScatter(query)
+			got := err.Error()
+			want := `^Query execution was interrupted, max result rows\[3\] exceeded \(backend:.*, phase:execute\) \(errno 9002\) \(sqlstate HY000\)$`
+			assert.Regexp(t, want, got)
+		}
+		txn.SetMaxResultRows(0)
+	}
+
+	// analyze.
+	{
+		txn.SetAnalyze(true)
+		_, err := txn.ExecuteScatter(query)
+		assert.Nil(t, err)
+		stats := txn.ExecStats()
+		assert.Equal(t, 2, len(stats.Stats))
+		for _, stat := range stats.Stats {
+			assert.Equal(t, query, stat.Query)
+			assert.Equal(t, 2, stat.Rows)
+			assert.Equal(t, 25, stat.Bytes)
+			assert.True(t, stat.Cost >= time.Second)
 		}
+		assert.True(t, stats.Cost >= time.Second)
+		txn.SetAnalyze(false)
 	}
 
 	{
@@ -25,13 +25,19 @@ type TxnManager struct {
 	txnid      uint64
 	txnNums    int64
 	commitLock sync.RWMutex
+	memory     *Memory
+	hedge      *Hedge
+	watermarks *Watermarks
 }
 
 // NewTxnManager creates new TxnManager.
 func NewTxnManager(log *xlog.Log) *TxnManager {
 	return &TxnManager{
-		log:   log,
-		txnid: 0,
+		log:        log,
+		txnid:      0,
+		memory:     NewMemory(log),
+		hedge:      NewHedge(),
+		watermarks: NewWatermarks(),
 	}
 }
 
@@ -0,0 +1,102 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"config"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+)
+
+// ValidateConfig used to check the backends metadata under the metadir without loading it,
+// returns the backend configs and all the problems found.
+func ValidateConfig(metadir string) ([]*config.BackendConfig, []error) {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	file := path.Join(metadir, backendjson)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		report("backend: can not read the backends file[%s]:%v", file, err)
+		return nil, errs
+	}
+	conf, err := config.ReadBackendsConfig(string(data))
+	if err != nil {
+		report("backend: backends file[%s] is not a valid json:%v", file, err)
+		return nil, errs
+	}
+
+	names := make(map[string]bool)
+	for _, b := range conf.Backends {
+		if b.Name == "" {
+			report("backend: the backend with address[%s] has an empty name", b.Address)
+		}
+		if names[b.Name] {
+			report("backend: the backend name[%s] is duplicate", b.Name)
+		}
+		names[b.Name] = true
+		if b.Address == "" {
+			report("backend: backend[%s] has an empty address", b.Name)
+		}
+		if b.User == "" {
+			report("backend: backend[%s] has an empty user", b.Name)
+		}
+		if b.MaxConnections <= 0 {
+			report("backend: backend[%s] max-connections[%d] must be greater than 0", b.Name, b.MaxConnections)
+		}
+		for _, replica := range b.Replicas {
+			if replica == "" || replica == b.Address {
+				report("backend: backend[%s] replica[%s] must be set and differ from the address", b.Name, replica)
+			}
+		}
+		switch b.CompatMode {
+		case "", CompatMySQL57, CompatMySQL80, CompatMariaDB:
+		default:
+			report("backend: backend[%s] compat-mode[%s] is unsupported, must be one of %s, %s, %s", b.Name, b.CompatMode, CompatMySQL57, CompatMySQL80, CompatMariaDB)
+		}
+		switch b.ValidateStrategy {
+		case "", ValidatePing, ValidateSelect1, ValidateNone:
+		default:
+			report("backend: backend[%s] validate-strategy[%s] is unsupported, must be one of %s, %s, %s", b.Name, b.ValidateStrategy, ValidatePing, ValidateSelect1, ValidateNone)
+		}
+		if b.ValidateIdleTime < 0 {
+			report("backend: backend[%s] validate-idle-time[%d] must not be negative, 0 means the default %ds", b.Name, b.ValidateIdleTime, defaultValidateIdleTime)
+		}
+	}
+	return conf.Backends, errs
+}
+
+// CheckBackend used to connect to the backend and check the user can read the mysql.user,
+// which the radon authentication and privilege check depend on.
+func CheckBackend(conf *config.BackendConfig) error {
+	charset := conf.Charset
+	if charset == "" {
+		charset = "utf8"
+	}
+	conn, err := driver.NewConn(conf.User, conf.Password, conf.Address, "", charset)
+	if err != nil {
+		return fmt.Errorf("backend: can not connect to backend[%s] address[%s] as user[%s]:%v", conf.Name, conf.Address, conf.User, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.FetchAll("select user from mysql.user limit 1", -1); err != nil {
+		return fmt.Errorf("backend: user[%s] of backend[%s] can not read the mysql.user, grant the select privilege on mysql.* to it:%v", conf.User, conf.Name, err)
+	}
+	return nil
+}
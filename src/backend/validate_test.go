@@ -0,0 +1,101 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestBackendValidateConfig(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	metadir := fakedb.GetTmpDir("", "radon_backend_", log)
+	defer os.RemoveAll(metadir)
+	file := path.Join(metadir, backendjson)
+
+	// Not exists.
+	{
+		backends, errs := ValidateConfig(metadir)
+		assert.Nil(t, backends)
+		assert.Nil(t, errs)
+	}
+
+	// Broken json.
+	{
+		err := ioutil.WriteFile(file, []byte("wtf"), 0644)
+		assert.Nil(t, err)
+		_, errs := ValidateConfig(metadir)
+		assert.Equal(t, 1, len(errs))
+	}
+
+	// All the problems are reported.
+	{
+		conf := config.BackendsConfig{
+			Backends: []*config.BackendConfig{
+				{Name: "backend1", Address: "127.0.0.1:3306", User: "root", MaxConnections: 16, Replicas: []string{"127.0.0.1:3307", "127.0.0.1:3306"}},
+				{Name: "backend1", Address: "", User: "", MaxConnections: 0, CompatMode: "9.0", ValidateStrategy: "select", ValidateIdleTime: -1},
+			},
+		}
+		err := config.WriteConfig(file, conf)
+		assert.Nil(t, err)
+		backends, errs := ValidateConfig(metadir)
+		assert.Equal(t, 2, len(backends))
+		want := []string{
+			"backend: backend[backend1] replica[127.0.0.1:3306] must be set and differ from the address",
+			"backend: the backend name[backend1] is duplicate",
+			"backend: backend[backend1] has an empty address",
+			"backend: backend[backend1] has an empty user",
+			"backend: backend[backend1] max-connections[0] must be greater than 0",
+			"backend: backend[backend1] compat-mode[9.0] is unsupported, must be one of 5.7, 8.0, mariadb",
+			"backend: backend[backend1] validate-strategy[select] is unsupported, must be one of ping, select1, none",
+			"backend: backend[backend1] validate-idle-time[-1] must not be negative, 0 means the default 10s",
+		}
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestBackendCheckBackend(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb := fakedb.New(log, 1)
+	defer fakedb.Close()
+	conf := fakedb.BackendConfs()[0]
+
+	// Can't read the mysql.user.
+	{
+		err := CheckBackend(conf)
+		assert.NotNil(t, err)
+	}
+
+	// OK.
+	{
+		fakedb.AddQuery("select user from mysql.user limit 1", &sqltypes.Result{})
+		err := CheckBackend(conf)
+		assert.Nil(t, err)
+	}
+
+	// Connect error.
+	{
+		conf.Address = "127.0.0.1:1"
+		err := CheckBackend(conf)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"sync"
+	"time"
+
+	"config"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// ValidatePing validates the idle connection by the COM_PING.
+	ValidatePing = "ping"
+
+	// ValidateSelect1 validates the idle connection by the 'select 1', which goes through the backend executor.
+	ValidateSelect1 = "select1"
+
+	// ValidateNone disables the validation of the backend.
+	ValidateNone = "none"
+)
+
+var (
+	defaultValidateIdleTime int64 = 10 // 10s
+)
+
+// Validator tuple, it validates the idle connections of the pools in the background,
+// so the ones broken behind the firewalls or NAT are discarded before the sessions get them.
+type Validator struct {
+	log     *xlog.Log
+	scatter *Scatter
+	done    chan bool
+	ticker  *time.Ticker
+	wg      sync.WaitGroup
+}
+
+// NewValidator creates the Validator tuple.
+func NewValidator(scatter *Scatter, conf *config.ScatterConfig) *Validator {
+	return &Validator{
+		log:     scatter.log,
+		scatter: scatter,
+		done:    make(chan bool),
+		ticker:  time.NewTicker(time.Second * time.Duration(conf.ValidateInterval)),
+	}
+}
+
+// Init used to start the validator goroutine.
+func (v *Validator) Init() {
+	v.wg.Add(1)
+	go func() {
+		defer v.wg.Done()
+		v.validateLoop()
+	}()
+	v.log.Info("validator.init.done")
+}
+
+func (v *Validator) validateLoop() {
+	for {
+		select {
+		case <-v.ticker.C:
+			v.validate()
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// validate used to validate the pools in their own goroutines, the pool hung on the dead backend
+// doesn't block the others, and it's skipped by the next round until it returns.
+func (v *Validator) validate() {
+	for _, pool := range v.scatter.PoolClone() {
+		go pool.ValidateIdle()
+	}
+}
+
+// Close used to stop the validator goroutine.
+func (v *Validator) Close() {
+	close(v.done)
+	v.ticker.Stop()
+	v.wg.Wait()
+	v.log.Info("validator.close.done")
+}
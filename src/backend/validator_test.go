@@ -0,0 +1,55 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"xbase"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestValidator(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	scatter, _, cleanup := MockScatter(log, 2)
+	defer cleanup()
+	scatter.SetClock(clock)
+
+	// The idle connections of all the pools.
+	for _, pool := range scatter.PoolClone() {
+		conn, err := pool.Get()
+		assert.Nil(t, err)
+		pool.Put(conn)
+	}
+	clock.Advance(time.Duration(defaultValidateIdleTime) * time.Second)
+
+	conf := MockScatterDefault(log)
+	conf.ValidateInterval = 1
+	scatter.validator = NewValidator(scatter, conf)
+	scatter.validator.Init()
+
+	// validated returns the number of the pools validated.
+	validated := func() int {
+		n := 0
+		for _, pool := range scatter.PoolClone() {
+			if pool.counters.Counts()[poolCounterValidate] > 0 {
+				n++
+			}
+		}
+		return n
+	}
+	for i := 0; i < 30 && validated() < 2; i++ {
+		time.Sleep(time.Millisecond * 100)
+	}
+	assert.Equal(t, 2, validated())
+}
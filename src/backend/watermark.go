@@ -0,0 +1,207 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"config"
+	"xbase"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// watermarksKept is the number of the recent watermarks kept.
+	watermarksKept = 64
+
+	watermarkCaptureQuery = "SELECT @@GLOBAL.gtid_executed"
+)
+
+// Watermark tuple, it's the GTID sets executed by the backends at a consistent point,
+// no distributed transaction is committing when it's captured.
+type Watermark struct {
+	ID    uint64            `json:"id"`
+	Time  time.Time         `json:"time"`
+	GTIDs map[string]string `json:"gtids"`
+}
+
+// Watermarks keeps the recent GTID watermarks, they're captured at the commits of the distributed transactions
+// once in the interval. The reads as of a watermark wait for the backends to execute its GTID sets.
+type Watermarks struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	waitTimeout int
+	nextID      uint64
+	last        time.Time // the last capture at the commit.
+	recent      []*Watermark
+	clock       xbase.AtomicClock
+}
+
+// NewWatermarks creates the new Watermarks, the watermarks are not captured at the commits.
+func NewWatermarks() *Watermarks {
+	return &Watermarks{nextID: 1, waitTimeout: 1}
+}
+
+// SetClock used to set the clock of the interval.
+func (w *Watermarks) SetClock(clock xbase.Clock) {
+	w.clock.Set(clock)
+}
+
+// SetLimits used to set the min interval(in millisecond) between two watermarks captured at the commits and the
+// wait timeout(in second) of the reads, 0 interval disables the captures at the commits.
+func (w *Watermarks) SetLimits(interval int, waitTimeout int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.interval = time.Duration(interval) * time.Millisecond
+	w.waitTimeout = waitTimeout
+}
+
+// WaitTimeout returns the seconds the read waits for the backend to execute the GTID set of the watermark.
+func (w *Watermarks) WaitTimeout() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.waitTimeout
+}
+
+// Latest returns the latest watermark, nil if there's none.
+func (w *Watermarks) Latest() *Watermark {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.recent) == 0 {
+		return nil
+	}
+	return w.recent[len(w.recent)-1]
+}
+
+// Get returns the watermark of the id, nil if it's not captured or expired.
+func (w *Watermarks) Get(id uint64) *Watermark {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, wm := range w.recent {
+		if wm.ID == id {
+			return wm
+		}
+	}
+	return nil
+}
+
+// Recent returns the recent watermarks, the oldest first.
+func (w *Watermarks) Recent() []*Watermark {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*Watermark(nil), w.recent...)
+}
+
+// due returns true if the watermark should be captured at the commit, the next one is due after the interval
+// even if the capture fails.
+func (w *Watermarks) due() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.clock.Get().Now()
+	if w.interval <= 0 || now.Sub(w.last) < w.interval {
+		return false
+	}
+	w.last = now
+	return true
+}
+
+func (w *Watermarks) add(gtids map[string]string) *Watermark {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.clock.Get().Now()
+	wm := &Watermark{ID: w.nextID, Time: now, GTIDs: gtids}
+	w.nextID++
+	w.recent = append(w.recent, wm)
+	if len(w.recent) > watermarksKept {
+		w.recent = w.recent[len(w.recent)-watermarksKept:]
+	}
+	return wm
+}
+
+// captureWatermark used to capture the GTID sets executed by the primarys of the backends,
+// the caller must hold the commit lock so no distributed transaction is committing.
+func (mgr *TxnManager) captureWatermark(backends map[string]*Pool) (*Watermark, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var allErrors []error
+
+	gtids := make(map[string]string, len(backends))
+	capture := func(name string, pool *Pool) {
+		defer wg.Done()
+		gtid, err := func() (string, error) {
+			conn, err := pool.Get()
+			if err != nil {
+				return "", err
+			}
+			qr, err := conn.Execute(watermarkCaptureQuery)
+			if err != nil {
+				conn.Close()
+				return "", err
+			}
+			conn.Recycle()
+			if len(qr.Rows) == 0 || len(qr.Rows[0]) == 0 || qr.Rows[0][0].String() == "" {
+				return "", errors.Errorf("backend[%s].gtid.executed.is.empty", name)
+			}
+			return qr.Rows[0][0].String(), nil
+		}()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			allErrors = append(allErrors, err)
+			return
+		}
+		gtids[name] = gtid
+	}
+
+	for name, pool := range backends {
+		if pool.conf.Role != config.NormalBackend {
+			continue
+		}
+		wg.Add(1)
+		go capture(name, pool)
+	}
+	wg.Wait()
+	if len(allErrors) > 0 {
+		mgr.log.Error("txnmgr.capture.watermark.error:%+v", allErrors[0])
+		return nil, allErrors[0]
+	}
+	txnCounters.Add(txnCounterWatermarkCapture, 1)
+	return mgr.watermarks.add(gtids), nil
+}
+
+// CaptureWatermark used to capture the GTID watermark of the backends at once, it waits for the committing
+// distributed transactions.
+func (mgr *TxnManager) CaptureWatermark(backends map[string]*Pool) (*Watermark, error) {
+	mgr.CommitLock()
+	defer mgr.CommitUnlock()
+	return mgr.captureWatermark(backends)
+}
+
+// waitWatermark used to wait for the backend of the connection to execute the GTID set of the watermark.
+func (txn *Txn) waitWatermark(back string, conn Connection) error {
+	gtid, ok := txn.watermark.GTIDs[back]
+	if !ok {
+		return nil
+	}
+	timeout := txn.mgr.watermarks.WaitTimeout()
+	query := fmt.Sprintf("SELECT WAIT_FOR_EXECUTED_GTID_SET('%s', %d)", gtid, timeout)
+	qr, err := conn.Execute(query)
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) > 0 && len(qr.Rows[0]) > 0 && qr.Rows[0][0].String() != "0" {
+		txnCounters.Add(txnCounterWatermarkTimeout, 1)
+		return errors.Errorf("txn.wait.watermark[%d].on[%s].timeout[%ds]", txn.watermark.ID, conn.Address(), timeout)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"xbase"
+	"xcontext"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// gtidResult returns the result of the one value query.
+func gtidResult(val string) *sqltypes.Result {
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "gtid", Type: querypb.Type_VARCHAR}},
+		Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(val))}},
+	}
+}
+
+func TestWatermarks(t *testing.T) {
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	watermarks := NewWatermarks()
+	watermarks.SetClock(clock)
+
+	// Disabled.
+	assert.False(t, watermarks.due())
+	assert.Nil(t, watermarks.Latest())
+
+	watermarks.SetLimits(100, 3)
+	assert.Equal(t, 3, watermarks.WaitTimeout())
+	assert.True(t, watermarks.due())
+	assert.False(t, watermarks.due())
+	clock.Advance(99 * time.Millisecond)
+	assert.False(t, watermarks.due())
+	clock.Advance(time.Millisecond)
+	assert.True(t, watermarks.due())
+
+	// The recent ones are kept.
+	for i := 0; i < watermarksKept+1; i++ {
+		watermarks.add(map[string]string{"node1": "uuid:1-10"})
+	}
+	recent := watermarks.Recent()
+	assert.Equal(t, watermarksKept, len(recent))
+	assert.Equal(t, uint64(2), recent[0].ID)
+	assert.Equal(t, uint64(watermarksKept+1), watermarks.Latest().ID)
+	assert.Nil(t, watermarks.Get(1))
+	assert.NotNil(t, watermarks.Get(2))
+}
+
+func TestWatermarkCapture(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+	fakedb.AddQuery(watermarkCaptureQuery, gtidResult("uuid:1-10"))
+
+	// Captured at once.
+	{
+		watermark, err := txnMgr.CaptureWatermark(backends)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), watermark.ID)
+		assert.Equal(t, map[string]string{addrs[0]: "uuid:1-10", addrs[1]: "uuid:1-10"}, watermark.GTIDs)
+	}
+
+	// Captured at the commit of the distributed transaction.
+	{
+		querys := []xcontext.QueryTuple{
+			xcontext.QueryTuple{Query: "insert", Backend: addrs[0]},
+			xcontext.QueryTuple{Query: "insert", Backend: addrs[1]},
+		}
+		fakedb.AddQuery("insert", result2)
+		fakedb.AddQueryPattern("XA .*", result1)
+		txnMgr.watermarks.SetLimits(1000, 1)
+
+		for i := 0; i < 2; i++ {
+			txn, err := txnMgr.CreateTxn(backends)
+			assert.Nil(t, err)
+			assert.Nil(t, txn.Begin())
+			_, err = txn.Execute(&xcontext.RequestContext{TxnMode: xcontext.TxnWrite, Querys: querys})
+			assert.Nil(t, err)
+			assert.Nil(t, txn.Commit())
+			txn.Finish()
+		}
+		// The second commit is in the interval.
+		assert.Equal(t, uint64(2), txnMgr.watermarks.Latest().ID)
+	}
+
+	// The backend without GTID.
+	{
+		fakedb.AddQuery(watermarkCaptureQuery, gtidResult(""))
+		_, err := txnMgr.CaptureWatermark(backends)
+		assert.NotNil(t, err)
+		assert.Equal(t, uint64(2), txnMgr.watermarks.Latest().ID)
+	}
+}
+
+func TestTxnReadAsOfWatermark(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+	}
+	wait1 := "SELECT WAIT_FOR_EXECUTED_GTID_SET('uuid:1-10', 1)"
+	wait2 := "SELECT WAIT_FOR_EXECUTED_GTID_SET('uuid:1-20', 1)"
+	fakedb.AddQuery("select * from node1", result1)
+	fakedb.AddQuery("select * from node2", result2)
+	fakedb.AddQuery(snapshotStartQuery, &sqltypes.Result{})
+	fakedb.AddQuery(snapshotEndQuery, &sqltypes.Result{})
+	fakedb.AddQuery(wait1, gtidResult("0"))
+	fakedb.AddQuery(wait2, gtidResult("0"))
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetWatermark(&Watermark{ID: 1, GTIDs: map[string]string{addrs[0]: "uuid:1-10", addrs[1]: "uuid:1-20"}})
+
+	// The snapshots are started after the watermark is executed.
+	{
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedb.GetQueryCalledNum(wait1))
+		assert.Equal(t, 1, fakedb.GetQueryCalledNum(wait2))
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(snapshotStartQuery))
+	}
+
+	// The point read is also as of the watermark.
+	{
+		rctx := &xcontext.RequestContext{
+			Querys:  querys[:1],
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(wait1))
+		assert.Equal(t, 3, fakedb.GetQueryCalledNum(snapshotStartQuery))
+	}
+
+	// Timeout.
+	{
+		fakedb.AddQuery(wait1, gtidResult("1"))
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "txn.wait.watermark[1].on[")
+	}
+
+	// Error.
+	{
+		fakedb.AddQueryError(wait1, errors.New("mock.wait.error"))
+		rctx := &xcontext.RequestContext{
+			Querys:  querys,
+			TxnMode: xcontext.TxnRead,
+		}
+		_, err := txn.Execute(rctx)
+		assert.NotNil(t, err)
+	}
+}
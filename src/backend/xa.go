@@ -69,6 +69,7 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 	var wg sync.WaitGroup
 
 	log := txn.log
+	locked := false
 	allErrors := make([]error, 0, 8)
 
 	txn.state.Set(int32(txnStateExecutingTwoPC))
@@ -78,10 +79,12 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 		var c Connection
 		defer wg.Done()
 
+		phase := xaPhases[state]
 		switch state {
 		case txnXAStateStart, txnXAStateEnd, txnXAStatePrepare:
 			if c, x = txn.twopcConnection(back); x != nil {
 				log.Error("txn.xa.fetch.connection.state[%v].on[%s].query[%v].error:%+v", state, back, query, x)
+				phase = phaseConnect
 			} else {
 				log.Debug("conn[%v].txn.sessid[%v].xa.execute[%v]", c.ID(), txn.sessionID, query)
 				if _, x = c.Execute(query); x != nil {
@@ -91,6 +94,7 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 		case txnXAStateCommit, txnXAStateRollback:
 			maxRetry := xaMaxRetryNum
 			for retry := 0; retry < maxRetry; retry++ {
+				phase = phaseConnect
 				if retry == 0 {
 					if c, x = txn.twopcConnection(back); x != nil {
 						log.Error("txn.xa.twopc.connection[maxretry:%v, retried:%v].state[%v].on[%s].query[%v].error:%+v", maxRetry, retry, state, back, query, x)
@@ -106,6 +110,7 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 				}
 
 				log.Debug("conn[%v].txn.sessid[%v].xa.execute[%v]", c.ID(), txn.sessionID, query)
+				phase = xaPhases[state]
 				if _, x = c.Execute(query); x != nil {
 					log.Error("txn.xa.execute[maxretry:%v, retried:%v].state[%v].on[%v].query[%v].error[%T]:%+v", maxRetry, retry, state, c.Address(), query, x, x)
 					if sqlErr, ok := x.(*sqldb.SQLError); ok {
@@ -126,6 +131,7 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 		}
 
 		if x != nil {
+			x = txn.shardError(back, "", phase, x)
 			mu.Lock()
 			allErrors = append(allErrors, x)
 			mu.Unlock()
@@ -150,6 +156,7 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 				// Acquire the commit lock if the txn is write.
 				txn.mgr.CommitLock()
 				defer txn.mgr.CommitUnlock()
+				locked = true
 			}
 
 			for back := range backends {
@@ -164,6 +171,7 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 			// Acquire the commit lock when the txn commit/rollback
 			txn.mgr.CommitLock()
 			defer txn.mgr.CommitUnlock()
+			locked = true
 		}
 
 		for back := range backends {
@@ -175,6 +183,9 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 	wg.Wait()
 	if len(allErrors) > 0 {
 		err = allErrors[0]
+	} else if locked && state == txnXAStateCommit && txn.mgr.watermarks.due() {
+		// The watermark is captured in the commit lock, no other distributed transaction is committing.
+		txn.mgr.captureWatermark(txn.backends)
 	}
 	return err
 }
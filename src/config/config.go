@@ -10,7 +10,10 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"xbase"
 
@@ -22,6 +25,54 @@ const (
 	AttachBackend = 1
 )
 
+// The policies of USE a database known to the backends but not to radon.
+const (
+	// UnknownDBBackend uses the database as the backends do, it's not in the metadata.
+	UnknownDBBackend = "backend"
+
+	// UnknownDBImport imports the database into the metadata if all the backends have it.
+	UnknownDBImport = "import"
+
+	// UnknownDBError rejects the database as unknown.
+	UnknownDBError = "error"
+)
+
+// The read consistencies of the sessions when the read-write-split is on.
+const (
+	// ReadConsistencyEventual reads from the replicas, the writes may not be seen at once.
+	ReadConsistencyEventual = "eventual"
+
+	// ReadConsistencyReadYourWrites reads the tables the session wrote in the read-consistency-window from the primary.
+	ReadConsistencyReadYourWrites = "read-your-writes"
+
+	// ReadConsistencyPrimary reads from the primary.
+	ReadConsistencyPrimary = "primary"
+)
+
+// The workload classes, the querys are oltp unless they're labeled by the hint or the user.
+const (
+	// WorkloadOLTP is the default class of the short transactional querys.
+	WorkloadOLTP = "oltp"
+
+	// WorkloadOLAP is the class of the analytical querys.
+	WorkloadOLAP = "olap"
+
+	// WorkloadBatch is the class of the bulk jobs, such as the imports and the reports.
+	WorkloadBatch = "batch"
+)
+
+// The variables of the query-tag, they're replaced by the values of the query.
+const (
+	// QueryTagProxy is replaced by the peer-address of the proxy, or the endpoint if it's empty.
+	QueryTagProxy = "{proxy}"
+
+	// QueryTagSession is replaced by the session id, 0 for the querys without client session.
+	QueryTagSession = "{session}"
+
+	// QueryTagUser is replaced by the user of the query.
+	QueryTagUser = "{user}"
+)
+
 // ProxyConfig tuple.
 type ProxyConfig struct {
 	IPS         []string `json:"allowip,omitempty"`
@@ -31,6 +82,7 @@ type ProxyConfig struct {
 
 	MaxConnections   int    `json:"max-connections"`
 	MaxResultSize    int    `json:"max-result-size"`
+	MaxResultRows    int    `json:"max-result-rows"`
 	MaxJoinRows      int    `json:"max-join-rows"`
 	DDLTimeout       int    `json:"ddl-timeout"`
 	QueryTimeout     int    `json:"query-timeout"`
@@ -38,6 +90,183 @@ type ProxyConfig struct {
 	LongQueryTime    int    `json:"long-query-time"`
 	StreamBufferSize int    `json:"stream-buffer-size"`
 	IdleTxnTimeout   uint32 `json:"kill-idle-transaction"` //is consistent with the official 8.0 kill_idle_transaction
+
+	// WaitTimeout and InteractiveTimeout are consistent with the mysql wait_timeout and interactive_timeout(seconds).
+	WaitTimeout        uint32 `json:"wait-timeout"`
+	InteractiveTimeout uint32 `json:"interactive-timeout"`
+
+	// ConnLeakTimeout is the seconds a checked out backend connection can be idle before it's treated as leaked, 0 means no check.
+	// If ConnLeakReclaim is true, the leaked connections will be closed.
+	ConnLeakTimeout uint32 `json:"conn-leak-timeout"`
+	ConnLeakReclaim bool   `json:"conn-leak-reclaim"`
+
+	// SkewThreshold is the ratio of a segment volume to its table average volume to be treated as hot.
+	SkewThreshold float64 `json:"skew-threshold"`
+
+	// MaxDMLRows is the max rows matched by the UPDATE and DELETE without the shard key, they're counted before the execution.
+	// The DML with the radon_force_dml hint isn't checked, 0 means no limits.
+	MaxDMLRows int `json:"max-dml-rows"`
+
+	// MemoryHighWater is the result bytes held by the in-flight querys to back off the new scatter querys, 0 means no limits.
+	// The scatter querys wait for the memory released for the MemoryQueueTime(in millisecond), 0 means they fail at once.
+	MemoryHighWater int `json:"memory-high-water"`
+	MemoryQueueTime int `json:"memory-queue-time"`
+
+	// QueryTag is the comment prepended to every backend query to trace it back to the radon session,
+	// such as 'radon={proxy} session={session} user={user}', empty means no tag.
+	QueryTag string `json:"query-tag,omitempty"`
+
+	// PgwireEndpoint is the experimental PostgreSQL wire protocol endpoint for the read-only querys, empty means disabled.
+	// The cleartext password is only accepted over the SSL with the PgwireTLSCert and PgwireTLSKey files, or from the local host.
+	PgwireEndpoint string `json:"pgwire-endpoint,omitempty"`
+	PgwireTLSCert  string `json:"pgwire-tls-cert,omitempty"`
+	PgwireTLSKey   string `json:"pgwire-tls-key,omitempty"`
+
+	// UserMaxResultRows overrides the MaxResultRows for the users, key is the user name.
+	UserMaxResultRows map[string]int `json:"user-max-result-rows,omitempty"`
+
+	// UnknownDBPolicy is the policy of USE a database unknown to radon, one of backend, import and error, empty means backend.
+	UnknownDBPolicy string `json:"unknown-db-policy,omitempty"`
+
+	// Procedures are the stored procedures can be called through radon, key is the 'db.name' in lower case.
+	Procedures map[string]*ProcedureConfig `json:"procedures,omitempty"`
+
+	// Jobs are the SQL statements run by radon on the cron schedules.
+	Jobs []*JobConfig `json:"jobs,omitempty"`
+
+	// Rollups are the aggregation results materialized into the GLOBAL or SINGLE tables by radon.
+	Rollups []*RollupConfig `json:"rollups,omitempty"`
+
+	// Workloads are the limits of the workload classes, key is one of oltp, olap and batch.
+	// The class not configured is not limited.
+	Workloads map[string]*WorkloadConfig `json:"workloads,omitempty"`
+
+	// UserWorkloads is the workload class of the users' querys without the hint, key is the user name.
+	UserWorkloads map[string]string `json:"user-workloads,omitempty"`
+
+	// ReadWriteSplit sends the reads out of the transactions to the replicas of the backends, the backend without replica serves them.
+	// ReadConsistency is the default read consistency of the sessions, one of eventual, read-your-writes and primary.
+	// ReadConsistencyWindow is the milliseconds the read-your-writes reads a table from the primary after the session wrote it.
+	ReadWriteSplit        bool   `json:"read-write-split"`
+	ReadConsistency       string `json:"read-consistency"`
+	ReadConsistencyWindow int    `json:"read-consistency-window"`
+
+	// HedgeDelay is the milliseconds the point select to the replicas waits before it's also sent to a second target, 0 means disabled.
+	// HedgeMaxRate is the max hedges sent per second, 0 means no limits.
+	HedgeDelay   int `json:"hedge-delay"`
+	HedgeMaxRate int `json:"hedge-max-rate"`
+
+	// GTIDWatermarkInterval is the min milliseconds between two GTID watermarks captured at the commits of the distributed transactions, 0 means disabled.
+	// GTIDWatermarkWaitTimeout is the seconds the read as of a watermark waits for the backend to execute its GTID set.
+	GTIDWatermarkInterval    int `json:"gtid-watermark-interval"`
+	GTIDWatermarkWaitTimeout int `json:"gtid-watermark-wait-timeout"`
+
+	// AutoAnalyze runs ANALYZE TABLE on the segments after the restores, the rollup refreshes and the shard shifts.
+	// AutoAnalyzeInterval is the milliseconds between two ANALYZE TABLEs to throttle them.
+	AutoAnalyze         bool `json:"auto-analyze"`
+	AutoAnalyzeInterval int  `json:"auto-analyze-interval"`
+
+	// CoalesceReads executes the identical SELECT/UNION querys of the same database and user out of the transactions once
+	// if they arrive while it's running, every session gets its own copy of the shared result.
+	CoalesceReads bool `json:"coalesce-reads"`
+
+	// PreparedPlanCacheSize is the max prepared statements of a session whose plans are cached, the executions of them
+	// are routed by the bound shard key without parsing and planning the query again, 0 means disabled.
+	PreparedPlanCacheSize int `json:"prepared-plan-cache-size"`
+
+	// DatabaseQuotas is the max data size(in byte) of the databases, key is the database name.
+	// The INSERT and REPLACE into the database whose data size reaches the quota are rejected.
+	// DatabaseUsageInterval is the milliseconds between two polls of the data size from the backends, 0 means disabled.
+	DatabaseQuotas        map[string]int64 `json:"database-quotas,omitempty"`
+	DatabaseUsageInterval int              `json:"database-usage-interval"`
+
+	// Analyst is the second MySQL listener for the admin and analyst traffic, nil means disabled.
+	Analyst *AnalystConfig `json:"analyst,omitempty"`
+
+	// Advisor suggests the indexes for the frequent scatter selects filtering on the non-shard-key columns, nil means disabled.
+	Advisor *AdvisorConfig `json:"advisor,omitempty"`
+
+	// DDLJournalDir is the dir of the journal of the DDL jobs not finished, they're journaled before the execution
+	// so the ones interrupted by the crash can be replayed, empty means disabled. It's local to the radon so it's
+	// out of the meta-dir synced to the peers.
+	// DDLJournalReplay replays the interrupted jobs at startup, else they're replayed by the api.
+	DDLJournalDir    string `json:"ddl-journal-dir"`
+	DDLJournalReplay bool   `json:"ddl-journal-replay"`
+}
+
+// AnalystConfig tuple, the sessions of the analyst endpoint are read-only and limited apart from the endpoint ones,
+// the reads skip the failed backends and return the partial result with the warnings.
+// The limits not greater than 0 are inherited from the proxy config.
+type AnalystConfig struct {
+	Endpoint string `json:"endpoint"`
+
+	// Users are the only users allowed to login on the endpoint.
+	Users []string `json:"users"`
+
+	MaxConnections int `json:"max-connections"`
+	MaxResultSize  int `json:"max-result-size,omitempty"`
+	MaxResultRows  int `json:"max-result-rows,omitempty"`
+	QueryTimeout   int `json:"query-timeout,omitempty"`
+}
+
+// AdvisorConfig tuple, the scatter selects are recorded since the last run of the advisor job,
+// which analyzes them on the schedule.
+type AdvisorConfig struct {
+	Schedule string `json:"schedule"`
+
+	// MinQuerys is the min scatter selects of the same filter columns to be advised.
+	MinQuerys uint64 `json:"min-querys"`
+
+	// MaxFilters is the max distinct filters recorded between two runs, the new ones are dropped once it's reached,
+	// 0 means 1024.
+	MaxFilters int `json:"max-filters"`
+}
+
+// WorkloadConfig tuple, the querys exceed the max-concurrency wait in the queue of the class,
+// and they're interrupted if they have waited for the max-queue-time(in millisecond).
+type WorkloadConfig struct {
+	// MaxConcurrency is the max querys of the class running at the same time, 0 means no limits.
+	MaxConcurrency int `json:"max-concurrency"`
+
+	// MaxQueueTime is the max milliseconds a query waits to run, 0 means no limits.
+	MaxQueueTime int `json:"max-queue-time"`
+
+	// MaxResultSize overrides the MaxResultSize for the querys of the class if it's greater than 0.
+	MaxResultSize int `json:"max-result-size,omitempty"`
+}
+
+// ProcedureConfig tuple, the procedure must be present on all the backends.
+// The call is routed to the backend owns the segment of the table for the shard-key-arg(1-based) argument,
+// or broadcasted to all the backends with the results merged if only the read-only is set.
+type ProcedureConfig struct {
+	Table       string `json:"table,omitempty"`
+	ShardKeyArg int    `json:"shard-key-arg,omitempty"`
+	ReadOnly    bool   `json:"read-only,omitempty"`
+}
+
+// JobConfig tuple, the query is run as the user on the schedule 'minute hour day-of-month month day-of-week'.
+type JobConfig struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	User     string `json:"user"`
+	Database string `json:"database"`
+	Query    string `json:"query"`
+}
+
+// RollupConfig tuple, the result of the query is refreshed into the table on the schedule.
+// The refresh replaces all the rows if the watermark is empty, otherwise it's incremental:
+// the rows whose watermark column is not less than the max of the table are replaced by the result of the query,
+// the ':watermark' in the query is the max, it's null if the table is empty. If the rewrite is set, the SELECT the same as the query is
+// rewritten to read the table after the first refresh.
+type RollupConfig struct {
+	Name      string `json:"name"`
+	Schedule  string `json:"schedule"`
+	User      string `json:"user"`
+	Database  string `json:"database"`
+	Table     string `json:"table"`
+	Query     string `json:"query"`
+	Watermark string `json:"watermark,omitempty"`
+	Rewrite   bool   `json:"rewrite,omitempty"`
 }
 
 // DefaultProxyConfig returns default proxy config.
@@ -47,6 +276,7 @@ func DefaultProxyConfig() *ProxyConfig {
 		Endpoint:         "127.0.0.1:3308",
 		MaxConnections:   1024,
 		MaxResultSize:    1024 * 1024 * 1024, // 1GB
+		MaxResultRows:    0,                  // no limits
 		MaxJoinRows:      32768,
 		DDLTimeout:       10 * 3600 * 1000, // 10hours
 		QueryTimeout:     5 * 60 * 1000,    // 5minutes
@@ -54,6 +284,21 @@ func DefaultProxyConfig() *ProxyConfig {
 		LongQueryTime:    5,                // 5 seconds
 		StreamBufferSize: 1024 * 1024 * 32, // 32MB
 		IdleTxnTimeout:   60,               // 60 seconds
+
+		WaitTimeout:        28800, // 8 hours
+		InteractiveTimeout: 28800, // 8 hours
+		ConnLeakTimeout:    600,   // 10 minutes
+		SkewThreshold:      2,
+		UnknownDBPolicy:    UnknownDBBackend,
+
+		ReadConsistency:          ReadConsistencyReadYourWrites,
+		ReadConsistencyWindow:    1000, // 1 second
+		HedgeMaxRate:             100,
+		GTIDWatermarkWaitTimeout: 1,    // 1 second
+		AutoAnalyzeInterval:      1000, // 1 second
+		PreparedPlanCacheSize:    128,
+		DatabaseUsageInterval:    60000, // 1 minute
+		DDLJournalDir:            "./ddl-journal",
 	}
 }
 
@@ -97,6 +342,33 @@ func (c *AuditConfig) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// AccessConfig tuple, the access log records the backends and the rewritten querys of each query.
+type AccessConfig struct {
+	LogDir      string `json:"access-dir"`
+	MaxSize     int    `json:"max-size"`
+	ExpireHours int    `json:"expire-hours"`
+}
+
+// DefaultAccessConfig returns default access config.
+func DefaultAccessConfig() *AccessConfig {
+	return &AccessConfig{
+		LogDir:      "/tmp/accesslog",
+		MaxSize:     1024 * 1024 * 256, // 256MB
+		ExpireHours: 0,                 // never purged
+	}
+}
+
+// UnmarshalJSON interface on AccessConfig.
+func (c *AccessConfig) UnmarshalJSON(b []byte) error {
+	type confAlias *AccessConfig
+	conf := confAlias(DefaultAccessConfig())
+	if err := json.Unmarshal(b, conf); err != nil {
+		return err
+	}
+	*c = AccessConfig(*conf)
+	return nil
+}
+
 // LogConfig tuple.
 type LogConfig struct {
 	Level string `json:"level"`
@@ -153,6 +425,25 @@ type BackendConfig struct {
 	Charset        string `json:"charset"`
 	MaxConnections int    `json:"max-connections"`
 	Role           int    `json:"role"`
+
+	// CompatMode is the version compatibility of the backend, such as '5.7', '8.0' or 'mariadb', empty means detecting at greeting.
+	CompatMode string `json:"compat-mode,omitempty"`
+
+	// SQLMode is the session sql_mode of the backend connections, empty means the server default.
+	SQLMode string `json:"sql-mode,omitempty"`
+
+	// Autocommit is the session autocommit of the backend connections, null means the server default.
+	Autocommit *bool `json:"autocommit,omitempty"`
+
+	// Replicas are the addresses of the read replicas of the backend, they share the user and password of the backend.
+	Replicas []string `json:"replicas,omitempty"`
+
+	// ValidateStrategy is how the idle connections are validated in the background, one of 'ping', 'select1' and 'none',
+	// empty means 'ping'.
+	ValidateStrategy string `json:"validate-strategy,omitempty"`
+
+	// ValidateIdleTime is the seconds a connection is idle before it's validated, 0 means the default 10s.
+	ValidateIdleTime int `json:"validate-idle-time,omitempty"`
 }
 
 // BackendsConfig tuple.
@@ -165,11 +456,17 @@ type PartitionConfig struct {
 	Table   string `json:"table"`
 	Segment string `json:"segment"`
 	Backend string `json:"backend"`
+	// ListValues are the canonical shard key values of the LIST partition, such as '1001' and 'beijing'.
+	ListValues []string `json:"list-values,omitempty"`
+	// Ring are the positions of the CHASH partition on the hash ring, the keys after one position are on the partition.
+	Ring []uint32 `json:"ring,omitempty"`
 }
 
 // AutoIncrement tuple.
 type AutoIncrement struct {
 	Column string `json:"column"`
+	// Start is the AUTO_INCREMENT table option, the values generated are not less than it.
+	Start uint64 `json:"start,omitempty"`
 }
 
 // TableConfig tuple.
@@ -181,6 +478,162 @@ type TableConfig struct {
 	ShardKey      string             `json:"shardkey"`
 	Partitions    []*PartitionConfig `json:"partitions"`
 	AutoIncrement *AutoIncrement     `json:"auto-increment,omitempty"`
+	SegmentNaming *SegmentNaming     `json:"segment-naming,omitempty"`
+	Triggers      []*TriggerConfig   `json:"triggers,omitempty"`
+	ShardMap      *ShardMapConfig    `json:"shard-map,omitempty"`
+	View          *ViewConfig        `json:"view,omitempty"`
+	Lookups       []*LookupConfig    `json:"lookups,omitempty"`
+
+	// LookupOf is the table whose lookup table this table is, in the same database.
+	LookupOf string `json:"lookup-of,omitempty"`
+
+	// ReshardTo is the shadow table the table is resharded to, the writes to the table are mirrored to it.
+	ReshardTo string `json:"reshard-to,omitempty"`
+	// ReshardOf is the table whose shadow table this table is, in the same database.
+	ReshardOf string `json:"reshard-of,omitempty"`
+
+	// KeyNormalization is the normalization of the HASH shard key values, empty means the canonical one.
+	KeyNormalization string `json:"key-normalization,omitempty"`
+	// ShardKeyType is the type of the HASH shard key column if it's hashed specially, empty for the others.
+	ShardKeyType string `json:"shard-key-type,omitempty"`
+	// TimeZone is the time zone the TIMESTAMP shard key literals are in, recorded from the router at the creation.
+	TimeZone string `json:"time-zone,omitempty"`
+}
+
+// KeyNormalizationLegacy is the key-normalization of the HASH tables created before the canonical one,
+// their string keys are hashed as they are written in the query, such as 'Abc ' and '1'.
+const KeyNormalizationLegacy = "legacy"
+
+// ShardKeyTypeBinary is the shard-key-type of the BINARY/VARBINARY shard key, the values are hashed by the raw bytes
+// whatever the key-normalization is, the hex literals X'..' and 0x.. are the bytes they encode.
+const ShardKeyTypeBinary = "binary"
+
+// The shard-key-type of the temporal shard keys, the values are hashed by the canonical UTC time in the
+// YYYYMMDDhhmmss integer form, which is also the form of the shard map keys and ranges of the table.
+const (
+	ShardKeyTypeDate      = "date"
+	ShardKeyTypeDatetime  = "datetime"
+	ShardKeyTypeTimestamp = "timestamp"
+)
+
+// ShardMapConfig tuple, the shard key values placed on the segments by hand, for the legacy tables.
+// The HASH router consults the keys first, then the ranges, then the hash function.
+type ShardMapConfig struct {
+	Keys   []*ShardMapKey   `json:"keys,omitempty"`
+	Ranges []*ShardMapRange `json:"ranges,omitempty"`
+}
+
+// ShardMapKey tuple, the rows whose shard key is the key are on the segment.
+// The key of the integer shard key is the decimal value, such as '1001'.
+type ShardMapKey struct {
+	Key     string `json:"key"`
+	Segment string `json:"segment"`
+}
+
+// ShardMapRange tuple, the rows whose integer shard key is in [start, end) are on the segment.
+type ShardMapRange struct {
+	Start   int64  `json:"start"`
+	End     int64  `json:"end"`
+	Segment string `json:"segment"`
+}
+
+// Rename returns the copy of the shard map whose segments are renamed by the names, key is the old segment name.
+func (m *ShardMapConfig) Rename(names map[string]string) *ShardMapConfig {
+	if m == nil {
+		return nil
+	}
+	rename := func(segment string) string {
+		if to, ok := names[segment]; ok {
+			return to
+		}
+		return segment
+	}
+	renamed := &ShardMapConfig{}
+	for _, key := range m.Keys {
+		renamed.Keys = append(renamed.Keys, &ShardMapKey{Key: key.Key, Segment: rename(key.Segment)})
+	}
+	for _, r := range m.Ranges {
+		renamed.Ranges = append(renamed.Ranges, &ShardMapRange{Start: r.Start, End: r.End, Segment: rename(r.Segment)})
+	}
+	return renamed
+}
+
+// LookupConfig tuple, the lookup table maps the values of the unique non-shard-key column to the shard keys of the table.
+// It's a HASH table in the same database partitioned by the column, with the column and the shard key columns named as
+// the table's. It's written in the same transaction as the table, and the selects filtering on the column are routed by it.
+type LookupConfig struct {
+	Column string `json:"column"`
+	Table  string `json:"table"`
+
+	// Backfilling is true while the rows of the table are filled into the lookup table, it isn't used to route.
+	Backfilling bool `json:"backfilling,omitempty"`
+}
+
+// TriggerConfig tuple, the trigger is created on every segment of the table,
+// which is named as '<name><segment suffix>', such as 'trg1_0001' on the segment 't1_0001'.
+type TriggerConfig struct {
+	Name   string `json:"name"`
+	Timing string `json:"timing"`
+	Event  string `json:"event"`
+	Body   string `json:"body"`
+}
+
+// ViewConfig tuple, the view is routed as the SINGLE or GLOBAL table it selects from,
+// it's created on the backends of the table with the same name.
+type ViewConfig struct {
+	// Definition is the select of the view sent to the backends, the tables are qualified by the database.
+	Definition string `json:"definition"`
+}
+
+// SegmentNaming tuple, the segment table is named as '<table><prefix><number><suffix>',
+// the number is zero-padded to the width, such as 't1_0001'.
+type SegmentNaming struct {
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+	Width  int    `json:"width"`
+}
+
+// DefaultSegmentNaming returns the default segment naming '<table>_%04d'.
+func DefaultSegmentNaming() *SegmentNaming {
+	return &SegmentNaming{
+		Prefix: "_",
+		Width:  4,
+	}
+}
+
+// Name returns the segment table name of the number.
+func (n *SegmentNaming) Name(table string, number int) string {
+	return fmt.Sprintf("%s%s%0*d%s", table, n.Prefix, n.Width, number, n.Suffix)
+}
+
+// Named returns true if the segment is named by the naming for the table.
+func (n *SegmentNaming) Named(table string, segment string) bool {
+	head := table + n.Prefix
+	if len(segment) < len(head)+n.Width+len(n.Suffix) || !strings.HasPrefix(segment, head) || !strings.HasSuffix(segment, n.Suffix) {
+		return false
+	}
+	for _, c := range segment[len(head) : len(segment)-len(n.Suffix)] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate used to check the naming, the names must be valid MySQL table names.
+func (n *SegmentNaming) Validate() error {
+	if n.Width <= 0 || n.Width > 8 {
+		return fmt.Errorf("segment-naming: width[%d] must be in [1, 8]", n.Width)
+	}
+	if n.Prefix == "" && n.Suffix == "" {
+		return fmt.Errorf("segment-naming: prefix and suffix can't both be empty, the segment names may conflict with the other tables")
+	}
+	for _, s := range []string{n.Prefix, n.Suffix} {
+		if strings.ContainsAny(s, "`./\\ ") {
+			return fmt.Errorf("segment-naming: prefix or suffix[%s] can't contain the backquote, dot, slash or space", s)
+		}
+	}
+	return nil
 }
 
 // SchemaConfig tuple.
@@ -193,13 +646,54 @@ type SchemaConfig struct {
 type RouterConfig struct {
 	Slots  int `json:"slots-readonly"`
 	Blocks int `json:"blocks-readonly"`
+
+	// Partitions is the default number of the segments of the new HASH and CHASH tables, which is overridden by
+	// the PARTITIONS of the CREATE TABLE, 0 means the slots divided by the blocks.
+	Partitions int `json:"partitions,omitempty"`
+
+	// SegmentNaming is the segment naming of the new HASH tables, nil means the DefaultSegmentNaming.
+	SegmentNaming *SegmentNaming `json:"segment-naming,omitempty"`
+
+	// LazyLoad loads the table metadata on the first access instead of at the startup.
+	LazyLoad bool `json:"lazy-load"`
+	// TableCacheSize is the max number of the tables loaded in the lazy mode, the least recently used
+	// are evicted and loaded again on the next access, 0 means no limit.
+	TableCacheSize int `json:"table-cache-size"`
+	// Prefetch loads the tables in the background after the startup in the lazy mode, until the cache is full.
+	Prefetch bool `json:"prefetch"`
+	// TimeZone is the time_zone of the backends which the TIMESTAMP shard key literals are in, such as '+08:00'
+	// or 'Asia/Shanghai', empty means UTC. It's recorded in the new tables, changing it doesn't reroute the old ones.
+	TimeZone string `json:"time-zone,omitempty"`
+}
+
+// ParseTimeZone returns the location of the time zone, which is the offset such as '+08:00' or the IANA name,
+// empty means UTC.
+func ParseTimeZone(zone string) (*time.Location, error) {
+	if zone == "" {
+		return time.UTC, nil
+	}
+	if zone[0] == '+' || zone[0] == '-' {
+		t, err := time.Parse("-07:00", zone)
+		if err != nil {
+			return nil, errors.Errorf("time.zone[%s].offset.malformed", zone)
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(zone, offset), nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, errors.Errorf("time.zone[%s].unknown", zone)
+	}
+	return loc, nil
 }
 
 // DefaultRouterConfig returns the default router config.
 func DefaultRouterConfig() *RouterConfig {
 	return &RouterConfig{
-		Slots:  4096,
-		Blocks: 64,
+		Slots:          4096,
+		Blocks:         64,
+		TableCacheSize: 10000,
+		Prefetch:       true,
 	}
 }
 
@@ -214,19 +708,44 @@ func (c *RouterConfig) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+const (
+	// SettingsModeVerify checks the declared variables on every new backend connection.
+	SettingsModeVerify = "verify"
+
+	// SettingsModeEnforce sets the declared session variables on every new backend connection and checks them.
+	SettingsModeEnforce = "enforce"
+)
+
+// SettingsConfig tuple, the variables declared to be the same on all the backends.
+type SettingsConfig struct {
+	// Mode is the 'verify' or 'enforce', the connection whose variables are not the declared values is refused.
+	Mode string `json:"mode"`
+
+	// Variables are the declared values of the session variables, such as 'sql_mode' and 'time_zone',
+	// the 'global.' prefixed ones are the global variables which are checked only.
+	Variables map[string]string `json:"variables"`
+}
+
 // ScatterConfig tuple.
 type ScatterConfig struct {
 	XaCheckInterval int    `json:"xa-check-interval"`
 	XaCheckDir      string `json:"xa-check-dir"`
 	XaCheckRetrys   int    `json:"xa-check-retrys`
+
+	// Settings are the variables of the backend connections, nil means not checked.
+	Settings *SettingsConfig `json:"settings,omitempty"`
+
+	// ValidateInterval is the seconds between the validations of the idle backend connections, 0 means disabled.
+	ValidateInterval int `json:"validate-interval"`
 }
 
 // DefaultScatterConfig returns default ScatterConfig config.
 func DefaultScatterConfig() *ScatterConfig {
 	return &ScatterConfig{
-		XaCheckInterval: 10,
-		XaCheckDir:      "./xacheck", //In the production environment, don't set the tmp dir
-		XaCheckRetrys:   10,
+		XaCheckInterval:  10,
+		XaCheckDir:       "./xacheck", //In the production environment, don't set the tmp dir
+		XaCheckRetrys:    10,
+		ValidateInterval: 5,
 	}
 }
 
@@ -245,6 +764,7 @@ func (c *ScatterConfig) UnmarshalJSON(b []byte) error {
 type Config struct {
 	Proxy   *ProxyConfig   `json:"proxy"`
 	Audit   *AuditConfig   `json:"audit"`
+	Access  *AccessConfig  `json:"access,omitempty"` // nil means the access log disabled.
 	Router  *RouterConfig  `json:"router"`
 	Log     *LogConfig     `json:"log"`
 	Monitor *MonitorConfig `json:"monitor"`
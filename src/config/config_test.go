@@ -9,11 +9,13 @@
 package config
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	_ "log"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -59,11 +61,12 @@ func TestLoadConfig(t *testing.T) {
 
 	{
 		mockProxyConfig := &ProxyConfig{
-			TwopcEnable:    true,
-			Endpoint:       ":5566",
-			MaxConnections: 1024,
-			MetaDir:        "/tmp/radonmeta",
-			PeerAddress:    ":8080",
+			TwopcEnable:     true,
+			Endpoint:        ":5566",
+			MaxConnections:  1024,
+			MetaDir:         "/tmp/radonmeta",
+			PeerAddress:     ":8080",
+			UnknownDBPolicy: UnknownDBBackend,
 		}
 		conf := &Config{
 			Proxy:   mockProxyConfig,
@@ -308,3 +311,195 @@ func TestReadBackendsConfigAttach(t *testing.T) {
 	got := backends
 	assert.NotEqual(t, want.Backends[0].Role, got.Backends[0].Role)
 }
+
+func TestConfigValidate(t *testing.T) {
+	// Default.
+	{
+		conf := &Config{}
+		checkConfig(conf)
+		assert.Equal(t, 0, len(conf.Validate()))
+	}
+
+	// All the problems are reported.
+	{
+		conf := &Config{}
+		checkConfig(conf)
+		conf.Proxy.Endpoint = ""
+		conf.Proxy.MaxConnections = 0
+		conf.Proxy.MaxDMLRows = -1
+		conf.Proxy.MemoryHighWater = -1
+		conf.Proxy.QueryTag = "radon={proxy} db={db}"
+		conf.Proxy.PgwireTLSCert = "/etc/radon/pg.crt"
+		conf.Proxy.UserMaxResultRows = map[string]int{"mock": -1}
+		conf.Proxy.UnknownDBPolicy = "ignore"
+		conf.Proxy.Workloads = map[string]*WorkloadConfig{"olap": {MaxConcurrency: -1}}
+		conf.Proxy.UserWorkloads = map[string]string{"mock": "adhoc"}
+		conf.Proxy.ReadConsistency = "strong"
+		conf.Proxy.ReadConsistencyWindow = -1
+		conf.Proxy.HedgeDelay = -1
+		conf.Proxy.GTIDWatermarkInterval = -1
+		conf.Proxy.AutoAnalyzeInterval = -1
+		conf.Proxy.PreparedPlanCacheSize = -1
+		conf.Proxy.DatabaseUsageInterval = -1
+		conf.Proxy.DatabaseQuotas = map[string]int64{"db1": -1}
+		conf.Proxy.Analyst = &AnalystConfig{Endpoint: ":3307", QueryTimeout: -1}
+		conf.Proxy.Procedures = map[string]*ProcedureConfig{"db1.p1": {Table: "t1"}}
+		conf.Proxy.Jobs = []*JobConfig{
+			{Name: "j1", Schedule: "@daily", User: "mock", Query: "delete from db1.t1"},
+			{Name: "j1", Schedule: "0 25 * * *", Query: "delete from db1.t1"},
+		}
+		conf.Proxy.Rollups = []*RollupConfig{
+			{Name: "r1", Schedule: "@hourly", User: "mock", Database: "db1", Table: "r1", Query: "select 1", Watermark: "day", Rewrite: true},
+		}
+		conf.Audit.Mode = "X"
+		conf.Audit.LogDir = ""
+		conf.Access = &AccessConfig{MaxSize: 0}
+		conf.Router.Blocks = 8192
+		conf.Router.Partitions = -1
+		conf.Router.SegmentNaming = &SegmentNaming{Prefix: "_", Width: 9}
+		conf.Router.TimeZone = "Mars/Olympus"
+		conf.Log.Level = "VERBOSE"
+		conf.Scatter.ValidateInterval = -1
+		want := []string{
+			"proxy: endpoint is empty, set it to the listen address such as 0.0.0.0:3306",
+			"proxy: max-connections[0] must be greater than 0",
+			"proxy: max-dml-rows[-1] must not be negative, 0 means no limits",
+			"proxy: memory-high-water[-1] and memory-queue-time[0] must not be negative, 0 means no limits and failing at once",
+			"proxy: query-tag[radon={proxy} db={db}] must not contain the '*/' and the variables except {proxy}, {session} and {user}",
+			"proxy: pgwire-tls-cert[/etc/radon/pg.crt] and pgwire-tls-key[] must be set together",
+			"proxy: user-max-result-rows of user[mock] is -1, must not be negative",
+			"proxy: unknown-db-policy[ignore] is invalid, must be one of backend, import and error",
+			"proxy: workload[olap] max-concurrency[-1], max-queue-time[0] and max-result-size[0] must not be negative, 0 means no limits",
+			"proxy: user-workloads of user[mock] is adhoc, must be one of oltp, olap and batch",
+			"proxy: read-consistency[strong] is invalid, must be one of eventual, read-your-writes and primary",
+			"proxy: read-consistency-window[-1] must not be negative",
+			"proxy: hedge-delay[-1] and hedge-max-rate[100] must not be negative, 0 means disabled and no limits",
+			"proxy: gtid-watermark-interval[-1] must not be negative and gtid-watermark-wait-timeout[1] must be greater than 0",
+			"proxy: auto-analyze-interval[-1] must not be negative",
+			"proxy: prepared-plan-cache-size[-1] must not be negative, 0 means disabled",
+			"proxy: database-usage-interval[-1] must not be negative, 0 means disabled",
+			"proxy: database-quotas of database[db1] is -1, must not be negative",
+			"proxy: analyst users is empty, set it to the users allowed to login on the analyst endpoint",
+			"proxy: analyst max-connections[0] must be greater than 0",
+			"proxy: analyst max-result-size[0], max-result-rows[0] and query-timeout[-1] must not be negative, 0 means the proxy ones",
+			"proxy: procedure[db1.p1] table[t1] and shard-key-arg[0] must be set together",
+			"proxy: job[j1] is duplicate",
+			"proxy: job[j1] schedule[0 25 * * *] is invalid: cron.field[25].out.of.range[0-23]",
+			"proxy: job[j1] user and query must be set",
+			"proxy: rollup[r1] with the watermark can't be rewritten",
+			"audit: mode[X] is invalid, must be one of N(none), R(read), W(write), A(all)",
+			"audit: audit-dir is empty but the mode is X",
+			"access: access-dir is empty, set it or remove the access section to disable the access log",
+			"access: max-size[0] must be greater than 0 and expire-hours[0] must not be negative",
+			"router: slots[4096] and blocks[8192] must be greater than 0 and blocks must not exceed slots",
+			"router: partitions[-1] must not be negative or exceed slots[4096]",
+			"router: segment-naming: width[9] must be in [1, 8]",
+			"router: time-zone[Mars/Olympus] must be the offset such as '+08:00' or the IANA name",
+			"log: level[VERBOSE] is invalid, must be one of DEBUG, INFO, WARNING, ERROR, FATAL, PANIC",
+			"scatter: validate-interval[-1] must not be negative, 0 means disabled",
+		}
+		var got []string
+		for _, err := range conf.Validate() {
+			got = append(got, err.Error())
+		}
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestParseTimeZone(t *testing.T) {
+	tests := []struct {
+		zone   string
+		offset int
+	}{
+		{"", 0},
+		{"UTC", 0},
+		{"+08:00", 8 * 3600},
+		{"-05:30", -(5*3600 + 30*60)},
+	}
+	for _, test := range tests {
+		loc, err := ParseTimeZone(test.zone)
+		assert.Nil(t, err)
+		_, offset := time.Date(2020, 1, 1, 0, 0, 0, 0, loc).Zone()
+		assert.Equal(t, test.offset, offset, test.zone)
+	}
+
+	_, err := ParseTimeZone("+8")
+	assert.Equal(t, "time.zone[+8].offset.malformed", err.Error())
+	_, err = ParseTimeZone("Mars/Olympus")
+	assert.Equal(t, "time.zone[Mars/Olympus].unknown", err.Error())
+}
+
+func TestSegmentNaming(t *testing.T) {
+	assert.Equal(t, "t1_0001", DefaultSegmentNaming().Name("t1", 1))
+	assert.Nil(t, DefaultSegmentNaming().Validate())
+	assert.True(t, DefaultSegmentNaming().Named("t1", "t1_0001"))
+	assert.True(t, DefaultSegmentNaming().Named("t1", "t1_10000"))
+	assert.False(t, DefaultSegmentNaming().Named("t1", "t1_001"))
+	assert.False(t, DefaultSegmentNaming().Named("t1", "t1_000x"))
+	assert.False(t, DefaultSegmentNaming().Named("t", "t1_0001"))
+
+	naming := &SegmentNaming{Suffix: "_old", Width: 2}
+	assert.Equal(t, "t1123_old", naming.Name("t1", 123))
+	assert.True(t, naming.Named("t1", "t1123_old"))
+	assert.Nil(t, naming.Validate())
+
+	tests := []*SegmentNaming{
+		{Width: 4},
+		{Prefix: "_", Width: 0},
+		{Prefix: ".", Width: 4},
+		{Prefix: "_", Suffix: "a b", Width: 4},
+	}
+	for _, test := range tests {
+		assert.NotNil(t, test.Validate(), "%+v", test)
+	}
+}
+
+func TestShardMapRename(t *testing.T) {
+	var nilMap *ShardMapConfig
+	assert.Nil(t, nilMap.Rename(nil))
+
+	m := &ShardMapConfig{
+		Keys:   []*ShardMapKey{{Key: "1", Segment: "t1_0000"}, {Key: "2", Segment: "t1_0001"}},
+		Ranges: []*ShardMapRange{{Start: 10, End: 20, Segment: "t1_0001"}},
+	}
+	got := m.Rename(map[string]string{"t1_0001": "t2_0001"})
+	want := &ShardMapConfig{
+		Keys:   []*ShardMapKey{{Key: "1", Segment: "t1_0000"}, {Key: "2", Segment: "t2_0001"}},
+		Ranges: []*ShardMapRange{{Start: 10, End: 20, Segment: "t2_0001"}},
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, "t1_0001", m.Keys[1].Segment)
+}
+
+func TestAccessConfigUnmarshalJSON(t *testing.T) {
+	conf := &Config{}
+	err := json.Unmarshal([]byte(`{"access": {"access-dir": "/tmp/radon_access"}}`), conf)
+	assert.Nil(t, err)
+	checkConfig(conf)
+
+	want := DefaultAccessConfig()
+	want.LogDir = "/tmp/radon_access"
+	assert.Equal(t, want, conf.Access)
+	assert.Equal(t, 0, len(conf.Validate()))
+
+	// The access log is disabled by default.
+	conf = &Config{}
+	checkConfig(conf)
+	assert.Nil(t, conf.Access)
+}
+
+func TestScatterSettingsUnmarshalJSON(t *testing.T) {
+	conf := &Config{}
+	err := json.Unmarshal([]byte(`{"scatter": {"settings": {"mode": "enforce", "variables": {"time_zone": "+00:00", "global.lower_case_table_names": "1"}}}}`), conf)
+	assert.Nil(t, err)
+
+	want := DefaultScatterConfig()
+	want.Settings = &SettingsConfig{
+		Mode:      SettingsModeEnforce,
+		Variables: map[string]string{"time_zone": "+00:00", "global.lower_case_table_names": "1"},
+	}
+	assert.Equal(t, want, conf.Scatter)
+
+	// The settings are not checked by default.
+	assert.Nil(t, DefaultScatterConfig().Settings)
+}
@@ -0,0 +1,208 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// backendsJSONFile is the backends metadata file name.
+	backendsJSONFile = "backend.json"
+)
+
+// Migration tuple, it upgrades the metadata from Version-1 to Version.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(metadir string, conf *Config) error
+}
+
+// migrations must be sorted by the version, the last one is the current schema version.
+var migrations = []*Migration{
+	{Version: 1, Name: "hash.table.slots.and.blocks", Up: migrateTableSlots},
+	{Version: 2, Name: "backend.default.charset", Up: migrateBackendCharset},
+	{Version: 3, Name: "hash.table.legacy.key.normalization", Up: migrateKeyNormalization},
+}
+
+// SchemaVersion returns the metadata schema version of this radon.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate used to upgrade the metadata under the meta-dir to the current schema version.
+// The pre-upgrade metadata is copied to the '<meta-dir>.backup-v<version>-<timestamp>' dir first.
+func Migrate(log *xlog.Log, conf *Config) error {
+	metadir := conf.Proxy.MetaDir
+	if _, err := os.Stat(metadir); os.IsNotExist(err) {
+		return nil
+	}
+
+	version := ReadSchemaVersion(metadir)
+	current := SchemaVersion()
+	switch {
+	case version == current:
+		return nil
+	case version > current:
+		return errors.Errorf("config.migrate.meta.schema.version[%d].is.newer.than.radon[%d]", version, current)
+	}
+
+	// The empty meta-dir is created by this version.
+	if empty, err := isEmptyDir(metadir); err != nil {
+		return err
+	} else if empty {
+		return writeSchemaVersion(metadir, current)
+	}
+
+	backup := fmt.Sprintf("%s.backup-v%d-%s", strings.TrimSuffix(metadir, "/"), version, time.Now().Format("20060102150405"))
+	if err := copyDir(metadir, backup); err != nil {
+		return err
+	}
+	log.Warning("config.migrate.meta.schema.version.from[%d].to[%d].backup[%s]", version, current, backup)
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		if err := m.Up(metadir, conf); err != nil {
+			log.Error("config.migrate[v%d:%s].error:%+v", m.Version, m.Name, err)
+			return errors.Errorf("config.migrate[v%d:%s].error:%v, the pre-upgrade metadata is in %s", m.Version, m.Name, err, backup)
+		}
+		if err := writeSchemaVersion(metadir, m.Version); err != nil {
+			return err
+		}
+		log.Warning("config.migrate[v%d:%s].done", m.Version, m.Name)
+	}
+	return nil
+}
+
+// migrateTableSlots used to fill the slots and blocks of the HASH tables created before they are stored in the table file.
+func migrateTableSlots(metadir string, conf *Config) error {
+	files, err := filepath.Glob(path.Join(metadir, "*", "*.json"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		tconf, err := ReadTableConfig(string(data))
+		if err != nil {
+			return err
+		}
+		if tconf.ShardType != "HASH" || tconf.Slots != 0 {
+			continue
+		}
+		tconf.Slots = conf.Router.Slots
+		tconf.Blocks = conf.Router.Blocks
+		if err := WriteConfig(file, tconf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateBackendCharset used to fill the empty charset of the backends, the radon connections use utf8.
+func migrateBackendCharset(metadir string, conf *Config) error {
+	file := path.Join(metadir, backendsJSONFile)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+	bconf, err := ReadBackendsConfig(string(data))
+	if err != nil {
+		return err
+	}
+	for _, backend := range bconf.Backends {
+		if backend.Charset == "" {
+			backend.Charset = "utf8"
+		}
+	}
+	return WriteConfig(file, bconf)
+}
+
+// migrateKeyNormalization used to keep the HASH tables created before the canonical shard key normalization
+// on the legacy one, their rows are placed by it. They can be switched to the canonical one once no rows move.
+func migrateKeyNormalization(metadir string, conf *Config) error {
+	files, err := filepath.Glob(path.Join(metadir, "*", "*.json"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		tconf, err := ReadTableConfig(string(data))
+		if err != nil {
+			return err
+		}
+		if tconf.ShardType != "HASH" || tconf.KeyNormalization != "" {
+			continue
+		}
+		tconf.KeyNormalization = KeyNormalizationLegacy
+		if err := WriteConfig(file, tconf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isEmptyDir(dir string) (bool, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return len(files) == 0, nil
+}
+
+// copyDir used to copy the dir recursively.
+func copyDir(src string, dst string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return errors.WithStack(os.MkdirAll(target, 0755))
+		}
+
+		in, err := os.Open(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer out.Close()
+		if _, err := io.Copy(out, in); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(out.Sync())
+	})
+}
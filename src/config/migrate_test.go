@@ -0,0 +1,165 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestMigrate(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := getTmpDir("", "radon_config_", log)
+	defer os.RemoveAll(tmpDir)
+	metadir := path.Join(tmpDir, "meta")
+
+	conf := &Config{}
+	checkConfig(conf)
+	conf.Proxy.MetaDir = metadir
+
+	// Not exists.
+	{
+		err := Migrate(log, conf)
+		assert.Nil(t, err)
+	}
+
+	// Empty dir.
+	{
+		err := os.MkdirAll(metadir, 0755)
+		assert.Nil(t, err)
+		err = Migrate(log, conf)
+		assert.Nil(t, err)
+		assert.Equal(t, SchemaVersion(), ReadSchemaVersion(metadir))
+		os.RemoveAll(metadir)
+	}
+
+	// The metadata written before the schema version.
+	{
+		err := os.MkdirAll(path.Join(metadir, "db1"), 0755)
+		assert.Nil(t, err)
+		err = genVersion(metadir, 1024)
+		assert.Nil(t, err)
+		tconf := &TableConfig{
+			Name:       "t1",
+			ShardType:  "HASH",
+			ShardKey:   "id",
+			Partitions: []*PartitionConfig{{Table: "t1_0000", Segment: "0-4096", Backend: "backend1"}},
+		}
+		err = WriteConfig(path.Join(metadir, "db1", "t1.json"), tconf)
+		assert.Nil(t, err)
+		bconf := &BackendsConfig{Backends: []*BackendConfig{{Name: "backend1", Address: "127.0.0.1:3306"}}}
+		err = WriteConfig(path.Join(metadir, backendsJSONFile), bconf)
+		assert.Nil(t, err)
+
+		err = Migrate(log, conf)
+		assert.Nil(t, err)
+		assert.Equal(t, SchemaVersion(), ReadSchemaVersion(metadir))
+		// The config version is kept.
+		assert.Equal(t, int64(1024), ReadVersion(metadir))
+
+		data, err := ioutil.ReadFile(path.Join(metadir, "db1", "t1.json"))
+		assert.Nil(t, err)
+		got, err := ReadTableConfig(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, conf.Router.Slots, got.Slots)
+		assert.Equal(t, conf.Router.Blocks, got.Blocks)
+		assert.Equal(t, KeyNormalizationLegacy, got.KeyNormalization)
+
+		data, err = ioutil.ReadFile(path.Join(metadir, backendsJSONFile))
+		assert.Nil(t, err)
+		backends, err := ReadBackendsConfig(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, "utf8", backends.Backends[0].Charset)
+
+		// The backup.
+		backups, err := filepath.Glob(metadir + ".backup-v0-*")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(backups))
+		data, err = ioutil.ReadFile(path.Join(backups[0], "db1", "t1.json"))
+		assert.Nil(t, err)
+		old, err := ReadTableConfig(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, 0, old.Slots)
+
+		// Again, nothing to do.
+		err = Migrate(log, conf)
+		assert.Nil(t, err)
+		backups, err = filepath.Glob(metadir + ".backup-v0-*")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(backups))
+
+		// UpdateVersion keeps the schema version.
+		err = UpdateVersion(metadir)
+		assert.Nil(t, err)
+		assert.Equal(t, SchemaVersion(), ReadSchemaVersion(metadir))
+	}
+
+	// The HASH tables created by the schema version 2 are on the legacy key normalization.
+	{
+		err := writeSchemaVersion(metadir, 2)
+		assert.Nil(t, err)
+		tconf := &TableConfig{
+			Name:       "t2",
+			Slots:      4096,
+			Blocks:     128,
+			ShardType:  "HASH",
+			ShardKey:   "id",
+			Partitions: []*PartitionConfig{{Table: "t2_0000", Segment: "0-4096", Backend: "backend1"}},
+		}
+		err = WriteConfig(path.Join(metadir, "db1", "t2.json"), tconf)
+		assert.Nil(t, err)
+		gconf := &TableConfig{
+			Name:       "g1",
+			ShardType:  "GLOBAL",
+			Partitions: []*PartitionConfig{{Table: "g1", Backend: "backend1"}},
+		}
+		err = WriteConfig(path.Join(metadir, "db1", "g1.json"), gconf)
+		assert.Nil(t, err)
+
+		err = Migrate(log, conf)
+		assert.Nil(t, err)
+		assert.Equal(t, SchemaVersion(), ReadSchemaVersion(metadir))
+		data, err := ioutil.ReadFile(path.Join(metadir, "db1", "t2.json"))
+		assert.Nil(t, err)
+		got, err := ReadTableConfig(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, KeyNormalizationLegacy, got.KeyNormalization)
+		data, err = ioutil.ReadFile(path.Join(metadir, "db1", "g1.json"))
+		assert.Nil(t, err)
+		got, err = ReadTableConfig(string(data))
+		assert.Nil(t, err)
+		assert.Equal(t, "", got.KeyNormalization)
+		os.Remove(path.Join(metadir, "db1", "t2.json"))
+		os.Remove(path.Join(metadir, "db1", "g1.json"))
+	}
+
+	// Newer than this radon.
+	{
+		err := writeSchemaVersion(metadir, SchemaVersion()+1)
+		assert.Nil(t, err)
+		err = Migrate(log, conf)
+		assert.NotNil(t, err)
+	}
+
+	// Broken table file.
+	{
+		err := writeSchemaVersion(metadir, 0)
+		assert.Nil(t, err)
+		err = ioutil.WriteFile(path.Join(metadir, "db1", "t2.json"), []byte("wtf"), 0644)
+		assert.Nil(t, err)
+		err = Migrate(log, conf)
+		assert.NotNil(t, err)
+	}
+}
@@ -92,10 +92,11 @@ var (
 
 	// MockProxyConfig config.
 	MockProxyConfig = &ProxyConfig{
-		Endpoint:       ":5566",
-		MaxConnections: 1024,
-		MetaDir:        "/tmp/radonmeta",
-		PeerAddress:    ":8080",
+		Endpoint:        ":5566",
+		MaxConnections:  1024,
+		MetaDir:         "/tmp/radonmeta",
+		PeerAddress:     ":8080",
+		UnknownDBPolicy: UnknownDBBackend,
 	}
 
 	// MockLogConfig config.
@@ -0,0 +1,247 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// Validate used to check the config and returns all the problems found.
+func (conf *Config) Validate() []error {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if proxy := conf.Proxy; proxy != nil {
+		if proxy.Endpoint == "" {
+			report("proxy: endpoint is empty, set it to the listen address such as 0.0.0.0:3306")
+		}
+		if proxy.MetaDir == "" {
+			report("proxy: meta-dir is empty, set it to the dir of the backends and tables metadata")
+		}
+		if proxy.MaxConnections <= 0 {
+			report("proxy: max-connections[%d] must be greater than 0", proxy.MaxConnections)
+		}
+		if proxy.MaxResultSize <= 0 {
+			report("proxy: max-result-size[%d] must be greater than 0", proxy.MaxResultSize)
+		}
+		if proxy.MaxResultRows < 0 {
+			report("proxy: max-result-rows[%d] must not be negative, 0 means no limits", proxy.MaxResultRows)
+		}
+		if proxy.MaxDMLRows < 0 {
+			report("proxy: max-dml-rows[%d] must not be negative, 0 means no limits", proxy.MaxDMLRows)
+		}
+		if proxy.DDLTimeout < 0 || proxy.QueryTimeout < 0 {
+			report("proxy: ddl-timeout[%d] and query-timeout[%d] must not be negative, 0 means no limits", proxy.DDLTimeout, proxy.QueryTimeout)
+		}
+		if proxy.MemoryHighWater < 0 || proxy.MemoryQueueTime < 0 {
+			report("proxy: memory-high-water[%d] and memory-queue-time[%d] must not be negative, 0 means no limits and failing at once", proxy.MemoryHighWater, proxy.MemoryQueueTime)
+		}
+		if tag := strings.NewReplacer(QueryTagProxy, "", QueryTagSession, "", QueryTagUser, "").Replace(proxy.QueryTag); strings.ContainsAny(tag, "{}") || strings.Contains(tag, "*/") {
+			report("proxy: query-tag[%s] must not contain the '*/' and the variables except %s, %s and %s", proxy.QueryTag, QueryTagProxy, QueryTagSession, QueryTagUser)
+		}
+		if proxy.PgwireEndpoint != "" && proxy.PgwireEndpoint == proxy.Endpoint {
+			report("proxy: pgwire-endpoint[%s] must differ from the endpoint", proxy.PgwireEndpoint)
+		}
+		if (proxy.PgwireTLSCert == "") != (proxy.PgwireTLSKey == "") {
+			report("proxy: pgwire-tls-cert[%s] and pgwire-tls-key[%s] must be set together", proxy.PgwireTLSCert, proxy.PgwireTLSKey)
+		}
+		for user, rows := range proxy.UserMaxResultRows {
+			if rows < 0 {
+				report("proxy: user-max-result-rows of user[%s] is %d, must not be negative", user, rows)
+			}
+		}
+		switch proxy.UnknownDBPolicy {
+		case "", UnknownDBBackend, UnknownDBImport, UnknownDBError:
+		default:
+			report("proxy: unknown-db-policy[%s] is invalid, must be one of %s, %s and %s", proxy.UnknownDBPolicy, UnknownDBBackend, UnknownDBImport, UnknownDBError)
+		}
+		workloads := map[string]bool{WorkloadOLTP: true, WorkloadOLAP: true, WorkloadBatch: true}
+		for class, workload := range proxy.Workloads {
+			if !workloads[class] {
+				report("proxy: workload[%s] is invalid, must be one of oltp, olap and batch", class)
+			}
+			if workload == nil {
+				report("proxy: workload[%s] is empty", class)
+				continue
+			}
+			if workload.MaxConcurrency < 0 || workload.MaxQueueTime < 0 || workload.MaxResultSize < 0 {
+				report("proxy: workload[%s] max-concurrency[%d], max-queue-time[%d] and max-result-size[%d] must not be negative, 0 means no limits",
+					class, workload.MaxConcurrency, workload.MaxQueueTime, workload.MaxResultSize)
+			}
+		}
+		for user, class := range proxy.UserWorkloads {
+			if !workloads[class] {
+				report("proxy: user-workloads of user[%s] is %s, must be one of oltp, olap and batch", user, class)
+			}
+		}
+		switch proxy.ReadConsistency {
+		case ReadConsistencyEventual, ReadConsistencyReadYourWrites, ReadConsistencyPrimary:
+		default:
+			report("proxy: read-consistency[%s] is invalid, must be one of %s, %s and %s", proxy.ReadConsistency, ReadConsistencyEventual, ReadConsistencyReadYourWrites, ReadConsistencyPrimary)
+		}
+		if proxy.ReadConsistencyWindow < 0 {
+			report("proxy: read-consistency-window[%d] must not be negative", proxy.ReadConsistencyWindow)
+		}
+		if proxy.HedgeDelay < 0 || proxy.HedgeMaxRate < 0 {
+			report("proxy: hedge-delay[%d] and hedge-max-rate[%d] must not be negative, 0 means disabled and no limits", proxy.HedgeDelay, proxy.HedgeMaxRate)
+		}
+		if proxy.GTIDWatermarkInterval < 0 || proxy.GTIDWatermarkWaitTimeout <= 0 {
+			report("proxy: gtid-watermark-interval[%d] must not be negative and gtid-watermark-wait-timeout[%d] must be greater than 0", proxy.GTIDWatermarkInterval, proxy.GTIDWatermarkWaitTimeout)
+		}
+		if proxy.AutoAnalyzeInterval < 0 {
+			report("proxy: auto-analyze-interval[%d] must not be negative", proxy.AutoAnalyzeInterval)
+		}
+		if proxy.PreparedPlanCacheSize < 0 {
+			report("proxy: prepared-plan-cache-size[%d] must not be negative, 0 means disabled", proxy.PreparedPlanCacheSize)
+		}
+		if proxy.DatabaseUsageInterval < 0 {
+			report("proxy: database-usage-interval[%d] must not be negative, 0 means disabled", proxy.DatabaseUsageInterval)
+		}
+		for db, quota := range proxy.DatabaseQuotas {
+			if quota < 0 {
+				report("proxy: database-quotas of database[%s] is %d, must not be negative", db, quota)
+			}
+		}
+		if analyst := proxy.Analyst; analyst != nil {
+			if analyst.Endpoint == "" || analyst.Endpoint == proxy.Endpoint || analyst.Endpoint == proxy.PgwireEndpoint {
+				report("proxy: analyst endpoint[%s] must be set and differ from the endpoint and pgwire-endpoint", analyst.Endpoint)
+			}
+			if len(analyst.Users) == 0 {
+				report("proxy: analyst users is empty, set it to the users allowed to login on the analyst endpoint")
+			}
+			if analyst.MaxConnections <= 0 {
+				report("proxy: analyst max-connections[%d] must be greater than 0", analyst.MaxConnections)
+			}
+			if analyst.MaxResultSize < 0 || analyst.MaxResultRows < 0 || analyst.QueryTimeout < 0 {
+				report("proxy: analyst max-result-size[%d], max-result-rows[%d] and query-timeout[%d] must not be negative, 0 means the proxy ones",
+					analyst.MaxResultSize, analyst.MaxResultRows, analyst.QueryTimeout)
+			}
+		}
+		for name, procedure := range proxy.Procedures {
+			if len(strings.Split(name, ".")) != 2 || name != strings.ToLower(name) {
+				report("proxy: procedure[%s] must be named as 'db.name' in lower case", name)
+			}
+			if procedure == nil {
+				report("proxy: procedure[%s] is empty", name)
+				continue
+			}
+			if (procedure.Table == "") != (procedure.ShardKeyArg <= 0) {
+				report("proxy: procedure[%s] table[%s] and shard-key-arg[%d] must be set together", name, procedure.Table, procedure.ShardKeyArg)
+			}
+			if procedure.Table == "" && !procedure.ReadOnly {
+				report("proxy: procedure[%s] must be routed by the table and shard-key-arg, or be read-only", name)
+			}
+		}
+		jobs := make(map[string]bool)
+		for i, job := range proxy.Jobs {
+			if job == nil || job.Name == "" {
+				report("proxy: jobs[%d] name is empty", i)
+				continue
+			}
+			if jobs[job.Name] {
+				report("proxy: job[%s] is duplicate", job.Name)
+			}
+			jobs[job.Name] = true
+			if _, err := xbase.ParseCron(job.Schedule); err != nil {
+				report("proxy: job[%s] schedule[%s] is invalid: %v", job.Name, job.Schedule, err)
+			}
+			if job.User == "" || job.Query == "" {
+				report("proxy: job[%s] user and query must be set", job.Name)
+			}
+		}
+		rollups := make(map[string]bool)
+		for i, rollup := range proxy.Rollups {
+			if rollup == nil || rollup.Name == "" {
+				report("proxy: rollups[%d] name is empty", i)
+				continue
+			}
+			if rollups[rollup.Name] {
+				report("proxy: rollup[%s] is duplicate", rollup.Name)
+			}
+			rollups[rollup.Name] = true
+			if _, err := xbase.ParseCron(rollup.Schedule); err != nil {
+				report("proxy: rollup[%s] schedule[%s] is invalid: %v", rollup.Name, rollup.Schedule, err)
+			}
+			if rollup.User == "" || rollup.Database == "" || rollup.Table == "" || rollup.Query == "" {
+				report("proxy: rollup[%s] user, database, table and query must be set", rollup.Name)
+			}
+			if rollup.Watermark != "" && rollup.Rewrite {
+				report("proxy: rollup[%s] with the watermark can't be rewritten", rollup.Name)
+			}
+		}
+	}
+
+	if audit := conf.Audit; audit != nil {
+		switch audit.Mode {
+		case "N", "R", "W", "A":
+		default:
+			report("audit: mode[%s] is invalid, must be one of N(none), R(read), W(write), A(all)", audit.Mode)
+		}
+		if audit.Mode != "N" && audit.LogDir == "" {
+			report("audit: audit-dir is empty but the mode is %s", audit.Mode)
+		}
+	}
+
+	if access := conf.Access; access != nil {
+		if access.LogDir == "" {
+			report("access: access-dir is empty, set it or remove the access section to disable the access log")
+		}
+		if access.MaxSize <= 0 || access.ExpireHours < 0 {
+			report("access: max-size[%d] must be greater than 0 and expire-hours[%d] must not be negative", access.MaxSize, access.ExpireHours)
+		}
+	}
+
+	if router := conf.Router; router != nil {
+		if router.Slots <= 0 || router.Blocks <= 0 || router.Blocks > router.Slots {
+			report("router: slots[%d] and blocks[%d] must be greater than 0 and blocks must not exceed slots", router.Slots, router.Blocks)
+		}
+		if router.Partitions < 0 || router.Partitions > router.Slots {
+			report("router: partitions[%d] must not be negative or exceed slots[%d]", router.Partitions, router.Slots)
+		}
+		if router.SegmentNaming != nil {
+			if err := router.SegmentNaming.Validate(); err != nil {
+				report("router: %v", err)
+			}
+		}
+		if _, err := ParseTimeZone(router.TimeZone); err != nil {
+			report("router: time-zone[%s] must be the offset such as '+08:00' or the IANA name", router.TimeZone)
+		}
+	}
+
+	if log := conf.Log; log != nil {
+		valid := false
+		var names []string
+		for _, name := range xlog.LevelNames {
+			if name == "" {
+				continue
+			}
+			names = append(names, name)
+			if log.Level == name {
+				valid = true
+			}
+		}
+		if !valid {
+			report("log: level[%s] is invalid, must be one of %s", log.Level, strings.Join(names, ", "))
+		}
+	}
+
+	if scatter := conf.Scatter; scatter != nil {
+		if scatter.ValidateInterval < 0 {
+			report("scatter: validate-interval[%d] must not be negative, 0 means disabled", scatter.ValidateInterval)
+		}
+	}
+	return errs
+}
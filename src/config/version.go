@@ -27,31 +27,68 @@ const (
 // Version tuple.
 type Version struct {
 	Ts int64 `json:"version"`
+	// SchemaVersion is the metadata format version, 0 means the file is written before it's introduced.
+	SchemaVersion int `json:"schema-version,omitempty"`
 }
 
-// UpdateVersion used to update the config version of the file.
+// UpdateVersion used to update the config version of the file, the schema version is kept.
 func UpdateVersion(metadir string) error {
-	name := path.Join(metadir, versionJSONFile)
 	version := &Version{
-		Ts: time.Now().UnixNano(),
+		Ts:            time.Now().UnixNano(),
+		SchemaVersion: SchemaVersion(),
 	}
-	b, err := json.Marshal(version)
-	if err != nil {
-		return errors.WithStack(err)
+	if old, err := readVersion(metadir); err == nil {
+		version.SchemaVersion = old.SchemaVersion
 	}
-	return xbase.WriteFile(name, b)
+	return writeVersion(metadir, version)
 }
 
 // ReadVersion used to read the config version from the file.
 func ReadVersion(metadir string) int64 {
+	version, err := readVersion(metadir)
+	if err != nil {
+		return 0
+	}
+	return version.Ts
+}
+
+// ReadSchemaVersion used to read the metadata schema version from the file.
+func ReadSchemaVersion(metadir string) int {
+	version, err := readVersion(metadir)
+	if err != nil {
+		return 0
+	}
+	return version.SchemaVersion
+}
+
+// writeSchemaVersion used to update the schema version, the config version is kept.
+func writeSchemaVersion(metadir string, schemaVersion int) error {
+	version, err := readVersion(metadir)
+	if err != nil {
+		version = &Version{Ts: time.Now().UnixNano()}
+	}
+	version.SchemaVersion = schemaVersion
+	return writeVersion(metadir, version)
+}
+
+func readVersion(metadir string) (*Version, error) {
 	name := path.Join(metadir, versionJSONFile)
 	version := &Version{}
 	data, err := ioutil.ReadFile(name)
 	if err != nil {
-		return 0
+		return nil, errors.WithStack(err)
 	}
 	if err := json.Unmarshal([]byte(data), version); err != nil {
-		return 0
+		return nil, errors.WithStack(err)
 	}
-	return version.Ts
+	return version, nil
+}
+
+func writeVersion(metadir string, version *Version) error {
+	name := path.Join(metadir, versionJSONFile)
+	b, err := json.Marshal(version)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return xbase.WriteFile(name, b)
 }
@@ -0,0 +1,70 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"conformance"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	flagCorpus        string
+	flagMySQLAddress  string
+	flagMySQLUser     string
+	flagMySQLPassword string
+	flagRadonAddress  string
+	flagRadonUser     string
+	flagRadonPassword string
+)
+
+func init() {
+	flag.StringVar(&flagCorpus, "corpus", "src/conformance/corpus", "the dir of the corpus files")
+	flag.StringVar(&flagMySQLAddress, "mysql-address", "127.0.0.1:13306", "the address of the reference MySQL")
+	flag.StringVar(&flagMySQLUser, "mysql-user", "root", "the user of the reference MySQL")
+	flag.StringVar(&flagMySQLPassword, "mysql-password", "", "the password of the reference MySQL")
+	flag.StringVar(&flagRadonAddress, "radon-address", "127.0.0.1:13308", "the address of the radon")
+	flag.StringVar(&flagRadonUser, "radon-user", "root", "the user of the radon")
+	flag.StringVar(&flagRadonPassword, "radon-password", "", "the password of the radon")
+}
+
+func usage() {
+	fmt.Println("Usage: " + os.Args[0] + " [--corpus <dir>] [--mysql-address <address>] [--mysql-user <user>] [--mysql-password <password>] [--radon-address <address>] [--radon-user <user>] [--radon-password <password>]")
+}
+
+func main() {
+	log := xlog.NewStdLog(xlog.Level(xlog.ERROR))
+
+	flag.Usage = func() { usage() }
+	flag.Parse()
+
+	corpus, err := conformance.LoadCorpus(flagCorpus)
+	if err != nil {
+		log.Panic("conformance.load.corpus.error[%v]", err)
+	}
+	conf := &conformance.Config{
+		MySQL: &conformance.Target{Address: flagMySQLAddress, User: flagMySQLUser, Password: flagMySQLPassword},
+		Radon: &conformance.Target{Address: flagRadonAddress, User: flagRadonUser, Password: flagRadonPassword},
+	}
+	report, err := conformance.NewComparer(log, conf).Run(corpus)
+	if err != nil {
+		log.Panic("conformance.run.error[%v]", err)
+	}
+	for _, m := range report.Mismatches {
+		fmt.Println(m)
+	}
+	fmt.Printf("cases:%d, passed:%d, mismatches:%d\n", report.Cases, report.Passed, len(report.Mismatches))
+	if len(report.Mismatches) > 0 {
+		os.Exit(1)
+	}
+}
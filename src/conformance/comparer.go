@@ -0,0 +1,203 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package conformance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// Target is the MySQL endpoint the corpus runs against.
+type Target struct {
+	Address  string
+	User     string
+	Password string
+}
+
+// Config tuple.
+type Config struct {
+	// MySQL is the single MySQL instance as the reference.
+	MySQL *Target
+	// Radon is the radon with the backends.
+	Radon *Target
+}
+
+// Mismatch is the case whose results are different.
+type Mismatch struct {
+	Case   *Case
+	Reason string
+	MySQL  string
+	Radon  string
+}
+
+// String impl.
+func (m *Mismatch) String() string {
+	return fmt.Sprintf("%s:%d: %s\n  query: %s\n  mysql: %s\n  radon: %s", m.Case.File, m.Case.Line, m.Reason, m.Case.Query, m.MySQL, m.Radon)
+}
+
+// Report tuple.
+type Report struct {
+	Cases      int
+	Passed     int
+	Mismatches []*Mismatch
+}
+
+// Comparer used to run the corpus against the MySQL and the radon, and diff the result sets and the error codes.
+// The files of the corpus run in order, each file on its own connections, so a file can set up the schema
+// of its querys. The rows are compared in order only if the query has the ORDER BY, radon merges the rows
+// of the backends in any order.
+type Comparer struct {
+	log  *xlog.Log
+	conf *Config
+}
+
+// NewComparer creates the new comparer.
+func NewComparer(log *xlog.Log, conf *Config) *Comparer {
+	return &Comparer{
+		log:  log,
+		conf: conf,
+	}
+}
+
+// Run used to run the corpus and returns the report.
+func (c *Comparer) Run(corpus [][]*Case) (*Report, error) {
+	report := &Report{}
+	for _, cases := range corpus {
+		if err := c.runFile(cases, report); err != nil {
+			return nil, err
+		}
+	}
+	c.log.Info("conformance.done.cases[%d].passed[%d].mismatches[%d]", report.Cases, report.Passed, len(report.Mismatches))
+	return report, nil
+}
+
+func (c *Comparer) runFile(cases []*Case, report *Report) error {
+	conf := c.conf
+	mysql, err := driver.NewConn(conf.MySQL.User, conf.MySQL.Password, conf.MySQL.Address, "", "utf8")
+	if err != nil {
+		return err
+	}
+	defer mysql.Close()
+	radon, err := driver.NewConn(conf.Radon.User, conf.Radon.Password, conf.Radon.Address, "", "utf8")
+	if err != nil {
+		return err
+	}
+	defer radon.Close()
+
+	for _, cs := range cases {
+		report.Cases++
+		mqr, merr := mysql.FetchAll(cs.Query, -1)
+		rqr, rerr := radon.FetchAll(cs.Query, -1)
+		if m := compare(cs, mqr, merr, rqr, rerr); m != nil {
+			c.log.Warning("conformance.mismatch:%s", m)
+			report.Mismatches = append(report.Mismatches, m)
+			continue
+		}
+		report.Passed++
+	}
+	return nil
+}
+
+// compare returns nil if the results of the two sides are the same.
+func compare(cs *Case, mqr *sqltypes.Result, merr error, rqr *sqltypes.Result, rerr error) *Mismatch {
+	mismatch := func(reason string, mysql, radon interface{}) *Mismatch {
+		return &Mismatch{Case: cs, Reason: reason, MySQL: fmt.Sprintf("%v", mysql), Radon: fmt.Sprintf("%v", radon)}
+	}
+
+	switch {
+	case merr != nil && rerr != nil:
+		if errorCode(merr) != errorCode(rerr) {
+			return mismatch("error code", merr, rerr)
+		}
+		return nil
+	case merr != nil:
+		return mismatch("error", merr, "no error")
+	case rerr != nil:
+		return mismatch("error", "no error", rerr)
+	case cs.Exec:
+		return nil
+	}
+
+	mfields, rfields := fieldNames(mqr), fieldNames(rqr)
+	if strings.Join(mfields, ",") != strings.Join(rfields, ",") {
+		return mismatch("fields", mfields, rfields)
+	}
+	// The rows affected of the DML.
+	if len(mfields) == 0 && mqr.RowsAffected != rqr.RowsAffected {
+		return mismatch("rows affected", mqr.RowsAffected, rqr.RowsAffected)
+	}
+	if len(mqr.Rows) != len(rqr.Rows) {
+		return mismatch("rows", len(mqr.Rows), len(rqr.Rows))
+	}
+	mrows, rrows := rowStrings(mqr), rowStrings(rqr)
+	if cs.Sort || !ordered(cs.Query) {
+		sort.Strings(mrows)
+		sort.Strings(rrows)
+	}
+	for i := range mrows {
+		if mrows[i] != rrows[i] {
+			return mismatch(fmt.Sprintf("row %d", i), mrows[i], rrows[i])
+		}
+	}
+	return nil
+}
+
+// errorCode returns the MySQL error number, or the message if it's not the SQL error.
+func errorCode(err error) string {
+	if se, ok := err.(*sqldb.SQLError); ok {
+		return fmt.Sprintf("%d", se.Num)
+	}
+	return err.Error()
+}
+
+func fieldNames(qr *sqltypes.Result) []string {
+	names := make([]string, 0, len(qr.Fields))
+	for _, field := range qr.Fields {
+		names = append(names, strings.ToLower(field.Name))
+	}
+	return names
+}
+
+func rowStrings(qr *sqltypes.Result) []string {
+	rows := make([]string, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		vals := make([]string, 0, len(row))
+		for _, v := range row {
+			if v.IsNull() {
+				vals = append(vals, "NULL")
+				continue
+			}
+			vals = append(vals, fmt.Sprintf("%q", v.ToString()))
+		}
+		rows = append(rows, "("+strings.Join(vals, ",")+")")
+	}
+	return rows
+}
+
+// ordered returns true if the query is the SELECT or UNION with the ORDER BY.
+func ordered(query string) bool {
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return false
+	}
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		return len(node.OrderBy) > 0
+	case *sqlparser.Union:
+		return len(node.OrderBy) > 0
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package conformance
+
+import (
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func mockResult(vals ...string) *sqltypes.Result {
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}},
+	}
+	for _, v := range vals {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_INT32, []byte(v))})
+	}
+	return qr
+}
+
+func TestConformanceComparer(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	mysqldb := fakedb.New(log, 1)
+	defer mysqldb.Close()
+	radondb := fakedb.New(log, 1)
+	defer radondb.Close()
+
+	errTable := sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, "t4")
+	errSyntax := sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, "near t4")
+	errUnknown := sqldb.NewSQLError(sqldb.ER_UNKNOWN_ERROR, "mock")
+	querys := []struct {
+		query string
+		mysql interface{}
+		radon interface{}
+	}{
+		{"select id from t1", mockResult("1", "2"), mockResult("2", "1")},
+		{"select id from t1 order by id", mockResult("1", "2"), mockResult("2", "1")},
+		{"select id from t2", mockResult("1"), mockResult("1", "2")},
+		{"select id from t3", sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, "t3"), sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, "t3")},
+		{"select id from t4", errTable, errSyntax},
+		{"select id from t5", mockResult("1"), errUnknown},
+		{"drop table t1", mockResult("1"), mockResult("2")},
+		{"delete from t1", &sqltypes.Result{RowsAffected: 1}, &sqltypes.Result{RowsAffected: 2}},
+	}
+	for _, q := range querys {
+		for db, r := range map[*fakedb.DB]interface{}{mysqldb: q.mysql, radondb: q.radon} {
+			switch r := r.(type) {
+			case *sqltypes.Result:
+				db.AddQuery(q.query, r)
+			case error:
+				db.AddQueryError(q.query, r)
+			}
+		}
+	}
+
+	target := func(db *fakedb.DB) *Target {
+		conf := db.BackendConfs()[0]
+		return &Target{Address: conf.Address, User: conf.User, Password: conf.Password}
+	}
+	conf := &Config{
+		MySQL: target(mysqldb),
+		Radon: target(radondb),
+	}
+	corpus := [][]*Case{
+		{
+			{File: "a.sql", Line: 1, Query: "select id from t1"},
+			{File: "a.sql", Line: 2, Query: "select id from t1 order by id"},
+			{File: "a.sql", Line: 3, Query: "select id from t2"},
+		},
+		{
+			{File: "b.sql", Line: 1, Query: "select id from t3"},
+			{File: "b.sql", Line: 2, Query: "select id from t4"},
+			{File: "b.sql", Line: 3, Query: "select id from t5"},
+			{File: "b.sql", Line: 4, Query: "drop table t1", Exec: true},
+			{File: "b.sql", Line: 5, Query: "delete from t1"},
+		},
+	}
+	report, err := NewComparer(log, conf).Run(corpus)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, report.Cases)
+	assert.Equal(t, 3, report.Passed)
+
+	want := []string{
+		"a.sql:2: row 0\n  query: select id from t1 order by id\n  mysql: (\"1\")\n  radon: (\"2\")",
+		"a.sql:3: rows\n  query: select id from t2\n  mysql: 1\n  radon: 2",
+		"b.sql:2: error code\n  query: select id from t4\n  mysql: " + errTable.Error() + "\n  radon: " + errSyntax.Error(),
+		"b.sql:3: error\n  query: select id from t5\n  mysql: no error\n  radon: " + errUnknown.Error(),
+		"b.sql:5: rows affected\n  query: delete from t1\n  mysql: 1\n  radon: 2",
+	}
+	var got []string
+	for _, m := range report.Mismatches {
+		got = append(got, m.String())
+	}
+	assert.Equal(t, want, got)
+
+	// The connection error.
+	{
+		conf.Radon = &Target{Address: "127.0.0.1:1", User: "mock"}
+		_, err := NewComparer(log, conf).Run(corpus)
+		assert.NotNil(t, err)
+	}
+}
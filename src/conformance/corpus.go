@@ -0,0 +1,107 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package conformance
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// corpusExtension is the extension of the corpus files.
+	corpusExtension = ".sql"
+
+	// directiveSort compares the rows of the next query in any order.
+	directiveSort = "sort"
+	// directiveExec executes the next query on both sides without comparing the results.
+	directiveExec = "exec"
+)
+
+// Case is one query of the corpus.
+type Case struct {
+	File  string
+	Line  int
+	Query string
+	// Sort is true if the rows are compared in any order.
+	Sort bool
+	// Exec is true if only the errors are compared.
+	Exec bool
+}
+
+// LoadCorpus used to load the cases of the corpus files under the dir, the files are loaded in the name order.
+// A query ends with the ';' at the end of the line and may span lines, the lines start with '--' are comments,
+// the comments '-- sort' and '-- exec' are the directives of the next query.
+func LoadCorpus(dir string) ([][]*Case, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+corpusExtension))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sort.Strings(files)
+
+	var corpus [][]*Case
+	for _, file := range files {
+		cases, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		corpus = append(corpus, cases)
+	}
+	return corpus, nil
+}
+
+func loadFile(file string) ([]*Case, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer fd.Close()
+
+	var cases []*Case
+	var lines []string
+	next := &Case{File: filepath.Base(file)}
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(lines) == 0 {
+			if line == "" {
+				continue
+			}
+			if strings.HasPrefix(line, "--") {
+				switch strings.TrimSpace(strings.TrimPrefix(line, "--")) {
+				case directiveSort:
+					next.Sort = true
+				case directiveExec:
+					next.Exec = true
+				}
+				continue
+			}
+			next.Line = n
+		}
+		lines = append(lines, line)
+		if strings.HasSuffix(line, ";") {
+			next.Query = strings.TrimSuffix(strings.Join(lines, " "), ";")
+			cases = append(cases, next)
+			next = &Case{File: next.File}
+			lines = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(lines) > 0 {
+		return nil, errors.Errorf("conformance.corpus[%s].line[%d].query.not.ended.with.semicolon", next.File, next.Line)
+	}
+	return cases, nil
+}
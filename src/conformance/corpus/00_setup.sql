@@ -0,0 +1,10 @@
+-- The schema of the corpus, the tables are partitioned by hash on both sides.
+-- exec
+drop database if exists conformance;
+create database conformance;
+create table conformance.t1(id int not null, name varchar(32), score int, primary key(id)) partition by hash(id);
+create table conformance.t2(id int not null, t1_id int, amount decimal(10,2), primary key(id)) partition by hash(id);
+
+insert into conformance.t1(id, name, score) values(1, 'a', 10), (2, 'b', 20), (3, 'c', 30), (4, 'd', null), (5, 'e', 50);
+insert into conformance.t1(id, name, score) values(6, 'f', 10), (7, null, 20), (8, 'h', 30), (9, 'i', 40), (10, 'j', 50);
+insert into conformance.t2(id, t1_id, amount) values(1, 1, 1.50), (2, 1, 2.50), (3, 2, 3.00), (4, 3, 4.25), (5, 9, 5.75), (6, 11, 6.00);
@@ -0,0 +1,9 @@
+select * from conformance.t1;
+select id, name from conformance.t1 where id = 3;
+select id, name from conformance.t1 where id in (1, 5, 9);
+select id, score from conformance.t1 where score between 20 and 40;
+select id, name from conformance.t1 where name like 'a%' or name is null;
+select id from conformance.t1 where score is null;
+select id, score + 1, score * 2 from conformance.t1 where id > 5;
+select t.id, t.name from conformance.t1 as t where t.score > 20;
+select * from conformance.t1 where id = 100;
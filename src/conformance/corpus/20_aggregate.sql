@@ -0,0 +1,7 @@
+select count(*) from conformance.t1;
+select count(score), sum(score), min(score), max(score) from conformance.t1;
+select score, count(*) from conformance.t1 group by score;
+select score, count(*) as c from conformance.t1 group by score having c > 1;
+select distinct score from conformance.t1;
+select count(distinct score) from conformance.t1;
+select t1_id, sum(amount) from conformance.t2 group by t1_id;
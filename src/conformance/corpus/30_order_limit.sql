@@ -0,0 +1,7 @@
+select id, name from conformance.t1 order by id;
+select id, name from conformance.t1 order by id desc limit 3;
+select id, score from conformance.t1 order by score, id limit 2, 4;
+select score, count(*) from conformance.t1 group by score order by score desc;
+-- The ties of the score are in any order.
+-- sort
+select id, score from conformance.t1 order by score limit 10;
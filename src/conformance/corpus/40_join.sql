@@ -0,0 +1,7 @@
+select t1.id, t1.name, t2.amount from conformance.t1 join conformance.t2 on t1.id = t2.t1_id;
+select t1.id, t2.id from conformance.t1 left join conformance.t2 on t1.id = t2.t1_id;
+select t1.id, t2.id from conformance.t1 right join conformance.t2 on t1.id = t2.t1_id;
+select t1.name, sum(t2.amount) from conformance.t1 join conformance.t2 on t1.id = t2.t1_id group by t1.name;
+select t1.id from conformance.t1 join conformance.t2 on t1.id = t2.t1_id where t2.amount > 3 order by t1.id;
+select id from conformance.t1 union select t1_id from conformance.t2;
+select id from conformance.t1 union all select t1_id from conformance.t2;
@@ -0,0 +1,9 @@
+update conformance.t1 set score = score + 1 where id in (1, 2);
+select id, score from conformance.t1 where id in (1, 2);
+update conformance.t1 set name = 'z' where score > 40;
+select id, name from conformance.t1;
+delete from conformance.t2 where amount > 5;
+select * from conformance.t2;
+insert into conformance.t2(id, t1_id, amount) values(7, 4, 7.00);
+replace into conformance.t2(id, t1_id, amount) values(7, 4, 8.00);
+select * from conformance.t2 where id = 7;
@@ -0,0 +1,6 @@
+-- Both sides should fail with the same error code.
+select * from conformance.t3;
+select xx from conformance.t1;
+insert into conformance.t1(id, name) values(1, 'dup');
+create database conformance;
+create table conformance.t1(id int) partition by hash(id);
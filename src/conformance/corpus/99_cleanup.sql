@@ -0,0 +1,2 @@
+-- exec
+drop database conformance;
@@ -0,0 +1,70 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package conformance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestConformanceLoadCorpus(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("", "radon_conformance_", log)
+	defer os.RemoveAll(dir)
+
+	err := ioutil.WriteFile(filepath.Join(dir, "20_b.sql"), []byte("select 3;\n"), 0644)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "10_a.sql"), []byte(`-- The comment.
+select 1;
+
+-- sort
+select id
+  from t1;
+-- exec
+drop table t1;
+`), 0644)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "readme.txt"), []byte("select 4;\n"), 0644)
+	assert.Nil(t, err)
+
+	corpus, err := LoadCorpus(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(corpus))
+	want := []*Case{
+		{File: "10_a.sql", Line: 2, Query: "select 1"},
+		{File: "10_a.sql", Line: 5, Query: "select id from t1", Sort: true},
+		{File: "10_a.sql", Line: 8, Query: "drop table t1", Exec: true},
+	}
+	assert.Equal(t, want, corpus[0])
+	assert.Equal(t, []*Case{{File: "20_b.sql", Line: 1, Query: "select 3"}}, corpus[1])
+
+	// The query not ended.
+	{
+		err := ioutil.WriteFile(filepath.Join(dir, "30_c.sql"), []byte("select 1;\nselect 2\n"), 0644)
+		assert.Nil(t, err)
+		_, err = LoadCorpus(dir)
+		assert.Equal(t, "conformance.corpus[30_c.sql].line[2].query.not.ended.with.semicolon", err.Error())
+	}
+}
+
+func TestConformanceCorpus(t *testing.T) {
+	corpus, err := LoadCorpus("corpus")
+	assert.Nil(t, err)
+	assert.True(t, len(corpus) > 0)
+	for _, cases := range corpus {
+		assert.True(t, len(cases) > 0)
+	}
+}
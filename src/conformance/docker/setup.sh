@@ -0,0 +1,33 @@
+#!/bin/bash
+# Starts the conformance setup and adds the backends to the radon.
+set -e
+cd "$(dirname "$0")"
+
+docker-compose up -d --build
+
+wait_mysql() {
+	for i in $(seq 1 60); do
+		if docker-compose exec -T "$1" mysql -uroot -e "select 1" >/dev/null 2>&1; then
+			return 0
+		fi
+		sleep 2
+	done
+	echo "$1 is not ready" >&2
+	exit 1
+}
+wait_mysql mysql
+wait_mysql backend1
+wait_mysql backend2
+
+for i in $(seq 1 30); do
+	if curl -s http://127.0.0.1:18080/v1/radon/ping >/dev/null; then
+		break
+	fi
+	sleep 1
+done
+
+for backend in backend1 backend2; do
+	curl -s -f -H 'Content-Type: application/json' -X POST \
+		-d "{\"name\": \"${backend}\", \"address\": \"${backend}:3306\", \"user\": \"root\", \"password\": \"\", \"max-connections\": 1024}" \
+		http://127.0.0.1:18080/v1/radon/backend
+done
@@ -29,8 +29,18 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Put("/v1/radon/throttle", v1.ThrottleHandler(log, proxy)),
 		rest.Post("/v1/radon/backend", v1.AddBackendHandler(log, proxy)),
 		rest.Delete("/v1/radon/backend/:name", v1.RemoveBackendHandler(log, proxy)),
+		rest.Post("/v1/radon/backend/:name/bootstrap", v1.BootstrapBackendHandler(log, proxy)),
+		rest.Post("/v1/radon/backend/:name/promote", v1.PromoteBackendHandler(log, proxy)),
 		rest.Get("/v1/radon/restapiaddress", v1.RestAPIAddressHandler(log, proxy)),
 		rest.Get("/v1/radon/status", v1.StatusHandler(log, proxy)),
+		rest.Get("/v1/radon/jobs", v1.JobsHandler(log, proxy)),
+		rest.Post("/v1/radon/jobs/#name/run", v1.RunJobHandler(log, proxy)),
+		rest.Get("/v1/radon/watermarks", v1.WatermarksHandler(log, proxy)),
+		rest.Post("/v1/radon/watermarks", v1.CaptureWatermarkHandler(log, proxy)),
+		rest.Post("/v1/radon/sessions/export", v1.SessionsExportHandler(log, proxy)),
+		rest.Post("/v1/radon/sessions/import", v1.SessionsImportHandler(log, proxy)),
+		rest.Get("/v1/radon/databases/usage", v1.DatabaseUsageHandler(log, proxy)),
+		rest.Put("/v1/radon/databases/:name/quota", v1.DatabaseQuotaHandler(log, proxy)),
 
 		// user
 		rest.Post("/v1/user/add", v1.CreateUserHandler(log, proxy)),
@@ -42,9 +52,15 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Get("/v1/shard/shardz", v1.ShardzHandler(log, proxy)),
 		rest.Get("/v1/shard/globals", v1.GlobalsHandler(log, proxy)),
 		rest.Get("/v1/shard/balanceadvice", v1.ShardBalanceAdviceHandler(log, proxy)),
+		rest.Get("/v1/shard/hotshards", v1.HotShardsHandler(log, proxy)),
+		rest.Get("/v1/shard/indexadvice", v1.IndexAdviceHandler(log, proxy)),
 		rest.Post("/v1/shard/shift", v1.ShardRuleShiftHandler(log, proxy)),
 		rest.Post("/v1/shard/reload", v1.ShardReLoadHandler(log, proxy)),
 
+		// backend
+		rest.Post("/v1/backend/promote", v1.FailoverBackendHandler(log, proxy)),
+		rest.Get("/v1/backends/info", v1.BackendsInfoHandler(log, proxy)),
+
 		// meta
 		rest.Get("/v1/meta/versions", v1.VersionzHandler(log, proxy)),
 		rest.Get("/v1/meta/versioncheck", v1.VersionCheckHandler(log, proxy)),
@@ -62,5 +78,27 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Get("/v1/debug/configz", v1.ConfigzHandler(log, proxy)),
 		rest.Get("/v1/debug/backendz", v1.BackendzHandler(log, proxy)),
 		rest.Get("/v1/debug/schemaz", v1.SchemazHandler(log, proxy)),
+
+		// table
+		rest.Post("/v1/table/backup", v1.TableBackupHandler(log, proxy)),
+		rest.Post("/v1/table/restore", v1.TableRestoreHandler(log, proxy)),
+		rest.Post("/v1/table/renamesegments", v1.TableRenameSegmentsHandler(log, proxy)),
+		rest.Post("/v1/table/shardmap", v1.TableShardMapHandler(log, proxy)),
+		rest.Post("/v1/table/keynormalization", v1.TableKeyNormalizationHandler(log, proxy)),
+		rest.Post("/v1/table/lookup", v1.TableLookupHandler(log, proxy)),
+		rest.Post("/v1/table/lookupcheck", v1.TableLookupCheckHandler(log, proxy)),
+		rest.Post("/v1/table/movesingle", v1.TableMoveSingleHandler(log, proxy)),
+		rest.Post("/v1/table/reshard", v1.TableReshardHandler(log, proxy)),
+		rest.Get("/v1/table/reshardz", v1.TableReshardzHandler(log, proxy)),
+
+		// query
+		rest.Post("/v1/query", v1.QueryHandler(log, proxy)),
+
+		// ddl
+		rest.Post("/v1/ddl/batch", v1.DDLBatchHandler(log, proxy)),
+		rest.Get("/v1/ddl/log", v1.DDLLogHandler(log, proxy)),
+		rest.Get("/v1/ddl/journal", v1.DDLJournalHandler(log, proxy)),
+		rest.Post("/v1/ddl/journal/replay", v1.DDLJournalReplayHandler(log, proxy)),
+		rest.Post("/v1/ddl/journal/discard", v1.DDLJournalDiscardHandler(log, proxy)),
 	)
 }
@@ -11,11 +11,14 @@ package v1
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
+	"backend"
 	"config"
 	"proxy"
 
 	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -25,6 +28,12 @@ type backendParams struct {
 	User           string `json:"user"`
 	Password       string `json:"password"`
 	MaxConnections int    `json:"max-connections"`
+	CompatMode     string `json:"compat-mode"`
+	SQLMode        string `json:"sql-mode"`
+	Autocommit     *bool  `json:"autocommit"`
+
+	ValidateStrategy string `json:"validate-strategy"`
+	ValidateIdleTime int    `json:"validate-idle-time"`
 }
 
 // AddBackendHandler impl.
@@ -42,7 +51,7 @@ func initBackend(proxy *proxy.Proxy, backend string, log *xlog.Log) error {
 	// create db from router on the new backend, make sure the db not exists, or else return err.
 	tblList := router.Tables()
 	for db, _ := range tblList {
-		query := fmt.Sprintf("create database %s", db)
+		query := fmt.Sprintf("create database %s", sqlparser.Backtick(db))
 		_, err := spanner.ExecuteOnThisBackend(backend, query)
 		if err != nil {
 			log.Error("api.v1.add.backend.initBackend.error:%v", err)
@@ -69,9 +78,31 @@ func addBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter,
 		Password:       p.Password,
 		Charset:        "utf8",
 		MaxConnections: p.MaxConnections,
+		CompatMode:     p.CompatMode,
+		SQLMode:        p.SQLMode,
+		Autocommit:     p.Autocommit,
+
+		ValidateStrategy: p.ValidateStrategy,
+		ValidateIdleTime: p.ValidateIdleTime,
 	}
 	log.Warning("api.v1.add[from:%v].backend[%+v]", r.RemoteAddr, conf)
 
+	switch conf.CompatMode {
+	case "", backend.CompatMySQL57, backend.CompatMySQL80, backend.CompatMariaDB:
+	default:
+		log.Error("api.v1.add.backend[%+v].error:unsupported.compat.mode", conf)
+		rest.Error(w, fmt.Sprintf("unsupported compat-mode:%s", conf.CompatMode), http.StatusInternalServerError)
+		return
+	}
+
+	switch conf.ValidateStrategy {
+	case "", backend.ValidatePing, backend.ValidateSelect1, backend.ValidateNone:
+	default:
+		log.Error("api.v1.add.backend[%+v].error:unsupported.validate.strategy", conf)
+		rest.Error(w, fmt.Sprintf("unsupported validate-strategy:%s", conf.ValidateStrategy), http.StatusInternalServerError)
+		return
+	}
+
 	if err := scatter.Add(conf); err != nil {
 		log.Error("api.v1.add.backend[%+v].error:%+v", conf, err)
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
@@ -119,3 +150,184 @@ func removeBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWrit
 		return
 	}
 }
+
+// BootstrapBackendHandler impl.
+func BootstrapBackendHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		bootstrapBackendHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func bootstrapBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	backend := r.PathParam("name")
+	log.Warning("api.v1.bootstrap[from:%v].backend[%s]", r.RemoteAddr, backend)
+
+	report, err := proxy.Spanner().BootstrapBackend(backend)
+	if err != nil {
+		log.Error("api.v1.bootstrap.backend[%s].created[%+v].error:%+v", backend, report, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(report)
+}
+
+type promoteParams struct {
+	Address  string `json:"address"`
+	Failover bool   `json:"failover"`
+}
+
+// PromoteBackendHandler impl.
+func PromoteBackendHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		promoteBackendHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func promoteBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	scatter := proxy.Scatter()
+	backend := r.PathParam("name")
+	p := promoteParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.promote.backend.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Warning("api.v1.promote[from:%v].backend[%s].params[%+v]", r.RemoteAddr, backend, p)
+
+	if err := scatter.Promote(backend, p.Address, p.Failover); err != nil {
+		log.Error("api.v1.promote.backend[%s].error:%+v", backend, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type failoverParams struct {
+	Name          string `json:"name"`
+	FailedAddress string `json:"failed-address"`
+	Address       string `json:"address"`
+	User          string `json:"user"`
+	Password      string `json:"password"`
+}
+
+// FailoverBackendHandler impl, it's the webhook of the failover managers such as Orchestrator and MHA.
+func FailoverBackendHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		failoverBackendHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func failoverBackendHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	scatter := proxy.Scatter()
+	p := failoverParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.failover.backend.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Warning("api.v1.failover[from:%v].backend[%s].failed.address[%s].to.address[%s].user[%s]", r.RemoteAddr, p.Name, p.FailedAddress, p.Address, p.User)
+
+	// The failover managers know the failed master address only.
+	name := p.Name
+	if name == "" {
+		if name = scatter.BackendByAddress(p.FailedAddress); name == "" {
+			log.Error("api.v1.failover.backend.failed.address[%s].not.found", p.FailedAddress)
+			rest.Error(w, fmt.Sprintf("backend of the failed-address[%s] can not be found", p.FailedAddress), http.StatusNotFound)
+			return
+		}
+	}
+
+	if err := scatter.Repoint(name, p.Address, p.User, p.Password); err != nil {
+		log.Error("api.v1.failover.backend[%s].error:%+v", name, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// backendInfoVariables are the variables compared between the backends, the mismatched settings make the
+// same query behave differently on the segments.
+var backendInfoVariables = []string{"version", "sql_mode", "max_allowed_packet", "gtid_mode", "lower_case_table_names"}
+
+type backendInfo struct {
+	Name      string            `json:"name"`
+	Address   string            `json:"address"`
+	Version   string            `json:"version"`
+	Variables map[string]string `json:"variables"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type backendMismatch struct {
+	Variable string `json:"variable"`
+	// Values is the value of the variable on each backend, the backend without the variable is "".
+	Values map[string]string `json:"values"`
+}
+
+// BackendsInfoHandler impl.
+func BackendsInfoHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		backendsInfoHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// backendsInfoHandler used to report the version and the important variables of the backends and the mismatched ones.
+// The unreachable backend is reported with the error and skipped by the comparison.
+func backendsInfoHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	type resp struct {
+		Backends   []*backendInfo     `json:"backends"`
+		Mismatches []*backendMismatch `json:"mismatches"`
+	}
+	scatter := proxy.Scatter()
+	spanner := proxy.Spanner()
+
+	addresses := make(map[string]string)
+	for _, bconf := range scatter.BackendConfigsClone() {
+		addresses[bconf.Name] = bconf.Address
+	}
+	names := make([]string, 0, len(backendInfoVariables))
+	for _, name := range backendInfoVariables {
+		names = append(names, fmt.Sprintf("'%s'", name))
+	}
+	query := fmt.Sprintf("show global variables where variable_name in (%s)", strings.Join(names, ", "))
+
+	rsp := &resp{Backends: []*backendInfo{}, Mismatches: []*backendMismatch{}}
+	for _, name := range scatter.Backends() {
+		info := &backendInfo{Name: name, Address: addresses[name], Variables: make(map[string]string)}
+		rsp.Backends = append(rsp.Backends, info)
+		qr, err := spanner.ExecuteOnThisBackend(name, query)
+		if err != nil {
+			log.Error("api.v1.backends.info.backend[%s].error:%+v", name, err)
+			info.Error = err.Error()
+			continue
+		}
+		for _, row := range qr.Rows {
+			if len(row) < 2 {
+				continue
+			}
+			info.Variables[strings.ToLower(row[0].String())] = row[1].String()
+		}
+		info.Version = info.Variables["version"]
+	}
+
+	for _, variable := range backendInfoVariables {
+		mismatch := &backendMismatch{Variable: variable, Values: make(map[string]string)}
+		values := make(map[string]bool)
+		for _, info := range rsp.Backends {
+			if info.Error != "" {
+				continue
+			}
+			value := info.Variables[variable]
+			mismatch.Values[info.Name] = value
+			values[value] = true
+		}
+		if len(values) > 1 {
+			log.Warning("api.v1.backends.info.variable[%s].mismatch:%+v", variable, mismatch.Values)
+			rsp.Mismatches = append(rsp.Mismatches, mismatch)
+		}
+	}
+	w.WriteJson(rsp)
+}
@@ -13,12 +13,14 @@ import (
 	"testing"
 
 	"backend"
+	"config"
 	"proxy"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ant0ine/go-json-rest/rest/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -79,6 +81,36 @@ func TestCtlV1BackendAddError(t *testing.T) {
 		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend", p))
 		recorded.CodeIs(500)
 	}
+
+	// unsupported compat-mode.
+	{
+		p := &backendParams{
+			Name:           "backend6",
+			Address:        "192.168.0.1:3306",
+			User:           "mock",
+			Password:       "pwd",
+			MaxConnections: 1024,
+			CompatMode:     "9.0",
+		}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend", p))
+		recorded.CodeIs(500)
+		recorded.BodyIs("{\"Error\":\"unsupported compat-mode:9.0\"}")
+	}
+
+	// unsupported validate-strategy.
+	{
+		p := &backendParams{
+			Name:             "backend6",
+			Address:          "192.168.0.1:3306",
+			User:             "mock",
+			Password:         "pwd",
+			MaxConnections:   1024,
+			ValidateStrategy: "select",
+		}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend", p))
+		recorded.CodeIs(500)
+		recorded.BodyIs("{\"Error\":\"unsupported validate-strategy:select\"}")
+	}
 }
 
 func TestCtlV1BackendAddInitBackend(t *testing.T) {
@@ -184,3 +216,216 @@ func TestCtlV1BackendRemoveError(t *testing.T) {
 		recorded.CodeIs(500)
 	}
 }
+
+func TestCtlV1BackendBootstrap(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQuery("show databases", &sqltypes.Result{})
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/radon/backend/:name/bootstrap", BootstrapBackendHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create database test"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend/backend1/bootstrap", nil))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"backend":"backend1","databases":["test"],"tables":[],"existing":[]}`)
+	}
+
+	// 500.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend/xx/bootstrap", nil))
+		recorded.CodeIs(500)
+	}
+}
+
+func TestCtlV1BackendPromote(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	scatter := proxy.Scatter()
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/radon/backend/:name/promote", PromoteBackendHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// The replica set.
+	var conf config.BackendConfig
+	for _, c := range scatter.BackendConfigsClone() {
+		if c.Name == "backend1" {
+			conf = *c
+		}
+	}
+	primary := conf.Address
+	conf.Replicas = []string{"192.168.0.2:3306"}
+	err := scatter.Remove(&conf)
+	assert.Nil(t, err)
+	err = scatter.Add(&conf)
+	assert.Nil(t, err)
+
+	{
+		p := &promoteParams{Address: "192.168.0.2:3306"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend/backend1/promote", p))
+		recorded.CodeIs(200)
+		for _, c := range scatter.BackendConfigsClone() {
+			if c.Name == "backend1" {
+				assert.Equal(t, "192.168.0.2:3306", c.Address)
+				assert.Equal(t, []string{primary}, c.Replicas)
+			}
+		}
+	}
+
+	// 500.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend/backend1/promote", nil))
+		recorded.CodeIs(500)
+
+		p := &promoteParams{Address: "192.168.0.3:3306", Failover: true}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/backend/backend1/promote", p))
+		recorded.CodeIs(500)
+	}
+}
+
+func TestCtlV1BackendFailover(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	scatter := proxy.Scatter()
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/backend/promote", FailoverBackendHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+	backendConf := func(name string) *config.BackendConfig {
+		for _, c := range scatter.BackendConfigsClone() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+
+	// By the name.
+	{
+		p := &failoverParams{Name: "backend1", Address: "192.168.0.2:3306", User: "root", Password: "pwd"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/backend/promote", p))
+		recorded.CodeIs(200)
+		conf := backendConf("backend1")
+		assert.Equal(t, "192.168.0.2:3306", conf.Address)
+		assert.Equal(t, "root", conf.User)
+		assert.Equal(t, "pwd", conf.Password)
+	}
+
+	// By the failed address.
+	{
+		p := &failoverParams{FailedAddress: "192.168.0.2:3306", Address: "192.168.0.3:3306"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/backend/promote", p))
+		recorded.CodeIs(200)
+		conf := backendConf("backend1")
+		assert.Equal(t, "192.168.0.3:3306", conf.Address)
+		assert.Equal(t, "root", conf.User)
+	}
+
+	// Errors.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/backend/promote", nil))
+		recorded.CodeIs(500)
+
+		p := &failoverParams{FailedAddress: "192.168.0.2:3306", Address: "192.168.0.4:3306"}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/backend/promote", p))
+		recorded.CodeIs(404)
+
+		p = &failoverParams{Name: "backend1"}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/backend/promote", p))
+		recorded.CodeIs(500)
+	}
+}
+
+func TestCtlV1BackendsInfo(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	variables := func(sqlMode string) *sqltypes.Result {
+		qr := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "Variable_name", Type: querypb.Type_VARCHAR},
+				{Name: "Value", Type: querypb.Type_VARCHAR},
+			},
+		}
+		for _, kv := range [][]string{{"gtid_mode", "ON"}, {"lower_case_table_names", "0"}, {"max_allowed_packet", "67108864"}, {"sql_mode", sqlMode}, {"version", "5.7.25"}} {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(kv[0])),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(kv[1])),
+			})
+		}
+		return qr
+	}
+	query := "show global variables where variable_name in ('version', 'sql_mode', 'max_allowed_packet', 'gtid_mode', 'lower_case_table_names')"
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/backends/info", BackendsInfoHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Same.
+	{
+		fakedbs.AddQuerys(query, variables("STRICT_TRANS_TABLES"))
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/backends/info", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.Contains(t, got, `{"name":"backend0","address":"`)
+		assert.Contains(t, got, `"version":"5.7.25","variables":{"gtid_mode":"ON","lower_case_table_names":"0","max_allowed_packet":"67108864","sql_mode":"STRICT_TRANS_TABLES","version":"5.7.25"}}`)
+		assert.Contains(t, got, `"mismatches":[]`)
+	}
+
+	// Mismatch.
+	{
+		same := variables("STRICT_TRANS_TABLES")
+		fakedbs.AddQuerys(query, same, same, variables(""), same, same)
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/backends/info", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.Contains(t, got, `"mismatches":[{"variable":"sql_mode","values":{"backend0":"STRICT_TRANS_TABLES","backend1":"STRICT_TRANS_TABLES","backend2":"","backend3":"STRICT_TRANS_TABLES","backend4":"STRICT_TRANS_TABLES"}}]`)
+	}
+
+	// Error.
+	{
+		fakedbs.AddQueryError(query, errors.New("mock.show.variables.error"))
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/backends/info", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.Contains(t, got, "mock.show.variables.error")
+		assert.Contains(t, got, `"mismatches":[]`)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"net/http"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+type ddlBatchParams struct {
+	Database string   `json:"database"`
+	Querys   []string `json:"querys"`
+}
+
+// DDLBatchHandler impl.
+func DDLBatchHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		ddlBatchHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// ddlBatchHandler used to apply the batch of the DDLs with the basic auth user, the batch is rejected if
+// one of the DDLs is invalid, otherwise the report of the statements is returned.
+func ddlBatchHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		rest.Error(w, "basic.auth.required", http.StatusUnauthorized)
+		return
+	}
+	if err := spanner.AuthCheckPassword(user, password); err != nil {
+		log.Error("api.v1.ddl.batch.user[%s].auth.error:%+v", user, err)
+		rest.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	p := ddlBatchParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.ddl.batch.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(p.Querys) == 0 {
+		rest.Error(w, "api.v1.ddl.batch.request.querys.is.empty", http.StatusBadRequest)
+		return
+	}
+
+	report, err := spanner.ApplyDDLBatch(user, p.Database, p.Querys)
+	if err != nil {
+		log.Error("api.v1.ddl.batch.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteJson(report)
+}
+
+// DDLLogHandler impl.
+func DDLLogHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		ddlLogHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// ddlLogHandler returns the DDLs executed on the backends chosen by the radon_backends hint, the latest first.
+func ddlLogHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(proxy.Spanner().DDLLog().Records())
+}
+
+type ddlJournalParams struct {
+	ID int64 `json:"id"`
+}
+
+// DDLJournalHandler impl.
+func DDLJournalHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		ddlJournalHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// ddlJournalHandler returns the DDL jobs not finished, the oldest first.
+func ddlJournalHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(proxy.Spanner().DDLJournal().Jobs())
+}
+
+// DDLJournalReplayHandler impl.
+func DDLJournalReplayHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		ddlJournalReplayHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// ddlJournalReplayHandler used to roll the interrupted or failed DDL job forward.
+func ddlJournalReplayHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	p := ddlJournalParams{}
+	if err := r.DecodeJsonPayload(&p); err != nil {
+		log.Error("api.v1.ddl.journal.replay.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := proxy.Spanner().ReplayDDLJob(p.ID); err != nil {
+		log.Error("api.v1.ddl.journal.replay.job[%d].error:%+v", p.ID, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DDLJournalDiscardHandler impl.
+func DDLJournalDiscardHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		ddlJournalDiscardHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// ddlJournalDiscardHandler used to remove the DDL job from the journal without replaying it, the segments are fixed by hand.
+func ddlJournalDiscardHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	p := ddlJournalParams{}
+	if err := r.DecodeJsonPayload(&p); err != nil {
+		log.Error("api.v1.ddl.journal.discard.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := proxy.Spanner().DDLJournal().Discard(p.ID); err != nil {
+		log.Error("api.v1.ddl.journal.discard.job[%d].error:%+v", p.ID, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,247 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1DDLBatch(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/ddl/batch", DDLBatchHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	{
+		p := &ddlBatchParams{
+			Database: "test",
+			Querys:   []string{"create database test", "create table t1(id int, b int) partition by hash(id)", "create index idx_b on t1(b)"},
+		}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/batch", p)
+		req.SetBasicAuth("mock", "mock")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(200)
+
+		report := &struct {
+			Applied    int           `json:"applied"`
+			Statements []interface{} `json:"statements"`
+		}{}
+		err := json.Unmarshal(recorded.Recorder.Body.Bytes(), report)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, report.Applied)
+		assert.Equal(t, 3, len(report.Statements))
+		assert.Equal(t, []string{"t1"}, proxy.Router().Tables()["test"])
+	}
+}
+
+func TestCtlV1DDLBatchError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/ddl/batch", DDLBatchHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// No auth.
+	{
+		p := &ddlBatchParams{Querys: []string{"create database test"}}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/batch", p))
+		recorded.CodeIs(401)
+	}
+
+	// Auth failed.
+	{
+		p := &ddlBatchParams{Querys: []string{"create database test"}}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/batch", p)
+		req.SetBasicAuth("mock", "xx")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(401)
+	}
+
+	// Empty querys.
+	{
+		p := &ddlBatchParams{}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/batch", p)
+		req.SetBasicAuth("mock", "mock")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(400)
+	}
+
+	// Invalid batch.
+	{
+		p := &ddlBatchParams{Querys: []string{"create table t1(id int) global"}}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/batch", p)
+		req.SetBasicAuth("mock", "mock")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(400)
+		recorded.BodyIs("{\"Error\":\"spanner.ddl.batch.statement[0].query[create table t1(id int) global].error:No database selected (errno 1046) (sqlstate 3D000)\"}")
+	}
+}
+
+func TestCtlV1DDLLog(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/ddl/log", DDLLogHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Empty.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/ddl/log", nil))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`[]`)
+	}
+
+	{
+		client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, b int) partition by hash(id)",
+			"create index idx_b on test.t1(b) /*+ radon_backends(backend1) */",
+		}
+		for _, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/ddl/log", nil))
+		recorded.CodeIs(200)
+		records := []struct {
+			Query    string        `json:"query"`
+			Status   string        `json:"status"`
+			Backends []interface{} `json:"backends"`
+		}{}
+		err = json.Unmarshal(recorded.Recorder.Body.Bytes(), &records)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(records))
+		assert.Equal(t, "create index idx_b on test.t1(b)", records[0].Query)
+		assert.Equal(t, "applied", records[0].Status)
+		assert.Equal(t, 1, len(records[0].Backends))
+	}
+}
+
+func TestCtlV1DDLJournal(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryErrorPattern("alter table .*", errors.New("mock.alter.error"))
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/ddl/journal", DDLJournalHandler(log, proxy)),
+		rest.Post("/v1/ddl/journal/replay", DDLJournalReplayHandler(log, proxy)),
+		rest.Post("/v1/ddl/journal/discard", DDLJournalDiscardHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Empty.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/ddl/journal", nil))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`[]`)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	_, err = client.FetchAll("alter table test.t1 add column(c int)", -1)
+	assert.NotNil(t, err)
+
+	jobs := []struct {
+		ID     int64  `json:"id"`
+		Query  string `json:"query"`
+		Status string `json:"status"`
+	}{}
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/ddl/journal", nil))
+		recorded.CodeIs(200)
+		err = json.Unmarshal(recorded.Recorder.Body.Bytes(), &jobs)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(jobs))
+		assert.Equal(t, "alter table test.t1 add column(c int)", jobs[0].Query)
+		assert.Equal(t, "failed", jobs[0].Status)
+	}
+
+	// Replay still failed.
+	{
+		p := &ddlJournalParams{ID: jobs[0].ID}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/journal/replay", p))
+		recorded.CodeIs(500)
+	}
+
+	// Discard.
+	{
+		p := &ddlJournalParams{ID: jobs[0].ID}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/journal/discard", p))
+		recorded.CodeIs(200)
+
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/ddl/journal", nil))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`[]`)
+
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/ddl/journal/discard", p))
+		recorded.CodeIs(500)
+	}
+}
@@ -10,8 +10,10 @@ package v1
 
 import (
 	"net/http"
+	"strings"
 
 	"optimizer"
+	"planner"
 	"proxy"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -21,6 +23,8 @@ import (
 
 type explainParams struct {
 	Query string `json:"query"`
+	// Format is the json returns the versioned planner.ExplainPlan, empty returns the plan message.
+	Format string `json:"format,omitempty"`
 }
 
 // ExplainHandler impl.
@@ -61,6 +65,17 @@ func explainHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r
 		w.WriteJson(rsp)
 		return
 	}
+	if len(planTree.Plans()) > 0 && strings.EqualFold(p.Format, "json") {
+		exp, err := planner.Explain(planTree.Plans()[0])
+		if err != nil {
+			log.Error("ctl.v1.explain[%s].explain.error:%+v", query, err)
+			rsp.Msg = err.Error()
+			w.WriteJson(rsp)
+			return
+		}
+		w.WriteJson(exp)
+		return
+	}
 	if len(planTree.Plans()) > 0 {
 		rsp.Msg = planTree.Plans()[0].JSON()
 		w.WriteJson(rsp)
@@ -11,6 +11,7 @@ package v1
 import (
 	"testing"
 
+	"planner"
 	"proxy"
 
 	"github.com/ant0ine/go-json-rest/rest"
@@ -65,4 +66,28 @@ func TestCtlV1Explain(t *testing.T) {
 		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/explain", p))
 		recorded.CodeIs(200)
 	}
+
+	// format json.
+	{
+		api := rest.NewApi()
+		router, _ := rest.MakeRouter(
+			rest.Post("/v1/radon/explain", ExplainHandler(log, proxy)),
+		)
+		api.SetApp(router)
+		handler := api.MakeHandler()
+
+		p := &explainParams{
+			Query:  "select id, b from test.t1 where id=1",
+			Format: "json",
+		}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/explain", p))
+		recorded.CodeIs(200)
+		exp := &planner.ExplainPlan{}
+		err := recorded.DecodeJsonPayload(exp)
+		assert.Nil(t, err)
+		assert.Equal(t, planner.ExplainVersion, exp.Version)
+		assert.Equal(t, "select", exp.Statement)
+		assert.Equal(t, "single", exp.Root.Routing)
+		assert.Equal(t, []string{"id", "b"}, exp.Fields)
+	}
 }
@@ -0,0 +1,51 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"net/http"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// JobsHandler impl.
+func JobsHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		jobsHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// jobsHandler returns the schedules and the run history of the jobs.
+func jobsHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(proxy.Spanner().Scheduler().Status())
+}
+
+// RunJobHandler impl.
+func RunJobHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		runJobHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// runJobHandler starts the run of the job now, the run is returned by the jobs api when it's finished.
+func runJobHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	name := r.PathParam("name")
+	log.Warning("api.v1.run[from:%v].job[%s]", r.RemoteAddr, name)
+
+	if err := proxy.Spanner().Scheduler().Run(name); err != nil {
+		log.Error("api.v1.run.job[%s].error:%+v", name, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
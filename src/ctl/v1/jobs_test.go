@@ -0,0 +1,90 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"config"
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1Jobs(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := proxy.MockDefaultConfig()
+	conf.Proxy.Jobs = []*config.JobConfig{
+		{Name: "j1", Schedule: "@daily", User: "mock", Database: "test", Query: "select * from t1"},
+	}
+	fakedbs, proxy, cleanup := proxy.MockProxy1(log, conf)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		fakedbs.AddQuery("select get_lock('radon.job.j1', 0)", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "get_lock", Type: querypb.Type_INT64}},
+			Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1"))}},
+		})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/radon/jobs", JobsHandler(log, proxy)),
+		rest.Post("/v1/radon/jobs/:name/run", RunJobHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Run.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/jobs/j1/run", nil))
+		recorded.CodeIs(200)
+		for proxy.Spanner().Scheduler().Status()[0].Running {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Run not found.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/jobs/xx/run", nil))
+		recorded.CodeIs(500)
+	}
+
+	// Jobs.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/radon/jobs", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.True(t, strings.Contains(got, `"name":"j1","schedule":"@daily"`), got)
+		assert.True(t, strings.Contains(got, `"runs":[{`), got)
+		assert.True(t, strings.Contains(got, `"result":"succeeded"`), got)
+	}
+}
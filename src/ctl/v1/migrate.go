@@ -0,0 +1,70 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"net/http"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// sessionState is the proxy.SessionState, the handlers' proxy argument shadows the package.
+type sessionState = proxy.SessionState
+
+type sessionsExportParams struct {
+	Close bool `json:"close"`
+}
+
+// SessionsExportHandler impl.
+func SessionsExportHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		sessionsExportHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func sessionsExportHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	p := sessionsExportParams{}
+	if r.ContentLength > 0 {
+		if err := r.DecodeJsonPayload(&p); err != nil {
+			log.Error("api.v1.sessions.export.error:%+v", err)
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	states := proxy.Sessions().Export(p.Close)
+	log.Warning("api.v1.sessions.export[from:%v].close[%v].sessions[%d]", r.RemoteAddr, p.Close, len(states))
+	if states == nil {
+		states = []*sessionState{}
+	}
+	w.WriteJson(states)
+}
+
+// SessionsImportHandler impl.
+func SessionsImportHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		sessionsImportHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func sessionsImportHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	var states []*sessionState
+	if err := r.DecodeJsonPayload(&states); err != nil {
+		log.Error("api.v1.sessions.import.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Warning("api.v1.sessions.import[from:%v].sessions[%d]", r.RemoteAddr, len(states))
+	proxy.Sessions().Import(states)
+}
@@ -0,0 +1,88 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"testing"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1SessionsMigrate(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/radon/sessions/export", SessionsExportHandler(log, proxy)),
+		rest.Post("/v1/radon/sessions/import", SessionsImportHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// No sessions.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/sessions/export", nil))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`[]`)
+	}
+
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		client.Close()
+
+		client, err = driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("set wait_timeout = 100", -1)
+		assert.Nil(t, err)
+	}
+
+	// Export and close.
+	{
+		p := &sessionsExportParams{Close: true}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/sessions/export", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`[{"user":"mock","host":"127.0.0.1","db":"test","wait-timeout":100}]`)
+		assert.Equal(t, 0, len(proxy.Sessions().Snapshot()))
+	}
+
+	// Import.
+	{
+		p := []*sessionState{{User: "mock", Host: "127.0.0.1", DB: "test"}}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/sessions/import", p))
+		recorded.CodeIs(200)
+		assert.Equal(t, 1, proxy.Sessions().Migrated())
+	}
+
+	// 500.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/sessions/import", nil))
+		recorded.CodeIs(500)
+	}
+}
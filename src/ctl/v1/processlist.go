@@ -24,15 +24,26 @@ func ProcesslistHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
 }
 
 func processlistHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	// backendConn is the backend connection held by the session.
+	type backendConn struct {
+		Backend  string `json:"backend"`
+		Address  string `json:"address"`
+		ThreadID uint32 `json:"thread-id"`
+		Command  string `json:"command"`
+		Time     int64  `json:"time"`
+		Info     string `json:"info"`
+	}
+
 	type processlist struct {
-		ID      uint32 `json:"id"`
-		User    string `json:"user"`
-		Host    string `json:"host"`
-		DB      string `json:"db"`
-		Command string `json:"command"`
-		Time    uint32 `json:"time"`
-		State   string `json:"state"`
-		Info    string `json:"info"`
+		ID       uint32        `json:"id"`
+		User     string        `json:"user"`
+		Host     string        `json:"host"`
+		DB       string        `json:"db"`
+		Command  string        `json:"command"`
+		Time     uint32        `json:"time"`
+		State    string        `json:"state"`
+		Info     string        `json:"info"`
+		Backends []backendConn `json:"backends,omitempty"`
 	}
 
 	var rsp []processlist
@@ -49,6 +60,20 @@ func processlistHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter
 			State:   sr.State,
 			Info:    sr.Info,
 		}
+		for _, conn := range sr.Backends {
+			command := "Sleep"
+			if conn.Executing {
+				command = "Query"
+			}
+			r.Backends = append(r.Backends, backendConn{
+				Backend:  conn.Backend,
+				Address:  conn.Address,
+				ThreadID: conn.ID,
+				Command:  command,
+				Time:     conn.Time,
+				Info:     conn.Query,
+			})
+		}
 		rsp = append(rsp, r)
 	}
 	w.WriteJson(rsp)
@@ -91,6 +91,7 @@ func TestCtlV1Processlist(t *testing.T) {
 		got := recorded.Recorder.Body.String()
 		log.Debug(got)
 		assert.True(t, strings.Contains(got, "select * from test.t1"))
+		assert.True(t, strings.Contains(got, `"command":"Query","time":0,"info":"select * from test.t1_0000 as t1"`), got)
 	}
 	wg.Wait()
 }
@@ -0,0 +1,110 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"net/http"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// defaultQueryLimit is the default max rows returned by the query api.
+	defaultQueryLimit = 1000
+	// maxQueryLimit is the upper bound of the query api limit.
+	maxQueryLimit = 10000
+)
+
+type queryParams struct {
+	Database string `json:"database"`
+	Query    string `json:"query"`
+	Limit    int    `json:"limit"`
+}
+
+type queryResponse struct {
+	Fields    []string        `json:"fields"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated"`
+}
+
+// QueryHandler impl.
+func QueryHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		queryHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// queryHandler used to execute the read-only query with the basic auth user.
+func queryHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		rest.Error(w, "basic.auth.required", http.StatusUnauthorized)
+		return
+	}
+	if err := spanner.AuthCheckPassword(user, password); err != nil {
+		log.Error("api.v1.query.user[%s].auth.error:%+v", user, err)
+		rest.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	p := queryParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.query.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Query == "" {
+		rest.Error(w, "api.v1.query.request.query.is.empty", http.StatusBadRequest)
+		return
+	}
+	limit := p.Limit
+	if limit <= 0 {
+		limit = defaultQueryLimit
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+
+	// One more row is read to know whether the result is truncated.
+	qr, err := spanner.ExecuteReadOnlyLimit(user, p.Database, p.Query, limit+1)
+	if err != nil {
+		log.Error("api.v1.query[%s].error:%+v", p.Query, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rsp := &queryResponse{
+		Fields: make([]string, 0, len(qr.Fields)),
+		Rows:   make([][]interface{}, 0, len(qr.Rows)),
+	}
+	for _, field := range qr.Fields {
+		rsp.Fields = append(rsp.Fields, field.Name)
+	}
+	for i, row := range qr.Rows {
+		if i >= limit {
+			rsp.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(row))
+		for j, v := range row {
+			if !v.IsNull() {
+				values[j] = v.String()
+			}
+		}
+		rsp.Rows = append(rsp.Rows, values)
+	}
+	w.WriteJson(rsp)
+}
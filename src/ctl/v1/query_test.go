@@ -0,0 +1,143 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"testing"
+
+	"fakedb"
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1Query(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+		client.Close()
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/query", QueryHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Query.
+	{
+		p := &queryParams{
+			Database: "test",
+			Query:    "select * from t1 where id=1",
+		}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/query", p)
+		req.SetBasicAuth("mock", "mock")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(200)
+
+		rsp := &queryResponse{}
+		err := json.Unmarshal(recorded.Recorder.Body.Bytes(), rsp)
+		assert.Nil(t, err)
+		want := &queryResponse{
+			Fields: []string{"id", "name"},
+			Rows: [][]interface{}{
+				{"11", "1nice name"},
+				{"12", nil},
+			},
+		}
+		assert.Equal(t, want, rsp)
+	}
+
+	// Query with limit.
+	{
+		p := &queryParams{
+			Database: "test",
+			Query:    "select * from t1 where id=1",
+			Limit:    1,
+		}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/query", p)
+		req.SetBasicAuth("mock", "mock")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"fields":["id","name"],"rows":[["11","1nice name"]],"truncated":true}`)
+	}
+}
+
+func TestCtlV1QueryError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/query", QueryHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// No auth.
+	{
+		p := &queryParams{Query: "select 1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/query", p))
+		recorded.CodeIs(401)
+	}
+
+	// Auth failed.
+	{
+		p := &queryParams{Query: "select 1"}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/query", p)
+		req.SetBasicAuth("mock", "xx")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(401)
+	}
+
+	// Empty query.
+	{
+		p := &queryParams{}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/query", p)
+		req.SetBasicAuth("mock", "mock")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(400)
+	}
+
+	// Write is denied.
+	{
+		p := &queryParams{Database: "test", Query: "insert into t1(id) values(1)"}
+		req := test.MakeSimpleRequest("POST", "http://localhost/v1/query", p)
+		req.SetBasicAuth("mock", "mock")
+		recorded := test.RunRequest(t, handler, req)
+		recorded.CodeIs(500)
+		recorded.BodyIs(`{"Error":"The MySQL server is running with the --read-only option so it cannot execute this statement (errno 1290) (sqlstate 42000)"}`)
+	}
+}
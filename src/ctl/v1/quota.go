@@ -0,0 +1,72 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// DatabaseUsageHandler impl.
+func DatabaseUsageHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		databaseUsageHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// databaseUsageHandler returns the data size last polled and the quotas of the databases.
+func databaseUsageHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(proxy.Spanner().Quotas().Usages())
+}
+
+type quotaParams struct {
+	Quota int64 `json:"quota"`
+}
+
+// DatabaseQuotaHandler impl.
+func DatabaseQuotaHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		databaseQuotaHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// databaseQuotaHandler sets the quota(in byte) of the database and writes it to the config file, 0 removes the quota.
+func databaseQuotaHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	database := r.PathParam("name")
+	p := quotaParams{}
+	if err := r.DecodeJsonPayload(&p); err != nil {
+		log.Error("api.v1.database[%s].quota.error:%+v", database, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Warning("api.v1.database[%s].quota[from:%v].body:%+v", database, r.RemoteAddr, p)
+
+	if p.Quota < 0 {
+		rest.Error(w, fmt.Sprintf("quota[%d] must not be negative", p.Quota), http.StatusInternalServerError)
+		return
+	}
+	if !proxy.Router().DatabaseExists(database) {
+		rest.Error(w, fmt.Sprintf("database[%s] can not be found", database), http.StatusNotFound)
+		return
+	}
+	proxy.SetDatabaseQuota(database, p.Quota)
+	if err := proxy.FlushConfig(); err != nil {
+		log.Error("api.v1.database[%s].quota.flush.config.error:%+v", database, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(proxy.Spanner().Quotas().Usage(database))
+}
@@ -0,0 +1,88 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"testing"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1DatabaseQuota(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		client.Close()
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/radon/databases/usage", DatabaseUsageHandler(log, proxy)),
+		rest.Put("/v1/radon/databases/:name/quota", DatabaseQuotaHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// 200.
+	{
+		p := &quotaParams{Quota: 1048576}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/databases/test/quota", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"database":"test","data-length":0,"quota":1048576,"exceeded":false}`)
+		assert.Equal(t, map[string]int64{"test": 1048576}, proxy.Config().Proxy.DatabaseQuotas)
+
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/radon/databases/usage", nil))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`[{"database":"test","data-length":0,"quota":1048576,"exceeded":false}]`)
+
+		// Remove the quota.
+		p = &quotaParams{Quota: 0}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/databases/test/quota", p))
+		recorded.CodeIs(200)
+		assert.Equal(t, 0, len(proxy.Config().Proxy.DatabaseQuotas))
+	}
+
+	// 404.
+	{
+		p := &quotaParams{Quota: 1}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/databases/xx/quota", p))
+		recorded.CodeIs(404)
+	}
+
+	// 500.
+	{
+		p := &quotaParams{Quota: -1}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/databases/test/quota", p))
+		recorded.CodeIs(500)
+
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("PUT", "http://localhost/v1/radon/databases/test/quota", nil))
+		recorded.CodeIs(500)
+	}
+}
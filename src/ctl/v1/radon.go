@@ -20,6 +20,7 @@ import (
 type radonParams struct {
 	MaxConnections   *int     `json:"max-connections"`
 	MaxResultSize    *int     `json:"max-result-size"`
+	MaxResultRows    *int     `json:"max-result-rows"`
 	MaxJoinRows      *int     `json:"max-join-rows"`
 	DDLTimeout       *int     `json:"ddl-timeout"`
 	QueryTimeout     *int     `json:"query-timeout"`
@@ -27,6 +28,9 @@ type radonParams struct {
 	AllowIP          []string `json:"allowip,omitempty"`
 	AuditMode        *string  `json:"audit-mode"`
 	StreamBufferSize *int     `json:"stream-buffer-size"`
+
+	AutoAnalyze         *bool `json:"auto-analyze"`
+	AutoAnalyzeInterval *int  `json:"auto-analyze-interval"`
 }
 
 // RadonConfigHandler impl.
@@ -53,6 +57,9 @@ func radonConfigHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter
 	if p.MaxResultSize != nil {
 		proxy.SetMaxResultSize(*p.MaxResultSize)
 	}
+	if p.MaxResultRows != nil {
+		proxy.SetMaxResultRows(*p.MaxResultRows)
+	}
 	if p.MaxJoinRows != nil {
 		proxy.SetMaxJoinRows(*p.MaxJoinRows)
 	}
@@ -72,6 +79,12 @@ func radonConfigHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter
 	if p.StreamBufferSize != nil {
 		proxy.SetStreamBufferSize(*p.StreamBufferSize)
 	}
+	if p.AutoAnalyze != nil {
+		proxy.SetAutoAnalyze(*p.AutoAnalyze)
+	}
+	if p.AutoAnalyzeInterval != nil {
+		proxy.SetAutoAnalyzeInterval(*p.AutoAnalyzeInterval)
+	}
 
 	// reset the allow ip table list.
 	proxy.IPTable().Refresh()
@@ -24,5 +24,5 @@ func SchemazHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
 }
 
 func schemazHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
-	w.WriteJson(proxy.Router().Schemas)
+	w.WriteJson(proxy.Router().Schemas())
 }
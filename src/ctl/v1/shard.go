@@ -267,6 +267,7 @@ func shardRuleShiftHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWri
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	proxy.Spanner().AutoAnalyzeSegment(toBackend, p.Database, p.Table)
 }
 
 // ShardReLoadHandler impl.
@@ -309,10 +310,17 @@ func globalsHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r
 	}
 
 	var globals schemas
-	for _, schema := range router.Schemas {
+	for _, schema := range router.Schemas() {
 		var tables []string
 		for _, tb := range schema.Tables {
-			if tb.TableConfig.ShardType == "GLOBAL" {
+			// The stubs of the lazy mode are loaded by the router.
+			tconf, err := router.TableConfig(schema.DB, tb.Name)
+			if err != nil {
+				log.Error("api.v1.globals.table[%s.%s].error:%v", schema.DB, tb.Name, err)
+				continue
+			}
+			// The view is created on the backends by its DDL, it has no rows to sync.
+			if tconf.ShardType == "GLOBAL" && tconf.View == nil {
 				tables = append(tables, tb.Name)
 			}
 		}
@@ -332,3 +340,45 @@ func globalsHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r
 	}
 	w.WriteJson(globals)
 }
+
+// HotShardsHandler used to get the hot segments report.
+func HotShardsHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		hotShardsHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// hotShardsHandler used to get the segments whose read/write volume exceeds the skew threshold,
+// with the suggested split points.
+func hotShardsHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	scatter := proxy.Scatter()
+	threshold := proxy.Config().Proxy.SkewThreshold
+
+	hots := scatter.Skew().HotShards(threshold, proxy.Router().SegmentTable)
+	if len(hots) == 0 {
+		log.Warning("api.v1.hotshards.return.nil.since.cant.find.the.hot.segments")
+		w.WriteJson(nil)
+		return
+	}
+	w.WriteJson(hots)
+}
+
+// IndexAdviceHandler impl.
+func IndexAdviceHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		indexAdviceHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// indexAdviceHandler used to get the last report of the index advisor job, the job can be run now by the jobs api.
+func indexAdviceHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	report := proxy.Spanner().Advisor().Report()
+	if report == nil {
+		log.Warning("api.v1.indexadvice.return.nil.since.the.advisor.has.never.run")
+		w.WriteJson(nil)
+		return
+	}
+	w.WriteJson(report)
+}
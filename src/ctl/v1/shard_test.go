@@ -9,9 +9,11 @@
 package v1
 
 import (
+	"config"
 	"router"
 	"strings"
 	"testing"
+	"time"
 
 	"proxy"
 
@@ -1275,3 +1277,136 @@ func TestCtlV1Globals(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+func TestCtlV1HotShards(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create database test"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/shard/hotshards", HotShardsHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// no hot shards.
+	{
+		proxy.Scatter().Skew().Reset()
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/shard/hotshards", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.Equal(t, "null", got)
+	}
+
+	// hot shards.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		for i := 0; i < 100; i++ {
+			_, err = client.FetchAll("select * from test.t1 where id=1", -1)
+			assert.Nil(t, err)
+		}
+
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/shard/hotshards", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.True(t, strings.Contains(got, `"Reads":101`))
+		assert.True(t, strings.Contains(got, `"SplitPoint"`))
+	}
+}
+
+func TestCtlV1IndexAdvice(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := proxy.MockDefaultConfig()
+	conf.Proxy.Advisor = &config.AdvisorConfig{Schedule: "@hourly"}
+	fakedbs, proxy, cleanup := proxy.MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show index from .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"select * from test.t1 where b=1",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/shard/indexadvice", IndexAdviceHandler(log, proxy)),
+		rest.Post("/v1/radon/jobs/#name/run", RunJobHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// never run.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/shard/indexadvice", nil))
+		recorded.CodeIs(200)
+		assert.Equal(t, "null", recorded.Recorder.Body.String())
+	}
+
+	// run the job.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/jobs/advisor.index/run", nil))
+		recorded.CodeIs(200)
+		// The job runs in the background.
+		running := func() bool {
+			for _, job := range proxy.Spanner().Scheduler().Status() {
+				if job.Name == "advisor.index" {
+					return job.Running
+				}
+			}
+			return false
+		}
+		for running() {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/shard/indexadvice", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.True(t, strings.Contains(got, `"Statement":"create index `+"`idx_b` on `test`.`t1`(`b`)"+`"`), got)
+		assert.True(t, strings.Contains(got, `"Advice":"shard-key"`), got)
+	}
+}
@@ -0,0 +1,441 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"config"
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+type tableBackupParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Dir      string `json:"dir"`
+}
+
+// TableBackupHandler impl.
+func TableBackupHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableBackupHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func tableBackupHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+	p := tableBackupParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.backup.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" || p.Dir == "" {
+		rest.Error(w, "api.v1.table.backup.request.database.table.dir.are.required", http.StatusBadRequest)
+		return
+	}
+
+	meta, err := spanner.BackupTable(p.Database, p.Table, p.Dir)
+	if err != nil {
+		log.Error("api.v1.table.backup[%+v].error:%+v", p, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(meta)
+}
+
+type tableRestoreParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Dir      string `json:"dir"`
+}
+
+// TableRestoreHandler impl.
+func TableRestoreHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableRestoreHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func tableRestoreHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	type resp struct {
+		Rows int `json:"rows"`
+	}
+	spanner := proxy.Spanner()
+	p := tableRestoreParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.restore.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Dir == "" {
+		rest.Error(w, "api.v1.table.restore.request.dir.is.required", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := spanner.RestoreTable(p.Database, p.Table, p.Dir)
+	if err != nil {
+		log.Error("api.v1.table.restore[%+v].error:%+v", p, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(&resp{Rows: rows})
+}
+
+type tableRenameSegmentsParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Prefix   string `json:"prefix"`
+	Suffix   string `json:"suffix"`
+	Width    int    `json:"width"`
+}
+
+// TableRenameSegmentsHandler impl.
+func TableRenameSegmentsHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableRenameSegmentsHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func tableRenameSegmentsHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+	p := tableRenameSegmentsParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.rename.segments.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" {
+		rest.Error(w, "api.v1.table.rename.segments.request.database.table.are.required", http.StatusBadRequest)
+		return
+	}
+	naming := &config.SegmentNaming{
+		Prefix: p.Prefix,
+		Suffix: p.Suffix,
+		Width:  p.Width,
+	}
+	if err := naming.Validate(); err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renames, err := spanner.RenameSegments(p.Database, p.Table, naming)
+	if err != nil {
+		log.Error("api.v1.table.rename.segments[%+v].error:%+v", p, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(renames)
+}
+
+type tableShardMapParams struct {
+	Database string                  `json:"database"`
+	Table    string                  `json:"table"`
+	Keys     []*config.ShardMapKey   `json:"keys"`
+	Ranges   []*config.ShardMapRange `json:"ranges"`
+}
+
+// TableShardMapHandler impl.
+func TableShardMapHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableShardMapHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func tableShardMapHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	router := proxy.Router()
+	p := tableShardMapParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.shard.map.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" {
+		rest.Error(w, "api.v1.table.shard.map.request.database.table.are.required", http.StatusBadRequest)
+		return
+	}
+
+	// The empty keys and ranges clear the shard map.
+	var shardMap *config.ShardMapConfig
+	if len(p.Keys) > 0 || len(p.Ranges) > 0 {
+		shardMap = &config.ShardMapConfig{Keys: p.Keys, Ranges: p.Ranges}
+	}
+	log.Warning("api.v1.table.shard.map[%s.%s].keys[%d].ranges[%d]", p.Database, p.Table, len(p.Keys), len(p.Ranges))
+	if err := router.SetShardMap(p.Database, p.Table, shardMap); err != nil {
+		log.Error("api.v1.table.shard.map[%s.%s].error:%+v", p.Database, p.Table, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type tableKeyNormalizationParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// Limit is the max keys to move returned, 100 if not set.
+	Limit int `json:"limit"`
+	// Canonicalize switches the table to the canonical key normalization if no keys move.
+	Canonicalize bool `json:"canonicalize"`
+}
+
+// TableKeyNormalizationHandler impl.
+func TableKeyNormalizationHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableKeyNormalizationHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func tableKeyNormalizationHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+	router := proxy.Router()
+	p := tableKeyNormalizationParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.key.normalization.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" {
+		rest.Error(w, "api.v1.table.key.normalization.request.database.table.are.required", http.StatusBadRequest)
+		return
+	}
+	if p.Limit <= 0 {
+		p.Limit = 100
+	}
+
+	check, err := spanner.CheckShardKeys(p.Database, p.Table, p.Limit)
+	if err != nil {
+		log.Error("api.v1.table.key.normalization[%s.%s].check.error:%+v", p.Database, p.Table, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Canonicalize && check.KeyNormalization != "" {
+		if len(check.Moves) > 0 {
+			rest.Error(w, fmt.Sprintf("api.v1.table.key.normalization[%s.%s].keys.must.be.moved.first", p.Database, p.Table), http.StatusBadRequest)
+			return
+		}
+		log.Warning("api.v1.table.key.normalization[%s.%s].canonicalize.keys[%d]", p.Database, p.Table, check.Keys)
+		if err := router.SetKeyNormalization(p.Database, p.Table, ""); err != nil {
+			log.Error("api.v1.table.key.normalization[%s.%s].error:%+v", p.Database, p.Table, err)
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		check.KeyNormalization = ""
+	}
+	w.WriteJson(check)
+}
+
+type tableLookupParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Column   string `json:"column"`
+	// LookupTable is the HASH table partitioned by the column, empty drops the lookup of the column.
+	LookupTable string `json:"lookup-table"`
+}
+
+// TableLookupHandler impl.
+func TableLookupHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableLookupHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// tableLookupHandler used to add the lookup table of the column to the table and backfill it, or drop the lookup.
+func tableLookupHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	type resp struct {
+		Rows uint64 `json:"rows"`
+	}
+	spanner := proxy.Spanner()
+	router := proxy.Router()
+	p := tableLookupParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.lookup.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" || p.Column == "" {
+		rest.Error(w, "api.v1.table.lookup.request.database.table.column.are.required", http.StatusBadRequest)
+		return
+	}
+
+	if p.LookupTable == "" {
+		log.Warning("api.v1.table.lookup[%s.%s].drop.column[%s]", p.Database, p.Table, p.Column)
+		if err := router.DropLookup(p.Database, p.Table, p.Column); err != nil {
+			log.Error("api.v1.table.lookup[%s.%s].drop.error:%+v", p.Database, p.Table, err)
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteJson(&resp{})
+		return
+	}
+	log.Warning("api.v1.table.lookup[%s.%s].add.column[%s].table[%s]", p.Database, p.Table, p.Column, p.LookupTable)
+	rows, err := spanner.AddLookup(p.Database, p.Table, p.Column, p.LookupTable)
+	if err != nil {
+		log.Error("api.v1.table.lookup[%s.%s].add.error:%+v", p.Database, p.Table, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(&resp{Rows: rows})
+}
+
+type tableLookupCheckParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Column   string `json:"column"`
+	// Limit is the max missing and orphans returned, 100 if it's zero.
+	Limit  int  `json:"limit"`
+	Repair bool `json:"repair"`
+}
+
+// TableLookupCheckHandler impl.
+func TableLookupCheckHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableLookupCheckHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// tableLookupCheckHandler used to check the lookup table of the column against the table, and repair it if asked.
+func tableLookupCheckHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+	p := tableLookupCheckParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.lookupcheck.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" || p.Column == "" {
+		rest.Error(w, "api.v1.table.lookupcheck.request.database.table.column.are.required", http.StatusBadRequest)
+		return
+	}
+	if p.Limit <= 0 {
+		p.Limit = 100
+	}
+
+	if p.Repair {
+		log.Warning("api.v1.table.lookupcheck[%s.%s].repair.column[%s]", p.Database, p.Table, p.Column)
+	}
+	check, err := spanner.CheckLookup(p.Database, p.Table, p.Column, p.Limit, p.Repair)
+	if err != nil {
+		log.Error("api.v1.table.lookupcheck[%s.%s].error:%+v", p.Database, p.Table, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(check)
+}
+
+type tableMoveSingleParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// ToBackend is the name of the backend the SINGLE table moved to.
+	ToBackend string `json:"to-backend"`
+}
+
+// TableMoveSingleHandler impl.
+func TableMoveSingleHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableMoveSingleHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// tableMoveSingleHandler used to move the SINGLE table with its rows to another backend.
+func tableMoveSingleHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+	p := tableMoveSingleParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.move.single.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" || p.ToBackend == "" {
+		rest.Error(w, "api.v1.table.move.single.request.database.table.to-backend.are.required", http.StatusBadRequest)
+		return
+	}
+
+	log.Warning("api.v1.table.move.single[%s.%s].to[%s].from[%v]", p.Database, p.Table, p.ToBackend, r.RemoteAddr)
+	move, err := spanner.MoveSingleTable(p.Database, p.Table, p.ToBackend)
+	if err != nil {
+		log.Error("api.v1.table.move.single[%s.%s].error:%+v", p.Database, p.Table, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(move)
+}
+
+type tableReshardParams struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// ShardKey is the new shard key, the shard key is kept if it's empty.
+	ShardKey string `json:"shard-key"`
+	// Partitions is the new segments number, the segments number is kept if it's 0.
+	Partitions int `json:"partitions"`
+}
+
+// TableReshardHandler impl.
+func TableReshardHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableReshardHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// tableReshardHandler used to start the resharding of the table in the background, it returns the status of the resharding.
+func tableReshardHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	spanner := proxy.Spanner()
+	p := tableReshardParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.table.reshard.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if p.Database == "" || p.Table == "" || (p.ShardKey == "" && p.Partitions == 0) {
+		rest.Error(w, "api.v1.table.reshard.request.database.table.and.shard-key.or.partitions.are.required", http.StatusBadRequest)
+		return
+	}
+
+	log.Warning("api.v1.table.reshard[%s.%s].shard.key[%s].partitions[%d].from[%v]", p.Database, p.Table, p.ShardKey, p.Partitions, r.RemoteAddr)
+	status, err := spanner.Reshard(p.Database, p.Table, p.ShardKey, p.Partitions)
+	if err != nil {
+		log.Error("api.v1.table.reshard[%s.%s].error:%+v", p.Database, p.Table, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(status)
+}
+
+// TableReshardzHandler impl.
+func TableReshardzHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		tableReshardzHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// tableReshardzHandler returns the progress of the reshardings since the radon started.
+func tableReshardzHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(proxy.Spanner().Reshards().Statuses())
+}
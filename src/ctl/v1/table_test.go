@@ -0,0 +1,654 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1TableBackupRestore(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	dir := fakedb.GetTmpDir("", "radon_backup_", log)
+	defer os.RemoveAll(dir)
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQuery("start transaction with consistent snapshot", &sqltypes.Result{})
+		fakedbs.AddQuery("commit", &sqltypes.Result{})
+		fakedbs.AddQuery("show master status", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select \\* from .*", fakedb.Result1)
+		fakedbs.AddQueryPattern("insert into .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) single", -1)
+		assert.Nil(t, err)
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/backup", TableBackupHandler(log, proxy)),
+		rest.Post("/v1/table/restore", TableRestoreHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// backup.
+	{
+		p := &tableBackupParams{Database: "test", Table: "t1", Dir: dir}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/backup", p))
+		recorded.CodeIs(200)
+	}
+
+	// restore.
+	{
+		p := &tableRestoreParams{Dir: dir}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/restore", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"rows":1}`)
+	}
+}
+
+func TestCtlV1TableBackupRestoreError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/backup", TableBackupHandler(log, proxy)),
+		rest.Post("/v1/table/restore", TableRestoreHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// decode error.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/backup", nil))
+		recorded.CodeIs(500)
+	}
+
+	// 400.
+	{
+		p := &tableBackupParams{Database: "test", Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/backup", p))
+		recorded.CodeIs(400)
+
+		p1 := &tableRestoreParams{Database: "test", Table: "t1"}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/restore", p1))
+		recorded.CodeIs(400)
+	}
+
+	// 500.
+	{
+		p := &tableBackupParams{Database: "test", Table: "t1", Dir: "/tmp/radon_backup_none"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/backup", p))
+		recorded.CodeIs(500)
+
+		p1 := &tableRestoreParams{Dir: "/tmp/radon_backup_none"}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/restore", p1))
+		recorded.CodeIs(500)
+	}
+}
+
+func TestCtlV1TableRenameSegments(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rename table .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/renamesegments", TableRenameSegmentsHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// rename.
+	{
+		p := &tableRenameSegmentsParams{Database: "test", Table: "t1", Prefix: "_p", Width: 3}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/renamesegments", p))
+		recorded.CodeIs(200)
+		assert.True(t, strings.HasPrefix(recorded.Recorder.Body.String(), `[{"backend":"backend0","from":"t1_0000","to":"t1_p000"},`))
+	}
+
+	// bad request.
+	{
+		params := []*tableRenameSegmentsParams{
+			{Table: "t1", Prefix: "_p", Width: 3},
+			{Database: "test", Table: "t1", Width: 3},
+		}
+		for _, p := range params {
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/renamesegments", p))
+			recorded.CodeIs(400)
+		}
+	}
+
+	// table not exists.
+	{
+		p := &tableRenameSegmentsParams{Database: "test", Table: "t2", Prefix: "_p", Width: 3}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/renamesegments", p))
+		recorded.CodeIs(500)
+	}
+}
+
+func TestCtlV1TableShardMap(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/shardmap", TableShardMapHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// set.
+	{
+		p := &tableShardMapParams{
+			Database: "test",
+			Table:    "t1",
+			Keys:     []*config.ShardMapKey{{Key: "1", Segment: "t1_0029"}},
+			Ranges:   []*config.ShardMapRange{{Start: 100, End: 200, Segment: "t1_0000"}},
+		}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/shardmap", p))
+		recorded.CodeIs(200)
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, &config.ShardMapConfig{Keys: p.Keys, Ranges: p.Ranges}, tconf.ShardMap)
+	}
+
+	// clear.
+	{
+		p := &tableShardMapParams{Database: "test", Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/shardmap", p))
+		recorded.CodeIs(200)
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Nil(t, tconf.ShardMap)
+	}
+
+	// bad request.
+	{
+		p := &tableShardMapParams{Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/shardmap", p))
+		recorded.CodeIs(400)
+	}
+
+	// segment not exists.
+	{
+		p := &tableShardMapParams{Database: "test", Table: "t1", Keys: []*config.ShardMapKey{{Key: "1", Segment: "t9"}}}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/shardmap", p))
+		recorded.CodeIs(500)
+		recorded.BodyIs(`{"Error":"hash.shard.map.key[1].segment[t9].not.found"}`)
+	}
+}
+
+func TestCtlV1TableKeyNormalization(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select distinct .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+		err = proxy.Router().SetKeyNormalization("test", "t1", config.KeyNormalizationLegacy)
+		assert.Nil(t, err)
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/keynormalization", TableKeyNormalizationHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// check.
+	{
+		p := &tableKeyNormalizationParams{Database: "test", Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/keynormalization", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"database":"test","table":"t1","key-normalization":"legacy","keys":0,"moves":[],"truncated":false}`)
+	}
+
+	// canonicalize.
+	{
+		p := &tableKeyNormalizationParams{Database: "test", Table: "t1", Canonicalize: true}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/keynormalization", p))
+		recorded.CodeIs(200)
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "", tconf.KeyNormalization)
+	}
+
+	// bad request.
+	{
+		p := &tableKeyNormalizationParams{Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/keynormalization", p))
+		recorded.CodeIs(400)
+	}
+
+	// table not exists.
+	{
+		p := &tableKeyNormalizationParams{Database: "test", Table: "t9"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/keynormalization", p))
+		recorded.CodeIs(500)
+	}
+}
+
+func TestCtlV1TableLookup(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, a int) partition by hash(id)",
+			"create table test.t1_a(a int, id int) partition by hash(a)",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/lookup", TableLookupHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// add.
+	{
+		p := &tableLookupParams{Database: "test", Table: "t1", Column: "a", LookupTable: "t1_a"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookup", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"rows":0}`)
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(tconf.Lookups))
+	}
+
+	// add again.
+	{
+		p := &tableLookupParams{Database: "test", Table: "t1", Column: "a", LookupTable: "t1_a"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookup", p))
+		recorded.CodeIs(500)
+	}
+
+	// drop.
+	{
+		p := &tableLookupParams{Database: "test", Table: "t1", Column: "a"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookup", p))
+		recorded.CodeIs(200)
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(tconf.Lookups))
+	}
+
+	// drop again.
+	{
+		p := &tableLookupParams{Database: "test", Table: "t1", Column: "a"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookup", p))
+		recorded.CodeIs(500)
+	}
+
+	// bad request.
+	{
+		p := &tableLookupParams{Database: "test", Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookup", p))
+		recorded.CodeIs(400)
+	}
+}
+
+func TestCtlV1TableLookupCheck(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.t1(id int, a int) partition by hash(id)",
+			"create table test.t1_a(a int, id int) partition by hash(a)",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+		_, err = proxy.Spanner().AddLookup("test", "t1", "a", "t1_a")
+		assert.Nil(t, err)
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/lookupcheck", TableLookupCheckHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// check.
+	{
+		p := &tableLookupCheckParams{Database: "test", Table: "t1", Column: "a", Repair: true}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookupcheck", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"database":"test","table":"t1","column":"a","lookup-table":"t1_a","rows":0,"missing":[],"orphans":[],"truncated":false,"repaired":0}`)
+	}
+
+	// no lookup.
+	{
+		p := &tableLookupCheckParams{Database: "test", Table: "t1", Column: "id"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookupcheck", p))
+		recorded.CodeIs(500)
+	}
+
+	// bad request.
+	{
+		p := &tableLookupCheckParams{Database: "test", Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/lookupcheck", p))
+		recorded.CodeIs(400)
+	}
+}
+
+func TestCtlV1TableMoveSingle(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create table .*", &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "Table", Type: querypb.Type_VARCHAR},
+				{Name: "Create Table", Type: querypb.Type_VARCHAR},
+			},
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("s1")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `s1` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB")),
+				},
+			},
+		})
+		fakedbs.AddQueryPattern("select \\* from .*", fakedb.Result1)
+		fakedbs.AddQueryPattern("insert into .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.s1(id int, b int) single on 'backend1'", -1)
+		assert.Nil(t, err)
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/movesingle", TableMoveSingleHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// move.
+	{
+		p := &tableMoveSingleParams{Database: "test", Table: "s1", ToBackend: "backend2"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/movesingle", p))
+		recorded.CodeIs(200)
+		assert.Equal(t, `{"database":"test","table":"s1","from":"backend1","to":"backend2","rows":2}`, recorded.Recorder.Body.String())
+		tconf, err := proxy.Router().TableConfig("test", "s1")
+		assert.Nil(t, err)
+		assert.Equal(t, "backend2", tconf.Partitions[0].Backend)
+	}
+
+	// bad request.
+	{
+		p := &tableMoveSingleParams{Database: "test", Table: "s1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/movesingle", p))
+		recorded.CodeIs(400)
+	}
+
+	// backend not exists.
+	{
+		p := &tableMoveSingleParams{Database: "test", Table: "s1", ToBackend: "backend9"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/movesingle", p))
+		recorded.CodeIs(500)
+	}
+}
+
+func TestCtlV1TableReshard(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show columns from .*", &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "Field", Type: querypb.Type_VARCHAR},
+				{Name: "Type", Type: querypb.Type_VARCHAR},
+			},
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("int(11)")),
+				},
+			},
+		})
+		fakedbs.AddQueryPattern("show keys from .*", &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "Table", Type: querypb.Type_VARCHAR},
+				{Name: "Non_unique", Type: querypb.Type_INT64},
+				{Name: "Key_name", Type: querypb.Type_VARCHAR},
+				{Name: "Seq_in_index", Type: querypb.Type_INT64},
+				{Name: "Column_name", Type: querypb.Type_VARCHAR},
+			},
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+					sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("PRIMARY")),
+					sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")),
+				},
+			},
+		})
+		fakedbs.AddQueryPattern("show create table .*", &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "Table", Type: querypb.Type_VARCHAR},
+				{Name: "Create Table", Type: querypb.Type_VARCHAR},
+			},
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `t1_0000` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB")),
+				},
+			},
+		})
+		fakedbs.AddQueryPattern("select \\* from .* for update", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select count\\(\\*\\) from .*", &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "count(*)", Type: querypb.Type_INT64},
+			},
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0"))},
+			},
+		})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	// server
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/table/reshard", TableReshardHandler(log, proxy)),
+		rest.Get("/v1/table/reshardz", TableReshardzHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// reshard.
+	{
+		p := &tableReshardParams{Database: "test", Table: "t1", Partitions: 10}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/reshard", p))
+		recorded.CodeIs(200)
+		assert.True(t, strings.Contains(recorded.Recorder.Body.String(), `"shadow":"t1_reshard"`))
+
+		for i := 0; i < 500; i++ {
+			if statuses := proxy.Spanner().Reshards().Statuses(); statuses[0].State == "done" || statuses[0].State == "failed" {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/table/reshardz", nil))
+		recorded.CodeIs(200)
+		assert.True(t, strings.Contains(recorded.Recorder.Body.String(), `"state":"done"`), recorded.Recorder.Body.String())
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(tconf.Partitions))
+	}
+
+	// bad request.
+	{
+		p := &tableReshardParams{Database: "test", Table: "t1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/reshard", p))
+		recorded.CodeIs(400)
+	}
+
+	// layout unchanged.
+	{
+		p := &tableReshardParams{Database: "test", Table: "t1", Partitions: 10}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/table/reshard", p))
+		recorded.CodeIs(500)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"net/http"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// WatermarksHandler impl.
+func WatermarksHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		watermarksHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// watermarksHandler returns the recent GTID watermarks, the oldest first.
+func watermarksHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(proxy.Scatter().Watermarks().Recent())
+}
+
+// CaptureWatermarkHandler impl.
+func CaptureWatermarkHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		captureWatermarkHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+// captureWatermarkHandler captures the GTID watermark of the backends now and returns it.
+func captureWatermarkHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	log.Warning("api.v1.capture.watermark[from:%v]", r.RemoteAddr)
+	watermark, err := proxy.Scatter().CaptureWatermark()
+	if err != nil {
+		log.Error("api.v1.capture.watermark.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(watermark)
+}
@@ -0,0 +1,66 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package v1
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"proxy"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCtlV1Watermarks(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/radon/watermarks", WatermarksHandler(log, proxy)),
+		rest.Post("/v1/radon/watermarks", CaptureWatermarkHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// Capture error.
+	{
+		fakedbs.AddQueryError("SELECT @@GLOBAL.gtid_executed", errors.New("mock.gtid.error"))
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/watermarks", nil))
+		recorded.CodeIs(500)
+	}
+
+	// Capture.
+	{
+		fakedbs.AddQuery("SELECT @@GLOBAL.gtid_executed", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "gtid", Type: querypb.Type_VARCHAR}},
+			Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("uuid:1-10"))}},
+		})
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/radon/watermarks", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.True(t, strings.Contains(got, `"id":1`), got)
+		assert.True(t, strings.Contains(got, `"uuid:1-10"`), got)
+	}
+
+	// List.
+	{
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/radon/watermarks", nil))
+		recorded.CodeIs(200)
+		got := recorded.Recorder.Body.String()
+		assert.True(t, strings.HasPrefix(got, `[{"id":1,`), got)
+	}
+}
@@ -9,10 +9,17 @@
 package executor
 
 import (
+	"regexp"
+	"strings"
+
 	"backend"
 	"planner"
 	"xcontext"
 
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -20,6 +27,35 @@ var (
 	_ Executor = &DDLExecutor{}
 )
 
+// erDBDropExists is the MySQL error of dropping the database doesn't exist, it isn't defined by the sqldb.
+const erDBDropExists = 1008
+
+// ddlAppliedErrors is the backend errors which mean the DDL has already been applied on the segment,
+// such as the segments created by the last partially failed CREATE TABLE.
+var ddlAppliedErrors = map[string]uint16{
+	sqlparser.CreateDBStr:        sqldb.ER_DB_CREATE_EXISTS,
+	sqlparser.DropDBStr:          erDBDropExists,
+	sqlparser.CreateTableStr:     sqldb.ER_TABLE_EXISTS_ERROR,
+	sqlparser.DropTableStr:       sqldb.ER_BAD_TABLE_ERROR,
+	sqlparser.CreateIndexStr:     sqldb.ER_DUP_KEYNAME,
+	sqlparser.DropIndexStr:       sqldb.ER_CANT_DROP_FIELD_OR_KEY,
+	sqlparser.AlterAddColumnStr:  sqldb.ER_DUP_FIELDNAME,
+	sqlparser.AlterDropColumnStr: sqldb.ER_CANT_DROP_FIELD_OR_KEY,
+}
+
+// createSegmentRegexp used to get the segment table and the LIKE source segment from the CREATE TABLE query of the segment.
+var createSegmentRegexp = regexp.MustCompile("(?is)^create\\s+table\\s+(?:if\\s+not\\s+exists\\s+)?((?:`(?:[^`]|``)+`|\\w+)(?:\\.(?:`(?:[^`]|``)+`|\\w+))?)(?:\\s+like\\s+((?:`(?:[^`]|``)+`|\\w+)(?:\\.(?:`(?:[^`]|``)+`|\\w+))?))?")
+
+// DDLApplied returns true if the error of the DDL action on a segment means the DDL has already been applied on it.
+func DDLApplied(action string, err error) bool {
+	applied, ok := ddlAppliedErrors[action]
+	if !ok {
+		return false
+	}
+	sqlErr, ok := err.(*sqldb.SQLError)
+	return ok && sqlErr.Num == applied
+}
+
 // DDLExecutor represents a CREATE, ALTER, DROP executor
 type DDLExecutor struct {
 	log  *xlog.Log
@@ -40,14 +76,126 @@ func NewDDLExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction) *
 func (executor *DDLExecutor) Execute(ctx *xcontext.ResultContext) error {
 	plan := executor.plan.(*planner.DDLPlan)
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.PlanType = xcontext.PlanDDL
 
 	res, err := executor.txn.Execute(reqCtx)
 	if err != nil {
-		return err
+		// Only the scatter failed as 'already applied' is converged, the other errors are returned as they are.
+		if !DDLApplied(plan.Action(), err) || plan.ReqMode != xcontext.ReqNormal {
+			return err
+		}
+		if res, err = executor.converge(ctx, plan); err != nil {
+			return err
+		}
 	}
 	ctx.Results = res
 	return nil
 }
+
+// converge used to execute the DDL segment by segment after the scatter failed,
+// the segments which the DDL has been applied on are skipped, so re-running a partially failed DDL is idempotent.
+// The existing segment of the CREATE TABLE is skipped only if it has the same columns as the DDL.
+// The DDL is converged if all the segments are applied, the Warnings of the result is the number of the skipped ones.
+func (executor *DDLExecutor) converge(ctx *xcontext.ResultContext, plan *planner.DDLPlan) (*sqltypes.Result, error) {
+	log := executor.log
+	applied := ddlAppliedErrors[plan.Action()]
+
+	var errs []error
+	skipped := 0
+	qr := &sqltypes.Result{}
+	for _, tuple := range plan.Querys {
+		reqCtx := xcontext.NewRequestContext()
+		reqCtx.Ctx = ctx.Context()
+		reqCtx.Mode = xcontext.ReqNormal
+		reqCtx.Querys = []xcontext.QueryTuple{tuple}
+		reqCtx.RawQuery = plan.RawQuery
+		reqCtx.PlanType = xcontext.PlanDDL
+
+		res, err := executor.txn.Execute(reqCtx)
+		if err != nil {
+			if sqlErr, ok := err.(*sqldb.SQLError); ok && sqlErr.Num == applied {
+				if plan.Action() == sqlparser.CreateTableStr {
+					if err := executor.verifyTable(ctx, plan, tuple); err != nil {
+						log.Error("executor.ddl.segment[%s@%s].verify.error:%v", tuple.Query, tuple.Backend, err)
+						errs = append(errs, err)
+						continue
+					}
+				}
+				log.Warning("executor.ddl.segment[%s@%s].already.applied:%v", tuple.Query, tuple.Backend, err)
+				skipped++
+				continue
+			}
+			log.Error("executor.ddl.segment[%s@%s].error:%v", tuple.Query, tuple.Backend, err)
+			errs = append(errs, err)
+			continue
+		}
+		qr.AppendResult(res)
+	}
+	if len(errs) > 0 {
+		log.Error("executor.ddl[%s].not.converged.segments[%d].failed[%d].skipped[%d]", plan.RawQuery, len(plan.Querys), len(errs), skipped)
+		return nil, errs[0]
+	}
+	log.Warning("executor.ddl[%s].converged.segments[%d].skipped[%d]", plan.RawQuery, len(plan.Querys), skipped)
+	qr.Warnings = uint16(skipped)
+	return qr, nil
+}
+
+// verifyTable used to check the existing segment has the same columns as the CREATE TABLE would create,
+// the columns of the CREATE TABLE ... LIKE are the ones of the source segment on the same backend.
+func (executor *DDLExecutor) verifyTable(ctx *xcontext.ResultContext, plan *planner.DDLPlan, tuple xcontext.QueryTuple) error {
+	var err error
+
+	m := createSegmentRegexp.FindStringSubmatch(tuple.Query)
+	if m == nil {
+		return errors.Errorf("executor.ddl.segment[%s@%s].can.not.be.verified", tuple.Query, tuple.Backend)
+	}
+	want := plan.Columns()
+	if m[2] != "" {
+		if want, err = executor.columns(ctx, tuple.Backend, m[2]); err != nil {
+			return err
+		}
+	}
+	if len(want) == 0 {
+		return errors.Errorf("executor.ddl.segment[%s@%s].can.not.be.verified", tuple.Query, tuple.Backend)
+	}
+	got, err := executor.columns(ctx, tuple.Backend, m[1])
+	if err != nil {
+		return err
+	}
+
+	same := len(got) == len(want)
+	for i := 0; same && i < len(want); i++ {
+		same = strings.EqualFold(got[i], want[i])
+	}
+	if !same {
+		return errors.Errorf("executor.ddl.segment[%s@%s].exists.with.the.different.columns[%s].want[%s]",
+			m[1], tuple.Backend, strings.Join(got, ","), strings.Join(want, ","))
+	}
+	return nil
+}
+
+// columns returns the column names of the segment table on the backend in order.
+func (executor *DDLExecutor) columns(ctx *xcontext.ResultContext, backend string, table string) ([]string, error) {
+	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
+	reqCtx.Mode = xcontext.ReqNormal
+	reqCtx.Querys = []xcontext.QueryTuple{{
+		Query:   "show columns from " + table,
+		Backend: backend,
+	}}
+	reqCtx.RawQuery = reqCtx.Querys[0].Query
+
+	res, err := executor.txn.Execute(reqCtx)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		columns = append(columns, row[0].String())
+	}
+	return columns, nil
+}
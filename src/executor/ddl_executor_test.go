@@ -9,6 +9,7 @@
 package executor
 
 import (
+	"errors"
 	"testing"
 
 	"backend"
@@ -18,7 +19,10 @@ import (
 	"xcontext"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -80,3 +84,106 @@ func TestDDLExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestDDLExecutorConverge(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	execute := func(query string, prepare func(plan *planner.DDLPlan)) (*xcontext.ResultContext, error) {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewDDLPlan(log, database, query, node.(*sqlparser.DDL), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		prepare(plan)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		ctx := xcontext.NewResultContext()
+		err = NewDDLExecutor(log, plan, txn).Execute(ctx)
+		return ctx, err
+	}
+
+	// columns returns the SHOW COLUMNS result of the segment.
+	columns := func(names ...string) *sqltypes.Result {
+		qr := &sqltypes.Result{Fields: []*querypb.Field{{Name: "Field", Type: querypb.Type_VARCHAR}}}
+		for _, name := range names {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(name))})
+		}
+		return qr
+	}
+
+	// The segments created by the last failed CREATE TABLE are skipped.
+	{
+		ctx, err := execute("create table A(a int)", func(plan *planner.DDLPlan) {
+			fakedbs.ResetAll()
+			fakedbs.AddQueryPattern("create table .*", fakedb.Result3)
+			fakedbs.AddQueryPattern("show columns from .*", columns("a"))
+			fakedbs.AddQueryError(plan.Querys[0].Query, sqldb.NewSQLError1(sqldb.ER_TABLE_EXISTS_ERROR, "42S01", "Table 'A0' already exists"))
+			fakedbs.AddQueryError(plan.Querys[2].Query, sqldb.NewSQLError1(sqldb.ER_TABLE_EXISTS_ERROR, "42S01", "Table 'A4' already exists"))
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(2), ctx.Results.Warnings)
+	}
+
+	// The existing segment with the different columns isn't skipped.
+	{
+		var other string
+		_, err := execute("create table A(a int)", func(plan *planner.DDLPlan) {
+			other = plan.Querys[2].Query
+			fakedbs.ResetAll()
+			fakedbs.AddQuery(other, fakedb.Result3)
+			fakedbs.AddQueryPattern("create table .*", fakedb.Result3)
+			fakedbs.AddQueryPattern("show columns from .*", columns("a", "b"))
+			fakedbs.AddQueryError(plan.Querys[0].Query, sqldb.NewSQLError1(sqldb.ER_TABLE_EXISTS_ERROR, "42S01", "Table 'A0' already exists"))
+		})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "exists.with.the.different.columns[a,b].want[a]")
+		// Once in the scatter, once in the converge.
+		assert.Equal(t, 2, fakedbs.GetQueryCalledNum(other))
+	}
+
+	// The segments indexed by the last failed CREATE INDEX are skipped.
+	{
+		ctx, err := execute("create index idx_a on A(a)", func(plan *planner.DDLPlan) {
+			fakedbs.ResetAll()
+			fakedbs.AddQueryPattern("create index .*", fakedb.Result3)
+			fakedbs.AddQueryError(plan.Querys[1].Query, sqldb.NewSQLError1(sqldb.ER_DUP_KEYNAME, "42000", "Duplicate key name 'idx_a'"))
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(1), ctx.Results.Warnings)
+	}
+
+	// The scatter failed not as 'already applied' is not converged.
+	{
+		var other string
+		_, err := execute("create table A(a int)", func(plan *planner.DDLPlan) {
+			other = plan.Querys[2].Query
+			fakedbs.ResetAll()
+			fakedbs.AddQuery(other, fakedb.Result3)
+			fakedbs.AddQueryPattern("create table .*", fakedb.Result3)
+			fakedbs.AddQueryError(plan.Querys[1].Query, errors.New("mock.create.error"))
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(other))
+	}
+
+	// The action without the applied errors is not converged.
+	{
+		_, err := execute("alter table A engine=tokudb", func(plan *planner.DDLPlan) {
+			fakedbs.ResetAll()
+			fakedbs.AddQueryPattern("alter table .*", fakedb.Result3)
+			fakedbs.AddQueryError(plan.Querys[0].Query, sqldb.NewSQLError1(sqldb.ER_TABLE_EXISTS_ERROR, "42S01", "mock"))
+		})
+		assert.NotNil(t, err)
+	}
+}
@@ -39,11 +39,19 @@ func NewDeleteExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction
 // Execute used to execute the executor.
 func (executor *DeleteExecutor) Execute(ctx *xcontext.ResultContext) error {
 	plan := executor.plan.(*planner.DeletePlan)
+	if plan.Scatter && !plan.Force() {
+		if err := checkDMLRows(ctx, executor.txn, plan.CountQuerys); err != nil {
+			return err
+		}
+	}
+
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.TxnMode = xcontext.TxnWrite
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.PlanType = xcontext.PlanDelete
 
 	rs, err := executor.txn.Execute(reqCtx)
 	if err != nil {
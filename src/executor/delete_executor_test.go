@@ -18,6 +18,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -64,3 +66,50 @@ func TestDeleteExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestDeleteExecutorMaxDMLRows(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	count := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "count(*)", Type: querypb.Type_INT64}},
+		Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_INT64, []byte("3"))}},
+	}
+	fakedbs.AddQueryPattern("delete from sbtest..*", fakedb.Result3)
+	fakedbs.AddQueryPattern("select count.*", count)
+
+	execute := func(query string, max int) error {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		txn.SetMaxDMLRows(max)
+		return NewDeleteExecutor(log, plan, txn).Execute(xcontext.NewResultContext())
+	}
+
+	// The rows of all the segments exceed the max.
+	err = execute("delete from sbtest.A where name='xx'", 10)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Query execution was interrupted, the DML matches 12 rows more than max dml rows[10]")
+
+	// No limits, forced and routed by the shard key.
+	assert.Nil(t, execute("delete from sbtest.A where name='xx'", 0))
+	assert.Nil(t, execute("delete /*+ radon_force_dml */ from sbtest.A where name='xx'", 10))
+	assert.Nil(t, execute("delete from sbtest.A where name='xx'", 12))
+	assert.Nil(t, execute("delete from sbtest.A where id=1", 1))
+}
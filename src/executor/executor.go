@@ -9,8 +9,12 @@
 package executor
 
 import (
+	"context"
+	"strconv"
+
 	"backend"
 	"planner"
+	"xbase"
 	"xcontext"
 
 	"github.com/pkg/errors"
@@ -49,6 +53,11 @@ func (et *Tree) Add(executor Executor) error {
 
 // Execute executes all Executor.Execute
 func (et *Tree) Execute() (*sqltypes.Result, error) {
+	return et.ExecuteContext(context.Background())
+}
+
+// ExecuteContext executes all Executor.Execute, the executors stop once the ctx is done.
+func (et *Tree) ExecuteContext(ctx context.Context) (*sqltypes.Result, error) {
 	// build tree
 	for _, plan := range et.planTree.Plans() {
 		switch plan.Type() {
@@ -94,10 +103,59 @@ func (et *Tree) Execute() (*sqltypes.Result, error) {
 
 	// execute all
 	rsCtx := xcontext.NewResultContext()
+	rsCtx.Ctx = ctx
 	for _, executor := range et.children {
+		if err := xbase.NewContextError(ctx); err != nil {
+			return nil, err
+		}
 		if err := executor.Execute(rsCtx); err != nil {
 			return nil, err
 		}
 	}
+	if err := checkResultRows(et.txn, rsCtx.Results); err != nil {
+		return nil, err
+	}
 	return rsCtx.Results, nil
 }
+
+// checkResultRows used to check the rows of the final result returned to the client,
+// the result is rejected if the rows exceed the txn max result rows.
+func checkResultRows(txn backend.Transaction, qr *sqltypes.Result) error {
+	max := txn.MaxResultRows()
+	if max <= 0 || qr == nil || len(qr.Rows) <= max {
+		return nil
+	}
+	return xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, max result rows[%d] exceeded", max)
+}
+
+// checkDMLRows used to count the rows matched by the scatter DML before it's executed,
+// the DML is rejected if the rows exceed the txn max dml rows.
+func checkDMLRows(ctx *xcontext.ResultContext, txn backend.Transaction, countQuerys []xcontext.QueryTuple) error {
+	max := txn.MaxDMLRows()
+	if max <= 0 || len(countQuerys) == 0 {
+		return nil
+	}
+
+	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
+	reqCtx.Mode = xcontext.ReqNormal
+	reqCtx.TxnMode = xcontext.TxnRead
+	reqCtx.Querys = countQuerys
+	qr, err := txn.Execute(reqCtx)
+	if err != nil {
+		return err
+	}
+
+	var rows uint64
+	for _, row := range qr.Rows {
+		v, err := strconv.ParseUint(row[0].ToString(), 10, 64)
+		if err != nil {
+			return err
+		}
+		rows += v
+	}
+	if rows > uint64(max) {
+		return xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, the DML matches %d rows more than max dml rows[%d], add the hint /*+ radon_force_dml */ to force it", rows, max)
+	}
+	return nil
+}
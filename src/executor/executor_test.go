@@ -9,6 +9,7 @@
 package executor
 
 import (
+	"context"
 	"testing"
 
 	"backend"
@@ -106,3 +107,45 @@ func TestExecutor1(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, fakedb.Result3, qr)
 }
+
+func TestExecutorContext(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select.*", fakedb.Result3)
+
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	query := "select * from A where a=2"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	planTree := planner.NewPlanTree()
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+	err = planTree.Add(plan)
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	// The cancelled request executes nothing.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewTree(log, planTree, txn).ExecuteContext(ctx)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Query execution was interrupted, the query is cancelled")
+	assert.Equal(t, 0, fakedbs.GetQueryCalledNum("select * from sbtest.A6 as A where a = 2"))
+
+	qr, err := NewTree(log, planTree, txn).ExecuteContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, fakedb.Result3, qr)
+}
@@ -40,10 +40,12 @@ func NewInsertExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction
 func (executor *InsertExecutor) Execute(ctx *xcontext.ResultContext) error {
 	plan := executor.plan.(*planner.InsertPlan)
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.TxnMode = xcontext.TxnWrite
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.PlanType = xcontext.PlanInsert
 
 	rs, err := executor.txn.Execute(reqCtx)
 	if err != nil {
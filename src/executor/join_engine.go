@@ -63,8 +63,8 @@ func (j *JoinEngine) execute(ctx *xcontext.ResultContext) error {
 			return err
 		}
 	} else {
-		lctx := xcontext.NewResultContext()
-		rctx := xcontext.NewResultContext()
+		lctx := ctx.Child()
+		rctx := ctx.Child()
 		wg.Add(1)
 		go oneExec(j.left, lctx)
 		wg.Add(1)
@@ -103,8 +103,8 @@ func (j *JoinEngine) execute(ctx *xcontext.ResultContext) error {
 // execBindVars used to execute querys with bindvas.
 func (j *JoinEngine) execBindVars(ctx *xcontext.ResultContext, bindVars map[string]*querypb.BindVariable, wantfields bool) error {
 	var err error
-	lctx := xcontext.NewResultContext()
-	rctx := xcontext.NewResultContext()
+	lctx := ctx.Child()
+	rctx := ctx.Child()
 	maxrow := j.txn.MaxJoinRows()
 	ctx.Results = &sqltypes.Result{}
 
@@ -175,8 +175,8 @@ func (j *JoinEngine) execBindVars(ctx *xcontext.ResultContext, bindVars map[stri
 // getFields fetches the field info.
 func (j *JoinEngine) getFields(ctx *xcontext.ResultContext, bindVars map[string]*querypb.BindVariable) error {
 	var err error
-	lctx := xcontext.NewResultContext()
-	rctx := xcontext.NewResultContext()
+	lctx := ctx.Child()
+	rctx := ctx.Child()
 
 	joinVars := make(map[string]*querypb.BindVariable)
 	if err = j.left.getFields(lctx, bindVars); err != nil {
@@ -27,6 +27,10 @@ type MergeEngine struct {
 	log  *xlog.Log
 	node *planner.MergeNode
 	txn  backend.Transaction
+
+	// passthrough used to keep the row packets of the backends in the results,
+	// it's only set if the results are returned to the client as they are.
+	passthrough bool
 }
 
 // NewMergeEngine creates the new merge executor.
@@ -43,10 +47,14 @@ func (m *MergeEngine) execute(ctx *xcontext.ResultContext) error {
 	var err error
 
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
 	reqCtx.Mode = m.node.ReqMode
 	reqCtx.TxnMode = xcontext.TxnRead
+	reqCtx.PlanType = xcontext.PlanSelect
+	reqCtx.RawRows = m.passthrough && len(m.node.Children().Plans()) == 0
 	if reqCtx.Mode == xcontext.ReqNormal {
 		reqCtx.Querys = m.node.Querys
+		reqCtx.Limit = m.limit()
 	} else {
 		buf := sqlparser.NewTrackedBuffer(nil)
 		m.node.Sel.Format(buf)
@@ -59,6 +67,24 @@ func (m *MergeEngine) execute(ctx *xcontext.ResultContext) error {
 	return execSubPlan(m.log, m.node, ctx)
 }
 
+// limit returns the rows the scatter query is satisfied with, it's the offset plus the limit if the limit
+// is the only operation on the results, any rows of the backends are correct without the order by. Returns 0 if not.
+func (m *MergeEngine) limit() int {
+	plans := m.node.Children().Plans()
+	if len(m.node.Querys) < 2 || len(plans) != 1 {
+		return 0
+	}
+	limitPlan, ok := plans[0].(*planner.LimitPlan)
+	if !ok {
+		return 0
+	}
+	// The rows locked by the select for update must be all read.
+	if sel, ok := m.node.Sel.(*sqlparser.Select); !ok || sel.Lock != "" {
+		return 0
+	}
+	return limitPlan.Offset + limitPlan.Limit
+}
+
 // execBindVars used to execute querys with bindvas.
 func (m *MergeEngine) execBindVars(ctx *xcontext.ResultContext, bindVars map[string]*querypb.BindVariable, wantfields bool) error {
 	var query string
@@ -74,8 +100,10 @@ func (m *MergeEngine) execBindVars(ctx *xcontext.ResultContext, bindVars map[str
 	}
 
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
 	reqCtx.Mode = xcontext.ReqNormal
 	reqCtx.TxnMode = xcontext.TxnRead
+	reqCtx.PlanType = xcontext.PlanSelect
 	reqCtx.Querys = querys
 
 	if ctx.Results, err = m.txn.Execute(reqCtx); err != nil {
@@ -94,6 +122,7 @@ func (m *MergeEngine) getFields(ctx *xcontext.ResultContext, bindVars map[string
 	query.Query = buf.String()
 
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
 	reqCtx.Mode = xcontext.ReqNormal
 	reqCtx.TxnMode = xcontext.TxnRead
 	reqCtx.Querys = []xcontext.QueryTuple{query}
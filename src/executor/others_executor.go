@@ -40,10 +40,12 @@ func NewOthersExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction
 func (executor *OthersExecutor) Execute(ctx *xcontext.ResultContext) error {
 	plan := executor.plan.(*planner.OthersPlan)
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx.Context()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.TxnMode = xcontext.TxnRead
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
+	reqCtx.PlanType = xcontext.PlanOthers
 
 	rs, err := executor.txn.Execute(reqCtx)
 	if err != nil {
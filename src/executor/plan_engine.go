@@ -11,6 +11,7 @@ package executor
 import (
 	"backend"
 	"planner"
+	"xbase"
 	"xcontext"
 
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
@@ -48,7 +49,14 @@ func buildEngine(log *xlog.Log, plan planner.PlanNode, txn backend.Transaction)
 func execSubPlan(log *xlog.Log, node planner.PlanNode, ctx *xcontext.ResultContext) error {
 	subPlanTree := node.Children()
 	if subPlanTree != nil {
+		// The sub plans change the rows, the row packets are stale.
+		if len(subPlanTree.Plans()) > 0 {
+			ctx.Results.RawRows = nil
+		}
 		for _, subPlan := range subPlanTree.Plans() {
+			if err := xbase.NewContextError(ctx.Context()); err != nil {
+				return err
+			}
 			switch subPlan.Type() {
 			case planner.PlanTypeAggregate:
 				aggrExecutor := NewAggregateExecutor(log, subPlan)
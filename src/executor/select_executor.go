@@ -41,6 +41,10 @@ func (executor *SelectExecutor) Execute(ctx *xcontext.ResultContext) error {
 	log := executor.log
 	plan := executor.plan.(*planner.SelectPlan)
 	planEngine := buildEngine(log, plan.Root, executor.txn)
+	// The merge-only results are passed through, the columns are never touched.
+	if merge, ok := planEngine.(*MergeEngine); ok {
+		merge.passthrough = true
+	}
 	if err := planEngine.execute(ctx); err != nil {
 		return err
 	}
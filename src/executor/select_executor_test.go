@@ -11,6 +11,7 @@ package executor
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"backend"
 	"planner"
@@ -20,6 +21,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
 	"github.com/xelabs/go-mysqlstack/xlog"
 
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
@@ -127,6 +129,165 @@ func TestMergeEngine(t *testing.T) {
 	}
 }
 
+func TestMergeEngineRawRows(t *testing.T) {
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "id",
+				Type: querypb.Type_INT32,
+			},
+			{
+				Name: "name",
+				Type: querypb.Type_VARCHAR,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("z")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("51")),
+				sqltypes.NULL,
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("5")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("")),
+			},
+		},
+	}
+	r2 := &sqltypes.Result{}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQuery("select id, name from sbtest.A0 as A where id > 8", r1)
+	fakedbs.AddQuery("select id, name from sbtest.A2 as A where id > 8", r1)
+	fakedbs.AddQuery("select id, name from sbtest.A4 as A where id > 8", r2)
+	fakedbs.AddQuery("select id, name from sbtest.A8 as A where id > 8", r2)
+	fakedbs.AddQuery("select id, name from sbtest.A0 as A where id > 8 order by id asc", r1)
+	fakedbs.AddQuery("select id, name from sbtest.A2 as A where id > 8 order by id asc", r1)
+	fakedbs.AddQuery("select id, name from sbtest.A4 as A where id > 8 order by id asc", r2)
+	fakedbs.AddQuery("select id, name from sbtest.A8 as A where id > 8 order by id asc", r2)
+
+	execute := func(query string) *sqltypes.Result {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		ctx := xcontext.NewResultContext()
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		return ctx.Results
+	}
+
+	// Merge only, the row packets are passed through.
+	{
+		qr := execute("select id, name from A where id>8")
+		assert.Equal(t, 6, len(qr.Rows))
+		assert.True(t, qr.HasRawRows())
+		for i, row := range qr.Rows {
+			buf := common.NewBuffer(16)
+			for _, val := range row {
+				if val.IsNull() {
+					buf.WriteLenEncodeNUL()
+				} else {
+					buf.WriteLenEncodeBytes(val.Raw())
+				}
+			}
+			assert.Equal(t, buf.Datas(), qr.RawRows[i])
+		}
+	}
+
+	// The orderby changes the rows.
+	{
+		qr := execute("select id, name from A where id>8 order by id")
+		assert.Equal(t, "[[3 z] [3 z] [5 ] [5 ] [51 ] [51 ]]", fmt.Sprintf("%v", qr.Rows))
+		assert.False(t, qr.HasRawRows())
+		assert.Nil(t, qr.RawRows)
+	}
+}
+
+func TestMergeEngineLimit(t *testing.T) {
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "id",
+				Type: querypb.Type_INT32,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("5"))},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQuery("select id from sbtest.A0 as A where id > 8 limit 2", r1)
+	fakedbs.AddQueryDelay("select id from sbtest.A2 as A where id > 8 limit 2", r1, 10000)
+	fakedbs.AddQueryDelay("select id from sbtest.A4 as A where id > 8 limit 2", r1, 10000)
+	fakedbs.AddQueryDelay("select id from sbtest.A8 as A where id > 8 limit 2", r1, 10000)
+	fakedbs.AddQuery("select id from sbtest.A0 as A where id > 8 order by id asc limit 2", r1)
+	fakedbs.AddQuery("select id from sbtest.A2 as A where id > 8 order by id asc limit 2", r1)
+	fakedbs.AddQuery("select id from sbtest.A4 as A where id > 8 order by id asc limit 2", r1)
+	fakedbs.AddQuery("select id from sbtest.A8 as A where id > 8 order by id asc limit 2", r1)
+
+	execute := func(query string) *sqltypes.Result {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		ctx := xcontext.NewResultContext()
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		return ctx.Results
+	}
+
+	// The slow backends are cancelled once the limit satisfied.
+	{
+		start := time.Now()
+		qr := execute("select id from A where id>8 limit 2")
+		assert.Equal(t, "[[3] [5]]", fmt.Sprintf("%v", qr.Rows))
+		assert.True(t, time.Since(start) < time.Second*5)
+	}
+
+	// The orderby needs the rows of all the backends.
+	{
+		qr := execute("select id from A where id>8 order by id limit 2")
+		assert.Equal(t, "[[3] [3]]", fmt.Sprintf("%v", qr.Rows))
+	}
+}
+
 func TestJoinEngine(t *testing.T) {
 	r1 := &sqltypes.Result{
 		Fields: []*querypb.Field{
@@ -625,6 +786,33 @@ func TestUnionEngine(t *testing.T) {
 				Type: querypb.Type_VARCHAR,
 			},
 		}}
+	// The rows are different though their values are the same after concatenated.
+	r4 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "id",
+				Type: querypb.Type_VARCHAR,
+			},
+			{
+				Name: "name",
+				Type: querypb.Type_VARCHAR,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("3g")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("o")),
+			},
+			{
+				sqltypes.NULL,
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("x")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("x")),
+			},
+		},
+	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	database := "sbtest"
@@ -639,6 +827,7 @@ func TestUnionEngine(t *testing.T) {
 	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
 	defer cleanup()
 	// desc
+	fakedbs.AddQuery("select '3g', 'o' from dual", r4)
 	fakedbs.AddQuery("select id, name from sbtest.A0 as A where id > 2", r2)
 	fakedbs.AddQuery("select id, name from sbtest.A2 as A where id > 2", r3)
 	fakedbs.AddQuery("select id, name from sbtest.A4 as A where id > 2", r3)
@@ -653,12 +842,14 @@ func TestUnionEngine(t *testing.T) {
 		"select id, name from A where id > 2 union all select 5, 'lang' order by id",
 		"select id, name from A where id = 2 union select id, name from B where id > 1 order by id",
 		"select id, name from A where id > 2 union distinct select 5, 'lang' order by id limit 1",
+		"select id, name from A where id > 2 union select '3g', 'o'",
 	}
 	results := []string{
 		"[[3 go] [5 lang]]",
 		"[[3 go] [5 lang] [5 lang]]",
 		"[]",
 		"[[3 go]]",
+		"[[3 go] [5 lang] [3g o] [ x] [ x]]",
 	}
 
 	for i, query := range querys {
@@ -742,7 +933,7 @@ func TestUnionEngineErr(t *testing.T) {
 	}
 	wants := []string{
 		"unsupported: the.used.'select'.statements.have.a.different.number.of.columns",
-		"mock.handler.query[select * from sbtest.b1 as b where id = 1].error[can.not.found.the.cond.please.set.first] (errno 1105) (sqlstate HY000)",
+		"mock.handler.query[select * from sbtest.b1 as b where id = 1].error[can.not.found.the.cond.please.set.first] (backend:backend2, table:sbtest.B1, phase:execute) (errno 1105) (sqlstate HY000)",
 	}
 
 	for i, query := range querys {
@@ -9,6 +9,7 @@
 package executor
 
 import (
+	"encoding/binary"
 	"errors"
 	"sync"
 
@@ -56,8 +57,8 @@ func (u *UnionEngine) execute(ctx *xcontext.ResultContext) error {
 			mu.Unlock()
 		}
 	}
-	lctx := xcontext.NewResultContext()
-	rctx := xcontext.NewResultContext()
+	lctx := ctx.Child()
+	rctx := ctx.Child()
 	wg.Add(1)
 	go oneExec(u.left, lctx)
 	wg.Add(1)
@@ -79,10 +80,7 @@ func (u *UnionEngine) execute(ctx *xcontext.ResultContext) error {
 	if u.node.Typ == "union distinct" || u.node.Typ == "union" {
 		table := common.NewHashTable()
 		for _, row := range lctx.Results.Rows {
-			var key []byte
-			for _, v := range row {
-				key = append(key, v.Raw()...)
-			}
+			key := unionRowKey(row)
 			if has, _ := table.Get(key); !has {
 				table.Put(key, row)
 			}
@@ -98,6 +96,24 @@ func (u *UnionEngine) execute(ctx *xcontext.ResultContext) error {
 	return execSubPlan(u.log, u.node, ctx)
 }
 
+// unionRowKey returns the dedup key of the row, every value is prefixed by its length so the rows such as
+// ('3', 'go') and ('3g', 'o') are different, and the NULL is different from the empty string.
+func unionRowKey(row []sqltypes.Value) []byte {
+	var key []byte
+	var buf [binary.MaxVarintLen64]byte
+	for _, v := range row {
+		if v.IsNull() {
+			key = append(key, 0)
+			continue
+		}
+		n := binary.PutUvarint(buf[:], uint64(len(v.Raw())))
+		key = append(key, 1)
+		key = append(key, buf[:n]...)
+		key = append(key, v.Raw()...)
+	}
+	return key
+}
+
 // execBindVars used to execute querys with bindvas.
 func (u *UnionEngine) execBindVars(ctx *xcontext.ResultContext, bindVars map[string]*querypb.BindVariable, wantfields bool) error {
 	return errors.New("UnionEngine.execBindVars: unreachable")
@@ -12,9 +12,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 
 	"config"
+	"xbase"
 
 	"github.com/xelabs/go-mysqlstack/driver"
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
@@ -103,11 +105,23 @@ type DB struct {
 	listeners    []*driver.Listener
 	backendconfs []*config.BackendConfig
 	addrs        []string
+	mariadb      bool
 }
 
 // New creates a new DB.
 func New(log *xlog.Log, n int) *DB {
+	return NewWithServerVersion(log, n, "")
+}
+
+// NewMariaDB creates a new DB which emulates the MariaDB 10.5 servers.
+func NewMariaDB(log *xlog.Log, n int) *DB {
+	return NewWithServerVersion(log, n, "5.5.5-10.5.8-MariaDB-log")
+}
+
+// NewWithServerVersion creates a new DB with the server version at greeting.
+func NewWithServerVersion(log *xlog.Log, n int, version string) *DB {
 	th := driver.NewTestHandler(log)
+	th.SetServerVersion(version)
 	listeners := make([]*driver.Listener, 0, 8)
 	addrs := make([]string, 0, 8)
 	backendconfs := make([]*config.BackendConfig, 0, 8)
@@ -116,6 +130,8 @@ func New(log *xlog.Log, n int) *DB {
 		if err != nil {
 			panic(err)
 		}
+		// The listeners share the handler, keep their connection ids apart for the KILL.
+		l.SetConnectionID(uint32(i)<<20 + 1)
 		conf := &config.BackendConfig{
 			Name:           fmt.Sprintf("backend%d", i),
 			Address:        l.Addr(),
@@ -135,6 +151,7 @@ func New(log *xlog.Log, n int) *DB {
 		addrs:        addrs,
 		listeners:    listeners,
 		backendconfs: backendconfs,
+		mariadb:      strings.Contains(version, "MariaDB"),
 	}
 	// Add mock/mock user to mysql.user table.
 	db.addMockUser()
@@ -224,6 +241,12 @@ func (db *DB) ResetErrors() {
 	db.handler.ResetErrors()
 }
 
+// SetClock used to drive the query delays by the clock, with the xbase.FakeClock
+// the delayed querys return only when the clock is advanced.
+func (db *DB) SetClock(clock xbase.Clock) {
+	db.handler.SetAfter(clock.After)
+}
+
 // addMockUser adds mock/mock user to mysql.user table.
 func (db *DB) addMockUser() {
 	r1 := &sqltypes.Result{
@@ -239,7 +262,11 @@ func (db *DB) addMockUser() {
 			},
 		},
 	}
-	db.AddQuery("select authentication_string from mysql.user where user='mock'", r1)
+	authQuery := "select authentication_string from mysql.user where user='%s'"
+	if db.mariadb {
+		authQuery = "select if(authentication_string = '', password, authentication_string) as authentication_string from mysql.user where user='%s'"
+	}
+	db.AddQuery(fmt.Sprintf(authQuery, "mock"), r1)
 	// Multiple users for the privilege.
-	db.AddQuery("select authentication_string from mysql.user where user='mock1'", r1)
+	db.AddQuery(fmt.Sprintf(authQuery, "mock1"), r1)
 }
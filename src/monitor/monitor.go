@@ -11,6 +11,8 @@ package monitor
 import (
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"config"
 
@@ -70,6 +72,129 @@ var (
 		[]string{"command", "result"},
 	)
 
+	planTotalCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "plan_total",
+			Help: "Counter of the executed plans.",
+		},
+		[]string{"type", "result"},
+	)
+
+	planBackendsHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "plan_backends",
+			Help:    "Histogram of the backends touched by the plans.",
+			Buckets: []float64{1, 2, 4, 8, 16, 32, 64},
+		},
+		[]string{"type"},
+	)
+
+	backendErrorCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "backend_error_total",
+			Help: "Counter of the backend errors.",
+		},
+		[]string{"backend", "phase", "errno"},
+	)
+
+	unsupportedSQLCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "unsupported_sql_total",
+			Help: "Counter of the unsupported querys by the construct.",
+		},
+		[]string{"construct"},
+	)
+
+	jobRunCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "job_run_total",
+			Help: "Counter of the scheduled job runs by the result.",
+		},
+		[]string{"job", "result"},
+	)
+
+	workloadQueryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "workload_query_total",
+			Help: "Counter of the querys by the workload class and the admission result.",
+		},
+		[]string{"class", "result"},
+	)
+
+	workloadRunningNum = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "workload_running",
+			Help: "Number of the running querys by the workload class.",
+		},
+		[]string{"class"},
+	)
+
+	workloadQueuedNum = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "workload_queued",
+			Help: "Number of the querys waiting for the admission by the workload class.",
+		},
+		[]string{"class"},
+	)
+
+	workloadQueryHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "workload_query_seconds",
+			Help:    "Histogram of the query latency by the workload class.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"class"},
+	)
+
+	routerTableCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "router_table_cache_total",
+			Help: "Counter of the table metadata accesses in the lazy mode by the result, one of hit and miss.",
+		},
+		[]string{"result"},
+	)
+
+	routerTableCachedNum = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "router_table_cached",
+			Help: "Number of the tables loaded in the lazy mode.",
+		})
+
+	routerTableLoadHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "router_table_load_seconds",
+			Help:    "Histogram of the table metadata load latency in the lazy mode.",
+			Buckets: prometheus.DefBuckets,
+		})
+
+	memoryUsedNum = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "memory_used_bytes",
+			Help: "Bytes of the results held by the in-flight querys.",
+		})
+
+	memoryBackoffCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "memory_backoff_total",
+			Help: "Counter of the scatter querys backed off by the memory high water, the result is one of queued and rejected.",
+		},
+		[]string{"result"},
+	)
+
+	backendConnectionValidateCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "backend_connection_validate_total",
+			Help: "Counter of the idle backend connections validated in the background, the result is one of ok and broken.",
+		},
+		[]string{"address", "result"},
+	)
+
+	idleSessionKilledCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "idle_session_killed_total",
+			Help: "Counter of sessions killed by wait_timeout.",
+		})
+
 	peerNum = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "peer_number",
@@ -84,6 +209,22 @@ func init() {
 	prometheus.MustRegister(backendNum)
 	prometheus.MustRegister(diskUsage)
 	prometheus.MustRegister(slowQueryTotalCounter)
+	prometheus.MustRegister(planTotalCounter)
+	prometheus.MustRegister(planBackendsHistogram)
+	prometheus.MustRegister(backendErrorCounter)
+	prometheus.MustRegister(unsupportedSQLCounter)
+	prometheus.MustRegister(jobRunCounter)
+	prometheus.MustRegister(workloadQueryCounter)
+	prometheus.MustRegister(workloadRunningNum)
+	prometheus.MustRegister(workloadQueuedNum)
+	prometheus.MustRegister(workloadQueryHistogram)
+	prometheus.MustRegister(routerTableCacheCounter)
+	prometheus.MustRegister(routerTableCachedNum)
+	prometheus.MustRegister(routerTableLoadHistogram)
+	prometheus.MustRegister(memoryUsedNum)
+	prometheus.MustRegister(memoryBackoffCounter)
+	prometheus.MustRegister(backendConnectionValidateCounter)
+	prometheus.MustRegister(idleSessionKilledCounter)
 	prometheus.MustRegister(peerNum)
 }
 
@@ -148,6 +289,82 @@ func SlowQueryTotalCounterInc(command string, result string) {
 	slowQueryTotalCounter.WithLabelValues(command, result).Inc()
 }
 
+// PlanObserve add 1 to the plan counter and observes the backends number touched by the plan.
+func PlanObserve(ptype string, result string, backends int) {
+	planTotalCounter.WithLabelValues(ptype, result).Inc()
+	planBackendsHistogram.WithLabelValues(ptype).Observe(float64(backends))
+}
+
+// BackendErrorInc add 1 to the backend errors with the phase and errno.
+func BackendErrorInc(backend string, phase string, errno uint16) {
+	backendErrorCounter.WithLabelValues(backend, phase, strconv.Itoa(int(errno))).Inc()
+}
+
+// UnsupportedSQLInc add 1 to the unsupported querys of the construct.
+func UnsupportedSQLInc(construct string) {
+	unsupportedSQLCounter.WithLabelValues(construct).Inc()
+}
+
+// JobRunInc add 1 to the runs of the job with the result, one of succeeded, failed and skipped.
+func JobRunInc(job string, result string) {
+	jobRunCounter.WithLabelValues(job, result).Inc()
+}
+
+// WorkloadQueryInc add 1 to the querys of the workload class with the admission result, one of admitted and rejected.
+func WorkloadQueryInc(class string, result string) {
+	workloadQueryCounter.WithLabelValues(class, result).Inc()
+}
+
+// WorkloadRunningAdd adds the delta to the running querys of the workload class.
+func WorkloadRunningAdd(class string, delta float64) {
+	workloadRunningNum.WithLabelValues(class).Add(delta)
+}
+
+// WorkloadQueuedAdd adds the delta to the queued querys of the workload class.
+func WorkloadQueuedAdd(class string, delta float64) {
+	workloadQueuedNum.WithLabelValues(class).Add(delta)
+}
+
+// WorkloadQueryObserve observes the query latency of the workload class.
+func WorkloadQueryObserve(class string, d time.Duration) {
+	workloadQueryHistogram.WithLabelValues(class).Observe(d.Seconds())
+}
+
+// RouterTableCacheInc add 1 to the table metadata accesses with the result, one of hit and miss.
+func RouterTableCacheInc(result string) {
+	routerTableCacheCounter.WithLabelValues(result).Inc()
+}
+
+// RouterTableCachedSet sets the number of the loaded tables.
+func RouterTableCachedSet(v float64) {
+	routerTableCachedNum.Set(v)
+}
+
+// RouterTableLoadObserve observes the table metadata load latency.
+func RouterTableLoadObserve(d time.Duration) {
+	routerTableLoadHistogram.Observe(d.Seconds())
+}
+
+// MemoryUsedSet sets the bytes of the results held by the in-flight querys.
+func MemoryUsedSet(v float64) {
+	memoryUsedNum.Set(v)
+}
+
+// MemoryBackoffInc add 1 to the scatter querys backed off by the memory high water with the result.
+func MemoryBackoffInc(result string) {
+	memoryBackoffCounter.WithLabelValues(result).Inc()
+}
+
+// BackendConnectionValidateInc add 1 to the idle connections of the backend validated with the result.
+func BackendConnectionValidateInc(address string, result string) {
+	backendConnectionValidateCounter.WithLabelValues(address, result).Inc()
+}
+
+// IdleSessionKilledInc add 1
+func IdleSessionKilledInc() {
+	idleSessionKilledCounter.Inc()
+}
+
 //PeerNumInc add 1
 func PeerNumInc() {
 	peerNum.Inc()
@@ -10,9 +10,11 @@ package monitor
 
 import (
 	"testing"
+	"time"
 
 	"config"
 
+	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -159,6 +161,143 @@ func TestSlowQueryTotalCounterInc(t *testing.T) {
 	assert.EqualValues(t, 1, v)
 }
 
+func TestPlanObserve(t *testing.T) {
+	PlanObserve("scatter_select", "OK", 3)
+	PlanObserve("scatter_select", "OK", 5)
+
+	var m dto.Metric
+	c, _ := planTotalCounter.GetMetricWithLabelValues("scatter_select", "OK")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetCounter().GetValue())
+
+	h, _ := planBackendsHistogram.GetMetricWithLabelValues("scatter_select")
+	err = h.(prometheus.Metric).Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetHistogram().GetSampleCount())
+	assert.EqualValues(t, 8, m.GetHistogram().GetSampleSum())
+}
+
+func TestBackendErrorInc(t *testing.T) {
+	BackendErrorInc("node1", "execute", 1146)
+	BackendErrorInc("node1", "execute", 1146)
+	BackendErrorInc("node1", "connect", 9001)
+
+	var m dto.Metric
+	c, _ := backendErrorCounter.GetMetricWithLabelValues("node1", "execute", "1146")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetCounter().GetValue())
+}
+
+func TestUnsupportedSQLInc(t *testing.T) {
+	UnsupportedSQLInc("trigger")
+	UnsupportedSQLInc("trigger")
+
+	var m dto.Metric
+	c, _ := unsupportedSQLCounter.GetMetricWithLabelValues("trigger")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetCounter().GetValue())
+}
+
+func TestJobRunInc(t *testing.T) {
+	JobRunInc("j1", "failed")
+	JobRunInc("j1", "failed")
+
+	var m dto.Metric
+	c, _ := jobRunCounter.GetMetricWithLabelValues("j1", "failed")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetCounter().GetValue())
+}
+
+func TestWorkload(t *testing.T) {
+	WorkloadQueryInc("olap", "admitted")
+	WorkloadRunningAdd("olap", 1)
+	WorkloadQueuedAdd("olap", 2)
+	WorkloadQueuedAdd("olap", -1)
+	WorkloadQueryObserve("olap", 2*time.Second)
+
+	var m dto.Metric
+	c, _ := workloadQueryCounter.GetMetricWithLabelValues("olap", "admitted")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, m.GetCounter().GetValue())
+
+	g, _ := workloadQueuedNum.GetMetricWithLabelValues("olap")
+	err = g.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, m.GetGauge().GetValue())
+
+	h, _ := workloadQueryHistogram.GetMetricWithLabelValues("olap")
+	err = h.(prometheus.Metric).Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetHistogram().GetSampleSum())
+}
+
+func TestRouterTableCache(t *testing.T) {
+	RouterTableCacheInc("hit")
+	RouterTableCacheInc("hit")
+	RouterTableCacheInc("miss")
+	RouterTableCachedSet(1)
+	RouterTableLoadObserve(time.Second)
+
+	var m dto.Metric
+	c, _ := routerTableCacheCounter.GetMetricWithLabelValues("hit")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetCounter().GetValue())
+
+	err = routerTableCachedNum.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, m.GetGauge().GetValue())
+
+	err = routerTableLoadHistogram.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, m.GetHistogram().GetSampleSum())
+}
+
+func TestMemory(t *testing.T) {
+	MemoryUsedSet(1024)
+	MemoryBackoffInc("queued")
+	MemoryBackoffInc("rejected")
+	MemoryBackoffInc("rejected")
+
+	var m dto.Metric
+	err := memoryUsedNum.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1024, m.GetGauge().GetValue())
+
+	c, _ := memoryBackoffCounter.GetMetricWithLabelValues("rejected")
+	err = c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetCounter().GetValue())
+}
+
+func TestBackendConnectionValidateInc(t *testing.T) {
+	BackendConnectionValidateInc("192.168.0.1:3306", "ok")
+	BackendConnectionValidateInc("192.168.0.1:3306", "broken")
+	BackendConnectionValidateInc("192.168.0.1:3306", "broken")
+
+	var m dto.Metric
+	c, _ := backendConnectionValidateCounter.GetMetricWithLabelValues("192.168.0.1:3306", "broken")
+	err := c.Write(&m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, m.GetCounter().GetValue())
+}
+
+func TestIdleSessionKilledInc(t *testing.T) {
+	IdleSessionKilledInc()
+	IdleSessionKilledInc()
+
+	var m dto.Metric
+	err := idleSessionKilledCounter.Write(&m)
+	assert.Nil(t, err)
+	v := m.GetCounter().GetValue()
+	assert.EqualValues(t, 2, v)
+}
+
 func TestPeerNum(t *testing.T) {
 	PeerNumSet(1)
 
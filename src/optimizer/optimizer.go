@@ -9,10 +9,13 @@
 package optimizer
 
 import (
+	"context"
+
 	"planner"
 )
 
 // Optimizer interface.
 type Optimizer interface {
 	BuildPlanTree() (*planner.PlanTree, error)
+	BuildPlanTreeContext(ctx context.Context) (*planner.PlanTree, error)
 }
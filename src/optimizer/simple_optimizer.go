@@ -9,6 +9,8 @@
 package optimizer
 
 import (
+	"context"
+
 	"planner"
 	"router"
 
@@ -43,6 +45,11 @@ func NewSimpleOptimizer(log *xlog.Log, database string, query string, node sqlpa
 
 // BuildPlanTree used to build plan trees for the query.
 func (so *SimpleOptimizer) BuildPlanTree() (*planner.PlanTree, error) {
+	return so.BuildPlanTreeContext(context.Background())
+}
+
+// BuildPlanTreeContext used to build plan trees for the query, the building stops once the ctx is done.
+func (so *SimpleOptimizer) BuildPlanTreeContext(ctx context.Context) (*planner.PlanTree, error) {
 	log := so.log
 	database := so.database
 	query := so.query
@@ -78,7 +85,7 @@ func (so *SimpleOptimizer) BuildPlanTree() (*planner.PlanTree, error) {
 	}
 
 	// Build plantree.
-	if err := plans.Build(); err != nil {
+	if err := plans.BuildContext(ctx); err != nil {
 		return nil, err
 	}
 	return plans, nil
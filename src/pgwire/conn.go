@@ -0,0 +1,272 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package pgwire
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	protocolVersion3  = 196608
+	sslRequestCode    = 80877103
+	cancelRequestCode = 80877102
+
+	// The max size of the client message.
+	maxMessageSize = 1 << 24
+
+	authOK                = 0
+	authCleartextPassword = 3
+)
+
+// The message types.
+const (
+	// Frontend.
+	msgQuery     = 'Q'
+	msgPassword  = 'p'
+	msgTerminate = 'X'
+	msgSync      = 'S'
+
+	// Backend.
+	msgAuthentication     = 'R'
+	msgParameterStatus    = 'S'
+	msgBackendKeyData     = 'K'
+	msgReadyForQuery      = 'Z'
+	msgRowDescription     = 'T'
+	msgDataRow            = 'D'
+	msgCommandComplete    = 'C'
+	msgEmptyQueryResponse = 'I'
+	msgErrorResponse      = 'E'
+)
+
+type conn struct {
+	c         net.Conn
+	r         *bufio.Reader
+	w         *bufio.Writer
+	tlsConfig *tls.Config
+	// secure is true if the connection is upgraded to the SSL.
+	secure bool
+}
+
+func newConn(c net.Conn, tlsConfig *tls.Config) *conn {
+	return &conn{
+		c:         c,
+		r:         bufio.NewReader(c),
+		w:         bufio.NewWriter(c),
+		tlsConfig: tlsConfig,
+	}
+}
+
+// readStartup used to read the startup message, the SSLRequest is accepted if the tlsConfig is set, else refused.
+func (c *conn) readStartup() (map[string]string, error) {
+	for {
+		payload, err := c.readPayload()
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) < 4 {
+			return nil, errors.New("pgwire.startup.message.too.short")
+		}
+
+		code := binary.BigEndian.Uint32(payload[:4])
+		switch code {
+		case sslRequestCode:
+			if c.tlsConfig == nil || c.secure {
+				if err := c.w.WriteByte('N'); err != nil {
+					return nil, err
+				}
+				if err := c.flush(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := c.w.WriteByte('S'); err != nil {
+				return nil, err
+			}
+			if err := c.flush(); err != nil {
+				return nil, err
+			}
+			tc := tls.Server(c.c, c.tlsConfig)
+			if err := tc.Handshake(); err != nil {
+				return nil, err
+			}
+			c.c, c.secure = tc, true
+			c.r, c.w = bufio.NewReader(tc), bufio.NewWriter(tc)
+			continue
+		case cancelRequestCode:
+			return nil, errors.New("pgwire.cancel.request.unsupported")
+		case protocolVersion3:
+		default:
+			return nil, errors.Errorf("pgwire.unsupported.protocol.version[%d]", code)
+		}
+
+		params := make(map[string]string)
+		kvs := strings.Split(string(payload[4:]), "\x00")
+		for i := 0; i+1 < len(kvs); i += 2 {
+			if kvs[i] == "" {
+				break
+			}
+			params[kvs[i]] = kvs[i+1]
+		}
+		return params, nil
+	}
+}
+
+// readPayload used to read the length-prefixed payload.
+func (c *conn) readPayload() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[:]))
+	if size < 4 || size > maxMessageSize {
+		return nil, errors.Errorf("pgwire.invalid.message.size[%d]", size)
+	}
+	payload := make([]byte, size-4)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// readMessage used to read the typed message.
+func (c *conn) readMessage() (byte, []byte, error) {
+	typ, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	payload, err := c.readPayload()
+	if err != nil {
+		return 0, nil, err
+	}
+	return typ, payload, nil
+}
+
+func (c *conn) writeMessage(typ byte, payload []byte) {
+	var header [5]byte
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)+4))
+	c.w.Write(header[:])
+	c.w.Write(payload)
+}
+
+func (c *conn) flush() error {
+	return c.w.Flush()
+}
+
+func (c *conn) writeAuthentication(code uint32) {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], code)
+	c.writeMessage(msgAuthentication, payload[:])
+}
+
+func (c *conn) writeParameterStatus(name, value string) {
+	c.writeMessage(msgParameterStatus, []byte(name+"\x00"+value+"\x00"))
+}
+
+func (c *conn) writeBackendKeyData(id uint32) {
+	var payload [8]byte
+	binary.BigEndian.PutUint32(payload[:4], id)
+	c.writeMessage(msgBackendKeyData, payload[:])
+}
+
+func (c *conn) writeReadyForQuery() {
+	// Always idle, there is no transaction in the pgwire frontend.
+	c.writeMessage(msgReadyForQuery, []byte{'I'})
+}
+
+func (c *conn) writeCommandComplete(tag string) {
+	c.writeMessage(msgCommandComplete, []byte(tag+"\x00"))
+}
+
+func (c *conn) writeEmptyQueryResponse() {
+	c.writeMessage(msgEmptyQueryResponse, nil)
+}
+
+// writeError used to write the ErrorResponse, the MySQL SQLSTATE is kept.
+func (c *conn) writeError(err error) {
+	state := "XX000"
+	msg := err.Error()
+	if sqlErr, ok := err.(*sqldb.SQLError); ok {
+		state = sqlErr.State
+		msg = sqlErr.Message
+	}
+
+	buf := make([]byte, 0, 64+len(msg))
+	buf = append(buf, 'S')
+	buf = append(buf, "ERROR\x00"...)
+	buf = append(buf, 'C')
+	buf = append(buf, state+"\x00"...)
+	buf = append(buf, 'M')
+	buf = append(buf, msg+"\x00"...)
+	buf = append(buf, 0)
+	c.writeMessage(msgErrorResponse, buf)
+}
+
+// writeResult used to write the RowDescription, DataRows and CommandComplete, all the values are in text format.
+func (c *conn) writeResult(qr *sqltypes.Result) {
+	if len(qr.Fields) == 0 {
+		c.writeCommandComplete(fmt.Sprintf("SELECT %d", qr.RowsAffected))
+		return
+	}
+
+	desc := make([]byte, 2, 256)
+	binary.BigEndian.PutUint16(desc, uint16(len(qr.Fields)))
+	bytea := make([]bool, len(qr.Fields))
+	for i, field := range qr.Fields {
+		oid, size := typeOID(field.Type)
+		bytea[i] = (oid == oidBytea)
+		desc = append(desc, field.Name+"\x00"...)
+		desc = appendUint32(desc, 0) // table oid
+		desc = appendUint16(desc, 0) // column attribute number
+		desc = appendUint32(desc, oid)
+		desc = appendUint16(desc, uint16(size))
+		desc = appendUint32(desc, 0xffffffff) // type modifier -1
+		desc = appendUint16(desc, 0)          // text format
+	}
+	c.writeMessage(msgRowDescription, desc)
+
+	for _, row := range qr.Rows {
+		data := make([]byte, 2, 128)
+		binary.BigEndian.PutUint16(data, uint16(len(row)))
+		for i, v := range row {
+			if v.IsNull() {
+				data = appendUint32(data, 0xffffffff)
+				continue
+			}
+			raw := v.Raw()
+			// The bytea text format is hex-escaped.
+			if i < len(bytea) && bytea[i] {
+				raw = []byte("\\x" + hex.EncodeToString(raw))
+			}
+			data = appendUint32(data, uint32(len(raw)))
+			data = append(data, raw...)
+		}
+		c.writeMessage(msgDataRow, data)
+	}
+	c.writeCommandComplete(fmt.Sprintf("SELECT %d", len(qr.Rows)))
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,241 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package pgwire
+
+import (
+	"crypto/tls"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// Handler interface, the executor of the pgwire frontend.
+type Handler interface {
+	// PgwireSessionCheck used to check the client address and the connections number of the endpoint before the
+	// authentication, the connections includes the new one.
+	PgwireSessionCheck(address string, connections int) error
+	// AuthCheckPassword used to check the cleartext password of the user.
+	AuthCheckPassword(user string, password string) error
+	// ExecuteReadOnly used to execute the read-only query.
+	ExecuteReadOnly(user string, database string, query string) (*sqltypes.Result, error)
+}
+
+// Listener is a PostgreSQL wire protocol(v3) listener, only the simple query protocol is supported.
+// The cleartext password is only accepted over the SSL or from the local host.
+type Listener struct {
+	log          *xlog.Log
+	address      string
+	handler      Handler
+	listener     net.Listener
+	tlsConfig    *tls.Config
+	connectionID uint32
+	connections  int32
+}
+
+// NewListener creates a new Listener, the SSL is refused if the tlsConfig is nil.
+func NewListener(log *xlog.Log, address string, tlsConfig *tls.Config, handler Handler) (*Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Listener{
+		log:       log,
+		address:   address,
+		handler:   handler,
+		listener:  listener,
+		tlsConfig: tlsConfig,
+	}, nil
+}
+
+// Accept runs an accept loop until the listener is closed.
+func (l *Listener) Accept() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			// Close() was probably called.
+			return
+		}
+		id := atomic.AddUint32(&l.connectionID, 1)
+		go l.handle(conn, id)
+	}
+}
+
+// Addr returns the listener address.
+func (l *Listener) Addr() string {
+	return l.listener.Addr().String()
+}
+
+// Close closes the listener.
+func (l *Listener) Close() {
+	l.listener.Close()
+}
+
+func (l *Listener) handle(c net.Conn, id uint32) {
+	log := l.log
+
+	// Catch panics, and close the connection in any case.
+	defer func() {
+		c.Close()
+		if x := recover(); x != nil {
+			log.Error("pgwire.handle.panic:\n%v\n%s", x, debug.Stack())
+		}
+	}()
+
+	connections := atomic.AddInt32(&l.connections, 1)
+	defer atomic.AddInt32(&l.connections, -1)
+
+	conn := newConn(c, l.tlsConfig)
+	params, err := conn.readStartup()
+	if err != nil {
+		log.Warning("pgwire.session[%v].startup.error:%+v", id, err)
+		return
+	}
+	user := params["user"]
+	database := params["database"]
+	if database == "" {
+		database = user
+	}
+
+	// The ip table and the max connections.
+	if err = l.handler.PgwireSessionCheck(c.RemoteAddr().String(), int(connections)); err != nil {
+		log.Warning("pgwire.session[%v].from[%s].check.error:%+v", id, c.RemoteAddr(), err)
+		conn.writeError(err)
+		conn.flush()
+		return
+	}
+	// The cleartext password is never sent in plain text over the network.
+	if !conn.secure && !localAddress(c.RemoteAddr()) {
+		log.Warning("pgwire.session[%v].from[%s].user[%s].denied.without.ssl", id, c.RemoteAddr(), user)
+		conn.writeError(sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v', the password requires the SSL connection", user))
+		conn.flush()
+		return
+	}
+
+	// Cleartext password authentication.
+	conn.writeAuthentication(authCleartextPassword)
+	if err = conn.flush(); err != nil {
+		return
+	}
+	typ, payload, err := conn.readMessage()
+	if err != nil || typ != msgPassword {
+		log.Warning("pgwire.session[%v].read.password.error:%+v", id, err)
+		return
+	}
+	password := strings.TrimSuffix(string(payload), "\x00")
+	if err = l.handler.AuthCheckPassword(user, password); err != nil {
+		log.Warning("pgwire.session[%v].user[%s].auth.error:%+v", id, user, err)
+		conn.writeError(err)
+		conn.flush()
+		return
+	}
+
+	conn.writeAuthentication(authOK)
+	for _, kv := range [][2]string{
+		{"server_version", "9.6.0"},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+	} {
+		conn.writeParameterStatus(kv[0], kv[1])
+	}
+	conn.writeBackendKeyData(id)
+	conn.writeReadyForQuery()
+	if err = conn.flush(); err != nil {
+		return
+	}
+	log.Debug("pgwire.session[%v].user[%s].db[%s].login", id, user, database)
+
+	// Command loop.
+	extended := false
+	for {
+		typ, payload, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case msgQuery:
+			query := strings.TrimSuffix(string(payload), "\x00")
+			l.handleQuery(conn, user, database, query)
+			conn.writeReadyForQuery()
+		case msgTerminate:
+			return
+		case msgSync:
+			// The end of the extended query messages.
+			extended = false
+			conn.writeReadyForQuery()
+		default:
+			// The extended query protocol is not supported, report once and skip to the sync.
+			if !extended {
+				extended = true
+				conn.writeError(sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "pgwire: unsupported message type '%c'", typ))
+			}
+		}
+		if err = conn.flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (l *Listener) handleQuery(conn *conn, user string, database string, query string) {
+	log := l.log
+
+	query = strings.TrimSpace(query)
+	query = strings.TrimSuffix(query, ";")
+	if query == "" {
+		conn.writeEmptyQueryResponse()
+		return
+	}
+
+	// The session statements are accepted and ignored.
+	if tag, ok := sessionTag(query); ok {
+		conn.writeCommandComplete(tag)
+		return
+	}
+
+	rewritten, err := Translate(query)
+	if err != nil {
+		conn.writeError(err)
+		return
+	}
+	qr, err := l.handler.ExecuteReadOnly(user, database, rewritten)
+	if err != nil {
+		log.Error("pgwire.query[%s].rewritten[%s].error:%+v", query, rewritten, err)
+		conn.writeError(err)
+		return
+	}
+	conn.writeResult(qr)
+}
+
+// localAddress returns true if the address is on the local host.
+func localAddress(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// sessionTag returns the command tag of the session statements which are no-op in radon.
+func sessionTag(query string) (string, bool) {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "", false
+	}
+	switch verb := strings.ToUpper(fields[0]); verb {
+	case "SET", "BEGIN", "COMMIT", "ROLLBACK", "DISCARD", "DEALLOCATE":
+		return verb, true
+	}
+	return "", false
+}
@@ -0,0 +1,354 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package pgwire
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+type mockHandler struct {
+	querys []string
+	denied bool
+}
+
+func (h *mockHandler) PgwireSessionCheck(address string, connections int) error {
+	if h.denied {
+		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user from host '%v'", address)
+	}
+	return nil
+}
+
+func (h *mockHandler) AuthCheckPassword(user string, password string) error {
+	if user != "mock" || password != "mock" {
+		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
+	}
+	return nil
+}
+
+func (h *mockHandler) ExecuteReadOnly(user string, database string, query string) (*sqltypes.Result, error) {
+	h.querys = append(h.querys, database+":"+query)
+	if query == "select error" {
+		return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+	}
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "name", Type: querypb.Type_VARCHAR},
+			{Name: "data", Type: querypb.Type_BLOB},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("a")),
+				sqltypes.MakeTrusted(querypb.Type_BLOB, []byte{0x01, 0xff}),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2")),
+				sqltypes.NULL,
+				sqltypes.NULL,
+			},
+		},
+	}, nil
+}
+
+// pgClient is a minimal PostgreSQL client for the tests.
+type pgClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type pgMessage struct {
+	typ     byte
+	payload []byte
+}
+
+func newPgClient(t *testing.T, address string, ssl bool) *pgClient {
+	conn, err := net.Dial("tcp", address)
+	assert.Nil(t, err)
+	c := &pgClient{conn: conn, r: bufio.NewReader(conn)}
+
+	if ssl {
+		req := make([]byte, 8)
+		binary.BigEndian.PutUint32(req, 8)
+		binary.BigEndian.PutUint32(req[4:], sslRequestCode)
+		_, err = conn.Write(req)
+		assert.Nil(t, err)
+		b, err := c.r.ReadByte()
+		assert.Nil(t, err)
+		assert.Equal(t, byte('N'), b)
+	}
+	return c
+}
+
+// newPgTLSClient returns the client upgraded to the SSL.
+func newPgTLSClient(t *testing.T, address string) *pgClient {
+	conn, err := net.Dial("tcp", address)
+	assert.Nil(t, err)
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req, 8)
+	binary.BigEndian.PutUint32(req[4:], sslRequestCode)
+	_, err = conn.Write(req)
+	assert.Nil(t, err)
+	b := make([]byte, 1)
+	_, err = io.ReadFull(conn, b)
+	assert.Nil(t, err)
+	assert.Equal(t, byte('S'), b[0])
+
+	tc := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	err = tc.Handshake()
+	assert.Nil(t, err)
+	return &pgClient{conn: tc, r: bufio.NewReader(tc)}
+}
+
+// testTLSConfig returns the config with a self-signed certificate.
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "radon"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func (c *pgClient) startup(user, database string) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, protocolVersion3)
+	payload = append(payload, "user\x00"+user+"\x00database\x00"+database+"\x00\x00"...)
+	msg := make([]byte, 4)
+	binary.BigEndian.PutUint32(msg, uint32(len(payload)+4))
+	_, err := c.conn.Write(append(msg, payload...))
+	return err
+}
+
+func (c *pgClient) send(typ byte, payload string) error {
+	msg := make([]byte, 5)
+	msg[0] = typ
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(payload)+4))
+	_, err := c.conn.Write(append(msg, payload...))
+	return err
+}
+
+func (c *pgClient) read() (*pgMessage, error) {
+	typ, err := c.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	var header [4]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[:])-4)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return nil, err
+	}
+	return &pgMessage{typ: typ, payload: payload}, nil
+}
+
+// readUntilReady returns the messages until the ReadyForQuery.
+func (c *pgClient) readUntilReady() ([]*pgMessage, error) {
+	var msgs []*pgMessage
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+		if msg.typ == msgReadyForQuery {
+			return msgs, nil
+		}
+	}
+}
+
+func (c *pgClient) login(t *testing.T, user, password string) []*pgMessage {
+	err := c.startup(user, "db1")
+	assert.Nil(t, err)
+	msg, err := c.read()
+	assert.Nil(t, err)
+	assert.Equal(t, byte(msgAuthentication), msg.typ)
+	assert.Equal(t, uint32(authCleartextPassword), binary.BigEndian.Uint32(msg.payload))
+	err = c.send(msgPassword, password+"\x00")
+	assert.Nil(t, err)
+	msgs, _ := c.readUntilReady()
+	return msgs
+}
+
+func msgTypes(msgs []*pgMessage) string {
+	var types []byte
+	for _, msg := range msgs {
+		types = append(types, msg.typ)
+	}
+	return string(types)
+}
+
+func TestPgwireServer(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	handler := &mockHandler{}
+	l, err := NewListener(log, "127.0.0.1:0", nil, handler)
+	assert.Nil(t, err)
+	defer l.Close()
+	go l.Accept()
+
+	// Auth failed.
+	{
+		c := newPgClient(t, l.Addr(), false)
+		msgs := c.login(t, "mock", "xx")
+		assert.Equal(t, "E", msgTypes(msgs))
+		c.conn.Close()
+	}
+
+	c := newPgClient(t, l.Addr(), true)
+	defer c.conn.Close()
+
+	// Login.
+	{
+		msgs := c.login(t, "mock", "mock")
+		assert.Equal(t, "RSSSSSSKZ", msgTypes(msgs))
+		assert.Equal(t, uint32(authOK), binary.BigEndian.Uint32(msgs[0].payload))
+	}
+
+	// Select.
+	{
+		err := c.send(msgQuery, `select "id", name, data from "t1";`+"\x00")
+		assert.Nil(t, err)
+		msgs, err := c.readUntilReady()
+		assert.Nil(t, err)
+		assert.Equal(t, "TDDCZ", msgTypes(msgs))
+		assert.Equal(t, "db1:select `id`, name, data from `t1`", handler.querys[0])
+
+		// RowDescription: 3 fields, the first is id int4.
+		desc := msgs[0].payload
+		assert.Equal(t, uint16(3), binary.BigEndian.Uint16(desc))
+		assert.Equal(t, "id\x00", string(desc[2:5]))
+		assert.Equal(t, uint32(oidInt4), binary.BigEndian.Uint32(desc[11:15]))
+
+		// DataRow: 1, 'a', bytea.
+		want := []byte{0, 3, 0, 0, 0, 1, '1', 0, 0, 0, 1, 'a', 0, 0, 0, 6, '\\', 'x', '0', '1', 'f', 'f'}
+		assert.Equal(t, want, msgs[1].payload)
+		// DataRow: 2, NULL, NULL.
+		want = []byte{0, 3, 0, 0, 0, 1, '2', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		assert.Equal(t, want, msgs[2].payload)
+		assert.Equal(t, "SELECT 2\x00", string(msgs[3].payload))
+	}
+
+	// Set and empty query.
+	{
+		err := c.send(msgQuery, "SET application_name = 'psql'\x00")
+		assert.Nil(t, err)
+		msgs, err := c.readUntilReady()
+		assert.Nil(t, err)
+		assert.Equal(t, "CZ", msgTypes(msgs))
+		assert.Equal(t, "SET\x00", string(msgs[0].payload))
+
+		err = c.send(msgQuery, " ;\x00")
+		assert.Nil(t, err)
+		msgs, err = c.readUntilReady()
+		assert.Nil(t, err)
+		assert.Equal(t, "IZ", msgTypes(msgs))
+	}
+
+	// Error.
+	{
+		err := c.send(msgQuery, "select error\x00")
+		assert.Nil(t, err)
+		msgs, err := c.readUntilReady()
+		assert.Nil(t, err)
+		assert.Equal(t, "EZ", msgTypes(msgs))
+		assert.Contains(t, string(msgs[0].payload), "C42000\x00")
+	}
+
+	// Extended query protocol is unsupported.
+	{
+		err := c.send('P', "\x00select 1\x00\x00\x00")
+		assert.Nil(t, err)
+		err = c.send('B', "\x00\x00\x00\x00\x00\x00\x00\x00")
+		assert.Nil(t, err)
+		err = c.send(msgSync, "")
+		assert.Nil(t, err)
+		msgs, err := c.readUntilReady()
+		assert.Nil(t, err)
+		assert.Equal(t, "EZ", msgTypes(msgs))
+	}
+
+	// Terminate.
+	{
+		err := c.send(msgTerminate, "")
+		assert.Nil(t, err)
+		_, err = c.read()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestPgwireServerSessionCheck(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	handler := &mockHandler{denied: true}
+	l, err := NewListener(log, "127.0.0.1:0", nil, handler)
+	assert.Nil(t, err)
+	defer l.Close()
+	go l.Accept()
+
+	c := newPgClient(t, l.Addr(), false)
+	defer c.conn.Close()
+	err = c.startup("mock", "db1")
+	assert.Nil(t, err)
+	msg, err := c.read()
+	assert.Nil(t, err)
+	assert.Equal(t, byte(msgErrorResponse), msg.typ)
+	assert.Contains(t, string(msg.payload), "Access denied for user from host")
+	_, err = c.read()
+	assert.NotNil(t, err)
+}
+
+func TestPgwireServerTLS(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	handler := &mockHandler{}
+	l, err := NewListener(log, "127.0.0.1:0", testTLSConfig(t), handler)
+	assert.Nil(t, err)
+	defer l.Close()
+	go l.Accept()
+
+	c := newPgTLSClient(t, l.Addr())
+	defer c.conn.Close()
+	msgs := c.login(t, "mock", "mock")
+	assert.Equal(t, "RSSSSSSKZ", msgTypes(msgs))
+
+	err = c.send(msgQuery, "select 1\x00")
+	assert.Nil(t, err)
+	msgs, err = c.readUntilReady()
+	assert.Nil(t, err)
+	assert.Equal(t, "TDDCZ", msgTypes(msgs))
+}
+
+func TestPgwireLocalAddress(t *testing.T) {
+	assert.True(t, localAddress(&net.TCPAddr{IP: net.ParseIP("127.0.0.1")}))
+	assert.True(t, localAddress(&net.TCPAddr{IP: net.ParseIP("::1")}))
+	assert.False(t, localAddress(&net.TCPAddr{IP: net.ParseIP("192.168.0.1")}))
+}
@@ -0,0 +1,116 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package pgwire
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/xelabs/go-mysqlstack/sqldb"
+)
+
+// Translate used to translate the simple PostgreSQL SELECT to the MySQL dialect:
+// 1. "ident" is quoted as `ident`.
+// 2. The backslash in the string literal is escaped(standard_conforming_strings is on).
+// 3. The ::type casts are removed.
+// 4. ILIKE is rewritten to LIKE, the MySQL default collations are case-insensitive.
+func Translate(query string) (string, error) {
+	var buf bytes.Buffer
+	n := len(query)
+
+	for i := 0; i < n; {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			// String literal.
+			buf.WriteByte(ch)
+			i++
+			closed := false
+			for i < n {
+				c := query[i]
+				i++
+				if c == '\'' {
+					if i < n && query[i] == '\'' {
+						buf.WriteString("''")
+						i++
+						continue
+					}
+					closed = true
+					buf.WriteByte(c)
+					break
+				}
+				if c == '\\' {
+					buf.WriteByte('\\')
+				}
+				buf.WriteByte(c)
+			}
+			if !closed {
+				return "", sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, "unterminated quoted string")
+			}
+		case ch == '"':
+			// Quoted identifier.
+			buf.WriteByte('`')
+			i++
+			closed := false
+			for i < n {
+				c := query[i]
+				i++
+				if c == '"' {
+					if i < n && query[i] == '"' {
+						buf.WriteByte('"')
+						i++
+						continue
+					}
+					closed = true
+					break
+				}
+				if c == '`' {
+					buf.WriteByte('`')
+				}
+				buf.WriteByte(c)
+			}
+			if !closed {
+				return "", sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, "unterminated quoted identifier")
+			}
+			buf.WriteByte('`')
+		case ch == ':' && i+1 < n && query[i+1] == ':':
+			// Type cast, such as ::int, ::varchar(10), ::text[].
+			i += 2
+			for i < n && isIdentChar(query[i]) {
+				i++
+			}
+			if i < n && query[i] == '(' {
+				if end := strings.IndexByte(query[i:], ')'); end >= 0 {
+					i += end + 1
+				}
+			}
+			for i+1 < n && query[i] == '[' && query[i+1] == ']' {
+				i += 2
+			}
+		case isIdentChar(ch):
+			start := i
+			for i < n && isIdentChar(query[i]) {
+				i++
+			}
+			word := query[start:i]
+			if strings.EqualFold(word, "ilike") {
+				word = "LIKE"
+			}
+			buf.WriteString(word)
+		default:
+			buf.WriteByte(ch)
+			i++
+		}
+	}
+	return buf.String(), nil
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
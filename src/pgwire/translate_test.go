@@ -0,0 +1,63 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package pgwire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			`select "id", "Name" from "db"."t1" where id = 1`,
+			"select `id`, `Name` from `db`.`t1` where id = 1",
+		},
+		{
+			`select "a""b", "c` + "`" + `d" from t1`,
+			"select `a\"b`, `c``d` from t1",
+		},
+		{
+			`select id::text, '2019-01-01'::date, b::varchar(10), c::int[] from t1`,
+			"select id, '2019-01-01', b, c from t1",
+		},
+		{
+			`select * from t1 where name ilike 'a%' and b NOT ILIKE 'B%'`,
+			"select * from t1 where name LIKE 'a%' and b NOT LIKE 'B%'",
+		},
+		{
+			`select 'it''s', 'c:\dir', '"x"::int' from t1`,
+			`select 'it''s', 'c:\\dir', '"x"::int' from t1`,
+		},
+		{
+			`select a from t1 limit 10 offset 20`,
+			`select a from t1 limit 10 offset 20`,
+		},
+	}
+	for _, test := range tests {
+		got, err := Translate(test.query)
+		assert.Nil(t, err)
+		assert.Equal(t, test.want, got)
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	querys := []string{
+		`select 'abc from t1`,
+		`select "abc from t1`,
+	}
+	for _, query := range querys {
+		_, err := Translate(query)
+		assert.NotNil(t, err)
+	}
+}
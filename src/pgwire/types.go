@@ -0,0 +1,58 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package pgwire
+
+import (
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// The PostgreSQL type oids, see pg_type.h.
+const (
+	oidInt8      = 20
+	oidInt2      = 21
+	oidInt4      = 23
+	oidText      = 25
+	oidFloat4    = 700
+	oidFloat8    = 701
+	oidDate      = 1082
+	oidTime      = 1083
+	oidTimestamp = 1114
+	oidNumeric   = 1700
+	oidBytea     = 17
+)
+
+// typeOID returns the PostgreSQL type oid and size of the MySQL type, -1 means variable size.
+func typeOID(typ querypb.Type) (uint32, int16) {
+	switch typ {
+	case sqltypes.Int8, sqltypes.Uint8, sqltypes.Int16:
+		return oidInt2, 2
+	case sqltypes.Uint16, sqltypes.Int24, sqltypes.Uint24, sqltypes.Int32, sqltypes.Year:
+		return oidInt4, 4
+	case sqltypes.Uint32, sqltypes.Int64, sqltypes.Uint64:
+		// The uint64 may overflow the int8, it's still sent as the text.
+		return oidInt8, 8
+	case sqltypes.Float32:
+		return oidFloat4, 4
+	case sqltypes.Float64:
+		return oidFloat8, 8
+	case sqltypes.Decimal:
+		return oidNumeric, -1
+	case sqltypes.Date:
+		return oidDate, 4
+	case sqltypes.Time:
+		return oidTime, 8
+	case sqltypes.Datetime, sqltypes.Timestamp:
+		return oidTimestamp, 8
+	}
+	if sqltypes.IsBinary(typ) {
+		return oidBytea, -1
+	}
+	return oidText, -1
+}
@@ -0,0 +1,34 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+var (
+	createTableCHashRegexp = regexp.MustCompile(`(?is)^create\s+table\s.*\bpartition\s+by\s+chash\s*\(`)
+)
+
+// IsCreateTableCHash returns true if the query may be the CREATE TABLE ... PARTITION BY CHASH.
+func IsCreateTableCHash(query string) bool {
+	return createTableCHashRegexp.MatchString(query)
+}
+
+// ParseCreateTableCHash used to parse the CREATE TABLE ... PARTITION BY CHASH(column) [PARTITIONS num], the parser doesn't
+// support it so the CREATE TABLE before the PARTITION BY is parsed by the parser, the DDL has the column as the PartitionName.
+func ParseCreateTableCHash(query string) (*sqlparser.DDL, error) {
+	cth, err := ParseCreateTableHash(query, "chash")
+	if err != nil {
+		return nil, err
+	}
+	return cth.Create, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestParseCreateTableCHash(t *testing.T) {
+	query := "create table if not exists db.t1(id int, name varchar(10) default 'partition by chash(x)') engine=innodb PARTITION BY CHASH(id);"
+	assert.True(t, IsCreateTableCHash(query))
+	ddl, err := ParseCreateTableCHash(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "id", ddl.PartitionName)
+	assert.True(t, ddl.IfNotExists)
+	assert.Equal(t, "create table if not exists db.t1 (\n\t`id` int,\n\t`name` varchar(10) default 'partition by chash(x)'\n) engine=innodb", sqlparser.String(ddl))
+
+	// Errors.
+	{
+		querys := []string{
+			"create table t1(id int) partition by hash(id)",
+			"create table t1(id int) partition by chash",
+			"create table t1(id int) partition by chash(1)",
+			"create table t1(id int) partition by chash(id) global",
+			"create table t1 partition by chash(id)",
+		}
+		wants := []string{
+			"unsupported: query[create table t1(id int) partition by hash(id)].is.not.create.table.partition.by.chash",
+			"create.table.partition.by.chash.syntax.error.at.the.end",
+			"create.table.partition.by.chash.syntax.error.near[1]",
+			"create.table.partition.by.chash.syntax.error.near[global]",
+			"syntax error at position 17",
+		}
+		for i, query := range querys {
+			_, err := ParseCreateTableCHash(query)
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+		assert.False(t, IsCreateTableCHash("create table t1(id int) partition by hash(id)"))
+	}
+}
+
+func TestCHashTablePlan(t *testing.T) {
+	querys := []string{
+		"select * from CH where id=1",
+		"select * from CH where id in (1, 4)",
+		"select * from CH where id>1",
+		"select * from CH join CH2 on CH.id=CH2.id where CH.id=1",
+	}
+	counts := []int{1, 2, 2, 1}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	// CH2 has the same ring as CH.
+	ch2 := router.MockTableCHConfig()
+	ch2.Name = "CH2"
+	ch2.Partitions[0].Table, ch2.Partitions[1].Table = "CH2_0000", "CH2_0001"
+	err := route.AddForTest(database, router.MockTableCHConfig(), ch2)
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err, query)
+		merge, ok := plan.Root.(*MergeNode)
+		assert.True(t, ok, query)
+		assert.Equal(t, counts[i], len(merge.Querys), query)
+	}
+}
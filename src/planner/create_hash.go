@@ -0,0 +1,76 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+var (
+	createTableHashPartitionsRegexp = regexp.MustCompile(`(?is)^create\s+table\s.*\bpartition\s+by\s+hash\s*\(.*\)\s*partitions\b`)
+)
+
+// CreateTableHash is the CREATE TABLE ... PARTITION BY HASH|CHASH(column) [PARTITIONS num], the parser ignores the tokens
+// after the PARTITION BY HASH(column) so the CREATE TABLE before the PARTITION BY is parsed by the parser and the partitions here.
+type CreateTableHash struct {
+	Create *sqlparser.DDL
+	Column string
+	// Partitions is the number of the segments of the table, 0 means the router config.
+	Partitions int
+}
+
+// IsCreateTableHashPartitions returns true if the query may be the CREATE TABLE ... PARTITION BY HASH(column) PARTITIONS num.
+func IsCreateTableHashPartitions(query string) bool {
+	return createTableHashPartitionsRegexp.MatchString(query)
+}
+
+// ParseCreateTableHash used to parse the CREATE TABLE ... PARTITION BY method(column) [PARTITIONS num],
+// the method is the 'hash' or the 'chash', the DDL has the column as the PartitionName.
+func ParseCreateTableHash(query string, method string) (*CreateTableHash, error) {
+	ddl, tokens, err := splitPartitionBy(query, method)
+	if err != nil {
+		return nil, err
+	}
+	p := &listParser{tokens: tokens, method: method}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	column, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	cth := &CreateTableHash{Create: ddl, Column: column}
+	// The tokenizer scans the PARTITIONS as the identifier.
+	if p.pos < len(p.tokens) && p.tokens[p.pos].typ == sqlparser.ID && strings.EqualFold(string(p.tokens[p.pos].val), "partitions") {
+		p.pos++
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].typ != sqlparser.INTEGRAL {
+			return nil, p.syntaxError()
+		}
+		if cth.Partitions, err = strconv.Atoi(string(p.tokens[p.pos].val)); err != nil || cth.Partitions == 0 {
+			return nil, p.syntaxError()
+		}
+		p.pos++
+	}
+	p.accept(';')
+	if p.pos < len(p.tokens) {
+		return nil, p.syntaxError()
+	}
+	ddl.PartitionName = column
+	if method == "hash" {
+		ddl.TableSpec.Options.Type = sqlparser.PartitionTableType
+	}
+	return cth, nil
+}
@@ -0,0 +1,68 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+func TestParseCreateTableHash(t *testing.T) {
+	// HASH.
+	{
+		query := "create table db.t1(id int, b varchar(10)) engine=innodb partition by hash(id) partitions 64;"
+		assert.True(t, IsCreateTableHashPartitions(query))
+		cth, err := ParseCreateTableHash(query, "hash")
+		assert.Nil(t, err)
+		assert.Equal(t, "id", cth.Column)
+		assert.Equal(t, 64, cth.Partitions)
+		assert.Equal(t, "id", cth.Create.PartitionName)
+		assert.Equal(t, sqlparser.PartitionTableType, cth.Create.TableSpec.Options.Type)
+	}
+
+	// CHASH.
+	{
+		query := "create table t1(id int) PARTITION BY CHASH(id) PARTITIONS 8"
+		assert.False(t, IsCreateTableHashPartitions(query))
+		cth, err := ParseCreateTableHash(query, "chash")
+		assert.Nil(t, err)
+		assert.Equal(t, 8, cth.Partitions)
+		ddl, err := ParseCreateTableCHash(query)
+		assert.Nil(t, err)
+		assert.Equal(t, "id", ddl.PartitionName)
+
+		// Without the PARTITIONS.
+		cth, err = ParseCreateTableHash("create table t1(id int) partition by chash(id)", "chash")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, cth.Partitions)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"create table t1(id int) partition by hash(id) partitions",
+			"create table t1(id int) partition by hash(id) partitions 0",
+			"create table t1(id int) partition by hash(id) partitions x",
+			"create table t1(id int) partition by hash(id) partitions 4 global",
+		}
+		wants := []string{
+			"create.table.partition.by.hash.syntax.error.at.the.end",
+			"create.table.partition.by.hash.syntax.error.near[0]",
+			"create.table.partition.by.hash.syntax.error.near[x]",
+			"create.table.partition.by.hash.syntax.error.near[global]",
+		}
+		for i, query := range querys {
+			assert.True(t, IsCreateTableHashPartitions(query), query)
+			_, err := ParseCreateTableHash(query, "hash")
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+	}
+}
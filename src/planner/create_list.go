@@ -0,0 +1,239 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+	"strings"
+
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+var (
+	createTableListRegexp = regexp.MustCompile(`(?is)^create\s+table\s.*\bpartition\s+by\s+list\s*\(`)
+)
+
+// CreateTableList is the CREATE TABLE ... PARTITION BY LIST(column) (PARTITION backend VALUES IN (value,...),...),
+// the parser doesn't support it so the CREATE TABLE before the PARTITION BY is parsed by the parser and the partitions here.
+// The partition name is the backend the rows of the values are placed on.
+type CreateTableList struct {
+	Create     *sqlparser.DDL
+	Column     string
+	Partitions []router.ListPartition
+}
+
+// IsCreateTableList returns true if the query may be the CREATE TABLE ... PARTITION BY LIST.
+func IsCreateTableList(query string) bool {
+	return createTableListRegexp.MatchString(query)
+}
+
+type listToken struct {
+	typ   int
+	val   []byte
+	start int
+}
+
+// ParseCreateTableList used to split the CREATE TABLE ... PARTITION BY LIST at the PARTITION BY out of the parentheses,
+// the values of the partitions must be the integer or string constants.
+func ParseCreateTableList(query string) (*CreateTableList, error) {
+	ddl, tokens, err := splitPartitionBy(query, "list")
+	if err != nil {
+		return nil, err
+	}
+	ctl := &CreateTableList{Create: ddl}
+	p := &listParser{tokens: tokens, method: "list"}
+	if err := ctl.parse(p); err != nil {
+		return nil, err
+	}
+	ddl.PartitionName = ctl.Column
+	return ctl, nil
+}
+
+// splitPartitionBy used to split the CREATE TABLE at the PARTITION BY method out of the parentheses,
+// the CREATE TABLE before it is parsed by the parser and the tokens after it are returned.
+func splitPartitionBy(query string, method string) (*sqlparser.DDL, []listToken, error) {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	// start returns the start offset of the token after the offset.
+	start := func(from int) int {
+		for from < len(query) && strings.IndexByte(" \t\r\n", query[from]) != -1 {
+			from++
+		}
+		return from
+	}
+
+	var tokens []listToken
+	depth, prev, partitionAt := 0, 0, -1
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			break
+		}
+		tokens = append(tokens, listToken{typ: typ, val: val, start: start(prev)})
+		// The tokenizer has read one byte ahead.
+		prev = tokenizer.Position - 1
+		switch typ {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		n := len(tokens)
+		if partitionAt == -1 && depth == 0 && n >= 3 && tokens[n-3].typ == sqlparser.PARTITION && tokens[n-2].typ == sqlparser.BY &&
+			(tokens[n-1].typ == sqlparser.ID || tokens[n-1].typ == sqlparser.HASH) && strings.EqualFold(string(tokens[n-1].val), method) {
+			partitionAt = n - 3
+		}
+	}
+	if partitionAt == -1 {
+		return nil, nil, errors.Errorf("unsupported: query[%s].is.not.create.table.partition.by.%s", query, method)
+	}
+
+	create, err := parseCreateTable(strings.TrimSpace(query[:tokens[partitionAt].start]))
+	if err != nil {
+		return nil, nil, err
+	}
+	ddl, ok := create.(*sqlparser.DDL)
+	if !ok || ddl.Action != sqlparser.CreateTableStr || ddl.TableSpec == nil {
+		return nil, nil, errors.Errorf("unsupported: query[%s].is.not.create.table.partition.by.%s", query, method)
+	}
+	return ddl, tokens[partitionAt+3:], nil
+}
+
+// parse used to parse the '(column) (PARTITION backend VALUES IN (value,...),...)'.
+func (ctl *CreateTableList) parse(p *listParser) error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	column, err := p.ident()
+	if err != nil {
+		return err
+	}
+	ctl.Column = column
+	if err := p.expect(')'); err != nil {
+		return err
+	}
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	for {
+		if err := p.expect(sqlparser.PARTITION); err != nil {
+			return err
+		}
+		backend, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(sqlparser.VALUES); err != nil {
+			return err
+		}
+		if err := p.expect(sqlparser.IN); err != nil {
+			return err
+		}
+		if err := p.expect('('); err != nil {
+			return err
+		}
+		part := router.ListPartition{Backend: backend}
+		for {
+			val, err := p.value()
+			if err != nil {
+				return err
+			}
+			part.Values = append(part.Values, val)
+			if !p.accept(',') {
+				break
+			}
+		}
+		if err := p.expect(')'); err != nil {
+			return err
+		}
+		ctl.Partitions = append(ctl.Partitions, part)
+		if !p.accept(',') {
+			break
+		}
+	}
+	if err := p.expect(')'); err != nil {
+		return err
+	}
+	p.accept(';')
+	if p.pos < len(p.tokens) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+// listParser used to parse the tokens after the PARTITION BY method.
+type listParser struct {
+	tokens []listToken
+	pos    int
+	method string
+}
+
+func (p *listParser) syntaxError() error {
+	if p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		near := string(tok.val)
+		// The single-character tokens have no value.
+		if near == "" && tok.typ < 256 {
+			near = string(rune(tok.typ))
+		}
+		return errors.Errorf("create.table.partition.by.%s.syntax.error.near[%s]", p.method, near)
+	}
+	return errors.Errorf("create.table.partition.by.%s.syntax.error.at.the.end", p.method)
+}
+
+func (p *listParser) accept(typ int) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].typ == typ {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *listParser) expect(typ int) error {
+	if !p.accept(typ) {
+		return p.syntaxError()
+	}
+	return nil
+}
+
+func (p *listParser) ident() (string, error) {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].typ == sqlparser.ID {
+		p.pos++
+		return string(p.tokens[p.pos-1].val), nil
+	}
+	return "", p.syntaxError()
+}
+
+// value returns the integer, float or string constant, the numbers can be signed.
+func (p *listParser) value() (*sqlparser.SQLVal, error) {
+	sign := ""
+	if p.accept('-') {
+		sign = "-"
+	} else {
+		p.accept('+')
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, p.syntaxError()
+	}
+	tok := p.tokens[p.pos]
+	switch {
+	case tok.typ == sqlparser.INTEGRAL:
+		p.pos++
+		return sqlparser.NewIntVal([]byte(sign + string(tok.val))), nil
+	case tok.typ == sqlparser.FLOAT:
+		p.pos++
+		return sqlparser.NewFloatVal([]byte(sign + string(tok.val))), nil
+	case tok.typ == sqlparser.STRING && sign == "":
+		p.pos++
+		return sqlparser.NewStrVal(tok.val), nil
+	}
+	return nil, p.syntaxError()
+}
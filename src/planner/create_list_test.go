@@ -0,0 +1,103 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestParseCreateTableList(t *testing.T) {
+	query := "create table if not exists db.t1(id int, name varchar(10) default 'partition by list(x)') engine=innodb " +
+		"PARTITION BY LIST(id) (PARTITION backend1 VALUES IN (1, -3, '5'), PARTITION `backend-2` VALUES IN (2.5, 'sh'));"
+	assert.True(t, IsCreateTableList(query))
+	ctl, err := ParseCreateTableList(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "id", ctl.Column)
+	assert.Equal(t, "id", ctl.Create.PartitionName)
+	assert.True(t, ctl.Create.IfNotExists)
+	assert.Equal(t, "db", ctl.Create.Table.Qualifier.String())
+	assert.Equal(t, "create table if not exists db.t1 (\n\t`id` int,\n\t`name` varchar(10) default 'partition by list(x)'\n) engine=innodb", sqlparser.String(ctl.Create))
+	assert.Equal(t, []router.ListPartition{
+		{Backend: "backend1", Values: []*sqlparser.SQLVal{sqlparser.NewIntVal([]byte("1")), sqlparser.NewIntVal([]byte("-3")), sqlparser.NewStrVal([]byte("5"))}},
+		{Backend: "backend-2", Values: []*sqlparser.SQLVal{sqlparser.NewFloatVal([]byte("2.5")), sqlparser.NewStrVal([]byte("sh"))}},
+	}, ctl.Partitions)
+
+	// Errors.
+	{
+		querys := []string{
+			"create table t1(id int) partition by hash(id)",
+			"create table t1(id int) partition by list(id)",
+			"create table t1(id int) partition by list(id) (partition backend1 values in ())",
+			"create table t1(id int) partition by list(id) (partition backend1 values in (a))",
+			"create table t1(id int) partition by list(id) (partition backend1 values in (-'a'))",
+			"create table t1(id int) partition by list(id) (partition backend1 values (1))",
+			"create table t1(id int) partition by list(id) (partition backend1 values in (1)) global",
+			"create table t1 partition by list(id) (partition backend1 values in (1))",
+		}
+		wants := []string{
+			"unsupported: query[create table t1(id int) partition by hash(id)].is.not.create.table.partition.by.list",
+			"create.table.partition.by.list.syntax.error.at.the.end",
+			"create.table.partition.by.list.syntax.error.near[)]",
+			"create.table.partition.by.list.syntax.error.near[a]",
+			"create.table.partition.by.list.syntax.error.near[a]",
+			"create.table.partition.by.list.syntax.error.near[(]",
+			"create.table.partition.by.list.syntax.error.near[global]",
+			"syntax error at position 17",
+		}
+		for i, query := range querys {
+			_, err := ParseCreateTableList(query)
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+		assert.False(t, IsCreateTableList("create table t1(id int) partition by hash(id)"))
+	}
+}
+
+func TestListTablePlan(t *testing.T) {
+	querys := []string{
+		"select * from L where id=1",
+		"select * from L where id in (1, 2)",
+		"select * from L where id>1",
+		"select * from L as a join L as b on a.id=b.id where a.id='beijing'",
+	}
+	counts := []int{1, 2, 2, 1}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableLConfig())
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err, query)
+		merge, ok := plan.Root.(*MergeNode)
+		assert.True(t, ok, query)
+		assert.Equal(t, counts[i], len(merge.Querys), query)
+	}
+
+	// The value not in the lists.
+	{
+		query := "select * from L where id=5"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Equal(t, "list.table[L].has.no.partition.for.value[5]", err.Error())
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// TableOptions is the table options after the column definitions of the CREATE TABLE, the parser only supports
+// the ENGINE, AUTO_INCREMENT and DEFAULT CHARSET in order and drops the AUTO_INCREMENT.
+type TableOptions struct {
+	Engine  string
+	Charset string
+	// AutoIncrement is the AUTO_INCREMENT start value, 0 if it's not set.
+	AutoIncrement uint64
+	// Others are the options except the ENGINE and the charset in the query text, such as "ROW_FORMAT=DYNAMIC"
+	// and "COMMENT='x'", which are sent to the backends verbatim.
+	Others []string
+}
+
+// String returns the other options, which follow the options formatted by the parser in the segment DDL.
+func (o *TableOptions) String() string {
+	return strings.Join(o.Others, " ")
+}
+
+type optionToken struct {
+	typ   int
+	val   []byte
+	start int
+	end   int
+}
+
+// SplitTableOptions used to split the table options out of the CREATE TABLE (create_definition,...), it returns the query
+// without the options and the options, nil if the query isn't the CREATE TABLE with the column definitions or has no options.
+// The options end at the PARTITION BY, GLOBAL, SINGLE, DISTRIBUTED BY, [AS] SELECT or the end of the query.
+func SplitTableOptions(query string) (string, *TableOptions, error) {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	// start returns the start offset of the token after the offset.
+	start := func(from int) int {
+		for from < len(query) && strings.IndexByte(" \t\r\n", query[from]) != -1 {
+			from++
+		}
+		return from
+	}
+
+	var tokens []optionToken
+	prev := 0
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			break
+		}
+		// The tokenizer has read one byte ahead.
+		tokens = append(tokens, optionToken{typ: typ, val: val, start: start(prev), end: tokenizer.Position - 1})
+		prev = tokenizer.Position - 1
+	}
+	if len(tokens) < 2 || tokens[0].typ != sqlparser.CREATE || tokens[1].typ != sqlparser.TABLE {
+		return query, nil, nil
+	}
+
+	// The column definitions are in the first parentheses.
+	i := 2
+	for i < len(tokens) && tokens[i].typ != '(' {
+		if tokens[i].typ == sqlparser.LIKE {
+			return query, nil, nil
+		}
+		i++
+	}
+	if i+1 >= len(tokens) || tokens[i+1].typ == sqlparser.LIKE || tokens[i+1].typ == sqlparser.SELECT {
+		return query, nil, nil
+	}
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].typ {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if i >= len(tokens) {
+		return query, nil, nil
+	}
+
+	opts := &TableOptions{}
+	from := i + 1
+	pos := from
+options:
+	for pos < len(tokens) {
+		switch tokens[pos].typ {
+		case sqlparser.PARTITION, sqlparser.GLOBAL, sqlparser.SINGLE, sqlparser.AS, sqlparser.SELECT, '(', ';':
+			break options
+		case ',':
+			pos++
+			continue
+		case sqlparser.ID:
+			if strings.EqualFold(string(tokens[pos].val), "distributed") {
+				break options
+			}
+		}
+		next, err := opts.parse(query, tokens, pos)
+		if err != nil {
+			return "", nil, err
+		}
+		pos = next
+	}
+	if pos == from {
+		return query, nil, nil
+	}
+	stripped := strings.TrimSpace(query[:tokens[from].start])
+	if pos < len(tokens) {
+		stripped += " " + query[tokens[pos].start:]
+	}
+	return stripped, opts, nil
+}
+
+// parse used to parse the '[DEFAULT] name [=] value' option at the pos, it returns the pos after the option.
+func (o *TableOptions) parse(query string, tokens []optionToken, pos int) (int, error) {
+	begin := pos
+	if tokens[pos].typ == sqlparser.DEFAULT {
+		pos++
+	}
+	if pos >= len(tokens) {
+		return 0, errors.Errorf("create.table.options.syntax.error.at.the.end")
+	}
+	name := strings.ToUpper(string(tokens[pos].val))
+	if tokens[pos].typ == sqlparser.CHARACTER && pos+1 < len(tokens) && tokens[pos+1].typ == sqlparser.SET {
+		name = "CHARSET"
+		pos++
+	}
+	pos++
+	if pos < len(tokens) && tokens[pos].typ == '=' {
+		pos++
+	}
+	if pos >= len(tokens) {
+		return 0, errors.Errorf("create.table.options.option[%s].value.is.missing", name)
+	}
+	value := tokens[pos]
+	// The value such as UNION=(t1, t2) is in the parentheses.
+	if value.typ == '(' {
+		depth := 0
+		for ; pos < len(tokens); pos++ {
+			switch tokens[pos].typ {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+		}
+		if pos >= len(tokens) {
+			return 0, errors.Errorf("create.table.options.option[%s].value.is.missing", name)
+		}
+	}
+	end := tokens[pos].end
+	pos++
+
+	switch name {
+	case "ENGINE":
+		o.Engine = string(value.val)
+		return pos, nil
+	case "CHARSET":
+		o.Charset = string(value.val)
+		return pos, nil
+	case "AUTO_INCREMENT":
+		n, err := strconv.ParseUint(string(value.val), 10, 64)
+		if err != nil || value.typ != sqlparser.INTEGRAL {
+			return 0, errors.Errorf("create.table.options.auto_increment[%s].must.be.the.unsigned.integer", value.val)
+		}
+		o.AutoIncrement = n
+	}
+	o.Others = append(o.Others, query[tokens[begin].start:end])
+	return pos, nil
+}
+
+// parseCreateTable used to parse the CREATE TABLE without the table options, the ENGINE and the charset of the options
+// are set to the DDL.
+func parseCreateTable(query string) (sqlparser.Statement, error) {
+	stripped, opts, err := SplitTableOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := sqlparser.Parse(stripped)
+	if err != nil {
+		return nil, err
+	}
+	if ddl, ok := stmt.(*sqlparser.DDL); ok && opts != nil && ddl.TableSpec != nil {
+		ddl.TableSpec.Options.Engine = opts.Engine
+		ddl.TableSpec.Options.Charset = opts.Charset
+	}
+	return stmt, nil
+}
+
+// ParseCreateTable used to parse the CREATE TABLE (create_definition,...) whose table options the parser doesn't support,
+// such as the ROW_FORMAT, KEY_BLOCK_SIZE and COMMENT.
+func ParseCreateTable(query string) (*sqlparser.DDL, *TableOptions, error) {
+	_, opts, err := SplitTableOptions(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	stmt, err := parseCreateTable(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	ddl, ok := stmt.(*sqlparser.DDL)
+	if !ok || ddl.Action != sqlparser.CreateTableStr || ddl.TableSpec == nil {
+		return nil, nil, errors.Errorf("unsupported: query[%s].is.not.create.table", query)
+	}
+	return ddl, opts, nil
+}
+
+// IsAlterTableComment returns true if the query is the ALTER TABLE tbl_name COMMENT [=] 'string' which the parser
+// takes as the unsupported ALTER, the query is sent to the segments with the table renamed.
+func IsAlterTableComment(query string) bool {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	var tokens []optionToken
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 {
+			break
+		}
+		if typ == sqlparser.LEX_ERROR {
+			return false
+		}
+		tokens = append(tokens, optionToken{typ: typ, val: val})
+	}
+	if len(tokens) > 0 && tokens[len(tokens)-1].typ == ';' {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	pos := 0
+	next := func(typ int) bool {
+		if pos < len(tokens) && tokens[pos].typ == typ {
+			pos++
+			return true
+		}
+		return false
+	}
+	if !next(sqlparser.ALTER) {
+		return false
+	}
+	next(sqlparser.IGNORE)
+	if !next(sqlparser.TABLE) || !next(sqlparser.ID) {
+		return false
+	}
+	if next('.') && !next(sqlparser.ID) {
+		return false
+	}
+	for {
+		if !next(sqlparser.COMMENT_KEYWORD) {
+			return false
+		}
+		next('=')
+		if !next(sqlparser.STRING) {
+			return false
+		}
+		if pos == len(tokens) {
+			return true
+		}
+		if !next(',') {
+			return false
+		}
+	}
+}
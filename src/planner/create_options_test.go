@@ -0,0 +1,151 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+func TestSplitTableOptions(t *testing.T) {
+	tests := []struct {
+		query         string
+		stripped      string
+		engine        string
+		charset       string
+		autoIncrement uint64
+		others        []string
+	}{
+		{
+			query:         "create table t1(a bigint auto_increment, b int) engine=innodb auto_increment=100 default charset=utf8",
+			stripped:      "create table t1(a bigint auto_increment, b int)",
+			engine:        "innodb",
+			charset:       "utf8",
+			autoIncrement: 100,
+			others:        []string{"auto_increment=100"},
+		},
+		{
+			query:    "CREATE TABLE t1(a int) ROW_FORMAT=DYNAMIC KEY_BLOCK_SIZE=8 COMMENT='the t1, (x)' ENGINE InnoDB",
+			stripped: "CREATE TABLE t1(a int)",
+			engine:   "InnoDB",
+			others:   []string{"ROW_FORMAT=DYNAMIC", "KEY_BLOCK_SIZE=8", "COMMENT='the t1, (x)'"},
+		},
+		{
+			query:    "create table t1(a int) character set = utf8mb4, collate=utf8mb4_bin, stats_persistent=default partition by hash(a)",
+			stripped: "create table t1(a int) partition by hash(a)",
+			charset:  "utf8mb4",
+			others:   []string{"collate=utf8mb4_bin", "stats_persistent=default"},
+		},
+		{
+			query:    "create table t1(a int) default collate utf8_bin union=(t2, t3) global;",
+			stripped: "create table t1(a int) global;",
+			others:   []string{"default collate utf8_bin", "union=(t2, t3)"},
+		},
+		{
+			query:    "create table t1(a int, key(a)) comment 'x' as select 1 as a",
+			stripped: "create table t1(a int, key(a)) as select 1 as a",
+			others:   []string{"comment 'x'"},
+		},
+	}
+	for _, test := range tests {
+		stripped, opts, err := SplitTableOptions(test.query)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.stripped, stripped, test.query)
+		assert.Equal(t, test.engine, opts.Engine, test.query)
+		assert.Equal(t, test.charset, opts.Charset, test.query)
+		assert.Equal(t, test.autoIncrement, opts.AutoIncrement, test.query)
+		assert.Equal(t, test.others, opts.Others, test.query)
+	}
+
+	// No options.
+	{
+		querys := []string{
+			"create table t1(a int)",
+			"create table t1(a int) partition by hash(a)",
+			"create table t1 like t2",
+			"create table t1 (like t2)",
+			"create database db1",
+			"select 1",
+		}
+		for _, query := range querys {
+			stripped, opts, err := SplitTableOptions(query)
+			assert.Nil(t, err, query)
+			assert.Nil(t, opts, query)
+			assert.Equal(t, query, stripped)
+		}
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"create table t1(a int) comment",
+			"create table t1(a int) auto_increment='x'",
+			"create table t1(a int) union=(t2",
+		}
+		wants := []string{
+			"create.table.options.option[COMMENT].value.is.missing",
+			"create.table.options.auto_increment[x].must.be.the.unsigned.integer",
+			"create.table.options.option[UNION].value.is.missing",
+		}
+		for i, query := range querys {
+			_, _, err := SplitTableOptions(query)
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+	}
+}
+
+func TestParseCreateTable(t *testing.T) {
+	query := "create table db.t1(a bigint auto_increment, b int) engine=tokudb row_format=compressed default charset=utf8mb4 partition by hash(b)"
+	ddl, opts, err := ParseCreateTable(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "b", ddl.PartitionName)
+	assert.Equal(t, "create table db.t1 (\n\t`a` bigint auto_increment,\n\t`b` int\n) engine=tokudb default charset=utf8mb4", sqlparser.String(ddl))
+	assert.Equal(t, "row_format=compressed", opts.String())
+
+	// The sub-parsers.
+	{
+		ctl, err := ParseCreateTableList("create table t1(a int) row_format=dynamic engine=innodb partition by list(a) (partition backend1 values in (1))")
+		assert.Nil(t, err)
+		assert.Equal(t, "innodb", ctl.Create.TableSpec.Options.Engine)
+		cts, err := ParseCreateTableSelect("create table t1(a int) comment='x' select 1 as a")
+		assert.Nil(t, err)
+		assert.Equal(t, "t1", cts.Create.Table.Name.String())
+	}
+
+	// Errors.
+	{
+		_, _, err := ParseCreateTable("create table t1(a int) row_format=dynamic comment")
+		assert.NotNil(t, err)
+		_, _, err = ParseCreateTable("create table t1(a int,) row_format=dynamic")
+		assert.NotNil(t, err)
+		_, _, err = ParseCreateTable("create database db1")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestIsAlterTableComment(t *testing.T) {
+	querys := []struct {
+		query string
+		ok    bool
+	}{
+		{"alter table t1 comment='the orders'", true},
+		{"ALTER TABLE `db`.`t1` COMMENT 'x';", true},
+		{"alter ignore table t1 comment = \"x\", comment='y'", true},
+		{"alter table t1 comment", false},
+		{"alter table t1 comment='x', engine=innodb", false},
+		{"alter table t1 engine=innodb", false},
+		{"alter table t1 modify column a int comment 'x'", false},
+		{"create table t1(a int) comment='x'", false},
+	}
+	for _, q := range querys {
+		assert.Equal(t, q.ok, IsAlterTableComment(q.query), q.query)
+	}
+}
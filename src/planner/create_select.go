@@ -0,0 +1,108 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+var (
+	createTableSelectRegexp = regexp.MustCompile(`(?is)^create\s+table\s.*\bselect\b`)
+)
+
+// CreateTableSelect is the CREATE TABLE ... [AS] SELECT, the parser doesn't support it so it's split into
+// the CREATE TABLE which creates the segments by the DDL plan and the SELECT whose rows are inserted into the table.
+type CreateTableSelect struct {
+	Create      *sqlparser.DDL
+	CreateQuery string
+	Select      sqlparser.SelectStatement
+	SelectQuery string
+}
+
+// IsCreateTableSelect returns true if the query may be the CREATE TABLE ... [AS] SELECT.
+func IsCreateTableSelect(query string) bool {
+	return createTableSelectRegexp.MatchString(query)
+}
+
+// ParseCreateTableSelect used to split the CREATE TABLE ... [AS] SELECT at the first SELECT out of the parentheses,
+// the column definitions of the table are required since the segments are created before the select is executed.
+func ParseCreateTableSelect(query string) (*CreateTableSelect, error) {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	// end returns the end offset of the last scanned token, the tokenizer has read one byte ahead.
+	end := func() int {
+		return tokenizer.Position - 1
+	}
+	// start returns the start offset of the token after the offset.
+	start := func(from int) int {
+		for from < len(query) && strings.IndexByte(" \t\r\n", query[from]) != -1 {
+			from++
+		}
+		return from
+	}
+
+	// The SELECT is at the top level, the AS before it belongs to neither part.
+	depth, prev, asStart, createEnd, selectStart := 0, 0, -1, -1, -1
+	for selectStart == -1 {
+		typ, _ := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			break
+		}
+		from := start(prev)
+		prev = end()
+		switch typ {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sqlparser.SELECT:
+			if depth == 0 {
+				selectStart, createEnd = from, from
+				if asStart != -1 {
+					createEnd = asStart
+				}
+			}
+		}
+		asStart = -1
+		if typ == sqlparser.AS && depth == 0 {
+			asStart = from
+		}
+	}
+	if selectStart == -1 {
+		return nil, errors.Errorf("unsupported: query[%s].is.not.create.table.select", query)
+	}
+
+	cts := &CreateTableSelect{
+		CreateQuery: strings.TrimSpace(query[:createEnd]),
+		SelectQuery: strings.TrimSpace(query[selectStart:]),
+	}
+	create, err := parseCreateTable(cts.CreateQuery)
+	if err != nil {
+		return nil, errors.Errorf("unsupported: create.table.select.needs.the.column.definitions:%v", err)
+	}
+	ddl, ok := create.(*sqlparser.DDL)
+	if !ok || ddl.Action != sqlparser.CreateTableStr || ddl.TableSpec == nil {
+		return nil, errors.Errorf("unsupported: query[%s].is.not.create.table.select", query)
+	}
+	sel, err := sqlparser.Parse(cts.SelectQuery)
+	if err != nil {
+		return nil, err
+	}
+	switch sel := sel.(type) {
+	case *sqlparser.Select, *sqlparser.Union:
+		cts.Select = sel.(sqlparser.SelectStatement)
+	default:
+		return nil, errors.Errorf("unsupported: query[%s].is.not.create.table.select", query)
+	}
+	cts.Create = ddl
+	return cts, nil
+}
@@ -0,0 +1,67 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+func TestParseCreateTableSelect(t *testing.T) {
+	querys := []string{
+		"create table t2(id int, b int) partition by hash(id) as select id, b from t1 where b > 1",
+		"CREATE TABLE IF NOT EXISTS db.t2 (id int, name varchar(10) default 'as select') GLOBAL SELECT id, name FROM t1",
+		"create table t2(id int primary key, b int) select id, max(b) as b from t1 group by id union all select id, b from t3",
+	}
+	creates := []string{
+		"create table t2(id int, b int) partition by hash(id)",
+		"CREATE TABLE IF NOT EXISTS db.t2 (id int, name varchar(10) default 'as select') GLOBAL",
+		"create table t2(id int primary key, b int)",
+	}
+	selects := []string{
+		"select id, b from t1 where b > 1",
+		"SELECT id, name FROM t1",
+		"select id, max(b) as b from t1 group by id union all select id, b from t3",
+	}
+	for i, query := range querys {
+		assert.True(t, IsCreateTableSelect(query))
+		cts, err := ParseCreateTableSelect(query)
+		assert.Nil(t, err, query)
+		assert.Equal(t, creates[i], cts.CreateQuery)
+		assert.Equal(t, selects[i], cts.SelectQuery)
+		assert.Equal(t, sqlparser.CreateTableStr, cts.Create.Action)
+	}
+	cts, err := ParseCreateTableSelect(querys[1])
+	assert.Nil(t, err)
+	assert.True(t, cts.Create.IfNotExists)
+	assert.Equal(t, "db", cts.Create.Table.Qualifier.String())
+	_, ok := cts.Select.(*sqlparser.Select)
+	assert.True(t, ok)
+
+	// Errors.
+	{
+		querys := []string{
+			"create table t2 as select id, b from t1",
+			"create table t2(id int, b int) partition by hash(id) as (select id, b from t1)",
+			"create table t2(id int, b int) partition by hash(id) as select from",
+		}
+		wants := []string{
+			"unsupported: create.table.select.needs.the.column.definitions:syntax error at position 17",
+			"unsupported: query[create table t2(id int, b int) partition by hash(id) as (select id, b from t1)].is.not.create.table.select",
+			"syntax error at position 12 near 'from'",
+		}
+		for i, query := range querys {
+			_, err := ParseCreateTableSelect(query)
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+		assert.False(t, IsCreateTableSelect("create table t2(id int, b int)"))
+	}
+}
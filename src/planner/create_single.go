@@ -0,0 +1,123 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+var (
+	createTableSingleRegexp = regexp.MustCompile(`(?is)^create\s+table\s.*(\bdistributed\s+by\s*\(|\bsingle\s+on\b)`)
+)
+
+// CreateTableSingle is the CREATE TABLE ... [SINGLE] DISTRIBUTED BY (backend) or the CREATE TABLE ... SINGLE ON 'backend',
+// the SINGLE table placed on the backend instead of the first one.
+type CreateTableSingle struct {
+	Create  *sqlparser.DDL
+	Backend string
+}
+
+// IsCreateTableSingle returns true if the query may be the CREATE TABLE ... DISTRIBUTED BY (backend) or SINGLE ON 'backend'.
+func IsCreateTableSingle(query string) bool {
+	return createTableSingleRegexp.MatchString(query)
+}
+
+// ParseCreateTableSingle used to parse the CREATE TABLE ... [SINGLE] DISTRIBUTED BY (backend) or SINGLE ON 'backend',
+// the DDL is the SINGLE table.
+func ParseCreateTableSingle(query string) (*CreateTableSingle, error) {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	// start returns the start offset of the token after the offset.
+	start := func(from int) int {
+		for from < len(query) && strings.IndexByte(" \t\r\n", query[from]) != -1 {
+			from++
+		}
+		return from
+	}
+
+	var tokens []listToken
+	depth, prev, distributedAt, onAt := 0, 0, -1, -1
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			break
+		}
+		tokens = append(tokens, listToken{typ: typ, val: val, start: start(prev)})
+		// The tokenizer has read one byte ahead.
+		prev = tokenizer.Position - 1
+		switch typ {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		n := len(tokens)
+		if distributedAt == -1 && onAt == -1 && depth == 0 && n >= 2 {
+			switch {
+			case isDistributed(tokens[n-2]) && tokens[n-1].typ == sqlparser.BY:
+				distributedAt = n - 2
+			case tokens[n-2].typ == sqlparser.SINGLE && tokens[n-1].typ == sqlparser.ON:
+				onAt = n - 2
+			}
+		}
+	}
+
+	var end int
+	var backend string
+	switch {
+	case distributedAt != -1:
+		// The DISTRIBUTED BY (backend) [;] is at the end.
+		rest := tokens[distributedAt+2:]
+		if len(rest) > 3 && rest[3].typ == ';' {
+			rest = rest[:3]
+		}
+		if len(rest) != 3 || rest[0].typ != '(' || rest[1].typ != sqlparser.ID || rest[2].typ != ')' {
+			return nil, errors.Errorf("create.table.distributed.by.syntax.error.near[%s]", query[tokens[distributedAt].start:])
+		}
+		end, backend = distributedAt, string(rest[1].val)
+		if end > 0 && tokens[end-1].typ == sqlparser.SINGLE {
+			end--
+		}
+	case onAt != -1:
+		// The SINGLE ON 'backend' [;] is at the end, the backend may be the identifier.
+		rest := tokens[onAt+2:]
+		if len(rest) > 1 && rest[1].typ == ';' {
+			rest = rest[:1]
+		}
+		if len(rest) != 1 || (rest[0].typ != sqlparser.STRING && rest[0].typ != sqlparser.ID) || len(rest[0].val) == 0 {
+			return nil, errors.Errorf("create.table.single.on.syntax.error.near[%s]", query[tokens[onAt].start:])
+		}
+		end, backend = onAt, string(rest[0].val)
+	default:
+		return nil, errors.Errorf("unsupported: query[%s].is.not.create.table.distributed.by", query)
+	}
+	create, err := parseCreateTable(strings.TrimSpace(query[:tokens[end].start]))
+	if err != nil {
+		return nil, err
+	}
+	ddl, ok := create.(*sqlparser.DDL)
+	if !ok || ddl.Action != sqlparser.CreateTableStr || ddl.TableSpec == nil {
+		return nil, errors.Errorf("unsupported: query[%s].is.not.create.table.distributed.by", query)
+	}
+	switch ddl.TableSpec.Options.Type {
+	case "", sqlparser.NormalTableType, sqlparser.SingleTableType:
+	default:
+		return nil, errors.Errorf("create.table.distributed.by.must.be.the.single.table")
+	}
+	ddl.TableSpec.Options.Type = sqlparser.SingleTableType
+	return &CreateTableSingle{Create: ddl, Backend: backend}, nil
+}
+
+// isDistributed returns true if the token is the DISTRIBUTED, the tokenizer scans it as the identifier.
+func isDistributed(tok listToken) bool {
+	return tok.typ == sqlparser.ID && strings.EqualFold(string(tok.val), "distributed")
+}
@@ -0,0 +1,63 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+func TestParseCreateTableSingle(t *testing.T) {
+	querys := []string{
+		"create table db.t1(id int, b varchar(10)) engine=innodb single distributed by (backend2);",
+		"CREATE TABLE t1(id int, b varchar(10)) DISTRIBUTED BY(`backend2`)",
+		"create table t1(id int, b varchar(10)) row_format=dynamic distributed by (backend2)",
+		"create table db.t1(id int, b varchar(10)) engine=innodb single on 'backend2';",
+		"CREATE TABLE t1(id int, b varchar(10)) SINGLE ON `backend2`",
+	}
+	for _, query := range querys {
+		assert.True(t, IsCreateTableSingle(query), query)
+		cts, err := ParseCreateTableSingle(query)
+		assert.Nil(t, err, query)
+		assert.Equal(t, "backend2", cts.Backend, query)
+		assert.Equal(t, "t1", cts.Create.Table.Name.String(), query)
+		assert.Equal(t, sqlparser.SingleTableType, cts.Create.TableSpec.Options.Type, query)
+	}
+	assert.False(t, IsCreateTableSingle("create table t1(id int) single"))
+
+	// Errors.
+	{
+		querys := []string{
+			"create table t1(id int) distributed by (backend1, backend2)",
+			"create table t1(id int) distributed by (backend1) global",
+			"create table t1(id int) global distributed by (backend1)",
+			"create table t1(id int) partition by hash(id) distributed by (backend1)",
+			"create table t1(id int, distributed int)",
+			"create table t1(id int) single on",
+			"create table t1(id int) single on 'backend1' global",
+			"create table t1(id int) single on ''",
+		}
+		wants := []string{
+			"create.table.distributed.by.syntax.error.near[distributed by (backend1, backend2)]",
+			"create.table.distributed.by.syntax.error.near[distributed by (backend1) global]",
+			"create.table.distributed.by.must.be.the.single.table",
+			"create.table.distributed.by.must.be.the.single.table",
+			"unsupported: query[create table t1(id int, distributed int)].is.not.create.table.distributed.by",
+			"create.table.single.on.syntax.error.near[single on]",
+			"create.table.single.on.syntax.error.near[single on 'backend1' global]",
+			"create.table.single.on.syntax.error.near[single on '']",
+		}
+		for i, query := range querys {
+			_, err := ParseCreateTableSingle(query)
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+	}
+}
@@ -25,6 +25,9 @@ import (
 
 var (
 	_ Plan = &DDLPlan{}
+
+	// CREATE TABLE [IF NOT EXISTS] tbl_name { LIKE old_tbl_name | (LIKE old_tbl_name) }
+	createTableLikeRegexp = regexp.MustCompile("(?is)^create\\s+table\\s+(if\\s+not\\s+exists\\s+)?([\\w.`]+)\\s*(?:like\\s+([\\w.`]+)|\\(\\s*like\\s+([\\w.`]+)\\s*\\))$")
 )
 
 // DDLPlan represents a CREATE, ALTER, DROP or RENAME plan
@@ -71,6 +74,10 @@ func NewDDLPlan(log *xlog.Log, database string, query string, node *sqlparser.DD
 func (p *DDLPlan) Build() error {
 	node := p.node
 
+	if node.Action == sqlparser.CreateTableStr && IsCreateTableLike(p.RawQuery) {
+		return p.buildCreateTableLike()
+	}
+
 	switch node.Action {
 	case sqlparser.CreateDBStr:
 		p.ReqMode = xcontext.ReqScatter
@@ -129,21 +136,10 @@ func (p *DDLPlan) Build() error {
 			return err
 		}
 		for _, segment := range segments {
-			var query string
-
-			segTable := segment.Table
-			if node.Table.Qualifier.IsEmpty() {
-				segTable = fmt.Sprintf("`%s`.`%s`", database, segTable)
-				rawQuery := strings.Replace(p.RawQuery, "`", "", 2)
-				// \b: https://www.regular-expressions.info/wordboundaries.html
-				re, _ := regexp.Compile(fmt.Sprintf(`\b(%s)\b`, table))
-				query = re.ReplaceAllString(rawQuery, segTable)
-			} else {
-				segTable = fmt.Sprintf("`%s`.`%s`", database, segTable)
-				newTable := fmt.Sprintf("%s.%s", database, table)
-				rawQuery := strings.Replace(p.RawQuery, "`", "", 4)
-				re, _ := regexp.Compile(fmt.Sprintf(`\b(%s)\b`, newTable))
-				query = re.ReplaceAllString(rawQuery, segTable)
+			segTable := fmt.Sprintf("%s.%s", sqlparser.Backtick(database), sqlparser.Backtick(segment.Table))
+			query, err := rewriteDDLTable(p.RawQuery, table, segTable)
+			if err != nil {
+				return err
 			}
 
 			tuple := xcontext.QueryTuple{
@@ -157,6 +153,174 @@ func (p *DDLPlan) Build() error {
 	return nil
 }
 
+// buildCreateTableLike used to build the CREATE TABLE ... LIKE querys, the new table has the same layout as the source one,
+// every segment is created like the source segment on the same backend.
+func (p *DDLPlan) buildCreateTableLike() error {
+	node, like, err := ParseCreateTableLike(p.RawQuery)
+	if err != nil {
+		return err
+	}
+	database, table := p.database, node.Table.Name.String()
+	if !node.Table.Qualifier.IsEmpty() {
+		database = node.Table.Qualifier.String()
+	}
+	likeDatabase, likeTable := p.database, like.Name.String()
+	if !like.Qualifier.IsEmpty() {
+		likeDatabase = like.Qualifier.String()
+	}
+
+	segments, err := p.router.Lookup(database, table, nil, nil)
+	if err != nil {
+		return err
+	}
+	likeSegments, err := p.router.Lookup(likeDatabase, likeTable, nil, nil)
+	if err != nil {
+		return err
+	}
+	if len(segments) != len(likeSegments) {
+		return errors.New(fmt.Sprintf("ddl.plan.table[%s.%s].layout.differs.from.table[%s.%s]", database, table, likeDatabase, likeTable))
+	}
+	ifNotExists := ""
+	if node.IfNotExists {
+		ifNotExists = "if not exists "
+	}
+	for i, segment := range segments {
+		likeSegment := likeSegments[i]
+		if segment.Backend != likeSegment.Backend {
+			return errors.New(fmt.Sprintf("ddl.plan.table[%s.%s].layout.differs.from.table[%s.%s]", database, table, likeDatabase, likeTable))
+		}
+		query := fmt.Sprintf("create table %s%s.%s like %s.%s", ifNotExists,
+			sqlparser.Backtick(database), sqlparser.Backtick(segment.Table),
+			sqlparser.Backtick(likeDatabase), sqlparser.Backtick(likeSegment.Table))
+		tuple := xcontext.QueryTuple{
+			Query:   query,
+			Backend: segment.Backend,
+			Range:   segment.Range.String(),
+		}
+		p.Querys = append(p.Querys, tuple)
+	}
+	return nil
+}
+
+// IsCreateTableLike returns true if the query is the CREATE TABLE ... LIKE, which the parser doesn't support.
+func IsCreateTableLike(query string) bool {
+	return createTableLikeRegexp.MatchString(query)
+}
+
+// ParseCreateTableLike used to parse the CREATE TABLE ... LIKE, it returns the create table DDL of the new table
+// and the source table.
+func ParseCreateTableLike(query string) (*sqlparser.DDL, sqlparser.TableName, error) {
+	m := createTableLikeRegexp.FindStringSubmatch(query)
+	if m == nil {
+		return nil, sqlparser.TableName{}, errors.New(fmt.Sprintf("ddl.plan.query[%s].is.not.create.table.like", query))
+	}
+	table, err := parseTableName(m[2])
+	if err != nil {
+		return nil, sqlparser.TableName{}, err
+	}
+	likeName := m[3]
+	if likeName == "" {
+		likeName = m[4]
+	}
+	like, err := parseTableName(likeName)
+	if err != nil {
+		return nil, sqlparser.TableName{}, err
+	}
+	node := &sqlparser.DDL{
+		Action:      sqlparser.CreateTableStr,
+		IfNotExists: m[1] != "",
+		Table:       table,
+	}
+	return node, like, nil
+}
+
+// parseTableName used to parse the [db.]table name.
+func parseTableName(name string) (sqlparser.TableName, error) {
+	stmt, err := sqlparser.Parse("select 1 from " + name)
+	if err != nil {
+		return sqlparser.TableName{}, err
+	}
+	if sel, ok := stmt.(*sqlparser.Select); ok && len(sel.From) == 1 {
+		if aliased, ok := sel.From[0].(*sqlparser.AliasedTableExpr); ok && aliased.As.IsEmpty() {
+			if table, ok := aliased.Expr.(sqlparser.TableName); ok {
+				return table, nil
+			}
+		}
+	}
+	return sqlparser.TableName{}, errors.New(fmt.Sprintf("ddl.plan.invalid.table.name[%s]", name))
+}
+
+// rewriteDDLTable used to replace the table reference(the [db.]table after the TABLE or ON keyword) in the DDL with the segTable.
+// The query is tokenized, so the quoted identifiers, reserved words and the columns which have the same name as the table are kept.
+func rewriteDDLTable(query string, table string, segTable string) (string, error) {
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	// end returns the end offset of the last scanned token, the tokenizer has read one byte ahead.
+	end := func() int {
+		return tokenizer.Position - 1
+	}
+	// start returns the start offset of the token after the offset.
+	start := func(from int) int {
+		for from < len(query) && strings.IndexByte(" \t\r\n", query[from]) != -1 {
+			from++
+		}
+		return from
+	}
+
+	prev := 0
+	found := false
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			break
+		}
+		if !found {
+			if typ == sqlparser.TABLE || typ == sqlparser.ON {
+				found = true
+			}
+			prev = end()
+			continue
+		}
+		switch typ {
+		case sqlparser.IF, sqlparser.NOT, sqlparser.EXISTS:
+			prev = end()
+			continue
+		}
+
+		// The table reference: table or qualifier.table.
+		from := start(prev)
+		name := string(val)
+		to := end()
+		if next, _ := tokenizer.Scan(); next == '.' {
+			_, val = tokenizer.Scan()
+			name = string(val)
+			to = end()
+		}
+		if name == table {
+			return query[:from] + segTable + query[to:], nil
+		}
+		break
+	}
+	return "", errors.New(fmt.Sprintf("ddl.plan.can.not.find.the.table[%s].in.query[%s]", table, query))
+}
+
+// Action returns the DDL action, such as 'create table'.
+func (p *DDLPlan) Action() string {
+	return p.node.Action
+}
+
+// Columns returns the column names of the CREATE TABLE in order,
+// it's nil if the DDL doesn't carry the table definition, such as the CREATE TABLE ... LIKE.
+func (p *DDLPlan) Columns() []string {
+	if p.node.Action != sqlparser.CreateTableStr || p.node.TableSpec == nil {
+		return nil
+	}
+	columns := make([]string, 0, len(p.node.TableSpec.Columns))
+	for _, col := range p.node.TableSpec.Columns {
+		columns = append(columns, col.Name.String())
+	}
+	return columns
+}
+
 // Type returns the type of the plan.
 func (p *DDLPlan) Type() PlanType {
 	return p.typ
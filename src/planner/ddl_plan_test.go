@@ -9,8 +9,13 @@
 package planner
 
 import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
 	"testing"
 
+	"config"
 	"router"
 
 	"github.com/stretchr/testify/assert"
@@ -284,7 +289,7 @@ func TestDDLPlanCreateIndexWithTableNameIssue10(t *testing.T) {
 func TestDDLPlanWithQuote(t *testing.T) {
 	results := []string{
 		"{\n\t\"RawQuery\": \"create table `A`(a int)\",\n\t\"Partitions\": [\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A0`(a int)\",\n\t\t\t\"Backend\": \"backend0\",\n\t\t\t\"Range\": \"[0-2)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A2`(a int)\",\n\t\t\t\"Backend\": \"backend2\",\n\t\t\t\"Range\": \"[2-4)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A4`(a int)\",\n\t\t\t\"Backend\": \"backend4\",\n\t\t\t\"Range\": \"[4-8)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A8`(a int)\",\n\t\t\t\"Backend\": \"backend8\",\n\t\t\t\"Range\": \"[8-4096)\"\n\t\t}\n\t]\n}",
-		"{\n\t\"RawQuery\": \"create table A(`a` int)\",\n\t\"Partitions\": [\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A0`(a int)\",\n\t\t\t\"Backend\": \"backend0\",\n\t\t\t\"Range\": \"[0-2)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A2`(a int)\",\n\t\t\t\"Backend\": \"backend2\",\n\t\t\t\"Range\": \"[2-4)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A4`(a int)\",\n\t\t\t\"Backend\": \"backend4\",\n\t\t\t\"Range\": \"[4-8)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A8`(a int)\",\n\t\t\t\"Backend\": \"backend8\",\n\t\t\t\"Range\": \"[8-4096)\"\n\t\t}\n\t]\n}",
+		"{\n\t\"RawQuery\": \"create table A(`a` int)\",\n\t\"Partitions\": [\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A0`(`a` int)\",\n\t\t\t\"Backend\": \"backend0\",\n\t\t\t\"Range\": \"[0-2)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A2`(`a` int)\",\n\t\t\t\"Backend\": \"backend2\",\n\t\t\t\"Range\": \"[2-4)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A4`(`a` int)\",\n\t\t\t\"Backend\": \"backend4\",\n\t\t\t\"Range\": \"[4-8)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A8`(`a` int)\",\n\t\t\t\"Backend\": \"backend8\",\n\t\t\t\"Range\": \"[8-4096)\"\n\t\t}\n\t]\n}",
 		"{\n\t\"RawQuery\": \"create table A(a int)\",\n\t\"Partitions\": [\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A0`(a int)\",\n\t\t\t\"Backend\": \"backend0\",\n\t\t\t\"Range\": \"[0-2)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A2`(a int)\",\n\t\t\t\"Backend\": \"backend2\",\n\t\t\t\"Range\": \"[2-4)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A4`(a int)\",\n\t\t\t\"Backend\": \"backend4\",\n\t\t\t\"Range\": \"[4-8)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A8`(a int)\",\n\t\t\t\"Backend\": \"backend8\",\n\t\t\t\"Range\": \"[8-4096)\"\n\t\t}\n\t]\n}",
 		"{\n\t\"RawQuery\": \"create table sbtest.A(a int)\",\n\t\"Partitions\": [\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A0`(a int)\",\n\t\t\t\"Backend\": \"backend0\",\n\t\t\t\"Range\": \"[0-2)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A2`(a int)\",\n\t\t\t\"Backend\": \"backend2\",\n\t\t\t\"Range\": \"[2-4)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A4`(a int)\",\n\t\t\t\"Backend\": \"backend4\",\n\t\t\t\"Range\": \"[4-8)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A8`(a int)\",\n\t\t\t\"Backend\": \"backend8\",\n\t\t\t\"Range\": \"[8-4096)\"\n\t\t}\n\t]\n}",
 		"{\n\t\"RawQuery\": \"create table sbtest.`A`(a int)\",\n\t\"Partitions\": [\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A0`(a int)\",\n\t\t\t\"Backend\": \"backend0\",\n\t\t\t\"Range\": \"[0-2)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A2`(a int)\",\n\t\t\t\"Backend\": \"backend2\",\n\t\t\t\"Range\": \"[2-4)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A4`(a int)\",\n\t\t\t\"Backend\": \"backend4\",\n\t\t\t\"Range\": \"[4-8)\"\n\t\t},\n\t\t{\n\t\t\t\"Query\": \"create table `sbtest`.`A8`(a int)\",\n\t\t\t\"Backend\": \"backend8\",\n\t\t\t\"Range\": \"[8-4096)\"\n\t\t}\n\t]\n}",
@@ -327,3 +332,180 @@ func TestDDLPlanWithQuote(t *testing.T) {
 		}
 	}
 }
+
+// nastyIdentifiers are the identifiers which must be quoted: reserved words, special characters and the backquote.
+var nastyIdentifiers = []string{
+	"order",
+	"select",
+	"table",
+	"status",
+	"my-table",
+	"my table",
+	"1abc",
+	"a`b",
+	"``",
+	"数据",
+	"on",
+	"if",
+}
+
+// randomIdentifier returns an identifier made of the letters, reserved words and special characters.
+func randomIdentifier(r *rand.Rand) string {
+	parts := []string{"a", "Z", "_", "-", " ", "`", "$", "9", "é", "order", "on", "table", "if", "not", "exists", "--", "/*", "'", "\""}
+	var buf bytes.Buffer
+	n := r.Intn(5) + 1
+	for i := 0; i < n; i++ {
+		buf.WriteString(parts[r.Intn(len(parts))])
+	}
+	return strings.TrimRight(buf.String(), " ")
+}
+
+func TestDDLPlanNastyIdentifiers(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	r := rand.New(rand.NewSource(20180808))
+
+	idents := append([]string{}, nastyIdentifiers...)
+	for i := 0; i < 200; i++ {
+		if ident := randomIdentifier(r); ident != "" {
+			idents = append(idents, ident)
+		}
+	}
+
+	for _, ident := range idents {
+		database := ident + "_db"
+		table := ident
+		column := ident
+
+		route, cleanup := router.MockNewRouter(log)
+		tconf := &config.TableConfig{
+			Name:      table,
+			ShardType: "HASH",
+			ShardKey:  "id",
+			Partitions: []*config.PartitionConfig{
+				{Table: table + "_0000", Segment: "0-2048", Backend: "backend0"},
+				{Table: table + "_0001", Segment: "2048-4096", Backend: "backend1"},
+			},
+		}
+		err := route.AddForTest(database, tconf)
+		assert.Nil(t, err)
+
+		qdb, qtable, qcolumn := sqlparser.Backtick(database), sqlparser.Backtick(table), sqlparser.Backtick(column)
+		querys := []string{
+			fmt.Sprintf("create table %s(%s int, id int)", qtable, qcolumn),
+			fmt.Sprintf("create table if not exists %s.%s(%s int, id int)", qdb, qtable, qcolumn),
+			fmt.Sprintf("alter table %s add column(%s int)", qtable, qcolumn),
+			fmt.Sprintf("alter table %s.%s modify column %s int", qdb, qtable, qcolumn),
+			fmt.Sprintf("alter table %s drop column %s", qtable, qcolumn),
+			fmt.Sprintf("alter table %s engine = tokudb", qtable),
+			fmt.Sprintf("create index %s on %s(%s)", qtable, qtable, qcolumn),
+			fmt.Sprintf("drop index %s on %s.%s", qtable, qdb, qtable),
+			fmt.Sprintf("truncate table %s", qtable),
+			fmt.Sprintf("drop table %s.%s", qdb, qtable),
+		}
+		for _, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err, query)
+			if err != nil {
+				continue
+			}
+			ddl := node.(*sqlparser.DDL)
+			if ddl.Action == sqlparser.DropTableStr {
+				ddl.Table = ddl.Tables[0]
+			}
+			plan := NewDDLPlan(log, database, query, ddl, route)
+			err = plan.Build()
+			assert.Nil(t, err, query)
+
+			assert.Equal(t, 2, len(plan.Querys), query)
+			for i, qt := range plan.Querys {
+				// The rewritten query refers to the segment and keeps the others.
+				got, err := sqlparser.Parse(qt.Query)
+				assert.Nil(t, err, qt.Query)
+				if err != nil {
+					continue
+				}
+				gotDDL := got.(*sqlparser.DDL)
+				name := gotDDL.NewName
+				if gotDDL.Action == sqlparser.DropTableStr {
+					name = gotDDL.Tables[0]
+				}
+				assert.Equal(t, ddl.Action, gotDDL.Action, qt.Query)
+				assert.Equal(t, tconf.Partitions[i].Table, name.Name.String(), qt.Query)
+				assert.Equal(t, database, name.Qualifier.String(), qt.Query)
+				if gotDDL.TableSpec != nil {
+					assert.Equal(t, column, gotDDL.TableSpec.Columns[0].Name.String(), qt.Query)
+				}
+			}
+		}
+		cleanup()
+	}
+}
+
+func TestDDLPlanCreateTableLike(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableGConfig(), router.MockTableSConfig())
+	assert.Nil(t, err)
+	err = route.CreateDatabase("db1")
+	assert.Nil(t, err)
+	err = route.CreateTableLike("db1", "B", database, "A")
+	assert.Nil(t, err)
+	err = route.CreateTableLike("db1", "G1", database, "G")
+	assert.Nil(t, err)
+
+	querys := []string{
+		"create table db1.B like A",
+		"CREATE TABLE IF NOT EXISTS db1.G1 (LIKE `sbtest`.`G`)",
+	}
+	wants := [][]string{
+		{
+			"create table `db1`.`B0` like `sbtest`.`A0`",
+			"create table `db1`.`B2` like `sbtest`.`A2`",
+			"create table `db1`.`B4` like `sbtest`.`A4`",
+			"create table `db1`.`B8` like `sbtest`.`A8`",
+		},
+		{
+			"create table if not exists `db1`.`G1` like `sbtest`.`G`",
+			"create table if not exists `db1`.`G1` like `sbtest`.`G`",
+		},
+	}
+	for i, query := range querys {
+		assert.True(t, IsCreateTableLike(query))
+		node, _, err := ParseCreateTableLike(query)
+		assert.Nil(t, err)
+		plan := NewDDLPlan(log, database, query, node, route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		var got []string
+		for _, q := range plan.Querys {
+			got = append(got, q.Query)
+		}
+		assert.Equal(t, wants[i], got)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"create table db1.G1 like A",
+			"create table db1.B like xx",
+		}
+		wants := []string{
+			"ddl.plan.table[db1.G1].layout.differs.from.table[sbtest.A]",
+			"Table 'xx' doesn't exist (errno 1146) (sqlstate 42S02)",
+		}
+		for i, query := range querys {
+			node, _, err := ParseCreateTableLike(query)
+			assert.Nil(t, err)
+			plan := NewDDLPlan(log, database, query, node, route)
+			err = plan.Build()
+			assert.Equal(t, wants[i], err.Error())
+		}
+		assert.False(t, IsCreateTableLike("create table t1(id int, b int)"))
+		_, _, err := ParseCreateTableLike("create table t1(id int)")
+		assert.NotNil(t, err)
+	}
+}
@@ -134,6 +134,16 @@ func TestDeletePlan(t *testing.T) {
 			"Range": ""
 		}
 	]
+}`,
+		`{
+	"RawQuery": "delete from sbtest.A where id=1 order by xx limit 10",
+	"Partitions": [
+		{
+			"Query": "delete from sbtest.A6 where id = 1 order by xx asc limit 10",
+			"Backend": "backend6",
+			"Range": "[512-4096)"
+		}
+	]
 }`,
 	}
 	querys := []string{
@@ -143,6 +153,7 @@ func TestDeletePlan(t *testing.T) {
 		"delete from sbtest.A where id in (1, 2,3)",
 		"delete from sbtest.G where id in (1, 2,3)",
 		"delete from sbtest.S where id in (1, 2,3)",
+		"delete from sbtest.A where id=1 order by xx limit 10",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -181,11 +192,13 @@ func TestDeleteUnsupportedPlan(t *testing.T) {
 	querys := []string{
 		"delete from sbtest.A",
 		"delete from sbtest.A where id in (select id from t1)",
+		"delete from sbtest.A where b=1 limit 10",
 	}
 
 	results := []string{
 		"unsupported: missing.where.clause.in.DML",
 		"unsupported: subqueries.in.delete",
+		"unsupported: limit.in.delete.across.segments",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
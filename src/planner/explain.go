@@ -0,0 +1,254 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
+)
+
+const (
+	// ExplainVersion is the version of the EXPLAIN FORMAT=JSON schema.
+	// The new fields are added in the same version, it's bumped only if a field is removed or its meaning is changed.
+	ExplainVersion = 1
+)
+
+// ExplainPlan is the stable explain of the plan for the tooling, see the EXPLAIN in docs/radon_sql_support.md.
+type ExplainPlan struct {
+	Version int `json:"version"`
+	// Statement is one of select, union, insert, delete, update and checksum.
+	Statement string `json:"statement"`
+	Query     string `json:"query"`
+	// Fields are the columns returned by the select and union.
+	Fields []string `json:"fields,omitempty"`
+	// Root is the node tree of the select and union.
+	Root *ExplainNode `json:"root,omitempty"`
+	// Routes are all the querys sent to the backends.
+	Routes []*ExplainRoute `json:"routes"`
+	// Operations are done by radon on the results of the backends in order.
+	Operations []*ExplainOperation `json:"operations,omitempty"`
+}
+
+// ExplainNode is the node of the plan tree.
+type ExplainNode struct {
+	// Type is one of merge, join and union.
+	// The merge is the querys pushed down to the backends, the join and union are done by radon on its children.
+	Type string `json:"type"`
+
+	// Routing of the merge is single if the query is pushed down to one backend as a whole, or scatter.
+	Routing string          `json:"routing,omitempty"`
+	Tables  []*ExplainTable `json:"tables,omitempty"`
+	Routes  []*ExplainRoute `json:"routes,omitempty"`
+
+	// JoinType of the join is one of inner, left and cross, Strategy is one of cartesian, sort-merge and nested-loop.
+	JoinType string `json:"join-type,omitempty"`
+	Strategy string `json:"strategy,omitempty"`
+
+	// UnionType of the union is the union or union all.
+	UnionType string `json:"union-type,omitempty"`
+
+	Children []*ExplainNode `json:"children,omitempty"`
+}
+
+// ExplainTable is the table referred by the merge and the segments it's routed to.
+type ExplainTable struct {
+	Database  string `json:"database"`
+	Table     string `json:"table"`
+	Alias     string `json:"alias,omitempty"`
+	ShardType string `json:"shard-type"`
+	ShardKey  string `json:"shard-key,omitempty"`
+	Segments  int    `json:"segments"`
+}
+
+// ExplainRoute is the query sent to the backend, the range is the shard range of the segment.
+type ExplainRoute struct {
+	Backend string `json:"backend"`
+	Range   string `json:"range,omitempty"`
+	Query   string `json:"query"`
+}
+
+// ExplainOperation is the operation done by radon.
+type ExplainOperation struct {
+	// Type is one of aggregate, group-by, order-by and limit.
+	Type string `json:"type"`
+	// Fields of the aggregate are the aggregate functions, of the group-by are the group keys,
+	// of the order-by are the fields with the directions.
+	Fields []string `json:"fields,omitempty"`
+	// Pushdown of the aggregate is true if the backends return the partial aggregations to be merged.
+	Pushdown *bool `json:"pushdown,omitempty"`
+	Offset   *int  `json:"offset,omitempty"`
+	Limit    *int  `json:"limit,omitempty"`
+}
+
+// Explain returns the stable explain of the built plan.
+func Explain(plan Plan) (*ExplainPlan, error) {
+	exp := &ExplainPlan{Version: ExplainVersion, Routes: []*ExplainRoute{}}
+	switch plan := plan.(type) {
+	case *SelectPlan:
+		exp.Statement = "select"
+		exp.Query = plan.RawQuery
+		explainSelectNode(exp, plan.Root)
+	case *UnionPlan:
+		exp.Statement = "union"
+		exp.Query = plan.RawQuery
+		explainSelectNode(exp, plan.Root)
+	case *InsertPlan:
+		exp.Statement = "insert"
+		exp.Query = plan.RawQuery
+		exp.Routes = explainRoutes(plan.Querys, true)
+	case *DeletePlan:
+		exp.Statement = "delete"
+		exp.Query = plan.RawQuery
+		exp.Routes = explainRoutes(plan.Querys, false)
+	case *UpdatePlan:
+		exp.Statement = "update"
+		exp.Query = plan.RawQuery
+		exp.Routes = explainRoutes(plan.Querys, false)
+	case *OthersPlan:
+		exp.Statement = "checksum"
+		exp.Query = plan.RawQuery
+		exp.Routes = explainRoutes(plan.Querys, true)
+	default:
+		return nil, errors.Errorf("unsupported: explain.plan.type[%v]", plan.Type())
+	}
+	return exp, nil
+}
+
+// ExplainJSON returns the stable explain of the built plan in the indented JSON.
+func ExplainJSON(plan Plan) (string, error) {
+	exp, err := Explain(plan)
+	if err != nil {
+		return "", err
+	}
+	bout, err := json.MarshalIndent(exp, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return common.BytesToString(bout), nil
+}
+
+func explainSelectNode(exp *ExplainPlan, root PlanNode) {
+	for _, tuple := range root.getFields() {
+		field := tuple.field
+		if tuple.alias != "" {
+			field = tuple.alias
+		}
+		exp.Fields = append(exp.Fields, field)
+	}
+	exp.Root = explainNode(root)
+	exp.Routes = explainRoutes(root.GetQuery(), false)
+
+	for _, sub := range root.Children().Plans() {
+		switch sub := sub.(type) {
+		case *AggregatePlan:
+			if len(sub.normalAggrs) > 0 {
+				pushdown := sub.IsPushDown
+				op := &ExplainOperation{Type: "aggregate", Pushdown: &pushdown}
+				for _, aggr := range sub.normalAggrs {
+					op.Fields = append(op.Fields, aggr.Field)
+				}
+				exp.Operations = append(exp.Operations, op)
+			}
+			if len(sub.groupAggrs) > 0 {
+				op := &ExplainOperation{Type: "group-by"}
+				for _, aggr := range sub.groupAggrs {
+					op.Fields = append(op.Fields, aggr.Field)
+				}
+				exp.Operations = append(exp.Operations, op)
+			}
+		case *OrderByPlan:
+			op := &ExplainOperation{Type: "order-by"}
+			for _, order := range sub.OrderBys {
+				field := order.Field
+				if order.Table != "" {
+					field = strings.Join([]string{order.Table, order.Field}, ".")
+				}
+				op.Fields = append(op.Fields, fmt.Sprintf("%s %s", field, order.Direction))
+			}
+			exp.Operations = append(exp.Operations, op)
+		case *LimitPlan:
+			offset, limit := sub.Offset, sub.Limit
+			exp.Operations = append(exp.Operations, &ExplainOperation{Type: "limit", Offset: &offset, Limit: &limit})
+		}
+	}
+}
+
+func explainNode(node PlanNode) *ExplainNode {
+	switch node := node.(type) {
+	case *MergeNode:
+		exp := &ExplainNode{Type: "merge", Routing: "scatter", Routes: explainRoutes(node.GetQuery(), false)}
+		if node.routeLen == 1 {
+			exp.Routing = "single"
+		}
+		aliases := make([]string, 0, len(node.referredTables))
+		for alias := range node.referredTables {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			info := node.referredTables[alias]
+			table := &ExplainTable{
+				Database:  info.database,
+				Table:     info.tableName,
+				ShardType: strings.ToLower(info.shardType),
+				ShardKey:  info.shardKey,
+				Segments:  len(info.Segments),
+			}
+			if alias != info.tableName {
+				table.Alias = alias
+			}
+			exp.Tables = append(exp.Tables, table)
+		}
+		return exp
+	case *JoinNode:
+		exp := &ExplainNode{Type: "join", JoinType: "inner"}
+		switch node.Strategy {
+		case Cartesian:
+			exp.Strategy = "cartesian"
+		case SortMerge:
+			exp.Strategy = "sort-merge"
+		case NestedLoop:
+			exp.Strategy = "nested-loop"
+		}
+		if node.IsLeftJoin {
+			exp.JoinType = "left"
+		} else if node.Strategy == Cartesian {
+			exp.JoinType = "cross"
+		}
+		exp.Children = []*ExplainNode{explainNode(node.Left), explainNode(node.Right)}
+		return exp
+	case *UnionNode:
+		return &ExplainNode{
+			Type:      "union",
+			UnionType: strings.ToLower(node.Typ),
+			Children:  []*ExplainNode{explainNode(node.Left), explainNode(node.Right)},
+		}
+	}
+	return nil
+}
+
+// explainRoutes returns the routes of the querys, they're sorted by the backend if sorted.
+func explainRoutes(querys []xcontext.QueryTuple, sorted bool) []*ExplainRoute {
+	if sorted {
+		querys = append([]xcontext.QueryTuple(nil), querys...)
+		sort.Stable(xcontext.QueryTuples(querys))
+	}
+	routes := make([]*ExplainRoute, 0, len(querys))
+	for _, q := range querys {
+		routes = append(routes, &ExplainRoute{Backend: q.Backend, Range: q.Range, Query: q.Query})
+	}
+	return routes
+}
@@ -0,0 +1,238 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestExplain(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+
+	results := []string{
+		`{
+	"version": 1,
+	"statement": "select",
+	"query": "select A.id, count(B.a) from A join B on A.id=B.id where A.id=1 group by A.id order by A.id desc limit 1",
+	"fields": [
+		"id",
+		"count(B.a)"
+	],
+	"root": {
+		"type": "join",
+		"join-type": "inner",
+		"strategy": "sort-merge",
+		"children": [
+			{
+				"type": "merge",
+				"routing": "single",
+				"tables": [
+					{
+						"database": "sbtest",
+						"table": "A",
+						"shard-type": "hash",
+						"shard-key": "id",
+						"segments": 1
+					}
+				],
+				"routes": [
+					{
+						"backend": "backend6",
+						"range": "[512-4096)",
+						"query": "select A.id from sbtest.A6 as A where A.id = 1 order by A.id asc"
+					}
+				]
+			},
+			{
+				"type": "merge",
+				"routing": "single",
+				"tables": [
+					{
+						"database": "sbtest",
+						"table": "B",
+						"shard-type": "hash",
+						"shard-key": "id",
+						"segments": 1
+					}
+				],
+				"routes": [
+					{
+						"backend": "backend2",
+						"range": "[512-4096)",
+						"query": "select B.a as ` + "`" + `count(B.a)` + "`" + `, B.id from sbtest.B1 as B where B.id = 1 order by B.id asc"
+					}
+				]
+			}
+		]
+	},
+	"routes": [
+		{
+			"backend": "backend6",
+			"range": "[512-4096)",
+			"query": "select A.id from sbtest.A6 as A where A.id = 1 order by A.id asc"
+		},
+		{
+			"backend": "backend2",
+			"range": "[512-4096)",
+			"query": "select B.a as ` + "`" + `count(B.a)` + "`" + `, B.id from sbtest.B1 as B where B.id = 1 order by B.id asc"
+		}
+	],
+	"operations": [
+		{
+			"type": "aggregate",
+			"fields": [
+				"count(B.a)"
+			],
+			"pushdown": false
+		},
+		{
+			"type": "group-by",
+			"fields": [
+				"id"
+			]
+		},
+		{
+			"type": "order-by",
+			"fields": [
+				"A.id DESC"
+			]
+		},
+		{
+			"type": "limit",
+			"offset": 0,
+			"limit": 1
+		}
+	]
+}`,
+		`{
+	"version": 1,
+	"statement": "union",
+	"query": "select a from A where id=1 union all select a from B where id=1",
+	"fields": [
+		"a"
+	],
+	"root": {
+		"type": "union",
+		"union-type": "union all",
+		"children": [
+			{
+				"type": "merge",
+				"routing": "single",
+				"tables": [
+					{
+						"database": "sbtest",
+						"table": "A",
+						"shard-type": "hash",
+						"shard-key": "id",
+						"segments": 1
+					}
+				],
+				"routes": [
+					{
+						"backend": "backend6",
+						"range": "[512-4096)",
+						"query": "select a from sbtest.A6 as A where id = 1"
+					}
+				]
+			},
+			{
+				"type": "merge",
+				"routing": "single",
+				"tables": [
+					{
+						"database": "sbtest",
+						"table": "B",
+						"shard-type": "hash",
+						"shard-key": "id",
+						"segments": 1
+					}
+				],
+				"routes": [
+					{
+						"backend": "backend2",
+						"range": "[512-4096)",
+						"query": "select a from sbtest.B1 as B where id = 1"
+					}
+				]
+			}
+		]
+	},
+	"routes": [
+		{
+			"backend": "backend6",
+			"range": "[512-4096)",
+			"query": "select a from sbtest.A6 as A where id = 1"
+		},
+		{
+			"backend": "backend2",
+			"range": "[512-4096)",
+			"query": "select a from sbtest.B1 as B where id = 1"
+		}
+	]
+}`,
+		`{
+	"version": 1,
+	"statement": "insert",
+	"query": "insert into B(id, a) values(1, 1), (513, 2)",
+	"routes": [
+		{
+			"backend": "backend1",
+			"range": "[0-512)",
+			"query": "insert into sbtest.B0(id, a) values (513, 2)"
+		},
+		{
+			"backend": "backend2",
+			"range": "[512-4096)",
+			"query": "insert into sbtest.B1(id, a) values (1, 1)"
+		}
+	]
+}`,
+	}
+	querys := []string{
+		"select A.id, count(B.a) from A join B on A.id=B.id where A.id=1 group by A.id order by A.id desc limit 1",
+		"select a from A where id=1 union all select a from B where id=1",
+		"insert into B(id, a) values(1, 1), (513, 2)",
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		var plan Plan
+		switch node := node.(type) {
+		case *sqlparser.Select:
+			plan = NewSelectPlan(log, database, query, node, route)
+		case *sqlparser.Union:
+			plan = NewUnionPlan(log, database, query, node, route)
+		case *sqlparser.Insert:
+			plan = NewInsertPlan(log, database, query, node, route)
+		}
+		err = plan.Build()
+		assert.Nil(t, err)
+		got, err := ExplainJSON(plan)
+		assert.Nil(t, err)
+		assert.Equal(t, results[i], got)
+	}
+}
+
+func TestExplainUnsupported(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, err := Explain(NewDDLPlan(log, "sbtest", "create database sbtest", nil, nil))
+	assert.Equal(t, "unsupported: explain.plan.type[PlanTypeDDL]", err.Error())
+}
@@ -32,7 +32,7 @@ func getDMLRouting(database, table, shardkey string, where *sqlparser.Where, rou
 			switch comparison.Operator {
 			case sqlparser.EqualStr:
 				if nameMatch(comparison.Left, table, shardkey) {
-					sqlval, ok := comparison.Right.(*sqlparser.SQLVal)
+					sqlval, ok := shardKeyVal(comparison.Right)
 					if ok {
 						return router.Lookup(database, table, sqlval, sqlval)
 					}
@@ -43,6 +43,48 @@ func getDMLRouting(database, table, shardkey string, where *sqlparser.Where, rou
 	return router.Lookup(database, table, nil, nil)
 }
 
+// shardKeyVal returns the value of the shard key expr, the sign of the numeric value such as -1.5 is folded
+// into it, then the value is routed the same whichever form it's written in.
+// The bind variable isn't a value, the query with it is routed to all the segments.
+func shardKeyVal(expr sqlparser.Expr) (*sqlparser.SQLVal, bool) {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		if expr.Type == sqlparser.ValArg {
+			return nil, false
+		}
+		return expr, true
+	case *sqlparser.UnaryExpr:
+		if expr.Operator != sqlparser.UMinusStr && expr.Operator != sqlparser.UPlusStr {
+			return nil, false
+		}
+		val, ok := shardKeyVal(expr.Expr)
+		if !ok || (val.Type != sqlparser.IntVal && val.Type != sqlparser.FloatVal) {
+			return nil, false
+		}
+		if expr.Operator == sqlparser.UPlusStr {
+			return val, true
+		}
+		num := val.Val
+		switch {
+		case len(num) > 0 && num[0] == '-':
+			num = num[1:]
+		case len(num) > 0 && num[0] == '+':
+			num = append([]byte("-"), num[1:]...)
+		default:
+			num = append([]byte("-"), num...)
+		}
+		return &sqlparser.SQLVal{Type: val.Type, Val: num}, true
+	}
+	return nil, false
+}
+
+// countDMLRows returns the query counting the rows of the segment matched by the DML.
+func countDMLRows(database, table string, where *sqlparser.Where) string {
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("select count(*) from %s.%s%v", database, table, where)
+	return buf.String()
+}
+
 func hasSubquery(node sqlparser.SQLNode) bool {
 	has := false
 	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
@@ -57,6 +99,10 @@ func hasSubquery(node sqlparser.SQLNode) bool {
 
 func checkTbName(tbInfos map[string]*TableInfo, node sqlparser.SQLNode) error {
 	return sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		// The tables of the subqueries pushed down are not in the tbInfos.
+		if _, ok := node.(*sqlparser.Subquery); ok {
+			return false, nil
+		}
 		if col, ok := node.(*sqlparser.ColName); ok {
 			tableName := col.Qualifier.Name.String()
 			if tableName != "" {
@@ -490,6 +536,8 @@ type filterTuple struct {
 	col *sqlparser.ColName
 	// val in the filter expr.
 	vals []*sqlparser.SQLVal
+	// bounds of the col in the range filter expr, such as BETWEEN, >= or <.
+	start, end *sqlparser.SQLVal
 }
 
 type joinTuple struct {
@@ -512,6 +560,7 @@ func parserWhereOrJoinExprs(exprs sqlparser.Expr, tbInfos map[string]*TableInfo)
 	for _, filter := range filters {
 		var col *sqlparser.ColName
 		var vals []*sqlparser.SQLVal
+		var start, end *sqlparser.SQLVal
 		count := 0
 		filter = skipParenthesis(filter)
 		filter = convertOrToIn(filter)
@@ -563,12 +612,12 @@ func parserWhereOrJoinExprs(exprs sqlparser.Expr, tbInfos map[string]*TableInfo)
 				}
 
 				if lok {
-					if sqlVal, ok := condition.Right.(*sqlparser.SQLVal); ok {
+					if sqlVal, ok := shardKeyVal(condition.Right); ok {
 						vals = append(vals, sqlVal)
 					}
 				}
 				if rok {
-					if sqlVal, ok := condition.Left.(*sqlparser.SQLVal); ok {
+					if sqlVal, ok := shardKeyVal(condition.Left); ok {
 						vals = append(vals, sqlVal)
 					}
 				}
@@ -578,7 +627,7 @@ func parserWhereOrJoinExprs(exprs sqlparser.Expr, tbInfos map[string]*TableInfo)
 						var sqlVals []*sqlparser.SQLVal
 						isVal := true
 						for _, val := range valTuple {
-							if sqlVal, ok := val.(*sqlparser.SQLVal); ok {
+							if sqlVal, ok := shardKeyVal(val); ok {
 								sqlVals = append(sqlVals, sqlVal)
 							} else {
 								isVal = false
@@ -590,9 +639,30 @@ func parserWhereOrJoinExprs(exprs sqlparser.Expr, tbInfos map[string]*TableInfo)
 						}
 					}
 				}
+			case sqlparser.GreaterThanStr, sqlparser.GreaterEqualStr:
+				if lok {
+					start, _ = shardKeyVal(condition.Right)
+				} else if rok {
+					end, _ = shardKeyVal(condition.Left)
+				}
+			case sqlparser.LessThanStr, sqlparser.LessEqualStr:
+				if lok {
+					end, _ = shardKeyVal(condition.Right)
+				} else if rok {
+					start, _ = shardKeyVal(condition.Left)
+				}
+			}
+		}
+		if condition, ok := filter.(*sqlparser.RangeCond); ok && condition.Operator == sqlparser.BetweenStr {
+			if _, ok := condition.Left.(*sqlparser.ColName); ok {
+				if from, ok := shardKeyVal(condition.From); ok {
+					if to, ok := shardKeyVal(condition.To); ok {
+						start, end = from, to
+					}
+				}
 			}
 		}
-		tuple := filterTuple{filter, referTables, col, vals}
+		tuple := filterTuple{filter, referTables, col, vals, start, end}
 		wheres = append(wheres, tuple)
 	}
 
@@ -772,7 +842,7 @@ func parserHaving(exprs sqlparser.Expr, tbInfos map[string]*TableInfo) ([]filter
 			return nil, err
 		}
 
-		tuple := filterTuple{filter, referTables, nil, nil}
+		tuple := filterTuple{filter, referTables, nil, nil, nil, nil}
 		tuples = append(tuples, tuple)
 	}
 
@@ -839,6 +909,53 @@ func getIndex(router *router.Router, tbInfo *TableInfo, val *sqlparser.SQLVal) e
 	return nil
 }
 
+// shardKeyRange is the range of the shard key bounded by the filters.
+type shardKeyRange struct {
+	tbInfo     *TableInfo
+	start, end *sqlparser.SQLVal
+}
+
+// addShardKeyRange merges the bounds of the range filter on the shard key into ranges.
+// The range is bounded by the later filter if the same side is bounded twice,
+// it's still the superset of the rows.
+func addShardKeyRange(ranges map[string]*shardKeyRange, tb string, tbInfo *TableInfo, filter filterTuple) {
+	if filter.start == nil && filter.end == nil {
+		return
+	}
+	if !nameMatch(filter.col, tb, tbInfo.shardKey) {
+		return
+	}
+	kr, ok := ranges[tb]
+	if !ok {
+		kr = &shardKeyRange{tbInfo: tbInfo}
+		ranges[tb] = kr
+	}
+	if filter.start != nil {
+		kr.start = filter.start
+	}
+	if filter.end != nil {
+		kr.end = filter.end
+	}
+}
+
+// getRangeIndex used to get the indexes of the segments by the shard key ranges bounded on both sides,
+// the range which can't be pruned scans all the segments.
+func getRangeIndex(router *router.Router, ranges map[string]*shardKeyRange) error {
+	for _, kr := range ranges {
+		if kr.start == nil || kr.end == nil {
+			continue
+		}
+		indexes, ok, err := router.GetRangeIndex(kr.tbInfo.database, kr.tbInfo.tableName, kr.start, kr.end)
+		if err != nil {
+			return err
+		}
+		if ok {
+			kr.tbInfo.parent.index = append(kr.tbInfo.parent.index, indexes...)
+		}
+	}
+	return nil
+}
+
 func getSelectExprs(node sqlparser.SelectStatement) sqlparser.SelectExprs {
 	var exprs sqlparser.SelectExprs
 	switch node := node.(type) {
@@ -48,6 +48,56 @@ func TestGetDMLRouting(t *testing.T) {
 	}
 }
 
+func TestShardKeyVal(t *testing.T) {
+	querys := []struct {
+		expr string
+		val  string
+		ok   bool
+	}{
+		{"-1", "-1", true},
+		{"-1.5", "-1.5", true},
+		{"+1.5", "1.5", true},
+		{"- -1.5", "1.5", true},
+		{"'-1'", "-1", true},
+		{"-'1'", "", false},
+		{"-a", "", false},
+		{"~1", "", false},
+	}
+	for _, q := range querys {
+		node, err := sqlparser.Parse("select * from B where id = " + q.expr)
+		assert.Nil(t, err)
+		val, ok := shardKeyVal(node.(*sqlparser.Select).Where.Expr.(*sqlparser.ComparisonExpr).Right)
+		assert.Equal(t, q.ok, ok, q.expr)
+		if ok {
+			assert.Equal(t, q.val, string(val.Val), q.expr)
+		}
+	}
+
+	// The signed values are routed the same whichever form they're written in.
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableBConfig())
+	assert.Nil(t, err)
+
+	var segments [][]router.Segment
+	for _, query := range []string{
+		"select * from B where id = -1.5",
+		"select * from B where id = '-1'",
+		"select * from B where id = -1",
+	} {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		got, err := getDMLRouting(database, "B", "id", node.(*sqlparser.Select).Where, route)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(got))
+		segments = append(segments, got)
+	}
+	assert.Equal(t, segments[0], segments[1])
+	assert.Equal(t, segments[0], segments[2])
+}
+
 func TestParserSelectExprsSubquery(t *testing.T) {
 	query := "select A.*,(select b.str from b where A.id=B.id) str from A"
 	want := "unsupported: subqueries.in.select.exprs"
@@ -99,6 +149,52 @@ func TestParserWhereOrJoinExprs(t *testing.T) {
 	}
 }
 
+func TestParserWhereRangeFilters(t *testing.T) {
+	tests := []struct {
+		query      string
+		start, end string
+	}{
+		{"select * from A where id between 1 and 10", "1", "10"},
+		{"select * from A where id >= -1", "-1", ""},
+		{"select * from A where id > 1", "1", ""},
+		{"select * from A where id < '2020-01-01'", "", "2020-01-01"},
+		{"select * from A where 10 >= id", "", "10"},
+		{"select * from A where 1 < id", "1", ""},
+		{"select * from A where id not between 1 and 10", "", ""},
+		{"select * from A where id between 1 and b", "", ""},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	val := func(v *sqlparser.SQLVal) string {
+		if v == nil {
+			return ""
+		}
+		return string(v.Val)
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err)
+		sel := node.(*sqlparser.Select)
+
+		p, err := scanTableExprs(log, route, database, sel.From)
+		assert.Nil(t, err)
+
+		_, filters, err := parserWhereOrJoinExprs(sel.Where.Expr, p.getReferredTables())
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(filters))
+		assert.Equal(t, test.start, val(filters[0].start), test.query)
+		assert.Equal(t, test.end, val(filters[0].end), test.query)
+	}
+}
+
 func TestWhereFilters(t *testing.T) {
 	querys := []string{
 		"select * from G, A where G.id=A.id and A.id=1",
@@ -9,6 +9,9 @@
 package planner
 
 import (
+	"fmt"
+	"strings"
+
 	"config"
 	"router"
 
@@ -39,6 +42,13 @@ type TableInfo struct {
 	parent *MergeNode
 }
 
+// rewriteAt used to rewrite the table's name to its i-th segment.
+func (t *TableInfo) rewriteAt(i int) {
+	expr, _ := t.tableExpr.Expr.(sqlparser.TableName)
+	expr.Name = sqlparser.NewTableIdent(t.Segments[i].Table)
+	t.tableExpr.Expr = expr
+}
+
 /* scanTableExprs analyzes the 'FROM' clause, build a plannode tree.
  * eg: select t1.a, t3.b from t1 join t2 on t1.a=t2.a join t3 on t1.a=t3.a;
  *             JoinNode
@@ -93,7 +103,6 @@ func scanAliasedTableExpr(log *xlog.Log, r *router.Router, database string, tabl
 		}
 		tn := &TableInfo{
 			database: expr.Qualifier.String(),
-			Segments: make([]router.Segment, 0, 16),
 		}
 		if expr.Qualifier.IsEmpty() {
 			expr.Qualifier = sqlparser.NewTableIdent(database)
@@ -114,7 +123,7 @@ func scanAliasedTableExpr(log *xlog.Log, r *router.Router, database string, tabl
 		case "SINGLE":
 			mn.index = append(mn.index, 0)
 			mn.nonGlobalCnt = 1
-		case "HASH":
+		case "HASH", "LIST", "CHASH":
 			// if a shard table hasn't alias, create one in order to push.
 			if tableExpr.As.String() == "" {
 				tableExpr.As = sqlparser.NewTableIdent(tn.tableName)
@@ -279,13 +288,19 @@ func isSameShard(ltb, rtb map[string]*TableInfo, lcn, rcn *sqlparser.ColName) bo
 	}
 	rtp := rt.tableConfig.Partitions
 
-	if len(ltp) != len(rtp) {
+	if lt.shardType != rt.shardType || len(ltp) != len(rtp) {
 		return false
 	}
 	for i, lpart := range ltp {
 		if lpart.Segment != rtp[i].Segment || lpart.Backend != rtp[i].Backend {
 			return false
 		}
+		if strings.Join(lpart.ListValues, ",") != strings.Join(rtp[i].ListValues, ",") {
+			return false
+		}
+		if fmt.Sprint(lpart.Ring) != fmt.Sprint(rtp[i].Ring) {
+			return false
+		}
 	}
 	return true
 }
@@ -0,0 +1,108 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
+)
+
+const (
+	hintNoPushdown = "radon_no_pushdown"
+	hintStream     = "radon_stream"
+	hintWorkload   = "radon_workload"
+	hintForceDML   = "radon_force_dml"
+	hintBackends   = "radon_backends"
+)
+
+var (
+	hintRegexp = regexp.MustCompile(`(?i)radon_\w+\s*(\([^)]*\))?`)
+)
+
+// Hints tuple, the radon-specific hints in the statement comments, such as:
+// /*+ radon_no_pushdown(aggregate, limit) */
+// /*+ radon_stream */
+// /*+ radon_workload(olap) */
+// /*+ radon_force_dml */
+// /*+ radon_backends(backend1, backend3) */
+type Hints struct {
+	// NoPushdownAggregate disables pushing the aggregate functions down to the backends.
+	NoPushdownAggregate bool
+	// NoPushdownLimit disables pushing the limit down to the backends.
+	NoPushdownLimit bool
+	// Stream forces the select to be executed in streaming fetch.
+	Stream bool
+	// Workload is the workload class of the query in lower case, empty if not labeled.
+	Workload string
+	// ForceDML skips the max-dml-rows check of the scatter UPDATE and DELETE.
+	ForceDML bool
+	// Backends are the backends the DDL is executed on, empty if all the backends of the table.
+	Backends []string
+}
+
+// ParseHints used to parse the radon hints from the comments.
+// Returns the hints and the comments without the radon hints, which will be sent to the backends.
+func ParseHints(comments sqlparser.Comments) (*Hints, sqlparser.Comments) {
+	hints := &Hints{}
+	var rest sqlparser.Comments
+
+	for _, comment := range comments {
+		str := common.BytesToString(comment)
+		if !strings.HasPrefix(str, "/*+") || !strings.HasSuffix(str, "*/") {
+			rest = append(rest, comment)
+			continue
+		}
+
+		body := strings.TrimSuffix(strings.TrimPrefix(str, "/*+"), "*/")
+		others := hintRegexp.ReplaceAllStringFunc(body, func(hint string) string {
+			name := hint
+			args := ""
+			if idx := strings.Index(hint, "("); idx >= 0 {
+				name = hint[:idx]
+				args = strings.Trim(hint[idx:], "()")
+			}
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case hintNoPushdown:
+				for _, arg := range strings.Split(args, ",") {
+					switch strings.ToLower(strings.TrimSpace(arg)) {
+					case "aggregate":
+						hints.NoPushdownAggregate = true
+					case "limit":
+						hints.NoPushdownLimit = true
+					}
+				}
+			case hintStream:
+				hints.Stream = true
+			case hintWorkload:
+				hints.Workload = strings.ToLower(strings.TrimSpace(args))
+			case hintForceDML:
+				hints.ForceDML = true
+			case hintBackends:
+				for _, arg := range strings.Split(args, ",") {
+					if backend := strings.TrimSpace(arg); backend != "" {
+						hints.Backends = append(hints.Backends, backend)
+					}
+				}
+			default:
+				return hint
+			}
+			return ""
+		})
+
+		if others == body {
+			rest = append(rest, comment)
+		} else if strings.TrimSpace(strings.Trim(others, "+")) != "" {
+			rest = append(rest, []byte("/*+"+others+"*/"))
+		}
+	}
+	return hints, rest
+}
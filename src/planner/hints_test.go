@@ -0,0 +1,151 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestParseHints(t *testing.T) {
+	querys := []string{
+		"select /*+ radon_no_pushdown(aggregate) */ a from t",
+		"select /*+ RADON_NO_PUSHDOWN(aggregate, limit) RADON_STREAM */ a from t",
+		"select /*+ radon_stream */ a from t",
+		"select /*+ radon_stream max_execution_time(1000) */ /* comment */ a from t",
+		"select /*+nested+*/ a from t",
+		"select /*+ radon_workload(OLAP) radon_stream */ a from t",
+		"select /*+ radon_force_dml */ a from t",
+		"select /*+ radon_backends(backend1, backend3) */ a from t",
+		"select a from t",
+	}
+	wants := []Hints{
+		{NoPushdownAggregate: true},
+		{NoPushdownAggregate: true, NoPushdownLimit: true, Stream: true},
+		{Stream: true},
+		{Stream: true},
+		{},
+		{Stream: true, Workload: "olap"},
+		{ForceDML: true},
+		{Backends: []string{"backend1", "backend3"}},
+		{},
+	}
+	comments := []string{
+		"select a from t",
+		"select a from t",
+		"select a from t",
+		"select /*+ max_execution_time(1000) */ /* comment */ a from t",
+		"select /*+nested+*/ a from t",
+		"select a from t",
+		"select a from t",
+		"select a from t",
+		"select a from t",
+	}
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		sel := node.(*sqlparser.Select)
+		hints, rest := ParseHints(sel.Comments)
+		assert.Equal(t, wants[i], *hints)
+
+		sel.Comments = rest
+		assert.Equal(t, comments[i], sqlparser.String(sel))
+	}
+}
+
+func TestSelectPlanHints(t *testing.T) {
+	querys := []string{
+		"select /*+ radon_no_pushdown(aggregate) */ sum(a), b from A where id>1 group by b",
+		"select /*+ radon_no_pushdown(limit) */ a from A where id>1 order by a limit 10",
+		"select sum(a), b from A where id>1 group by b",
+		"select a from A where id>1 order by a limit 10",
+	}
+	wants := []string{
+		"select a as `sum(a)`, b from sbtest.A1 as A where id > 1 group by b order by b asc",
+		"select a from sbtest.A1 as A where id > 1 order by a asc",
+		"select sum(a), b from sbtest.A1 as A where id > 1 group by b order by b asc",
+		"select a from sbtest.A1 as A where id > 1 order by a asc limit 10",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, wants[i], plan.Root.GetQuery()[0].Query)
+	}
+}
+
+func TestDMLPlanHints(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// delete.
+	{
+		query := "delete /*+ radon_force_dml */ from A where name='xx'"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.True(t, plan.Scatter)
+		assert.True(t, plan.Force())
+		assert.Equal(t, "delete from sbtest.A0 where name = 'xx'", plan.Querys[0].Query)
+		assert.Equal(t, 4, len(plan.CountQuerys))
+		assert.Equal(t, "select count(*) from sbtest.A0 where name = 'xx'", plan.CountQuerys[0].Query)
+		assert.Equal(t, "backend0", plan.CountQuerys[0].Backend)
+	}
+
+	// update.
+	{
+		query := "update A set name='yy' where name='xx'"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.True(t, plan.Scatter)
+		assert.False(t, plan.Force())
+		assert.Equal(t, 4, len(plan.CountQuerys))
+		assert.Equal(t, "select count(*) from sbtest.A0 where name = 'xx'", plan.CountQuerys[0].Query)
+	}
+
+	// routed by the shard key.
+	{
+		query := "update A set name='yy' where id=1"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.False(t, plan.Scatter)
+		assert.Equal(t, 0, len(plan.CountQuerys))
+	}
+}
@@ -99,6 +99,7 @@ func (p *InsertPlan) Build() error {
 				Query:   buf.String(),
 				Backend: segment.Backend,
 				Range:   segment.Range.String(),
+				Table:   database + "." + segment.Table,
 			}
 			p.Querys = append(p.Querys, tuple)
 		}
@@ -138,7 +139,7 @@ func (p *InsertPlan) Build() error {
 		if idx >= len(row) {
 			return errors.Errorf("unsupported: shardkey[%v].out.of.index:[%v]", shardKey, idx)
 		}
-		shardVal, ok := row[idx].(*sqlparser.SQLVal)
+		shardVal, ok := shardKeyVal(row[idx])
 		if !ok {
 			return errors.Errorf("unsupported: shardkey[%v].type.canot.be[%T]", shardKey, row[idx])
 		}
@@ -171,6 +172,7 @@ func (p *InsertPlan) Build() error {
 			Query:   buf.String(),
 			Backend: v.backend,
 			Range:   v.rangi,
+			Table:   database + "." + rewritten,
 		}
 		p.Querys = append(p.Querys, tuple)
 	}
@@ -154,6 +154,7 @@ func (j *JoinNode) setParenthese(hasParen bool) {
 func (j *JoinNode) pushFilter(filters []filterTuple) error {
 	var err error
 	rightTbs := j.Right.getReferredTables()
+	ranges := make(map[string]*shardKeyRange)
 	for _, filter := range filters {
 		if len(filter.referTables) == 0 {
 			j.noTableFilter = append(j.noTableFilter, filter.expr)
@@ -182,6 +183,9 @@ func (j *JoinNode) pushFilter(filters []filterTuple) error {
 						}
 					}
 				}
+				if tbInfo.shardKey != "" {
+					addShardKeyRange(ranges, tb, tbInfo, filter)
+				}
 			}
 		} else {
 			var parent SelectNode
@@ -206,7 +210,7 @@ func (j *JoinNode) pushFilter(filters []filterTuple) error {
 			}
 		}
 	}
-	return err
+	return getRangeIndex(j.router, ranges)
 }
 
 // setParent set the parent node.
@@ -0,0 +1,200 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"config"
+	"router"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// LookupRoute is the lookup table which routes the select filtering on its column of the table,
+// the shard keys of the values are read from the lookup table and added to the filters of the select.
+type LookupRoute struct {
+	Database string
+	Table    string
+	// Alias is the name of the table in the select, the alias if it's aliased.
+	Alias    string
+	ShardKey string
+	Lookup   *config.LookupConfig
+	// Vals are the values the column is compared with by '=' or IN.
+	Vals []*sqlparser.SQLVal
+}
+
+// LookupRoutes returns the lookup routes of the tables in the FROM clause of the select, which are filtered
+// on the lookup columns with the constant values but not on the shard keys.
+func LookupRoutes(route *router.Router, database string, node *sqlparser.Select) []*LookupRoute {
+	if node.Where == nil {
+		return nil
+	}
+	tables := make(map[string]*LookupRoute)
+	var aliases []string
+	count := 0
+	var walk func(expr sqlparser.TableExpr)
+	walk = func(expr sqlparser.TableExpr) {
+		switch expr := expr.(type) {
+		case *sqlparser.AliasedTableExpr:
+			count++
+			name, ok := expr.Expr.(sqlparser.TableName)
+			if !ok {
+				return
+			}
+			db := database
+			if !name.Qualifier.IsEmpty() {
+				db = name.Qualifier.String()
+			}
+			tconf, err := route.TableConfig(db, name.Name.String())
+			if err != nil || len(tconf.Lookups) == 0 {
+				return
+			}
+			alias := name.Name.String()
+			if !expr.As.IsEmpty() {
+				alias = expr.As.String()
+			}
+			tables[alias] = &LookupRoute{Database: db, Table: name.Name.String(), Alias: alias, ShardKey: tconf.ShardKey}
+			aliases = append(aliases, alias)
+		case *sqlparser.JoinTableExpr:
+			walk(expr.LeftExpr)
+			walk(expr.RightExpr)
+		case *sqlparser.ParenTableExpr:
+			for _, x := range expr.Exprs {
+				walk(x)
+			}
+		}
+	}
+	for _, expr := range node.From {
+		walk(expr)
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	sharded := make(map[string]bool)
+	for _, filter := range splitAndExpression(nil, node.Where.Expr) {
+		filter = convertOrToIn(skipParenthesis(filter))
+		cmp, ok := filter.(*sqlparser.ComparisonExpr)
+		if !ok {
+			continue
+		}
+		col, ok := cmp.Left.(*sqlparser.ColName)
+		if !ok {
+			continue
+		}
+		alias := col.Qualifier.Name.String()
+		if alias == "" && count == 1 {
+			alias = aliases[0]
+		}
+		lr, ok := tables[alias]
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(col.Name.String(), lr.ShardKey) {
+			sharded[alias] = true
+			continue
+		}
+		if lr.Lookup != nil {
+			continue
+		}
+		tconf, _ := route.TableConfig(lr.Database, lr.Table)
+		for _, lookup := range tconf.Lookups {
+			if lookup.Backfilling || !strings.EqualFold(col.Name.String(), lookup.Column) {
+				continue
+			}
+			var vals []*sqlparser.SQLVal
+			switch cmp.Operator {
+			case sqlparser.EqualStr:
+				if val, ok := shardKeyVal(cmp.Right); ok {
+					vals = append(vals, val)
+				}
+			case sqlparser.InStr:
+				if tuple, ok := cmp.Right.(sqlparser.ValTuple); ok {
+					for _, x := range tuple {
+						val, ok := shardKeyVal(x)
+						if !ok {
+							vals = nil
+							break
+						}
+						vals = append(vals, val)
+					}
+				}
+			}
+			if len(vals) > 0 {
+				lr.Lookup, lr.Vals = lookup, vals
+			}
+		}
+	}
+
+	var routes []*LookupRoute
+	for _, alias := range aliases {
+		if lr := tables[alias]; lr.Lookup != nil && !sharded[alias] {
+			routes = append(routes, lr)
+		}
+	}
+	return routes
+}
+
+// LookupDMLRoutes returns the lookup routes of the table of the single-table UPDATE or DELETE as LookupRoutes does,
+// the shard key of their filters isn't qualified since the table is renamed to the segment in the DML.
+func LookupDMLRoutes(route *router.Router, database string, node sqlparser.Statement) []*LookupRoute {
+	var table sqlparser.TableName
+	var where *sqlparser.Where
+	switch node := node.(type) {
+	case *sqlparser.Update:
+		table, where = node.Table, node.Where
+	case *sqlparser.Delete:
+		table, where = node.Table, node.Where
+	default:
+		return nil
+	}
+	sel := &sqlparser.Select{From: sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: table}}, Where: where}
+	routes := LookupRoutes(route, database, sel)
+	for _, lr := range routes {
+		lr.Alias = ""
+	}
+	return routes
+}
+
+// Query returns the select of the shard keys of the values from the lookup table.
+func (l *LookupRoute) Query() string {
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("select %s from %s.%s where %s in %v", sqlparser.Backtick(l.ShardKey), sqlparser.Backtick(l.Database),
+		sqlparser.Backtick(l.Lookup.Table), sqlparser.Backtick(l.Lookup.Column), lookupValTuple(l.Vals))
+	return buf.String()
+}
+
+// Filter returns the filter of the table on the shard keys read from the lookup table, such as 't1.id in (1, 2)'.
+func (l *LookupRoute) Filter(keys []*sqlparser.SQLVal) sqlparser.Expr {
+	return ShardKeyFilter(l.Alias, l.ShardKey, keys)
+}
+
+// ShardKeyFilter returns the filter of the shard key on the keys, the column isn't qualified if the table is empty.
+func ShardKeyFilter(table, shardKey string, keys []*sqlparser.SQLVal) sqlparser.Expr {
+	col := &sqlparser.ColName{Name: sqlparser.NewColIdent(shardKey), Qualifier: sqlparser.TableName{Name: sqlparser.NewTableIdent(table)}}
+	if len(keys) == 1 {
+		return &sqlparser.ComparisonExpr{Operator: sqlparser.EqualStr, Left: col, Right: keys[0]}
+	}
+	return &sqlparser.ComparisonExpr{Operator: sqlparser.InStr, Left: col, Right: lookupValTuple(keys)}
+}
+
+// String returns the route for the logs.
+func (l *LookupRoute) String() string {
+	return fmt.Sprintf("%s.%s.%s->%s", l.Database, l.Table, l.Lookup.Column, l.Lookup.Table)
+}
+
+func lookupValTuple(vals []*sqlparser.SQLVal) sqlparser.ValTuple {
+	tuple := make(sqlparser.ValTuple, 0, len(vals))
+	for _, val := range vals {
+		tuple = append(tuple, val)
+	}
+	return tuple
+}
@@ -0,0 +1,118 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"config"
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestLookupRoutes(t *testing.T) {
+	querys := []string{
+		"select * from A where a=1",
+		"select * from A where a in (1, 2) and b=3",
+		"select * from A where a=1 or a=2",
+		"select * from A as x where x.a='s'",
+		"select * from A where a=1 and id=2",
+		"select * from A where a>1",
+		"select * from A where a in (1, b)",
+		"select * from A where b=1",
+		"select * from A",
+		"select * from A join B on A.id=B.id where a=1",
+		"select * from A join B on A.id=B.id where A.a=1",
+	}
+	results := []string{
+		"select `id` from `sbtest`.`A_a` where `a` in (1)",
+		"select `id` from `sbtest`.`A_a` where `a` in (1, 2)",
+		"select `id` from `sbtest`.`A_a` where `a` in (1, 2)",
+		"select `id` from `sbtest`.`A_a` where `a` in ('s')",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"",
+		"select `id` from `sbtest`.`A_a` where `a` in (1)",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	tconf := router.MockTableMConfig()
+	tconf.Lookups = []*config.LookupConfig{{Column: "a", Table: "A_a"}, {Column: "b", Table: "A_b", Backfilling: true}}
+	err := route.AddForTest(database, tconf, router.MockTableBConfig())
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		routes := LookupRoutes(route, database, node.(*sqlparser.Select))
+		got := ""
+		if len(routes) > 0 {
+			assert.Equal(t, 1, len(routes), query)
+			got = routes[0].Query()
+		}
+		assert.Equal(t, results[i], got, query)
+	}
+
+	// Filter.
+	{
+		keys := []*sqlparser.SQLVal{sqlparser.NewIntVal([]byte("1"))}
+		lr := &LookupRoute{Alias: "x", ShardKey: "id"}
+		assert.Equal(t, "x.id = 1", sqlparser.String(lr.Filter(keys)))
+		keys = append(keys, sqlparser.NewIntVal([]byte("2")))
+		assert.Equal(t, "x.id in (1, 2)", sqlparser.String(lr.Filter(keys)))
+		assert.Equal(t, "id in (1, 2)", sqlparser.String(ShardKeyFilter("", "id", keys)))
+	}
+}
+
+func TestLookupDMLRoutes(t *testing.T) {
+	querys := []string{
+		"update A set b=1 where a=1",
+		"delete from A where a in (1, 2)",
+		"delete from A where a=1 and id=1",
+		"update A set a=1 where b=1",
+		"insert into A(id, a) values(1, 1)",
+	}
+	results := []string{
+		"id = 1",
+		"id in (1, 2)",
+		"",
+		"",
+		"",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	tconf := router.MockTableMConfig()
+	tconf.Lookups = []*config.LookupConfig{{Column: "a", Table: "A_a"}}
+	err := route.AddForTest(database, tconf)
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		routes := LookupDMLRoutes(route, database, node)
+		got := ""
+		if len(routes) > 0 {
+			assert.Equal(t, 1, len(routes), query)
+			got = sqlparser.String(routes[0].Filter(routes[0].Vals))
+		}
+		assert.Equal(t, results[i], got, query)
+	}
+}
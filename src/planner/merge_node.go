@@ -10,7 +10,6 @@ package planner
 
 import (
 	"math/rand"
-	"time"
 
 	"router"
 	"xcontext"
@@ -36,6 +35,8 @@ type MergeNode struct {
 	routeLen int
 	// referred tables' tableInfo map.
 	referredTables map[string]*TableInfo
+	// tables of the subqueries pushed down with the select, they're rewritten to the segments too.
+	subTables []*TableInfo
 	// whether has parenthese in FROM clause.
 	hasParen bool
 	// parent node in the plan tree.
@@ -97,6 +98,7 @@ func (m *MergeNode) setParenthese(hasParen bool) {
 // pushFilter used to push the filters.
 func (m *MergeNode) pushFilter(filters []filterTuple) error {
 	var err error
+	ranges := make(map[string]*shardKeyRange)
 	for _, filter := range filters {
 		m.addWhere(filter.expr)
 		if len(filter.referTables) == 1 {
@@ -110,9 +112,12 @@ func (m *MergeNode) pushFilter(filters []filterTuple) error {
 					}
 				}
 			}
+			if tbInfo.shardKey != "" {
+				addShardKeyRange(ranges, filter.referTables[0], tbInfo, filter)
+			}
 		}
 	}
-	return err
+	return getRangeIndex(m.router, ranges)
 }
 
 // setParent set the parent node.
@@ -157,7 +162,6 @@ func (m *MergeNode) calcRoute() (SelectNode, error) {
 			if err != nil {
 				return nil, err
 			}
-			rand := rand.New(rand.NewSource(time.Now().UnixNano()))
 			idx := rand.Intn(len(segments))
 			m.backend = segments[idx].Backend
 			m.index = append(m.index, idx)
@@ -290,7 +294,6 @@ func (m *MergeNode) Order() int {
 
 // buildQuery used to build the QueryTuple.
 func (m *MergeNode) buildQuery(tbInfos map[string]*TableInfo) {
-	var Range string
 	if sel, ok := m.Sel.(*sqlparser.Select); ok {
 		for expr := range m.filters {
 			m.addWhere(expr)
@@ -306,7 +309,7 @@ func (m *MergeNode) buildQuery(tbInfos map[string]*TableInfo) {
 		switch node := node.(type) {
 		case *sqlparser.ColName:
 			tableName := node.Qualifier.Name.String()
-			if tableName != "" {
+			if tableName != "" && !m.hasSubTable(tableName) {
 				if _, ok := m.referredTables[tableName]; !ok {
 					joinVar := procure(tbInfos, node)
 					buf.Myprintf("%a", ":"+joinVar)
@@ -319,19 +322,7 @@ func (m *MergeNode) buildQuery(tbInfos map[string]*TableInfo) {
 
 	for i := 0; i < m.routeLen; i++ {
 		// Rewrite the shard table's name.
-		backend := m.backend
-		for _, tbInfo := range m.referredTables {
-			if tbInfo.shardKey == "" {
-				continue
-			}
-			if backend == "" {
-				backend = tbInfo.Segments[i].Backend
-			}
-			Range = tbInfo.Segments[i].Range.String()
-			expr, _ := tbInfo.tableExpr.Expr.(sqlparser.TableName)
-			expr.Name = sqlparser.NewTableIdent(tbInfo.Segments[i].Table)
-			tbInfo.tableExpr.Expr = expr
-		}
+		backend, Range, Table := m.segmentAt(i)
 
 		buf := sqlparser.NewTrackedBuffer(varFormatter)
 		varFormatter(buf, m.Sel)
@@ -342,11 +333,46 @@ func (m *MergeNode) buildQuery(tbInfos map[string]*TableInfo) {
 			Query:   pq.Query,
 			Backend: backend,
 			Range:   Range,
+			Table:   Table,
 		}
 		m.Querys = append(m.Querys, tuple)
 	}
 }
 
+// segmentAt used to rewrite the shard tables' names to their i-th segments,
+// returns the backend, range and table of the segment.
+func (m *MergeNode) segmentAt(i int) (string, string, string) {
+	var rng, table string
+	backend := m.backend
+	for _, tbInfo := range m.referredTables {
+		if tbInfo.shardKey == "" {
+			continue
+		}
+		if backend == "" {
+			backend = tbInfo.Segments[i].Backend
+		}
+		rng = tbInfo.Segments[i].Range.String()
+		table = tbInfo.database + "." + tbInfo.Segments[i].Table
+		tbInfo.rewriteAt(i)
+	}
+	for _, tbInfo := range m.subTables {
+		if tbInfo.shardKey != "" {
+			tbInfo.rewriteAt(i)
+		}
+	}
+	return backend, rng, table
+}
+
+// hasSubTable returns true if the name is the table or alias of the subqueries pushed down.
+func (m *MergeNode) hasSubTable(name string) bool {
+	for _, tbInfo := range m.subTables {
+		if tbInfo.alias == name || (tbInfo.alias == "" && tbInfo.tableName == name) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetQuery used to get the Querys.
 func (m *MergeNode) GetQuery() []xcontext.QueryTuple {
 	return m.Querys
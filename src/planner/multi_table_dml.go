@@ -0,0 +1,271 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"regexp"
+	"strings"
+
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	// DELETE t1[, t2] FROM table_references [WHERE where_condition]
+	multiDeleteRegexp = regexp.MustCompile("(?is)^delete\\s+((?:/\\*.*?\\*/\\s*)*)([\\w.*`]+(?:\\s*,\\s*[\\w.*`]+)*)\\s+from\\s+(.+)$")
+	// DELETE FROM t1[, t2] USING table_references [WHERE where_condition]
+	multiDeleteUsingRegexp = regexp.MustCompile("(?is)^delete\\s+((?:/\\*.*?\\*/\\s*)*)from\\s+([\\w.*`]+(?:\\s*,\\s*[\\w.*`]+)*)\\s+using\\s+(.+)$")
+	// UPDATE table_references SET assignment_list [WHERE where_condition]
+	multiUpdateRegexp = regexp.MustCompile("(?is)^update\\s+((?:/\\*.*?\\*/\\s*)*)(.+?)\\s+set\\s+(.+)$")
+	// The table references of the multi-table UPDATE have the join.
+	multiTableRefsRegexp = regexp.MustCompile(`(?i)(,|\bjoin\b)`)
+	commentRegexp        = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// MultiTableDML is the multi-table DELETE or UPDATE, the parser doesn't support it so it's parsed by parts:
+// the table references and the where are parsed as a SELECT, the assignments as a single-table UPDATE.
+type MultiTableDML struct {
+	// Action is delete or update.
+	Action   string
+	Comments sqlparser.Comments
+	// Targets are the names or aliases of the tables deleted from or updated.
+	Targets []string
+	From    sqlparser.TableExprs
+	Exprs   sqlparser.UpdateExprs
+	Where   *sqlparser.Where
+}
+
+// IsMultiTableDML returns true if the query is a multi-table DELETE or UPDATE.
+func IsMultiTableDML(query string) bool {
+	if m := multiDeleteRegexp.FindStringSubmatch(query); m != nil && !strings.EqualFold(m[2], "from") {
+		return true
+	}
+	if multiDeleteUsingRegexp.MatchString(query) {
+		return true
+	}
+	if m := multiUpdateRegexp.FindStringSubmatch(query); m != nil {
+		return multiTableRefsRegexp.MatchString(m[2])
+	}
+	return false
+}
+
+// ParseMultiTableDML used to parse the multi-table DELETE or UPDATE.
+func ParseMultiTableDML(query string) (*MultiTableDML, error) {
+	dml := &MultiTableDML{}
+	var comments, targets, refs string
+	if m := multiDeleteRegexp.FindStringSubmatch(query); m != nil && !strings.EqualFold(m[2], "from") {
+		dml.Action, comments, targets, refs = "delete", m[1], m[2], m[3]
+	} else if m := multiDeleteUsingRegexp.FindStringSubmatch(query); m != nil {
+		dml.Action, comments, targets, refs = "delete", m[1], m[2], m[3]
+	} else if m := multiUpdateRegexp.FindStringSubmatch(query); m != nil && multiTableRefsRegexp.MatchString(m[2]) {
+		dml.Action, comments, refs = "update", m[1], m[2]
+		stmt, err := sqlparser.Parse("update radon_dual set " + m[3])
+		if err != nil {
+			return nil, err
+		}
+		upd := stmt.(*sqlparser.Update)
+		if len(upd.OrderBy) > 0 || upd.Limit != nil {
+			return nil, errors.New("unsupported: order.by.or.limit.in.multi.table.update")
+		}
+		dml.Exprs, dml.Where = upd.Exprs, upd.Where
+	} else {
+		return nil, errors.Errorf("unsupported: query[%s].is.not.multi.table.DML", query)
+	}
+
+	stmt, err := sqlparser.Parse("select 1 from " + refs)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return nil, errors.Errorf("unsupported: table.references[%s].in.multi.table.%s", refs, dml.Action)
+	}
+	if len(sel.OrderBy) > 0 || sel.Limit != nil || len(sel.GroupBy) > 0 || sel.Having != nil || sel.Lock != "" {
+		return nil, errors.Errorf("unsupported: clauses.in.multi.table.%s", dml.Action)
+	}
+	if dml.Action == "delete" {
+		dml.Where = sel.Where
+	} else if sel.Where != nil {
+		return nil, errors.Errorf("unsupported: table.references[%s].in.multi.table.update", refs)
+	}
+	dml.From = sel.From
+
+	for _, comment := range commentRegexp.FindAllString(comments, -1) {
+		dml.Comments = append(dml.Comments, []byte(comment))
+	}
+
+	// The targets of the update are the tables of the assigned columns.
+	if dml.Action == "update" {
+		for _, expr := range dml.Exprs {
+			qualifier := expr.Name.Qualifier.Name.String()
+			if qualifier == "" {
+				return nil, errors.Errorf("unsupported: unqualified.column[%s].in.multi.table.update", expr.Name.Name.String())
+			}
+			targets += "," + qualifier
+		}
+	}
+	seen := make(map[string]bool)
+	for _, target := range strings.Split(targets, ",") {
+		// t1, t1.*, db.t1, `t1`.
+		target = strings.TrimSuffix(strings.TrimSpace(target), ".*")
+		if idx := strings.LastIndex(target, "."); idx >= 0 {
+			target = target[idx+1:]
+		}
+		target = strings.Trim(target, "`")
+		if target == "" || seen[target] {
+			continue
+		}
+		if _, ok := dml.table(target); !ok {
+			return nil, errors.Errorf("unsupported: unknown.table[%s].in.multi.table.%s", target, dml.Action)
+		}
+		seen[target] = true
+		dml.Targets = append(dml.Targets, target)
+	}
+	return dml, nil
+}
+
+// table returns the table of the name or alias in the table references.
+func (dml *MultiTableDML) table(name string) (sqlparser.TableName, bool) {
+	var table sqlparser.TableName
+	found := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		aliased, ok := node.(*sqlparser.AliasedTableExpr)
+		if !ok || found {
+			return !found, nil
+		}
+		tb, ok := aliased.Expr.(sqlparser.TableName)
+		if !ok {
+			return false, nil
+		}
+		if aliased.As.String() == name || (aliased.As.IsEmpty() && tb.Name.String() == name) {
+			table, found = tb, true
+		}
+		return false, nil
+	}, dml.From)
+	return table, found
+}
+
+// Tables returns all the tables in the table references.
+func (dml *MultiTableDML) Tables() []sqlparser.TableName {
+	var tables []sqlparser.TableName
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if tb, ok := node.(sqlparser.TableName); ok {
+			tables = append(tables, tb)
+			return false, nil
+		}
+		return true, nil
+	}, dml.From)
+	return tables
+}
+
+// Node returns the single-table DELETE or UPDATE on the first target with the where, it goes through the DML path
+// as the statement of the query, the plan is built from the raw query.
+func (dml *MultiTableDML) Node() sqlparser.Statement {
+	table, _ := dml.table(dml.Targets[0])
+	if dml.Action == "delete" {
+		return &sqlparser.Delete{Comments: dml.Comments, Table: table, Where: dml.Where}
+	}
+	return &sqlparser.Update{Comments: dml.Comments, Table: table, Exprs: dml.Exprs, Where: dml.Where}
+}
+
+// hasJoinOn returns true if the table references have the join with the ON condition.
+func hasJoinOn(tableExprs sqlparser.TableExprs) bool {
+	has := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if join, ok := node.(*sqlparser.JoinTableExpr); ok && join.On != nil {
+			has = true
+		}
+		return !has, nil
+	}, tableExprs)
+	return has
+}
+
+// buildMultiTableDML used to build the querys of the multi-table DML, the tables are routed as the join of the select,
+// the DML is pushed down to every segment only if all the tables are merged into one route: they're co-located
+// by the equal shard keys on the same layout, or GLOBAL. The count querys are returned if the DML is scattered.
+func buildMultiTableDML(log *xlog.Log, r *router.Router, database string, dml *MultiTableDML) ([]xcontext.QueryTuple, []xcontext.QueryTuple, error) {
+	if hasSubquery(dml.From) || (dml.Where != nil && hasSubquery(dml.Where)) || hasSubquery(dml.Exprs) {
+		return nil, nil, errors.Errorf("unsupported: subqueries.in.%s", dml.Action)
+	}
+	if dml.Where == nil && !hasJoinOn(dml.From) {
+		return nil, nil, errors.New("unsupported: missing.where.clause.in.DML")
+	}
+
+	root, err := scanTableExprs(log, r, database, dml.From)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dml.Where != nil {
+		joins, filters, err := parserWhereOrJoinExprs(dml.Where.Expr, root.getReferredTables())
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = root.pushFilter(filters); err != nil {
+			return nil, nil, err
+		}
+		root = root.pushEqualCmpr(joins)
+	}
+	if root, err = root.calcRoute(); err != nil {
+		return nil, nil, err
+	}
+	m, ok := root.(*MergeNode)
+	if !ok {
+		return nil, nil, errors.Errorf("unsupported: multi.table.%s.on.the.tables.not.co-located", dml.Action)
+	}
+
+	for _, target := range dml.Targets {
+		tbInfo := m.referredTables[target]
+		// The GLOBAL table has a copy on every backend, the rows joined differ on the backends.
+		if tbInfo.shardType == "GLOBAL" {
+			return nil, nil, errors.Errorf("unsupported: multi.table.%s.on.the.global.table[%s]", dml.Action, target)
+		}
+		var exprs sqlparser.UpdateExprs
+		for _, expr := range dml.Exprs {
+			if expr.Name.Qualifier.Name.String() == target {
+				exprs = append(exprs, expr)
+			}
+		}
+		if isShardKeyChanging(exprs, tbInfo.shardKey) {
+			return nil, nil, errors.New("unsupported: cannot.update.shard.key")
+		}
+	}
+
+	for expr := range m.filters {
+		m.addWhere(expr)
+	}
+	sel := m.Sel.(*sqlparser.Select)
+	var querys, countQuerys []xcontext.QueryTuple
+	for i := 0; i < m.routeLen; i++ {
+		backend, rng, table := m.segmentAt(i)
+		buf := sqlparser.NewTrackedBuffer(nil)
+		if dml.Action == "delete" {
+			buf.Myprintf("delete %v%s from %v%v", dml.Comments, strings.Join(dml.Targets, ", "), sel.From, sel.Where)
+		} else {
+			buf.Myprintf("update %v%v set %v%v", dml.Comments, sel.From, dml.Exprs, sel.Where)
+		}
+		tuple := xcontext.QueryTuple{
+			Query:   buf.String(),
+			Backend: backend,
+			Range:   rng,
+			Table:   table,
+		}
+		querys = append(querys, tuple)
+		if m.routeLen > 1 {
+			buf := sqlparser.NewTrackedBuffer(nil)
+			buf.Myprintf("select count(*) from %v%v", sel.From, sel.Where)
+			tuple.Query = buf.String()
+			countQuerys = append(countQuerys, tuple)
+		}
+	}
+	return querys, countQuerys, nil
+}
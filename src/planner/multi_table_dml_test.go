@@ -0,0 +1,145 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"strings"
+	"testing"
+
+	"router"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestIsMultiTableDML(t *testing.T) {
+	querys := []string{
+		"delete A from A join C on A.id=C.id where C.b=1",
+		"delete A.*, C from A, C where A.id=C.id",
+		"DELETE /*+ radon_force_dml */ `A` FROM A JOIN C ON A.id=C.id",
+		"delete from A using A join C on A.id=C.id",
+		"update A join C on A.id=C.id set A.b=1",
+		"update A, C set A.b=C.b where A.id=C.id",
+		"delete from A where id=1",
+		"delete /*+ radon_force_dml */ from A where id in (1, 2)",
+		"delete from A where name='x from y'",
+		"update A set a=1, b=2 where id=1",
+		"update A set a='join' where id=1",
+	}
+	wants := []bool{true, true, true, true, true, true, false, false, false, false, false}
+	for i, query := range querys {
+		assert.Equal(t, wants[i], IsMultiTableDML(query), query)
+	}
+}
+
+func TestMultiTableDMLPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// C is co-located with A.
+	tableC := router.MockTableMConfig()
+	tableC.Name = "C"
+	for _, part := range tableC.Partitions {
+		part.Table = strings.Replace(part.Table, "A", "C", 1)
+	}
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableGConfig(), tableC)
+	assert.Nil(t, err)
+
+	newPlan := func(query string) Plan {
+		if strings.HasPrefix(query, "delete") {
+			return NewDeletePlan(log, database, query, &sqlparser.Delete{}, route)
+		}
+		return NewUpdatePlan(log, database, query, &sqlparser.Update{}, route)
+	}
+
+	// Single segment.
+	{
+		querys := []string{
+			"delete A from A join C on A.id=C.id where A.id=1",
+			"delete from A, C using A join C on A.id=C.id join G on G.id=A.b where C.id=1",
+			"delete a.* from sbtest.A as a, C where a.id=C.id and a.id=1",
+			"update A join C on A.id=C.id set A.b=C.b, C.b=1 where A.id=1",
+		}
+		wants := []string{
+			"delete A from sbtest.A6 as A join sbtest.C6 as C on A.id = C.id where A.id = 1",
+			"delete A, C from sbtest.A6 as A join sbtest.C6 as C on A.id = C.id join sbtest.G on G.id = A.b where C.id = 1",
+			"delete a from sbtest.A6 as a, sbtest.C6 as C where a.id = 1 and a.id = C.id",
+			"update sbtest.A6 as A join sbtest.C6 as C on A.id = C.id set A.b = C.b, C.b = 1 where A.id = 1",
+		}
+		for i, query := range querys {
+			plan := newPlan(query)
+			err := plan.Build()
+			assert.Nil(t, err, query)
+			var querys, countQuerys []xcontext.QueryTuple
+			switch plan := plan.(type) {
+			case *DeletePlan:
+				querys, countQuerys = plan.Querys, plan.CountQuerys
+			case *UpdatePlan:
+				querys, countQuerys = plan.Querys, plan.CountQuerys
+			}
+			assert.Equal(t, 1, len(querys), query)
+			assert.Equal(t, wants[i], querys[0].Query)
+			assert.Equal(t, "backend6", querys[0].Backend)
+			assert.Equal(t, 0, len(countQuerys))
+		}
+	}
+
+	// Scatter.
+	{
+		query := "update /*+ radon_force_dml */ A join G on A.b=G.id set A.c=G.c"
+		plan := newPlan(query).(*UpdatePlan)
+		err := plan.Build()
+		assert.Nil(t, err)
+		assert.True(t, plan.Scatter)
+		assert.True(t, plan.Force())
+		assert.Equal(t, 6, len(plan.Querys))
+		assert.Equal(t, 6, len(plan.CountQuerys))
+		assert.Equal(t, "update sbtest.A1 as A join sbtest.G on A.b = G.id set A.c = G.c", plan.Querys[0].Query)
+		assert.Equal(t, "select count(*) from sbtest.A1 as A join sbtest.G on A.b = G.id", plan.CountQuerys[0].Query)
+		assert.Equal(t, "backend1", plan.CountQuerys[0].Backend)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"delete A from A join B on A.id=B.id where A.id=1",
+			"delete A from A join C on A.b=C.b where A.id=1",
+			"delete G from A join G on A.b=G.id where A.id=1",
+			"update A join C on A.id=C.id set A.id=2 where C.id=1",
+			"update A join C on A.id=C.id set b=2 where C.id=1",
+			"delete X from A join C on A.id=C.id where C.id=1",
+			"delete A from A, C",
+			"delete A from A join C on A.id=C.id where A.b in (select b from G)",
+			"update A join C on A.id=C.id set A.b=1 where C.id=1 limit 1",
+		}
+		wants := []string{
+			"unsupported: multi.table.delete.on.the.tables.not.co-located",
+			"unsupported: multi.table.delete.on.the.tables.not.co-located",
+			"unsupported: multi.table.delete.on.the.global.table[G]",
+			"unsupported: cannot.update.shard.key",
+			"unsupported: unqualified.column[b].in.multi.table.update",
+			"unsupported: unknown.table[X].in.multi.table.delete",
+			"unsupported: missing.where.clause.in.DML",
+			"unsupported: subqueries.in.delete",
+			"unsupported: order.by.or.limit.in.multi.table.update",
+		}
+		for i, query := range querys {
+			err := newPlan(query).Build()
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, wants[i], err.Error(), query)
+			}
+		}
+	}
+}
@@ -8,7 +8,11 @@
 
 package planner
 
-import ()
+import (
+	"context"
+
+	"xbase"
+)
 
 // Plan interface.
 type Plan interface {
@@ -41,7 +45,15 @@ func (pt *PlanTree) Add(plan Plan) error {
 
 // Build used to build plans(we won't build sub-plans in this plan).
 func (pt *PlanTree) Build() error {
+	return pt.BuildContext(context.Background())
+}
+
+// BuildContext used to build plans, the building stops once the ctx is done.
+func (pt *PlanTree) BuildContext(ctx context.Context) error {
 	for _, plan := range pt.children {
+		if err := xbase.NewContextError(ctx); err != nil {
+			return err
+		}
 		if err := plan.Build(); err != nil {
 			return err
 		}
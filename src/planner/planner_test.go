@@ -9,6 +9,7 @@
 package planner
 
 import (
+	"context"
 	"testing"
 
 	"router"
@@ -74,3 +75,30 @@ func TestPlannerError(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestPlannerBuildContext(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	database := "xx"
+	query := "create table A(a int)"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	DDL := NewDDLPlan(log, database, query, node.(*sqlparser.DDL), route)
+
+	planTree := NewPlanTree()
+	err = planTree.Add(DDL)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = planTree.BuildContext(ctx)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Query execution was interrupted, the query is cancelled")
+}
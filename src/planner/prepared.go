@@ -0,0 +1,263 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"unicode/utf8"
+
+	"config"
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// PreparedPlan is the plan of the prepared SELECT, UPDATE or DELETE on one table whose shard key is compared with
+// the parameter, such as 'select * from t1 where id=?'. The plan is built once over all the segments with the
+// parameter kept as the bind variable, every execution is routed to the segment of the bound value by Bind
+// without parsing and planning the query again.
+type PreparedPlan struct {
+	log    *xlog.Log
+	router *router.Router
+
+	// database and table of the plan.
+	database string
+	table    string
+
+	// tconf is the table config the plan is built on, the plan is stale once the table is changed.
+	tconf *config.TableConfig
+
+	// arg is the name of the bind variable compared with the shard key, such as 'v1'.
+	arg string
+
+	// plan is built over all the segments, querys and parsedQuerys are its ones, index is keyed by the 'db.segment'.
+	plan         Plan
+	querys       []xcontext.QueryTuple
+	parsedQuerys []*sqlparser.ParsedQuery
+	index        map[string]int
+}
+
+// NewPreparedPlan used to build the PreparedPlan of the query with the parameters, the error is returned if the
+// query can't be routed by the parameter, it should be planned after the parameters are bound.
+func NewPreparedPlan(log *xlog.Log, database string, query string, router *router.Router) (*PreparedPlan, error) {
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var table sqlparser.TableName
+	var alias string
+	var where *sqlparser.Where
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if len(node.From) != 1 || len(node.Comments) > 0 || hasSubquery(node) {
+			return nil, errors.New("unsupported: prepared.plan.of.the.select.on.multiple.tables")
+		}
+		aliased, ok := node.From[0].(*sqlparser.AliasedTableExpr)
+		if !ok {
+			return nil, errors.New("unsupported: prepared.plan.of.the.select.on.multiple.tables")
+		}
+		if table, ok = aliased.Expr.(sqlparser.TableName); !ok {
+			return nil, errors.New("unsupported: prepared.plan.of.the.select.on.multiple.tables")
+		}
+		alias, where = aliased.As.String(), node.Where
+	case *sqlparser.Update:
+		if IsMultiTableDML(query) || len(node.Comments) > 0 {
+			return nil, errors.New("unsupported: prepared.plan.of.the.multi-table.update")
+		}
+		table, where = node.Table, node.Where
+	case *sqlparser.Delete:
+		if IsMultiTableDML(query) || len(node.Comments) > 0 {
+			return nil, errors.New("unsupported: prepared.plan.of.the.multi-table.delete")
+		}
+		table, where = node.Table, node.Where
+	default:
+		return nil, errors.Errorf("unsupported: prepared.plan.of.the.query[%s]", query)
+	}
+	if !table.Qualifier.IsEmpty() {
+		database = table.Qualifier.String()
+	}
+	tconf, err := router.TableConfig(database, table.Name.String())
+	if err != nil {
+		return nil, err
+	}
+	// The lookups and the resharding rewrite the querys before they're planned.
+	if tconf.ShardKey == "" || len(tconf.Lookups) > 0 || tconf.LookupOf != "" || tconf.ReshardTo != "" || tconf.ReshardOf != "" {
+		return nil, errors.Errorf("unsupported: prepared.plan.of.the.table[%s.%s]", database, tconf.Name)
+	}
+	arg, ok := preparedShardKeyArg(where, tconf.ShardKey, table.Name.String(), alias)
+	if !ok {
+		return nil, errors.Errorf("unsupported: prepared.plan.without.the.shard.key[%s].parameter", tconf.ShardKey)
+	}
+
+	p := &PreparedPlan{
+		log:      log,
+		router:   router,
+		database: database,
+		table:    table.Name.String(),
+		tconf:    tconf,
+		arg:      arg,
+	}
+	// The parameter isn't routed, the plan is built over all the segments.
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		plan := NewSelectPlan(log, database, query, node, router)
+		if err := plan.Build(); err != nil {
+			return nil, err
+		}
+		m, ok := plan.Root.(*MergeNode)
+		if !ok || m.ReqMode != xcontext.ReqNormal {
+			return nil, errors.New("unsupported: prepared.plan.of.the.select.isn't.merged")
+		}
+		p.plan, p.querys, p.parsedQuerys = plan, m.Querys, m.ParsedQuerys
+	case *sqlparser.Update:
+		plan := NewUpdatePlan(log, database, query, node, router)
+		if err := plan.Build(); err != nil {
+			return nil, err
+		}
+		p.plan, p.querys, p.parsedQuerys = plan, plan.Querys, plan.ParsedQuerys
+	case *sqlparser.Delete:
+		plan := NewDeletePlan(log, database, query, node, router)
+		if err := plan.Build(); err != nil {
+			return nil, err
+		}
+		p.plan, p.querys, p.parsedQuerys = plan, plan.Querys, plan.ParsedQuerys
+	}
+	if len(p.querys) != len(p.parsedQuerys) {
+		return nil, errors.New("unsupported: prepared.plan.querys.mismatch")
+	}
+	p.index = make(map[string]int, len(p.querys))
+	for i, tuple := range p.querys {
+		p.index[tuple.Table] = i
+	}
+	return p, nil
+}
+
+// preparedShardKeyArg returns the bind variable of the 'shardkey=?' in the top level AND of the where,
+// the shard key mustn't be in the other filters which route the query too.
+func preparedShardKeyArg(where *sqlparser.Where, shardkey, table, alias string) (string, bool) {
+	if where == nil {
+		return "", false
+	}
+	refers := 0
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok && col.Name.EqualString(shardkey) {
+			refers++
+		}
+		return true, nil
+	}, where.Expr)
+	if refers != 1 {
+		return "", false
+	}
+	for _, filter := range splitAndExpression(nil, where.Expr) {
+		comparison, ok := skipParenthesis(filter).(*sqlparser.ComparisonExpr)
+		if !ok || comparison.Operator != sqlparser.EqualStr {
+			continue
+		}
+		col, ok := comparison.Left.(*sqlparser.ColName)
+		if !ok || !col.Name.EqualString(shardkey) {
+			continue
+		}
+		if qualifier := col.Qualifier.Name.String(); qualifier != "" && qualifier != table && qualifier != alias {
+			continue
+		}
+		if val, ok := comparison.Right.(*sqlparser.SQLVal); ok && val.Type == sqlparser.ValArg {
+			return string(val.Val[1:]), true
+		}
+	}
+	return "", false
+}
+
+// Valid returns false if the table is changed since the plan is built, such as the segments are shifted,
+// then the plan should be built again.
+func (p *PreparedPlan) Valid() bool {
+	tconf, err := p.router.TableConfig(p.database, p.table)
+	return err == nil && tconf == p.tconf
+}
+
+// Bind used to route the plan to the segment of the bound shard key, the query is the one with the parameters bound.
+// The returned plan tree holds the copy of the plan with the query of the segment only.
+func (p *PreparedPlan) Bind(query string, bindVariables map[string]*querypb.BindVariable, extras map[string]sqlparser.Encodable) (*PlanTree, error) {
+	bv, ok := bindVariables[p.arg]
+	if !ok {
+		return nil, errors.Errorf("prepared.plan.missing.bind.variable[%s]", p.arg)
+	}
+	val, ok := BindVarSQLVal(bv)
+	if !ok {
+		return nil, errors.Errorf("unsupported: prepared.plan.shard.key.type[%v]", bv.Type)
+	}
+	segments, err := p.router.Lookup(p.database, p.table, val, val)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) != 1 {
+		return nil, errors.Errorf("prepared.plan.shard.key.routed.to[%d].segments", len(segments))
+	}
+	i, ok := p.index[p.database+"."+segments[0].Table]
+	if !ok {
+		return nil, errors.Errorf("prepared.plan.can.not.find.segment[%s]", segments[0].Table)
+	}
+	tuple := p.querys[i]
+	if tuple.Query, err = p.parsedQuerys[i].GenerateQuery(bindVariables, extras); err != nil {
+		return nil, err
+	}
+	querys := []xcontext.QueryTuple{tuple}
+	parsedQuerys := []*sqlparser.ParsedQuery{p.parsedQuerys[i]}
+
+	var plan Plan
+	switch orig := p.plan.(type) {
+	case *SelectPlan:
+		m := *orig.Root.(*MergeNode)
+		m.Querys, m.ParsedQuerys = querys, parsedQuerys
+		sel := *orig
+		sel.RawQuery, sel.Root = query, &m
+		plan = &sel
+	case *UpdatePlan:
+		upd := *orig
+		upd.RawQuery, upd.Querys, upd.ParsedQuerys = query, querys, parsedQuerys
+		upd.Scatter, upd.CountQuerys = false, nil
+		plan = &upd
+	case *DeletePlan:
+		del := *orig
+		del.RawQuery, del.Querys, del.ParsedQuerys = query, querys, parsedQuerys
+		del.Scatter, del.CountQuerys = false, nil
+		plan = &del
+	}
+	plans := NewPlanTree()
+	if err := plans.Add(plan); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// BindVarSQLVal returns the bind variable as the value the query parsed after it's bound has, false if it isn't
+// a plain value such as the NULL and the tuple.
+// The binary value which isn't valid UTF-8 is the hex literal, see the hexBindVariables of the proxy.
+func BindVarSQLVal(bv *querypb.BindVariable) (*sqlparser.SQLVal, bool) {
+	switch {
+	case sqltypes.IsIntegral(bv.Type):
+		return sqlparser.NewIntVal(bv.Value), true
+	case sqltypes.IsFloat(bv.Type) || bv.Type == querypb.Type_DECIMAL:
+		if bytes.ContainsAny(bv.Value, ".eE") {
+			return sqlparser.NewFloatVal(bv.Value), true
+		}
+		return sqlparser.NewIntVal(bv.Value), true
+	case sqltypes.IsBinary(bv.Type) && !utf8.Valid(bv.Value):
+		return sqlparser.NewHexVal([]byte(hex.EncodeToString(bv.Value))), true
+	case sqltypes.IsQuoted(bv.Type):
+		return sqlparser.NewStrVal(bv.Value), true
+	}
+	return nil, false
+}
@@ -0,0 +1,175 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"fmt"
+	"router"
+	"testing"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestPreparedPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.CreateDatabase(database)
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	// querysOf returns the querys and backends of the tuples.
+	querysOf := func(tuples []xcontext.QueryTuple) []string {
+		var querys []string
+		for _, tuple := range tuples {
+			querys = append(querys, tuple.Backend+":"+tuple.Query)
+		}
+		return querys
+	}
+
+	tests := []struct {
+		query string
+		bound string
+	}{
+		{"select * from A where id=?", "select * from A where id=%s"},
+		{"select a.b from sbtest.A as a where a.id=? and a.b=?", "select a.b from sbtest.A as a where a.id=%s and a.b=2"},
+		{"update A set b=? where id=?", "update A set b=2 where id=%s"},
+		{"delete from A where b=? and (id=?)", "delete from A where b=2 and (id=%s)"},
+	}
+	for _, test := range tests {
+		p, err := NewPreparedPlan(log, database, test.query, route)
+		assert.Nil(t, err, test.query)
+		assert.True(t, p.Valid())
+
+		for _, id := range []string{"1", "3", "1000"} {
+			bindVars := map[string]*querypb.BindVariable{
+				"v1": sqltypes.Int64BindVariable(2),
+				"v2": sqltypes.Int64BindVariable(2),
+			}
+			bindVars[p.arg] = &querypb.BindVariable{Type: querypb.Type_INT64, Value: []byte(id)}
+			bound := fmt.Sprintf(test.bound, id)
+			plans, err := p.Bind(bound, bindVars, nil)
+			assert.Nil(t, err)
+
+			// The bound plan is the same as the one of the bound query.
+			node, err := sqlparser.Parse(bound)
+			assert.Nil(t, err)
+			var want, got []string
+			switch node := node.(type) {
+			case *sqlparser.Select:
+				plan := NewSelectPlan(log, database, bound, node, route)
+				assert.Nil(t, plan.Build())
+				want = querysOf(plan.Root.(*MergeNode).Querys)
+				got = querysOf(plans.Plans()[0].(*SelectPlan).Root.(*MergeNode).Querys)
+			case *sqlparser.Update:
+				plan := NewUpdatePlan(log, database, bound, node, route)
+				assert.Nil(t, plan.Build())
+				want = querysOf(plan.Querys)
+				upd := plans.Plans()[0].(*UpdatePlan)
+				assert.False(t, upd.Scatter)
+				got = querysOf(upd.Querys)
+			case *sqlparser.Delete:
+				plan := NewDeletePlan(log, database, bound, node, route)
+				assert.Nil(t, plan.Build())
+				want = querysOf(plan.Querys)
+				del := plans.Plans()[0].(*DeletePlan)
+				assert.False(t, del.Scatter)
+				got = querysOf(del.Querys)
+			}
+			assert.Equal(t, want, got, bound)
+		}
+	}
+
+	// The plan is stale after the segment is shifted.
+	{
+		p, err := NewPreparedPlan(log, database, "select * from A where id=?", route)
+		assert.Nil(t, err)
+		err = route.PartitionRuleShift("backend6", "backend66", database, "A6")
+		assert.Nil(t, err)
+		assert.False(t, p.Valid())
+	}
+}
+
+func TestPreparedPlanUnsupported(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+	err = route.AddForTest(database, router.MockTableGConfig())
+	assert.Nil(t, err)
+
+	querys := []string{
+		"insert into A(id, b) values(?, ?)",
+		"select * from A where b=?",
+		"select * from A where id=1",
+		"select * from A where id=? or b=1",
+		"select * from A where id=? and id>?",
+		"select * from A where ?=id",
+		"select * from A where x.id=?",
+		"select /*+ radon_force_dml */ * from A where id=?",
+		"select * from A join G on A.b=G.b where A.id=?",
+		"select * from A where id=? and b in (select b from A)",
+		"select * from G where id=?",
+		"update A set b=1 where id=? limit 1",
+		"delete from A where id in (?, ?)",
+		"select * from B where id=?",
+	}
+	for _, query := range querys {
+		_, err := NewPreparedPlan(log, database, query, route)
+		assert.NotNil(t, err, query)
+	}
+
+	// The bind variables can't route the plan.
+	{
+		p, err := NewPreparedPlan(log, database, "select * from A where id=?", route)
+		assert.Nil(t, err)
+		_, err = p.Bind("", map[string]*querypb.BindVariable{}, nil)
+		assert.Equal(t, "prepared.plan.missing.bind.variable[v1]", err.Error())
+		_, err = p.Bind("", map[string]*querypb.BindVariable{"v1": sqltypes.NullBindVariable}, nil)
+		assert.Equal(t, "unsupported: prepared.plan.shard.key.type[NULL_TYPE]", err.Error())
+	}
+}
+
+func TestBindVarSQLVal(t *testing.T) {
+	tests := []struct {
+		bv  *querypb.BindVariable
+		typ sqlparser.ValType
+		val string
+	}{
+		{sqltypes.Int64BindVariable(-1), sqlparser.IntVal, "-1"},
+		{sqltypes.Uint64BindVariable(1), sqlparser.IntVal, "1"},
+		{sqltypes.Float64BindVariable(1.5), sqlparser.FloatVal, "1.5"},
+		{&querypb.BindVariable{Type: querypb.Type_DECIMAL, Value: []byte("10")}, sqlparser.IntVal, "10"},
+		{sqltypes.StringBindVariable("abc"), sqlparser.StrVal, "abc"},
+		{sqltypes.BytesBindVariable([]byte("abc")), sqlparser.StrVal, "abc"},
+		{sqltypes.BytesBindVariable([]byte("\x9f\x1e")), sqlparser.HexVal, "9f1e"},
+		{&querypb.BindVariable{Type: querypb.Type_DATETIME, Value: []byte("2020-01-01 00:00:00")}, sqlparser.StrVal, "2020-01-01 00:00:00"},
+	}
+	for _, test := range tests {
+		val, ok := BindVarSQLVal(test.bv)
+		assert.True(t, ok)
+		assert.Equal(t, test.typ, val.Type)
+		assert.Equal(t, test.val, string(val.Val))
+	}
+	_, ok := BindVarSQLVal(sqltypes.NullBindVariable)
+	assert.False(t, ok)
+	_, ok = BindVarSQLVal(&querypb.BindVariable{Type: querypb.Type_TUPLE})
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"sort"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// ScatterFilter is the columns of the table which a scatter select filters on,
+// the select is sent to all the segments since none of the columns is the shard key.
+type ScatterFilter struct {
+	Database string
+	Table    string
+	ShardKey string
+	// Equals are the columns compared with the constants by '=' or IN.
+	Equals []string
+	// Ranges are the columns compared with the constant bounds, such as BETWEEN, >= or <.
+	Ranges []string
+}
+
+// ScatterFilters returns the filters of the MergeNodes which are sent to more than one segment,
+// the tables filtered on the shard key are skipped. It's used by the index advisor.
+func ScatterFilters(plan Plan) []ScatterFilter {
+	var filters []ScatterFilter
+	switch plan := plan.(type) {
+	case *SelectPlan:
+		filters = scatterFilters(plan.Root, filters)
+	case *UnionPlan:
+		filters = scatterFilters(plan.Root, filters)
+	}
+	return filters
+}
+
+func scatterFilters(node PlanNode, filters []ScatterFilter) []ScatterFilter {
+	switch node := node.(type) {
+	case *MergeNode:
+		return append(filters, node.scatterFilters()...)
+	case *JoinNode:
+		filters = scatterFilters(node.Left, filters)
+		return scatterFilters(node.Right, filters)
+	case *UnionNode:
+		filters = scatterFilters(node.Left, filters)
+		return scatterFilters(node.Right, filters)
+	}
+	return filters
+}
+
+// scatterFilters returns the non-shard-key columns filtered on in the where clause.
+func (m *MergeNode) scatterFilters() []ScatterFilter {
+	sel, ok := m.Sel.(*sqlparser.Select)
+	if !ok || sel.Where == nil || len(m.Querys) < 2 {
+		return nil
+	}
+	_, wheres, err := parserWhereOrJoinExprs(sel.Where.Expr, m.referredTables)
+	if err != nil {
+		return nil
+	}
+
+	byTable := make(map[string]*ScatterFilter)
+	sharded := make(map[string]bool)
+	for _, where := range wheres {
+		if where.col == nil || len(where.referTables) != 1 {
+			continue
+		}
+		alias := where.referTables[0]
+		tbInfo := m.referredTables[alias]
+		if tbInfo.shardKey == "" {
+			continue
+		}
+		if nameMatch(where.col, alias, tbInfo.shardKey) {
+			sharded[alias] = true
+			continue
+		}
+		filter, ok := byTable[alias]
+		if !ok {
+			filter = &ScatterFilter{Database: tbInfo.database, Table: tbInfo.tableName, ShardKey: tbInfo.shardKey}
+			byTable[alias] = filter
+		}
+		col := where.col.Name.String()
+		switch {
+		case len(where.vals) > 0:
+			filter.Equals = appendColumn(filter.Equals, col)
+		case where.start != nil || where.end != nil:
+			filter.Ranges = appendColumn(filter.Ranges, col)
+		}
+	}
+
+	aliases := make([]string, 0, len(byTable))
+	for alias := range byTable {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	var filters []ScatterFilter
+	for _, alias := range aliases {
+		filter := byTable[alias]
+		if sharded[alias] || (len(filter.Equals) == 0 && len(filter.Ranges) == 0) {
+			continue
+		}
+		sort.Strings(filter.Equals)
+		sort.Strings(filter.Ranges)
+		filters = append(filters, *filter)
+	}
+	return filters
+}
+
+func appendColumn(cols []string, col string) []string {
+	for _, c := range cols {
+		if c == col {
+			return cols
+		}
+	}
+	return append(cols, col)
+}
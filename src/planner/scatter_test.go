@@ -0,0 +1,71 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"fmt"
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestScatterFilters(t *testing.T) {
+	querys := []string{
+		"select * from A where a=1 and b in (1,2) and c>3 and c<10 and d like 'x%'",
+		"select * from A where a=1 and id=2",
+		"select * from A where id>1 and b=1",
+		"select A.a, B.c from A join B on A.id=B.id where A.a=1 and B.c between 1 and 3",
+		"select * from A join G on A.a=G.a where G.b=1 and A.b=2",
+		"select * from A where a=b",
+		"select * from A",
+		"select * from A where a=1 union select * from B where b=2",
+	}
+	results := []string{
+		"[{sbtest A id [a b] [c]}]",
+		"[]",
+		"[]",
+		"[{sbtest A id [a] []} {sbtest B id [] [c]}]",
+		"[{sbtest A id [b] []}]",
+		"[]",
+		"[]",
+		"[{sbtest A id [a] []} {sbtest B id [b] []}]",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		var plan Plan
+		switch node := node.(type) {
+		case *sqlparser.Select:
+			plan = NewSelectPlan(log, database, query, node, route)
+		case *sqlparser.Union:
+			plan = NewUnionPlan(log, database, query, node, route)
+		}
+		err = plan.Build()
+		assert.Nil(t, err, query)
+
+		filters := ScatterFilters(plan)
+		if filters == nil {
+			filters = []ScatterFilter{}
+		}
+		got := fmt.Sprintf("%v", filters)
+		assert.Equal(t, results[i], got, query)
+	}
+}
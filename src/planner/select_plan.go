@@ -45,6 +45,9 @@ type SelectPlan struct {
 	// type
 	typ PlanType
 
+	// radon hints
+	hints *Hints
+
 	Root SelectNode
 }
 
@@ -62,17 +65,21 @@ func NewSelectPlan(log *xlog.Log, database string, query string, node *sqlparser
 
 // analyze used to check the 'select' is at the support level, and get the db, table, etc..
 // Unsupports:
-// 1. subquery.
+// 1. subquery can't be pushed down.
 func (p *SelectPlan) analyze() error {
 	var err error
 	log := p.log
 	node := p.node
 
-	// Check subquery.
+	// Check subquery, the ones in the WHERE are pushed down after the route is calculated.
+	subFilters := subqueryFilters(node)
 	if hasSubquery(node) {
 		return errors.New("unsupported: subqueries.in.select")
 	}
 
+	// The radon hints shouldn't be sent to the backends.
+	p.hints, node.Comments = ParseHints(node.Comments)
+
 	if p.Root, err = scanTableExprs(log, p.router, p.database, node.From); err != nil {
 		return err
 	}
@@ -91,6 +98,11 @@ func (p *SelectPlan) analyze() error {
 	if p.Root, err = p.Root.calcRoute(); err != nil {
 		return err
 	}
+	if len(subFilters) > 0 {
+		if err = pushSubqueryFilters(log, p.router, p.database, p.Root, subFilters); err != nil {
+			return err
+		}
+	}
 
 	mn, ok := p.Root.(*MergeNode)
 	if ok && mn.routeLen == 1 {
@@ -111,6 +123,9 @@ func (p *SelectPlan) analyze() error {
 	if err != nil {
 		return err
 	}
+	if aggTyp == canPush && p.hints.NoPushdownAggregate {
+		aggTyp = notPush
+	}
 
 	if groups, err = checkGroupBy(node.GroupBy, fields, p.router, tbInfos, ok); err != nil {
 		return err
@@ -142,6 +157,9 @@ func (p *SelectPlan) analyze() error {
 		if err = p.Root.pushLimit(node); err != nil {
 			return err
 		}
+		if m, ok := p.Root.(*MergeNode); ok && p.hints.NoPushdownLimit {
+			m.Sel.SetLimit(nil)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,263 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// Subquery is the uncorrelated IN or EXISTS subquery in the WHERE clause of the select, it's executed before
+// the select is planned and replaced by its result, so the select is routed by the values as the constant IN list.
+type Subquery struct {
+	Select sqlparser.SelectStatement
+	// Exists is true if it's the EXISTS subquery, else it's the right of the IN or NOT IN.
+	Exists bool
+	cmp    *sqlparser.ComparisonExpr
+	// replace used to replace the IN or EXISTS expression in the WHERE clause.
+	replace func(sqlparser.Expr)
+}
+
+// Subqueries returns the uncorrelated IN and EXISTS subqueries in the WHERE clause of the select, including the
+// ones under NOT, AND and OR. The others such as the correlated ones are left to the planner.
+func Subqueries(node *sqlparser.Select) []*Subquery {
+	if node.Where == nil {
+		return nil
+	}
+	var subs []*Subquery
+	var collect func(expr sqlparser.Expr, replace func(sqlparser.Expr))
+	collect = func(expr sqlparser.Expr, replace func(sqlparser.Expr)) {
+		switch expr := expr.(type) {
+		case *sqlparser.AndExpr:
+			collect(expr.Left, func(x sqlparser.Expr) { expr.Left = x })
+			collect(expr.Right, func(x sqlparser.Expr) { expr.Right = x })
+		case *sqlparser.OrExpr:
+			collect(expr.Left, func(x sqlparser.Expr) { expr.Left = x })
+			collect(expr.Right, func(x sqlparser.Expr) { expr.Right = x })
+		case *sqlparser.NotExpr:
+			collect(expr.Expr, func(x sqlparser.Expr) { expr.Expr = x })
+		case *sqlparser.ParenExpr:
+			collect(expr.Expr, func(x sqlparser.Expr) { expr.Expr = x })
+		case *sqlparser.ExistsExpr:
+			if !isCorrelated(expr.Subquery.Select) {
+				subs = append(subs, &Subquery{Select: expr.Subquery.Select, Exists: true, replace: replace})
+			}
+		case *sqlparser.ComparisonExpr:
+			if expr.Operator != sqlparser.InStr && expr.Operator != sqlparser.NotInStr {
+				return
+			}
+			sub, ok := expr.Right.(*sqlparser.Subquery)
+			if !ok || hasSubquery(expr.Left) || isCorrelated(sub.Select) {
+				return
+			}
+			subs = append(subs, &Subquery{Select: sub.Select, cmp: expr, replace: replace})
+		}
+	}
+	collect(node.Where.Expr, func(x sqlparser.Expr) { node.Where.Expr = x })
+	return subs
+}
+
+// isCorrelated returns true if the subquery refers to the tables out of it by the qualified columns,
+// the unqualified columns are taken as the columns of its own tables.
+func isCorrelated(sel sqlparser.SelectStatement) bool {
+	tables := make(map[string]bool)
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if expr, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			if !expr.As.IsEmpty() {
+				tables[expr.As.String()] = true
+			} else if name, ok := expr.Expr.(sqlparser.TableName); ok {
+				tables[name.Name.String()] = true
+			}
+		}
+		return true, nil
+	}, sel)
+
+	correlated := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok {
+			if name := col.Qualifier.Name.String(); name != "" && !tables[name] {
+				correlated = true
+				return false, nil
+			}
+		}
+		return true, nil
+	}, sel)
+	return correlated
+}
+
+// Query returns the query of the subquery, the EXISTS subquery reads one row at most.
+func (s *Subquery) Query() string {
+	if sel, ok := s.Select.(*sqlparser.Select); ok && s.Exists && sel.Limit == nil {
+		sel.SetLimit(&sqlparser.Limit{Rowcount: sqlparser.NewIntVal([]byte("1"))})
+	}
+	return sqlparser.String(s.Select)
+}
+
+// Bind used to replace the subquery by its result. The EXISTS is replaced by true or false, the IN subquery by
+// the distinct values of the result, or by false(true for NOT IN) if the result is empty.
+func (s *Subquery) Bind(qr *sqltypes.Result) error {
+	if s.Exists {
+		s.replace(sqlparser.BoolVal(len(qr.Rows) > 0))
+		return nil
+	}
+	if len(qr.Fields) > 1 {
+		return errors.Errorf("subquery.should.contain.1.column.but[%d]", len(qr.Fields))
+	}
+
+	seen := make(map[string]bool)
+	tuple := make(sqlparser.ValTuple, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		var val sqlparser.Expr = &sqlparser.NullVal{}
+		if !row[0].IsNull() {
+			v, ok := BindVarSQLVal(sqltypes.ValueBindVariable(row[0]))
+			if !ok {
+				return errors.Errorf("unsupported: subquery.value.type[%v]", row[0].Type())
+			}
+			val = v
+		}
+		key := sqlparser.String(val)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		tuple = append(tuple, val)
+	}
+	if len(tuple) == 0 {
+		s.replace(sqlparser.BoolVal(s.cmp.Operator == sqlparser.NotInStr))
+		return nil
+	}
+	s.cmp.Right = tuple
+	return nil
+}
+
+// subqueryFilters used to take the conditions with the subqueries out of the top level AND of the WHERE,
+// they're pushed down with the select after its route is calculated.
+func subqueryFilters(node *sqlparser.Select) []sqlparser.Expr {
+	if node.Where == nil || !hasSubquery(node.Where) {
+		return nil
+	}
+	var filters, others []sqlparser.Expr
+	for _, expr := range splitAndExpression(nil, node.Where.Expr) {
+		if hasSubquery(expr) {
+			filters = append(filters, expr)
+			continue
+		}
+		others = append(others, expr)
+	}
+	node.Where = nil
+	for _, expr := range others {
+		node.AddWhere(expr)
+	}
+	return filters
+}
+
+// pushSubqueryFilters used to push the conditions with the subqueries down to the segments of the select.
+// The subquery can be pushed down if its tables are all global, or it's correlated to the select on the shard key,
+// such as 'a = (select max(a) from t2 where t2.id = t1.id)' with t1 and t2 sharded by the id in the same way,
+// so the rows it reads are in the same segment as the row of the select. The tables of the subquery are kept
+// by the MergeNode to be rewritten to the segments together.
+func pushSubqueryFilters(log *xlog.Log, router *router.Router, database string, root SelectNode, filters []sqlparser.Expr) error {
+	mn, ok := root.(*MergeNode)
+	if !ok {
+		return errors.New("unsupported: subqueries.in.select")
+	}
+	for _, filter := range filters {
+		var subs []*sqlparser.Select
+		if err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+			sub, ok := node.(*sqlparser.Subquery)
+			if !ok {
+				return true, nil
+			}
+			sel, ok := sub.Select.(*sqlparser.Select)
+			if !ok || hasSubquery(sel) {
+				return false, errors.New("unsupported: subqueries.in.select")
+			}
+			subs = append(subs, sel)
+			return false, nil
+		}, filter); err != nil {
+			return err
+		}
+
+		for _, sel := range subs {
+			node, err := scanTableExprs(log, router, database, sel.From)
+			if err != nil {
+				return err
+			}
+			inner, ok := node.(*MergeNode)
+			if !ok || (inner.nonGlobalCnt > 0 && !correlatedOnShardKey(sel, inner.referredTables, mn.referredTables)) {
+				return errors.New("unsupported: subqueries.in.select")
+			}
+			for _, tbInfo := range inner.referredTables {
+				if tbInfo.shardType != "GLOBAL" {
+					if tbInfo.Segments, err = router.GetSegments(tbInfo.database, tbInfo.tableName, mn.index); err != nil {
+						return err
+					}
+				}
+				tbInfo.parent = mn
+				mn.subTables = append(mn.subTables, tbInfo)
+			}
+		}
+		mn.addWhere(filter)
+	}
+	return nil
+}
+
+// correlatedOnShardKey returns true if the subquery has the equal condition on the shard keys of its table and
+// the outer table which have the same shards.
+func correlatedOnShardKey(sel *sqlparser.Select, inner, outer map[string]*TableInfo) bool {
+	if sel.Where == nil {
+		return false
+	}
+	// qualify returns the column qualified by its table of the subquery, the unqualified one belongs to
+	// the only table of the subquery.
+	qualify := func(col *sqlparser.ColName) (*sqlparser.ColName, bool) {
+		name := col.Qualifier.Name.String()
+		if name != "" {
+			_, ok := inner[name]
+			return col, ok
+		}
+		if len(inner) != 1 {
+			return nil, false
+		}
+		for name := range inner {
+			c := *col
+			c.Qualifier = sqlparser.TableName{Name: sqlparser.NewTableIdent(name)}
+			return &c, true
+		}
+		return nil, false
+	}
+	for _, expr := range splitAndExpression(nil, sel.Where.Expr) {
+		cmp, ok := expr.(*sqlparser.ComparisonExpr)
+		if !ok || cmp.Operator != sqlparser.EqualStr {
+			continue
+		}
+		left, lok := cmp.Left.(*sqlparser.ColName)
+		right, rok := cmp.Right.(*sqlparser.ColName)
+		if !lok || !rok {
+			continue
+		}
+		for _, pair := range [][2]*sqlparser.ColName{{left, right}, {right, left}} {
+			col, ok := qualify(pair[0])
+			if !ok {
+				continue
+			}
+			if _, ok := outer[pair[1].Qualifier.Name.String()]; !ok {
+				continue
+			}
+			if isSameShard(inner, outer, col, pair[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"router"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestSubqueries(t *testing.T) {
+	// resultOf returns the result of the column with the values, "null" is the NULL.
+	resultOf := func(vals ...string) *sqltypes.Result {
+		qr := &sqltypes.Result{Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}}}
+		for _, val := range vals {
+			v := sqltypes.MakeTrusted(querypb.Type_INT32, []byte(val))
+			if val == "null" {
+				v = sqltypes.NULL
+			}
+			qr.Rows = append(qr.Rows, []sqltypes.Value{v})
+		}
+		return qr
+	}
+
+	tests := []struct {
+		query   string
+		subs    []string
+		results []*sqltypes.Result
+		bound   string
+	}{
+		{
+			"select * from A where id in (select id from B where b=1)",
+			[]string{"select id from B where b = 1"},
+			[]*sqltypes.Result{resultOf("1", "3", "1")},
+			"select * from A where id in (1, 3)",
+		},
+		{
+			"select * from A where id not in (select id from B) and a=1",
+			[]string{"select id from B"},
+			[]*sqltypes.Result{resultOf("2", "null")},
+			"select * from A where id not in (2, null) and a = 1",
+		},
+		{
+			"select * from A where id in (select id from B) or a=1",
+			[]string{"select id from B"},
+			[]*sqltypes.Result{resultOf()},
+			"select * from A where false or a = 1",
+		},
+		{
+			"select * from A where not (id not in (select id from B))",
+			[]string{"select id from B"},
+			[]*sqltypes.Result{resultOf()},
+			"select * from A where not (true)",
+		},
+		{
+			"select * from A where exists (select 1 from B where B.b=2) and not exists (select 1 from G limit 3)",
+			[]string{"select 1 from B where B.b = 2 limit 1", "select 1 from G limit 3"},
+			[]*sqltypes.Result{resultOf("1"), resultOf()},
+			"select * from A where true and not false",
+		},
+		// The correlated is left to the planner.
+		{
+			"select * from A where exists (select 1 from B where B.id=A.id) and id in (select b.id from B as b)",
+			[]string{"select b.id from B as b"},
+			[]*sqltypes.Result{resultOf("5")},
+			"select * from A where exists (select 1 from B where B.id = A.id) and id in (5)",
+		},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err)
+		sel := node.(*sqlparser.Select)
+		subs := Subqueries(sel)
+		var got []string
+		for _, sub := range subs {
+			got = append(got, sub.Query())
+		}
+		assert.Equal(t, test.subs, got, test.query)
+		for i, sub := range subs {
+			assert.Nil(t, sub.Bind(test.results[i]))
+		}
+		assert.Equal(t, test.bound, sqlparser.String(sel), test.query)
+	}
+
+	// The subquery returns more than one column.
+	{
+		node, err := sqlparser.Parse("select * from A where id in (select id, b from B)")
+		assert.Nil(t, err)
+		subs := Subqueries(node.(*sqlparser.Select))
+		assert.Equal(t, 1, len(subs))
+		qr := resultOf("1")
+		qr.Fields = append(qr.Fields, &querypb.Field{Name: "b"})
+		err = subs[0].Bind(qr)
+		assert.Equal(t, "subquery.should.contain.1.column.but[2]", err.Error())
+	}
+}
+
+func TestSubqueriesPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	// The bound select is routed as the one with the constant values.
+	node, err := sqlparser.Parse("select * from A where id in (select id from B)")
+	assert.Nil(t, err)
+	sel := node.(*sqlparser.Select)
+	qr := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1000"))},
+		},
+	}
+	for _, sub := range Subqueries(sel) {
+		assert.Nil(t, sub.Bind(qr))
+	}
+	plan := NewSelectPlan(log, database, sqlparser.String(sel), sel, route)
+	assert.Nil(t, plan.Build())
+
+	query := "select * from A where id in (1, 1000)"
+	node, err = sqlparser.Parse(query)
+	assert.Nil(t, err)
+	want := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	assert.Nil(t, want.Build())
+	assert.Equal(t, want.Root.(*MergeNode).Querys, plan.Root.(*MergeNode).Querys)
+	assert.True(t, len(plan.Root.(*MergeNode).Querys) < 6)
+}
+
+func TestCorrelatedSubqueryPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+
+	// The subqueries are pushed down to the segments with the select.
+	{
+		tests := []struct {
+			query string
+			want  string
+			n     int
+		}{
+			{
+				"select * from A where a = (select max(a) from A as T where T.id = A.id)",
+				"select * from sbtest.A1 as A where a = (select max(a) from sbtest.A1 as T where T.id = A.id)",
+				6,
+			},
+			{
+				"select * from A where id = 1 and exists (select 1 from A as T where A.id = T.id and T.b > 1)",
+				"select * from sbtest.A6 as A where id = 1 and exists (select 1 from sbtest.A6 as T where A.id = T.id and T.b > 1)",
+				1,
+			},
+			{
+				"select a from A where a > 1 and b in (select b from G where G.a = A.a) order by a",
+				"select a from sbtest.A1 as A where a > 1 and b in (select b from sbtest.G where G.a = A.a) order by a asc",
+				6,
+			},
+			{
+				"select count(*) from A as A1 where not exists (select 1 from A as A2 where id = A1.id and A2.a > A1.a)",
+				"select count(*) from sbtest.A1 as A1 where not exists (select 1 from sbtest.A1 as A2 where id = A1.id and A2.a > A1.a)",
+				6,
+			},
+			{
+				"select * from A where a = 1 or exists (select 1 from A as T where T.id = A.id)",
+				"select * from sbtest.A1 as A where (a = 1 or exists (select 1 from sbtest.A1 as T where T.id = A.id))",
+				6,
+			},
+		}
+		for _, test := range tests {
+			node, err := sqlparser.Parse(test.query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, test.query, node.(*sqlparser.Select), route)
+			assert.Nil(t, plan.Build(), test.query)
+			querys := plan.Root.GetQuery()
+			assert.Equal(t, test.n, len(querys), test.query)
+			assert.Equal(t, test.want, querys[0].Query)
+		}
+	}
+
+	// The subqueries can't be pushed down.
+	{
+		querys := []string{
+			"select * from A where a = (select max(a) from A as T where T.b = A.b)",
+			"select * from A where exists (select 1 from B where B.id = A.id)",
+			"select * from A where id in (select id from B)",
+			"select A.id from A join B on A.a = B.a where exists (select 1 from G where G.a = A.a)",
+			"select * from A where exists (select 1 from G where G.a in (select a from B))",
+			"select * from A where exists (select 1 from A as T, B where T.id = A.id)",
+		}
+		for _, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, "unsupported: subqueries.in.select", err.Error(), query)
+			}
+		}
+	}
+}
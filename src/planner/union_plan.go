@@ -218,6 +218,10 @@ func union(log *xlog.Log, router *router.Router, database string, left, right Pl
 			v.parent = lm
 			lm.referredTables[k] = v
 		}
+		for _, v := range rm.subTables {
+			v.parent = lm
+			lm.subTables = append(lm.subTables, v)
+		}
 		return lm, nil
 	}
 end:
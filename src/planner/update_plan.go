@@ -48,6 +48,18 @@ type UpdatePlan struct {
 
 	// query and backend tuple
 	Querys []xcontext.QueryTuple
+
+	// querys with bind locations.
+	ParsedQuerys []*sqlparser.ParsedQuery
+
+	// Scatter is true if the DML isn't routed by the shard key, it's executed on all the segments.
+	Scatter bool
+
+	// CountQuerys count the rows matched by the scatter DML, one per segment.
+	CountQuerys []xcontext.QueryTuple
+
+	// radon hints
+	hints *Hints
 }
 
 // NewUpdatePlan used to create UpdatePlan
@@ -78,11 +90,17 @@ func (p *UpdatePlan) analyze() error {
 
 // Build used to build distributed querys.
 func (p *UpdatePlan) Build() error {
+	if IsMultiTableDML(p.RawQuery) {
+		return p.buildMultiTable()
+	}
 	if err := p.analyze(); err != nil {
 		return err
 	}
 
 	node := p.node
+	// The radon hints shouldn't be sent to the backends.
+	p.hints, node.Comments = ParseHints(node.Comments)
+
 	// Database.
 	database := p.database
 	if !node.Table.Qualifier.IsEmpty() {
@@ -106,21 +124,53 @@ func (p *UpdatePlan) Build() error {
 	if err != nil {
 		return err
 	}
+	p.Scatter = shardkey != "" && len(segments) > 1
+	// The LIMIT is per backend, it can't limit the rows across the segments.
+	if p.Scatter && node.Limit != nil {
+		return errors.New("unsupported: limit.in.update.across.segments")
+	}
 
 	// Rewrite the query.
 	for _, segment := range segments {
 		buf := sqlparser.NewTrackedBuffer(nil)
 		buf.Myprintf("update %v%s.%s set %v%v%v%v", node.Comments, database, segment.Table, node.Exprs, node.Where, node.OrderBy, node.Limit)
+		pq := buf.ParsedQuery()
+		p.ParsedQuerys = append(p.ParsedQuerys, pq)
 		tuple := xcontext.QueryTuple{
-			Query:   buf.String(),
+			Query:   pq.Query,
 			Backend: segment.Backend,
 			Range:   segment.Range.String(),
+			Table:   database + "." + segment.Table,
 		}
 		p.Querys = append(p.Querys, tuple)
+		if p.Scatter {
+			tuple.Query = countDMLRows(database, segment.Table, node.Where)
+			p.CountQuerys = append(p.CountQuerys, tuple)
+		}
+	}
+	return nil
+}
+
+// buildMultiTable used to build the querys of the multi-table update on the co-located tables.
+func (p *UpdatePlan) buildMultiTable() error {
+	dml, err := ParseMultiTableDML(p.RawQuery)
+	if err != nil {
+		return err
 	}
+	// The radon hints shouldn't be sent to the backends.
+	p.hints, dml.Comments = ParseHints(dml.Comments)
+	if p.Querys, p.CountQuerys, err = buildMultiTableDML(p.log, p.router, p.database, dml); err != nil {
+		return err
+	}
+	p.Scatter = len(p.CountQuerys) > 0
 	return nil
 }
 
+// Force returns true if the DML carries the radon_force_dml hint.
+func (p *UpdatePlan) Force() bool {
+	return p.hints != nil && p.hints.ForceDML
+}
+
 // Type returns the type of the plan.
 func (p *UpdatePlan) Type() PlanType {
 	return p.typ
@@ -73,11 +73,22 @@ func TestUpdatePlan(t *testing.T) {
 			"Range": "[512-4096)"
 		}
 	]
+}`,
+		`{
+	"RawQuery": "update sbtest.A set val = 1 where id = 1 order by b desc limit 1",
+	"Partitions": [
+		{
+			"Query": "update sbtest.A6 set val = 1 where id = 1 order by b desc limit 1",
+			"Backend": "backend6",
+			"Range": "[512-4096)"
+		}
+	]
 }`}
 	querys := []string{
 		"update sbtest.A set val = 1 where id = 1",
 		"update sbtest.A set val = 1 where id = id2 and id = 1",
 		"update sbtest.A set val = 1 where id in (1, 2)",
+		"update sbtest.A set val = 1 where id = 1 order by b desc limit 1",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -115,12 +126,14 @@ func TestUpdateUnsupportedPlan(t *testing.T) {
 		"update sbtest.A set a=3",
 		"update sbtest.A set id=3 where id=1",
 		"update sbtest.A set b=3 where id in (select id from t1)",
+		"update sbtest.A set b=3 where id in (1, 2) order by b limit 1",
 	}
 
 	results := []string{
 		"unsupported: missing.where.clause.in.DML",
 		"unsupported: cannot.update.shard.key",
 		"unsupported: subqueries.in.update",
+		"unsupported: limit.in.update.across.segments",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
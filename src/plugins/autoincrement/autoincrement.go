@@ -58,8 +58,11 @@ func (autoinc *AutoIncrement) Process(database string, ins *sqlparser.Insert) er
 		return err
 	}
 
-	// Get seq(thread-safe).
+	// Get seq(thread-safe), the values are after the seq so it's moved to the one before the start of the table if it's behind.
 	autoinc.mu.Lock()
+	if tblInfo.AutoIncrement != nil && autoinc.seq+1 < tblInfo.AutoIncrement.Start {
+		autoinc.seq = tblInfo.AutoIncrement.Start - 1
+	}
 	seq = autoinc.seq
 	switch rows := ins.Rows.(type) {
 	case sqlparser.Values:
@@ -73,6 +76,15 @@ func (autoinc *AutoIncrement) Process(database string, ins *sqlparser.Insert) er
 	return nil
 }
 
+// Next -- returns the next seq, it's unique with the auto-increment values.
+func (autoinc *AutoIncrement) Next() uint64 {
+	autoinc.mu.Lock()
+	defer autoinc.mu.Unlock()
+	seq := autoinc.seq
+	autoinc.seq++
+	return seq
+}
+
 // Close -- close the plugin.
 func (autoinc *AutoIncrement) Close() error {
 	return nil
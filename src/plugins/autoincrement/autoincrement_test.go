@@ -9,6 +9,7 @@
 package autoincrement
 
 import (
+	"fmt"
 	"testing"
 
 	"config"
@@ -178,3 +179,69 @@ func TestPluginAutoIncrement(t *testing.T) {
 		log.Debug("%v", buf.String())
 	}
 }
+
+func TestPluginAutoIncrementNext(t *testing.T) {
+	db := "db1"
+	log := xlog.NewStdLog(xlog.Level(xlog.ERROR))
+
+	// Router.
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// Plugin.
+	autoplug := NewAutoIncrement(log, route)
+	err := autoplug.Init()
+	assert.Nil(t, err)
+	defer autoplug.Close()
+
+	route.AddForTest(db, &config.TableConfig{Name: "t1", ShardType: "GLOBAL", AutoIncrement: &config.AutoIncrement{Column: "a"}})
+	seq := autoplug.Next()
+	assert.Equal(t, seq+1, autoplug.Next())
+
+	// The values of the insert follow the seq.
+	node, err := sqlparser.Parse("insert into t1(b) values(1),(2)")
+	assert.Nil(t, err)
+	err = autoplug.Process(db, node.(*sqlparser.Insert))
+	assert.Nil(t, err)
+	assert.Equal(t, seq+4, autoplug.Next())
+}
+
+func TestPluginAutoIncrementStart(t *testing.T) {
+	db := "db1"
+	log := xlog.NewStdLog(xlog.Level(xlog.ERROR))
+
+	// Router.
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// Plugin.
+	autoplug := NewAutoIncrement(log, route)
+	err := autoplug.Init()
+	assert.Nil(t, err)
+	defer autoplug.Close()
+
+	seq := autoplug.Next()
+	route.AddForTest(db, &config.TableConfig{Name: "t1", ShardType: "GLOBAL", AutoIncrement: &config.AutoIncrement{Column: "a", Start: 1}})
+	route.AddForTest(db, &config.TableConfig{Name: "t2", ShardType: "GLOBAL", AutoIncrement: &config.AutoIncrement{Column: "a", Start: seq + 100}})
+
+	// The start behind the seq is ignored.
+	{
+		node, err := sqlparser.Parse("insert into t1(b) values(1)")
+		assert.Nil(t, err)
+		insert := node.(*sqlparser.Insert)
+		err = autoplug.Process(db, insert)
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("insert into t1(b, a) values (1, %d)", seq+2), sqlparser.String(insert))
+	}
+
+	// The values start from the start.
+	{
+		node, err := sqlparser.Parse("insert into t2(b) values(1),(2)")
+		assert.Nil(t, err)
+		insert := node.(*sqlparser.Insert)
+		err = autoplug.Process(db, insert)
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("insert into t2(b, a) values (1, %d), (2, %d)", seq+100, seq+101), sqlparser.String(insert))
+		assert.Equal(t, seq+101, autoplug.Next())
+	}
+}
@@ -25,6 +25,7 @@ var (
 type AutoIncrementHandler interface {
 	Init() error
 	Process(database string, ins *sqlparser.Insert) error
+	Next() uint64
 	Close() error
 }
 
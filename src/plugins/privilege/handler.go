@@ -20,5 +20,6 @@ type PrivilegeHandler interface {
 	IsSuperPriv(user string) bool
 	GetUserPrivilegeDBS(user string) (dbs map[string]struct{})
 	CheckDBinUserPrivilege(user string, db string) bool
+	UpdatePrivileges() error
 	Close() error
 }
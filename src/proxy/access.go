@@ -0,0 +1,74 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"time"
+
+	"audit"
+	"backend"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// accessLog used to write the access record of the query with the backend querys in stats, if the access log is enabled.
+// The tables must be resolved before the planner, which rewrites the table names of the node to the backend ones.
+func (spanner *Spanner) accessLog(session *driver.Session, database string, query string, tables []string, stats []backend.ExecStat, start time.Time, err error) {
+	access := spanner.access
+	if access == nil {
+		return
+	}
+
+	record := &audit.AccessRecord{
+		Start:    start.UTC(),
+		Cost:     time.Since(start),
+		User:     session.User(),
+		UserHost: session.Addr(),
+		ThreadID: session.ID(),
+		Database: database,
+		Tables:   tables,
+		Query:    query,
+		Backends: make([]audit.AccessBackend, 0, len(stats)),
+	}
+	for _, stat := range stats {
+		record.Backends = append(record.Backends, audit.AccessBackend{Backend: stat.Backend, Query: stat.Query, Cost: stat.Cost})
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	access.LogRecord(record)
+}
+
+// accessTables returns the logical tables referenced by the node in the 'db.table' form, without duplicates.
+func accessTables(database string, node sqlparser.Statement) []string {
+	tables := []string{}
+	seen := make(map[string]bool)
+	sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		switch node := node.(type) {
+		case *sqlparser.StarExpr, *sqlparser.ColName:
+			return false, nil
+		case sqlparser.TableName:
+			if node.Name.IsEmpty() || node.Name.String() == "dual" {
+				return false, nil
+			}
+			db := database
+			if !node.Qualifier.IsEmpty() {
+				db = node.Qualifier.String()
+			}
+			table := db + "." + node.Name.String()
+			if !seen[table] {
+				seen[table] = true
+				tables = append(tables, table)
+			}
+		}
+		return true, nil
+	}, node)
+	return tables
+}
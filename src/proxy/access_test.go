@@ -0,0 +1,117 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"audit"
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyAccessLog(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_access_", log)
+	conf := MockDefaultConfig()
+	conf.Access = config.DefaultAccessConfig()
+	conf.Access.LogDir = tmpDir
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"select * from test.t1 where id=1",
+		"select * from test.t1 a join test.t1 b on a.id=b.id where a.id=1",
+		"flush access logs",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	logs, err := filepath.Glob(filepath.Join(tmpDir, "access-*.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(logs))
+	data, err := ioutil.ReadFile(logs[0])
+	assert.Nil(t, err)
+
+	records := make(map[string]*audit.AccessRecord)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		record := &audit.AccessRecord{}
+		err := json.Unmarshal([]byte(line), record)
+		assert.Nil(t, err)
+		records[record.Query] = record
+	}
+
+	// The point select is served by one backend.
+	{
+		record := records[querys[2]]
+		assert.NotNil(t, record)
+		assert.Equal(t, "mock", record.User)
+		assert.Equal(t, []string{"test.t1"}, record.Tables)
+		assert.Equal(t, 1, len(record.Backends))
+		assert.Equal(t, "select * from test.t1_0017 as t1 where id = 1", record.Backends[0].Query)
+		assert.Equal(t, "", record.Error)
+	}
+
+	// The tables are logged without duplicates.
+	{
+		record := records[querys[3]]
+		assert.NotNil(t, record)
+		assert.Equal(t, []string{"test.t1"}, record.Tables)
+		assert.Equal(t, 1, len(record.Backends))
+	}
+
+	// Disabled.
+	{
+		proxy.spanner.access = nil
+		_, err = client.FetchAll("flush access logs", -1)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestProxyAccessTables(t *testing.T) {
+	querys := []struct {
+		query  string
+		tables []string
+	}{
+		{"select * from t1", []string{"db1.t1"}},
+		{"select * from t1 join db2.t2 on t1.a=t2.a where t1.b in (select b from t3)", []string{"db1.t1", "db2.t2", "db1.t3"}},
+		{"insert into t1 values(1)", []string{"db1.t1"}},
+		{"delete from t1 where id=1", []string{"db1.t1"}},
+		{"select 1", []string{}},
+	}
+	for _, q := range querys {
+		node, err := sqlparser.Parse(q.query)
+		assert.Nil(t, err)
+		assert.Equal(t, q.tables, accessTables("db1", node))
+	}
+}
@@ -0,0 +1,338 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"config"
+	"planner"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// AdviceIndex suggests the secondary index on the columns.
+	AdviceIndex = "index"
+
+	// AdviceShardKey suggests the column as the new shard key of the table.
+	AdviceShardKey = "shard-key"
+
+	advisorJob            = "advisor.index"
+	advisorMaxFilters     = 1024
+	advisorShardKeyFactor = 0.5
+)
+
+// IndexAdvice tuple.
+type IndexAdvice struct {
+	Database string
+	Table    string
+	ShardKey string
+	Advice   string
+	Columns  []string
+	// Querys is the scatter selects of the table filtering on the columns.
+	Querys uint64
+	// AvgTime is the average milliseconds of the querys.
+	AvgTime float64
+	// Statement is the DDL of the index advice.
+	Statement string `json:",omitempty"`
+}
+
+// AdvisorReport tuple, the advices of the scatter selects recorded between Since and Time.
+type AdvisorReport struct {
+	Since   time.Time
+	Time    time.Time
+	Querys  uint64
+	Dropped uint64
+	Advices []IndexAdvice
+}
+
+type scatterStat struct {
+	filter planner.ScatterFilter
+	querys uint64
+	cost   time.Duration
+}
+
+// Advisor used to record the scatter selects filtering on the non-shard-key columns,
+// and to advise the indexes or the shard keys for the frequent ones.
+type Advisor struct {
+	log     *xlog.Log
+	spanner *Spanner
+	conf    *config.AdvisorConfig
+	mu      sync.Mutex
+	since   time.Time
+	querys  uint64
+	dropped uint64
+	// Key is the table and the filter columns.
+	stats  map[string]*scatterStat
+	report *AdvisorReport
+}
+
+// NewAdvisor creates the new Advisor, it records nothing if the conf is nil.
+func NewAdvisor(log *xlog.Log, spanner *Spanner, conf *config.AdvisorConfig) *Advisor {
+	return &Advisor{
+		log:     log,
+		spanner: spanner,
+		conf:    conf,
+		since:   time.Now(),
+		stats:   make(map[string]*scatterStat),
+	}
+}
+
+// Register used to add the advisor job to the scheduler.
+func (a *Advisor) Register(scheduler *Scheduler) {
+	if a.conf == nil {
+		return
+	}
+	scheduler.AddLocal(advisorJob, a.conf.Schedule, a.Run)
+}
+
+// Record used to record the scatter filters of the plans executed in the cost.
+func (a *Advisor) Record(plans *planner.PlanTree, cost time.Duration) {
+	if a.conf == nil {
+		return
+	}
+	var filters []planner.ScatterFilter
+	for _, plan := range plans.Plans() {
+		filters = append(filters, planner.ScatterFilters(plan)...)
+	}
+	if len(filters) == 0 {
+		return
+	}
+
+	maxFilters := a.conf.MaxFilters
+	if maxFilters <= 0 {
+		maxFilters = advisorMaxFilters
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.querys++
+	for _, filter := range filters {
+		key := fmt.Sprintf("%s.%s:%s:%s", filter.Database, filter.Table, strings.Join(filter.Equals, ","), strings.Join(filter.Ranges, ","))
+		stat, ok := a.stats[key]
+		if !ok {
+			if len(a.stats) >= maxFilters {
+				a.dropped++
+				continue
+			}
+			stat = &scatterStat{filter: filter}
+			a.stats[key] = stat
+		}
+		stat.querys++
+		stat.cost += cost
+	}
+}
+
+// Report returns the report of the last run, nil if the advisor has never run.
+func (a *Advisor) Report() *AdvisorReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.report
+}
+
+// Run used to analyze the scatter selects recorded since the last run, the rows affected is the advices.
+// The filters of the same table are advised to one index if the columns are not the leading columns of
+// any index of the table, the equal columns go first and then one range column.
+// The equal column filtered by more than half of the scatter selects of the table is also advised as the shard key.
+func (a *Advisor) Run() (*sqltypes.Result, error) {
+	a.mu.Lock()
+	stats := a.stats
+	report := &AdvisorReport{Since: a.since, Time: time.Now(), Querys: a.querys, Dropped: a.dropped}
+	a.stats = make(map[string]*scatterStat)
+	a.since, a.querys, a.dropped = report.Time, 0, 0
+	a.mu.Unlock()
+
+	var minQuerys uint64
+	if a.conf != nil {
+		minQuerys = a.conf.MinQuerys
+	}
+	tables := make(map[string][]*scatterStat)
+	for _, stat := range stats {
+		table := fmt.Sprintf("%s.%s", stat.filter.Database, stat.filter.Table)
+		tables[table] = append(tables[table], stat)
+	}
+	for _, tableStats := range tables {
+		report.Advices = append(report.Advices, a.advise(tableStats, minQuerys)...)
+	}
+	sort.Slice(report.Advices, func(i, j int) bool {
+		x, y := report.Advices[i], report.Advices[j]
+		if x.Querys != y.Querys {
+			return x.Querys > y.Querys
+		}
+		if x.Database+"."+x.Table != y.Database+"."+y.Table {
+			return x.Database+"."+x.Table < y.Database+"."+y.Table
+		}
+		return x.Advice < y.Advice
+	})
+
+	a.mu.Lock()
+	a.report = report
+	a.mu.Unlock()
+	return &sqltypes.Result{RowsAffected: uint64(len(report.Advices))}, nil
+}
+
+// advise returns the advices of the filters on the same table.
+func (a *Advisor) advise(stats []*scatterStat, minQuerys uint64) []IndexAdvice {
+	var advices []IndexAdvice
+	var total uint64
+	filter := stats[0].filter
+	indexes := a.indexes(filter.Database, filter.Table)
+	equals := make(map[string]*scatterStat)
+	for _, stat := range stats {
+		total += stat.querys
+		for _, col := range stat.filter.Equals {
+			x, ok := equals[col]
+			if !ok {
+				x = &scatterStat{}
+				equals[col] = x
+			}
+			x.querys += stat.querys
+			x.cost += stat.cost
+		}
+		if stat.querys < minQuerys {
+			continue
+		}
+
+		columns := append([]string{}, stat.filter.Equals...)
+		if len(stat.filter.Ranges) > 0 {
+			columns = append(columns, stat.filter.Ranges[0])
+		}
+		if isIndexed(indexes, stat.filter.Equals, columns) {
+			continue
+		}
+		advices = append(advices, IndexAdvice{
+			Database:  filter.Database,
+			Table:     filter.Table,
+			ShardKey:  filter.ShardKey,
+			Advice:    AdviceIndex,
+			Columns:   columns,
+			Querys:    stat.querys,
+			AvgTime:   avgMilliseconds(stat.cost, stat.querys),
+			Statement: indexStatement(filter.Database, filter.Table, columns),
+		})
+	}
+
+	for col, stat := range equals {
+		if stat.querys < minQuerys || float64(stat.querys) <= float64(total)*advisorShardKeyFactor {
+			continue
+		}
+		advices = append(advices, IndexAdvice{
+			Database: filter.Database,
+			Table:    filter.Table,
+			ShardKey: filter.ShardKey,
+			Advice:   AdviceShardKey,
+			Columns:  []string{col},
+			Querys:   stat.querys,
+			AvgTime:  avgMilliseconds(stat.cost, stat.querys),
+		})
+	}
+	return advices
+}
+
+// indexes returns the columns of the indexes of the table, which are read from its first segment.
+func (a *Advisor) indexes(database, table string) [][]string {
+	log := a.log
+	spanner := a.spanner
+	tconf, err := spanner.router.TableConfig(database, table)
+	if err != nil || len(tconf.Partitions) == 0 {
+		return nil
+	}
+	partition := tconf.Partitions[0]
+	query := fmt.Sprintf("show index from %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(partition.Table))
+	qr, err := spanner.ExecuteOnThisBackend(partition.Backend, query)
+	if err != nil {
+		log.Error("advisor.show.index.of.table[%s.%s].error:%v", database, table, err)
+		return nil
+	}
+
+	keyIdx, colIdx := -1, -1
+	for i, field := range qr.Fields {
+		switch strings.ToLower(field.Name) {
+		case "key_name":
+			keyIdx = i
+		case "column_name":
+			colIdx = i
+		}
+	}
+	if keyIdx == -1 || colIdx == -1 {
+		return nil
+	}
+	// The rows are ordered by the key and the seq in index.
+	var names []string
+	keys := make(map[string][]string)
+	for _, row := range qr.Rows {
+		name := row[keyIdx].String()
+		if _, ok := keys[name]; !ok {
+			names = append(names, name)
+		}
+		keys[name] = append(keys[name], row[colIdx].String())
+	}
+	indexes := make([][]string, 0, len(names))
+	for _, name := range names {
+		indexes = append(indexes, keys[name])
+	}
+	return indexes
+}
+
+// isIndexed returns true if the columns are the leading columns of any index,
+// the order of the equal columns doesn't matter.
+func isIndexed(indexes [][]string, equals []string, columns []string) bool {
+	for _, index := range indexes {
+		if len(index) < len(columns) {
+			continue
+		}
+		matched := true
+		for i, col := range columns {
+			if i < len(equals) {
+				if !containsColumn(equals, strings.ToLower(index[i])) {
+					matched = false
+					break
+				}
+			} else if !strings.EqualFold(index[i], col) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsColumn(cols []string, col string) bool {
+	for _, c := range cols {
+		if strings.ToLower(c) == col {
+			return true
+		}
+	}
+	return false
+}
+
+func indexStatement(database, table string, columns []string) string {
+	cols := make([]string, 0, len(columns))
+	for _, col := range columns {
+		cols = append(cols, sqlparser.Backtick(col))
+	}
+	name := "idx_" + strings.Join(columns, "_")
+	return fmt.Sprintf("create index %s on %s.%s(%s)", sqlparser.Backtick(name), sqlparser.Backtick(database), sqlparser.Backtick(table), strings.Join(cols, ", "))
+}
+
+func avgMilliseconds(cost time.Duration, querys uint64) float64 {
+	if querys == 0 {
+		return 0
+	}
+	return float64(cost) / float64(querys) / float64(time.Millisecond)
+}
@@ -0,0 +1,162 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyAdvisor(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.Advisor = &config.AdvisorConfig{Schedule: "@hourly", MinQuerys: 2}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+	advisor := proxy.Spanner().Advisor()
+
+	indexResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Table", Type: querypb.Type_VARCHAR},
+			{Name: "Key_name", Type: querypb.Type_VARCHAR},
+			{Name: "Seq_in_index", Type: querypb.Type_INT64},
+			{Name: "Column_name", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("idx_b")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("b")),
+			},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("show index from .*", indexResult)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, a int, b int, c int, d int) partition by hash(id)",
+		"create table test.g1(id int, a int) global",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// Never run.
+	{
+		assert.Nil(t, advisor.Report())
+	}
+
+	// Run.
+	{
+		querys := []string{
+			"select * from test.t1 where a=1 and c>2",
+			"select * from test.t1 where c<9 and a=2",
+			"select * from test.t1 where a in (1, 2) and c between 1 and 3",
+			"select * from test.t1 where a=3 and c>=1 and b like 'x%'",
+			"select * from test.t1 where b=1",
+			"select * from test.t1 where b=2",
+			"select * from test.t1 where d=1",
+			"select * from test.t1 where id=1 and d=1",
+			"select * from test.g1 where a=1",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+
+		run := runJob(t, proxy.Spanner().Scheduler(), advisorJob)
+		assert.Equal(t, "", run.Error)
+		assert.Equal(t, uint64(2), run.RowsAffected)
+
+		report := advisor.Report()
+		assert.NotNil(t, report)
+		assert.Equal(t, uint64(7), report.Querys)
+		assert.Equal(t, 2, len(report.Advices))
+
+		index := report.Advices[0]
+		assert.Equal(t, AdviceIndex, index.Advice)
+		assert.Equal(t, "t1", index.Table)
+		assert.Equal(t, []string{"a", "c"}, index.Columns)
+		assert.Equal(t, uint64(4), index.Querys)
+		assert.Equal(t, "create index `idx_a_c` on `test`.`t1`(`a`, `c`)", index.Statement)
+
+		shardKey := report.Advices[1]
+		assert.Equal(t, AdviceShardKey, shardKey.Advice)
+		assert.Equal(t, "id", shardKey.ShardKey)
+		assert.Equal(t, []string{"a"}, shardKey.Columns)
+		assert.Equal(t, "", shardKey.Statement)
+	}
+
+	// The recorded are reset by the run.
+	{
+		runJob(t, proxy.Spanner().Scheduler(), advisorJob)
+		report := advisor.Report()
+		assert.Equal(t, uint64(0), report.Querys)
+		assert.Equal(t, 0, len(report.Advices))
+	}
+}
+
+func TestProxyAdvisorMaxFilters(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.Advisor = &config.AdvisorConfig{Schedule: "@hourly", MaxFilters: 1}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("show index from .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, a int, b int) partition by hash(id)",
+		"select * from test.t1 where a=1",
+		"select * from test.t1 where b=1",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	runJob(t, proxy.Spanner().Scheduler(), advisorJob)
+	report := proxy.Spanner().Advisor().Report()
+	assert.Equal(t, uint64(1), report.Dropped)
+	assert.Equal(t, 2, len(report.Advices))
+	assert.Equal(t, []string{"a"}, report.Advices[0].Columns)
+}
@@ -0,0 +1,76 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"backend"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+)
+
+const (
+	// analystConnectionID is the first connection id of the analyst endpoint,
+	// the ids of the two endpoints are kept apart for the sessions and KILL.
+	analystConnectionID = 1 << 31
+)
+
+// analystHandler is the handler of the analyst endpoint, it shares the spanner with the endpoint
+// but only the analyst users can login and the sessions are limited by the analyst config.
+type analystHandler struct {
+	*Spanner
+}
+
+// NewSession impl.
+func (h *analystHandler) NewSession(s *driver.Session) {
+	h.sessions.AddAnalyst(s)
+}
+
+// SessionCheck impl, the analyst sessions don't take the max-connections of the endpoint.
+func (h *analystHandler) SessionCheck(s *driver.Session) error {
+	max := h.conf.Proxy.Analyst.MaxConnections
+	if h.sessions.AnalystReaches(max) {
+		return sqldb.NewSQLErrorf(sqldb.ER_CON_COUNT_ERROR, "Too many connections(max: %v)", max)
+	}
+	return h.hostCheck(s.Addr())
+}
+
+// AuthCheck impl.
+func (h *analystHandler) AuthCheck(s *driver.Session) error {
+	allowed := false
+	for _, user := range h.conf.Proxy.Analyst.Users {
+		if user == s.User() {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		h.log.Warning("proxy.analyst.user[%s].denied", s.User())
+		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v' on the analyst endpoint", s.User())
+	}
+	return h.Spanner.AuthCheck(s)
+}
+
+// setAnalystLimits used to set the analyst limits and the partial result to the txn of the analyst session.
+func (spanner *Spanner) setAnalystLimits(session *driver.Session, txn backend.Transaction) {
+	analyst := spanner.conf.Proxy.Analyst
+	if analyst == nil || !spanner.sessions.isAnalyst(session) {
+		return
+	}
+	if analyst.QueryTimeout > 0 {
+		txn.SetTimeout(analyst.QueryTimeout)
+	}
+	if analyst.MaxResultSize > 0 {
+		txn.SetMaxResult(analyst.MaxResultSize)
+	}
+	if analyst.MaxResultRows > 0 {
+		txn.SetMaxResultRows(analyst.MaxResultRows)
+	}
+	txn.SetPartialResult(true)
+}
@@ -0,0 +1,147 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyAnalyst(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.Analyst = &config.AnalystConfig{
+		Endpoint:       fmt.Sprintf("127.0.0.1:%d", randomPort(20000, 25000)),
+		Users:          []string{"mock"},
+		MaxConnections: 2,
+		MaxResultRows:  50,
+	}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	assert.NotEqual(t, "", proxy.AnalystAddress())
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("insert .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	analyst, err := driver.NewConn("mock", "mock", proxy.AnalystAddress(), "", "utf8")
+	assert.Nil(t, err)
+	defer analyst.Close()
+
+	// The sessions of the two endpoints.
+	{
+		assert.True(t, proxy.Spanner().sessions.AnalystReaches(1))
+		assert.False(t, proxy.Spanner().sessions.Reaches(2))
+		for _, info := range proxy.Spanner().sessions.Snapshot() {
+			if info.ID >= analystConnectionID {
+				assert.Equal(t, "mock", info.User)
+			}
+		}
+	}
+
+	// The max result rows of the analyst endpoint.
+	{
+		qr, err := client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 60, len(qr.Rows))
+
+		_, err = analyst.FetchAll("select * from test.t1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "max result rows[50] exceeded"), err.Error())
+	}
+
+	// The analyst limits of the transaction and the EXPLAIN ANALYZE.
+	{
+		proxy.conf.Proxy.TwopcEnable = true
+		fakedbs.AddQueryPattern("xa .*", fakedb.Result3)
+		_, err := analyst.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = analyst.FetchAll("select * from test.t1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "max result rows[50] exceeded"), err.Error())
+		_, err = analyst.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+		proxy.conf.Proxy.TwopcEnable = false
+
+		_, err = analyst.FetchAll("explain analyze select * from test.t1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "max result rows[50] exceeded"), err.Error())
+	}
+
+	// The partial result skips the failed backend.
+	{
+		fakedbs.AddQueryErrorPattern("select .* from test.t1_0024 .*", errors.New("mock.select.error"))
+		_, err := client.FetchAll("select * from test.t1", -1)
+		assert.NotNil(t, err)
+
+		qr, err := analyst.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 48, len(qr.Rows))
+		fakedbs.ResetPatternErrors()
+	}
+
+	// Read-only.
+	{
+		querys := []string{
+			"insert into test.t1(id, b) values(1, 1)",
+			"create table test.t2(id int, b int) partition by hash(id)",
+			"flush tables",
+			"rename database test to db2",
+		}
+		for _, query := range querys {
+			_, err := analyst.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			assert.Equal(t, "The MySQL server is running with the --read-only option so it cannot execute this statement (errno 1290) (sqlstate 42000)", err.Error())
+		}
+		_, err := client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+	}
+
+	// The users not allowed.
+	{
+		_, err := driver.NewConn("xx", "xx", proxy.AnalystAddress(), "", "utf8")
+		assert.NotNil(t, err)
+		assert.Equal(t, "Access denied for user 'xx' on the analyst endpoint (errno 1045) (sqlstate 28000)", err.Error())
+	}
+
+	// Max connections.
+	{
+		analyst2, err := driver.NewConn("mock", "mock", proxy.AnalystAddress(), "", "utf8")
+		assert.Nil(t, err)
+		defer analyst2.Close()
+
+		_, err = driver.NewConn("mock", "mock", proxy.AnalystAddress(), "", "utf8")
+		assert.NotNil(t, err)
+		assert.Equal(t, "Too many connections(max: 2) (errno 1040) (sqlstate 08004)", err.Error())
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"config"
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// analyzeTask is the segment to be analyzed on the backend.
+type analyzeTask struct {
+	backend  string
+	database string
+	table    string
+}
+
+// Analyzer runs ANALYZE TABLE on the segments after the restores, the rollup refreshes and the shard shifts,
+// so the backend optimizers don't use the stale statistics of the bulk written or moved rows.
+// The segments are analyzed one by one in the background with the auto-analyze-interval(in millisecond)
+// between them, and the segment queued again before it's analyzed is analyzed once.
+type Analyzer struct {
+	log     *xlog.Log
+	spanner *Spanner
+	conf    *config.ProxyConfig
+	mu      sync.Mutex
+	queue   []analyzeTask
+	queued  map[analyzeTask]bool
+	wake    chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	clock   xbase.AtomicClock
+}
+
+// NewAnalyzer creates the new Analyzer.
+func NewAnalyzer(log *xlog.Log, spanner *Spanner, conf *config.ProxyConfig) *Analyzer {
+	return &Analyzer{
+		log:     log,
+		spanner: spanner,
+		conf:    conf,
+		queued:  make(map[analyzeTask]bool),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Init used to start the worker.
+func (a *Analyzer) Init() {
+	a.wg.Add(1)
+	go a.run()
+	a.log.Info("analyzer.init.done")
+}
+
+// Close used to stop the worker, the queued segments are dropped.
+func (a *Analyzer) Close() {
+	close(a.done)
+	a.wg.Wait()
+	a.log.Info("analyzer.closed")
+}
+
+// SetClock used to set the clock of the interval.
+func (a *Analyzer) SetClock(clock xbase.Clock) {
+	a.clock.Set(clock)
+}
+
+// Add used to queue the segment of the database on the backend, it's ignored if the auto-analyze is off.
+func (a *Analyzer) Add(backend string, database string, table string) {
+	if !a.conf.AutoAnalyze {
+		return
+	}
+
+	task := analyzeTask{backend: backend, database: database, table: table}
+	a.mu.Lock()
+	if !a.queued[task] {
+		a.queued[task] = true
+		a.queue = append(a.queue, task)
+	}
+	a.mu.Unlock()
+
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending returns the segments queued but not analyzed yet.
+func (a *Analyzer) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.queue)
+}
+
+func (a *Analyzer) pop() (analyzeTask, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.queue) == 0 {
+		return analyzeTask{}, false
+	}
+	task := a.queue[0]
+	a.queue = a.queue[1:]
+	delete(a.queued, task)
+	return task, true
+}
+
+func (a *Analyzer) run() {
+	defer a.wg.Done()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-a.wake:
+		}
+
+		for {
+			task, ok := a.pop()
+			if !ok {
+				break
+			}
+			a.analyze(task)
+
+			// Throttle the ANALYZE TABLEs.
+			interval := time.Duration(a.conf.AutoAnalyzeInterval) * time.Millisecond
+			select {
+			case <-a.done:
+				return
+			case <-a.clock.Get().After(interval):
+			}
+		}
+	}
+}
+
+func (a *Analyzer) analyze(task analyzeTask) {
+	log := a.log
+	query := fmt.Sprintf("analyze table %s.%s", sqlparser.Backtick(task.database), sqlparser.Backtick(task.table))
+	if _, err := a.spanner.ExecuteOnThisBackend(task.backend, query); err != nil {
+		log.Error("analyzer.backend[%s].query[%s].error:%+v", task.backend, query, err)
+		return
+	}
+	log.Info("analyzer.backend[%s].query[%s].done", task.backend, query)
+}
+
+// autoAnalyze used to queue all the segments of the table to the analyzer.
+func (spanner *Spanner) autoAnalyze(database string, table string) {
+	tconf, err := spanner.router.TableConfig(database, table)
+	if err != nil {
+		spanner.log.Error("spanner.auto.analyze.table[%s.%s].error:%+v", database, table, err)
+		return
+	}
+	for _, part := range tconf.Partitions {
+		spanner.analyzer.Add(part.Backend, database, part.Table)
+	}
+}
+
+// AutoAnalyzeSegment used to queue the segment on the backend to the analyzer, such as the segment shifted to it.
+func (spanner *Spanner) AutoAnalyzeSegment(backend string, database string, table string) {
+	spanner.analyzer.Add(backend, database, table)
+}
+
+// Analyzer returns the analyzer.
+func (spanner *Spanner) Analyzer() *Analyzer {
+	return spanner.analyzer
+}
@@ -0,0 +1,122 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"fakedb"
+	"xbase"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyAutoAnalyze(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.AutoAnalyze = true
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	proxy.SetClock(clock)
+	spanner := proxy.Spanner()
+	analyzer := spanner.Analyzer()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("analyze table .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	tconf, err := proxy.Router().TableConfig("test", "t1")
+	assert.Nil(t, err)
+	analyzed := func(segment string) int {
+		return fakedbs.GetQueryCalledNum(fmt.Sprintf("analyze table `test`.`%s`", segment))
+	}
+
+	interval := time.Duration(conf.Proxy.AutoAnalyzeInterval) * time.Millisecond
+	// advance used to move the clock by the intervals until the cond is met.
+	advance := func(cond func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			if cond() {
+				return true
+			}
+			clock.Advance(interval)
+			time.Sleep(time.Millisecond)
+		}
+		return false
+	}
+
+	// The segments queued twice are analyzed once, one per interval.
+	{
+		seen := make(map[string]bool)
+		for _, part := range tconf.Partitions {
+			seen[part.Table] = true
+		}
+		segments := len(seen)
+		waiters := clock.Waiters()
+		spanner.autoAnalyze("test", "t1")
+		spanner.autoAnalyze("test", "t1")
+
+		// The next waits for the interval.
+		assert.True(t, clock.WaitForWaiters(waiters+1, time.Second))
+		assert.Equal(t, segments-1, analyzer.Pending())
+		assert.True(t, advance(func() bool { return analyzer.Pending() == 0 }))
+		assert.True(t, advance(func() bool { return analyzed(tconf.Partitions[len(tconf.Partitions)-1].Table) == 1 }))
+		for table := range seen {
+			assert.Equal(t, 1, analyzed(table), table)
+		}
+	}
+
+	// The shifted segment.
+	{
+		part := tconf.Partitions[0]
+		spanner.AutoAnalyzeSegment(part.Backend, "test", part.Table)
+		assert.True(t, advance(func() bool { return analyzed(part.Table) == 2 }))
+	}
+
+	// The table created by the CREATE TABLE ... SELECT.
+	{
+		_, err := client.FetchAll("create table test.t2(id int, b int) partition by hash(id) as select id, b from test.t1", -1)
+		assert.Nil(t, err)
+		tconf, err := proxy.Router().TableConfig("test", "t2")
+		assert.Nil(t, err)
+		for _, part := range tconf.Partitions {
+			table := part.Table
+			assert.True(t, advance(func() bool { return analyzed(table) == 1 }), table)
+		}
+	}
+
+	// Off.
+	{
+		proxy.SetAutoAnalyze(false)
+		spanner.autoAnalyze("test", "t1")
+		assert.Equal(t, 0, analyzer.Pending())
+	}
+}
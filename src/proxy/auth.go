@@ -43,12 +43,26 @@ func (spanner *Spanner) SessionCheck(s *driver.Session) error {
 	if spanner.sessions.Reaches(max) {
 		return sqldb.NewSQLErrorf(sqldb.ER_CON_COUNT_ERROR, "Too many connections(max: %v)", max)
 	}
+	return spanner.hostCheck(s.Addr())
+}
 
+// PgwireSessionCheck used to check the pgwire client as the SessionCheck, the connections of the pgwire endpoint
+// includes the new one and they share the max-connections with the mysql sessions.
+func (spanner *Spanner) PgwireSessionCheck(address string, connections int) error {
+	max := spanner.conf.Proxy.MaxConnections
+	if spanner.sessions.Reaches(max - connections + 1) {
+		return sqldb.NewSQLErrorf(sqldb.ER_CON_COUNT_ERROR, "Too many connections(max: %v)", max)
+	}
+	return spanner.hostCheck(address)
+}
+
+// hostCheck used to check the client host by the ip table.
+func (spanner *Spanner) hostCheck(address string) error {
 	log := spanner.log
-	host, _, err := net.SplitHostPort(s.Addr())
+	host, _, err := net.SplitHostPort(address)
 	if err != nil {
-		log.Error("proxy.spanner.split.address.error:%+v", s.Addr())
-		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user from host '%v'", s.Addr())
+		log.Error("proxy.spanner.split.address.error:%+v", address)
+		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user from host '%v'", address)
 	}
 
 	// Local login bypass.
@@ -64,43 +78,69 @@ func (spanner *Spanner) SessionCheck(s *driver.Session) error {
 	return nil
 }
 
-// AuthCheck impl.
-func (spanner *Spanner) AuthCheck(s *driver.Session) error {
-	// Local login bypass.
-	if localUserLogin(s) {
-		return nil
-	}
-
+// authStage2 returns the SHA1(SHA1(password)) of the user from the backend mysql.user.
+func (spanner *Spanner) authStage2(user string) ([]byte, error) {
 	log := spanner.log
-	user := s.User()
-
-	// Server salt.
-	salt := s.Salt()
-	// Client response.
-	resp := s.Scramble()
-
 	query := fmt.Sprintf("select authentication_string from mysql.user where user='%s'", user)
 	qr, err := spanner.ExecuteSingle(query)
 
 	// Query error.
 	if err != nil {
 		log.Error("proxy: auth.error:%+v", err)
-		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
 	}
 
 	// User not exists.
 	if len(qr.Rows) == 0 {
 		log.Error("proxy: auth.can't.find.the.user:%s", user)
-		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
 	}
 
 	// mysql.user.authentication_string is ['*' + HEX(SHA1(SHA1(password)))]
 	authStr := strings.TrimPrefix(qr.Rows[0][0].String(), "*")
-	wantStage2, err := hex.DecodeString(authStr)
+	stage2, err := hex.DecodeString(authStr)
 	if err != nil {
 		log.Error("proxy: auth.user[%s].decode[%s].error:%+v", user, authStr, err)
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
+	}
+	return stage2, nil
+}
+
+// AuthCheckPassword used to check the cleartext password of the user, for the non-mysql frontends.
+func (spanner *Spanner) AuthCheckPassword(user string, password string) error {
+	wantStage2, err := spanner.authStage2(user)
+	if err != nil {
+		return err
+	}
+
+	stage1 := sha1.Sum([]byte(password))
+	gotStage2 := sha1.Sum(stage1[:])
+	if !bytes.Equal(wantStage2, gotStage2[:]) {
+		spanner.log.Error("proxy: auth.user[%s].failed(password.invalid)", user)
 		return sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", user)
 	}
+	return nil
+}
+
+// AuthCheck impl.
+func (spanner *Spanner) AuthCheck(s *driver.Session) error {
+	// Local login bypass.
+	if localUserLogin(s) {
+		return nil
+	}
+
+	log := spanner.log
+	user := s.User()
+
+	// Server salt.
+	salt := s.Salt()
+	// Client response.
+	resp := s.Scramble()
+
+	wantStage2, err := spanner.authStage2(user)
+	if err != nil {
+		return err
+	}
 
 	// last= SHA1(salt <concat> SHA1(SHA1(password)))
 	crypt := sha1.New()
@@ -87,6 +87,48 @@ func TestProxyAuth(t *testing.T) {
 	}
 }
 
+func TestProxyAuthMariaDB(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxyMariaDB(log, MockDefaultConfig())
+	defer cleanup()
+	address := proxy.Address()
+
+	// The MariaDB backends only respond to the rewritten query.
+	{
+		fakedbs.AddQuery("select if(authentication_string = '', password, authentication_string) as authentication_string from mysql.user where user='mocknull'", &sqltypes.Result{})
+		_, err := driver.NewConn("mocknull", "mockx", address, "", "utf8")
+		want := "Access denied for user 'mocknull' (errno 1045) (sqlstate 28000)"
+		got := err.Error()
+		assert.Equal(t, want, got)
+	}
+
+	// Auth OK.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		client.Close()
+	}
+}
+
+func TestProxyAuthCheckPassword(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+
+	assert.Nil(t, spanner.AuthCheckPassword("mock", "mock"))
+	{
+		err := spanner.AuthCheckPassword("mock", "mockx")
+		want := "Access denied for user 'mock' (errno 1045) (sqlstate 28000)"
+		assert.Equal(t, want, err.Error())
+	}
+	{
+		err := spanner.AuthCheckPassword("mockx", "mock")
+		want := "Access denied for user 'mockx' (errno 1045) (sqlstate 28000)"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
 func TestProxyAuthLocalPassby(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	_, proxy, cleanup := MockProxy(log)
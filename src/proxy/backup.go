@@ -0,0 +1,384 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"backend"
+	"config"
+	"executor"
+	"optimizer"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	backupMetaFile = "meta.json"
+	// backupBatchRows is the rows of one insert in the backup file.
+	backupBatchRows = 256
+)
+
+// BackupPosition tuple, the binlog position of the backend when the snapshot is taken.
+type BackupPosition struct {
+	Backend  string `json:"backend"`
+	File     string `json:"file"`
+	Position string `json:"position"`
+	GTID     string `json:"gtid"`
+}
+
+// BackupSegment tuple.
+type BackupSegment struct {
+	Backend string `json:"backend"`
+	Table   string `json:"table"`
+	File    string `json:"file"`
+	Rows    int    `json:"rows"`
+}
+
+// BackupMeta tuple, it's the meta.json of the backup dir.
+type BackupMeta struct {
+	Database    string            `json:"database"`
+	Table       string            `json:"table"`
+	ShardType   string            `json:"shardtype"`
+	ShardKey    string            `json:"shardkey"`
+	CreateTable string            `json:"create-table"`
+	Columns     []string          `json:"columns"`
+	Positions   []*BackupPosition `json:"positions"`
+	Segments    []*BackupSegment  `json:"segments"`
+}
+
+// BackupTable used to dump all the segments of the logical table to the dir.
+// The segments on the same backend are dumped in one consistent snapshot and the binlog position is recorded,
+// the snapshots and the positions of all the backends are taken under the commit lock, so they are at the same cut
+// of the distributed transactions. For the global table, only one copy is dumped.
+func (spanner *Spanner) BackupTable(database string, table string, dir string) (*BackupMeta, error) {
+	log := spanner.log
+	router := spanner.router
+	scatter := spanner.scatter
+
+	tconf, err := router.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := os.Stat(path.Join(dir, backupMetaFile)); err == nil {
+		return nil, errors.Errorf("backup.dir[%s].already.has.a.backup", dir)
+	}
+
+	partitions := tconf.Partitions
+	if tconf.ShardType == "GLOBAL" && len(partitions) > 0 {
+		partitions = partitions[:1]
+	}
+	// Group the segments by backend.
+	var backends []string
+	segments := make(map[string][]*config.PartitionConfig)
+	for _, part := range partitions {
+		if _, ok := segments[part.Backend]; !ok {
+			backends = append(backends, part.Backend)
+		}
+		segments[part.Backend] = append(segments[part.Backend], part)
+	}
+
+	meta := &BackupMeta{
+		Database:  database,
+		Table:     table,
+		ShardType: tconf.ShardType,
+		ShardKey:  tconf.ShardKey,
+	}
+	pools := scatter.PoolClone()
+	// The connections are in the snapshot transactions, don't reuse them.
+	conns := make([]backend.Connection, 0, len(backends))
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for _, name := range backends {
+		pool, ok := pools[name]
+		if !ok {
+			return nil, errors.Errorf("backup.can.not.find.backend[%s]", name)
+		}
+		conn, err := pool.Get()
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	meta.Positions = make([]*BackupPosition, len(backends))
+	if err := scatter.CommitReadLocked(func() error {
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		var errs []error
+		for i, name := range backends {
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				pos, err := backupSnapshot(conns[i], name)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, err)
+					return
+				}
+				meta.Positions[i] = pos
+			}(i, name)
+		}
+		wg.Wait()
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}); err != nil {
+		log.Error("spanner.backup.table[%s.%s].snapshot.error:%+v", database, table, err)
+		return nil, err
+	}
+
+	for i, name := range backends {
+		if err := spanner.backupBackend(conns[i], meta, database, segments[name], dir); err != nil {
+			log.Error("spanner.backup.table[%s.%s].backend[%s].error:%+v", database, table, name, err)
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, backupMetaFile), data, 0644); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	log.Info("spanner.backup.table[%s.%s].to[%s].done", database, table, dir)
+	return meta, nil
+}
+
+// backupSnapshot used to start the consistent snapshot on the connection and returns the binlog position of it.
+func backupSnapshot(conn backend.Connection, name string) (*BackupPosition, error) {
+	if _, err := conn.Execute("start transaction with consistent snapshot"); err != nil {
+		return nil, err
+	}
+	qr, err := conn.Execute("show master status")
+	if err != nil {
+		return nil, err
+	}
+	pos := &BackupPosition{Backend: name}
+	if len(qr.Rows) > 0 {
+		row := qr.Rows[0]
+		for i, field := range qr.Fields {
+			switch field.Name {
+			case "File":
+				pos.File = row[i].String()
+			case "Position":
+				pos.Position = row[i].String()
+			case "Executed_Gtid_Set":
+				pos.GTID = row[i].String()
+			}
+		}
+	}
+	return pos, nil
+}
+
+// backupBackend used to dump the segments on one backend in the consistent snapshot of the connection.
+func (spanner *Spanner) backupBackend(conn backend.Connection, meta *BackupMeta, database string, parts []*config.PartitionConfig, dir string) error {
+	if meta.CreateTable == "" {
+		qr, err := conn.Execute(fmt.Sprintf("show create table %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(parts[0].Table)))
+		if err != nil {
+			return err
+		}
+		if len(qr.Rows) > 0 && len(qr.Rows[0]) > 1 {
+			create := qr.Rows[0][1].String()
+			meta.CreateTable = strings.Replace(create, sqlparser.Backtick(parts[0].Table), sqlparser.Backtick(meta.Table), 1)
+		}
+	}
+
+	for _, part := range parts {
+		seg := &BackupSegment{
+			Backend: part.Backend,
+			Table:   part.Table,
+			File:    part.Table + ".sql",
+		}
+		if err := backupSegment(conn, meta, database, seg, path.Join(dir, seg.File)); err != nil {
+			return err
+		}
+		meta.Segments = append(meta.Segments, seg)
+	}
+	_, err := conn.Execute("commit")
+	return err
+}
+
+// backupSegment used to dump the segment rows to the file, one line is the values of one insert batch.
+func backupSegment(conn backend.Connection, meta *BackupMeta, database string, seg *BackupSegment, file string) error {
+	fd, err := os.Create(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer fd.Close()
+	w := bufio.NewWriter(fd)
+
+	rows, err := conn.ExecuteStreamFetch(fmt.Sprintf("select * from %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(seg.Table)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if meta.Columns == nil {
+		for _, field := range rows.Fields() {
+			meta.Columns = append(meta.Columns, field.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	batch := 0
+	for rows.Next() {
+		row, err := rows.RowValues()
+		if err != nil {
+			return err
+		}
+		if batch > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('(')
+		for i, v := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			v.EncodeSQL(&buf)
+		}
+		buf.WriteByte(')')
+		batch++
+		seg.Rows++
+		if batch == backupBatchRows {
+			buf.WriteByte('\n')
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return errors.WithStack(err)
+			}
+			buf.Reset()
+			batch = 0
+		}
+	}
+	if err := rows.LastError(); err != nil {
+		return err
+	}
+	if batch > 0 {
+		buf.WriteByte('\n')
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return errors.WithStack(w.Flush())
+}
+
+// RestoreTable used to restore the backup in the dir to the database.table, the table must be created first.
+// The rows are inserted by the planner, so they are re-sharded if the layout differs from the backup.
+func (spanner *Spanner) RestoreTable(database string, table string, dir string) (int, error) {
+	log := spanner.log
+	router := spanner.router
+
+	data, err := ioutil.ReadFile(path.Join(dir, backupMetaFile))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	meta := &BackupMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if database == "" {
+		database = meta.Database
+	}
+	if table == "" {
+		table = meta.Table
+	}
+	if _, err := router.TableConfig(database, table); err != nil {
+		return 0, err
+	}
+
+	columns := make([]string, len(meta.Columns))
+	for i, column := range meta.Columns {
+		columns[i] = sqlparser.Backtick(column)
+	}
+	prefix := fmt.Sprintf("insert into %s.%s(%s) values ", sqlparser.Backtick(database), sqlparser.Backtick(table), strings.Join(columns, ","))
+
+	// The files must be in the dir, the meta may be edited.
+	for _, seg := range meta.Segments {
+		if seg.File == "" || seg.File != path.Base(seg.File) || seg.File == ".." || seg.File == "." || strings.Contains(seg.File, "\\") {
+			return 0, errors.Errorf("restore.segment[%s].file[%s].must.be.a.file.name.in.the.backup.dir", seg.Table, seg.File)
+		}
+	}
+
+	restored := 0
+	for _, seg := range meta.Segments {
+		fd, err := os.Open(path.Join(dir, seg.File))
+		if err != nil {
+			return restored, errors.WithStack(err)
+		}
+		r := bufio.NewReader(fd)
+		for {
+			line, err := r.ReadString('\n')
+			if line = strings.TrimSuffix(line, "\n"); line != "" {
+				qr, xerr := spanner.executeRestore(database, prefix+line)
+				if xerr != nil {
+					fd.Close()
+					log.Error("spanner.restore.table[%s.%s].segment[%s].error:%+v", database, table, seg.Table, xerr)
+					return restored, xerr
+				}
+				restored += int(qr.RowsAffected)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fd.Close()
+				return restored, errors.WithStack(err)
+			}
+		}
+		fd.Close()
+	}
+	log.Info("spanner.restore.table[%s.%s].from[%s].rows[%d].done", database, table, dir, restored)
+	spanner.autoAnalyze(database, table)
+	return restored, nil
+}
+
+// executeRestore used to execute the insert by the planner without the client session.
+func (spanner *Spanner) executeRestore(database string, query string) (*sqltypes.Result, error) {
+	log := spanner.log
+	conf := spanner.conf
+	router := spanner.router
+	scatter := spanner.scatter
+
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := scatter.CreateTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Finish()
+	txn.SetTimeout(conf.Proxy.QueryTimeout)
+	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+
+	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	if err != nil {
+		return nil, err
+	}
+	return executor.NewTree(log, plans, txn).Execute()
+}
@@ -0,0 +1,161 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	backupMasterStatusResult = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "File", Type: querypb.Type_VARCHAR},
+			{Name: "Position", Type: querypb.Type_INT64},
+			{Name: "Executed_Gtid_Set", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("mysql-bin.000003")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("154")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("uuid:1-10")),
+			},
+		},
+	}
+
+	backupCreateTableResult = &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Table", Type: querypb.Type_VARCHAR},
+			{Name: "Create Table", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `t1_0000` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB")),
+			},
+		},
+	}
+)
+
+func TestProxyBackupRestoreTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+
+	dir := fakedb.GetTmpDir("", "radon_backup_", log)
+	defer os.RemoveAll(dir)
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQuery("start transaction with consistent snapshot", &sqltypes.Result{})
+		fakedbs.AddQuery("commit", &sqltypes.Result{})
+		fakedbs.AddQuery("show master status", backupMasterStatusResult)
+		fakedbs.AddQueryPattern("show create table .*", backupCreateTableResult)
+		fakedbs.AddQueryPattern("select \\* from .*", fakedb.Result1)
+		fakedbs.AddQueryPattern("insert into .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.g1(id int, b int) global", -1)
+		assert.Nil(t, err)
+	}
+
+	// Backup.
+	{
+		meta, err := spanner.BackupTable("test", "t1", dir)
+		assert.Nil(t, err)
+		assert.Equal(t, "HASH", meta.ShardType)
+		assert.Equal(t, "id", meta.ShardKey)
+		assert.Equal(t, []string{"id", "name"}, meta.Columns)
+		assert.Equal(t, "CREATE TABLE `t1` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB", meta.CreateTable)
+		assert.Equal(t, 5, len(meta.Positions))
+		assert.Equal(t, "mysql-bin.000003", meta.Positions[0].File)
+		assert.Equal(t, "154", meta.Positions[0].Position)
+		assert.Equal(t, "uuid:1-10", meta.Positions[0].GTID)
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, len(tconf.Partitions), len(meta.Segments))
+		assert.Equal(t, 2, meta.Segments[0].Rows)
+
+		data, err := ioutil.ReadFile(path.Join(dir, meta.Segments[0].File))
+		assert.Nil(t, err)
+		assert.Equal(t, "(11,'1nice name'),(12,null)\n", string(data))
+
+		// Backup again to the same dir.
+		_, err = spanner.BackupTable("test", "t1", dir)
+		assert.NotNil(t, err)
+	}
+
+	// Backup the global table, only one copy.
+	{
+		globalDir := path.Join(dir, "g1")
+		meta, err := spanner.BackupTable("test", "g1", globalDir)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(meta.Segments))
+	}
+
+	// Restore.
+	{
+		rows, err := spanner.RestoreTable("", "", dir)
+		assert.Nil(t, err)
+		assert.True(t, rows > 0)
+
+		// Restore to the global table, the rows are written to all the 5 backends.
+		rows, err = spanner.RestoreTable("test", "g1", dir)
+		assert.Nil(t, err)
+		assert.Equal(t, 30*5, rows)
+	}
+
+	// Errors.
+	{
+		_, err := spanner.BackupTable("test", "t2", path.Join(dir, "t2"))
+		assert.NotNil(t, err)
+
+		_, err = spanner.RestoreTable("test", "t2", dir)
+		assert.NotNil(t, err)
+
+		_, err = spanner.RestoreTable("", "", path.Join(dir, "none"))
+		assert.NotNil(t, err)
+	}
+
+	// The segment files out of the backup dir are refused.
+	for _, file := range []string{"../t1_0000.sql", "/etc/passwd", "..", "sub/t1_0000.sql"} {
+		evilDir := path.Join(dir, "evil")
+		assert.Nil(t, os.MkdirAll(evilDir, 0755))
+		meta := &BackupMeta{Database: "test", Table: "t1", Columns: []string{"id"}, Segments: []*BackupSegment{{Table: "t1_0000", File: file}}}
+		data, err := json.Marshal(meta)
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(path.Join(evilDir, backupMetaFile), data, 0644))
+		_, err = spanner.RestoreTable("", "", evilDir)
+		assert.Equal(t, fmt.Sprintf("restore.segment[t1_0000].file[%s].must.be.a.file.name.in.the.backup.dir", file), err.Error())
+	}
+}
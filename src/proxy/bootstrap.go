@@ -0,0 +1,133 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// BootstrapReport tuple, the databases and the segment tables created on the backend,
+// the existing ones are not touched and are in the Existing as 'db' or 'db.table'.
+type BootstrapReport struct {
+	Backend   string   `json:"backend"`
+	Databases []string `json:"databases"`
+	Tables    []string `json:"tables"`
+	Existing  []string `json:"existing"`
+}
+
+// BootstrapBackend used to create all the databases and the empty segment tables placed on the backend by the router,
+// so the backend added is usable. The segment table is created as the segments of the same table on the other backends,
+// the error is returned with the report of the ones created before it.
+func (spanner *Spanner) BootstrapBackend(name string) (*BootstrapReport, error) {
+	log := spanner.log
+	router := spanner.router
+	report := &BootstrapReport{
+		Backend:   name,
+		Databases: []string{},
+		Tables:    []string{},
+		Existing:  []string{},
+	}
+	if _, ok := spanner.scatter.PoolClone()[name]; !ok {
+		return report, errors.Errorf("backend[%s].can.not.be.found", name)
+	}
+
+	// The databases on the backend.
+	qr, err := spanner.ExecuteOnThisBackend(name, "show databases")
+	if err != nil {
+		return report, err
+	}
+	databases := make(map[string]bool)
+	for _, row := range qr.Rows {
+		databases[row[0].String()] = true
+	}
+
+	list := router.Tables()
+	dbs := make([]string, 0, len(list))
+	for db := range list {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+	for _, db := range dbs {
+		existing := make(map[string]bool)
+		if databases[db] {
+			report.Existing = append(report.Existing, db)
+			qr, err := spanner.ExecuteOnThisBackend(name, fmt.Sprintf("show tables from %s", sqlparser.Backtick(db)))
+			if err != nil {
+				return report, err
+			}
+			for _, row := range qr.Rows {
+				existing[row[0].String()] = true
+			}
+		} else {
+			if _, err := spanner.ExecuteOnThisBackend(name, fmt.Sprintf("create database if not exists %s", sqlparser.Backtick(db))); err != nil {
+				return report, err
+			}
+			log.Warning("spanner.bootstrap.backend[%s].database[%s].created", name, db)
+			report.Databases = append(report.Databases, db)
+		}
+
+		tables := list[db]
+		sort.Strings(tables)
+		for _, table := range tables {
+			tconf, err := router.TableConfig(db, table)
+			if err != nil {
+				return report, err
+			}
+			create, source := "", ""
+			for _, part := range tconf.Partitions {
+				if part.Backend != name {
+					continue
+				}
+				segment := fmt.Sprintf("%s.%s", db, part.Table)
+				if existing[part.Table] {
+					report.Existing = append(report.Existing, segment)
+					continue
+				}
+				if create == "" {
+					if create, source, err = spanner.segmentCreateTable(name, db, tconf.Partitions); err != nil {
+						return report, errors.Wrapf(err, "bootstrap.backend[%s].table[%s.%s]", name, db, table)
+					}
+				}
+				query := strings.Replace(create, sqlparser.Backtick(source), fmt.Sprintf("%s.%s", sqlparser.Backtick(db), sqlparser.Backtick(part.Table)), 1)
+				if _, err := spanner.ExecuteOnThisBackend(name, query); err != nil {
+					return report, err
+				}
+				log.Warning("spanner.bootstrap.backend[%s].table[%s].created", name, segment)
+				report.Tables = append(report.Tables, segment)
+			}
+		}
+	}
+	return report, nil
+}
+
+// segmentCreateTable returns the CREATE TABLE of the segments and the segment it's from,
+// the segment is one of the partitions not on the backend.
+func (spanner *Spanner) segmentCreateTable(backend string, database string, parts []*config.PartitionConfig) (string, string, error) {
+	for _, part := range parts {
+		if part.Backend == backend {
+			continue
+		}
+		qr, err := spanner.ExecuteOnThisBackend(part.Backend, fmt.Sprintf("show create table %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(part.Table)))
+		if err != nil {
+			return "", "", err
+		}
+		if len(qr.Rows) == 0 || len(qr.Rows[0]) < 2 {
+			return "", "", errors.Errorf("show.create.table[%s.%s].on.backend[%s].is.empty", database, part.Table, part.Backend)
+		}
+		return qr.Rows[0][1].String(), part.Table, nil
+	}
+	return "", "", errors.New("no.segment.on.the.other.backends.to.copy.the.schema")
+}
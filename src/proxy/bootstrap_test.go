@@ -0,0 +1,132 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyBootstrapBackend(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	tconf, err := proxy.Router().TableConfig("test", "t1")
+	assert.Nil(t, err)
+	backend := tconf.Partitions[0].Backend
+	var segments, source []string
+	for _, part := range tconf.Partitions {
+		if part.Backend == backend {
+			segments = append(segments, part.Table)
+		} else if source == nil {
+			source = []string{part.Backend, part.Table}
+		}
+	}
+	rows := func(values ...string) *sqltypes.Result {
+		qr := &sqltypes.Result{Fields: []*querypb.Field{{Name: "Name", Type: querypb.Type_VARCHAR}}}
+		for _, value := range values {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(value))})
+		}
+		return qr
+	}
+	showCreate := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Table", Type: querypb.Type_VARCHAR},
+			{Name: "Create Table", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(source[1])),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(fmt.Sprintf("CREATE TABLE `%s` (`id` int(11) DEFAULT NULL) ENGINE=InnoDB", source[1]))),
+		}},
+	}
+	fakedbs.AddQuery(fmt.Sprintf("show create table `test`.`%s`", source[1]), showCreate)
+	fakedbs.AddQuery("show create table `test`.`g1`", &sqltypes.Result{
+		Fields: showCreate.Fields,
+		Rows: [][]sqltypes.Value{{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("g1")),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `g1` (`id` int(11) DEFAULT NULL) ENGINE=InnoDB")),
+		}},
+	})
+	createSegment := func(table string) string {
+		return fmt.Sprintf("CREATE TABLE `test`.`%s` (`id` int(11) DEFAULT NULL) ENGINE=InnoDB", table)
+	}
+
+	// The new backend.
+	{
+		fakedbs.AddQuery("show databases", rows("information_schema", "mysql"))
+		report, err := spanner.BootstrapBackend(backend)
+		assert.Nil(t, err)
+		assert.Equal(t, backend, report.Backend)
+		assert.Equal(t, []string{"test"}, report.Databases)
+		assert.Equal(t, len(segments)+1, len(report.Tables))
+		assert.Equal(t, 0, len(report.Existing))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create database if not exists `test`"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(createSegment("g1")))
+		for _, segment := range segments {
+			assert.Equal(t, 1, fakedbs.GetQueryCalledNum(createSegment(segment)), segment)
+		}
+		// The schema is copied once per table.
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("show create table `test`.`%s`", source[1])))
+	}
+
+	// The existing ones.
+	{
+		fakedbs.AddQuery("show databases", rows("test"))
+		fakedbs.AddQuery("show tables from `test`", rows(append(segments, "g1")...))
+		report, err := spanner.BootstrapBackend(backend)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(report.Databases))
+		assert.Equal(t, 0, len(report.Tables))
+		assert.Equal(t, len(segments)+2, len(report.Existing))
+		assert.Equal(t, "test", report.Existing[0])
+	}
+
+	// Errors.
+	{
+		_, err := spanner.BootstrapBackend("xx")
+		assert.Equal(t, "backend[xx].can.not.be.found", err.Error())
+
+		fakedbs.AddQuery("show tables from `test`", rows())
+		fakedbs.AddQueryError(fmt.Sprintf("show create table `test`.`%s`", source[1]), fmt.Errorf("mock.show.create.error"))
+		report, err := spanner.BootstrapBackend(backend)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "mock.show.create.error")
+		assert.Equal(t, 1, len(report.Tables))
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+var (
+	callRegexp = regexp.MustCompile("(?is)^call\\s+(`?(\\w+)`?\\s*\\.\\s*)?`?(\\w+)`?\\s*(\\((.*)\\))?$")
+)
+
+// isCall returns true if the query is a CALL statement, it's not supported by the parser.
+func isCall(query string) bool {
+	return callRegexp.MatchString(query)
+}
+
+// handleCall used to handle the CALL of the procedures declared in the proxy procedures config.
+// The procedure with the table and shard-key-arg is routed to the backend owns the key argument,
+// the read-only one without the table is broadcasted to all the backends and the results are merged.
+// The procedures not declared are rejected as unsupported.
+func (spanner *Spanner) handleCall(session *driver.Session, query string) (*sqltypes.Result, error) {
+	router := spanner.router
+	privilegePlug := spanner.plugins.PlugPrivilege()
+
+	matches := callRegexp.FindStringSubmatch(query)
+	db, name, args := matches[2], matches[3], matches[5]
+	if db == "" {
+		db = session.Schema()
+	}
+	procedure, ok := spanner.conf.Proxy.Procedures[strings.ToLower(db+"."+name)]
+	if db == "" || !ok {
+		return nil, unsupportedSQLError(query)
+	}
+
+	// The read-only procedure needs the select privilege, the others need the update privilege.
+	var node sqlparser.Statement = &sqlparser.Update{}
+	if procedure.ReadOnly {
+		node = &sqlparser.Select{}
+	}
+	if !privilegePlug.CheckPrivilege(db, session.User(), node) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'@'%%' to database '%v'", session.User(), db)
+	}
+	if !procedure.ReadOnly {
+		if spanner.ReadOnly() {
+			return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+		}
+		if (session.Status() & sqldb.SERVER_STATUS_IN_TRANS_READONLY) > 0 {
+			return nil, sqldb.NewSQLError(sqldb.ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION)
+		}
+	}
+
+	// The arguments are re-serialized from the literals, the raw text never reaches the backends.
+	exprs, err := callArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	call := fmt.Sprintf("call `%s`.`%s`(%s)", db, name, sqlparser.String(exprs))
+	if procedure.Table == "" {
+		return spanner.ExecuteScatter(call)
+	}
+
+	key, err := callShardKey(exprs, procedure.ShardKeyArg)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := router.Lookup(db, procedure.Table, key, key)
+	if err != nil {
+		return nil, err
+	}
+	return spanner.ExecuteOnThisBackend(segments[0].Backend, call)
+}
+
+// callArgs parses the arguments of the CALL, each one must be a literal.
+func callArgs(args string) (sqlparser.SelectExprs, error) {
+	if strings.TrimSpace(args) == "" {
+		return nil, nil
+	}
+	node, err := sqlparser.Parse("select " + args)
+	if err != nil {
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+	}
+	// Only the arguments list is accepted, no clause follows it.
+	sel, ok := node.(*sqlparser.Select)
+	if !ok || sqlparser.String(sel) != "select "+sqlparser.String(sel.SelectExprs)+" from dual" {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "procedure.args[%s].must.be.literals", args)
+	}
+	for i, expr := range sel.SelectExprs {
+		if aliased, ok := expr.(*sqlparser.AliasedExpr); ok && aliased.As.IsEmpty() && isCallLiteral(aliased.Expr) {
+			continue
+		}
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "procedure.arg[%d].must.be.a.literal", i+1)
+	}
+	return sel.SelectExprs, nil
+}
+
+// isCallLiteral returns true if the expr is a literal or a signed number.
+func isCallLiteral(expr sqlparser.Expr) bool {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal, *sqlparser.NullVal, sqlparser.BoolVal:
+		return true
+	case *sqlparser.UnaryExpr:
+		if expr.Operator != sqlparser.UMinusStr && expr.Operator != sqlparser.UPlusStr {
+			return false
+		}
+		val, ok := expr.Expr.(*sqlparser.SQLVal)
+		return ok && (val.Type == sqlparser.IntVal || val.Type == sqlparser.FloatVal)
+	}
+	return false
+}
+
+// callShardKey returns the literal of the n-th(1-based) argument.
+func callShardKey(exprs sqlparser.SelectExprs, n int) (*sqlparser.SQLVal, error) {
+	if n > len(exprs) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "procedure.shard.key.arg[%d].out.of.range[%d]", n, len(exprs))
+	}
+	if expr, ok := exprs[n-1].(*sqlparser.AliasedExpr); ok {
+		if val, ok := expr.Expr.(*sqlparser.SQLVal); ok {
+			return val, nil
+		}
+	}
+	return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "procedure.shard.key.arg[%d].must.be.a.literal", n)
+}
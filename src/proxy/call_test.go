@@ -0,0 +1,126 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyCall(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.Procedures = map[string]*config.ProcedureConfig{
+		"test.p1": {Table: "t1", ShardKeyArg: 2},
+		"test.p2": {ReadOnly: true},
+	}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("use .*", fakedb.Result3)
+		fakedbs.AddQuery("call `test`.`p1`('x', 1)", fakedb.Result1)
+		fakedbs.AddQuery("call `test`.`p2`()", fakedb.Result1)
+		fakedbs.AddQuery("call `test`.`p2`(-1, 'a;b', null, true)", fakedb.Result1)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	// Routed to the backend owns the key.
+	{
+		qr, err := client.FetchAll("CALL test.`P1`('x', 1);", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, fakedb.Result1.Rows, qr.Rows)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("call `test`.`p1`('x', 1)"))
+	}
+
+	// Broadcasted and merged.
+	{
+		_, err := client.FetchAll("use test", -1)
+		assert.Nil(t, err)
+		qr, err := client.FetchAll("call p2", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(qr.Rows))
+		assert.Equal(t, 5, fakedbs.GetQueryCalledNum("call `test`.`p2`()"))
+
+		// The literals are re-serialized.
+		_, err = client.FetchAll("call p2( -1,'a;b' , NULL, true /* c */)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, fakedbs.GetQueryCalledNum("call `test`.`p2`(-1, 'a;b', null, true)"))
+	}
+
+	// Errors.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{
+				"call test.p3()",
+				"Unsupported procedure: stored procedures and functions are not supported, workaround: move the routine logic to the application (errno 9003) (sqlstate HY000)",
+			},
+			{
+				"call test.p1('x')",
+				"procedure.shard.key.arg[2].out.of.range[1] (errno 1105) (sqlstate HY000)",
+			},
+			{
+				"call test.p1('x', @id)",
+				"procedure.arg[2].must.be.a.literal (errno 1105) (sqlstate HY000)",
+			},
+			{
+				"call test.p1('x', 1); drop database test; select (1)",
+				"You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, syntax error at position 15 (errno 1149) (sqlstate 42000)",
+			},
+			{
+				"call test.p2(1 from t)",
+				"procedure.args[1 from t].must.be.literals (errno 1105) (sqlstate HY000)",
+			},
+			{
+				"call test.p2((select 1), now())",
+				"procedure.arg[1].must.be.a.literal (errno 1105) (sqlstate HY000)",
+			},
+			{
+				"call test.p1(null, null)",
+				"procedure.shard.key.arg[2].must.be.a.literal (errno 1105) (sqlstate HY000)",
+			},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+	}
+
+	// Readonly.
+	{
+		proxy.SetReadOnly(true)
+		_, err := client.FetchAll("call test.p1('x', 1)", -1)
+		assert.Equal(t, "The MySQL server is running with the --read-only option so it cannot execute this statement (errno 1290) (sqlstate 42000)", err.Error())
+		_, err = client.FetchAll("call test.p2()", -1)
+		assert.Nil(t, err)
+		proxy.SetReadOnly(false)
+	}
+}
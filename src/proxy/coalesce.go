@@ -0,0 +1,164 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"xbase"
+	"xbase/sync2"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// coalesceCall is the in-flight execution shared by the identical querys.
+type coalesceCall struct {
+	done  chan struct{}
+	start time.Time
+	dups  int
+	qr    *sqltypes.Result
+	err   error
+}
+
+// Coalescer executes the identical querys arrive at the same time once, the first one runs the query
+// and the others wait for its result.
+type Coalescer struct {
+	mu     sync.Mutex
+	calls  map[string]*coalesceCall
+	shared sync2.AtomicInt64
+}
+
+// NewCoalescer creates the new Coalescer.
+func NewCoalescer() *Coalescer {
+	return &Coalescer{
+		calls: make(map[string]*coalesceCall),
+	}
+}
+
+// Do used to execute the fn once for the querys of the key in flight.
+// The caller only joins the execution started after its last write, the older one may not see the write and the
+// caller executes the fn by itself.
+// The result is read only after it's shared, so every caller gets its own copy to write to the client.
+// The waiting caller is interrupted if the ctx is cancelled, such as killed, and the execution goes on for the others.
+func (c *Coalescer) Do(ctx context.Context, key string, now time.Time, lastWrite time.Time, fn func() (*sqltypes.Result, error)) (*sqltypes.Result, error) {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		if !call.start.After(lastWrite) {
+			c.mu.Unlock()
+			return fn()
+		}
+		call.dups++
+		c.mu.Unlock()
+		c.shared.Add(1)
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, the query is cancelled")
+		}
+		if call.err != nil || call.qr == nil {
+			return nil, call.err
+		}
+		return call.qr.Copy(), nil
+	}
+	call := &coalesceCall{done: make(chan struct{}), start: now}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	qr, err := fn()
+	call.qr, call.err = qr, err
+	c.mu.Lock()
+	delete(c.calls, key)
+	dups := call.dups
+	c.mu.Unlock()
+	close(call.done)
+
+	if qr != nil && dups > 0 {
+		qr = qr.Copy()
+	}
+	return qr, err
+}
+
+// Inflight returns the querys running now.
+func (c *Coalescer) Inflight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.calls)
+}
+
+// Shared returns the querys served by the others' execution.
+func (c *Coalescer) Shared() int64 {
+	return c.shared.Get()
+}
+
+// coalesceKey returns the key of the read to be coalesced, false if the coalesce-reads is disabled or the read
+// is in the transaction or with the locking.
+// The key is the database and the fingerprint of the query, the user, the analyst, the replica routing, the
+// radon_consistent_read and the resolved radon_read_as_of watermark are also in it, the sessions sharing the
+// result have the same privileges, limits and consistency.
+// The read isn't coalesced if its watermark can't be resolved, the error is returned by the execution.
+func (spanner *Spanner) coalesceKey(session *driver.Session, database string, node sqlparser.Statement) (string, bool) {
+	if !spanner.conf.Proxy.CoalesceReads {
+		return "", false
+	}
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if node.Lock != "" {
+			return "", false
+		}
+	case *sqlparser.Union:
+		if node.Lock != "" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	analyst := false
+	if txSession := spanner.sessions.getTxnSession(session); txSession != nil {
+		if _, transaction := txSession.getReadConsistencyVar(); transaction {
+			return "", false
+		}
+		analyst = txSession.analyst
+	}
+	var asOf string
+	watermark, err := spanner.readWatermark(session, node)
+	if err != nil {
+		return "", false
+	}
+	if watermark != nil {
+		asOf = strconv.FormatUint(watermark.ID, 10)
+	}
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	key := []string{
+		database,
+		session.User(),
+		flag(analyst),
+		flag(spanner.readReplica(session, database, node)),
+		flag(spanner.consistentRead(session, node)),
+		asOf,
+		sqlparser.String(node),
+	}
+	return strings.Join(key, "\x00"), true
+}
+
+// Coalescer returns the coalescer of the reads.
+func (spanner *Spanner) Coalescer() *Coalescer {
+	return spanner.coalescer
+}
@@ -0,0 +1,231 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"fakedb"
+	"xbase"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyCoalesceReads(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.CoalesceReads = true
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	fakedbs.SetClock(clock)
+	proxy.SetClock(clock)
+	coalescer := proxy.Spanner().Coalescer()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQuery("SELECT @@GLOBAL.gtid_executed", &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "val", Type: querypb.Type_VARCHAR}},
+			Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("uuid:1-10"))}},
+		})
+		fakedbs.AddQueryDelay("select * from test.g1", fakedb.Result1, 1000)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	type result struct {
+		qr  *sqltypes.Result
+		err error
+	}
+	// fetch used to run the query on the n new clients at the same time.
+	fetch := func(n int, query string) []chan result {
+		results := make([]chan result, n)
+		for i := range results {
+			results[i] = make(chan result, 1)
+			go func(c chan result) {
+				client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+				if err != nil {
+					c <- result{err: err}
+					return
+				}
+				defer client.Close()
+				qr, err := client.FetchAll(query, -1)
+				c <- result{qr: qr, err: err}
+			}(results[i])
+		}
+		return results
+	}
+	// wait used to wait for the cond.
+	wait := func(cond func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if cond() {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The identical reads are executed once.
+	{
+		called := fakedbs.GetQueryCalledNum("select * from test.g1")
+		shared := coalescer.Shared()
+		results := fetch(5, "select * from test.g1")
+		assert.True(t, wait(func() bool { return coalescer.Shared() == shared+4 }))
+		assert.Equal(t, 1, coalescer.Inflight())
+		assert.True(t, wait(func() bool {
+			clock.Advance(time.Second)
+			return coalescer.Inflight() == 0
+		}))
+		for _, c := range results {
+			got := <-c
+			assert.Nil(t, got.err)
+			assert.Equal(t, len(fakedb.Result1.Rows), len(got.qr.Rows))
+			assert.Equal(t, fakedb.Result1.Rows[0][0].String(), got.qr.Rows[0][0].String())
+		}
+		assert.Equal(t, called+1, fakedbs.GetQueryCalledNum("select * from test.g1"))
+	}
+
+	// The keys.
+	{
+		spanner := proxy.Spanner()
+		session := proxy.Sessions().getSession(client.ConnectionID()).session
+		coalesceKey := func(database string, query string) (string, bool) {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			return spanner.coalesceKey(session, database, node)
+		}
+		_, ok := coalesceKey("test", "select * from g1 for update")
+		assert.False(t, ok)
+		_, ok = coalesceKey("test", "insert into g1(id, b) values(1, 1)")
+		assert.False(t, ok)
+		key1, ok := coalesceKey("test", "select * from g1")
+		assert.True(t, ok)
+		key2, _ := coalesceKey("test", "SELECT *   FROM g1")
+		assert.Equal(t, key1, key2)
+		key3, _ := coalesceKey("db1", "select * from g1")
+		assert.NotEqual(t, key1, key3)
+
+		// The consistent read.
+		_, err = client.FetchAll("set @@SESSION.radon_consistent_read='ON'", -1)
+		assert.Nil(t, err)
+		key6, ok := coalesceKey("test", "select * from g1")
+		assert.True(t, ok)
+		assert.NotEqual(t, key1, key6)
+		_, err = client.FetchAll("set @@SESSION.radon_consistent_read='OFF'", -1)
+		assert.Nil(t, err)
+		key7, _ := coalesceKey("test", "select * from g1")
+		assert.Equal(t, key1, key7)
+
+		// The read as of the watermark.
+		_, err = client.FetchAll("set radon_read_as_of = 'latest'", -1)
+		assert.Nil(t, err)
+		_, ok = coalesceKey("test", "select * from g1")
+		assert.False(t, ok)
+		watermark, err := proxy.Scatter().CaptureWatermark()
+		assert.Nil(t, err)
+		key4, ok := coalesceKey("test", "select * from g1")
+		assert.True(t, ok)
+		assert.NotEqual(t, key1, key4)
+		_, err = client.FetchAll(fmt.Sprintf("set radon_read_as_of = %d", watermark.ID), -1)
+		assert.Nil(t, err)
+		key5, _ := coalesceKey("test", "select * from g1")
+		assert.Equal(t, key4, key5)
+		_, err = client.FetchAll("set radon_read_as_of = NULL", -1)
+		assert.Nil(t, err)
+
+		// In the transaction.
+		proxy.conf.Proxy.TwopcEnable = true
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, ok = coalesceKey("test", "select * from g1")
+		assert.False(t, ok)
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+		proxy.conf.Proxy.TwopcEnable = false
+	}
+
+	// Disabled.
+	{
+		proxy.Spanner().conf.Proxy.CoalesceReads = false
+		called := fakedbs.GetQueryCalledNum("select * from test.g1")
+		waiters := clock.Waiters()
+		results := fetch(2, "select * from test.g1")
+		// The query timeouts and the delays.
+		assert.True(t, clock.WaitForWaiters(waiters+4, 5*time.Second))
+		clock.Advance(time.Second)
+		for _, c := range results {
+			got := <-c
+			assert.Nil(t, got.err)
+		}
+		assert.Equal(t, called+2, fakedbs.GetQueryCalledNum("select * from test.g1"))
+	}
+}
+
+func TestCoalescerLastWrite(t *testing.T) {
+	c := NewCoalescer()
+	start := time.Unix(1552608000, 0)
+	release := make(chan struct{})
+	executed := make(chan struct{}, 3)
+	fn := func() (*sqltypes.Result, error) {
+		executed <- struct{}{}
+		<-release
+		return fakedb.Result1, nil
+	}
+
+	done := make(chan error, 3)
+	go func() {
+		_, err := c.Do(context.Background(), "k", start, time.Time{}, fn)
+		done <- err
+	}()
+	<-executed
+
+	// The caller wrote after the call started executes by itself.
+	go func() {
+		_, err := c.Do(context.Background(), "k", start.Add(time.Second), start.Add(time.Second), fn)
+		done <- err
+	}()
+	<-executed
+	assert.Equal(t, int64(0), c.Shared())
+
+	// The caller wrote before the call started joins it.
+	go func() {
+		_, err := c.Do(context.Background(), "k", start.Add(time.Second), start.Add(-time.Second), fn)
+		done <- err
+	}()
+	for c.Shared() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, <-done)
+	}
+	assert.Equal(t, 0, len(executed))
+}
@@ -0,0 +1,122 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"strings"
+	"time"
+
+	"config"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+const (
+	var_radon_read_consistency = "radon_read_consistency"
+)
+
+// setReadConsistency used to set the read consistency of the session, the empty string or NULL resets it to the global one.
+func (spanner *Spanner) setReadConsistency(txSession *session, expr sqlparser.Expr) error {
+	switch expr := expr.(type) {
+	case *sqlparser.NullVal:
+		txSession.setReadConsistencyVar("")
+		return nil
+	case *sqlparser.SQLVal:
+		if expr.Type == sqlparser.StrVal {
+			consistency := strings.ToLower(string(expr.Val))
+			switch consistency {
+			case "", config.ReadConsistencyEventual, config.ReadConsistencyReadYourWrites, config.ReadConsistencyPrimary:
+				txSession.setReadConsistencyVar(consistency)
+				return nil
+			}
+		}
+	}
+	return sqldb.NewSQLError(sqldb.ER_WRONG_VALUE_FOR_VAR, var_radon_read_consistency, sqlparser.String(expr))
+}
+
+// readReplica returns true if the read can be routed to the replicas of the backends.
+// The read-write-split must be enabled, and the read must be out of the transaction and without the locking.
+// The read of the read-your-writes consistency is routed to the primarys if the session wrote one of its tables
+// in the read-consistency-window.
+func (spanner *Spanner) readReplica(session *driver.Session, database string, node sqlparser.Statement) bool {
+	conf := spanner.conf.Proxy
+	if !conf.ReadWriteSplit {
+		return false
+	}
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if node.Lock != "" {
+			return false
+		}
+	case *sqlparser.Union:
+		if node.Lock != "" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	txSession := spanner.sessions.getTxnSession(session)
+	if txSession == nil {
+		return conf.ReadConsistency != config.ReadConsistencyPrimary
+	}
+	consistency, transaction := txSession.getReadConsistencyVar()
+	if transaction {
+		return false
+	}
+	if consistency == "" {
+		consistency = conf.ReadConsistency
+	}
+	switch consistency {
+	case config.ReadConsistencyEventual:
+		return true
+	case config.ReadConsistencyReadYourWrites:
+		window := time.Duration(conf.ReadConsistencyWindow) * time.Millisecond
+		return !txSession.wroteSince(accessTables(database, node), spanner.sessions.now().Add(-window))
+	}
+	return false
+}
+
+// consistentRead returns true if the read to the multiple backends starts the consistent snapshots on them first.
+// The radon_consistent_read of the session must be ON, and the read must be out of the transaction and without the locking.
+func (spanner *Spanner) consistentRead(session *driver.Session, node sqlparser.Statement) bool {
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if node.Lock != "" {
+			return false
+		}
+	case *sqlparser.Union:
+		if node.Lock != "" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	txSession := spanner.sessions.getTxnSession(session)
+	if txSession == nil || !txSession.getConsistentReadVar() {
+		return false
+	}
+	_, transaction := txSession.getReadConsistencyVar()
+	return !transaction
+}
+
+// recordWrites used to record the write of the session for the coalesced reads, and the tables written for the
+// read-your-writes consistency, the writes in the transaction are recorded when it ends.
+func (spanner *Spanner) recordWrites(session *driver.Session, database string, node sqlparser.Statement) {
+	if txSession := spanner.sessions.getTxnSession(session); txSession != nil {
+		var tables []string
+		if spanner.conf.Proxy.ReadWriteSplit {
+			tables = accessTables(database, node)
+		}
+		txSession.recordWrites(tables, spanner.sessions.now())
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"fakedb"
+	"xbase"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyReadConsistency(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.ReadWriteSplit = true
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	fakedbs.SetClock(clock)
+	proxy.SetClock(clock)
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("insert .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.t2(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	session := proxy.Sessions().getSession(client.ConnectionID()).session
+
+	readReplica := func(query string) bool {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		return spanner.readReplica(session, "test", node)
+	}
+	assert.True(t, readReplica("select * from t1"))
+	assert.False(t, readReplica("select * from t1 for update"))
+	assert.False(t, readReplica("insert into t1(id, b) values(1, 1)"))
+
+	// read-your-writes.
+	{
+		_, err = client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		assert.False(t, readReplica("select * from t1"))
+		assert.False(t, readReplica("select * from t2 join t1 on t1.id=t2.id"))
+		assert.True(t, readReplica("select * from t2"))
+
+		clock.Advance(time.Duration(conf.Proxy.ReadConsistencyWindow) * time.Millisecond)
+		assert.True(t, readReplica("select * from t1"))
+	}
+
+	// The session consistency.
+	{
+		_, err = client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("set radon_read_consistency = 'eventual'", -1)
+		assert.Nil(t, err)
+		assert.True(t, readReplica("select * from t1"))
+
+		_, err = client.FetchAll("set radon_read_consistency = 'PRIMARY'", -1)
+		assert.Nil(t, err)
+		assert.False(t, readReplica("select * from t2"))
+
+		// Reset to the global one.
+		_, err = client.FetchAll("set radon_read_consistency = ''", -1)
+		assert.Nil(t, err)
+		assert.False(t, readReplica("select * from t1"))
+		assert.True(t, readReplica("select * from t2"))
+
+		_, err = client.FetchAll("set radon_read_consistency = 'strong'", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "Variable 'radon_read_consistency' can't be set to the value of ''strong'' (errno 1231) (sqlstate 42000)", err.Error())
+	}
+
+	// The read-write-split is disabled.
+	{
+		spanner.conf.Proxy.ReadWriteSplit = false
+		assert.False(t, readReplica("select * from t2"))
+	}
+}
+
+func TestProxyConsistentRead(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	backends := len(proxy.Spanner().scatter.Backends())
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+		fakedbs.AddQuery("START TRANSACTION WITH CONSISTENT SNAPSHOT", fakedb.Result3)
+		fakedbs.AddQuery("ROLLBACK", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	snapshots := func() int {
+		return fakedbs.GetQueryCalledNum("START TRANSACTION WITH CONSISTENT SNAPSHOT")
+	}
+
+	// Disabled.
+	_, err = client.FetchAll("select * from test.t1", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, snapshots())
+
+	_, err = client.FetchAll("set @@SESSION.radon_consistent_read='ON'", -1)
+	assert.Nil(t, err)
+
+	// The snapshots are started on all the backends of the scatter read.
+	{
+		_, err = client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, backends, snapshots())
+		assert.Equal(t, backends, fakedbs.GetQueryCalledNum("ROLLBACK"))
+	}
+
+	// The point read and the locking read start no snapshot.
+	{
+		_, err = client.FetchAll("select * from test.t1 where id=1", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select * from test.t1 for update", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, backends, snapshots())
+	}
+
+	// The stream fetch.
+	{
+		_, err = client.FetchAll("select /*+ radon_stream */ * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.True(t, snapshots() > backends)
+	}
+
+	_, err = client.FetchAll("set @@SESSION.radon_consistent_read='OFF'", -1)
+	assert.Nil(t, err)
+	called := snapshots()
+	_, err = client.FetchAll("select * from test.t1", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, called, snapshots())
+}
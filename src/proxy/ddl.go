@@ -12,9 +12,12 @@ import (
 	"fmt"
 	"strings"
 
+	"config"
+	"planner"
 	"plugins/autoincrement"
 	"router"
 
+	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
@@ -114,6 +117,189 @@ func tryGetShardKey(ddl *sqlparser.DDL) (string, error) {
 	return "", fmt.Errorf("The unique/primary constraint shoule be defined or add 'PARTITION BY HASH' to mandatory indication")
 }
 
+// createTableOptions used to check the CREATE TABLE and returns the shardkey, table type and router extra of the table.
+func createTableOptions(ddl *sqlparser.DDL) (string, string, *router.Extra, error) {
+	var err error
+	shardKey := ddl.PartitionName
+	tableType := router.TableTypeUnknow
+
+	// Check engine.
+	checkEngine(ddl)
+
+	switch ddl.TableSpec.Options.Type {
+	case sqlparser.PartitionTableType, sqlparser.NormalTableType:
+		if shardKey, err = tryGetShardKey(ddl); err != nil {
+			return "", "", nil, err
+		}
+		tableType = router.TableTypePartition
+	case sqlparser.GlobalTableType:
+		tableType = router.TableTypeGlobal
+	case sqlparser.SingleTableType:
+		tableType = router.TableTypeSingle
+	}
+
+	autoinc, err := autoincrement.GetAutoIncrement(ddl)
+	if err != nil {
+		return "", "", nil, err
+	}
+	extra := &router.Extra{
+		AutoIncrement: autoinc,
+	}
+	if tableType == router.TableTypePartition {
+		extra.ShardKeyType = shardKeyType(ddl, shardKey)
+	}
+	return shardKey, tableType, extra, nil
+}
+
+// parseCreateTable used to parse the CREATE TABLE the parser doesn't support, such as the LIKE, LIST, CHASH, SINGLE ON,
+// AS SELECT and the table options, the parser error err is returned if it's not the case.
+func parseCreateTable(query string, err error) (*sqlparser.DDL, error) {
+	var node *sqlparser.DDL
+	if planner.IsCreateTableLike(query) {
+		node, _, err = planner.ParseCreateTableLike(query)
+	}
+	if err != nil && planner.IsCreateTableList(query) {
+		var ctl *planner.CreateTableList
+		if ctl, err = planner.ParseCreateTableList(query); err == nil {
+			node = ctl.Create
+		}
+	}
+	if err != nil && planner.IsCreateTableCHash(query) {
+		node, err = planner.ParseCreateTableCHash(query)
+	}
+	if err != nil && planner.IsCreateTableSingle(query) {
+		var cts *planner.CreateTableSingle
+		if cts, err = planner.ParseCreateTableSingle(query); err == nil {
+			node = cts.Create
+		}
+	}
+	if err != nil && planner.IsCreateTableSelect(query) {
+		var cts *planner.CreateTableSelect
+		if cts, err = planner.ParseCreateTableSelect(query); err == nil {
+			node = cts.Create
+		}
+	}
+	// The table options which the parser doesn't support, the parser error is kept if it's not the case.
+	if err != nil {
+		if ddl, _, perr := planner.ParseCreateTable(query); perr == nil {
+			node, err = ddl, nil
+		}
+	}
+	return node, err
+}
+
+// createTableSpec is the table of the CREATE TABLE to be added to the router and its segment DDL.
+type createTableSpec struct {
+	shardKey  string
+	tableType string
+	extra     *router.Extra
+	backends  []string
+	// create is the DDL of the segments, the table options the parser drops are appended verbatim.
+	create string
+}
+
+// planCreateTable used to check the CREATE TABLE query and returns the spec of the table on the backends,
+// including the LIST, CHASH, SINGLE ON, PARTITIONS N and the table options the parser drops.
+// The LIKE and AS SELECT are handled by the callers.
+func planCreateTable(query string, ddl *sqlparser.DDL, backends []string) (*createTableSpec, error) {
+	shardKey, tableType, extra, err := createTableOptions(ddl)
+	if err != nil {
+		return nil, err
+	}
+	if planner.IsCreateTableList(query) {
+		ctl, err := planner.ParseCreateTableList(query)
+		if err != nil {
+			return nil, err
+		}
+		tableType = router.TableTypeList
+		extra.ListPartitions = ctl.Partitions
+	}
+	if planner.IsCreateTableSingle(query) {
+		cts, err := planner.ParseCreateTableSingle(query)
+		if err != nil {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+		}
+		if backends, err = singleBackend(backends, cts.Backend); err != nil {
+			return nil, err
+		}
+	}
+	// The parser ignores the tokens after the PARTITION BY HASH(column).
+	if planner.IsCreateTableHashPartitions(query) {
+		cth, err := planner.ParseCreateTableHash(query, "hash")
+		if err != nil {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+		}
+		extra.Partitions = cth.Partitions
+	}
+	if planner.IsCreateTableCHash(query) {
+		cth, err := planner.ParseCreateTableHash(query, "chash")
+		if err != nil {
+			return nil, err
+		}
+		tableType = router.TableTypeCHash
+		extra.Partitions = cth.Partitions
+	}
+	create := sqlparser.String(ddl)
+	_, options, err := planner.SplitTableOptions(query)
+	if err != nil {
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+	}
+	if options != nil {
+		if len(options.Others) > 0 {
+			create += " " + options.String()
+		}
+		if extra.AutoIncrement != nil {
+			extra.AutoIncrement.Start = options.AutoIncrement
+		}
+	}
+	return &createTableSpec{
+		shardKey:  shardKey,
+		tableType: tableType,
+		extra:     extra,
+		backends:  backends,
+		create:    create,
+	}, nil
+}
+
+// singleBackend returns the backend of the SINGLE table DISTRIBUTED BY or SINGLE ON it, which must be one of the normal backends.
+func singleBackend(backends []string, backend string) ([]string, error) {
+	for _, b := range backends {
+		if b == backend {
+			return []string{backend}, nil
+		}
+	}
+	return nil, errors.Errorf("create.table.distributed.by.backend[%s].not.exists", backend)
+}
+
+// shardKeyType returns the shard-key-type of the shard key column, the BINARY/VARBINARY ones are hashed by the raw bytes
+// and the DATE/DATETIME/TIMESTAMP ones by the canonical time.
+func shardKeyType(ddl *sqlparser.DDL, shardKey string) string {
+	for _, col := range ddl.TableSpec.Columns {
+		if col.Name.String() == shardKey {
+			return shardKeyTypeOf(col.Type.Type)
+		}
+	}
+	return ""
+}
+
+// shardKeyTypeOf returns the shard-key-type of the column type, such as 'varbinary(16)' of the SHOW COLUMNS.
+func shardKeyTypeOf(typ string) string {
+	if i := strings.IndexAny(typ, "( "); i != -1 {
+		typ = typ[:i]
+	}
+	switch strings.ToLower(typ) {
+	case "binary", "varbinary":
+		return config.ShardKeyTypeBinary
+	case "date":
+		return config.ShardKeyTypeDate
+	case "datetime":
+		return config.ShardKeyTypeDatetime
+	case "timestamp":
+		return config.ShardKeyTypeTimestamp
+	}
+	return ""
+}
+
 func checkDatabaseExists(database string, router *router.Router) bool {
 	tblList := router.Tables()
 	_, ok := tblList[database]
@@ -144,6 +330,16 @@ func checkTableExists(database string, table string, router *router.Router) bool
 // 5. ALTER TABLE .. ADD COLUMN (column definition)
 // 6. ALTER TABLE .. MODIFY COLUMN column definition
 // 7. ALTER TABLE .. DROP COLUMN column
+// 8. ALTER TABLE .. RENAME TO [database.]table
+// 9. ALTER TABLE and CREATE/DROP INDEX with /*+ radon_backends(backend...) */ on the segments of the backends only
+// 10. CREATE TABLE .. LIKE [database.]table
+// 11. CREATE TABLE (create_definition,...) .. [AS] SELECT ..
+// 12. CREATE TABLE (create_definition,...) PARTITION BY LIST(column) (PARTITION backend VALUES IN (value,...),...)
+// 13. CREATE TABLE (create_definition,...) PARTITION BY CHASH(column) [PARTITIONS num]
+// 14. CREATE TABLE (create_definition,...) PARTITION BY HASH(column) PARTITIONS num
+// 15. ALTER TABLE .. COMMENT [=] 'string'
+// 16. CREATE TABLE (create_definition,...) [SINGLE] DISTRIBUTED BY (backend)
+// 17. CREATE TABLE (create_definition,...) SINGLE ON 'backend'
 func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *sqlparser.DDL) (*sqltypes.Result, error) {
 	log := spanner.log
 	route := spanner.router
@@ -171,6 +367,15 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		}
 	}
 	databases = append(databases, database)
+	// The table can be moved to the other database.
+	toDatabase := database
+	if ddl.Action == sqlparser.RenameStr {
+		toDatabase = session.Schema()
+		if !ddl.NewName.Qualifier.IsEmpty() {
+			toDatabase = ddl.NewName.Qualifier.String()
+		}
+		databases = append(databases, toDatabase)
+	}
 
 	for _, db := range databases {
 		// Check the database ACL.
@@ -184,6 +389,14 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		}
 	}
 
+	if err := spanner.checkReshardDDL(database, ddl); err != nil {
+		return nil, err
+	}
+	// The DDL on the backends chosen by the radon_backends hint.
+	if hints, stripped := ddlHints(query); len(hints.Backends) > 0 {
+		return spanner.handleDDLOnBackends(session, database, stripped, node, hints.Backends)
+	}
+
 	switch ddl.Action {
 	case sqlparser.CreateDBStr:
 		if node.IfNotExists && checkDatabaseExists(database, route) {
@@ -192,13 +405,24 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		if err := route.CreateDatabase(database); err != nil {
 			return nil, err
 		}
-		return spanner.ExecuteScatter(query)
+		job, err := spanner.beginScatterDDLJob(session.User(), database, ddl.Action, query)
+		if err != nil {
+			return nil, err
+		}
+		qr, err := spanner.executeScatterDDLJob(job, query)
+		spanner.ddlJournal.Finish(job, err)
+		return qr, err
 	case sqlparser.DropDBStr:
 		if node.IfExists && !checkDatabaseExists(database, route) {
 			return &sqltypes.Result{}, nil
 		}
+		job, err := spanner.beginScatterDDLJob(session.User(), database, ddl.Action, query)
+		if err != nil {
+			return nil, err
+		}
 		// Execute the ddl.
-		qr, err := spanner.ExecuteScatter(query)
+		qr, err := spanner.executeScatterDDLJob(job, query)
+		spanner.ddlJournal.Finish(job, err)
 		if err != nil {
 			return nil, err
 		}
@@ -208,11 +432,8 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		}
 		return qr, nil
 	case sqlparser.CreateTableStr:
-		var err error
 		table := ddl.Table.Name.String()
 		backends := scatter.Backends()
-		shardKey := ddl.PartitionName
-		tableType := router.TableTypeUnknow
 
 		if !checkDatabaseExists(database, route) {
 			return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
@@ -223,37 +444,28 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			return &sqltypes.Result{}, nil
 		}
 
-		// Check engine.
-		checkEngine(ddl)
-
-		switch ddl.TableSpec.Options.Type {
-		case sqlparser.PartitionTableType, sqlparser.NormalTableType:
-			if shardKey, err = tryGetShardKey(ddl); err != nil {
-				return nil, err
-			}
-			tableType = router.TableTypePartition
-		case sqlparser.GlobalTableType:
-			tableType = router.TableTypeGlobal
-		case sqlparser.SingleTableType:
-			tableType = router.TableTypeSingle
+		if planner.IsCreateTableLike(query) {
+			return spanner.handleCreateTableLike(session, database, query, node)
 		}
 
-		autoinc, err := autoincrement.GetAutoIncrement(node)
+		spec, err := planCreateTable(query, ddl, backends)
 		if err != nil {
 			return nil, err
 		}
-		extra := &router.Extra{
-			AutoIncrement: autoinc,
-		}
-		if err := route.CreateTable(database, table, shardKey, tableType, backends, extra); err != nil {
+		if err := route.CreateTable(database, table, spec.shardKey, spec.tableType, spec.backends, spec.extra); err != nil {
 			return nil, err
 		}
-		r, err := spanner.ExecuteDDL(session, database, sqlparser.String(ddl), node)
+		r, err := spanner.ExecuteDDL(session, database, spec.create, node)
 		if err != nil {
 			// Try to drop table.
 			route.DropTable(database, table)
 			return nil, err
 		}
+		if planner.IsCreateTableSelect(query) {
+			if cts, err := planner.ParseCreateTableSelect(query); err == nil {
+				return spanner.insertCreateTableSelect(session, database, table, cts)
+			}
+		}
 		return r, nil
 	case sqlparser.DropTableStr:
 		r := &sqltypes.Result{}
@@ -265,11 +477,11 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			// The query need differentiate, ddl_plan will define database.
 			var query string
 			if tableIdent.Qualifier.IsEmpty() {
-				query = fmt.Sprintf("drop table %s", table)
+				query = fmt.Sprintf("drop table %s", sqlparser.Backtick(table))
 			} else {
 				//If the tableIdent with Qualifier, us it as db, or else use the default.
 				db = tableIdent.Qualifier.String()
-				query = fmt.Sprintf("drop table %s.%s", db, table)
+				query = fmt.Sprintf("drop table %s.%s", sqlparser.Backtick(db), sqlparser.Backtick(table))
 			}
 
 			// Check the database and table is exists.
@@ -281,6 +493,13 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 			if node.IfExists && !checkTableExists(db, table, route) {
 				return &sqltypes.Result{}, nil
 			}
+			// The view is dropped by the DROP VIEW.
+			if checkBaseTable(route, db, table) != nil {
+				return nil, sqldb.NewSQLError1(sqldb.ER_BAD_TABLE_ERROR, "42S02", "Unknown table '%s.%s'", db, table)
+			}
+			if owner := route.LookupOwner(db, table); owner != "" {
+				return nil, errors.Errorf("unsupported: table[%s.%s].is.the.lookup.table.of[%s]", db, table, owner)
+			}
 
 			// Execute.
 			r, err := spanner.ExecuteDDL(session, db, query, node)
@@ -297,9 +516,14 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		}
 		return r, nil
 	case sqlparser.CreateIndexStr, sqlparser.DropIndexStr,
-		sqlparser.AlterEngineStr, sqlparser.AlterCharsetStr,
+		sqlparser.AlterStr, sqlparser.AlterEngineStr, sqlparser.AlterCharsetStr,
 		sqlparser.AlterAddColumnStr, sqlparser.AlterDropColumnStr, sqlparser.AlterModifyColumnStr,
 		sqlparser.TruncateTableStr:
+		// The parser takes the ALTER TABLE .. COMMENT as the unsupported ALTER.
+		if ddl.Action == sqlparser.AlterStr && !planner.IsAlterTableComment(query) {
+			log.Error("spanner.ddl[%v, %+v].access.denied", query, node)
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; you don't have the privilege for %v operation", ddl.Action)
+		}
 
 		// Check the database and table is exists.
 		if !checkDatabaseExists(database, route) {
@@ -310,14 +534,136 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node *s
 		if !checkTableExists(database, table, route) {
 			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
 		}
+		if err := checkBaseTable(route, database, table); err != nil {
+			return nil, err
+		}
 		// Execute.
 		r, err := spanner.ExecuteDDL(session, database, query, node)
 		if err != nil {
 			log.Error("spanner.ddl[%v].error[%+v]", query, err)
 		}
 		return r, err
+	case sqlparser.RenameStr:
+		// The new name without the database is in the current database as MySQL does.
+		if toDatabase == "" {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+		}
+		if !checkDatabaseExists(database, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+		}
+		table := ddl.Table.Name.String()
+		if !checkTableExists(database, table, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+		}
+		txSession := spanner.sessions.getTxnSession(session)
+		if spanner.isTwoPC() && txSession.transaction != nil {
+			return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
+		}
+		r, err := spanner.RenameTable(database, table, toDatabase, ddl.NewName.Name.String())
+		if err != nil {
+			log.Error("spanner.ddl[%v].error[%+v]", query, err)
+		}
+		return r, err
 	default:
 		log.Error("spanner.ddl[%v, %+v].access.denied", query, node)
 		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; you don't have the privilege for %v operation", ddl.Action)
 	}
 }
+
+// handleCreateTableLike used to handle the 'CREATE TABLE t2 LIKE t1', the new table has the same shard key, shard type
+// and partition layout as the source one, every segment is created like the source segment on the same backend.
+func (spanner *Spanner) handleCreateTableLike(session *driver.Session, database string, query string, node *sqlparser.DDL) (*sqltypes.Result, error) {
+	log := spanner.log
+	route := spanner.router
+
+	_, like, err := planner.ParseCreateTableLike(query)
+	if err != nil {
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+	}
+	likeDatabase := session.Schema()
+	if !like.Qualifier.IsEmpty() {
+		likeDatabase = like.Qualifier.String()
+	}
+	if likeDatabase == "" {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+	}
+	if err := route.DatabaseACL(likeDatabase); err != nil {
+		return nil, err
+	}
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if err := privilegePlug.Check(likeDatabase, session.User(), node); err != nil {
+		return nil, err
+	}
+	likeTable := like.Name.String()
+	if !checkTableExists(likeDatabase, likeTable, route) {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, likeTable)
+	}
+	if err := checkBaseTable(route, likeDatabase, likeTable); err != nil {
+		return nil, err
+	}
+
+	table := node.Table.Name.String()
+	if "dual" == table {
+		return nil, fmt.Errorf("spanner.ddl.check.create.table[%s].error:not support", table)
+	}
+	if err := route.CreateTableLike(database, table, likeDatabase, likeTable); err != nil {
+		return nil, err
+	}
+	r, err := spanner.ExecuteDDL(session, database, query, node)
+	if err != nil {
+		log.Error("spanner.ddl[%v].error[%+v]", query, err)
+		// Try to drop table.
+		route.DropTable(database, table)
+		return nil, err
+	}
+	return r, nil
+}
+
+// insertCreateTableSelect used to insert the rows of the select into the table created by the CREATE TABLE ... SELECT,
+// the rows are routed to the segments by the insert planner in batches, the table is dropped if it fails as MySQL does.
+func (spanner *Spanner) insertCreateTableSelect(session *driver.Session, database string, table string, cts *planner.CreateTableSelect) (*sqltypes.Result, error) {
+	log := spanner.log
+	route := spanner.router
+
+	qr, err := spanner.insertSelectRows(session, database, table, cts)
+	if err != nil {
+		log.Error("spanner.create.table[%s.%s].select[%s].error:%+v", database, table, cts.SelectQuery, err)
+		query := fmt.Sprintf("drop table %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(table))
+		node := &sqlparser.DDL{Action: sqlparser.DropTableStr, Table: sqlparser.TableName{Name: sqlparser.NewTableIdent(table), Qualifier: sqlparser.NewTableIdent(database)}}
+		if _, xerr := spanner.ExecuteDDL(session, database, query, node); xerr != nil {
+			log.Error("spanner.create.table[%s.%s].select.drop.table.error:%+v", database, table, xerr)
+		}
+		if xerr := route.DropTable(database, table); xerr != nil {
+			log.Error("spanner.create.table[%s.%s].select.router.drop.table.error:%+v", database, table, xerr)
+		}
+		return nil, err
+	}
+	spanner.autoAnalyze(database, table)
+	return qr, nil
+}
+
+func (spanner *Spanner) insertSelectRows(session *driver.Session, database string, table string, cts *planner.CreateTableSelect) (*sqltypes.Result, error) {
+	rows, err := spanner.handleSelect(session, cts.SelectQuery, cts.Select)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(rows.Fields))
+	for i, field := range rows.Fields {
+		columns[i] = sqlparser.Backtick(field.Name)
+	}
+
+	qr := &sqltypes.Result{}
+	into := fmt.Sprintf("%s.%s", sqlparser.Backtick(database), sqlparser.Backtick(table))
+	for _, query := range rollupInserts(into, columns, rows.Rows) {
+		node, err := sqlparser.Parse(query)
+		if err != nil {
+			return nil, err
+		}
+		r, err := spanner.handleInsert(session, query, node)
+		if err != nil {
+			return nil, err
+		}
+		qr.RowsAffected += r.RowsAffected
+	}
+	return qr, nil
+}
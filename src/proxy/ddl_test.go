@@ -13,10 +13,13 @@ import (
 	"fmt"
 	"testing"
 
+	"config"
 	"fakedb"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -285,9 +288,9 @@ func TestProxyDDLTable(t *testing.T) {
 		assert.Nil(t, err)
 		query := "create table sbtest.sberror2(id int, b int) partition by hash(id)"
 		_, err = client.FetchAll(query, -1)
-		want := "mock.mysql.create.table.error (errno 1105) (sqlstate HY000)"
+		want := `^mock.mysql.create.table.error \(backend:backend\d, phase:execute\) \(errno 1105\) \(sqlstate HY000\)$`
 		got := err.Error()
-		assert.Equal(t, want, got)
+		assert.Regexp(t, want, got)
 	}
 
 	// check sbtest.tables.
@@ -362,9 +365,9 @@ func TestProxyDDLTable(t *testing.T) {
 		assert.Nil(t, err)
 		query := "drop table sbtest.sbt1"
 		_, err = client.FetchAll(query, -1)
-		want := "mock.mysql.drop.table.error (errno 1105) (sqlstate HY000)"
+		want := `^mock.mysql.drop.table.error \(backend:backend\d, phase:execute\) \(errno 1105\) \(sqlstate HY000\)$`
 		got := err.Error()
-		assert.Equal(t, want, got)
+		assert.Regexp(t, want, got)
 	}
 }
 
@@ -640,11 +643,11 @@ func TestProxyDDLUnsupported(t *testing.T) {
 		fakedbs.AddQueryPattern("rename .*", &sqltypes.Result{})
 	}
 
-	// rename test table.
+	// rename user.
 	{
 		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
 		assert.Nil(t, err)
-		query := "rename table t1 to t2"
+		query := "rename user u1 to u2"
 		_, err = client.FetchAll(query, -1)
 		want := "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, syntax error at position 7 near 'rename' (errno 1149) (sqlstate 42000)"
 		got := err.Error()
@@ -730,6 +733,167 @@ func TestProxyDDLCreateTableError(t *testing.T) {
 	}
 }
 
+func TestProxyDDLCreateTableLike(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create database db1",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// Partition table.
+	{
+		_, err = client.FetchAll("create table db1.t2 like test.t1", -1)
+		assert.Nil(t, err)
+		from, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		tconf, err := route.TableConfig("db1", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, "id", tconf.ShardKey)
+		assert.Equal(t, len(from.Partitions), len(tconf.Partitions))
+		for i, part := range from.Partitions {
+			assert.Equal(t, part.Backend, tconf.Partitions[i].Backend)
+			query := fmt.Sprintf("create table `db1`.`t2%s` like `test`.`%s`", part.Table[len("t1"):], part.Table)
+			assert.Equal(t, 1, fakedbs.GetQueryCalledNum(query), query)
+		}
+
+		// The session database.
+		client1, err := driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+		assert.Nil(t, err)
+		defer client1.Close()
+		_, err = client1.FetchAll("create table if not exists t3 (like t1)", -1)
+		assert.Nil(t, err)
+		_, err = client1.FetchAll("create table if not exists t3 like t1", -1)
+		assert.Nil(t, err)
+	}
+
+	// Global table.
+	{
+		_, err = client.FetchAll("create table test.g2 like test.g1", -1)
+		assert.Nil(t, err)
+		tconf, err := route.TableConfig("test", "g2")
+		assert.Nil(t, err)
+		assert.Equal(t, "GLOBAL", tconf.ShardType)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"create table test.t4 like test.xx",
+			"create table test.t4 like xx",
+			"create table test.dual like test.t1",
+		}
+		wants := []string{
+			"Table 'xx' doesn't exist (errno 1146) (sqlstate 42S02)",
+			"No database selected (errno 1046) (sqlstate 3D000)",
+			"spanner.ddl.check.create.table[dual].error:not support (errno 1105) (sqlstate HY000)",
+		}
+		for i, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, wants[i], err.Error(), query)
+			}
+		}
+
+		// The failed table is dropped from the router.
+		fakedbs.AddQueryErrorPattern("create .*", errors.New("mock.create.like.error"))
+		_, err = client.FetchAll("create table test.t5 like test.t1", -1)
+		assert.NotNil(t, err)
+		_, err = route.TableConfig("test", "t5")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestProxyDDLCreateTableSelect(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.g1(id int, name varchar(10)) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// The rows are routed to the segments of the new table.
+	{
+		qr, err := client.FetchAll("create table test.t2(id int, name varchar(10)) partition by hash(id) as select id, name from test.g1", -1)
+		assert.Nil(t, err)
+		assert.True(t, qr.RowsAffected > 0)
+		tconf, err := route.TableConfig("test", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, "id", tconf.ShardKey)
+
+		// Exists.
+		_, err = client.FetchAll("create table if not exists test.t2(id int, name varchar(10)) partition by hash(id) select id, name from test.g1", -1)
+		assert.Nil(t, err)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"create table test.t3 as select id, name from test.g1",
+			"create table test.t3(id int, name varchar(10)) partition by hash(id) select id, name from test.xx",
+		}
+		wants := []string{
+			"You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, unsupported: create.table.select.needs.the.column.definitions:syntax error at position 22 (errno 1149) (sqlstate 42000)",
+			"Table 'xx' doesn't exist (errno 1146) (sqlstate 42S02)",
+		}
+		for i, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, wants[i], err.Error(), query)
+			}
+		}
+		// The table is dropped if the select fails.
+		_, err = route.TableConfig("test", "t3")
+		assert.NotNil(t, err)
+
+		// The table is dropped if the insert fails.
+		fakedbs.AddQueryErrorPattern("insert .*", errors.New("mock.insert.error"))
+		_, err = client.FetchAll("create table test.t4(id int, name varchar(10)) partition by hash(id) select id, name from test.g1", -1)
+		assert.NotNil(t, err)
+		_, err = route.TableConfig("test", "t4")
+		assert.NotNil(t, err)
+	}
+}
+
 func TestProxyMyLoaderImport(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	fakedbs, proxy, cleanup := MockProxy(log)
@@ -1098,3 +1262,475 @@ func TestProxyDDLGlobalSingleNormal(t *testing.T) {
 		}
 	}
 }
+
+func TestProxyDDLNastyIdentifiers(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use `my-db`", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create database `my-db`", -1)
+		assert.Nil(t, err)
+		client.Close()
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "my-db", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// create table.
+	{
+		_, err := client.FetchAll("create table `order`(`select` int, `order` int, id int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+		want := "create table `my-db`.`order_0000` (\n\t`select` int,\n\t`order` int,\n\t`id` int\n) engine=InnoDB"
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(want))
+	}
+
+	// alter table.
+	{
+		_, err := client.FetchAll("alter table `my-db`.`order` add column(`table` int, `my-col` int)", -1)
+		assert.Nil(t, err)
+		want := "alter table `my-db`.`order_0029` add column(`table` int, `my-col` int)"
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(want))
+	}
+
+	// dml.
+	{
+		_, err := client.FetchAll("select `select`, `order` from `order` where id=1", -1)
+		assert.Nil(t, err)
+		want := "select `select`, `order` from `my-db`.order_0017 as `order` where id = 1"
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(want))
+	}
+
+	// drop table.
+	{
+		_, err := client.FetchAll("drop table `order`", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("drop table `my-db`.`order_0000`"))
+	}
+}
+
+func TestProxyDDLCreateTableList(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Router()
+
+	showCreate := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "table", Type: querypb.Type_VARCHAR},
+			{Name: "create table", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `t1_0000` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB")),
+			},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		fakedbs.AddQuery("show create table `test`.`t1_0000`", showCreate)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by list(id) (partition backend1 values in (1, 3), partition backend0 values in (2, 'x'))",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	tconf, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "LIST", tconf.ShardType)
+	assert.Equal(t, "id", tconf.ShardKey)
+	assert.Equal(t, 2, len(tconf.Partitions))
+	assert.Equal(t, "backend1", tconf.Partitions[0].Backend)
+	assert.Equal(t, []string{"2", "x"}, tconf.Partitions[1].ListValues)
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create table `test`.`t1_0000` (\n\t`id` int,\n\t`b` int\n) engine=InnoDB"))
+
+	// The rows are routed by the lists.
+	{
+		_, err := client.FetchAll("insert into test.t1(id, b) values(3, 1), ('X', 2)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("insert into test.t1_0000(id, b) values (3, 1)"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("insert into test.t1_0001(id, b) values ('X', 2)"))
+
+		_, err = client.FetchAll("select * from test.t1 where id=1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("select * from test.t1_0000 as t1 where id = 1"))
+	}
+
+	// Show create table.
+	{
+		qr, err := client.FetchAll("show create table test.t1", -1)
+		assert.Nil(t, err)
+		want := "CREATE TABLE `t1` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB\nPARTITION BY LIST(`id`) (\nPARTITION `backend1` VALUES IN (1,3),\nPARTITION `backend0` VALUES IN (2,'x')\n)"
+		assert.Equal(t, want, qr.Rows[0][1].String())
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"insert into test.t1(id, b) values(5, 1)",
+			"create table test.t2(id int, b int) partition by list(id) (partition backend9 values in (1))",
+			"create table test.t2(id int, b int) partition by list(id) (partition backend1 values in (1), partition backend0 values in ('01'))",
+			"create table test.t2(id int, b int) partition by list(c) (partition backend1 values in (1))",
+			"create table test.t2(id int, b int) partition by list(id) (partition backend1 values in (a))",
+		}
+		wants := []string{
+			"list.table[t1].has.no.partition.for.value[5] (errno 1105) (sqlstate HY000)",
+			"router.compute.list.partition.backend[backend9].can.not.be.found (errno 1105) (sqlstate HY000)",
+			"router.compute.list.value[1].duplicate (errno 1105) (sqlstate HY000)",
+			"Sharding Key column 'c' doesn't exist in table (errno 1105) (sqlstate HY000)",
+			"You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, create.table.partition.by.list.syntax.error.near[a] (errno 1149) (sqlstate 42000)",
+		}
+		for i, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, wants[i], err.Error(), query)
+			}
+		}
+		_, err = route.TableConfig("test", "t2")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestProxyDDLCreateTableCHash(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Router()
+
+	showCreate := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "table", Type: querypb.Type_VARCHAR},
+			{Name: "create table", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `t1_0000` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB")),
+			},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQuery("show create table `test`.`t1_0000`", showCreate)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by chash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	tconf, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "CHASH", tconf.ShardType)
+	assert.Equal(t, "id", tconf.ShardKey)
+	assert.Equal(t, 30, len(tconf.Partitions))
+	assert.Equal(t, 64, len(tconf.Partitions[0].Ring))
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create table `test`.`t1_0000` (\n\t`id` int,\n\t`b` int\n) engine=InnoDB"))
+
+	// The row is routed by the ring.
+	{
+		segments, err := route.Lookup("test", "t1", sqlparser.NewIntVal([]byte("1")), sqlparser.NewIntVal([]byte("1")))
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("insert into test.%s(id, b) values (1, 1)", segments[0].Table)))
+	}
+
+	// Show create table.
+	{
+		qr, err := client.FetchAll("show create table test.t1", -1)
+		assert.Nil(t, err)
+		want := "CREATE TABLE `t1` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB\nPARTITION BY CHASH(`id`) PARTITIONS 30"
+		assert.Equal(t, want, qr.Rows[0][1].String())
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"create table test.t2(id int, b int) partition by chash(c)",
+			"create table test.t2(id int, b int) partition by chash(1)",
+		}
+		wants := []string{
+			"Sharding Key column 'c' doesn't exist in table (errno 1105) (sqlstate HY000)",
+			"You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, create.table.partition.by.chash.syntax.error.near[1] (errno 1149) (sqlstate 42000)",
+		}
+		for i, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, wants[i], err.Error(), query)
+			}
+		}
+		_, err = route.TableConfig("test", "t2")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestProxyDDLCreateTablePartitions(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id) partitions 7",
+		"create table test.t2(id int, b int) partition by chash(id) partitions 12",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	t1, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "HASH", t1.ShardType)
+	assert.Equal(t, "id", t1.ShardKey)
+	assert.Equal(t, 7, len(t1.Partitions))
+	assert.Equal(t, "0-585", t1.Partitions[0].Segment)
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create table `test`.`t1_0006` (\n\t`id` int,\n\t`b` int\n) engine=InnoDB"))
+	t2, err := route.TableConfig("test", "t2")
+	assert.Nil(t, err)
+	assert.Equal(t, "CHASH", t2.ShardType)
+	assert.Equal(t, 12, len(t2.Partitions))
+
+	// Errors.
+	{
+		querys := []string{
+			"create table test.t3(id int, b int) partition by hash(id) partitions 2",
+			"create table test.t3(id int, b int) partition by hash(id) partitions x",
+		}
+		wants := []string{
+			"router.compute.partitions[2].out.of.range:[min:5, max:4096] (errno 1105) (sqlstate HY000)",
+			"You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, create.table.partition.by.hash.syntax.error.near[x] (errno 1149) (sqlstate 42000)",
+		}
+		for i, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, wants[i], err.Error(), query)
+			}
+		}
+	}
+}
+
+func TestProxyDDLCreateTableOptions(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"create table test.t1(a bigint auto_increment, b int) engine=innodb auto_increment=1000 default charset=utf8 partition by hash(b)",
+			"create table `test`.`t1_0000` (\n\t`a` bigint auto_increment,\n\t`b` int\n) engine=innodb default charset=utf8 auto_increment=1000",
+		},
+		{
+			"create table test.t2(a int, b int) ROW_FORMAT=COMPRESSED KEY_BLOCK_SIZE=8 COMMENT='the t2' partition by hash(a)",
+			"create table `test`.`t2_0000` (\n\t`a` int,\n\t`b` int\n) engine=InnoDB ROW_FORMAT=COMPRESSED KEY_BLOCK_SIZE=8 COMMENT='the t2'",
+		},
+		{
+			"create table test.t3(a int, b int) engine=tokudb default charset=utf8mb4 collate=utf8mb4_bin global",
+			"create table `test`.`t3` (\n\t`a` int,\n\t`b` int\n) engine=tokudb default charset=utf8mb4 collate=utf8mb4_bin",
+		},
+		{
+			"create table test.t4(a int, b int) comment='the t4' partition by list(a) (partition backend1 values in (1))",
+			"create table `test`.`t4_0000` (\n\t`a` int,\n\t`b` int\n) engine=InnoDB comment='the t4'",
+		},
+	}
+	for _, test := range tests {
+		_, err := client.FetchAll(test.query, -1)
+		assert.Nil(t, err, test.query)
+		assert.True(t, fakedbs.GetQueryCalledNum(test.want) > 0, test.want)
+	}
+
+	// The AUTO_INCREMENT is the start of the auto increment column.
+	tconf, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, &config.AutoIncrement{Column: "a", Start: 1000}, tconf.AutoIncrement)
+
+	// Errors.
+	{
+		_, err := client.FetchAll("create table test.t5(a int, b int) auto_increment='x' partition by hash(a)", -1)
+		assert.Equal(t, "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, syntax error at position 54 near 'x' (errno 1149) (sqlstate 42000)", err.Error())
+	}
+}
+
+func TestProxyDDLComment(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("alter .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(a int comment 'the a', b int) comment='the t1' partition by hash(a)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create table `test`.`t1_0000` (\n\t`a` int comment 'the a',\n\t`b` int\n) engine=InnoDB comment='the t1'"))
+
+	// The column comment.
+	{
+		_, err := client.FetchAll("alter table test.t1 modify column b int comment 'the b'", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("alter table `test`.`t1_0000` modify column b int comment 'the b'"))
+	}
+
+	// The table comment.
+	{
+		_, err := client.FetchAll("alter table test.t1 comment='the orders'", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("alter table `test`.`t1_0000` comment='the orders'"))
+	}
+
+	// The other alters are still denied.
+	{
+		_, err := client.FetchAll("alter table test.t1 comment='x', rename index a to b", -1)
+		assert.Equal(t, "Access denied; you don't have the privilege for alter operation (errno 1227) (sqlstate 42000)", err.Error())
+	}
+}
+
+func TestProxyDDLCreateTableSingle(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.s1(id int, b int) single",
+		"create table test.s2(id int, b int) engine=innodb comment='the s2' single distributed by (backend3)",
+		"create table test.s3(id int, b int) distributed by (`backend2`)",
+		"create table test.s5(id int, b int) single on 'backend4'",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create table `test`.`s2` (\n\t`id` int,\n\t`b` int\n) engine=innodb comment='the s2'"))
+
+	tests := []struct {
+		table   string
+		backend string
+	}{
+		{"s1", "backend0"},
+		{"s2", "backend3"},
+		{"s3", "backend2"},
+		{"s5", "backend4"},
+	}
+	for _, test := range tests {
+		tconf, err := route.TableConfig("test", test.table)
+		assert.Nil(t, err)
+		assert.Equal(t, "SINGLE", tconf.ShardType)
+		assert.Equal(t, 1, len(tconf.Partitions))
+		assert.Equal(t, test.backend, tconf.Partitions[0].Backend)
+	}
+
+	// The DML is routed to the backend.
+	{
+		for _, query := range []string{"explain insert into test.s2(id, b) values(1, 2)", "explain select * from test.s2 where b=1"} {
+			qr, err := client.FetchAll(query, -1)
+			assert.Nil(t, err)
+			assert.Contains(t, qr.Rows[0][0].String(), `"Backend": "backend3"`, query)
+		}
+	}
+
+	// Errors.
+	{
+		_, err := client.FetchAll("create table test.s4(id int) distributed by (backend9)", -1)
+		assert.Equal(t, "create.table.distributed.by.backend[backend9].not.exists (errno 1105) (sqlstate HY000)", err.Error())
+		_, err = client.FetchAll("create table test.s4(id int) distributed by (backend1, backend2)", -1)
+		assert.NotNil(t, err)
+		_, err = client.FetchAll("create table test.s4(id int) single on 'backend9'", -1)
+		assert.Equal(t, "create.table.distributed.by.backend[backend9].not.exists (errno 1105) (sqlstate HY000)", err.Error())
+		_, err = route.TableConfig("test", "s4")
+		assert.NotNil(t, err)
+	}
+}
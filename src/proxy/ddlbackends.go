@@ -0,0 +1,177 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"planner"
+	"xbase"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	// maxDDLLogRecords is the max records kept in the DDL log.
+	maxDDLLogRecords = 100
+)
+
+var (
+	// ddlHintRegexp matches the hint comments in the DDL, the parser drops the comments of the DDL.
+	ddlHintRegexp = regexp.MustCompile(`(?s)/\*\+.*?\*/`)
+)
+
+// DDLLogRecord tuple, the DDL executed on the backends chosen by the radon_backends hint.
+type DDLLogRecord struct {
+	Start    string             `json:"start"`
+	Cost     string             `json:"cost"`
+	User     string             `json:"user"`
+	Database string             `json:"database"`
+	Query    string             `json:"query"`
+	Status   string             `json:"status"`
+	Backends []*DDLBatchBackend `json:"backends"`
+}
+
+// DDLLog keeps the latest maxDDLLogRecords records of the targeted DDLs in memory.
+type DDLLog struct {
+	mu      sync.Mutex
+	records []*DDLLogRecord
+}
+
+// NewDDLLog creates the new DDLLog.
+func NewDDLLog() *DDLLog {
+	return &DDLLog{}
+}
+
+// Add used to add the record, the oldest one is dropped if the log is full.
+func (l *DDLLog) Add(record *DDLLogRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, record)
+	if len(l.records) > maxDDLLogRecords {
+		l.records = l.records[len(l.records)-maxDDLLogRecords:]
+	}
+}
+
+// Records returns the records, the latest first.
+func (l *DDLLog) Records() []*DDLLogRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := make([]*DDLLogRecord, len(l.records))
+	for i, record := range l.records {
+		records[len(l.records)-1-i] = record
+	}
+	return records
+}
+
+// DDLLog returns the log of the targeted DDLs.
+func (spanner *Spanner) DDLLog() *DDLLog {
+	return spanner.ddlLog
+}
+
+// ddlHints returns the radon hints of the DDL and the query without them.
+func ddlHints(query string) (*planner.Hints, string) {
+	hints := &planner.Hints{}
+	query = ddlHintRegexp.ReplaceAllStringFunc(query, func(comment string) string {
+		h, rest := planner.ParseHints(sqlparser.Comments{[]byte(comment)})
+		hints.Backends = append(hints.Backends, h.Backends...)
+		if len(rest) == 0 {
+			return ""
+		}
+		return string(rest[0])
+	})
+	return hints, strings.TrimSpace(query)
+}
+
+// handleDDLOnBackends used to execute the DDL on the segments of the table on the backends only, it's the emergency fix of
+// the segments drifted from the others, such as the index missing on one backend. The DDL needs the super privilege and
+// it's recorded in the DDL log whether it succeeds or not, the router is not changed.
+func (spanner *Spanner) handleDDLOnBackends(session *driver.Session, database string, query string, node *sqlparser.DDL, backends []string) (*sqltypes.Result, error) {
+	log := spanner.log
+	route := spanner.router
+
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; lacking super privilege for the operation")
+	}
+
+	switch node.Action {
+	case sqlparser.CreateIndexStr, sqlparser.DropIndexStr,
+		sqlparser.AlterEngineStr, sqlparser.AlterCharsetStr,
+		sqlparser.AlterAddColumnStr, sqlparser.AlterDropColumnStr, sqlparser.AlterModifyColumnStr:
+	default:
+		return nil, xbase.NewRadonError(xbase.ER_RADON_UNSUPPORTED_SQL, "Unsupported radon_backends hint on %s: only the ALTER TABLE and CREATE/DROP INDEX can be executed on the backends, the router is not changed", node.Action)
+	}
+	if !checkDatabaseExists(database, route) {
+		return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+	}
+	table := node.Table.Name.String()
+	if !checkTableExists(database, table, route) {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+	}
+	txSession := spanner.sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
+	}
+
+	plan := planner.NewDDLPlan(log, database, query, node, route)
+	if err := plan.Build(); err != nil {
+		return nil, err
+	}
+	pools := spanner.scatter.PoolClone()
+	var querys []xcontext.QueryTuple
+	for _, backend := range backends {
+		if _, ok := pools[backend]; !ok {
+			return nil, errors.Errorf("backend[%s].can.not.be.found", backend)
+		}
+		n := len(querys)
+		for _, tuple := range plan.Querys {
+			if tuple.Backend == backend {
+				querys = append(querys, tuple)
+			}
+		}
+		if len(querys) == n {
+			return nil, errors.Errorf("table[%s.%s].has.no.segment.on.backend[%s]", database, table, backend)
+		}
+	}
+
+	start := time.Now()
+	stmt := &ddlBatchStatement{query: query, node: node, database: database, table: table, querys: querys}
+	result := spanner.executeDDLBatch([]*ddlBatchStatement{stmt})[0]
+	spanner.ddlLog.Add(&DDLLogRecord{
+		Start:    start.Format("2006-01-02 15:04:05"),
+		Cost:     time.Since(start).String(),
+		User:     session.User(),
+		Database: database,
+		Query:    query,
+		Status:   result.Status,
+		Backends: result.Backends,
+	})
+	log.Warning("spanner.ddl[%s].on.backends%v.by.user[%s].status:%s", query, backends, session.User(), result.Status)
+
+	if result.Status != DDLBatchApplied {
+		var errs []string
+		for _, b := range result.Backends {
+			if b.Error != "" {
+				errs = append(errs, fmt.Sprintf("%s: %s", b.Backend, b.Error))
+			}
+		}
+		return nil, errors.Errorf("spanner.ddl.on.backends.%s: %s", result.Status, strings.Join(errs, "; "))
+	}
+	return &sqltypes.Result{}, nil
+}
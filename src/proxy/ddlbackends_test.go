@@ -0,0 +1,127 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyDDLOnBackends(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	tconf, err := proxy.Router().TableConfig("test", "t1")
+	assert.Nil(t, err)
+	backend := tconf.Partitions[0].Backend
+	alter := func(segment string) string {
+		return fmt.Sprintf("alter table `test`.`%s` add column(c int)", segment)
+	}
+
+	// The segments on the backend only.
+	{
+		_, err = client.FetchAll(fmt.Sprintf("alter table test.t1 add column(c int) /*+ radon_backends(%s) */", backend), -1)
+		assert.Nil(t, err)
+		for _, part := range tconf.Partitions {
+			want := 0
+			if part.Backend == backend {
+				want = 1
+			}
+			assert.Equal(t, want, fakedbs.GetQueryCalledNum(alter(part.Table)), part.Table)
+		}
+
+		records := proxy.Spanner().DDLLog().Records()
+		assert.Equal(t, 1, len(records))
+		assert.Equal(t, "mock", records[0].User)
+		assert.Equal(t, "test", records[0].Database)
+		assert.Equal(t, "alter table test.t1 add column(c int)", records[0].Query)
+		assert.Equal(t, DDLBatchApplied, records[0].Status)
+		assert.Equal(t, 1, len(records[0].Backends))
+		assert.Equal(t, backend, records[0].Backends[0].Backend)
+	}
+
+	// The failed one is recorded.
+	{
+		fakedbs.AddQueryErrorPattern("alter table .*", errors.New("mock.alter.error"))
+		_, err = client.FetchAll(fmt.Sprintf("alter table test.t1 /*+ radon_backends(%s) */ add column(c int)", backend), -1)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "mock.alter.error")
+		records := proxy.Spanner().DDLLog().Records()
+		assert.Equal(t, 2, len(records))
+		assert.Equal(t, DDLBatchFailed, records[0].Status)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"alter table test.t1 add column(c int) /*+ radon_backends(xx) */",
+			"create table test.t2(id int, b int) partition by hash(id) /*+ radon_backends(backend0) */",
+			"alter table test.xx add column(c int) /*+ radon_backends(backend0) */",
+		}
+		wants := []string{
+			"backend[xx].can.not.be.found (errno 1105) (sqlstate HY000)",
+			"Unsupported radon_backends hint on create table: only the ALTER TABLE and CREATE/DROP INDEX can be executed on the backends, the router is not changed (errno 9003) (sqlstate HY000)",
+			"Table 'xx' doesn't exist (errno 1146) (sqlstate 42S02)",
+		}
+		for i, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.Equal(t, wants[i], err.Error(), query)
+		}
+	}
+}
+
+func TestProxyDDLOnBackendsPrivilege(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxyPrivilegeNotSuper(log, MockDefaultConfig())
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+	route := proxy.Spanner().router
+	route.CreateDatabase("test")
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("alter table t1 add column(c int) /*+ radon_backends(backend0) */", -1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Access denied; lacking super privilege for the operation")
+}
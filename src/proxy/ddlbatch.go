@@ -0,0 +1,468 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"executor"
+	"planner"
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+const (
+	// DDLBatchApplied is the status of the statement applied on all its backends.
+	DDLBatchApplied = "applied"
+	// DDLBatchFailed is the status of the statement failed on one of its backends.
+	DDLBatchFailed = "failed"
+	// DDLBatchSkipped is the status of the statement not executed since the earlier statement failed on its backends.
+	DDLBatchSkipped = "skipped"
+)
+
+// DDLBatchBackend is the result of the statement on one backend.
+type DDLBatchBackend struct {
+	Backend string `json:"backend"`
+	Querys  int    `json:"querys"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DDLBatchStatement is the result of one statement of the batch.
+type DDLBatchStatement struct {
+	Query    string             `json:"query"`
+	Status   string             `json:"status"`
+	Backends []*DDLBatchBackend `json:"backends"`
+}
+
+// DDLBatchReport is the combined report of the batch.
+type DDLBatchReport struct {
+	Applied    int                  `json:"applied"`
+	Failed     int                  `json:"failed"`
+	Skipped    int                  `json:"skipped"`
+	Cost       string               `json:"cost"`
+	Statements []*DDLBatchStatement `json:"statements"`
+}
+
+// ddlBatchStatement is the planned statement of the batch.
+type ddlBatchStatement struct {
+	query    string
+	node     *sqlparser.DDL
+	database string
+	table    string
+	// create is the table to be created with its options.
+	create *createTableSpec
+	// querys are the rewritten querys on the backends.
+	querys []xcontext.QueryTuple
+}
+
+// ddlBatchPlanner used to validate and plan the statements of the batch in order, the databases and tables
+// created and dropped by the earlier statements are tracked so the later statements can refer to them.
+type ddlBatchPlanner struct {
+	spanner  *Spanner
+	user     string
+	database string
+	tables   map[string]map[string]bool
+	// previews are the routers of the tables created in the batch, key is db.table.
+	previews map[string]*router.Router
+}
+
+// ApplyDDLBatch used to validate the whole batch of the DDLs first, then apply them on the backends.
+// Each backend executes its querys of the batch in order in one session, and stops at the first error
+// since the later statements may depend on it, the backends are applied in parallel.
+// The router is changed in the statement order after the backends are done: the tables of the applied CREATE TABLE
+// are added, and the tables of the executed DROP TABLE are removed even it failed as the DROP TABLE query does.
+// The querys failed since they have been applied, such as the segments created by the last failed batch, are applied.
+// Only the CREATE/DROP DATABASE, CREATE/DROP TABLE, CREATE/DROP INDEX, ALTER TABLE and TRUNCATE TABLE are supported,
+// the DDLs are not transactional, the statements applied before the failure are not rolled back.
+func (spanner *Spanner) ApplyDDLBatch(user string, database string, querys []string) (*DDLBatchReport, error) {
+	log := spanner.log
+	start := time.Now()
+
+	if len(querys) == 0 {
+		return nil, errors.New("spanner.ddl.batch.querys.is.empty")
+	}
+	stmts, err := spanner.planDDLBatch(user, database, querys)
+	if err != nil {
+		log.Error("spanner.ddl.batch.plan.error:%+v", err)
+		return nil, err
+	}
+
+	results := spanner.executeDDLBatch(stmts)
+	report := &DDLBatchReport{}
+	for i, stmt := range stmts {
+		result := results[i]
+		switch result.Status {
+		case DDLBatchApplied:
+			report.Applied++
+		case DDLBatchFailed:
+			report.Failed++
+		case DDLBatchSkipped:
+			report.Skipped++
+		}
+		report.Statements = append(report.Statements, result)
+		if result.Status != DDLBatchSkipped {
+			spanner.applyDDLBatchRouter(stmt, result.Status == DDLBatchApplied)
+		}
+	}
+	report.Cost = time.Since(start).String()
+	log.Warning("spanner.ddl.batch.statements[%d].applied[%d].failed[%d].skipped[%d].cost[%s]", len(stmts), report.Applied, report.Failed, report.Skipped, report.Cost)
+	return report, nil
+}
+
+// planDDLBatch used to validate and plan all the statements, nothing is applied if one of them is invalid.
+func (spanner *Spanner) planDDLBatch(user string, database string, querys []string) ([]*ddlBatchStatement, error) {
+	p := &ddlBatchPlanner{
+		spanner:  spanner,
+		user:     user,
+		database: database,
+		tables:   make(map[string]map[string]bool),
+		previews: make(map[string]*router.Router),
+	}
+	for db, tables := range spanner.router.Tables() {
+		p.tables[db] = make(map[string]bool)
+		for _, table := range tables {
+			p.tables[db][table] = true
+		}
+	}
+
+	var stmts []*ddlBatchStatement
+	for i, query := range querys {
+		planned, err := p.plan(query)
+		if err != nil {
+			return nil, errors.Errorf("spanner.ddl.batch.statement[%d].query[%s].error:%v", i, query, err)
+		}
+		stmts = append(stmts, planned...)
+	}
+	return stmts, nil
+}
+
+// plan returns the planned statements of the query, the DROP TABLE of multiple tables is planned one statement per table.
+func (p *ddlBatchPlanner) plan(query string) ([]*ddlBatchStatement, error) {
+	spanner := p.spanner
+	route := spanner.router
+
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		var ddl *sqlparser.DDL
+		if ddl, err = parseCreateTable(query, err); err != nil {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+		}
+		node = ddl
+	}
+	ddl, ok := node.(*sqlparser.DDL)
+	if !ok {
+		return nil, errors.New("only.the.ddl.is.allowed")
+	}
+
+	database := p.database
+	if !ddl.Database.IsEmpty() {
+		database = ddl.Database.String()
+	}
+	if ddl.Action != sqlparser.DropTableStr && !ddl.Table.Qualifier.IsEmpty() {
+		database = ddl.Table.Qualifier.String()
+	}
+	if database == "" {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+	}
+	check := func(db string) error {
+		if err := route.DatabaseACL(db); err != nil {
+			return err
+		}
+		return spanner.plugins.PlugPrivilege().Check(db, p.user, ddl)
+	}
+	if err := check(database); err != nil {
+		return nil, err
+	}
+	if err := spanner.checkReshardDDL(database, ddl); err != nil {
+		return nil, err
+	}
+
+	stmt := &ddlBatchStatement{query: query, node: ddl, database: database}
+	switch ddl.Action {
+	case sqlparser.CreateDBStr:
+		if _, ok := p.tables[database]; ok {
+			if ddl.IfNotExists {
+				return []*ddlBatchStatement{stmt}, nil
+			}
+			return nil, sqldb.NewSQLError(sqldb.ER_DB_CREATE_EXISTS, database)
+		}
+		p.tables[database] = make(map[string]bool)
+		stmt.querys = p.scatterQuerys(query)
+		return []*ddlBatchStatement{stmt}, nil
+	case sqlparser.DropDBStr:
+		if _, ok := p.tables[database]; !ok {
+			if ddl.IfExists {
+				return []*ddlBatchStatement{stmt}, nil
+			}
+			return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+		}
+		delete(p.tables, database)
+		stmt.querys = p.scatterQuerys(query)
+		return []*ddlBatchStatement{stmt}, nil
+	case sqlparser.CreateTableStr:
+		table := ddl.Table.Name.String()
+		tables, ok := p.tables[database]
+		if !ok {
+			return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+		}
+		if tables[table] {
+			if ddl.IfNotExists {
+				return []*ddlBatchStatement{stmt}, nil
+			}
+			return nil, sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, table)
+		}
+		// The LIKE reads the definition of the table and the AS SELECT inserts the rows, neither is a plain DDL.
+		if planner.IsCreateTableLike(query) || planner.IsCreateTableSelect(query) {
+			return nil, errors.New("unsupported: create.table.like.or.as.select.in.batch")
+		}
+		spec, err := planCreateTable(query, ddl, spanner.scatter.Backends())
+		if err != nil {
+			return nil, err
+		}
+		preview, err := route.PreviewTable(database, table, spec.shardKey, spec.tableType, spec.backends, spec.extra)
+		if err != nil {
+			return nil, err
+		}
+		stmt.table = table
+		stmt.query = spec.create
+		stmt.create = spec
+		if stmt.querys, err = p.tableQuerys(preview, database, stmt.query, ddl); err != nil {
+			return nil, err
+		}
+		tables[table] = true
+		p.previews[database+"."+table] = preview
+		return []*ddlBatchStatement{stmt}, nil
+	case sqlparser.DropTableStr:
+		var stmts []*ddlBatchStatement
+		for _, tableIdent := range ddl.Tables {
+			db := database
+			table := tableIdent.Name.String()
+			query := fmt.Sprintf("drop table %s", sqlparser.Backtick(table))
+			if !tableIdent.Qualifier.IsEmpty() {
+				db = tableIdent.Qualifier.String()
+				query = fmt.Sprintf("drop table %s.%s", sqlparser.Backtick(db), sqlparser.Backtick(table))
+				if err := check(db); err != nil {
+					return nil, err
+				}
+			}
+			tables, ok := p.tables[db]
+			if !ok {
+				return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+			}
+			if !tables[table] {
+				if ddl.IfExists {
+					continue
+				}
+				return nil, sqldb.NewSQLError1(sqldb.ER_BAD_TABLE_ERROR, "42S02", "Unknown table '%s'", table)
+			}
+			single := *ddl
+			single.Table = tableIdent
+			drop := &ddlBatchStatement{query: query, node: &single, database: db, table: table}
+			var err error
+			if drop.querys, err = p.tableQuerys(p.router(db, table), db, query, &single); err != nil {
+				return nil, err
+			}
+			delete(tables, table)
+			stmts = append(stmts, drop)
+		}
+		if len(stmts) == 0 {
+			return []*ddlBatchStatement{stmt}, nil
+		}
+		return stmts, nil
+	case sqlparser.CreateIndexStr, sqlparser.DropIndexStr,
+		sqlparser.AlterEngineStr, sqlparser.AlterCharsetStr,
+		sqlparser.AlterAddColumnStr, sqlparser.AlterDropColumnStr, sqlparser.AlterModifyColumnStr,
+		sqlparser.TruncateTableStr:
+		table := ddl.Table.Name.String()
+		tables, ok := p.tables[database]
+		if !ok {
+			return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+		}
+		if !tables[table] {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+		}
+		stmt.table = table
+		var err error
+		if stmt.querys, err = p.tableQuerys(p.router(database, table), database, query, ddl); err != nil {
+			return nil, err
+		}
+		return []*ddlBatchStatement{stmt}, nil
+	default:
+		return nil, errors.Errorf("unsupported.ddl[%v].in.batch", ddl.Action)
+	}
+}
+
+// router returns the preview router if the table is created in the batch.
+func (p *ddlBatchPlanner) router(database string, table string) *router.Router {
+	if preview, ok := p.previews[database+"."+table]; ok {
+		return preview
+	}
+	return p.spanner.router
+}
+
+func (p *ddlBatchPlanner) scatterQuerys(query string) []xcontext.QueryTuple {
+	var querys []xcontext.QueryTuple
+	for _, backend := range p.spanner.scatter.AllBackends() {
+		querys = append(querys, xcontext.QueryTuple{Query: query, Backend: backend})
+	}
+	return querys
+}
+
+func (p *ddlBatchPlanner) tableQuerys(route *router.Router, database string, query string, node *sqlparser.DDL) ([]xcontext.QueryTuple, error) {
+	plan := planner.NewDDLPlan(p.spanner.log, database, query, node, route)
+	if err := plan.Build(); err != nil {
+		return nil, err
+	}
+	return plan.Querys, nil
+}
+
+// executeDDLBatch used to execute the querys of the statements on the backends, one session per backend,
+// and returns the results of the statements.
+func (spanner *Spanner) executeDDLBatch(stmts []*ddlBatchStatement) []*DDLBatchStatement {
+	log := spanner.log
+	timeout := spanner.conf.Proxy.DDLTimeout
+	pools := spanner.scatter.PoolClone()
+
+	// The querys of the backends in the statement order.
+	type backendQuery struct {
+		stmt   int
+		query  string
+		action string
+	}
+	byBackend := make(map[string][]backendQuery)
+	for i, stmt := range stmts {
+		for _, tuple := range stmt.querys {
+			byBackend[tuple.Backend] = append(byBackend[tuple.Backend], backendQuery{stmt: i, query: tuple.Query, action: stmt.node.Action})
+		}
+	}
+
+	// errs[backend][stmt] is the error of the statement on the backend, the skipped statements are absent.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]map[int]error)
+	executed := make(map[string]map[int]int)
+	for backend, querys := range byBackend {
+		errs[backend] = make(map[int]error)
+		executed[backend] = make(map[int]int)
+		wg.Add(1)
+		go func(backend string, querys []backendQuery) {
+			defer wg.Done()
+			record := func(stmt int, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs[backend][stmt] = err
+					return
+				}
+				executed[backend][stmt]++
+			}
+
+			pool, ok := pools[backend]
+			if !ok {
+				record(querys[0].stmt, errors.Errorf("spanner.ddl.batch.can.not.find.backend[%s]", backend))
+				return
+			}
+			conn, err := pool.Get()
+			if err != nil {
+				record(querys[0].stmt, err)
+				return
+			}
+			for _, q := range querys {
+				if _, err := conn.ExecuteWithLimits(q.query, timeout, 0); err != nil && !executor.DDLApplied(q.action, err) {
+					log.Error("spanner.ddl.batch.execute[%s].on[%s].error:%+v", q.query, backend, err)
+					record(q.stmt, err)
+					conn.Close()
+					return
+				}
+				record(q.stmt, nil)
+			}
+			conn.Recycle()
+		}(backend, querys)
+	}
+	wg.Wait()
+
+	var backends []string
+	for backend := range byBackend {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends)
+
+	results := make([]*DDLBatchStatement, len(stmts))
+	for i, stmt := range stmts {
+		result := &DDLBatchStatement{Query: stmt.query, Status: DDLBatchApplied, Backends: []*DDLBatchBackend{}}
+		counts := make(map[string]int)
+		for _, tuple := range stmt.querys {
+			counts[tuple.Backend]++
+		}
+		skipped := 0
+		for _, backend := range backends {
+			if counts[backend] == 0 {
+				continue
+			}
+			b := &DDLBatchBackend{Backend: backend, Querys: executed[backend][i]}
+			if err, ok := errs[backend][i]; ok {
+				b.Error = err.Error()
+				result.Status = DDLBatchFailed
+			} else if b.Querys < counts[backend] {
+				b.Error = DDLBatchSkipped
+				skipped++
+			}
+			result.Backends = append(result.Backends, b)
+		}
+		if result.Status == DDLBatchApplied && skipped > 0 {
+			result.Status = DDLBatchFailed
+			if skipped == len(result.Backends) {
+				result.Status = DDLBatchSkipped
+			}
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// applyDDLBatchRouter used to change the router for the executed statement as the single DDL does.
+func (spanner *Spanner) applyDDLBatchRouter(stmt *ddlBatchStatement, applied bool) {
+	log := spanner.log
+	route := spanner.router
+
+	switch stmt.node.Action {
+	case sqlparser.CreateDBStr:
+		if applied && len(stmt.querys) > 0 {
+			if err := route.CreateDatabase(stmt.database); err != nil {
+				log.Error("spanner.ddl.batch.router.create.database[%s].error:%+v", stmt.database, err)
+			}
+		}
+	case sqlparser.DropDBStr:
+		if applied && len(stmt.querys) > 0 {
+			if err := route.DropDatabase(stmt.database); err != nil {
+				log.Error("spanner.ddl.batch.router.drop.database[%s].error:%+v", stmt.database, err)
+			}
+		}
+	case sqlparser.CreateTableStr:
+		if applied && stmt.create != nil {
+			create := stmt.create
+			if err := route.CreateTable(stmt.database, stmt.table, create.shardKey, create.tableType, create.backends, create.extra); err != nil {
+				log.Error("spanner.ddl.batch.router.create.table[%s.%s].error:%+v", stmt.database, stmt.table, err)
+			}
+		}
+	case sqlparser.DropTableStr:
+		if stmt.table != "" {
+			if err := route.DropTable(stmt.database, stmt.table); err != nil {
+				log.Error("spanner.ddl.batch.router.drop.table[%s.%s].error:%+v", stmt.database, stmt.table, err)
+			}
+		}
+	}
+}
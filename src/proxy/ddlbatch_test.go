@@ -0,0 +1,210 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyDDLBatch(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("alter .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+	}
+
+	// Apply.
+	{
+		querys := []string{
+			"create database test",
+			"create table t1(id int, b int) partition by hash(id)",
+			"alter table t1 add column(c int)",
+			"create index idx_b on t1(b)",
+			"create table t2(id int) global",
+			"create table if not exists t2(id int) global",
+			"drop table t2",
+		}
+		report, err := spanner.ApplyDDLBatch("mock", "test", querys)
+		assert.Nil(t, err)
+		assert.Equal(t, 7, report.Applied)
+		assert.Equal(t, 0, report.Failed)
+		assert.Equal(t, 0, report.Skipped)
+
+		// The create table is rewritten.
+		assert.Equal(t, "create table t1 (\n\t`id` int,\n\t`b` int\n) engine=InnoDB", report.Statements[1].Query)
+		// The segments on one backend.
+		querys1 := 0
+		for _, backend := range report.Statements[2].Backends {
+			assert.Equal(t, "", backend.Error)
+			querys1 += backend.Querys
+		}
+		segments, err := route.Lookup("test", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, len(segments), querys1)
+		assert.Equal(t, 0, len(report.Statements[5].Backends))
+		assert.Equal(t, []string{"t1"}, route.Tables()["test"])
+	}
+
+	// Failed and skipped.
+	{
+		fakedbs.AddQueryErrorPattern("alter table .* add column\\(d .*", errors.New("mock.alter.error"))
+		querys := []string{
+			"create table t3(id int) global",
+			"alter table t3 add column(d int)",
+			"alter table t3 add column(e int)",
+			"create table t4(id int) global",
+		}
+		report, err := spanner.ApplyDDLBatch("mock", "test", querys)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Applied)
+		assert.Equal(t, 1, report.Failed)
+		assert.Equal(t, 2, report.Skipped)
+		assert.Equal(t, DDLBatchFailed, report.Statements[1].Status)
+		assert.Contains(t, report.Statements[1].Backends[0].Error, "mock.alter.error")
+		assert.Equal(t, DDLBatchSkipped, report.Statements[2].Backends[0].Error)
+		assert.Equal(t, DDLBatchSkipped, report.Statements[3].Status)
+
+		tables := route.Tables()["test"]
+		assert.Equal(t, 2, len(tables))
+		assert.Contains(t, tables, "t3")
+	}
+
+	// The CREATE TABLE is planned as the single DDL.
+	{
+		querys := []string{
+			"create table t6(id int, b int) comment='the t6' partition by hash(id) partitions 8",
+			"create table t7(id int, b int) partition by list(id) (partition backend1 values in (1, 3))",
+			"create table t8(id int, b int) partition by chash(id) partitions 12",
+			"create table t9(id int, b int) single on 'backend2'",
+		}
+		report, err := spanner.ApplyDDLBatch("mock", "test", querys)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, report.Applied)
+		assert.Equal(t, "create table t6 (\n\t`id` int,\n\t`b` int\n) engine=InnoDB comment='the t6'", report.Statements[0].Query)
+
+		tests := []struct {
+			table     string
+			tableType string
+			segments  int
+		}{
+			{"t6", "HASH", 8},
+			{"t7", "LIST", 1},
+			{"t8", "CHASH", 12},
+			{"t9", "SINGLE", 1},
+		}
+		for _, test := range tests {
+			tconf, err := route.TableConfig("test", test.table)
+			assert.Nil(t, err)
+			assert.Equal(t, test.tableType, tconf.ShardType, test.table)
+			assert.Equal(t, test.segments, len(tconf.Partitions), test.table)
+		}
+		tconf, err := route.TableConfig("test", "t9")
+		assert.Nil(t, err)
+		assert.Equal(t, "backend2", tconf.Partitions[0].Backend)
+	}
+
+	// The segments already created are applied.
+	{
+		fakedbs.AddQueryErrorPattern("create table .*t5.*", sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, "t5"))
+		report, err := spanner.ApplyDDLBatch("mock", "test", []string{"create table t5(id int) global"})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, report.Applied)
+		assert.Contains(t, route.Tables()["test"], "t5")
+	}
+}
+
+func TestProxyDDLBatchError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	report, err := spanner.ApplyDDLBatch("mock", "test", []string{"create database test"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Applied)
+
+	tests := []struct {
+		querys []string
+		want   string
+	}{
+		{
+			querys: []string{},
+			want:   "spanner.ddl.batch.querys.is.empty",
+		},
+		{
+			querys: []string{"create table t1(id int) global", "select * from t1"},
+			want:   "spanner.ddl.batch.statement[1].query[select * from t1].error:only.the.ddl.is.allowed",
+		},
+		{
+			querys: []string{"create table t1(id int) global", "alter table t2 add column(c int)"},
+			want:   "spanner.ddl.batch.statement[1].query[alter table t2 add column(c int)].error:Table 't2' doesn't exist (errno 1146) (sqlstate 42S02)",
+		},
+		{
+			querys: []string{"create table t1(id int) global", "create table t1(id int) global"},
+			want:   "spanner.ddl.batch.statement[1].query[create table t1(id int) global].error:Table 't1' already exists (errno 1050) (sqlstate 42S01)",
+		},
+		{
+			querys: []string{"create table t1(id int) global", "drop table t1", "drop table t1"},
+			want:   "spanner.ddl.batch.statement[2].query[drop table t1].error:Unknown table 't1' (errno 1051) (sqlstate 42S02)",
+		},
+		{
+			querys: []string{"create table t1(id int) global", "alter table t1 rename to t2"},
+			want:   "spanner.ddl.batch.statement[1].query[alter table t1 rename to t2].error:unsupported.ddl[rename].in.batch",
+		},
+		{
+			querys: []string{"create table t1(id int, b int) partition by hash(id)", "alter table t1 drop column id"},
+			want:   "spanner.ddl.batch.statement[1].query[alter table t1 drop column id].error:unsupported: cannot.drop.the.column.on.shard.key",
+		},
+		{
+			querys: []string{"create table t1(id int) global", "create table t2 like t1"},
+			want:   "spanner.ddl.batch.statement[1].query[create table t2 like t1].error:unsupported: create.table.like.or.as.select.in.batch",
+		},
+		{
+			querys: []string{"create table t1(id int) global as select 1"},
+			want:   "spanner.ddl.batch.statement[0].query[create table t1(id int) global as select 1].error:unsupported: create.table.like.or.as.select.in.batch",
+		},
+		{
+			querys: []string{"create table t1(id int) single on 'backend9'"},
+			want:   "spanner.ddl.batch.statement[0].query[create table t1(id int) single on 'backend9'].error:create.table.distributed.by.backend[backend9].not.exists",
+		},
+		{
+			querys: []string{"create database mysql"},
+			want:   "spanner.ddl.batch.statement[0].query[create database mysql].error:Access denied; lacking privileges for database mysql (errno 1227) (sqlstate 42000)",
+		},
+		{
+			querys: []string{"create table xx.t1(id int) global"},
+			want:   "spanner.ddl.batch.statement[0].query[create table xx.t1(id int) global].error:Unknown database 'xx' (errno 1049) (sqlstate 42000)",
+		},
+	}
+	for _, test := range tests {
+		_, err := spanner.ApplyDDLBatch("mock", "test", test.querys)
+		assert.Equal(t, test.want, err.Error())
+	}
+	// Nothing is applied.
+	assert.Equal(t, 0, len(route.Tables()["test"]))
+}
@@ -0,0 +1,431 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"executor"
+	"planner"
+	"xbase"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// ddlJournalFile is the file of the journal in the DDLJournalDir.
+	ddlJournalFile = "ddl_journal.json"
+
+	// DDLJobRunning is the status of the job being executed.
+	DDLJobRunning = "running"
+	// DDLJobFailed is the status of the job failed on some segments.
+	DDLJobFailed = "failed"
+	// DDLJobInterrupted is the status of the job was running when radon crashed.
+	DDLJobInterrupted = "interrupted"
+
+	// DDLSegmentPending is the status of the segment not known to be applied.
+	DDLSegmentPending = "pending"
+	// DDLSegmentApplied is the status of the segment applied.
+	DDLSegmentApplied = "applied"
+	// DDLSegmentFailed is the status of the segment failed by the execution or the replay.
+	DDLSegmentFailed = "failed"
+)
+
+// DDLJobSegment is the DDL of the job on one segment.
+type DDLJobSegment struct {
+	Backend string `json:"backend"`
+	Query   string `json:"query"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DDLJob tuple, the scatter DDL journaled before the execution, it's removed from the journal once it's applied
+// on all the segments.
+type DDLJob struct {
+	ID       int64            `json:"id"`
+	Start    string           `json:"start"`
+	User     string           `json:"user"`
+	Database string           `json:"database"`
+	Table    string           `json:"table,omitempty"`
+	Action   string           `json:"action"`
+	Query    string           `json:"query"`
+	Status   string           `json:"status"`
+	Error    string           `json:"error,omitempty"`
+	Segments []*DDLJobSegment `json:"segments"`
+}
+
+func (job *DDLJob) clone() *DDLJob {
+	c := *job
+	c.Segments = make([]*DDLJobSegment, len(job.Segments))
+	for i, seg := range job.Segments {
+		s := *seg
+		c.Segments[i] = &s
+	}
+	return &c
+}
+
+// ddlJournalData is the content of the journal file.
+type ddlJournalData struct {
+	NextID int64     `json:"next-id"`
+	Jobs   []*DDLJob `json:"jobs"`
+}
+
+// DDLJournal tuple, the journal of the DDL jobs not finished. The file is rewritten atomically by every change,
+// so the job is durable before its DDL is executed and the status of the segments is kept by the replay.
+type DDLJournal struct {
+	log  *xlog.Log
+	mu   sync.Mutex
+	dir  string
+	file string
+	data ddlJournalData
+}
+
+// NewDDLJournal creates the new DDLJournal, the empty dir means disabled.
+func NewDDLJournal(log *xlog.Log, dir string) *DDLJournal {
+	j := &DDLJournal{
+		log:  log,
+		dir:  dir,
+		data: ddlJournalData{NextID: 1},
+	}
+	if dir != "" {
+		j.file = path.Join(dir, ddlJournalFile)
+	}
+	return j
+}
+
+// Init used to load the journal, the jobs were running are interrupted by the crash.
+func (j *DDLJournal) Init() error {
+	if j.file == "" {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := os.MkdirAll(j.dir, 0744); err != nil {
+		return errors.WithStack(err)
+	}
+	buf, err := ioutil.ReadFile(j.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	if err := json.Unmarshal(buf, &j.data); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, job := range j.data.Jobs {
+		if job.Status == DDLJobRunning {
+			job.Status = DDLJobInterrupted
+			j.log.Warning("spanner.ddl.journal.job[%d:%s].interrupted", job.ID, job.Query)
+		}
+	}
+	return j.flush()
+}
+
+// flush used to write the journal to the tmp file and rename it to the journal file.
+func (j *DDLJournal) flush() error {
+	buf, err := json.MarshalIndent(&j.data, "", "\t")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := j.file + ".tmp"
+	if err := xbase.WriteFile(tmp, buf); err != nil {
+		return err
+	}
+	return errors.WithStack(os.Rename(tmp, j.file))
+}
+
+// Begin used to journal the job before it's executed, the DDL must not be executed if it fails.
+// The job is nil if the journal is disabled.
+func (j *DDLJournal) Begin(user string, database string, table string, action string, query string, querys []xcontext.QueryTuple) (*DDLJob, error) {
+	if j.file == "" {
+		return nil, nil
+	}
+	job := &DDLJob{
+		Start:    time.Now().Format("2006-01-02 15:04:05"),
+		User:     user,
+		Database: database,
+		Table:    table,
+		Action:   action,
+		Query:    query,
+		Status:   DDLJobRunning,
+	}
+	for _, tuple := range querys {
+		job.Segments = append(job.Segments, &DDLJobSegment{Backend: tuple.Backend, Query: tuple.Query, Status: DDLSegmentPending})
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job.ID = j.data.NextID
+	j.data.NextID++
+	j.data.Jobs = append(j.data.Jobs, job)
+	if err := j.flush(); err != nil {
+		j.data.Jobs = j.data.Jobs[:len(j.data.Jobs)-1]
+		j.log.Error("spanner.ddl.journal.begin[%s].error:%+v", query, err)
+		return nil, errors.Wrap(err, "spanner.ddl.journal.begin.error")
+	}
+	return job, nil
+}
+
+// Finish used to remove the job applied, or mark it failed with the err.
+func (j *DDLJournal) Finish(job *DDLJob, err error) {
+	if job == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err == nil {
+		j.remove(job.ID)
+	} else {
+		job.Status, job.Error = DDLJobFailed, err.Error()
+	}
+	if err := j.flush(); err != nil {
+		j.log.Error("spanner.ddl.journal.finish.job[%d].error:%+v", job.ID, err)
+	}
+}
+
+// Done used to journal the status of the segment once its DDL is executed, so the replay skips the segments applied.
+// The segment is matched by the backend and the query, the DDL applied already on it is taken as applied.
+func (j *DDLJournal) Done(job *DDLJob, backend string, query string, err error) {
+	if job == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, seg := range job.Segments {
+		if seg.Backend != backend || seg.Query != query || seg.Status == DDLSegmentApplied {
+			continue
+		}
+		seg.Status, seg.Error = DDLSegmentApplied, ""
+		if err != nil && !executor.DDLApplied(job.Action, err) {
+			seg.Status, seg.Error = DDLSegmentFailed, err.Error()
+		}
+		if err := j.flush(); err != nil {
+			j.log.Error("spanner.ddl.journal.job[%d].segment[%s].on[%s].error:%+v", job.ID, query, backend, err)
+		}
+		return
+	}
+}
+
+// Jobs returns the copies of the jobs not finished, the oldest first.
+func (j *DDLJournal) Jobs() []*DDLJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]*DDLJob, 0, len(j.data.Jobs))
+	for _, job := range j.data.Jobs {
+		jobs = append(jobs, job.clone())
+	}
+	return jobs
+}
+
+// Discard used to remove the job from the journal without replaying it.
+func (j *DDLJournal) Discard(id int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, err := j.get(id)
+	if err != nil {
+		return err
+	}
+	j.remove(job.ID)
+	j.log.Warning("spanner.ddl.journal.job[%d:%s].discarded", job.ID, job.Query)
+	return j.flush()
+}
+
+// acquire used to mark the job not running as running for the replay.
+func (j *DDLJournal) acquire(id int64) (*DDLJob, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, err := j.get(id)
+	if err != nil {
+		return nil, err
+	}
+	status := job.Status
+	job.Status = DDLJobRunning
+	if err := j.flush(); err != nil {
+		job.Status = status
+		return nil, err
+	}
+	return job, nil
+}
+
+// update used to change the jobs under the lock and flush them.
+func (j *DDLJournal) update(fn func()) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn()
+	return j.flush()
+}
+
+func (j *DDLJournal) get(id int64) (*DDLJob, error) {
+	for _, job := range j.data.Jobs {
+		if job.ID == id {
+			if job.Status == DDLJobRunning {
+				return nil, errors.Errorf("spanner.ddl.journal.job[%d].is.running", id)
+			}
+			return job, nil
+		}
+	}
+	return nil, errors.Errorf("spanner.ddl.journal.job[%d].can.not.be.found", id)
+}
+
+func (j *DDLJournal) remove(id int64) {
+	for i, job := range j.data.Jobs {
+		if job.ID == id {
+			j.data.Jobs = append(j.data.Jobs[:i], j.data.Jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// DDLJournal returns the journal of the DDL jobs not finished.
+func (spanner *Spanner) DDLJournal() *DDLJournal {
+	return spanner.ddlJournal
+}
+
+// beginDDLJob used to journal the DDL on the segments of the table planned by the DDL plan.
+func (spanner *Spanner) beginDDLJob(user string, database string, query string, node sqlparser.Statement) (*DDLJob, error) {
+	ddl, ok := node.(*sqlparser.DDL)
+	if !ok || spanner.ddlJournal.file == "" {
+		return nil, nil
+	}
+	plan := planner.NewDDLPlan(spanner.log, database, query, ddl, spanner.router)
+	// The error is returned by the execution.
+	if err := plan.Build(); err != nil {
+		return nil, nil
+	}
+	if !ddl.Table.Qualifier.IsEmpty() {
+		database = ddl.Table.Qualifier.String()
+	}
+	return spanner.ddlJournal.Begin(user, database, ddl.Table.Name.String(), ddl.Action, query, plan.Querys)
+}
+
+// ddlJobDone returns the query done fn of the txn executing the DDL of the job, nil if the job is nil.
+func (spanner *Spanner) ddlJobDone(job *DDLJob) func(backend string, query string, err error) {
+	if job == nil {
+		return nil
+	}
+	return func(backend string, query string, err error) {
+		spanner.ddlJournal.Done(job, backend, query, err)
+	}
+}
+
+// executeScatterDDLJob used to execute the database DDL of the job on all the backends as the ExecuteScatter,
+// the status of each backend is journaled.
+func (spanner *Spanner) executeScatterDDLJob(job *DDLJob, query string) (*sqltypes.Result, error) {
+	txn, err := spanner.scatter.CreateTransaction()
+	if err != nil {
+		spanner.log.Error("spanner.execute.scatter.txn.create.error:[%v]", err)
+		return nil, err
+	}
+	defer txn.Finish()
+	txn.SetQueryDone(spanner.ddlJobDone(job))
+	return txn.ExecuteScatter(query)
+}
+
+// beginScatterDDLJob used to journal the database DDL executed on all the backends.
+func (spanner *Spanner) beginScatterDDLJob(user string, database string, action string, query string) (*DDLJob, error) {
+	var querys []xcontext.QueryTuple
+	for _, backend := range spanner.scatter.Backends() {
+		querys = append(querys, xcontext.QueryTuple{Backend: backend, Query: query})
+	}
+	return spanner.ddlJournal.Begin(user, database, "", action, query, querys)
+}
+
+// ReplayDDLJob used to roll the interrupted or failed job forward. The segments not applied are executed one by one
+// and their status are journaled, the DDL applied already on the segment such as the table exists is taken as applied.
+// The router is changed as the DDL does after all the segments are applied, then the job is removed from the journal.
+func (spanner *Spanner) ReplayDDLJob(id int64) error {
+	log := spanner.log
+	route := spanner.router
+	journal := spanner.ddlJournal
+
+	job, err := journal.acquire(id)
+	if err != nil {
+		return err
+	}
+	log.Warning("spanner.ddl.journal.replay.job[%d:%s]...", job.ID, job.Query)
+	fail := func(err error) error {
+		log.Error("spanner.ddl.journal.replay.job[%d:%s].error:%+v", job.ID, job.Query, err)
+		if xerr := journal.update(func() { job.Status, job.Error = DDLJobFailed, err.Error() }); xerr != nil {
+			log.Error("spanner.ddl.journal.replay.job[%d].flush.error:%+v", job.ID, xerr)
+		}
+		return err
+	}
+
+	switch job.Action {
+	case sqlparser.CreateDBStr:
+		if !checkDatabaseExists(job.Database, route) {
+			if err := route.CreateDatabase(job.Database); err != nil {
+				return fail(err)
+			}
+		}
+	case sqlparser.DropDBStr, sqlparser.DropTableStr:
+	default:
+		// The table of the CREATE TABLE failed has been dropped from the router, the job should be discarded.
+		if !checkTableExists(job.Database, job.Table, route) {
+			return fail(errors.Errorf("spanner.ddl.journal.job[%d].table[%s.%s].can.not.be.found.in.router.please.discard.it", job.ID, job.Database, job.Table))
+		}
+	}
+
+	for _, seg := range job.Segments {
+		if seg.Status == DDLSegmentApplied {
+			continue
+		}
+		status, msg := DDLSegmentApplied, ""
+		if _, err := spanner.ExecuteOnThisBackend(seg.Backend, seg.Query); err != nil && !executor.DDLApplied(job.Action, err) {
+			status, msg = DDLSegmentFailed, err.Error()
+		}
+		if err := journal.update(func() { seg.Status, seg.Error = status, msg }); err != nil {
+			return fail(err)
+		}
+		if status == DDLSegmentFailed {
+			return fail(errors.Errorf("spanner.ddl.journal.job[%d].segment[%s].on[%s].error:%s", job.ID, seg.Query, seg.Backend, msg))
+		}
+	}
+
+	switch job.Action {
+	case sqlparser.DropDBStr:
+		if checkDatabaseExists(job.Database, route) {
+			if err := route.DropDatabase(job.Database); err != nil {
+				return fail(err)
+			}
+		}
+	case sqlparser.DropTableStr:
+		if checkTableExists(job.Database, job.Table, route) {
+			if err := route.DropTable(job.Database, job.Table); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	journal.Finish(job, nil)
+	log.Warning("spanner.ddl.journal.replay.job[%d:%s].done", job.ID, job.Query)
+	return nil
+}
+
+// replayDDLJournal used to replay the interrupted jobs at startup.
+func (spanner *Spanner) replayDDLJournal() {
+	for _, job := range spanner.ddlJournal.Jobs() {
+		if job.Status != DDLJobInterrupted {
+			continue
+		}
+		if err := spanner.ReplayDDLJob(job.ID); err != nil {
+			spanner.log.Error("spanner.ddl.journal.startup.replay.job[%d].error:%+v", job.ID, err)
+		}
+	}
+}
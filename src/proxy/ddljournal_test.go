@@ -0,0 +1,218 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyDDLJournal(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	for _, query := range []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.t2(id int, b int) partition by hash(id)",
+	} {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	tconf, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	segments := len(tconf.Partitions)
+
+	// The jobs applied are removed.
+	assert.Equal(t, 0, len(spanner.DDLJournal().Jobs()))
+
+	// restart used to reload the journal as radon restarts.
+	restart := func() {
+		journal := NewDDLJournal(log, spanner.conf.Proxy.DDLJournalDir)
+		assert.Nil(t, journal.Init())
+		spanner.ddlJournal = journal
+	}
+
+	// The failed job is replayed.
+	{
+		fakedbs.AddQueryErrorPattern("alter table .*", errors.New("mock.alter.error"))
+		_, err := client.FetchAll("alter table test.t1 add column(c int)", -1)
+		assert.NotNil(t, err)
+
+		jobs := spanner.DDLJournal().Jobs()
+		assert.Equal(t, 1, len(jobs))
+		job := jobs[0]
+		assert.Equal(t, DDLJobFailed, job.Status)
+		assert.Equal(t, "mock", job.User)
+		assert.Equal(t, "test", job.Database)
+		assert.Equal(t, "t1", job.Table)
+		assert.Equal(t, sqlparser.AlterAddColumnStr, job.Action)
+		assert.Equal(t, segments, len(job.Segments))
+
+		// Still failed.
+		err = spanner.ReplayDDLJob(job.ID)
+		assert.NotNil(t, err)
+		job = spanner.DDLJournal().Jobs()[0]
+		assert.Equal(t, DDLJobFailed, job.Status)
+		assert.Equal(t, DDLSegmentFailed, job.Segments[0].Status)
+
+		fakedbs.ResetPatternErrors()
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+		err = spanner.ReplayDDLJob(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(spanner.DDLJournal().Jobs()))
+		for _, part := range tconf.Partitions {
+			query := fmt.Sprintf("alter table `test`.`%s` add column(c int)", part.Table)
+			assert.True(t, fakedbs.GetQueryCalledNum(query) > 0, query)
+		}
+	}
+
+	// The segments applied by the execution are journaled and skipped by the replay.
+	{
+		fakedbs.AddQueryPattern("alter table .* add column\\(e int\\)", &sqltypes.Result{})
+		failed := fmt.Sprintf("alter table `test`.`%s` add column(e int)", tconf.Partitions[0].Table)
+		fakedbs.AddQueryError(failed, errors.New("mock.alter.error"))
+		_, err := client.FetchAll("alter table test.t1 add column(e int)", -1)
+		assert.NotNil(t, err)
+
+		jobs := spanner.DDLJournal().Jobs()
+		assert.Equal(t, 1, len(jobs))
+		job := jobs[0]
+		// The segments after the failed one on the same backend are not executed.
+		for _, seg := range job.Segments {
+			if seg.Query == failed {
+				assert.Equal(t, DDLSegmentFailed, seg.Status)
+				assert.Contains(t, seg.Error, "mock.alter.error")
+			} else {
+				assert.NotEqual(t, DDLSegmentFailed, seg.Status, seg.Query)
+			}
+		}
+
+		called := make(map[string]int)
+		for _, seg := range job.Segments {
+			called[seg.Query] = fakedbs.GetQueryCalledNum(seg.Query)
+		}
+		fakedbs.AddQuery(failed, &sqltypes.Result{})
+		err = spanner.ReplayDDLJob(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(spanner.DDLJournal().Jobs()))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(failed))
+		for _, seg := range job.Segments {
+			switch {
+			case seg.Query == failed:
+			case seg.Status == DDLSegmentApplied:
+				assert.Equal(t, called[seg.Query], fakedbs.GetQueryCalledNum(seg.Query), seg.Query)
+			default:
+				assert.Equal(t, called[seg.Query]+1, fakedbs.GetQueryCalledNum(seg.Query), seg.Query)
+			}
+		}
+	}
+
+	// The interrupted DROP TABLE is rolled forward at startup.
+	{
+		query := "drop table test.t2"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		// The DROP TABLE is executed table by table.
+		ddl := node.(*sqlparser.DDL)
+		ddl.Table = ddl.Tables[0]
+		job, err := spanner.beginDDLJob("mock", "test", query, ddl)
+		assert.Nil(t, err)
+		assert.Equal(t, DDLJobRunning, job.Status)
+
+		// The running job can't be replayed or discarded.
+		assert.NotNil(t, spanner.ReplayDDLJob(job.ID))
+		assert.NotNil(t, spanner.DDLJournal().Discard(job.ID))
+
+		restart()
+		jobs := spanner.DDLJournal().Jobs()
+		assert.Equal(t, 1, len(jobs))
+		assert.Equal(t, DDLJobInterrupted, jobs[0].Status)
+		assert.True(t, checkTableExists("test", "t2", route))
+
+		spanner.replayDDLJournal()
+		assert.Equal(t, 0, len(spanner.DDLJournal().Jobs()))
+		assert.False(t, checkTableExists("test", "t2", route))
+		restart()
+		assert.Equal(t, 0, len(spanner.DDLJournal().Jobs()))
+	}
+
+	// The interrupted CREATE DATABASE is rolled forward by the replay.
+	{
+		query := "create database test2"
+		job, err := spanner.beginScatterDDLJob("mock", "test2", sqlparser.CreateDBStr, query)
+		assert.Nil(t, err)
+		assert.Equal(t, len(spanner.scatter.Backends()), len(job.Segments))
+		restart()
+
+		err = spanner.ReplayDDLJob(job.ID)
+		assert.Nil(t, err)
+		assert.True(t, checkDatabaseExists("test2", route))
+		assert.Equal(t, len(job.Segments), fakedbs.GetQueryCalledNum(query))
+	}
+
+	// The table of the job isn't in the router.
+	{
+		query := "alter table test.t1 add column(d int)"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		job, err := spanner.beginDDLJob("mock", "test", query, node)
+		assert.Nil(t, err)
+		restart()
+		assert.Nil(t, route.DropTable("test", "t1"))
+
+		err = spanner.ReplayDDLJob(job.ID)
+		assert.NotNil(t, err)
+		jobs := spanner.DDLJournal().Jobs()
+		assert.Equal(t, 1, len(jobs))
+		assert.Equal(t, DDLJobFailed, jobs[0].Status)
+
+		assert.Nil(t, spanner.DDLJournal().Discard(job.ID))
+		assert.Equal(t, 0, len(spanner.DDLJournal().Jobs()))
+	}
+
+	// Unknown job.
+	{
+		err := spanner.ReplayDDLJob(100)
+		assert.Equal(t, "spanner.ddl.journal.job[100].can.not.be.found", err.Error())
+		err = spanner.DDLJournal().Discard(100)
+		assert.Equal(t, "spanner.ddl.journal.job[100].can.not.be.found", err.Error())
+	}
+}
+
+func TestProxyDDLJournalDisabled(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	journal := NewDDLJournal(log, "")
+	assert.Nil(t, journal.Init())
+	job, err := journal.Begin("mock", "test", "t1", sqlparser.AlterAddColumnStr, "alter table t1 add column(c int)", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+	journal.Finish(job, nil)
+	assert.Equal(t, 0, len(journal.Jobs()))
+}
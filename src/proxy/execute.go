@@ -9,6 +9,9 @@
 package proxy
 
 import (
+	"strconv"
+	"time"
+
 	"executor"
 	"optimizer"
 	"planner"
@@ -16,25 +19,36 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
 // ExecuteMultiStmtsInTxn used to execute multiple statements in the transaction.
-func (spanner *Spanner) ExecuteMultiStmtsInTxn(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+func (spanner *Spanner) ExecuteMultiStmtsInTxn(session *driver.Session, database string, query string, node sqlparser.Statement) (qr *sqltypes.Result, err error) {
 	log := spanner.log
-	router := spanner.router
 	sessions := spanner.sessions
 	txSession := sessions.getTxnSession(session)
 
 	sessions.MultiStmtTxnBinding(session, nil, node, query)
+	ctx, cancel := sessions.QueryContext(session)
+	defer cancel()
+
+	// The stats of the transaction are accumulated by the statements, only the ones of this statement are logged.
+	txn := txSession.transaction
+	if spanner.access != nil {
+		txn.SetAnalyze(true)
+		defer func(start time.Time, tables []string, offset int) {
+			spanner.accessLog(session, database, query, tables, txn.ExecStats().Stats[offset:], start, err)
+		}(time.Now(), accessTables(database, node), len(txn.ExecStats().Stats))
+	}
 
-	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	plans, err := spanner.buildPlanTree(ctx, session, database, query, node)
 	if err != nil {
 		return nil, err
 	}
-	executors := executor.NewTree(log, plans, txSession.transaction)
-	qr, err := executors.Execute()
+	executors := executor.NewTree(log, plans, txn)
+	qr, err = executors.ExecuteContext(ctx)
 	if err != nil {
 		// need the user to rollback
 		return nil, err
@@ -45,10 +59,9 @@ func (spanner *Spanner) ExecuteMultiStmtsInTxn(session *driver.Session, database
 }
 
 // ExecuteSingleStmtTxnTwoPC used to execute single statement transaction with 2pc commit.
-func (spanner *Spanner) ExecuteSingleStmtTxnTwoPC(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+func (spanner *Spanner) ExecuteSingleStmtTxnTwoPC(session *driver.Session, database string, query string, node sqlparser.Statement) (qr *sqltypes.Result, err error) {
 	log := spanner.log
 	conf := spanner.conf
-	router := spanner.router
 	scatter := spanner.scatter
 	sessions := spanner.sessions
 
@@ -62,13 +75,26 @@ func (spanner *Spanner) ExecuteSingleStmtTxnTwoPC(session *driver.Session, datab
 
 	// txn limits.
 	txn.SetTimeout(conf.Proxy.QueryTimeout)
-	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetMaxResult(spanner.maxResultSize(session.User(), node))
+	txn.SetMaxResultRows(spanner.maxResultRows(session.User()))
 	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetMaxDMLRows(conf.Proxy.MaxDMLRows)
+	txn.SetQueryTag(spanner.queryTag(session.User(), session.ID()))
+	spanner.setAnalystLimits(session, txn)
+	if spanner.access != nil {
+		txn.SetAnalyze(true)
+		defer func(start time.Time, tables []string) {
+			spanner.accessLog(session, database, query, tables, txn.ExecStats().Stats, start, err)
+		}(time.Now(), accessTables(database, node))
+	}
 
 	// binding.
 	sessions.TxnBinding(session, txn, node, query)
 	defer sessions.TxnUnBinding(session)
 
+	ctx, cancel := sessions.QueryContext(session)
+	defer cancel()
+
 	// Transaction begin.
 	if err := txn.Begin(); err != nil {
 		log.Error("spanner.execute.2pc.txn.begin.error:[%v]", err)
@@ -76,13 +102,13 @@ func (spanner *Spanner) ExecuteSingleStmtTxnTwoPC(session *driver.Session, datab
 	}
 
 	// Transaction execute.
-	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	plans, err := spanner.buildPlanTree(ctx, session, database, query, node)
 	if err != nil {
 		return nil, err
 	}
 
 	executors := executor.NewTree(log, plans, txn)
-	qr, err := executors.Execute()
+	qr, err = executors.ExecuteContext(ctx)
 	if err != nil {
 		if x := txn.Rollback(); x != nil {
 			log.Error("spanner.execute.2pc.error.to.rollback.still.error:[%v]", x)
@@ -101,7 +127,18 @@ func (spanner *Spanner) ExecuteSingleStmtTxnTwoPC(session *driver.Session, datab
 // ExecuteNormal used to execute non-2pc querys to shards with QueryTimeout limits.
 func (spanner *Spanner) ExecuteNormal(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	timeout := spanner.conf.Proxy.QueryTimeout
-	return spanner.executeWithTimeout(session, database, query, node, timeout)
+	if key, ok := spanner.coalesceKey(session, database, node); ok {
+		ctx, cancel := spanner.sessions.QueryContext(session)
+		defer cancel()
+		var lastWrite time.Time
+		if txSession := spanner.sessions.getTxnSession(session); txSession != nil {
+			lastWrite = txSession.getLastWrite()
+		}
+		return spanner.coalescer.Do(ctx, key, spanner.sessions.now(), lastWrite, func() (*sqltypes.Result, error) {
+			return spanner.executeWithTimeout(session, database, query, node, timeout, nil)
+		})
+	}
+	return spanner.executeWithTimeout(session, database, query, node, timeout, nil)
 }
 
 // ExecuteDDL used to execute ddl querys to the shards with DDLTimeout limits, used for create/drop index long time operation.
@@ -114,17 +151,23 @@ func (spanner *Spanner) ExecuteDDL(session *driver.Session, database string, que
 		return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
 	}
 
-	return spanner.executeWithTimeout(session, database, query, node, timeout)
+	job, err := spanner.beginDDLJob(session.User(), database, query, node)
+	if err != nil {
+		return nil, err
+	}
+	qr, err := spanner.executeWithTimeout(session, database, query, node, timeout, job)
+	spanner.ddlJournal.Finish(job, err)
+	return qr, err
 }
 
 // ExecuteNormal used to execute non-2pc querys to shards with timeout limits.
 // timeout:
 //    0x01. if timeout <= 0, no limits.
 //    0x02. if timeout > 0, the query will be interrupted if the timeout(in millisecond) is exceeded.
-func (spanner *Spanner) executeWithTimeout(session *driver.Session, database string, query string, node sqlparser.Statement, timeout int) (*sqltypes.Result, error) {
+// The status of the segments of the DDL job is journaled as they are executed, the job is nil for the others.
+func (spanner *Spanner) executeWithTimeout(session *driver.Session, database string, query string, node sqlparser.Statement, timeout int, job *DDLJob) (qr *sqltypes.Result, err error) {
 	log := spanner.log
 	conf := spanner.conf
-	router := spanner.router
 	scatter := spanner.scatter
 	sessions := spanner.sessions
 
@@ -138,22 +181,46 @@ func (spanner *Spanner) executeWithTimeout(session *driver.Session, database str
 
 	// txn limits.
 	txn.SetTimeout(timeout)
-	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetMaxResult(spanner.maxResultSize(session.User(), node))
+	txn.SetMaxResultRows(spanner.maxResultRows(session.User()))
 	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetMaxDMLRows(conf.Proxy.MaxDMLRows)
+	txn.SetQueryTag(spanner.queryTag(session.User(), session.ID()))
+	txn.SetReplica(spanner.readReplica(session, database, node))
+	txn.SetConsistentRead(spanner.consistentRead(session, node))
+	watermark, err := spanner.readWatermark(session, node)
+	if err != nil {
+		return nil, err
+	}
+	txn.SetWatermark(watermark)
+	txn.SetQueryDone(spanner.ddlJobDone(job))
+	spanner.setAnalystLimits(session, txn)
+	if spanner.access != nil {
+		txn.SetAnalyze(true)
+		defer func(start time.Time, tables []string) {
+			spanner.accessLog(session, database, query, tables, txn.ExecStats().Stats, start, err)
+		}(time.Now(), accessTables(database, node))
+	}
 
 	// binding.
 	sessions.TxnBinding(session, txn, node, query)
 	defer sessions.TxnUnBinding(session)
+	ctx, cancel := sessions.QueryContext(session)
+	defer cancel()
 
-	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	start := time.Now()
+	plans, err := spanner.buildPlanTree(ctx, session, database, query, node)
 	if err != nil {
 		return nil, err
 	}
 	executors := executor.NewTree(log, plans, txn)
-	qr, err := executors.Execute()
+	qr, err = executors.ExecuteContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if spanner.advisor != nil {
+		spanner.advisor.Record(plans, time.Since(start))
+	}
 	return qr, nil
 }
 
@@ -164,6 +231,10 @@ func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database str
 	scatter := spanner.scatter
 	sessions := spanner.sessions
 
+	if err := spanner.subqueryRewrite(session, database, node); err != nil {
+		return err
+	}
+
 	// transaction.
 	txn, err := scatter.CreateTransaction()
 	if err != nil {
@@ -171,10 +242,20 @@ func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database str
 		return err
 	}
 	defer txn.Finish()
+	txn.SetQueryTag(spanner.queryTag(session.User(), session.ID()))
+	txn.SetReplica(spanner.readReplica(session, database, node))
+	txn.SetConsistentRead(spanner.consistentRead(session, node))
+	watermark, err := spanner.readWatermark(session, node)
+	if err != nil {
+		return err
+	}
+	txn.SetWatermark(watermark)
 
 	// binding.
 	sessions.TxnBinding(session, txn, node, query)
 	defer sessions.TxnUnBinding(session)
+	ctx, cancel := sessions.QueryContext(session)
+	defer cancel()
 
 	selectNode, ok := node.(*sqlparser.Select)
 	if !ok {
@@ -190,6 +271,7 @@ func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database str
 		return errors.New("ExecuteStreamFetch.unsupport.cross-shard.join")
 	}
 	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Ctx = ctx
 	reqCtx.Mode = m.ReqMode
 	reqCtx.Querys = m.GetQuery()
 	reqCtx.RawQuery = plan.RawQuery
@@ -198,11 +280,33 @@ func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database str
 }
 
 // ExecuteDML used to execute some DML querys to shards.
-func (spanner *Spanner) ExecuteDML(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+func (spanner *Spanner) ExecuteDML(session *driver.Session, database string, query string, node sqlparser.Statement) (qr *sqltypes.Result, err error) {
 	privilegePlug := spanner.plugins.PlugPrivilege()
 	if err := privilegePlug.Check(session.Schema(), session.User(), node); err != nil {
 		return nil, err
 	}
+	if spanner.IsDMLWrite(node) {
+		defer func() {
+			if err == nil {
+				spanner.recordWrites(session, database, node)
+			}
+		}()
+	}
+	if err := spanner.subqueryRewrite(session, database, node); err != nil {
+		return nil, err
+	}
+	if qr, ok, err := spanner.executeReshardDML(session, database, query, node); ok {
+		return qr, err
+	}
+	if qr, ok, err := spanner.executeShardKeyValue(session, database, query, node); ok {
+		return qr, err
+	}
+	if err := spanner.lookupRewrite(session, database, query, node); err != nil {
+		return nil, err
+	}
+	if qr, ok, err := spanner.executeLookupDML(session, database, query, node); ok {
+		return qr, err
+	}
 
 	if spanner.isTwoPC() {
 		txSession := spanner.sessions.getTxnSession(session)
@@ -218,6 +322,182 @@ func (spanner *Spanner) ExecuteDML(session *driver.Session, database string, que
 	return spanner.ExecuteNormal(session, database, query, node)
 }
 
+// ExecuteReadOnly used to execute the SELECT/UNION query without the client session,
+// it's used by the non-mysql frontends.
+func (spanner *Spanner) ExecuteReadOnly(user string, database string, query string) (*sqltypes.Result, error) {
+	return spanner.ExecuteReadOnlyLimit(user, database, query, 0)
+}
+
+// ExecuteReadOnlyLimit used to execute the SELECT/UNION query as the ExecuteReadOnly does, at most limit rows are read,
+// the limit is pushed into the query LIMIT so the backends stop at it, 0 means no limits.
+func (spanner *Spanner) ExecuteReadOnlyLimit(user string, database string, query string, limit int) (*sqltypes.Result, error) {
+	log := spanner.log
+	conf := spanner.conf
+	router := spanner.router
+	scatter := spanner.scatter
+	throttle := spanner.throttle
+
+	throttle.Acquire()
+	defer throttle.Release()
+
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		log.Error("spanner.execute.readonly.query[%v].parser.error: %v", query, err)
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+	}
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if limit > 0 {
+			node.Limit = limitRowcount(node.Limit, limit)
+			query = sqlparser.String(node)
+		}
+	case *sqlparser.Union:
+		if limit > 0 {
+			node.Limit = limitRowcount(node.Limit, limit)
+			query = sqlparser.String(node)
+		}
+	default:
+		return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+	}
+
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if err := privilegePlug.Check(database, user, node); err != nil {
+		return nil, err
+	}
+
+	txn, err := scatter.CreateTransaction()
+	if err != nil {
+		log.Error("spanner.execute.readonly.txn.create.error:[%v]", err)
+		return nil, err
+	}
+	defer txn.Finish()
+
+	txn.SetTimeout(conf.Proxy.QueryTimeout)
+	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetMaxResultRows(spanner.maxResultRows(user))
+	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetMaxDMLRows(conf.Proxy.MaxDMLRows)
+	txn.SetQueryTag(spanner.queryTag(user, 0))
+
+	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	if err != nil {
+		return nil, err
+	}
+	return executor.NewTree(log, plans, txn).Execute()
+}
+
+// limitRowcount returns the LIMIT whose row count is at most the rows, the offset is kept.
+func limitRowcount(limit *sqlparser.Limit, rows int) *sqlparser.Limit {
+	rowcount := sqlparser.NewIntVal([]byte(strconv.Itoa(rows)))
+	if limit == nil {
+		return &sqlparser.Limit{Rowcount: rowcount}
+	}
+	if val, ok := limit.Rowcount.(*sqlparser.SQLVal); ok && val.Type == sqlparser.IntVal {
+		if n, err := strconv.ParseUint(string(val.Val), 10, 64); err == nil && n <= uint64(rows) {
+			return limit
+		}
+	}
+	return &sqlparser.Limit{Offset: limit.Offset, Rowcount: rowcount}
+}
+
+// ExecuteJob used to execute the querys of the scheduled job without the client session in one transaction,
+// the SELECT, UNION, INSERT, REPLACE, UPDATE and DELETE querys are supported.
+// The writes are in the 2pc transaction if the twopc is enabled.
+// The result is the last query's, the rows affected are summed.
+func (spanner *Spanner) ExecuteJob(user string, database string, querys ...string) (*sqltypes.Result, error) {
+	log := spanner.log
+	conf := spanner.conf
+	router := spanner.router
+	scatter := spanner.scatter
+	throttle := spanner.throttle
+
+	throttle.Acquire()
+	defer throttle.Release()
+
+	write := false
+	nodes := make([]sqlparser.Statement, len(querys))
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		if err != nil {
+			log.Error("spanner.execute.job.query[%v].parser.error: %v", query, err)
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+		}
+		switch node := node.(type) {
+		case *sqlparser.Select, *sqlparser.Union, *sqlparser.Update, *sqlparser.Delete:
+		case *sqlparser.Insert:
+			if err := spanner.plugins.PlugAutoIncrement().Process(database, node); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, sqldb.NewSQLError(sqldb.ER_NOT_SUPPORTED_YET, "the job query except SELECT, INSERT, REPLACE, UPDATE and DELETE")
+		}
+		if spanner.IsDMLWrite(node) {
+			if spanner.ReadOnly() {
+				return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+			}
+			// The lookup tables are written by the client sessions only.
+			if tb, ok := dmlTable(node); ok {
+				if db, tconf := spanner.lookupTableConfig(database, tb); tconf != nil {
+					return nil, errors.Errorf("unsupported: the.job.write.on.table[%s.%s].with.lookups", db, tconf.Name)
+				}
+			}
+			write = true
+		}
+
+		privilegePlug := spanner.plugins.PlugPrivilege()
+		if err := privilegePlug.Check(database, user, node); err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+
+	txn, err := scatter.CreateTransaction()
+	if err != nil {
+		log.Error("spanner.execute.job.txn.create.error:[%v]", err)
+		return nil, err
+	}
+	defer txn.Finish()
+
+	txn.SetTimeout(conf.Proxy.QueryTimeout)
+	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetMaxResultRows(spanner.maxResultRows(user))
+	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetMaxDMLRows(conf.Proxy.MaxDMLRows)
+	txn.SetQueryTag(spanner.queryTag(user, 0))
+
+	twopc := write && spanner.isTwoPC()
+	if twopc {
+		if err := txn.Begin(); err != nil {
+			log.Error("spanner.execute.job.2pc.txn.begin.error:[%v]", err)
+			return nil, err
+		}
+	}
+	qr := &sqltypes.Result{}
+	for i, node := range nodes {
+		rowsAffected := qr.RowsAffected
+		plans, err := optimizer.NewSimpleOptimizer(log, database, querys[i], node, router).BuildPlanTree()
+		if err == nil {
+			qr, err = executor.NewTree(log, plans, txn).Execute()
+		}
+		if err != nil {
+			if twopc {
+				if x := txn.Rollback(); x != nil {
+					log.Error("spanner.execute.job.2pc.error.to.rollback.still.error:[%v]", x)
+				}
+			}
+			return nil, err
+		}
+		qr.RowsAffected += rowsAffected
+	}
+	if twopc {
+		if err := txn.Commit(); err != nil {
+			log.Error("spanner.execute.job.2pc.txn.commit.error:[%v]", err)
+			return nil, err
+		}
+	}
+	return qr, nil
+}
+
 // ExecuteSingle used to execute query on one shard without planner.
 // The query must contain the database, such as db.table.
 func (spanner *Spanner) ExecuteSingle(query string) (*sqltypes.Result, error) {
@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -171,9 +172,9 @@ func TestProxyExecute2PCCommitError(t *testing.T) {
 		assert.Nil(t, err)
 		query := "insert into test.t1 (id, b) values(1,2),(3,4)"
 		_, err = client.FetchAll(query, -1)
-		want := "mock.xa.prepare.error (errno 1105) (sqlstate HY000)"
+		want := `^mock.xa.prepare.error \(backend:backend\d, phase:xa prepare\) \(errno 1105\) \(sqlstate HY000\)$`
 		got := err.Error()
-		assert.Equal(t, want, got)
+		assert.Regexp(t, want, got)
 	}
 
 	// Insert with 2PC but rollback error in the commit phase.
@@ -502,3 +503,80 @@ func TestProxyExecutPrivilegeN(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+func TestProxyExecuteReadOnlyFrontend(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .* limit 1", fakedb.Result1)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result3)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	spanner := proxy.Spanner()
+	// select.
+	{
+		qr, err := spanner.ExecuteReadOnly("mock", "test", "select * from t1 where id=1")
+		assert.Nil(t, err)
+		assert.Equal(t, len(fakedb.Result3.Rows), len(qr.Rows))
+	}
+
+	// select with the limit, the backends read at most the limit rows.
+	{
+		qr, err := spanner.ExecuteReadOnlyLimit("mock", "test", "select * from t1", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+	}
+
+	// write denied.
+	{
+		_, err := spanner.ExecuteReadOnly("mock", "test", "insert into t1(id, b) values(1, 1)")
+		want := "The MySQL server is running with the --read-only option so it cannot execute this statement (errno 1290) (sqlstate 42000)"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// syntax error.
+	{
+		_, err := spanner.ExecuteReadOnly("mock", "test", "select from")
+		assert.NotNil(t, err)
+	}
+}
+
+func TestProxyLimitRowcount(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"select * from t1", "select * from t1 limit 10"},
+		{"select * from t1 limit 5", "select * from t1 limit 5"},
+		{"select * from t1 limit 20", "select * from t1 limit 10"},
+		{"select * from t1 limit 3, 20", "select * from t1 limit 3, 10"},
+		{"select a from t1 union select a from t2", "select a from t1 union select a from t2 limit 10"},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err)
+		switch node := node.(type) {
+		case *sqlparser.Select:
+			node.Limit = limitRowcount(node.Limit, 10)
+		case *sqlparser.Union:
+			node.Limit = limitRowcount(node.Limit, 10)
+		}
+		assert.Equal(t, test.want, sqlparser.String(node))
+	}
+}
@@ -11,8 +11,15 @@ package proxy
 import (
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
+	"backend"
+	"executor"
 	"optimizer"
+	"planner"
+	"router"
+	"xcontext"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
@@ -22,6 +29,11 @@ import (
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
+var (
+	// explainFormatRegexp matches the EXPLAIN FORMAT=xx, the JSON format returns the versioned schema of planner.ExplainPlan.
+	explainFormatRegexp = regexp.MustCompile(`(?i)^\s*explain\s+format\s*=\s*(\w+)\s`)
+)
+
 // handleExplain used to handle the EXPLAIN command.
 func (spanner *Spanner) handleExplain(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	log := spanner.log
@@ -32,7 +44,21 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 		{Name: "EXPLAIN", Type: querypb.Type_VARCHAR},
 	}
 
+	analyze, dryrun, jsonFormat := false, false, false
 	pat := `(?i)explain`
+	if format := explainFormatRegexp.FindStringSubmatch(query); format != nil {
+		if !strings.EqualFold(format[1], "json") {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, fmt.Sprintf("explain format only supports JSON, not %s", format[1]))
+		}
+		pat = `(?i)explain\s+format\s*=\s*json`
+		jsonFormat = true
+	} else if regexp.MustCompile(`(?i)^\s*explain\s+analyze\s`).MatchString(query) {
+		pat = `(?i)explain\s+analyze`
+		analyze = true
+	} else if regexp.MustCompile(`(?i)^\s*explain\s+ddl\s`).MatchString(query) {
+		pat = `(?i)explain\s+ddl`
+		dryrun = true
+	}
 	reg := regexp.MustCompile(pat)
 	idx := reg.FindStringIndex(query)
 	if len(idx) != 2 {
@@ -40,6 +66,19 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 	}
 	cutQuery := query[idx[1]:]
 	subNode, err := sqlparser.Parse(cutQuery)
+	if err != nil && planner.IsMultiTableDML(strings.TrimSpace(cutQuery)) {
+		cutQuery = strings.TrimSpace(cutQuery)
+		if subNode, err = spanner.multiTableDMLNode(session, cutQuery); err != nil {
+			return nil, err
+		}
+	}
+	// The CREATE TABLE the parser doesn't support is planned as the DDL does.
+	if err != nil && dryrun {
+		var ddl *sqlparser.DDL
+		if ddl, err = parseCreateTable(strings.TrimSpace(cutQuery), err); err == nil {
+			subNode = ddl
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("query[%s].parser.error: %v", cutQuery, err)
 		row := []sqltypes.Value{
@@ -54,6 +93,23 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 		return nil, err
 	}
 
+	if analyze {
+		switch subNode.(type) {
+		case *sqlparser.Select, *sqlparser.Union:
+			return spanner.handleExplainAnalyze(session, cutQuery, subNode)
+		default:
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, "explain analyze only supports SELECT/UNION")
+		}
+	}
+
+	if dryrun {
+		ddl, ok := subNode.(*sqlparser.DDL)
+		if !ok {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, "explain ddl only supports DDL")
+		}
+		return spanner.handleExplainDDL(session, strings.TrimSpace(cutQuery), ddl)
+	}
+
 	// Explain only supports DML.
 	// see https://dev.mysql.com/doc/refman/5.7/en/explain.html
 	switch subNode.(type) {
@@ -85,6 +141,11 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 
 	if len(planTree.Plans()) > 0 {
 		msg := planTree.Plans()[0].JSON()
+		if jsonFormat {
+			if msg, err = planner.ExplainJSON(planTree.Plans()[0]); err != nil {
+				return nil, err
+			}
+		}
 		row := []sqltypes.Value{
 			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(msg)),
 		}
@@ -93,3 +154,197 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 	}
 	return qr, nil
 }
+
+// handleExplainAnalyze used to execute the query and returns the per-backend execution statistics.
+func (spanner *Spanner) handleExplainAnalyze(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	log := spanner.log
+	conf := spanner.conf
+	database := session.Schema()
+	router := spanner.router
+	scatter := spanner.scatter
+	sessions := spanner.sessions
+
+	// transaction.
+	txn, err := scatter.CreateTransaction()
+	if err != nil {
+		log.Error("spanner.txn.create.error:[%v]", err)
+		return nil, err
+	}
+	defer txn.Finish()
+
+	// txn limits.
+	txn.SetTimeout(conf.Proxy.QueryTimeout)
+	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetMaxResultRows(spanner.maxResultRows(session.User()))
+	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetMaxDMLRows(conf.Proxy.MaxDMLRows)
+	txn.SetQueryTag(spanner.queryTag(session.User(), session.ID()))
+	spanner.setAnalystLimits(session, txn)
+	txn.SetAnalyze(true)
+
+	// binding.
+	sessions.TxnBinding(session, txn, node, query)
+	defer sessions.TxnUnBinding(session)
+
+	start := time.Now()
+	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	if err != nil {
+		return nil, err
+	}
+	executors := executor.NewTree(log, plans, txn)
+	res, err := executors.Execute()
+	if err != nil {
+		return nil, err
+	}
+	cost := time.Since(start)
+
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Backend", Type: querypb.Type_VARCHAR},
+		{Name: "Query", Type: querypb.Type_VARCHAR},
+		{Name: "Time(ms)", Type: querypb.Type_VARCHAR},
+		{Name: "Rows", Type: querypb.Type_INT64},
+		{Name: "Bytes", Type: querypb.Type_INT64},
+	}
+	makeRow := func(backend string, query string, cost time.Duration, rows int, bytes int) []sqltypes.Value {
+		return []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(backend)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(query)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(fmt.Sprintf("%.3f", float64(cost)/float64(time.Millisecond)))),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", rows))),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", bytes))),
+		}
+	}
+
+	stats := txn.ExecStats()
+	for _, stat := range stats.Stats {
+		qr.Rows = append(qr.Rows, makeRow(stat.Backend, stat.Query, stat.Cost, stat.Rows, stat.Bytes))
+	}
+	// The proxy merge time is the total time minus the time spent on the backends.
+	merge := cost - stats.Cost
+	if merge < 0 {
+		merge = 0
+	}
+	qr.Rows = append(qr.Rows, makeRow("radon", "merge", merge, len(res.Rows), backend.ResultBytes(res)))
+	return qr, nil
+}
+
+// handleExplainDDL used to check the DDL and returns the per-backend querys without executing them.
+func (spanner *Spanner) handleExplainDDL(session *driver.Session, query string, ddl *sqlparser.DDL) (*sqltypes.Result, error) {
+	route := spanner.router
+	scatter := spanner.scatter
+
+	database := session.Schema()
+	if !ddl.Database.IsEmpty() {
+		database = ddl.Database.String()
+	}
+	if ddl.Action != sqlparser.DropTableStr && !ddl.Table.Qualifier.IsEmpty() {
+		database = ddl.Table.Qualifier.String()
+	}
+	if err := route.DatabaseACL(database); err != nil {
+		return nil, err
+	}
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if err := privilegePlug.Check(database, session.User(), ddl); err != nil {
+		return nil, err
+	}
+
+	var querys []xcontext.QueryTuple
+	switch ddl.Action {
+	case sqlparser.CreateDBStr, sqlparser.DropDBStr:
+		exists := checkDatabaseExists(database, route)
+		if (ddl.Action == sqlparser.CreateDBStr && ddl.IfNotExists && exists) || (ddl.Action == sqlparser.DropDBStr && ddl.IfExists && !exists) {
+			break
+		}
+		for _, backend := range scatter.Backends() {
+			querys = append(querys, xcontext.QueryTuple{Query: query, Backend: backend})
+		}
+	case sqlparser.CreateTableStr:
+		table := ddl.Table.Name.String()
+		if !checkDatabaseExists(database, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+		}
+		if ddl.IfNotExists && checkTableExists(database, table, route) {
+			break
+		}
+		if planner.IsCreateTableLike(query) {
+			return nil, errors.New("unsupported: explain.create.table.like")
+		}
+		spec, err := planCreateTable(query, ddl, scatter.Backends())
+		if err != nil {
+			return nil, err
+		}
+		preview, err := route.PreviewTable(database, table, spec.shardKey, spec.tableType, spec.backends, spec.extra)
+		if err != nil {
+			return nil, err
+		}
+		if querys, err = spanner.planDDL(preview, database, spec.create, ddl); err != nil {
+			return nil, err
+		}
+	case sqlparser.DropTableStr:
+		for _, tableIdent := range ddl.Tables {
+			ddl.Table = tableIdent
+			table := tableIdent.Name.String()
+			db := database
+			query := fmt.Sprintf("drop table %s", sqlparser.Backtick(table))
+			if !tableIdent.Qualifier.IsEmpty() {
+				db = tableIdent.Qualifier.String()
+				query = fmt.Sprintf("drop table %s.%s", sqlparser.Backtick(db), sqlparser.Backtick(table))
+			}
+			if !checkDatabaseExists(db, route) {
+				return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+			}
+			if ddl.IfExists && !checkTableExists(db, table, route) {
+				continue
+			}
+			qs, err := spanner.planDDL(route, db, query, ddl)
+			if err != nil {
+				return nil, err
+			}
+			querys = append(querys, qs...)
+		}
+	case sqlparser.CreateIndexStr, sqlparser.DropIndexStr,
+		sqlparser.AlterEngineStr, sqlparser.AlterCharsetStr,
+		sqlparser.AlterAddColumnStr, sqlparser.AlterDropColumnStr, sqlparser.AlterModifyColumnStr,
+		sqlparser.TruncateTableStr:
+		if !checkDatabaseExists(database, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+		}
+		table := ddl.Table.Name.String()
+		if !checkTableExists(database, table, route) {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+		}
+		var err error
+		if querys, err = spanner.planDDL(route, database, query, ddl); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; you don't have the privilege for %v operation", ddl.Action)
+	}
+
+	qr := &sqltypes.Result{}
+	qr.Fields = []*querypb.Field{
+		{Name: "Backend", Type: querypb.Type_VARCHAR},
+		{Name: "Range", Type: querypb.Type_VARCHAR},
+		{Name: "Query", Type: querypb.Type_VARCHAR},
+	}
+	for _, q := range querys {
+		row := []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(q.Backend)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(q.Range)),
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(q.Query)),
+		}
+		qr.Rows = append(qr.Rows, row)
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr, nil
+}
+
+// planDDL used to build the DDL plan with the router and returns the querys it sends to the backends.
+func (spanner *Spanner) planDDL(route *router.Router, database string, query string, ddl *sqlparser.DDL) ([]xcontext.QueryTuple, error) {
+	plan := planner.NewDDLPlan(spanner.log, database, query, ddl, route)
+	if err := plan.Build(); err != nil {
+		return nil, err
+	}
+	return plan.Querys, nil
+}
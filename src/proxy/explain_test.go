@@ -9,8 +9,13 @@
 package proxy
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 
+	"planner"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
@@ -315,3 +320,257 @@ func TestProxyExplainPrivilege(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestProxyExplainAnalyze(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", result1)
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create database test"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		query := "create table t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		client.Quit()
+	}
+
+	// explain analyze.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		query := "explain analyze select * from t1"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(qr.Fields))
+		assert.True(t, len(qr.Rows) > 1)
+
+		shards := len(qr.Rows) - 1
+		for _, row := range qr.Rows[:shards] {
+			assert.True(t, strings.HasPrefix(string(row[0].Raw()), "backend"))
+			assert.Equal(t, "2", string(row[3].Raw()))
+			assert.Equal(t, "25", string(row[4].Raw()))
+		}
+		merge := qr.Rows[shards]
+		assert.Equal(t, "radon", string(merge[0].Raw()))
+		assert.Equal(t, "merge", string(merge[1].Raw()))
+		assert.Equal(t, fmt.Sprintf("%d", shards*2), string(merge[3].Raw()))
+	}
+
+	// explain analyze unsupported.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		query := "explain analyze delete from t1"
+		_, err = client.FetchAll(query, -1)
+		want := "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, explain analyze only supports SELECT/UNION (errno 1149) (sqlstate 42000)"
+		got := err.Error()
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestProxyExplainDDL(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create database test"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// create test table.
+	{
+		query := "create table t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// explain ddl create table.
+	{
+		query := "explain ddl create table t2(id int, b int) partition by hash(id)"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 30, len(qr.Rows))
+		assert.Equal(t, "backend0", qr.Rows[0][0].String())
+		assert.Equal(t, "[0-128)", qr.Rows[0][1].String())
+		assert.Equal(t, "create table `test`.`t2_0000` (\n\t`id` int,\n\t`b` int\n) engine=InnoDB", qr.Rows[0][2].String())
+		assert.Equal(t, "[3916-4096)", qr.Rows[29][1].String())
+
+		// The table is not created.
+		query = "explain ddl alter table t2 engine=tokudb"
+		_, err = client.FetchAll(query, -1)
+		assert.NotNil(t, err)
+	}
+
+	// explain ddl create global table.
+	{
+		query := "explain ddl create table t3(id int, b int) global"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(qr.Rows))
+	}
+
+	// explain ddl alter table.
+	{
+		query := "explain ddl alter table t1 add column(c int)"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 30, len(qr.Rows))
+		assert.Equal(t, "alter table `test`.`t1_0029` add column(c int)", qr.Rows[29][2].String())
+	}
+
+	// explain ddl drop table.
+	{
+		query := "explain ddl drop table if exists t1, t9"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 30, len(qr.Rows))
+		assert.Equal(t, "drop table `test`.`t1_0000`", qr.Rows[0][2].String())
+	}
+
+	// explain ddl create table with the partitions and the table options.
+	{
+		query := "explain ddl create table t5(id int, b int) comment='the t5' partition by hash(id) partitions 8"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 8, len(qr.Rows))
+		assert.Equal(t, "create table `test`.`t5_0000` (\n\t`id` int,\n\t`b` int\n) engine=InnoDB comment='the t5'", qr.Rows[0][2].String())
+
+		query = "explain ddl create table t6(id int, b int) single on 'backend2'"
+		qr, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+		assert.Equal(t, "backend2", qr.Rows[0][0].String())
+	}
+
+	// explain ddl create database.
+	{
+		query := "explain ddl create database db1"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(qr.Rows))
+		assert.Equal(t, "create database db1", qr.Rows[0][2].String())
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"explain ddl alter table t1 drop column id",
+			"explain ddl alter table t1 add column(c int primary key)",
+			"explain ddl create table t1(id int, b int) partition by hash(id)",
+			"explain ddl create table t4(id int, b int unique) partition by hash(id)",
+			"explain ddl create table t4(id int, b int) partition by hash(c)",
+			"explain ddl create table xx.t4(id int, b int) partition by hash(id)",
+			"explain ddl alter table t9 engine=tokudb",
+			"explain ddl create table t4 like t1",
+			"explain ddl select 1",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+		}
+	}
+}
+
+func TestProxyExplainFormatJSON(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create database test"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// create test table.
+	{
+		query := "create table t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// explain format=json.
+	{
+		query := "explain format=json select id, sum(b) from t1 where id=1 group by id"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+		exp := &planner.ExplainPlan{}
+		err = json.Unmarshal([]byte(qr.Rows[0][0].String()), exp)
+		assert.Nil(t, err)
+		assert.Equal(t, planner.ExplainVersion, exp.Version)
+		assert.Equal(t, "select", exp.Statement)
+		assert.Equal(t, "merge", exp.Root.Type)
+		assert.Equal(t, "single", exp.Root.Routing)
+		assert.Equal(t, 1, len(exp.Routes))
+	}
+
+	// explain format = JSON insert.
+	{
+		query := "explain FORMAT = JSON insert into t1(id, b) values(1, 1), (65536, 1)"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		exp := &planner.ExplainPlan{}
+		err = json.Unmarshal([]byte(qr.Rows[0][0].String()), exp)
+		assert.Nil(t, err)
+		assert.Equal(t, "insert", exp.Statement)
+		assert.Equal(t, 2, len(exp.Routes))
+	}
+
+	// unsupported format.
+	{
+		query := "explain format=tree select * from t1"
+		_, err := client.FetchAll(query, -1)
+		want := "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, explain format only supports JSON, not tree (errno 1149) (sqlstate 42000)"
+		assert.Equal(t, want, err.Error())
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+var (
+	flushRegexp = regexp.MustCompile(`(?is)^(flush(\s+(no_write_to_binlog|local))?|reset)\s+(.+)$`)
+)
+
+// flushAction is the radon side effect of a FLUSH or RESET option, nil means nothing to do.
+type flushAction func(spanner *Spanner) error
+
+// isFlush returns true if the query is a FLUSH or RESET statement, they are not supported by the parser.
+func isFlush(query string) bool {
+	return flushRegexp.MatchString(query)
+}
+
+// handleFlush used to handle the FLUSH and RESET statements issued by the admin scripts:
+// FLUSH PRIVILEGES reloads the privileges of radon users from the backend.
+// FLUSH LOGS rotates the audit log, the slow querys are counted by the monitor and have no log to rotate.
+// FLUSH ACCESS LOGS rotates the access log, it's rotated independently of the audit log.
+// The options radon has no state for are no-ops with a warning, the ones can't be emulated are rejected.
+func (spanner *Spanner) handleFlush(session *driver.Session, query string) (*sqltypes.Result, error) {
+	log := spanner.log
+	privilegePlug := spanner.plugins.PlugPrivilege()
+
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return nil, sqldb.NewSQLError(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "RELOAD")
+	}
+
+	matches := flushRegexp.FindStringSubmatch(query)
+	verb := strings.ToUpper(strings.Fields(matches[1])[0])
+	actions, err := flushActions(verb, matches[4])
+	if err != nil {
+		return nil, err
+	}
+
+	qr := &sqltypes.Result{}
+	for _, action := range actions {
+		if action == nil {
+			qr.Warnings++
+			continue
+		}
+		if err := action(spanner); err != nil {
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "%s.error:%v", strings.ToLower(verb), err)
+		}
+	}
+	log.Warning("proxy.flush[%s].from.session[%v].done", query, session.ID())
+	return qr, nil
+}
+
+// flushActions resolves all the options before any of them executed.
+func flushActions(verb string, options string) ([]flushAction, error) {
+	var actions []flushAction
+	options = strings.ToLower(strings.Join(strings.Fields(options), " "))
+
+	if word := strings.Fields(options)[0]; verb == "FLUSH" && (word == "tables" || word == "table") {
+		// The table list may contain the ',', it's the only option.
+		switch {
+		case strings.HasSuffix(options, " with read lock"):
+			return nil, sqldb.NewSQLError(sqldb.ER_NOT_SUPPORTED_YET, "FLUSH TABLES WITH READ LOCK")
+		case strings.HasSuffix(options, " for export"):
+			return nil, sqldb.NewSQLError(sqldb.ER_NOT_SUPPORTED_YET, "FLUSH TABLES FOR EXPORT")
+		}
+		return append(actions, nil), nil
+	}
+
+	for _, option := range strings.Split(options, ",") {
+		option = strings.TrimSpace(option)
+		action, ok, err := flushOption(verb, option)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, fmt.Sprintf("near '%s'", option))
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+func flushOption(verb string, option string) (flushAction, bool, error) {
+	switch verb {
+	case "FLUSH":
+		switch {
+		case option == "privileges":
+			return func(spanner *Spanner) error {
+				return spanner.plugins.PlugPrivilege().UpdatePrivileges()
+			}, true, nil
+		case option == "logs", option == "general logs", option == "slow logs":
+			return func(spanner *Spanner) error {
+				return spanner.audit.Rotate()
+			}, true, nil
+		case option == "access logs":
+			return func(spanner *Spanner) error {
+				if spanner.access == nil {
+					return errors.New("access.log.disabled")
+				}
+				return spanner.access.Rotate()
+			}, true, nil
+		case option == "binary logs", option == "engine logs", option == "error logs", strings.HasPrefix(option, "relay logs"),
+			option == "status", option == "hosts", option == "user_resources", option == "optimizer_costs", option == "query cache":
+			return nil, true, nil
+		}
+	case "RESET":
+		switch {
+		case option == "query cache":
+			return nil, true, nil
+		case option == "master", strings.HasPrefix(option, "slave"), strings.HasPrefix(option, "persist"):
+			return nil, true, sqldb.NewSQLError(sqldb.ER_NOT_SUPPORTED_YET, "RESET "+strings.ToUpper(option))
+		}
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyFlush(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// Reload the privileges.
+	{
+		query := "select host, user, select_priv, insert_priv, update_priv, delete_priv, create_priv, drop_priv, alter_priv, index_priv, show_db_priv, super_priv from mysql.user"
+		called := fakedbs.GetQueryCalledNum(query)
+		_, err := client.FetchAll("flush privileges", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("FLUSH NO_WRITE_TO_BINLOG PRIVILEGES;", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, called+2, fakedbs.GetQueryCalledNum(query))
+	}
+
+	// The no-ops.
+	{
+		querys := []string{
+			"flush tables",
+			"flush local tables t1, t2",
+			"flush status, hosts",
+			"flush binary logs",
+			"flush relay logs for channel c1",
+			"reset query cache",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+	}
+
+	// The unsupported.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{"flush tables t1 with read lock", "This version of MySQL doesn't yet support 'FLUSH TABLES WITH READ LOCK' (errno 1235) (sqlstate 42000)"},
+			{"flush tables t1 for export", "This version of MySQL doesn't yet support 'FLUSH TABLES FOR EXPORT' (errno 1235) (sqlstate 42000)"},
+			{"reset master", "This version of MySQL doesn't yet support 'RESET MASTER' (errno 1235) (sqlstate 42000)"},
+			{"reset slave all", "This version of MySQL doesn't yet support 'RESET SLAVE ALL' (errno 1235) (sqlstate 42000)"},
+			{"flush privileges, xx", "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, near 'xx' (errno 1149) (sqlstate 42000)"},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+	}
+}
+
+func TestProxyFlushLogs(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := fakedb.GetTmpDir("", "radon_flush_audit_", log)
+	conf := MockDefaultConfig()
+	conf.Audit.Mode = "A"
+	conf.Audit.LogDir = tmpDir
+	_, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// Each flush event is written to the new audit log.
+	for i := 0; i < 3; i++ {
+		_, err := client.FetchAll("flush logs", -1)
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err = client.FetchAll("flush slow logs, general logs", -1)
+	assert.Nil(t, err)
+
+	logs, err := filepath.Glob(filepath.Join(tmpDir, "audit-*.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(logs))
+}
+
+func TestProxyFlushPrivilege(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxyPrivilegeNotSuper(log, MockDefaultConfig())
+	defer cleanup()
+	address := proxy.Address()
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	_, err = client.FetchAll("flush privileges", -1)
+	want := "Access denied; you need (at least one of) the RELOAD privilege(s) for this operation (errno 1227) (sqlstate 42000)"
+	assert.Equal(t, want, err.Error())
+}
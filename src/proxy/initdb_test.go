@@ -26,7 +26,7 @@ func TestProxyUseDatabase(t *testing.T) {
 	// fakedbs.
 	{
 		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
-		fakedbs.AddQueryPattern("use test", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use `test`", &sqltypes.Result{})
 	}
 
 	// connection without database.
@@ -55,7 +55,7 @@ func TestProxyUseDatabasePrivilegeNotSuper(t *testing.T) {
 	// fakedbs.
 	{
 		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
-		fakedbs.AddQueryPattern("use test1", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use `test1`", &sqltypes.Result{})
 	}
 
 	// connection without database.
@@ -80,7 +80,7 @@ func TestProxyUseDatabasePrivilegeDB(t *testing.T) {
 	// fakedbs.
 	{
 		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
-		fakedbs.AddQueryPattern("use test1", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use `test1`", &sqltypes.Result{})
 	}
 
 	// connection without database.
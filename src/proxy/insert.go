@@ -19,6 +19,15 @@ func (spanner *Spanner) handleInsert(session *driver.Session, query string, node
 	database := session.Schema()
 	autoincPlug := spanner.plugins.PlugAutoIncrement()
 
+	// Database quota check.
+	quotaDB := database
+	if insert := node.(*sqlparser.Insert); !insert.Table.Qualifier.IsEmpty() {
+		quotaDB = insert.Table.Qualifier.String()
+	}
+	if err := spanner.quotas.Check(quotaDB); err != nil {
+		return nil, err
+	}
+
 	// AutoIncrement plugin process.
 	if err := autoincPlug.Process(database, node.(*sqlparser.Insert)); err != nil {
 		return nil, err
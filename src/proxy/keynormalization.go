@@ -0,0 +1,157 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+
+	"backend"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// ShardKeyMove tuple, the shard key which the canonical key normalization routes to the other segment.
+type ShardKeyMove struct {
+	Key  string `json:"key"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ShardKeyCheck tuple, the result of checking the shard keys on the backends against the canonical key normalization.
+type ShardKeyCheck struct {
+	Database         string          `json:"database"`
+	Table            string          `json:"table"`
+	KeyNormalization string          `json:"key-normalization"`
+	Keys             int             `json:"keys"`
+	Moves            []*ShardKeyMove `json:"moves"`
+	// Truncated is true if there are more moves than the limit.
+	Truncated bool `json:"truncated"`
+}
+
+// CheckShardKeys used to read the distinct shard keys of every segment of the HASH table and return the ones
+// the canonical key normalization routes to the other segments, at most limit of them.
+// The table can be switched to the canonical key normalization only if no keys move, otherwise the rows of
+// the keys must be moved to their canonical segments first.
+func (spanner *Spanner) CheckShardKeys(database string, table string, limit int) (*ShardKeyCheck, error) {
+	log := spanner.log
+	route := spanner.router
+	scatter := spanner.scatter
+
+	tconf, err := route.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := route.CanonicalPartition(database, table)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := route.Lookup(database, table, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &ShardKeyCheck{
+		Database:         database,
+		Table:            table,
+		KeyNormalization: tconf.KeyNormalization,
+		Moves:            []*ShardKeyMove{},
+	}
+	pools := scatter.PoolClone()
+	for _, segment := range segments {
+		pool, ok := pools[segment.Backend]
+		if !ok {
+			return nil, errors.Errorf("shard.key.check.can.not.find.backend[%s]", segment.Backend)
+		}
+		query := fmt.Sprintf("select distinct %s from %s.%s", sqlparser.Backtick(tconf.ShardKey), sqlparser.Backtick(database), sqlparser.Backtick(segment.Table))
+		err := streamShardKeys(pool, query, func(key sqltypes.Value) error {
+			check.Keys++
+			idx, err := canonical.GetIndex(shardKeySQLVal(key))
+			if err != nil {
+				return err
+			}
+			to, err := canonical.GetSegment(idx)
+			if err != nil {
+				return err
+			}
+			if to.Table == segment.Table {
+				return nil
+			}
+			if len(check.Moves) == limit {
+				check.Truncated = true
+				return nil
+			}
+			check.Moves = append(check.Moves, &ShardKeyMove{Key: key.String(), From: segment.Table, To: to.Table})
+			return nil
+		})
+		if err != nil {
+			log.Error("spanner.check.shard.keys[%s.%s].segment[%s].error:%+v", database, table, segment.Table, err)
+			return nil, err
+		}
+	}
+	log.Info("spanner.check.shard.keys[%s.%s].keys[%d].moves[%d]", database, table, check.Keys, len(check.Moves))
+	return check, nil
+}
+
+// streamShardKeys used to stream the not NULL keys of the query to the fn.
+func streamShardKeys(pool *backend.Pool, query string, fn func(sqltypes.Value) error) error {
+	return streamRows(pool, query, func(row []sqltypes.Value) error {
+		if len(row) == 0 || row[0].IsNull() {
+			return nil
+		}
+		return fn(row[0])
+	})
+}
+
+// streamRows used to stream the rows of the query to the fn, the connection is closed
+// instead of put back to the pool if the streaming breaks.
+func streamRows(pool *backend.Pool, query string, fn func([]sqltypes.Value) error) error {
+	conn, err := pool.Get()
+	if err != nil {
+		return err
+	}
+	rows, err := conn.ExecuteStreamFetch(query)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	for rows.Next() {
+		row, err := rows.RowValues()
+		if err != nil {
+			rows.Close()
+			conn.Close()
+			return err
+		}
+		if err := fn(row); err != nil {
+			rows.Close()
+			conn.Close()
+			return err
+		}
+	}
+	err = rows.LastError()
+	rows.Close()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	pool.Put(conn)
+	return nil
+}
+
+// shardKeySQLVal returns the SQLVal of the key read from the backend, it's typed as the planner types the literal.
+func shardKeySQLVal(key sqltypes.Value) *sqlparser.SQLVal {
+	switch {
+	case key.IsIntegral():
+		return sqlparser.NewIntVal(key.Raw())
+	case key.IsFloat(), key.Type() == sqltypes.Decimal:
+		return sqlparser.NewFloatVal(key.Raw())
+	}
+	return sqlparser.NewStrVal(key.Raw())
+}
@@ -0,0 +1,109 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyCheckShardKeys(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+	route := spanner.router
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select distinct .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(name varchar(32), b int) partition by hash(name)", -1)
+		assert.Nil(t, err)
+	}
+
+	// The canonical table is checked as well.
+	{
+		check, err := spanner.CheckShardKeys("test", "t1", 10)
+		assert.Nil(t, err)
+		assert.Equal(t, "", check.KeyNormalization)
+		assert.Equal(t, 0, check.Keys)
+		assert.Equal(t, 0, len(check.Moves))
+	}
+
+	// The legacy table has the key which the canonical normalization routes elsewhere.
+	err := route.SetKeyNormalization("test", "t1", config.KeyNormalizationLegacy)
+	assert.Nil(t, err)
+	val := sqlparser.NewStrVal([]byte("ABC"))
+	legacy, err := route.Lookup("test", "t1", val, val)
+	assert.Nil(t, err)
+	canonical, err := route.CanonicalPartition("test", "t1")
+	assert.Nil(t, err)
+	idx, err := canonical.GetIndex(val)
+	assert.Nil(t, err)
+	to, err := canonical.GetSegment(idx)
+	assert.Nil(t, err)
+	assert.NotEqual(t, legacy[0].Table, to.Table)
+
+	query := fmt.Sprintf("select distinct `name` from `test`.`%s`", legacy[0].Table)
+	result := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "name", Type: querypb.Type_VARCHAR}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("ABC"))},
+			{sqltypes.NULL},
+		},
+	}
+	fakedbs.AddQueryStream(query, result)
+	{
+		check, err := spanner.CheckShardKeys("test", "t1", 10)
+		assert.Nil(t, err)
+		assert.Equal(t, config.KeyNormalizationLegacy, check.KeyNormalization)
+		assert.Equal(t, 1, check.Keys)
+		assert.Equal(t, []*ShardKeyMove{{Key: "ABC", From: legacy[0].Table, To: to.Table}}, check.Moves)
+		assert.False(t, check.Truncated)
+	}
+
+	// Limit.
+	{
+		check, err := spanner.CheckShardKeys("test", "t1", 0)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(check.Moves))
+		assert.True(t, check.Truncated)
+	}
+
+	// Errors.
+	{
+		_, err := spanner.CheckShardKeys("test", "t9", 10)
+		assert.NotNil(t, err)
+
+		fakedbs.AddQueryError(query, errors.New("mock.select.error"))
+		_, err = spanner.CheckShardKeys("test", "t1", 10)
+		assert.NotNil(t, err)
+	}
+}
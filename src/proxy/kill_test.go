@@ -161,3 +161,49 @@ func TestProxyKillPrivilege(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestProxyKillOnClientGone(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select * .*", &sqltypes.Result{})
+		fakedbs.AddQueryDelay("select * from test.t1_0002 as t1", &sqltypes.Result{}, 10000)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+		client.Quit()
+	}
+
+	// The client is gone during the long query.
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := client.FetchAll("select * from t1", -1)
+		assert.NotNil(t, err)
+	}()
+	time.Sleep(time.Millisecond * 500)
+	client.Cleanup()
+	<-done
+
+	// The backend query is killed, the session exits before the query delay.
+	start := time.Now()
+	for len(proxy.sessions.Snapshot()) > 0 && time.Since(start) < time.Second*5 {
+		time.Sleep(time.Millisecond * 50)
+	}
+	assert.Equal(t, 0, len(proxy.sessions.Snapshot()))
+}
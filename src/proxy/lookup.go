@@ -0,0 +1,710 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"config"
+	"executor"
+	"optimizer"
+	"planner"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	lookupBackfillBatch = 256
+)
+
+// lookupExec executes the statement in the transaction of the lookup writes.
+type lookupExec func(node sqlparser.Statement) (*sqltypes.Result, error)
+
+// AddLookup used to add the lookup table of the column to the table and fill it with the rows of the table,
+// the rows filled are returned. The lookup is written with the table once it's added, but it routes the selects
+// only after it's filled. The lookup is removed if the fill fails.
+// The fill doesn't overwrite the values already written, the rows deleted during the fill may be left in the lookup table.
+func (spanner *Spanner) AddLookup(database, table, column, lookupTable string) (uint64, error) {
+	log := spanner.log
+	route := spanner.router
+
+	lookup := &config.LookupConfig{Column: column, Table: lookupTable, Backfilling: true}
+	if err := route.AddLookup(database, table, lookup); err != nil {
+		return 0, err
+	}
+	rows, err := spanner.backfillLookup(database, table, lookup)
+	if err != nil {
+		log.Error("spanner.lookup[%s.%s.%s].backfill.error:%v", database, table, column, err)
+		if x := route.DropLookup(database, table, column); x != nil {
+			log.Error("spanner.lookup[%s.%s.%s].drop.error:%v", database, table, column, x)
+		}
+		return rows, err
+	}
+	if err := route.FinishLookup(database, table, column); err != nil {
+		return rows, err
+	}
+	log.Warning("spanner.lookup[%s.%s.%s].to.table[%s].backfilled.rows[%d]", database, table, column, lookupTable, rows)
+	return rows, nil
+}
+
+// backfillLookup used to insert the column values and the shard keys of the segments into the lookup table in batches.
+func (spanner *Spanner) backfillLookup(database, table string, lookup *config.LookupConfig) (uint64, error) {
+	route := spanner.router
+	tconf, err := route.TableConfig(database, table)
+	if err != nil {
+		return 0, err
+	}
+	segments, err := route.Lookup(database, table, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var filled uint64
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		query := fmt.Sprintf("insert ignore into %s.%s(%s, %s) values %s", sqlparser.Backtick(database), sqlparser.Backtick(lookup.Table),
+			sqlparser.Backtick(lookup.Column), sqlparser.Backtick(tconf.ShardKey), strings.Join(batch, ", "))
+		qr, err := spanner.executeLookupQuery(database, query)
+		if err != nil {
+			return err
+		}
+		filled += qr.RowsAffected
+		batch = batch[:0]
+		return nil
+	}
+
+	pools := spanner.scatter.PoolClone()
+	for _, segment := range segments {
+		pool, ok := pools[segment.Backend]
+		if !ok {
+			return filled, errors.Errorf("lookup.backfill.can.not.find.backend[%s]", segment.Backend)
+		}
+		query := fmt.Sprintf("select %s, %s from %s.%s where %s is not null", sqlparser.Backtick(lookup.Column), sqlparser.Backtick(tconf.ShardKey),
+			sqlparser.Backtick(database), sqlparser.Backtick(segment.Table), sqlparser.Backtick(lookup.Column))
+		err := streamRows(pool, query, func(row []sqltypes.Value) error {
+			if len(row) < 2 || row[0].IsNull() || row[1].IsNull() {
+				return nil
+			}
+			batch = append(batch, fmt.Sprintf("(%s, %s)", sqlparser.String(shardKeySQLVal(row[0])), sqlparser.String(shardKeySQLVal(row[1]))))
+			if len(batch) >= lookupBackfillBatch {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return filled, err
+		}
+	}
+	return filled, flush()
+}
+
+// executeLookupQuery used to execute the query on the lookup tables out of the transactions.
+func (spanner *Spanner) executeLookupQuery(database string, query string) (*sqltypes.Result, error) {
+	log := spanner.log
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := spanner.scatter.CreateTransaction()
+	if err != nil {
+		log.Error("spanner.lookup.txn.create.error:[%v]", err)
+		return nil, err
+	}
+	defer txn.Finish()
+	txn.SetTimeout(spanner.conf.Proxy.QueryTimeout)
+
+	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, spanner.router).BuildPlanTree()
+	if err != nil {
+		return nil, err
+	}
+	return executor.NewTree(log, plans, txn).Execute()
+}
+
+// lookupRewrite used to add the filters on the shard keys read from the lookup tables to the select, update or delete
+// filtering on the lookup columns, so it's routed to the segments of the keys instead of all.
+// The session in the transaction isn't rewritten, its writes to the lookup tables aren't visible out of it.
+func (spanner *Spanner) lookupRewrite(session *driver.Session, database string, query string, node sqlparser.Statement) error {
+	log := spanner.log
+	if txSession := spanner.sessions.getTxnSession(session); txSession != nil && txSession.transaction != nil {
+		return nil
+	}
+	var routes []*planner.LookupRoute
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		routes = planner.LookupRoutes(spanner.router, database, node)
+	case *sqlparser.Update, *sqlparser.Delete:
+		if planner.IsMultiTableDML(query) {
+			return nil
+		}
+		routes = planner.LookupDMLRoutes(spanner.router, database, node)
+	}
+	for _, route := range routes {
+		qr, err := spanner.executeLookupQuery(database, route.Query())
+		if err != nil {
+			log.Error("spanner.lookup[%v].query.error:%v", route, err)
+			return err
+		}
+		keys := lookupKeys(qr, 0)
+		// No rows have the values, the query still goes to all the segments to keep its result.
+		if len(keys) == 0 {
+			continue
+		}
+		switch node := node.(type) {
+		case *sqlparser.Select:
+			node.AddWhere(route.Filter(keys))
+		case *sqlparser.Update:
+			node.Where = andWhere(node.Where, route.Filter(keys))
+		case *sqlparser.Delete:
+			node.Where = andWhere(node.Where, route.Filter(keys))
+		}
+	}
+	return nil
+}
+
+// lookupKeys returns the not NULL values of the column in the result.
+func lookupKeys(qr *sqltypes.Result, col int) []*sqlparser.SQLVal {
+	var keys []*sqlparser.SQLVal
+	for _, row := range qr.Rows {
+		if !row[col].IsNull() {
+			keys = append(keys, shardKeySQLVal(row[col]))
+		}
+	}
+	return keys
+}
+
+// executeLookupDML used to execute the INSERT, UPDATE or DELETE on the table with the lookups, it returns false if the
+// table has no lookups or the UPDATE doesn't change the lookup columns.
+// The rows changed are read by the SELECT ... FOR UPDATE first, and the lookup tables are written in the same 2pc
+// transaction as the table.
+func (spanner *Spanner) executeLookupDML(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, bool, error) {
+	if planner.IsMultiTableDML(query) {
+		dml, err := planner.ParseMultiTableDML(query)
+		if err != nil {
+			return nil, false, nil
+		}
+		for _, tb := range dml.Tables() {
+			if db, tconf := spanner.lookupTableConfig(database, tb); tconf != nil {
+				return nil, true, errors.Errorf("unsupported: the.multi-table.dml.on.table[%s.%s].with.lookups", db, tconf.Name)
+			}
+		}
+		return nil, false, nil
+	}
+
+	tb, ok := dmlTable(node)
+	if !ok {
+		return nil, false, nil
+	}
+	db, tconf := spanner.lookupTableConfig(database, tb)
+	if tconf == nil {
+		return nil, false, nil
+	}
+
+	var fn func(exec lookupExec) (*sqltypes.Result, error)
+	switch node := node.(type) {
+	case *sqlparser.Insert:
+		writes, err := lookupInserts(db, tconf, node)
+		if err != nil {
+			return nil, true, err
+		}
+		fn = func(exec lookupExec) (*sqltypes.Result, error) {
+			qr, err := exec(node)
+			if err != nil {
+				return nil, err
+			}
+			for _, write := range writes {
+				if _, err := exec(write); err != nil {
+					return nil, err
+				}
+			}
+			return qr, nil
+		}
+	case *sqlparser.Update:
+		var lookups []*config.LookupConfig
+		var vals []sqlparser.Expr
+		for _, expr := range node.Exprs {
+			for _, lookup := range tconf.Lookups {
+				if strings.EqualFold(expr.Name.Name.String(), lookup.Column) {
+					if !isLookupValue(expr.Expr) {
+						return nil, true, errors.Errorf("unsupported: the.value.of.lookup.column[%s].must.be.constant", lookup.Column)
+					}
+					lookups = append(lookups, lookup)
+					vals = append(vals, expr.Expr)
+				}
+			}
+		}
+		if len(lookups) == 0 {
+			return nil, false, nil
+		}
+		if node.Limit != nil {
+			return nil, true, errors.Errorf("unsupported: the.limit.on.table[%s.%s].with.lookups", db, tconf.Name)
+		}
+		fn = func(exec lookupExec) (*sqltypes.Result, error) {
+			keys, olds, err := lookupRows(exec, tb, node.Where, tconf.ShardKey, lookups)
+			if err != nil || len(keys) == 0 {
+				return &sqltypes.Result{}, err
+			}
+			node.Where = andWhere(node.Where, planner.ShardKeyFilter("", tconf.ShardKey, keys))
+			qr, err := exec(node)
+			if err != nil {
+				return nil, err
+			}
+			for i, lookup := range lookups {
+				for _, del := range lookupDeletes(db, tconf.ShardKey, lookup, olds[i]) {
+					if _, err := exec(del); err != nil {
+						return nil, err
+					}
+				}
+				if _, ok := vals[i].(*sqlparser.NullVal); ok {
+					continue
+				}
+				rows := make(sqlparser.Values, 0, len(keys))
+				for _, key := range keys {
+					rows = append(rows, sqlparser.ValTuple{vals[i], key})
+				}
+				if _, err := exec(lookupInsert(db, tconf.ShardKey, lookup, rows)); err != nil {
+					return nil, err
+				}
+			}
+			return qr, nil
+		}
+	case *sqlparser.Delete:
+		if node.Limit != nil {
+			return nil, true, errors.Errorf("unsupported: the.limit.on.table[%s.%s].with.lookups", db, tconf.Name)
+		}
+		fn = func(exec lookupExec) (*sqltypes.Result, error) {
+			keys, olds, err := lookupRows(exec, tb, node.Where, tconf.ShardKey, tconf.Lookups)
+			if err != nil || len(keys) == 0 {
+				return &sqltypes.Result{}, err
+			}
+			node.Where = andWhere(node.Where, planner.ShardKeyFilter("", tconf.ShardKey, keys))
+			qr, err := exec(node)
+			if err != nil {
+				return nil, err
+			}
+			for i, lookup := range tconf.Lookups {
+				for _, del := range lookupDeletes(db, tconf.ShardKey, lookup, olds[i]) {
+					if _, err := exec(del); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return qr, nil
+		}
+	}
+	qr, err := spanner.executeLookupTxn(session, database, query, node, fn)
+	return qr, true, err
+}
+
+// lookupTableConfig returns the database and the config of the table if it has lookups, nil if not.
+func (spanner *Spanner) lookupTableConfig(database string, tb sqlparser.TableName) (string, *config.TableConfig) {
+	db := database
+	if !tb.Qualifier.IsEmpty() {
+		db = tb.Qualifier.String()
+	}
+	tconf, err := spanner.router.TableConfig(db, tb.Name.String())
+	if err != nil || len(tconf.Lookups) == 0 {
+		return db, nil
+	}
+	return db, tconf
+}
+
+// dmlTable returns the table written by the INSERT, UPDATE or DELETE.
+func dmlTable(node sqlparser.Statement) (sqlparser.TableName, bool) {
+	switch node := node.(type) {
+	case *sqlparser.Insert:
+		return node.Table, true
+	case *sqlparser.Update:
+		return node.Table, true
+	case *sqlparser.Delete:
+		return node.Table, true
+	}
+	return sqlparser.TableName{}, false
+}
+
+// executeLookupTxn used to execute the statements of the fn in the 2pc transaction,
+// they're executed in the session's transaction if it's in one.
+func (spanner *Spanner) executeLookupTxn(session *driver.Session, database string, query string, node sqlparser.Statement, fn func(exec lookupExec) (*sqltypes.Result, error)) (*sqltypes.Result, error) {
+	log := spanner.log
+	conf := spanner.conf
+	router := spanner.router
+	sessions := spanner.sessions
+
+	txSession := sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		return fn(func(node sqlparser.Statement) (*sqltypes.Result, error) {
+			return spanner.ExecuteMultiStmtsInTxn(session, database, sqlparser.String(node), node)
+		})
+	}
+
+	txn, err := spanner.scatter.CreateTransaction()
+	if err != nil {
+		log.Error("spanner.lookup.txn.create.error:[%v]", err)
+		return nil, err
+	}
+	defer txn.Finish()
+
+	txn.SetTimeout(conf.Proxy.QueryTimeout)
+	txn.SetMaxResult(spanner.maxResultSize(session.User(), node))
+	txn.SetMaxResultRows(spanner.maxResultRows(session.User()))
+	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetMaxDMLRows(conf.Proxy.MaxDMLRows)
+	txn.SetQueryTag(spanner.queryTag(session.User(), session.ID()))
+
+	// binding.
+	sessions.TxnBinding(session, txn, node, query)
+	defer sessions.TxnUnBinding(session)
+	ctx, cancel := sessions.QueryContext(session)
+	defer cancel()
+
+	if err := txn.Begin(); err != nil {
+		log.Error("spanner.lookup.txn.begin.error:[%v]", err)
+		return nil, err
+	}
+	qr, err := fn(func(node sqlparser.Statement) (*sqltypes.Result, error) {
+		query := sqlparser.String(node)
+		plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTreeContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return executor.NewTree(log, plans, txn).ExecuteContext(ctx)
+	})
+	if err != nil {
+		if x := txn.Rollback(); x != nil {
+			log.Error("spanner.lookup.txn.error.to.rollback.still.error:[%v]", x)
+		}
+		return nil, err
+	}
+	if err := txn.Commit(); err != nil {
+		log.Error("spanner.lookup.txn.commit.error:[%v]", err)
+		return nil, err
+	}
+	return qr, nil
+}
+
+// lookupPair tuple, the value of the lookup column and the shard key of the row.
+type lookupPair struct {
+	val *sqlparser.SQLVal
+	key *sqlparser.SQLVal
+}
+
+// lookupRows used to read the shard keys of the rows matching the where by the SELECT ... FOR UPDATE,
+// and the pairs of the not NULL values of the lookup columns and the shard keys.
+func lookupRows(exec lookupExec, tb sqlparser.TableName, where *sqlparser.Where, shardKey string, lookups []*config.LookupConfig) ([]*sqlparser.SQLVal, [][]lookupPair, error) {
+	cols := []string{sqlparser.Backtick(shardKey)}
+	for _, lookup := range lookups {
+		cols = append(cols, sqlparser.Backtick(lookup.Column))
+	}
+	query := fmt.Sprintf("select %s from %s%s for update", strings.Join(cols, ", "), sqlparser.String(tb), sqlparser.String(where))
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	qr, err := exec(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	olds := make([][]lookupPair, len(lookups))
+	for _, row := range qr.Rows {
+		if row[0].IsNull() {
+			continue
+		}
+		for i := range lookups {
+			if !row[i+1].IsNull() {
+				olds[i] = append(olds[i], lookupPair{val: shardKeySQLVal(row[i+1]), key: shardKeySQLVal(row[0])})
+			}
+		}
+	}
+	return lookupKeys(qr, 0), olds, nil
+}
+
+// lookupInserts returns the INSERTs of the lookup tables for the rows of the INSERT, the rows whose lookup column
+// isn't given or is NULL have no lookups.
+func lookupInserts(database string, tconf *config.TableConfig, node *sqlparser.Insert) ([]sqlparser.Statement, error) {
+	if node.Action == sqlparser.ReplaceStr || node.Ignore != "" || len(node.OnDup) > 0 {
+		return nil, errors.Errorf("unsupported: the.replace.ignore.or.on.duplicate.key.update.on.table[%s.%s].with.lookups", database, tconf.Name)
+	}
+	rows, ok := node.Rows.(sqlparser.Values)
+	if !ok {
+		return nil, errors.Errorf("unsupported: the.insert.select.on.table[%s.%s].with.lookups", database, tconf.Name)
+	}
+	index := func(name string) int {
+		for i, col := range node.Columns {
+			if strings.EqualFold(col.String(), name) {
+				return i
+			}
+		}
+		return -1
+	}
+	keyIdx := index(tconf.ShardKey)
+	if keyIdx == -1 {
+		return nil, errors.Errorf("unsupported: the.insert.on.table[%s.%s].with.lookups.must.list.the.shard.key[%s]", database, tconf.Name, tconf.ShardKey)
+	}
+
+	var writes []sqlparser.Statement
+	for _, lookup := range tconf.Lookups {
+		colIdx := index(lookup.Column)
+		if colIdx == -1 {
+			continue
+		}
+		var values sqlparser.Values
+		for _, row := range rows {
+			if colIdx >= len(row) || keyIdx >= len(row) {
+				return nil, errors.Errorf("unsupported: the.insert.values.count.mismatch")
+			}
+			val := row[colIdx]
+			if !isLookupValue(val) {
+				return nil, errors.Errorf("unsupported: the.value.of.lookup.column[%s].must.be.constant", lookup.Column)
+			}
+			if _, ok := val.(*sqlparser.NullVal); ok {
+				continue
+			}
+			values = append(values, sqlparser.ValTuple{val, row[keyIdx]})
+		}
+		if len(values) > 0 {
+			writes = append(writes, lookupInsert(database, tconf.ShardKey, lookup, values))
+		}
+	}
+	return writes, nil
+}
+
+func lookupInsert(database string, shardKey string, lookup *config.LookupConfig, rows sqlparser.Values) *sqlparser.Insert {
+	return &sqlparser.Insert{
+		Action:  sqlparser.InsertStr,
+		Table:   sqlparser.TableName{Name: sqlparser.NewTableIdent(lookup.Table), Qualifier: sqlparser.NewTableIdent(database)},
+		Columns: sqlparser.Columns{sqlparser.NewColIdent(lookup.Column), sqlparser.NewColIdent(shardKey)},
+		Rows:    rows,
+	}
+}
+
+// lookupDeletes returns the DELETEs of the pairs from the lookup table, one for the keys of every value so it's
+// routed to one segment, the other rows of the same value are kept for the non-unique column.
+func lookupDeletes(database string, shardKey string, lookup *config.LookupConfig, pairs []lookupPair) []sqlparser.Statement {
+	var vals []*sqlparser.SQLVal
+	keys := make(map[string][]*sqlparser.SQLVal)
+	for _, pair := range pairs {
+		val := sqlparser.String(pair.val)
+		if _, ok := keys[val]; !ok {
+			vals = append(vals, pair.val)
+		}
+		keys[val] = append(keys[val], pair.key)
+	}
+
+	deletes := make([]sqlparser.Statement, 0, len(vals))
+	for _, val := range vals {
+		deletes = append(deletes, &sqlparser.Delete{
+			Table: sqlparser.TableName{Name: sqlparser.NewTableIdent(lookup.Table), Qualifier: sqlparser.NewTableIdent(database)},
+			Where: sqlparser.NewWhere(sqlparser.WhereStr, &sqlparser.AndExpr{
+				Left:  planner.ShardKeyFilter("", lookup.Column, []*sqlparser.SQLVal{val}),
+				Right: planner.ShardKeyFilter("", shardKey, keys[sqlparser.String(val)]),
+			}),
+		})
+	}
+	return deletes
+}
+
+// isLookupValue returns true if the expr is a constant or NULL.
+func isLookupValue(expr sqlparser.Expr) bool {
+	switch expr.(type) {
+	case *sqlparser.SQLVal, *sqlparser.NullVal:
+		return true
+	}
+	return false
+}
+
+func andWhere(where *sqlparser.Where, expr sqlparser.Expr) *sqlparser.Where {
+	if where == nil || where.Expr == nil {
+		return sqlparser.NewWhere(sqlparser.WhereStr, expr)
+	}
+	return sqlparser.NewWhere(sqlparser.WhereStr, &sqlparser.AndExpr{Left: &sqlparser.ParenExpr{Expr: where.Expr}, Right: expr})
+}
+
+// LookupEntry tuple, the value of the lookup column and the shard key of the row.
+type LookupEntry struct {
+	Value string `json:"value"`
+	Key   string `json:"key"`
+}
+
+// LookupCheck tuple, the result of checking the lookup table against the table.
+type LookupCheck struct {
+	Database    string `json:"database"`
+	Table       string `json:"table"`
+	Column      string `json:"column"`
+	LookupTable string `json:"lookup-table"`
+	// Rows is the rows of the table whose lookup column isn't NULL.
+	Rows uint64 `json:"rows"`
+	// Missing are the rows of the table not in the lookup table, Orphans are the rows of the lookup table not in the table.
+	Missing []*LookupEntry `json:"missing"`
+	Orphans []*LookupEntry `json:"orphans"`
+	// Truncated is true if there are more missing or orphans than the limit.
+	Truncated bool `json:"truncated"`
+	// Repaired is the rows of the lookup table inserted and deleted by the repair.
+	Repaired uint64 `json:"repaired"`
+}
+
+// CheckLookup used to compare the values and the shard keys of the table with the rows of its lookup table of the column,
+// at most limit of the missing and the orphans are returned. With the repair, the missing are inserted into the lookup table
+// and the orphans are deleted from it.
+// The rows are compared in memory and the writes during the check may be reported, the check of the lookup in the fill is refused.
+func (spanner *Spanner) CheckLookup(database, table, column string, limit int, repair bool) (*LookupCheck, error) {
+	log := spanner.log
+	route := spanner.router
+
+	tconf, err := route.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	var lookup *config.LookupConfig
+	for _, x := range tconf.Lookups {
+		if strings.EqualFold(x.Column, column) {
+			lookup = x
+		}
+	}
+	if lookup == nil {
+		return nil, errors.Errorf("lookup.check.table[%s.%s].column[%s].has.no.lookup", database, table, column)
+	}
+	if lookup.Backfilling {
+		return nil, errors.Errorf("lookup.check.table[%s.%s].column[%s].is.backfilling", database, table, column)
+	}
+
+	check := &LookupCheck{
+		Database:    database,
+		Table:       table,
+		Column:      lookup.Column,
+		LookupTable: lookup.Table,
+		Missing:     []*LookupEntry{},
+		Orphans:     []*LookupEntry{},
+	}
+	// The pairs of the table, the value is true once it's found in the lookup table.
+	var pairs []lookupPair
+	found := make(map[string]bool)
+	pairKey := func(pair lookupPair) string {
+		return sqlparser.String(pair.val) + "," + sqlparser.String(pair.key)
+	}
+	query := fmt.Sprintf("select %s, %s from %%s where %s is not null", sqlparser.Backtick(lookup.Column), sqlparser.Backtick(tconf.ShardKey), sqlparser.Backtick(lookup.Column))
+	err = spanner.streamLookupPairs(database, table, query, func(pair lookupPair) error {
+		key := pairKey(pair)
+		if _, ok := found[key]; !ok {
+			found[key] = false
+			pairs = append(pairs, pair)
+			check.Rows++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("spanner.lookup.check[%s.%s.%s].table.error:%+v", database, table, column, err)
+		return nil, err
+	}
+
+	var orphans []lookupPair
+	err = spanner.streamLookupPairs(database, lookup.Table, query, func(pair lookupPair) error {
+		key := pairKey(pair)
+		if _, ok := found[key]; !ok {
+			orphans = append(orphans, pair)
+		}
+		// The orphan is marked as found too to skip its duplicates.
+		found[key] = true
+		return nil
+	})
+	if err != nil {
+		log.Error("spanner.lookup.check[%s.%s.%s].lookup.table.error:%+v", database, table, column, err)
+		return nil, err
+	}
+
+	var missing []lookupPair
+	for _, pair := range pairs {
+		if !found[pairKey(pair)] {
+			missing = append(missing, pair)
+		}
+	}
+	entries := func(pairs []lookupPair) []*LookupEntry {
+		list := []*LookupEntry{}
+		for _, pair := range pairs {
+			if len(list) == limit {
+				check.Truncated = true
+				break
+			}
+			list = append(list, &LookupEntry{Value: string(pair.val.Val), Key: string(pair.key.Val)})
+		}
+		return list
+	}
+	check.Missing, check.Orphans = entries(missing), entries(orphans)
+
+	if repair {
+		if check.Repaired, err = spanner.repairLookup(database, tconf.ShardKey, lookup, missing, orphans); err != nil {
+			log.Error("spanner.lookup.check[%s.%s.%s].repair.error:%+v", database, table, column, err)
+			return nil, err
+		}
+	}
+	log.Info("spanner.lookup.check[%s.%s.%s].rows[%d].missing[%d].orphans[%d].repaired[%d]", database, table, column, check.Rows, len(missing), len(orphans), check.Repaired)
+	return check, nil
+}
+
+// streamLookupPairs used to read the pairs of the value and the shard key from the segments of the table,
+// the query has the '%s' of the segment.
+func (spanner *Spanner) streamLookupPairs(database, table string, query string, fn func(pair lookupPair) error) error {
+	segments, err := spanner.router.Lookup(database, table, nil, nil)
+	if err != nil {
+		return err
+	}
+	pools := spanner.scatter.PoolClone()
+	for _, segment := range segments {
+		pool, ok := pools[segment.Backend]
+		if !ok {
+			return errors.Errorf("lookup.check.can.not.find.backend[%s]", segment.Backend)
+		}
+		segQuery := fmt.Sprintf(query, fmt.Sprintf("%s.%s", sqlparser.Backtick(database), sqlparser.Backtick(segment.Table)))
+		err := streamRows(pool, segQuery, func(row []sqltypes.Value) error {
+			if len(row) < 2 || row[0].IsNull() || row[1].IsNull() {
+				return nil
+			}
+			return fn(lookupPair{val: shardKeySQLVal(row[0]), key: shardKeySQLVal(row[1])})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairLookup used to insert the missing into the lookup table and delete the orphans from it, the rows affected are returned.
+func (spanner *Spanner) repairLookup(database string, shardKey string, lookup *config.LookupConfig, missing, orphans []lookupPair) (uint64, error) {
+	var repaired uint64
+	for i := 0; i < len(missing); i += lookupBackfillBatch {
+		end := i + lookupBackfillBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+		rows := make(sqlparser.Values, 0, end-i)
+		for _, pair := range missing[i:end] {
+			rows = append(rows, sqlparser.ValTuple{pair.val, pair.key})
+		}
+		insert := lookupInsert(database, shardKey, lookup, rows)
+		insert.Ignore = sqlparser.IgnoreStr
+		qr, err := spanner.executeLookupQuery(database, sqlparser.String(insert))
+		if err != nil {
+			return repaired, err
+		}
+		repaired += qr.RowsAffected
+	}
+	for _, del := range lookupDeletes(database, shardKey, lookup, orphans) {
+		qr, err := spanner.executeLookupQuery(database, sqlparser.String(del))
+		if err != nil {
+			return repaired, err
+		}
+		repaired += qr.RowsAffected
+	}
+	return repaired, nil
+}
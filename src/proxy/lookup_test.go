@@ -0,0 +1,306 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyLookup(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+
+	keyResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+		},
+	}
+	rowsResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "a", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+			},
+		},
+	}
+	backfillResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "a", Type: querypb.Type_INT32},
+			{Name: "id", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+			},
+			{
+				sqltypes.NULL,
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2")),
+			},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select `a`, `id` from .* where `a` is not null", backfillResult)
+		fakedbs.AddQueryPattern("select .* from .*t1_a_.*", keyResult)
+		fakedbs.AddQueryPattern("select `id`, `a` from .* for update", rowsResult)
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("update .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("delete .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, a int, b int) partition by hash(id)",
+		"create table test.t1_a(a int, id int) partition by hash(a)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// Add the lookup.
+	{
+		rows, err := proxy.Spanner().AddLookup("test", "t1", "a", "t1_a")
+		assert.Nil(t, err)
+		assert.True(t, rows > 0)
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(tconf.Lookups))
+		assert.False(t, tconf.Lookups[0].Backfilling)
+		assert.Equal(t, "t1", route.LookupOwner("test", "t1_a"))
+
+		_, err = proxy.Spanner().AddLookup("test", "t1", "a", "t1_a")
+		assert.NotNil(t, err)
+	}
+
+	// Writes and selects.
+	{
+		querys := []string{
+			"insert into test.t1(id, a, b) values(1, 1, 1), (2, null, 2)",
+			"insert into test.t1(id, b) values(3, 3)",
+			"update test.t1 set a=3 where b=1",
+			"update test.t1 set a=null where b=1",
+			"update test.t1 set b=3 where b=1",
+			"delete from test.t1 where b=1",
+			"update test.t1 set b=3 where a=1",
+			"delete from test.t1 where a in (1, 2)",
+			"select * from test.t1 where a=1",
+			"select * from test.t1 as x where x.a in (1, 2)",
+			"select * from test.t1 where a=1 and id=1",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+	}
+
+	// Unsupported.
+	{
+		querys := []string{
+			"insert into test.t1(a, b) values(1, 1)",
+			"insert ignore into test.t1(id, a) values(1, 1)",
+			"replace into test.t1(id, a) values(1, 1)",
+			"insert into test.t1(id, a) values(1, 1) on duplicate key update b=1",
+			"insert into test.t1(id, a) select id, a from test.t1",
+			"insert into test.t1(id, a) values(1, b)",
+			"update test.t1 set a=b where id=1",
+			"update test.t1 set a=1 limit 1",
+			"delete from test.t1 limit 1",
+			"update test.t1, test.t1_a set t1.b=1 where t1.a=t1_a.a",
+			"drop table test.t1_a",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+		}
+	}
+
+	// The error of the lookup select.
+	{
+		fakedbs.AddQueryErrorPattern("select .* from .*t1_a_.*", errors.New("mock.lookup.select.error"))
+		_, err := client.FetchAll("select * from test.t1 where a=1", -1)
+		assert.NotNil(t, err)
+		fakedbs.ResetPatternErrors()
+	}
+
+	// Drop the lookup.
+	{
+		err := route.DropLookup("test", "t1", "a")
+		assert.Nil(t, err)
+		assert.Equal(t, "", route.LookupOwner("test", "t1_a"))
+		_, err = client.FetchAll("drop table test.t1_a", -1)
+		assert.Nil(t, err)
+	}
+}
+
+func TestProxyLookupBackfillError(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryErrorPattern("select .*", errors.New("mock.backfill.select.error"))
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, a int) partition by hash(id)",
+		"create table test.t1_a(a int, id int) partition by hash(a)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	_, err = proxy.Spanner().AddLookup("test", "t1", "a", "t1_a")
+	assert.NotNil(t, err)
+	tconf, err := proxy.Router().TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(tconf.Lookups))
+	assert.Equal(t, "", proxy.Router().LookupOwner("test", "t1_a"))
+}
+
+func TestProxyLookupCheck(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+
+	pairsResult := func(pairs ...string) *sqltypes.Result {
+		qr := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "a", Type: querypb.Type_INT32},
+				{Name: "id", Type: querypb.Type_INT32},
+			},
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte(pairs[i])),
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte(pairs[i+1])),
+			})
+		}
+		return qr
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select `a`, `id` from `test`.`t1_a_.*", pairsResult("1", "1", "3", "3"))
+		fakedbs.AddQueryPattern("select `a`, `id` from `test`.`t1_.*", pairsResult("1", "1", "2", "2"))
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("delete .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, a int) partition by hash(id)",
+		"create table test.t1_a(a int, id int) partition by hash(a)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// No lookup.
+	{
+		_, err := spanner.CheckLookup("test", "t1", "a", 100, false)
+		assert.NotNil(t, err)
+	}
+
+	_, err = spanner.AddLookup("test", "t1", "a", "t1_a")
+	assert.Nil(t, err)
+
+	// Check.
+	{
+		check, err := spanner.CheckLookup("test", "t1", "a", 100, false)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), check.Rows)
+		assert.Equal(t, []*LookupEntry{{Value: "2", Key: "2"}}, check.Missing)
+		assert.Equal(t, []*LookupEntry{{Value: "3", Key: "3"}}, check.Orphans)
+		assert.False(t, check.Truncated)
+		assert.Equal(t, uint64(0), check.Repaired)
+	}
+
+	// Truncated.
+	{
+		check, err := spanner.CheckLookup("test", "t1", "a", 0, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(check.Missing))
+		assert.Equal(t, 0, len(check.Orphans))
+		assert.True(t, check.Truncated)
+	}
+
+	// Repair.
+	{
+		fakedbs.ResetAll()
+		fakedbs.AddQueryPattern("select `a`, `id` from `test`.`t1_a_.*", pairsResult("1", "1", "3", "3"))
+		fakedbs.AddQueryPattern("select `a`, `id` from `test`.`t1_.*", pairsResult("1", "1", "2", "2"))
+		fakedbs.AddQueryPattern("insert ignore into test.t1_a_.*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("delete from test.t1_a_.* where a = 3 and id = 3", &sqltypes.Result{RowsAffected: 1})
+		check, err := spanner.CheckLookup("test", "t1", "a", 100, true)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), check.Repaired)
+	}
+
+	// The error of the repair.
+	{
+		fakedbs.AddQueryErrorPattern("delete .*", errors.New("mock.lookup.delete.error"))
+		_, err := spanner.CheckLookup("test", "t1", "a", 100, true)
+		assert.NotNil(t, err)
+		fakedbs.ResetPatternErrors()
+	}
+
+	// The error of the check.
+	{
+		fakedbs.AddQueryErrorPattern("select .*", errors.New("mock.lookup.check.error"))
+		_, err := spanner.CheckLookup("test", "t1", "a", 100, false)
+		assert.NotNil(t, err)
+		fakedbs.ResetPatternErrors()
+	}
+}
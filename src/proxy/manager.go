@@ -13,20 +13,26 @@ import (
 	"sync"
 	"time"
 
+	"backend"
 	"config"
+	"monitor"
+	"router"
 
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
 type Manager struct {
-	log      *xlog.Log
-	sessions *Sessions
-	conf     *config.ProxyConfig
-	done     chan bool
-	ticker   *time.Ticker
-	wg       sync.WaitGroup
-	mu       sync.RWMutex
+	log        *xlog.Log
+	sessions   *Sessions
+	scatter    *backend.Scatter
+	router     *router.Router
+	conf       *config.ProxyConfig
+	done       chan bool
+	ticker     *time.Ticker
+	skewTicker *time.Ticker
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
 }
 
 // https://www.percona.com/doc/percona-server/8.0/management/kill_idle_trx.html
@@ -51,6 +57,43 @@ func (mgr *Manager) killIdleTxn() error {
 	return nil
 }
 
+// https://dev.mysql.com/doc/refman/5.7/en/server-system-variables.html#sysvar_wait_timeout
+func (mgr *Manager) killIdleSession() error {
+	log := mgr.log
+	ss := mgr.sessions
+	ssIdle := ss.SnapshotIdle(mgr.conf.WaitTimeout, mgr.conf.InteractiveTimeout)
+
+	for _, si := range ssIdle {
+		log.Warning("the idle session will be killed, the session info is: %v:", si)
+		str := fmt.Sprintf("the session is idle for a long time: %d s, exceeds the wait timeout.", si.Time)
+		ss.Kill(si.ID, str)
+		monitor.IdleSessionKilledInc()
+	}
+	return nil
+}
+
+// checkConnLeak used to find the backend connections checked out but idle for a long time.
+func (mgr *Manager) checkConnLeak() error {
+	if mgr.conf.ConnLeakTimeout == 0 {
+		return nil
+	}
+	mgr.scatter.CheckLeaks(int64(mgr.conf.ConnLeakTimeout), mgr.conf.ConnLeakReclaim)
+	return nil
+}
+
+// checkSkew used to report the hot segments whose volume exceeds the skew threshold.
+func (mgr *Manager) checkSkew() {
+	log := mgr.log
+	if mgr.conf.SkewThreshold <= 0 {
+		return
+	}
+
+	for _, hot := range mgr.scatter.Skew().HotShards(mgr.conf.SkewThreshold, mgr.router.SegmentTable) {
+		log.Warning("manager.check.skew.hot.segment[%s].backend[%s].range[%s].reads[%d].writes[%d].ratio[%.2f].split.point[%s]",
+			hot.Table, hot.Backend, hot.Range, hot.Reads, hot.Writes, hot.Ratio, hot.SplitPoint)
+	}
+}
+
 func (mgr *Manager) manageMain() error {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -58,15 +101,26 @@ func (mgr *Manager) manageMain() error {
 	if err := mgr.killIdleTxn(); err != nil {
 		return err
 	}
+
+	if err := mgr.killIdleSession(); err != nil {
+		return err
+	}
+
+	if err := mgr.checkConnLeak(); err != nil {
+		return err
+	}
 	return nil
 }
 
 func (mgr *Manager) manage() {
 	defer mgr.ticker.Stop()
+	defer mgr.skewTicker.Stop()
 	for {
 		select {
 		case <-mgr.ticker.C:
 			mgr.manageMain()
+		case <-mgr.skewTicker.C:
+			mgr.checkSkew()
 		case <-mgr.done:
 			return
 		}
@@ -94,12 +148,15 @@ func (mgr *Manager) Close() {
 }
 
 // NewManager creates new Manager.
-func NewManager(log *xlog.Log, sessions *Sessions, conf *config.ProxyConfig) *Manager {
+func NewManager(log *xlog.Log, sessions *Sessions, scatter *backend.Scatter, router *router.Router, conf *config.ProxyConfig) *Manager {
 	return &Manager{
-		log:      log,
-		sessions: sessions,
-		conf:     conf,
-		done:     make(chan bool),
-		ticker:   time.NewTicker(time.Duration(time.Second)),
+		log:        log,
+		sessions:   sessions,
+		scatter:    scatter,
+		router:     router,
+		conf:       conf,
+		done:       make(chan bool),
+		ticker:     time.NewTicker(time.Duration(time.Second)),
+		skewTicker: time.NewTicker(time.Duration(time.Minute)),
 	}
 }
@@ -227,3 +227,34 @@ func TestKillIdleTxnLongQueryInExecuteSingle(t *testing.T) {
 	wg.Wait()
 	client1.Close()
 }
+
+func TestKillIdleSession(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	_, proxy, cleanup := MockProxy1(log, MockConfigWaitTimeout1())
+	defer cleanup()
+	address := proxy.Address()
+
+	// idle session.
+	client1, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client1.Close()
+
+	// session with wait_timeout.
+	client2, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client2.Close()
+	query := "set wait_timeout=100"
+	_, err = client2.FetchAll(query, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(proxy.sessions.Snapshot()))
+
+	time.Sleep(3 * time.Second)
+
+	infos := proxy.sessions.Snapshot()
+	assert.Equal(t, 1, len(infos))
+	assert.Equal(t, client2.ConnectionID(), infos[0].ID)
+
+	_, err = client1.FetchAll("select 1", -1)
+	assert.NotNil(t, err)
+}
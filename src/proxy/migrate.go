@@ -0,0 +1,188 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"net"
+	"time"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+)
+
+const (
+	// migratedStateTTL is the time the imported session state waits for the client to reconnect.
+	migratedStateTTL = 60 * time.Second
+)
+
+// SessionState tuple, the state of the client session migrated between the radons.
+// The Host is the client ip without the port, the client reconnected from it with the same user gets the state,
+// so the state may be given to the other session of the user on the host. The radon_shard_key_value which forces
+// the querys to the segments is never migrated.
+type SessionState struct {
+	User            string `json:"user"`
+	Host            string `json:"host"`
+	DB              string `json:"db"`
+	StreamingFetch  bool   `json:"streaming-fetch,omitempty"`
+	ConsistentRead  bool   `json:"consistent-read,omitempty"`
+	WaitTimeout     uint32 `json:"wait-timeout,omitempty"`
+	ReadConsistency string `json:"read-consistency,omitempty"`
+	ReadAsOf        string `json:"read-as-of,omitempty"`
+}
+
+// migratedState is the imported state waiting for the client.
+type migratedState struct {
+	state   *SessionState
+	expires time.Time
+}
+
+func migratedKey(user string, host string) string {
+	return user + "@" + host
+}
+
+// sessionHost returns the client ip of the session address.
+func sessionHost(s *driver.Session) string {
+	host, _, err := net.SplitHostPort(s.Addr())
+	if err != nil {
+		return s.Addr()
+	}
+	return host
+}
+
+// Export used to export the states of the idle sessions out of the transaction, the analyst endpoint sessions
+// are not exported. If close is true, the exported sessions are closed to reconnect to the other radon by the
+// load balancer, the sessions in the transaction or executing are left to drain.
+func (ss *Sessions) Export(close bool) []*SessionState {
+	var states []*SessionState
+	var closed []uint32
+
+	ss.mu.RLock()
+	for id, v := range ss.sessions {
+		v.mu.Lock()
+		if v.analyst || v.transaction != nil || v.node != nil {
+			v.mu.Unlock()
+			continue
+		}
+		state := &SessionState{
+			User:            v.session.User(),
+			Host:            sessionHost(v.session),
+			DB:              v.session.Schema(),
+			StreamingFetch:  v.getStreamingFetchVar(),
+			ConsistentRead:  v.getConsistentReadVar(),
+			WaitTimeout:     v.waitTimeout,
+			ReadConsistency: v.readConsistency,
+		}
+		// The watermark ids are local to the radon.
+		if v.readAsOf == readAsOfLatest {
+			state.ReadAsOf = v.readAsOf
+		}
+		v.mu.Unlock()
+		states = append(states, state)
+		closed = append(closed, id)
+	}
+	ss.mu.RUnlock()
+
+	if close {
+		for _, id := range closed {
+			ss.Kill(id, "session.migrated")
+		}
+	}
+	return states
+}
+
+// Import used to import the states exported by the other radon, they're given to the clients reconnected
+// from the same host with the same user in the migratedStateTTL, one state for one session.
+func (ss *Sessions) Import(states []*SessionState) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.migrated == nil {
+		ss.migrated = make(map[string][]*migratedState)
+	}
+	expires := ss.now().Add(migratedStateTTL)
+	for _, state := range states {
+		key := migratedKey(state.User, state.Host)
+		ss.migrated[key] = append(ss.migrated[key], &migratedState{state: state, expires: expires})
+	}
+}
+
+// Migrated returns the imported states not given to the clients and not expired.
+func (ss *Sessions) Migrated() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.expireMigrated()
+	n := 0
+	for _, states := range ss.migrated {
+		n += len(states)
+	}
+	return n
+}
+
+// expireMigrated used to drop the expired imported states, the caller must hold the lock.
+func (ss *Sessions) expireMigrated() {
+	now := ss.now()
+	for key, states := range ss.migrated {
+		var alive []*migratedState
+		for _, state := range states {
+			if now.Before(state.expires) {
+				alive = append(alive, state)
+			}
+		}
+		if len(alive) == 0 {
+			delete(ss.migrated, key)
+		} else {
+			ss.migrated[key] = alive
+		}
+	}
+}
+
+// takeMigrated returns the imported state of the session's user and host, nil if there's none.
+func (ss *Sessions) takeMigrated(s *driver.Session) *SessionState {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.migrated) == 0 {
+		return nil
+	}
+	ss.expireMigrated()
+	key := migratedKey(s.User(), sessionHost(s))
+	states := ss.migrated[key]
+	if len(states) == 0 {
+		return nil
+	}
+	if len(states) == 1 {
+		delete(ss.migrated, key)
+	} else {
+		ss.migrated[key] = states[1:]
+	}
+	return states[0].state
+}
+
+// restoreSession used to give the imported state to the session reconnected, the database chosen by the client
+// at the login takes precedence over the migrated one.
+func (spanner *Spanner) restoreSession(s *driver.Session) {
+	log := spanner.log
+	txSession := spanner.sessions.getTxnSession(s)
+	if txSession == nil || txSession.analyst {
+		return
+	}
+	state := spanner.sessions.takeMigrated(s)
+	if state == nil {
+		return
+	}
+
+	if s.Schema() == "" && state.DB != "" {
+		if spanner.router.DatabaseExists(state.DB) {
+			s.SetSchema(state.DB)
+		}
+	}
+	txSession.setStreamingFetchVar(state.StreamingFetch)
+	txSession.setConsistentReadVar(state.ConsistentRead)
+	txSession.setWaitTimeoutVar(state.WaitTimeout)
+	txSession.setReadConsistencyVar(state.ReadConsistency)
+	txSession.setReadAsOfVar(state.ReadAsOf)
+	log.Warning("proxy.session[%v].restored.migrated.state:%+v", s.ID(), state)
+}
@@ -0,0 +1,125 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"fakedb"
+	"xbase"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxySessionsMigrate(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	proxy.SetClock(clock)
+	sessions := proxy.Sessions()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("xa .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("use .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+
+	// The session to be migrated.
+	migrated, err := driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+	assert.Nil(t, err)
+	defer migrated.Close()
+	querys := []string{
+		"set radon_streaming_fetch = 'ON'",
+		"set wait_timeout = 100",
+		"set radon_read_consistency = 'primary'",
+		"set radon_consistent_read = 'ON'",
+		"set radon_read_as_of = 'latest'",
+		"set radon_shard_key_value = 1",
+	}
+	for _, query := range querys {
+		_, err = migrated.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// The session in the transaction is not exported.
+	proxy.conf.Proxy.TwopcEnable = true
+	_, err = client.FetchAll("begin", -1)
+	assert.Nil(t, err)
+
+	// Export.
+	var states []*SessionState
+	{
+		states = sessions.Export(true)
+		assert.Equal(t, 1, len(states))
+		assert.Equal(t, &SessionState{
+			User:            "mock",
+			Host:            "127.0.0.1",
+			DB:              "test",
+			StreamingFetch:  true,
+			WaitTimeout:     100,
+			ReadConsistency: "primary",
+			ConsistentRead:  true,
+			ReadAsOf:        "latest",
+		}, states[0])
+		assert.Nil(t, sessions.getSession(migrated.ConnectionID()))
+		assert.NotNil(t, sessions.getSession(client.ConnectionID()))
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+	}
+
+	// Import and reconnect.
+	{
+		sessions.Import(states)
+		assert.Equal(t, 1, sessions.Migrated())
+		reconnected, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+		assert.Nil(t, err)
+		defer reconnected.Close()
+		assert.Equal(t, 0, sessions.Migrated())
+
+		session := sessions.getSession(reconnected.ConnectionID())
+		assert.Equal(t, "test", session.session.Schema())
+		assert.True(t, session.getStreamingFetchVar())
+		assert.Equal(t, uint32(100), session.waitTimeout)
+		consistency, _ := session.getReadConsistencyVar()
+		assert.Equal(t, "primary", consistency)
+		assert.True(t, session.getConsistentReadVar())
+		asOf, _ := session.getReadAsOfVar()
+		assert.Equal(t, "latest", asOf)
+		// The radon_shard_key_value is not migrated.
+		assert.Nil(t, session.shardKeyValue)
+
+		// The next one is not migrated.
+		other, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+		assert.Nil(t, err)
+		defer other.Close()
+		session = sessions.getSession(other.ConnectionID())
+		assert.Equal(t, "", session.session.Schema())
+		assert.False(t, session.getStreamingFetchVar())
+	}
+
+	// Expired.
+	{
+		sessions.Import(states)
+		clock.Advance(migratedStateTTL)
+		assert.Equal(t, 0, sessions.Migrated())
+	}
+}
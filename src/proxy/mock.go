@@ -111,12 +111,19 @@ func MockProxy(log *xlog.Log) (*fakedb.DB, *Proxy, func()) {
 
 // MockProxy1 mocks the proxy with config.
 func MockProxy1(log *xlog.Log, conf *config.Config) (*fakedb.DB, *Proxy, func()) {
+	return mockProxy(log, conf, fakedb.New(log, 5))
+}
+
+// MockProxyMariaDB mocks the proxy with the MariaDB backends.
+func MockProxyMariaDB(log *xlog.Log, conf *config.Config) (*fakedb.DB, *Proxy, func()) {
+	return mockProxy(log, conf, fakedb.NewMariaDB(log, 5))
+}
+
+func mockProxy(log *xlog.Log, conf *config.Config, fakedbs *fakedb.DB) (*fakedb.DB, *Proxy, func()) {
 	tmpDir := fakedb.GetTmpDir("", "radon_mock_", log)
 
 	// set Blocks 128
 	conf.Router.Blocks = 128
-	// Fake backends.
-	fakedbs := fakedb.New(log, 5)
 
 	port := randomPort(15000, 20000)
 	addr := fmt.Sprintf(":%d", port)
@@ -128,6 +135,7 @@ func MockProxy1(log *xlog.Log, conf *config.Config) (*fakedb.DB, *Proxy, func())
 	timestamp := t.Format(fileFormat)
 	metaDir := tmpDir + "/test_radonmeta_" + timestamp
 	conf.Proxy.MetaDir = metaDir
+	conf.Proxy.DDLJournalDir = tmpDir + "/test_radon_ddl_journal_" + timestamp
 
 	if x := os.MkdirAll(metaDir, 0777); x != nil {
 		log.Panic("%+v", x)
@@ -171,6 +179,7 @@ func MockProxyPrivilegeN(log *xlog.Log, conf *config.Config) (*fakedb.DB, *Proxy
 	timestamp := t.Format(fileFormat)
 	metaDir := tmpDir + "/test_radonmeta_" + timestamp
 	conf.Proxy.MetaDir = metaDir
+	conf.Proxy.DDLJournalDir = tmpDir + "/test_radon_ddl_journal_" + timestamp
 
 	if x := os.MkdirAll(metaDir, 0777); x != nil {
 		log.Panic("%+v", x)
@@ -213,6 +222,7 @@ func MockProxyPrivilegeNotSuper(log *xlog.Log, conf *config.Config) (*fakedb.DB,
 	timestamp := t.Format(fileFormat)
 	metaDir := tmpDir + "/test_radonmeta_" + timestamp
 	conf.Proxy.MetaDir = metaDir
+	conf.Proxy.DDLJournalDir = tmpDir + "/test_radon_ddl_journal_" + timestamp
 
 	if x := os.MkdirAll(metaDir, 0777); x != nil {
 		log.Panic("%+v", x)
@@ -255,6 +265,7 @@ func MockProxyPrivilegeUsers(log *xlog.Log, conf *config.Config) (*fakedb.DB, *P
 	timestamp := t.Format(fileFormat)
 	metaDir := tmpDir + "/test_radonmeta_" + timestamp
 	conf.Proxy.MetaDir = metaDir
+	conf.Proxy.DDLJournalDir = tmpDir + "/test_radon_ddl_journal_" + timestamp
 
 	if x := os.MkdirAll(metaDir, 0777); x != nil {
 		log.Panic("%+v", x)
@@ -278,6 +289,14 @@ func MockProxyPrivilegeUsers(log *xlog.Log, conf *config.Config) (*fakedb.DB, *P
 	}
 }
 
+// MockConfigWaitTimeout1 mocks the config with WaitTimeout=1 and InteractiveTimeout=1.
+func MockConfigWaitTimeout1() *config.Config {
+	conf := MockDefaultConfig()
+	conf.Proxy.WaitTimeout = 1        // 1s
+	conf.Proxy.InteractiveTimeout = 1 // 1s
+	return conf
+}
+
 // MockConfigIdleTxnTimeout1 mocks the config with IdleTxnTimeout=1.
 func MockConfigIdleTxnTimeout1() *config.Config {
 	conf := MockDefaultConfig()
@@ -0,0 +1,40 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"planner"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// multiTableDMLNode returns the statement of the multi-table DELETE or UPDATE which the parser doesn't support,
+// the privilege is checked on the databases of all the tables here, the statement is the DML on the first target
+// and the plan is built from the query.
+func (spanner *Spanner) multiTableDMLNode(session *driver.Session, query string) (sqlparser.Statement, error) {
+	dml, err := planner.ParseMultiTableDML(query)
+	if err != nil {
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+	}
+	node := dml.Node()
+
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	for _, table := range dml.Tables() {
+		db := session.Schema()
+		if !table.Qualifier.IsEmpty() {
+			db = table.Qualifier.String()
+		}
+		if !privilegePlug.CheckPrivilege(db, session.User(), node) {
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'@'%%' to database '%v'", session.User(), db)
+		}
+	}
+	return node, nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyMultiTableDML(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("delete .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("update .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.t2(id int, b int) partition by hash(id)",
+		"create table test.t3(id int, b int) single",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// Co-located.
+	{
+		_, err = client.FetchAll("delete t1 from test.t1 join test.t2 on t1.id=t2.id where t1.id=1", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("update test.t1 join test.g1 on t1.b=g1.id set t1.b=g1.b where t1.id=1", -1)
+		assert.Nil(t, err)
+
+		// The session database.
+		client1, err := driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+		assert.Nil(t, err)
+		defer client1.Close()
+		_, err = client1.FetchAll("delete from t1, t2 using t1, t2 where t1.id=t2.id and t1.id=1", -1)
+		assert.Nil(t, err)
+
+		// Explain.
+		qr, err := client1.FetchAll("explain format=json update t1 join t2 on t1.id=t2.id set t2.b=1 where t1.id=1", -1)
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(qr.Rows[0][0].String(), `"statement": "update"`))
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"delete t1 from test.t1 join test.t3 on t1.id=t3.id where t1.id=1",
+			"delete g1 from test.t1 join test.g1 on t1.b=g1.id where t1.id=1",
+			"update test.t1, test.t2 set t1.id=2 where t1.id=t2.id and t1.id=1",
+			"delete t1 from t1 join t2 on t1.id=t2.id",
+		}
+		wants := []string{
+			"unsupported: multi.table.delete.on.the.tables.not.co-located (errno 1105) (sqlstate HY000)",
+			"unsupported: multi.table.delete.on.the.global.table[g1] (errno 1105) (sqlstate HY000)",
+			"unsupported: cannot.update.shard.key (errno 1105) (sqlstate HY000)",
+			"No database selected (errno 1046) (sqlstate 3D000)",
+		}
+		for i, query := range querys {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, wants[i], err.Error(), query)
+			}
+		}
+	}
+}
+
+func TestProxyMultiTableDMLPrivilegeN(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxyPrivilegeN(log, MockDefaultConfig())
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("delete t1 from test.t1 join test.t2 on t1.id=t2.id where t1.id=1", -1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Access denied for user 'mock'@'%' to database 'test'")
+}
@@ -9,14 +9,28 @@
 package proxy
 
 import (
+	"regexp"
+
 	"backend"
 
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
+// The transaction states of the session tracker.
+const (
+	txnStateNone     = "________"
+	txnStateExplicit = "T_______"
+)
+
+var (
+	// The parser drops the transaction characteristics.
+	txnReadOnlyRegexp = regexp.MustCompile(`(?is)^start\s+transaction\s.*\bread\s+only\b`)
+)
+
 func (spanner *Spanner) handleMultiStmtTxn(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	var err error
 	var qr *sqltypes.Result
@@ -24,7 +38,7 @@ func (spanner *Spanner) handleMultiStmtTxn(session *driver.Session, query string
 	snode := node.(*sqlparser.Transaction)
 	switch snode.Action {
 	case sqlparser.StartTxnStr:
-		qr, err = spanner.handleStartTransaction(session, snode.Action, node)
+		qr, err = spanner.handleStartTransaction(session, query, node)
 	case sqlparser.BeginTxnStr:
 		qr, err = spanner.handleBegin(session, snode.Action, node)
 	case sqlparser.RollbackTxnStr:
@@ -38,9 +52,14 @@ func (spanner *Spanner) handleMultiStmtTxn(session *driver.Session, query string
 	return qr, err
 }
 
-// handleStartTransaction used to handle Multi-statement transaction "start transaction"
+// handleStartTransaction used to handle Multi-statement transaction "start transaction",
+// the READ ONLY transaction is flagged in the server status.
 func (spanner *Spanner) handleStartTransaction(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
-	return spanner.ExecuteBegin(session, query, node)
+	qr, err := spanner.ExecuteBegin(session, sqlparser.StartTxnStr, node)
+	if err == nil && txnReadOnlyRegexp.MatchString(query) {
+		session.SetStatusFlags(sqldb.SERVER_STATUS_IN_TRANS_READONLY)
+	}
+	return qr, err
 }
 
 // handleBegin used to handle Multi-statement transaction "begin"
@@ -91,7 +110,11 @@ func (spanner *Spanner) ExecuteBegin(session *driver.Session, query string, node
 	}
 	txn.SetTimeout(conf.Proxy.QueryTimeout)
 	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetMaxResultRows(spanner.maxResultRows(session.User()))
 	txn.SetMaxJoinRows(conf.Proxy.MaxJoinRows)
+	txn.SetMaxDMLRows(conf.Proxy.MaxDMLRows)
+	txn.SetQueryTag(spanner.queryTag(session.User(), session.ID()))
+	spanner.setAnalystLimits(session, txn)
 	txn.SetMultiStmtTxn()
 
 	sessions.MultiStmtTxnBinding(session, txn, node, query)
@@ -101,6 +124,11 @@ func (spanner *Spanner) ExecuteBegin(session *driver.Session, query string, node
 		log.Error("spanner.execute.multistmt.txn.begin.scatter.error:[%v]", err)
 		return nil, err
 	}
+	session.TrackTransactionState(txnStateExplicit)
+	session.SetStatusFlags(sqldb.SERVER_STATUS_IN_TRANS)
+	if spanner.ReadOnly() {
+		session.SetStatusFlags(sqldb.SERVER_STATUS_IN_TRANS_READONLY)
+	}
 
 	qr := &sqltypes.Result{}
 	return qr, nil
@@ -137,6 +165,8 @@ func (spanner *Spanner) ExecuteRollback(session *driver.Session, query string, n
 
 	sessions.MultiStmtTxnUnBinding(session, true)
 	txn.Finish()
+	session.TrackTransactionState(txnStateNone)
+	session.ClearStatusFlags(sqldb.SERVER_STATUS_IN_TRANS | sqldb.SERVER_STATUS_IN_TRANS_READONLY)
 	qr := &sqltypes.Result{}
 	return qr, nil
 }
@@ -172,6 +202,8 @@ func (spanner *Spanner) ExecuteCommit(session *driver.Session, query string, nod
 
 	sessions.MultiStmtTxnUnBinding(session, true)
 	txn.Finish()
+	session.TrackTransactionState(txnStateNone)
+	session.ClearStatusFlags(sqldb.SERVER_STATUS_IN_TRANS | sqldb.SERVER_STATUS_IN_TRANS_READONLY)
 	qr := &sqltypes.Result{}
 	return qr, nil
 }
@@ -17,6 +17,7 @@ import (
 	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -643,3 +644,54 @@ func TestProxyHandleMStmtTxnNOUseDB(t *testing.T) {
 
 	client1.Close()
 }
+
+func TestProxyHandleMStmtTxnStatusFlags(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	proxy.SetTwoPC(true)
+	fakedbs.AddQueryPattern("XA .*", result1)
+
+	query, closeConn := mockSessionTrackConn(t, proxy.Address())
+	defer closeConn()
+	inTrans := uint16(sqldb.SERVER_STATUS_IN_TRANS | sqldb.SERVER_STATUS_IN_TRANS_READONLY)
+
+	// Read write transaction.
+	{
+		ok, err := query("begin")
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(sqldb.SERVER_STATUS_IN_TRANS), ok.StatusFlags&inTrans)
+
+		ok, err = query("commit")
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(0), ok.StatusFlags&inTrans)
+	}
+
+	// Read only transaction.
+	{
+		ok, err := query("start transaction read only")
+		assert.Nil(t, err)
+		assert.Equal(t, inTrans, ok.StatusFlags&inTrans)
+
+		_, err = query("insert into test.t1(id, b) values(1, 1)")
+		want := "Cannot execute statement in a READ ONLY transaction. (errno 1792) (sqlstate 25006)"
+		assert.Equal(t, want, err.Error())
+
+		ok, err = query("rollback")
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(0), ok.StatusFlags&inTrans)
+	}
+
+	// The transaction in radon readonly mode.
+	{
+		proxy.SetReadOnly(true)
+		ok, err := query("start transaction read write")
+		assert.Nil(t, err)
+		assert.Equal(t, inTrans, ok.StatusFlags&inTrans)
+
+		ok, err = query("commit")
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(0), ok.StatusFlags&inTrans)
+	}
+}
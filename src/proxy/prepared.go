@@ -0,0 +1,193 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"container/list"
+	"context"
+
+	"optimizer"
+	"planner"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+)
+
+// preparedArg is the parameter of the prepared statement, its value is bound in place.
+type preparedArg struct {
+	name string
+	val  *sqlparser.SQLVal
+}
+
+// preparedStmt is the prepared statement cached by the session, keyed by the query with the parameters.
+type preparedStmt struct {
+	query    string
+	database string
+
+	// node is parsed from the query once, the parameters in it are bound by every execution.
+	node sqlparser.Statement
+	args []preparedArg
+
+	// parsed generates the query with the parameters bound.
+	parsed *sqlparser.ParsedQuery
+
+	// plan is nil if the statement isn't routed by the parameter, it's parsed and planned after the parameters are bound.
+	plan *planner.PreparedPlan
+}
+
+// preparedBinding is the prepared statement bound by the executing query.
+type preparedBinding struct {
+	stmt  *preparedStmt
+	node  sqlparser.Statement
+	query string
+	plans *planner.PlanTree
+	// used is true if the plans are executed, else the node may have been planned by the others.
+	used bool
+}
+
+// preparedStmts is the LRU of the prepared statements of the session, it's only accessed by the session.
+type preparedStmts struct {
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+	binding *preparedBinding
+}
+
+func newPreparedStmts(size int) *preparedStmts {
+	return &preparedStmts{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (ps *preparedStmts) get(query string) *preparedStmt {
+	elem, ok := ps.entries[query]
+	if !ok {
+		return nil
+	}
+	ps.lru.MoveToFront(elem)
+	return elem.Value.(*preparedStmt)
+}
+
+func (ps *preparedStmts) put(stmt *preparedStmt) {
+	if elem, ok := ps.entries[stmt.query]; ok {
+		elem.Value = stmt
+		ps.lru.MoveToFront(elem)
+		return
+	}
+	ps.entries[stmt.query] = ps.lru.PushFront(stmt)
+	for ps.lru.Len() > ps.size {
+		oldest := ps.lru.Back()
+		ps.lru.Remove(oldest)
+		delete(ps.entries, oldest.Value.(*preparedStmt).query)
+	}
+}
+
+// newPreparedStmt used to parse and plan the prepared statement, the plan is nil if it can't be routed by the parameter.
+func (spanner *Spanner) newPreparedStmt(database string, query string) *preparedStmt {
+	stmt := &preparedStmt{query: query, database: database}
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return stmt
+	}
+	switch node.(type) {
+	case *sqlparser.Select, *sqlparser.Update, *sqlparser.Delete:
+	default:
+		return stmt
+	}
+	plan, err := planner.NewPreparedPlan(spanner.log, database, query, spanner.router)
+	if err != nil {
+		spanner.log.Debug("spanner.prepared.stmt[%s].not.cached:%v", query, err)
+		return stmt
+	}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if val, ok := node.(*sqlparser.SQLVal); ok && val.Type == sqlparser.ValArg {
+			stmt.args = append(stmt.args, preparedArg{name: string(val.Val[1:]), val: val})
+		}
+		return true, nil
+	}, node)
+	// The bind locations are taken before the parameters are bound.
+	stmt.node, stmt.parsed, stmt.plan = node, sqlparser.NewParsedQuery(node), plan
+	return stmt
+}
+
+// bindPrepared used to bind the parameters to the cached prepared statement, the binding is nil if the statement
+// should be parsed and planned after the parameters are bound, such as it isn't routed by the parameter or
+// the parameter is NULL. The caller must unbind it after the execution.
+func (spanner *Spanner) bindPrepared(session *driver.Session, query string, bindVariables map[string]*querypb.BindVariable) *preparedBinding {
+	size := spanner.conf.Proxy.PreparedPlanCacheSize
+	if bindVariables == nil || size <= 0 {
+		return nil
+	}
+	txSession := spanner.sessions.getTxnSession(session)
+	if txSession == nil {
+		return nil
+	}
+	if txSession.prepared == nil {
+		txSession.prepared = newPreparedStmts(size)
+	}
+	database := session.Schema()
+	stmts := txSession.prepared
+	stmt := stmts.get(query)
+	if stmt == nil || stmt.database != database || (stmt.plan != nil && !stmt.plan.Valid()) {
+		stmt = spanner.newPreparedStmt(database, query)
+		stmts.put(stmt)
+	}
+	if stmt.plan == nil {
+		return nil
+	}
+
+	for _, arg := range stmt.args {
+		bv, ok := bindVariables[arg.name]
+		if !ok {
+			return nil
+		}
+		val, ok := planner.BindVarSQLVal(bv)
+		if !ok {
+			return nil
+		}
+		arg.val.Type, arg.val.Val = val.Type, val.Val
+	}
+	extras := hexBindVariables(bindVariables)
+	bound, err := stmt.parsed.GenerateQuery(bindVariables, extras)
+	if err != nil {
+		return nil
+	}
+	plans, err := stmt.plan.Bind(bound, bindVariables, extras)
+	if err != nil {
+		spanner.log.Debug("spanner.prepared.stmt[%s].bind.error:%v", query, err)
+		return nil
+	}
+	stmts.binding = &preparedBinding{stmt: stmt, node: stmt.node, query: bound, plans: plans}
+	return stmts.binding
+}
+
+// unbindPrepared used to unbind the prepared statement after the execution. The statement whose plans aren't used
+// is executed by the other ways such as the streaming fetch, it isn't bound any more.
+func (spanner *Spanner) unbindPrepared(session *driver.Session, binding *preparedBinding) {
+	if !binding.used {
+		binding.stmt.node, binding.stmt.args, binding.stmt.plan = nil, nil, nil
+	}
+	if txSession := spanner.sessions.getTxnSession(session); txSession != nil && txSession.prepared != nil {
+		txSession.prepared.binding = nil
+	}
+}
+
+// buildPlanTree used to build the plan tree of the query, the plans of the prepared statement bound to the node are used if there're.
+func (spanner *Spanner) buildPlanTree(ctx context.Context, session *driver.Session, database string, query string, node sqlparser.Statement) (*planner.PlanTree, error) {
+	if txSession := spanner.sessions.getTxnSession(session); txSession != nil && txSession.prepared != nil {
+		if binding := txSession.prepared.binding; binding != nil && binding.node == node && binding.stmt.database == database {
+			binding.used = true
+			return binding.plans, nil
+		}
+	}
+	return optimizer.NewSimpleOptimizer(spanner.log, database, query, node, spanner.router).BuildPlanTreeContext(ctx)
+}
@@ -0,0 +1,300 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyPreparedPlanCache(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("update .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("delete .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	for _, query := range []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	} {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// segmentOf returns the segment of the id.
+	segmentOf := func(id string) string {
+		val := sqlparser.NewIntVal([]byte(id))
+		segments, err := route.Lookup("test", "t1", val, val)
+		assert.Nil(t, err)
+		return segments[0].Table
+	}
+	// preparedOf returns the prepared statement cached by the session.
+	preparedOf := func(query string) *preparedStmt {
+		for _, s := range spanner.sessions.sessions {
+			if s.prepared != nil {
+				if elem, ok := s.prepared.entries[query]; ok {
+					return elem.Value.(*preparedStmt)
+				}
+			}
+		}
+		return nil
+	}
+
+	conn, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// The executions are routed by the bound shard key.
+	{
+		tests := []struct {
+			query   string
+			backend string
+		}{
+			{"select * from t1 where id=?", "select * from test.%s as t1 where id = %s"},
+			{"update t1 set b=2 where id=?", "update test.%s set b = 2 where id = %s"},
+			{"delete from t1 where id=?", "delete from test.%s where id = %s"},
+		}
+		for _, test := range tests {
+			stmt, err := conn.ComStatementPrepare(test.query)
+			assert.Nil(t, err)
+			for _, id := range []string{"1", "7", "19"} {
+				params := []sqltypes.Value{sqltypes.MakeTrusted(sqltypes.Int32, []byte(id))}
+				_, err := stmt.ComStatementQuery(params)
+				assert.Nil(t, err, test.query)
+				backend := fmt.Sprintf(test.backend, segmentOf(id), id)
+				assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+			}
+			stmt.ComStatementClose()
+
+			cached := preparedOf(test.query)
+			assert.NotNil(t, cached, test.query)
+			assert.NotNil(t, cached.plan, test.query)
+		}
+	}
+
+	// The statement isn't routed by the parameter is executed as before.
+	{
+		for _, query := range []string{
+			"select * from t1 where b=?",
+			"insert into t1(id, b) values(?, 2)",
+		} {
+			stmt, err := conn.ComStatementPrepare(query)
+			assert.Nil(t, err)
+			params := []sqltypes.Value{sqltypes.MakeTrusted(sqltypes.Int32, []byte("3"))}
+			_, err = stmt.ComStatementQuery(params)
+			assert.Nil(t, err, query)
+			stmt.ComStatementClose()
+
+			cached := preparedOf(query)
+			assert.NotNil(t, cached, query)
+			assert.Nil(t, cached.plan, query)
+		}
+		backend := fmt.Sprintf("insert into test.%s(id, b) values (3, 2)", segmentOf("3"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+	}
+
+	// The plan is built again after the table is changed.
+	{
+		query := "select * from t1 where id=?"
+		old := preparedOf(query).plan
+		for _, query := range []string{
+			"drop table test.t1",
+			"create table test.t1(id int, b int) partition by hash(id) partitions 7",
+		} {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+
+		stmt, err := conn.ComStatementPrepare(query)
+		assert.Nil(t, err)
+		params := []sqltypes.Value{sqltypes.MakeTrusted(sqltypes.Int32, []byte("5"))}
+		_, err = stmt.ComStatementQuery(params)
+		assert.Nil(t, err)
+		stmt.ComStatementClose()
+		backend := fmt.Sprintf("select * from test.%s as t1 where id = 5", segmentOf("5"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+		assert.NotEqual(t, old, preparedOf(query).plan)
+	}
+
+	// Disabled.
+	{
+		spanner.conf.Proxy.PreparedPlanCacheSize = 0
+		conn, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer conn.Close()
+		query := "select * from t1 where id=? and b=1"
+		stmt, err := conn.ComStatementPrepare(query)
+		assert.Nil(t, err)
+		params := []sqltypes.Value{sqltypes.MakeTrusted(sqltypes.Int32, []byte("5"))}
+		_, err = stmt.ComStatementQuery(params)
+		assert.Nil(t, err)
+		stmt.ComStatementClose()
+		assert.Nil(t, preparedOf(query))
+	}
+}
+
+func TestProxyPreparedStmtsLRU(t *testing.T) {
+	stmts := newPreparedStmts(2)
+	for _, query := range []string{"q1", "q2", "q3"} {
+		stmts.put(&preparedStmt{query: query})
+		if query == "q2" {
+			assert.NotNil(t, stmts.get("q1"))
+		}
+	}
+	assert.NotNil(t, stmts.get("q1"))
+	assert.Nil(t, stmts.get("q2"))
+	assert.NotNil(t, stmts.get("q3"))
+	assert.Equal(t, 2, stmts.lru.Len())
+}
+
+func TestProxyStmtCursorAndLongData(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+
+	result := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+		},
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		result.Rows = append(result.Rows, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id))})
+	}
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", result)
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	for _, query := range []string{
+		"create database test",
+		"create table test.t1(id int, b varchar(64)) partition by hash(id)",
+	} {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	conn, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// The rows are fetched by the cursor.
+	{
+		stmt, err := conn.ComStatementPrepare("select * from t1 where id=?")
+		assert.Nil(t, err)
+		_, err = stmt.ComStatementOpenCursor([]sqltypes.Value{sqltypes.NewInt32(1)})
+		assert.Nil(t, err)
+		qr, last, err := stmt.ComStatementFetch(2)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(qr.Rows))
+		assert.False(t, last)
+		qr, last, err = stmt.ComStatementFetch(2)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Rows))
+		assert.True(t, last)
+		stmt.ComStatementClose()
+	}
+
+	// The select of the cursor is streamed if the rows need no merging, the streaming isn't limited by the max result rows.
+	{
+		proxy.SetMaxResultRows(10)
+		stmt, err := conn.ComStatementPrepare("select * from t1")
+		assert.Nil(t, err)
+		_, err = stmt.ComStatementOpenCursor(nil)
+		assert.Nil(t, err)
+		rows := 0
+		for {
+			qr, last, err := stmt.ComStatementFetch(50)
+			assert.Nil(t, err)
+			rows += len(qr.Rows)
+			if last {
+				break
+			}
+		}
+		assert.Equal(t, 90, rows)
+		stmt.ComStatementClose()
+
+		stmt, err = conn.ComStatementPrepare("select * from t1 order by id")
+		assert.Nil(t, err)
+		_, err = stmt.ComStatementOpenCursor(nil)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "max result rows[10] exceeded")
+		stmt.ComStatementClose()
+		proxy.SetMaxResultRows(0)
+	}
+
+	// The streaming fetch is streamed by the cursor.
+	{
+		_, err := conn.FetchAll("set @@SESSION.radon_streaming_fetch='ON'", -1)
+		assert.Nil(t, err)
+		stmt, err := conn.ComStatementPrepare("select * from t1")
+		assert.Nil(t, err)
+		_, err = stmt.ComStatementOpenCursor(nil)
+		assert.Nil(t, err)
+		rows := 0
+		for {
+			qr, last, err := stmt.ComStatementFetch(50)
+			assert.Nil(t, err)
+			rows += len(qr.Rows)
+			if last {
+				break
+			}
+		}
+		assert.Equal(t, 90, rows)
+		stmt.ComStatementClose()
+	}
+
+	// The long data is bound to the parameter.
+	{
+		stmt, err := conn.ComStatementPrepare("insert into t1(id, b) values(?, ?)")
+		assert.Nil(t, err)
+		assert.Nil(t, stmt.ComStatementSendLongData(1, []byte("long.")))
+		assert.Nil(t, stmt.ComStatementSendLongData(1, []byte("value")))
+		params := []sqltypes.Value{sqltypes.NewInt32(3), sqltypes.NewVarChar("")}
+		err = stmt.ComStatementExecute(params)
+		assert.Nil(t, err)
+		stmt.ComStatementClose()
+
+		val := sqlparser.NewIntVal([]byte("3"))
+		segments, err := route.Lookup("test", "t1", val, val)
+		assert.Nil(t, err)
+		backend := fmt.Sprintf("insert into test.%s(id, b) values (3, 'long.value')", segments[0].Table)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+	}
+}
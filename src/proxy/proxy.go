@@ -9,11 +9,13 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"sync"
 
 	"audit"
 	"backend"
 	"config"
+	"pgwire"
 	"plugins"
 	"router"
 	"syncer"
@@ -30,6 +32,7 @@ type Proxy struct {
 	conf          *config.Config
 	confPath      string
 	audit         *audit.Audit
+	access        *audit.Access
 	router        *router.Router
 	scatter       *backend.Scatter
 	syncer        *syncer.Syncer
@@ -38,12 +41,18 @@ type Proxy struct {
 	spanner       *Spanner
 	sessions      *Sessions
 	listener      *driver.Listener
+	analyst       *driver.Listener
+	pgListener    *pgwire.Listener
 	throttle      *xbase.Throttle
 	serverVersion string
 }
 
 // NewProxy creates new proxy.
 func NewProxy(log *xlog.Log, path string, serverVersion string, conf *config.Config) *Proxy {
+	var access *audit.Access
+	if conf.Access != nil {
+		access = audit.NewAccess(log, conf.Access)
+	}
 	audit := audit.NewAudit(log, conf.Audit)
 	router := router.NewRouter(log, conf.Proxy.MetaDir, conf.Router)
 	scatter := backend.NewScatter(log, conf.Proxy.MetaDir)
@@ -54,6 +63,7 @@ func NewProxy(log *xlog.Log, path string, serverVersion string, conf *config.Con
 		conf:          conf,
 		confPath:      path,
 		audit:         audit,
+		access:        access,
 		router:        router,
 		scatter:       scatter,
 		syncer:        syncer,
@@ -70,6 +80,7 @@ func (p *Proxy) Start() {
 	log := p.log
 	conf := p.conf
 	audit := p.audit
+	access := p.access
 	iptable := p.iptable
 	syncer := p.syncer
 	router := p.router
@@ -83,9 +94,24 @@ func (p *Proxy) Start() {
 	log.Info("proxy.config[%+v]...", conf.Proxy)
 	log.Info("log.config[%+v]...", conf.Log)
 
+	if err := config.Migrate(log, conf); err != nil {
+		log.Panic("proxy.migrate.meta.panic:%+v", err)
+	}
+	if errs := ValidateConfig(log, conf, false); len(errs) > 0 {
+		for _, err := range errs {
+			log.Error("proxy.validate.config.error:%v", err)
+		}
+		log.Panic("proxy.validate.config.panic:%d.problems.found", len(errs))
+	}
+
 	if err := audit.Init(); err != nil {
 		log.Panic("proxy.audit.init.panic:%+v", err)
 	}
+	if access != nil {
+		if err := access.Init(); err != nil {
+			log.Panic("proxy.access.init.panic:%+v", err)
+		}
+	}
 	if err := syncer.Init(); err != nil {
 		log.Panic("proxy.syncer.init.panic:%+v", err)
 	}
@@ -99,12 +125,16 @@ func (p *Proxy) Start() {
 	if err := scatter.Init(p.conf.Scatter); err != nil {
 		log.Panic("proxy.scatter.init.panic:%+v", err)
 	}
+	scatter.Memory().SetLimits(conf.Proxy.MemoryHighWater, conf.Proxy.MemoryQueueTime)
+	scatter.Hedge().SetLimits(conf.Proxy.HedgeDelay, conf.Proxy.HedgeMaxRate)
+	scatter.Watermarks().SetLimits(conf.Proxy.GTIDWatermarkInterval, conf.Proxy.GTIDWatermarkWaitTimeout)
 
 	if err := plugins.Init(); err != nil {
 		log.Panic("proxy.plugins.init.panic:%+v", err)
 	}
 
-	spanner := NewSpanner(log, conf, iptable, router, scatter, sessions, audit, throttle, plugins, serverVersion)
+	spanner := NewSpanner(log, conf, iptable, router, scatter, sessions, audit, access, throttle, plugins, serverVersion)
+	spanner.proxy = p
 	if err := spanner.Init(); err != nil {
 		log.Panic("proxy.spanner.init.panic:%+v", err)
 	}
@@ -116,6 +146,37 @@ func (p *Proxy) Start() {
 	p.listener = svr
 	log.Info("proxy.start[%v]...", endpoint)
 	go svr.Accept()
+
+	// The analyst endpoint.
+	if analyst := conf.Proxy.Analyst; analyst != nil {
+		asvr, err := driver.NewListener(log, analyst.Endpoint, &analystHandler{spanner})
+		if err != nil {
+			log.Panic("proxy.analyst.start.error[%+v]", err)
+		}
+		asvr.SetConnectionID(analystConnectionID)
+		p.analyst = asvr
+		log.Info("proxy.analyst.start[%v]...", analyst.Endpoint)
+		go asvr.Accept()
+	}
+
+	// The experimental pgwire frontend.
+	if conf.Proxy.PgwireEndpoint != "" {
+		var tlsConfig *tls.Config
+		if conf.Proxy.PgwireTLSCert != "" {
+			cert, err := tls.LoadX509KeyPair(conf.Proxy.PgwireTLSCert, conf.Proxy.PgwireTLSKey)
+			if err != nil {
+				log.Panic("proxy.pgwire.load.tls.error[%+v]", err)
+			}
+			tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+		pgsvr, err := pgwire.NewListener(log, conf.Proxy.PgwireEndpoint, tlsConfig, spanner)
+		if err != nil {
+			log.Panic("proxy.pgwire.start.error[%+v]", err)
+		}
+		p.pgListener = pgsvr
+		log.Info("proxy.pgwire.start[%v]...", conf.Proxy.PgwireEndpoint)
+		go pgsvr.Accept()
+	}
 }
 
 // Stop used to stop the proxy.
@@ -126,8 +187,17 @@ func (p *Proxy) Stop() {
 	p.sessions.Close()
 	p.spanner.Close()
 	p.listener.Close()
+	if p.analyst != nil {
+		p.analyst.Close()
+	}
+	if p.pgListener != nil {
+		p.pgListener.Close()
+	}
 	p.scatter.Close()
 	p.audit.Close()
+	if p.access != nil {
+		p.access.Close()
+	}
 	p.syncer.Close()
 	p.plugins.Close()
 	log.Info("proxy.shutdown.complete...")
@@ -143,6 +213,22 @@ func (p *Proxy) Address() string {
 	return p.conf.Proxy.Endpoint
 }
 
+// AnalystAddress returns the analyst listener address, empty if it's disabled.
+func (p *Proxy) AnalystAddress() string {
+	if p.analyst == nil {
+		return ""
+	}
+	return p.analyst.Addr()
+}
+
+// PgwireAddress returns the pgwire listener address, empty if it's disabled.
+func (p *Proxy) PgwireAddress() string {
+	if p.pgListener == nil {
+		return ""
+	}
+	return p.pgListener.Addr()
+}
+
 // IPTable returns the ip table.
 func (p *Proxy) IPTable() *IPTable {
 	return p.iptable
@@ -189,6 +275,14 @@ func (p *Proxy) SetMaxResultSize(size int) {
 	p.conf.Proxy.MaxResultSize = size
 }
 
+// SetMaxResultRows used to set the max result rows.
+func (p *Proxy) SetMaxResultRows(rows int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log.Info("proxy.SetMaxResultRows:[%d->%d]", p.conf.Proxy.MaxResultRows, rows)
+	p.conf.Proxy.MaxResultRows = rows
+}
+
 // SetMaxJoinRows used to set the max result size.
 func (p *Proxy) SetMaxJoinRows(size int) {
 	p.mu.Lock()
@@ -285,3 +379,49 @@ func (p *Proxy) SetStreamBufferSize(streamBufferSize int) {
 	p.log.Info("proxy.SetStreamBufferSize:[%d->%d]", p.conf.Proxy.StreamBufferSize, streamBufferSize)
 	p.conf.Proxy.StreamBufferSize = streamBufferSize
 }
+
+// SetAutoAnalyze used to enable/disable the auto analyze.
+func (p *Proxy) SetAutoAnalyze(enable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log.Info("proxy.SetAutoAnalyze:[%v->%v]", p.conf.Proxy.AutoAnalyze, enable)
+	p.conf.Proxy.AutoAnalyze = enable
+}
+
+// SetAutoAnalyzeInterval used to set the interval(in millisecond) between the auto ANALYZE TABLEs.
+func (p *Proxy) SetAutoAnalyzeInterval(interval int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log.Info("proxy.SetAutoAnalyzeInterval:[%d->%d]", p.conf.Proxy.AutoAnalyzeInterval, interval)
+	p.conf.Proxy.AutoAnalyzeInterval = interval
+}
+
+// SetDatabaseQuota used to set the quota(in byte) of the database, 0 removes the quota.
+// The quotas are copied on write, the writes read them without the lock.
+func (p *Proxy) SetDatabaseQuota(database string, quota int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log.Info("proxy.SetDatabaseQuota[%s]:[%d->%d]", database, p.conf.Proxy.DatabaseQuotas[database], quota)
+	quotas := make(map[string]int64, len(p.conf.Proxy.DatabaseQuotas)+1)
+	for db, v := range p.conf.Proxy.DatabaseQuotas {
+		quotas[db] = v
+	}
+	if quota > 0 {
+		quotas[database] = quota
+	} else {
+		delete(quotas, database)
+	}
+	p.conf.Proxy.DatabaseQuotas = quotas
+}
+
+// SetClock used to set the clock of the proxy, the tests use the xbase.FakeClock to move the time
+// of the session idle times, the query timeouts, the workload queue times and the job schedules.
+func (p *Proxy) SetClock(clock xbase.Clock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spanner.SetClock(clock)
+	p.listener.SetNow(clock.Now)
+	if p.analyst != nil {
+		p.analyst.SetNow(clock.Now)
+	}
+}
@@ -9,10 +9,18 @@
 package proxy
 
 import (
+	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+	"xbase"
 
 	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -39,6 +47,12 @@ func TestProxy1(t *testing.T) {
 		assert.Equal(t, 6666, proxy.conf.Proxy.MaxResultSize)
 	}
 
+	// SetMaxResultRows
+	{
+		proxy.SetMaxResultRows(6666)
+		assert.Equal(t, 6666, proxy.conf.Proxy.MaxResultRows)
+	}
+
 	// SetMaxJoinRows
 	{
 		proxy.SetMaxJoinRows(6666)
@@ -115,3 +129,91 @@ func TestProxy1(t *testing.T) {
 		assert.NotNil(t, addr)
 	}
 }
+
+func TestProxyPgwire(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.PgwireEndpoint = "127.0.0.1:0"
+	_, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+
+	addr := proxy.PgwireAddress()
+	assert.NotEqual(t, "", addr)
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	conn.Close()
+}
+
+func TestProxyClock(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.QueryTimeout = 100
+	conf.Proxy.Workloads = map[string]*config.WorkloadConfig{
+		config.WorkloadOLAP: {MaxConcurrency: 1, MaxQueueTime: 1000},
+	}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	clock := xbase.NewFakeClock(time.Unix(1552608000, 0))
+	fakedbs.SetClock(clock)
+	proxy.SetClock(clock)
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryDelay("select * from test.g1", fakedb.Result1, 1000)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// The session time.
+	{
+		clock.Advance(10 * time.Second)
+		infos := proxy.Sessions().Snapshot()
+		assert.Equal(t, 1, len(infos))
+		assert.Equal(t, uint32(10), infos[0].Time)
+	}
+
+	// The query timeout is reached before the delay.
+	{
+		waiters := clock.Waiters()
+		errc := make(chan error, 1)
+		go func() {
+			_, err := client.FetchAll("select * from test.g1", -1)
+			errc <- err
+		}()
+		// The deadline and the delay.
+		assert.True(t, clock.WaitForWaiters(waiters+2, time.Second))
+		clock.Advance(100 * time.Millisecond)
+		err := <-errc
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "Query execution was interrupted, timeout[100ms] exceeded"), err.Error())
+	}
+
+	// The workload max queue time.
+	{
+		release, err := proxy.Spanner().workloads.Admit(config.WorkloadOLAP)
+		assert.Nil(t, err)
+		waiters := clock.Waiters()
+		errc := make(chan error, 1)
+		go func() {
+			_, err := client.FetchAll("select /*+ radon_workload(olap) */ * from test.g1", -1)
+			errc <- err
+		}()
+		assert.True(t, clock.WaitForWaiters(waiters+1, time.Second))
+		clock.Advance(time.Second)
+		err = <-errc
+		assert.Equal(t, "Query execution was interrupted, the olap workload max queue time[1000ms] exceeded (errno 9002) (sqlstate HY000)", err.Error())
+		release()
+	}
+}
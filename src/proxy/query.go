@@ -9,10 +9,13 @@
 package proxy
 
 import (
+	"encoding/hex"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"monitor"
+	"planner"
 	"xbase"
 
 	"github.com/xelabs/go-mysqlstack/driver"
@@ -23,6 +26,32 @@ import (
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
+// hexLiteral is the bytes encoded as the X'..' literal.
+type hexLiteral []byte
+
+// EncodeSQL impl.
+func (h hexLiteral) EncodeSQL(buf *strings.Builder) {
+	buf.WriteString("X'")
+	buf.WriteString(hex.EncodeToString(h))
+	buf.WriteByte('\'')
+}
+
+// hexBindVariables returns the binary bind variables which aren't valid UTF-8 as the hex literals, the backends take
+// them as the bytes they are whatever the connection charset is, and the binary shard key routes them by the bytes.
+func hexBindVariables(bindVariables map[string]*querypb.BindVariable) map[string]sqlparser.Encodable {
+	var extras map[string]sqlparser.Encodable
+	for name, bv := range bindVariables {
+		if !sqltypes.IsBinary(bv.Type) || utf8.Valid(bv.Value) {
+			continue
+		}
+		if extras == nil {
+			extras = make(map[string]sqlparser.Encodable)
+		}
+		extras[name] = hexLiteral(bv.Value)
+	}
+	return extras
+}
+
 func returnQuery(qr *sqltypes.Result, callback func(qr *sqltypes.Result) error, err error) error {
 	if err != nil {
 		return err
@@ -64,16 +93,154 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 	query = strings.TrimSpace(query)
 	query = strings.TrimSuffix(query, ";")
 
-	node, err := sqlparser.Parse(query)
+	// The analyst endpoint is read-only, the statements handled before the parser are denied.
+	analyst := spanner.sessions.isAnalyst(session)
+	if analyst && (isFlush(query) || isCall(query) || isTrigger(query) || isView(query) || isRenameDatabase(query) || isRenameTable(query)) {
+		return sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+	}
+
+	// FLUSH and RESET.
+	if isFlush(query) {
+		qr, err := spanner.handleFlush(session, query)
+		if err != nil {
+			log.Error("proxy.flush[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, W, xbase.FLUSH, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// CALL of the declared procedures.
+	if isCall(query) {
+		qr, err := spanner.handleCall(session, query)
+		if err != nil {
+			log.Error("proxy.call[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, W, xbase.CALL, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// CREATE and DROP TRIGGER on the radon tables.
+	if isTrigger(query) {
+		qr, err := spanner.handleTrigger(session, query)
+		if err != nil {
+			log.Error("proxy.trigger[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, W, xbase.DDL, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// CREATE and DROP VIEW on the SINGLE and GLOBAL tables.
+	if isView(query) {
+		qr, err := spanner.handleView(session, query)
+		if err != nil {
+			log.Error("proxy.view[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, W, xbase.DDL, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// SHOW CREATE VIEW.
+	if isShowCreateView(query) {
+		qr, err := spanner.handleShowCreateView(session, query)
+		if err != nil {
+			log.Error("proxy.show.create.view[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, R, xbase.SHOW, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// RENAME DATABASE.
+	if isRenameDatabase(query) {
+		qr, err := spanner.handleRenameDatabase(session, query)
+		if err != nil {
+			log.Error("proxy.rename.database[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, W, xbase.DDL, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// RENAME TABLE.
+	if isRenameTable(query) {
+		qr, err := spanner.handleRenameTable(session, query)
+		if err != nil {
+			log.Error("proxy.rename.table[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, W, xbase.DDL, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// SHOW TABLES and SHOW DATABASES with the filters.
+	if isShowFilter(query) {
+		var qr *sqltypes.Result
+		var err error
+		if showTablesRegexp.MatchString(query) {
+			if qr, err = spanner.handleShowTables(session, query, nil); err != nil {
+				log.Error("proxy.show.tables[%s].from.session[%v].error:%+v", query, session.ID(), err)
+			}
+		} else {
+			if qr, err = spanner.handleShowDatabases(session, query, nil); err != nil {
+				log.Error("proxy.show.databases[%s].from.session[%v].error:%+v", query, session.ID(), err)
+			}
+		}
+		spanner.auditLog(session, R, xbase.SHOW, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// SHOW FULL PROCESSLIST.
+	if showFullProcesslistRegexp.MatchString(strings.TrimSpace(query)) {
+		qr, err := spanner.handleShowProcesslist(session, query, nil)
+		if err != nil {
+			log.Error("proxy.show.processlist[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, R, xbase.SHOW, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// SHOW [FULL] COLUMNS, the parser supports the SHOW COLUMNS FROM tbl_name only.
+	if showColumnsRegexp.MatchString(strings.TrimSpace(query)) {
+		qr, err := spanner.handleShowColumns(session, query, nil)
+		if err != nil {
+			log.Error("proxy.show.colomns[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
+		spanner.auditLog(session, R, xbase.SHOW, query, qr)
+		return returnQuery(qr, callback, err)
+	}
+
+	// The prepared statement routed by the parameter is neither parsed nor planned again.
+	var node sqlparser.Statement
+	var err error
+	prepared := spanner.bindPrepared(session, query, bindVariables)
+	if prepared != nil {
+		defer spanner.unbindPrepared(session, prepared)
+		query, node = prepared.query, prepared.node
+	} else {
+		node, err = sqlparser.Parse(query)
+	}
+	if err != nil && bindVariables == nil && planner.IsMultiTableDML(query) {
+		node, err = spanner.multiTableDMLNode(session, query)
+		if err != nil {
+			log.Error("query[%v].multi.table.dml.error: %v", query, err)
+			return err
+		}
+	}
+	if err != nil {
+		var ddl *sqlparser.DDL
+		if ddl, err = parseCreateTable(query, err); err == nil {
+			node = ddl
+		}
+	}
 	if err != nil {
 		log.Error("query[%v].parser.error: %v", query, err)
+		if uerr := unsupportedSQLError(query); uerr != nil {
+			return uerr
+		}
 		return sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
 	}
 
 	// Bind variables.
-	if bindVariables != nil {
+	if bindVariables != nil && prepared == nil {
 		parsedQuery := sqlparser.NewParsedQuery(node)
-		query, err = parsedQuery.GenerateQuery(bindVariables, nil)
+		query, err = parsedQuery.GenerateQuery(bindVariables, hexBindVariables(bindVariables))
 		if err != nil {
 			log.Error("query[%v].parsed.GenerateQuery.error: %v, bind:%+v", query, err, bindVariables)
 			return sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
@@ -89,7 +256,7 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 	log.Debug("query:%v", query)
 
 	// Readonly check.
-	if spanner.ReadOnly() {
+	if spanner.ReadOnly() || analyst {
 		// DML Write denied.
 		if spanner.IsDMLWrite(node) {
 			return sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
@@ -100,6 +267,35 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 		}
 	}
 
+	// Read-only transaction check.
+	if (session.Status()&sqldb.SERVER_STATUS_IN_TRANS_READONLY) > 0 && spanner.IsDMLWrite(node) {
+		return sqldb.NewSQLError(sqldb.ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION)
+	}
+
+	// Workload admission.
+	release, err := spanner.workloads.Admit(spanner.workloads.Classify(session.User(), node))
+	if err != nil {
+		log.Error("query[%v].workload.admit.error:%v", xbase.TruncateQuery(query, 256), err)
+		return err
+	}
+	defer release()
+
+	// Cancel the querys on the backends if the client is gone during the DML,
+	// the DDL isn't cancelled to leave no segments half changed.
+	if spanner.IsDML(node) {
+		defer session.WatchClose(func() {
+			spanner.sessions.Cancel(session, "client.disconnected")
+		})()
+	}
+
+	// Rollup rewrite.
+	if sel, ok := node.(*sqlparser.Select); ok {
+		if rewritten, rnode, ok := spanner.rollups.Rewrite(session.Schema(), sel); ok {
+			log.Debug("query[%v].rewritten.to.rollup[%v]", query, rewritten)
+			query, node = rewritten, rnode
+		}
+	}
+
 	defer func() {
 		queryStat(node, timeStart, slowQueryTime, err)
 	}()
@@ -136,8 +332,7 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 				log.Error("proxy.show.engines[%s].from.session[%v].error:%+v", query, session.ID(), err)
 			}
 		case sqlparser.ShowTablesStr, sqlparser.ShowFullTablesStr:
-			// Support for SHOW FULL TBALES which can be parsed used by Navicat
-			// TODO: need to support: SHOW [FULL] TABLES [FROM db_name] [like_or_where]
+			// The LIKE, WHERE and LIMIT are handled before the parser, see isShowFilter.
 			if qr, err = spanner.handleShowTables(session, query, node); err != nil {
 				log.Error("proxy.show.tables[%s].from.session[%v].error:%+v", query, session.ID(), err)
 			}
@@ -146,6 +341,7 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 				log.Error("proxy.show.create.table[%s].from.session[%v].error:%+v", query, session.ID(), err)
 			}
 		case sqlparser.ShowColumnsStr:
+			// The SHOW [FULL] COLUMNS matched by showColumnsRegexp are handled before the parser.
 			if qr, err = spanner.handleShowColumns(session, query, node); err != nil {
 				log.Error("proxy.show.colomns[%s].from.session[%v].error:%+v", query, session.ID(), err)
 			}
@@ -206,8 +402,20 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, bindVari
 		spanner.auditLog(session, W, xbase.UPDATE, query, qr)
 		return returnQuery(qr, callback, err)
 	case *sqlparser.Select:
+		// The radon functions are evaluated by the proxy.
+		if isRadonFuncSelect(node) {
+			if qr, err = spanner.handleSelectRadonFunc(session, node); err != nil {
+				log.Error("proxy.select.radon.function[%s].from.session[%v].error:%+v", query, session.ID(), err)
+			}
+			spanner.auditLog(session, R, xbase.SELECT, query, qr)
+			return returnQuery(qr, callback, err)
+		}
 		txSession := spanner.sessions.getTxnSession(session)
-		if txSession.getStreamingFetchVar() {
+		hints, _ := planner.ParseHints(node.Comments)
+		// The analyst sessions don't stream, the streaming fetch is not limited.
+		// The select of the read-only cursor is streamed too if the rows need no merging by the proxy.
+		stream := txSession.getStreamingFetchVar() || hints.Stream || (session.Cursor() && spanner.cursorStreamable(session, query))
+		if stream && !txSession.analyst {
 			if err = spanner.handleSelectStream(session, query, node, callback); err != nil {
 				log.Error("proxy.select.for.backup:[%s].error:%+v", xbase.TruncateQuery(query, 256), err)
 				return err
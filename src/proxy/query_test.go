@@ -9,11 +9,17 @@
 package proxy
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
+	"config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -223,6 +229,14 @@ func TestProxyQuerys(t *testing.T) {
 			_, err = client.FetchAll(query, -1)
 			assert.Nil(t, err)
 		}
+		{ // select with radon_stream hint.
+			query := "select /*+ radon_stream */ * from test.t1 as aliaseTable"
+			qr, err := client.FetchAll(query, -1)
+			assert.Nil(t, err)
+			want := 60510
+			got := int(qr.RowsAffected)
+			assert.Equal(t, want, got)
+		}
 		{ // select 1 from dual
 			query := "select 1 from dual"
 			qr, err := client.FetchAll(query, -1)
@@ -296,9 +310,9 @@ func TestProxyQuerys(t *testing.T) {
 		{ // ERROR 1054 (42S22): Unknown column 'a' in 'field list'
 			query := "select a from dual"
 			_, err := client.FetchAll(query, -1)
-			want := "mock.mysql.select.from.dual.error (errno 1105) (sqlstate HY000)"
+			want := `^mock.mysql.select.from.dual.error \(backend:backend\d, phase:execute\) \(errno 1105\) \(sqlstate HY000\)$`
 			got := err.Error()
-			assert.Equal(t, want, got)
+			assert.Regexp(t, want, got)
 		}
 		{
 			query := "set @@SESSION.radon_streaming_fetch='ON'"
@@ -409,6 +423,167 @@ func TestProxyQueryStmtPrepare(t *testing.T) {
 	}
 }
 
+func TestProxyQueryBinaryShardKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Spanner().router
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.t1(id binary(16), b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	tconf, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, config.ShardKeyTypeBinary, tconf.ShardKeyType)
+
+	// The uuid is routed by its bytes whichever form it's written in.
+	uuid := []byte("\x9f\x1e\x00\xfe\x10\x2a\x4b\x3c\x8d\x7e\x6f\x50\x41\x32\x23\x14")
+	val := sqlparser.NewStrVal(uuid)
+	segments, err := route.Lookup("test", "t1", val, val)
+	assert.Nil(t, err)
+	segment := segments[0].Table
+	hexUUID := hex.EncodeToString(uuid)
+
+	querys := []struct {
+		query   string
+		backend string
+	}{
+		{
+			fmt.Sprintf("select * from test.t1 where id = X'%s'", hexUUID),
+			fmt.Sprintf("select * from test.%s as t1 where id = X'%s'", segment, hexUUID),
+		},
+		{
+			fmt.Sprintf("select * from test.t1 where id = 0x%s", hexUUID),
+			fmt.Sprintf("select * from test.%s as t1 where id = 0x%s", segment, hexUUID),
+		},
+		{
+			fmt.Sprintf("insert into test.t1(id, b) values (X'%s', 1)", hexUUID),
+			fmt.Sprintf("insert into test.%s(id, b) values (X'%s', 1)", segment, hexUUID),
+		},
+	}
+	for _, q := range querys {
+		_, err := client.FetchAll(q.query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(q.backend), q.backend)
+	}
+
+	// The binary bind variable is rendered as the hex literal.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		params := []sqltypes.Value{
+			sqltypes.MakeTrusted(sqltypes.VarBinary, uuid),
+			sqltypes.MakeTrusted(sqltypes.Int32, []byte("2")),
+		}
+		stmt, err := client.ComStatementPrepare("insert into t1(id, b) values(?,?)")
+		assert.Nil(t, err)
+		err = stmt.ComStatementExecute(params)
+		assert.Nil(t, err)
+		stmt.ComStatementClose()
+		backend := fmt.Sprintf("insert into test.%s(id, b) values (X'%s', 2)", segment, hexUUID)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend))
+	}
+}
+
+func TestProxyQueryTemporalShardKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Spanner().router
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.t1(d date, b int) partition by hash(d)", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.t2(dt datetime, b int) partition by hash(dt)", -1)
+	assert.Nil(t, err)
+
+	tconf, err := route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, config.ShardKeyTypeDate, tconf.ShardKeyType)
+	tconf, err = route.TableConfig("test", "t2")
+	assert.Nil(t, err)
+	assert.Equal(t, config.ShardKeyTypeDatetime, tconf.ShardKeyType)
+
+	// The range of the days is routed to the segments of the days.
+	tconf, err = route.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	segments := make(map[string]bool)
+	for _, day := range []string{"2020-01-30", "2020-01-31"} {
+		val := sqlparser.NewStrVal([]byte(day))
+		parts, err := route.Lookup("test", "t1", val, val)
+		assert.Nil(t, err)
+		segments[parts[0].Table] = true
+	}
+	querys := []string{
+		"select * from test.t1 where d between '2020-01-30' and '2020-01-31'",
+		"select * from test.t1 where d >= '2020-01-30' and d <= '2020/1/31'",
+	}
+	for _, query := range querys {
+		fakedbs.ResetAll()
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		for segment := range segments {
+			backend := strings.Replace(query, "test.t1", fmt.Sprintf("test.%s as t1", segment), 1)
+			assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+		}
+		for _, part := range tconf.Partitions {
+			if !segments[part.Table] {
+				backend := strings.Replace(query, "test.t1", fmt.Sprintf("test.%s as t1", part.Table), 1)
+				assert.Equal(t, 0, fakedbs.GetQueryCalledNum(backend), backend)
+			}
+		}
+	}
+
+	// The malformed bound is rejected.
+	{
+		_, err := client.FetchAll("select * from test.t1 where d between '2020-01-30' and 'tomorrow'", -1)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestProxyHexBindVariables(t *testing.T) {
+	bindVariables := map[string]*querypb.BindVariable{
+		"v1": {Type: sqltypes.VarBinary, Value: []byte("\xfe\x01")},
+		"v2": {Type: sqltypes.VarBinary, Value: []byte("abc")},
+		"v3": {Type: sqltypes.VarChar, Value: []byte("\xfe")},
+		"v4": {Type: sqltypes.Blob, Value: []byte("\x00\xff")},
+	}
+	extras := hexBindVariables(bindVariables)
+	assert.Equal(t, 2, len(extras))
+
+	buf := &strings.Builder{}
+	extras["v1"].EncodeSQL(buf)
+	assert.Equal(t, "X'fe01'", buf.String())
+	assert.Nil(t, hexBindVariables(nil))
+}
+
 // Proxy with system database query.
 // Such as: select * from information_schema.
 func TestProxyQuerySystemDatabase(t *testing.T) {
@@ -488,9 +663,98 @@ func TestProxyQuerySystemDatabase(t *testing.T) {
 		query1 := "select * from information_schema.SCHEMATA"
 		_, err = client.FetchAll(query1, -1)
 		assert.NotNil(t, err)
-		want := "mysql.select.from.information_schema.error (errno 1105) (sqlstate HY000)"
+		want := `^mysql.select.from.information_schema.error \(backend:backend\d, phase:execute\) \(errno 1105\) \(sqlstate HY000\)$`
 		got := err.Error()
-		assert.Equal(t, want, got)
+		assert.Regexp(t, want, got)
+	}
+}
+
+func TestProxyQueryInformationSchemaComments(t *testing.T) {
+	str := func(s string) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(s))
+	}
+	columns := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "TABLE_SCHEMA", Type: querypb.Type_VARCHAR},
+			{Name: "TABLE_NAME", Type: querypb.Type_VARCHAR},
+			{Name: "COLUMN_NAME", Type: querypb.Type_VARCHAR},
+			{Name: "COLUMN_COMMENT", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{str("test"), str("t1_0000"), str("id"), str("")},
+			{str("test"), str("t1_0000"), str("b"), str("the b")},
+			{str("test"), str("t1_0001"), str("id"), str("")},
+			{str("test"), str("t1_0001"), str("b"), str("the b")},
+			{str("test"), str("g1"), str("a"), str("the a")},
+		},
+	}
+	tables := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "TABLE_NAME", Type: querypb.Type_VARCHAR},
+			{Name: "TABLE_COMMENT", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{str("t1_0000"), str("the orders")},
+			{str("t1_0001"), str("the orders")},
+			{str("g1"), str("")},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*columns.*", columns)
+		fakedbs.AddQueryPattern("select .*tables.*", tables)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int comment 'the b') comment='the orders' partition by hash(id)",
+		"create table test.g1(a int comment 'the a') global",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// All the backends.
+		{
+			"select * from information_schema.COLUMNS where TABLE_SCHEMA='test'",
+			"[[test t1 id ] [test t1 b the b] [test g1 a the a]]",
+		},
+		{
+			"select TABLE_NAME, TABLE_COMMENT from information_schema.TABLES where TABLE_SCHEMA='test'",
+			"[[t1 the orders] [g1 ]]",
+		},
+		// The first segment.
+		{
+			"select TABLE_NAME, TABLE_COMMENT from information_schema.TABLES where TABLE_SCHEMA='test' and TABLE_NAME='t1'",
+			"[[t1 the orders] [g1 ]]",
+		},
+	}
+	for _, test := range tests {
+		qr, err := client.FetchAll(test.query, -1)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.want, fmt.Sprintf("%+v", qr.Rows), test.query)
+	}
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("select TABLE_NAME, TABLE_COMMENT from information_schema.`TABLES` where TABLE_SCHEMA = 'test' and TABLE_NAME = 't1_0000'"))
+
+	// The TABLE_NAME isn't selected.
+	{
+		_, err := client.FetchAll("select count(*) from information_schema.TABLES where TABLE_SCHEMA='test'", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("select count(*) from information_schema.TABLES where TABLE_SCHEMA='test'"))
 	}
 }
 
@@ -578,3 +842,63 @@ func TestLongQuery2(t *testing.T) {
 		}
 	}
 }
+
+func TestProxyQueryMaxResultRows(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", result1)
+	}
+
+	// create database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create database test"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// Global limits.
+	{
+		proxy.SetMaxResultRows(10)
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		query := "select * from test.t1"
+		_, err = client.FetchAll(query, -1)
+		want := "Query execution was interrupted, max result rows[10] exceeded (errno 9002) (sqlstate HY000)"
+		got := err.Error()
+		assert.Equal(t, want, got)
+
+		// The limits are checked on the final result, after the LIMIT.
+		qr, err := client.FetchAll("select * from test.t1 limit 5", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, len(qr.Rows))
+	}
+
+	// User limits overrides the global.
+	{
+		proxy.conf.Proxy.UserMaxResultRows = map[string]int{"mock": 0}
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		query := "select * from test.t1"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,32 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"config"
+)
+
+// queryTag returns the tag of the backend querys rendered from the query-tag config, empty if it's not set.
+// The sessionID is 0 for the querys without client session, such as the jobs.
+// The '*/' rendered, such as in the user name, is escaped to '* /' so the tag can't close the comment.
+func (spanner *Spanner) queryTag(user string, sessionID uint32) string {
+	conf := spanner.conf.Proxy
+	if conf.QueryTag == "" {
+		return ""
+	}
+	proxy := conf.PeerAddress
+	if proxy == "" {
+		proxy = conf.Endpoint
+	}
+	replacer := strings.NewReplacer(config.QueryTagProxy, proxy, config.QueryTagSession, fmt.Sprintf("%d", sessionID), config.QueryTagUser, user)
+	return strings.Replace(replacer.Replace(conf.QueryTag), "*/", "* /", -1)
+}
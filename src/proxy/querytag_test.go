@@ -0,0 +1,67 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyQueryTag(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.QueryTag = "radon={proxy} session={session} user={user}"
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern(".* create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern(".* select .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"select * from test.t1 where id=1",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+	want := fmt.Sprintf("/* radon=%s session=%d user=mock */ select * from test.t1_0017 as t1 where id = 1", conf.Proxy.PeerAddress, client.ConnectionID())
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum(want))
+
+	// The querys without client session.
+	{
+		_, err := proxy.Spanner().ExecuteReadOnly("mock", "test", "select * from t1 where id=1")
+		assert.Nil(t, err)
+		want := fmt.Sprintf("/* radon=%s session=0 user=mock */ select * from test.t1_0017 as t1 where id = 1", conf.Proxy.PeerAddress)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(want))
+	}
+
+	// The '*/' in the values can't close the comment.
+	{
+		want := fmt.Sprintf("radon=%s session=1 user=a* /b", conf.Proxy.PeerAddress)
+		assert.Equal(t, want, proxy.Spanner().queryTag("a*/b", 1))
+
+		conf.Proxy.QueryTag = "user=*{user}"
+		assert.Equal(t, "user=* /* / x", proxy.Spanner().queryTag("/*/ x", 1))
+	}
+}
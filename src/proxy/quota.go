@@ -0,0 +1,179 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"config"
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// databaseUsageQuery sums the data_length of the segments on the backend by the database.
+	databaseUsageQuery = "select table_schema, sum(data_length) from information_schema.tables where table_schema not in ('sys', 'information_schema', 'mysql', 'performance_schema') group by table_schema"
+)
+
+// DatabaseUsage tuple, the approximate data size of the database aggregated from the data_length of its segments on all the backends.
+// The Quota is the max data size of the database, 0 means no quota.
+type DatabaseUsage struct {
+	Database   string `json:"database"`
+	DataLength uint64 `json:"data-length"`
+	Quota      int64  `json:"quota"`
+	Exceeded   bool   `json:"exceeded"`
+}
+
+// Quotas tracks the data size of the databases by polling the backends every database-usage-interval(in millisecond),
+// the INSERT and REPLACE into the database exceeds its quota are rejected until the usage drops below the quota.
+// The usage of the backend failed to poll is kept as the last known one.
+type Quotas struct {
+	log     *xlog.Log
+	spanner *Spanner
+	conf    *config.ProxyConfig
+	mu      sync.RWMutex
+	usages  map[string]map[string]uint64 // backend -> database -> data_length.
+	done    chan struct{}
+	wg      sync.WaitGroup
+	clock   xbase.AtomicClock
+}
+
+// NewQuotas creates the new Quotas.
+func NewQuotas(log *xlog.Log, spanner *Spanner, conf *config.ProxyConfig) *Quotas {
+	return &Quotas{
+		log:     log,
+		spanner: spanner,
+		conf:    conf,
+		usages:  make(map[string]map[string]uint64),
+		done:    make(chan struct{}),
+	}
+}
+
+// Init used to start the poller.
+func (q *Quotas) Init() {
+	q.wg.Add(1)
+	go q.run()
+	q.log.Info("quotas.init.done")
+}
+
+// Close used to stop the poller.
+func (q *Quotas) Close() {
+	close(q.done)
+	q.wg.Wait()
+	q.log.Info("quotas.closed")
+}
+
+// SetClock used to set the clock of the interval.
+func (q *Quotas) SetClock(clock xbase.Clock) {
+	q.clock.Set(clock)
+}
+
+func (q *Quotas) run() {
+	defer q.wg.Done()
+	for {
+		// The poll is disabled if the interval is 0, check it again later.
+		interval := time.Duration(q.conf.DatabaseUsageInterval) * time.Millisecond
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		select {
+		case <-q.done:
+			return
+		case <-q.clock.Get().After(interval):
+		}
+		if q.conf.DatabaseUsageInterval > 0 {
+			q.Refresh()
+		}
+	}
+}
+
+// Refresh used to poll the data size of the databases on all the backends now.
+func (q *Quotas) Refresh() {
+	log := q.log
+	spanner := q.spanner
+	usages := make(map[string]map[string]uint64)
+	for _, backend := range spanner.scatter.AllBackends() {
+		qr, err := spanner.ExecuteOnThisBackend(backend, databaseUsageQuery)
+		if err != nil {
+			log.Error("quotas.backend[%s].usage.error:%+v", backend, err)
+			q.mu.RLock()
+			usages[backend] = q.usages[backend]
+			q.mu.RUnlock()
+			continue
+		}
+		usage := make(map[string]uint64)
+		for _, row := range qr.Rows {
+			if len(row) < 2 {
+				continue
+			}
+			size, _ := row[1].ParseUint64()
+			usage[row[0].String()] = size
+		}
+		usages[backend] = usage
+	}
+	q.mu.Lock()
+	q.usages = usages
+	q.mu.Unlock()
+}
+
+// dataLength returns the data size of the database on all the backends.
+func (q *Quotas) dataLength(database string) uint64 {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	var size uint64
+	for _, usage := range q.usages {
+		size += usage[database]
+	}
+	return size
+}
+
+// Usage returns the usage of the database.
+func (q *Quotas) Usage(database string) *DatabaseUsage {
+	usage := &DatabaseUsage{
+		Database:   database,
+		DataLength: q.dataLength(database),
+		Quota:      q.conf.DatabaseQuotas[database],
+	}
+	usage.Exceeded = usage.Quota > 0 && usage.DataLength >= uint64(usage.Quota)
+	return usage
+}
+
+// Usages returns the usages of all the databases of the router.
+func (q *Quotas) Usages() []*DatabaseUsage {
+	schemas := q.spanner.router.Schemas()
+	dbs := make([]string, 0, len(schemas))
+	for db := range schemas {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+	usages := make([]*DatabaseUsage, 0, len(dbs))
+	for _, db := range dbs {
+		usages = append(usages, q.Usage(db))
+	}
+	return usages
+}
+
+// Check returns the error if the database exceeds its quota.
+func (q *Quotas) Check(database string) error {
+	if len(q.conf.DatabaseQuotas) == 0 {
+		return nil
+	}
+	if usage := q.Usage(database); usage.Exceeded {
+		return xbase.NewRadonError(xbase.ER_RADON_QUOTA_EXCEEDED, "Quota exceeded, the data size[%d] of database[%s] reaches its quota[%d]", usage.DataLength, database, usage.Quota)
+	}
+	return nil
+}
+
+// Quotas returns the quotas of the databases.
+func (spanner *Spanner) Quotas() *Quotas {
+	return spanner.quotas
+}
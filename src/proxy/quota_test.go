@@ -0,0 +1,136 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyDatabaseQuotas(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.DatabaseQuotas = map[string]int64{"test": 1000}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	quotas := proxy.Spanner().Quotas()
+	backends := len(proxy.Scatter().AllBackends())
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("insert .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create database db1",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	usage := func(size int) *sqltypes.Result {
+		return &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "table_schema", Type: querypb.Type_VARCHAR},
+				{Name: "sum(data_length)", Type: querypb.Type_DECIMAL},
+			},
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test")),
+					sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte(fmt.Sprintf("%d", size))),
+				},
+				{
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("db1")),
+					sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("10")),
+				},
+			},
+		}
+	}
+
+	// Under the quota.
+	{
+		fakedbs.AddQuery(databaseUsageQuery, usage(100))
+		quotas.Refresh()
+		got := quotas.Usages()
+		assert.Equal(t, 2, len(got))
+		assert.Equal(t, &DatabaseUsage{Database: "db1", DataLength: uint64(10 * backends)}, got[0])
+		assert.Equal(t, &DatabaseUsage{Database: "test", DataLength: uint64(100 * backends), Quota: 1000}, got[1])
+		_, err = client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+	}
+
+	// Exceeded.
+	{
+		fakedbs.AddQuery(databaseUsageQuery, usage(1000))
+		quotas.Refresh()
+		assert.True(t, quotas.Usage("test").Exceeded)
+		_, err = client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		want := fmt.Sprintf("Quota exceeded, the data size[%d] of database[test] reaches its quota[1000] (errno 9004) (sqlstate HY000)", 1000*backends)
+		assert.Equal(t, want, err.Error())
+
+		// The session database.
+		client1, err := driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+		assert.Nil(t, err)
+		defer client1.Close()
+		_, err = client1.FetchAll("replace into t1(id, b) values(1, 1)", -1)
+		assert.NotNil(t, err)
+
+		// The database without quota.
+		_, err = client.FetchAll("create table db1.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into db1.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+	}
+
+	// SHOW DATABASES EXTENDED.
+	{
+		qr, err := client.FetchAll("show databases extended where `Database` like 'test'", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(qr.Fields))
+		assert.Equal(t, "Data_length", qr.Fields[1].Name)
+		assert.Equal(t, 1, len(qr.Rows))
+		assert.Equal(t, []string{"test", fmt.Sprintf("%d", 1000*backends), "1000"},
+			[]string{qr.Rows[0][0].String(), qr.Rows[0][1].String(), qr.Rows[0][2].String()})
+
+		qr, err = client.FetchAll("show databases extended", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(qr.Fields))
+	}
+
+	// The usage of the failed backends is the last known one.
+	{
+		fakedbs.AddQueryError(databaseUsageQuery, errors.New("mock.usage.error"))
+		quotas.Refresh()
+		assert.Equal(t, uint64(1000*backends), quotas.Usage("test").DataLength)
+
+		fakedbs.AddQuery(databaseUsageQuery, usage(10))
+		quotas.Refresh()
+		_, err = client.FetchAll("insert into test.t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	// radonFuncShard returns the backend/segment of the shard key value, such as RADON_SHARD('db1.t1', 1001).
+	radonFuncShard = "radon_shard"
+	// radonFuncUUIDShort returns the unique 64-bit integer, it's unique with the auto-increment values.
+	radonFuncUUIDShort = "radon_uuid_short"
+
+	// erWrongParamcountToNativeFct is the MySQL error of the wrong argument count.
+	erWrongParamcountToNativeFct = 1582
+)
+
+// isRadonFuncSelect returns true if the select without the table calls the radon functions.
+func isRadonFuncSelect(node *sqlparser.Select) bool {
+	if len(node.From) != 1 {
+		return false
+	}
+	aliasTableExpr, ok := node.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return false
+	}
+	tb, ok := aliasTableExpr.Expr.(sqlparser.TableName)
+	if !ok || tb.Name.String() != "dual" || !tb.Qualifier.IsEmpty() {
+		return false
+	}
+
+	found := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if fn, ok := node.(*sqlparser.FuncExpr); ok && strings.HasPrefix(fn.Name.Lowered(), "radon_") {
+			found = true
+			return false, nil
+		}
+		return true, nil
+	}, node.SelectExprs)
+	return found
+}
+
+// handleSelectRadonFunc used to evaluate the radon functions in the proxy, the select exprs
+// must be the radon functions or the literals.
+func (spanner *Spanner) handleSelectRadonFunc(session *driver.Session, node *sqlparser.Select) (*sqltypes.Result, error) {
+	if node.Where != nil || len(node.GroupBy) > 0 || node.Having != nil {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "unsupported: radon.functions.with.where.group.by.having")
+	}
+
+	qr := &sqltypes.Result{}
+	row := make([]sqltypes.Value, 0, len(node.SelectExprs))
+	for _, selectExpr := range node.SelectExprs {
+		expr, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "unsupported: radon.functions.with[%s]", sqlparser.String(selectExpr))
+		}
+		val, err := spanner.evalRadonFunc(session, expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		name := expr.As.String()
+		if name == "" {
+			name = sqlparser.String(expr.Expr)
+		}
+		qr.Fields = append(qr.Fields, &querypb.Field{Name: name, Type: val.Type()})
+		row = append(row, val)
+	}
+	qr.Rows = append(qr.Rows, row)
+	qr.RowsAffected = 1
+	return qr, nil
+}
+
+func (spanner *Spanner) evalRadonFunc(session *driver.Session, expr sqlparser.Expr) (sqltypes.Value, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		switch expr.Type {
+		case sqlparser.IntVal:
+			return sqltypes.MakeTrusted(querypb.Type_INT64, expr.Val), nil
+		case sqlparser.StrVal:
+			return sqltypes.MakeTrusted(querypb.Type_VARCHAR, expr.Val), nil
+		}
+	case *sqlparser.FuncExpr:
+		switch expr.Name.Lowered() {
+		case radonFuncShard:
+			return spanner.radonShard(session, expr)
+		case radonFuncUUIDShort:
+			if len(expr.Exprs) != 0 {
+				return sqltypes.NULL, radonFuncParamCountError(expr)
+			}
+			seq := spanner.plugins.PlugAutoIncrement().Next()
+			return sqltypes.MakeTrusted(querypb.Type_UINT64, strconv.AppendUint(nil, seq, 10)), nil
+		}
+	}
+	return sqltypes.NULL, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "unsupported: radon.functions.with[%s]", sqlparser.String(expr))
+}
+
+// radonShard returns the 'backend/segment' of the shard key value, the segments of the GLOBAL table are joined by ','.
+// The table is 'db.table' or 'table' in the current database.
+func (spanner *Spanner) radonShard(session *driver.Session, fn *sqlparser.FuncExpr) (sqltypes.Value, error) {
+	var args []*sqlparser.SQLVal
+	for _, e := range fn.Exprs {
+		if arg, ok := e.(*sqlparser.AliasedExpr); ok {
+			if val, ok := arg.Expr.(*sqlparser.SQLVal); ok {
+				args = append(args, val)
+				continue
+			}
+		}
+		return sqltypes.NULL, sqldb.NewSQLErrorf(sqldb.ER_UNKNOWN_ERROR, "unsupported: %s.args.must.be.literals", radonFuncShard)
+	}
+	if len(args) != 2 {
+		return sqltypes.NULL, radonFuncParamCountError(fn)
+	}
+
+	database, table := session.Schema(), string(args[0].Val)
+	if i := strings.Index(table, "."); i >= 0 {
+		database, table = table[:i], table[i+1:]
+	}
+	node := &sqlparser.Select{From: sqlparser.TableExprs{&sqlparser.AliasedTableExpr{
+		Expr: sqlparser.TableName{Name: sqlparser.NewTableIdent(table), Qualifier: sqlparser.NewTableIdent(database)},
+	}}}
+	if err := spanner.plugins.PlugPrivilege().Check(database, session.User(), node); err != nil {
+		return sqltypes.NULL, err
+	}
+	segments, err := spanner.router.Lookup(database, table, args[1], args[1])
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	shards := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		shards = append(shards, fmt.Sprintf("%s/%s", segment.Backend, segment.Table))
+	}
+	return sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(strings.Join(shards, ","))), nil
+}
+
+func radonFuncParamCountError(fn *sqlparser.FuncExpr) error {
+	return sqldb.NewSQLError1(erWrongParamcountToNativeFct, "42000", "Incorrect parameter count in the call to native function '%s'", fn.Name.String())
+}
@@ -0,0 +1,148 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyRadonFunc(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("use .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.g1(id int, b int) global", -1)
+	assert.Nil(t, err)
+
+	// RADON_SHARD.
+	{
+		val := sqlparser.NewIntVal([]byte("1001"))
+		segments, err := proxy.Router().Lookup("test", "t1", val, val)
+		assert.Nil(t, err)
+		want := fmt.Sprintf("%s/%s", segments[0].Backend, segments[0].Table)
+
+		qr, err := client.FetchAll("select radon_shard('test.t1', 1001), RADON_SHARD('test.t1', 1001) as shard, 'x'", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "radon_shard('test.t1', 1001)", qr.Fields[0].Name)
+		assert.Equal(t, "shard", qr.Fields[1].Name)
+		assert.Equal(t, 1, len(qr.Rows))
+		assert.Equal(t, want, qr.Rows[0][0].ToString())
+		assert.Equal(t, want, qr.Rows[0][1].ToString())
+		assert.Equal(t, "x", qr.Rows[0][2].ToString())
+
+		// The table in the current database.
+		_, err = client.FetchAll("use test", -1)
+		assert.Nil(t, err)
+		qr, err = client.FetchAll("select radon_shard('t1', 1001) from dual", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, want, qr.Rows[0][0].ToString())
+
+		// The global table is on all the backends.
+		segments, err = proxy.Router().Lookup("test", "g1", nil, nil)
+		assert.Nil(t, err)
+		qr, err = client.FetchAll("select radon_shard('g1', 1)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, len(segments), len(strings.Split(qr.Rows[0][0].ToString(), ",")))
+		assert.True(t, strings.HasPrefix(qr.Rows[0][0].ToString(), fmt.Sprintf("%s/g1,", segments[0].Backend)))
+	}
+
+	// RADON_UUID_SHORT.
+	{
+		qr, err := client.FetchAll("select radon_uuid_short(), radon_uuid_short()", -1)
+		assert.Nil(t, err)
+		id1, err := strconv.ParseUint(qr.Rows[0][0].ToString(), 10, 64)
+		assert.Nil(t, err)
+		id2, err := strconv.ParseUint(qr.Rows[0][1].ToString(), 10, 64)
+		assert.Nil(t, err)
+		assert.Equal(t, id1+1, id2)
+	}
+
+	// Errors.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{
+				"select radon_shard('t1')",
+				"Incorrect parameter count in the call to native function 'radon_shard' (errno 1582) (sqlstate 42000)",
+			},
+			{
+				"select radon_uuid_short(1)",
+				"Incorrect parameter count in the call to native function 'radon_uuid_short' (errno 1582) (sqlstate 42000)",
+			},
+			{
+				"select radon_shard('t1', b)",
+				"unsupported: radon_shard.args.must.be.literals (errno 1105) (sqlstate HY000)",
+			},
+			{
+				"select radon_shard('t9', 1)",
+				"Table 't9' doesn't exist (errno 1146) (sqlstate 42S02)",
+			},
+			{
+				"select radon_uuid_short(), now()",
+				"unsupported: radon.functions.with[now()] (errno 1105) (sqlstate HY000)",
+			},
+			{
+				"select radon_uuid_short() where 1=1",
+				"unsupported: radon.functions.with.where.group.by.having (errno 1105) (sqlstate HY000)",
+			},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+	}
+}
+
+func TestProxyRadonFuncPrivilegeN(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxyPrivilegeN(log, MockDefaultConfig())
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("select radon_shard('test.t1', 1)", -1)
+	assert.Equal(t, "Access denied for user 'mock'@'%' to database 'test' (errno 1045) (sqlstate 28000)", err.Error())
+}
@@ -0,0 +1,274 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+var (
+	renameDatabaseRegexp = regexp.MustCompile("(?is)^rename\\s+(database|schema)\\s+`?(\\w+)`?\\s+to\\s+`?(\\w+)`?$")
+	renameTableRegexp    = regexp.MustCompile("(?is)^rename\\s+tables?\\s+(.+)$")
+	renamePairRegexp     = regexp.MustCompile("(?is)^(?:`?(\\w+)`?\\.)?`?(\\w+)`?\\s+to\\s+(?:`?(\\w+)`?\\.)?`?(\\w+)`?$")
+)
+
+const (
+	// databaseObjectsQuery lists the tables, views, routines and events of the database on the backend.
+	databaseObjectsQuery = "select table_name from information_schema.tables where table_schema = '%[1]s' " +
+		"union all select routine_name from information_schema.routines where routine_schema = '%[1]s' " +
+		"union all select event_name from information_schema.events where event_schema = '%[1]s'"
+)
+
+// isRenameDatabase returns true if the query is a RENAME DATABASE statement, it's not supported by MySQL and the parser.
+func isRenameDatabase(query string) bool {
+	return renameDatabaseRegexp.MatchString(query)
+}
+
+// handleRenameDatabase used to handle the 'RENAME DATABASE db1 TO db2', all the tables of the database
+// are moved to the new database which is created by radon.
+func (spanner *Spanner) handleRenameDatabase(session *driver.Session, query string) (*sqltypes.Result, error) {
+	route := spanner.router
+	privilegePlug := spanner.plugins.PlugPrivilege()
+
+	matches := renameDatabaseRegexp.FindStringSubmatch(query)
+	database, toDatabase := matches[2], matches[3]
+	for _, db := range []string{database, toDatabase} {
+		if err := route.DatabaseACL(db); err != nil {
+			return nil, err
+		}
+		if !privilegePlug.CheckPrivilege(db, session.User(), &sqlparser.DDL{}) {
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'@'%%' to database '%v'", session.User(), db)
+		}
+	}
+	if spanner.ReadOnly() {
+		return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+	}
+	txSession := spanner.sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
+	}
+	return spanner.RenameDatabase(database, toDatabase)
+}
+
+// isRenameTable returns true if the query is a RENAME TABLE statement, it's not supported by the parser.
+func isRenameTable(query string) bool {
+	return renameTableRegexp.MatchString(query)
+}
+
+// handleRenameTable used to handle the 'RENAME TABLE t1 TO t2[, t3 TO t4]', every pair is renamed as the
+// 'ALTER TABLE t1 RENAME TO t2' in order. If one pair fails, the pairs already renamed are renamed back.
+func (spanner *Spanner) handleRenameTable(session *driver.Session, query string) (*sqltypes.Result, error) {
+	log := spanner.log
+
+	if spanner.ReadOnly() {
+		return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+	}
+	matches := renameTableRegexp.FindStringSubmatch(query)
+	var ddls []*sqlparser.DDL
+	for _, pair := range strings.Split(matches[1], ",") {
+		names := renamePairRegexp.FindStringSubmatch(strings.TrimSpace(pair))
+		if names == nil {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, fmt.Sprintf("near '%s'", strings.TrimSpace(pair)))
+		}
+		// The names without the database are in the current database as MySQL does.
+		database, toDatabase := names[1], names[3]
+		if database == "" {
+			database = session.Schema()
+		}
+		if toDatabase == "" {
+			toDatabase = session.Schema()
+		}
+		if database == "" || toDatabase == "" {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+		}
+		ddls = append(ddls, &sqlparser.DDL{
+			Action:  sqlparser.RenameStr,
+			Table:   sqlparser.TableName{Qualifier: sqlparser.NewTableIdent(database), Name: sqlparser.NewTableIdent(names[2])},
+			NewName: sqlparser.TableName{Qualifier: sqlparser.NewTableIdent(toDatabase), Name: sqlparser.NewTableIdent(names[4])},
+		})
+	}
+
+	for i, ddl := range ddls {
+		if _, err := spanner.handleDDL(session, sqlparser.String(ddl), ddl); err != nil {
+			// Rename the renamed pairs back in the reverse order.
+			for j := i - 1; j >= 0; j-- {
+				done := ddls[j]
+				if _, x := spanner.RenameTable(done.NewName.Qualifier.String(), done.NewName.Name.String(), done.Table.Qualifier.String(), done.Table.Name.String()); x != nil {
+					log.Error("spanner.rename.table.rollback[%s].error:%+v", sqlparser.String(done), x)
+				}
+			}
+			return nil, err
+		}
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// RenameTable used to move the table to the database with the new name, the segments are renamed
+// by replacing the table name prefix on the backends, then the metadata is moved.
+// If one backend fails, the backends already renamed are renamed back.
+func (spanner *Spanner) RenameTable(database string, table string, toDatabase string, toTable string) (*sqltypes.Result, error) {
+	route := spanner.router
+
+	if err := spanner.checkReshardTable(database, table); err != nil {
+		return nil, err
+	}
+	renames, err := route.TableRenames(database, table, toDatabase, toTable)
+	if err != nil {
+		return nil, err
+	}
+	rollback, err := spanner.renameOnBackends(database, toDatabase, renames)
+	if err != nil {
+		return nil, err
+	}
+	if err := route.RenameTable(database, table, toDatabase, toTable, renames); err != nil {
+		rollback()
+		return nil, err
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// RenameDatabase used to rename the database as MySQL can't: the new database is created on the backends,
+// the segments of all the tables are moved to it with one RENAME TABLE statement on every backend,
+// then the metadata is moved and the old database is dropped.
+// If any step before the metadata fails, the segments are renamed back and the new database is dropped.
+// Note:
+// The rename is refused if the old database has the objects radon doesn't know on the backends, such as the views
+// and the procedures, and the old database is left in place on the backends if it's not empty after the move.
+func (spanner *Spanner) RenameDatabase(database string, toDatabase string) (*sqltypes.Result, error) {
+	log := spanner.log
+	route := spanner.router
+
+	if !route.DatabaseExists(database) {
+		return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+	}
+	if route.DatabaseExists(toDatabase) {
+		return nil, sqldb.NewSQLError(sqldb.ER_DB_CREATE_EXISTS, toDatabase)
+	}
+	if err := spanner.checkReshardDatabase(database); err != nil {
+		return nil, err
+	}
+
+	log.Warning("spanner.rename.database[%s].to[%s]", database, toDatabase)
+	if _, err := spanner.ExecuteScatter(fmt.Sprintf("create database if not exists %s", sqlparser.Backtick(toDatabase))); err != nil {
+		return nil, err
+	}
+	if err := route.CreateDatabase(toDatabase); err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		if err := route.DropDatabase(toDatabase); err != nil {
+			log.Error("spanner.rename.database.cleanup.router[%s].error:%+v", toDatabase, err)
+		}
+		if _, err := spanner.ExecuteScatter(fmt.Sprintf("drop database if exists %s", sqlparser.Backtick(toDatabase))); err != nil {
+			log.Error("spanner.rename.database.cleanup.backends[%s].error:%+v", toDatabase, err)
+		}
+	}
+
+	tables := route.Tables()[database]
+	sort.Strings(tables)
+	var all []router.SegmentRename
+	renames := make(map[string][]router.SegmentRename)
+	for _, table := range tables {
+		tableRenames, err := route.TableRenames(database, table, toDatabase, table)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		renames[table] = tableRenames
+		all = append(all, tableRenames...)
+	}
+	known := make(map[string]map[string]bool)
+	for _, rename := range all {
+		if known[rename.Backend] == nil {
+			known[rename.Backend] = make(map[string]bool)
+		}
+		known[rename.Backend][rename.From] = true
+	}
+	for _, backend := range spanner.scatter.Backends() {
+		unknown, err := spanner.databaseObjects(backend, database, known[backend])
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		if len(unknown) > 0 {
+			cleanup()
+			return nil, errors.Errorf("unsupported: the.database[%s].on.backend[%s].has.the.objects%v.radon.doesn't.know", database, backend, unknown)
+		}
+	}
+	rollback, err := spanner.renameOnBackends(database, toDatabase, all)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	for i, table := range tables {
+		if err := route.RenameTable(database, table, toDatabase, table, renames[table]); err != nil {
+			// Move the metadata of the moved tables back.
+			for _, moved := range tables[:i] {
+				var back []router.SegmentRename
+				for _, rename := range renames[moved] {
+					back = append(back, router.SegmentRename{Backend: rename.Backend, From: rename.To, To: rename.From})
+				}
+				if x := route.RenameTable(toDatabase, moved, database, moved, back); x != nil {
+					log.Error("spanner.rename.database.rollback.table[%s].error:%+v", moved, x)
+				}
+			}
+			rollback()
+			cleanup()
+			return nil, err
+		}
+	}
+
+	// The segments are all moved, drop the old database if it's empty on all the backends.
+	empty := true
+	for _, backend := range spanner.scatter.Backends() {
+		left, err := spanner.databaseObjects(backend, database, nil)
+		if err != nil || len(left) > 0 {
+			log.Warning("spanner.rename.database[%s].on[%s].not.empty[%v].error[%v].left.in.place", database, backend, left, err)
+			empty = false
+		}
+	}
+	if empty {
+		if _, err := spanner.ExecuteScatter(fmt.Sprintf("drop database if exists %s", sqlparser.Backtick(database))); err != nil {
+			log.Error("spanner.rename.database.drop.backends[%s].error:%+v", database, err)
+			return nil, err
+		}
+	}
+	if err := route.DropDatabase(database); err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// databaseObjects returns the objects of the database on the backend not in the known, sorted by the name.
+func (spanner *Spanner) databaseObjects(backend string, database string, known map[string]bool) ([]string, error) {
+	qr, err := spanner.ExecuteOnThisBackend(backend, fmt.Sprintf(databaseObjectsQuery, database))
+	if err != nil {
+		return nil, err
+	}
+	var unknown []string
+	for _, row := range qr.Rows {
+		if len(row) > 0 && !known[row[0].String()] {
+			unknown = append(unknown, row[0].String())
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
@@ -0,0 +1,343 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+)
+
+func TestProxyRenameTable(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rename table .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create database db2",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	renameQuery := func(from string, to string, start int, end int) string {
+		var pairs []string
+		for i := start; i < end; i++ {
+			pairs = append(pairs, fmt.Sprintf("%s_%04d` to %s_%04d`", from, i, to, i))
+		}
+		return "rename table " + strings.Join(pairs, ", ")
+	}
+
+	// Backend error, the renamed backends are rolled back.
+	{
+		fakedbs.AddQueryError(renameQuery("`test`.`t1", "`db2`.`t2", 24, 30), errors.New("mock.rename.error"))
+		_, err := client.FetchAll("alter table test.t1 rename to db2.t2", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(renameQuery("`db2`.`t2", "`test`.`t1", 0, 6)))
+
+		segments, err := spanner.router.Lookup("test", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_0000", segments[0].Table)
+		fakedbs.ResetErrors()
+	}
+
+	// Move the table to the other database.
+	{
+		_, err := client.FetchAll("alter table test.t1 rename to db2.t2", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, fakedbs.GetQueryCalledNum(renameQuery("`test`.`t1", "`db2`.`t2", 24, 30)))
+
+		segments, err := spanner.router.Lookup("db2", "t2", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t2_0000", segments[0].Table)
+		_, err = spanner.router.TableConfig("test", "t1")
+		assert.NotNil(t, err)
+	}
+
+	// Rename in the database.
+	{
+		_, err := client.FetchAll("alter table test.g1 rename test.g2", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, fakedbs.GetQueryCalledNum("rename table `test`.`g1` to `test`.`g2`"))
+	}
+
+	// Errors.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{
+				"alter table test.t9 rename to db2.t9",
+				"Table 't9' doesn't exist (errno 1146) (sqlstate 42S02)",
+			},
+			{
+				"alter table db9.t9 rename to db2.t9",
+				"Unknown database 'db9' (errno 1049) (sqlstate 42000)",
+			},
+			{
+				"alter table test.g2 rename to db9.g2",
+				"Unknown database 'db9' (errno 1049) (sqlstate 42000)",
+			},
+			{
+				"alter table test.g2 rename to g3",
+				"No database selected (errno 1046) (sqlstate 3D000)",
+			},
+			{
+				"alter table db2.t2 rename to test.g2",
+				"Table 'g2' already exists (errno 1050) (sqlstate 42S01)",
+			},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+	}
+}
+
+func TestProxyRenameDatabase(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rename table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop database .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select table_name from information_schema.*", &sqltypes.Result{})
+	}
+	objects := func(database string, names ...string) {
+		qr := &sqltypes.Result{Fields: []*querypb.Field{{Name: "table_name", Type: querypb.Type_VARCHAR}}}
+		for _, name := range names {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(name))})
+		}
+		fakedbs.AddQuery(fmt.Sprintf(databaseObjectsQuery, database), qr)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create database db2",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// The objects radon doesn't know, the rename is refused.
+	{
+		objects("test", "g1", "v1")
+		_, err := client.FetchAll("rename database test to db3", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "unsupported: the.database[test].on.backend[backend0].has.the.objects[v1].radon.doesn't.know"), err.Error())
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum("rename table `test`.`g1` to `db3`.`g1`"))
+		assert.Equal(t, 5, fakedbs.GetQueryCalledNum("drop database if exists `db3`"))
+		assert.False(t, spanner.router.DatabaseExists("db3"))
+		objects("test")
+	}
+
+	// Backend error, the renamed backends are rolled back and the new database is dropped.
+	{
+		fakedbs.AddQueryErrorPattern("rename table `test`.`g1` to `db3`.`g1`, `test`.`t1_0024` .*", errors.New("mock.rename.error"))
+		_, err := client.FetchAll("rename database test to db3", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, 10, fakedbs.GetQueryCalledNum("drop database if exists `db3`"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("rename table `db3`.`g1` to `test`.`g1`, `db3`.`t1_0000` to `test`.`t1_0000`, `db3`.`t1_0001` to `test`.`t1_0001`, "+
+			"`db3`.`t1_0002` to `test`.`t1_0002`, `db3`.`t1_0003` to `test`.`t1_0003`, `db3`.`t1_0004` to `test`.`t1_0004`, `db3`.`t1_0005` to `test`.`t1_0005`"))
+		assert.False(t, spanner.router.DatabaseExists("db3"))
+		_, err = spanner.router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		fakedbs.ResetPatternErrors()
+	}
+
+	// Rename.
+	{
+		_, err := client.FetchAll("rename database `test` to `db3`", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5, fakedbs.GetQueryCalledNum("drop database if exists `test`"))
+		assert.False(t, spanner.router.DatabaseExists("test"))
+
+		segments, err := spanner.router.Lookup("db3", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_0000", segments[0].Table)
+		_, err = spanner.router.TableConfig("db3", "g1")
+		assert.Nil(t, err)
+	}
+
+	// The old database isn't empty after the move, it's left in place.
+	{
+		objects("db3", "g1")
+		dropped := fakedbs.GetQueryCalledNum("drop database if exists `db3`")
+		_, err := client.FetchAll("rename database db3 to db5", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, dropped, fakedbs.GetQueryCalledNum("drop database if exists `db3`"))
+		assert.False(t, spanner.router.DatabaseExists("db3"))
+		objects("db3")
+		_, err = client.FetchAll("rename database db5 to db3", -1)
+		assert.Nil(t, err)
+	}
+
+	// Errors.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{
+				"rename database db9 to db10",
+				"Unknown database 'db9' (errno 1049) (sqlstate 42000)",
+			},
+			{
+				"rename schema db3 to db2",
+				"Can't create database 'db2'; database exists (errno 1007) (sqlstate HY000)",
+			},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+	}
+
+	// Read only.
+	{
+		proxy.SetReadOnly(true)
+		_, err := client.FetchAll("rename database db3 to db4", -1)
+		assert.Equal(t, "The MySQL server is running with the --read-only option so it cannot execute this statement (errno 1290) (sqlstate 42000)", err.Error())
+		proxy.SetReadOnly(false)
+	}
+}
+
+func TestProxyRenameTableStatement(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rename table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create database db2",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// Rename the pairs.
+	{
+		_, err := client.FetchAll("rename table test.t1 to `db2`.`t2`, test.g1 to test.g2", -1)
+		assert.Nil(t, err)
+		segments, err := spanner.router.Lookup("db2", "t2", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t2_0000", segments[0].Table)
+		_, err = spanner.router.TableConfig("test", "g2")
+		assert.Nil(t, err)
+		assert.Equal(t, 5, fakedbs.GetQueryCalledNum("rename table `test`.`g1` to `test`.`g2`"))
+	}
+
+	// The names without the database are in the current database.
+	{
+		client1, err := driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+		assert.Nil(t, err)
+		defer client1.Close()
+		_, err = client1.FetchAll("RENAME TABLE g2 TO g3;", -1)
+		assert.Nil(t, err)
+		_, err = spanner.router.TableConfig("test", "g3")
+		assert.Nil(t, err)
+	}
+
+	// One pair fails, the renamed pairs are renamed back.
+	{
+		_, err := client.FetchAll("rename table db2.t2 to test.t1, test.g9 to test.g10", -1)
+		assert.Equal(t, "Table 'g9' doesn't exist (errno 1146) (sqlstate 42S02)", err.Error())
+		_, err = spanner.router.TableConfig("db2", "t2")
+		assert.Nil(t, err)
+		_, err = spanner.router.TableConfig("test", "t1")
+		assert.NotNil(t, err)
+	}
+
+	// Errors.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{
+				"rename table t1 to t2",
+				"No database selected (errno 1046) (sqlstate 3D000)",
+			},
+			{
+				"rename table test.g3",
+				"You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, near 'test.g3' (errno 1149) (sqlstate 42000)",
+			},
+			{
+				"rename table test.g3 to db2.t2",
+				"Table 't2' already exists (errno 1050) (sqlstate 42S01)",
+			},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+	}
+
+	// Read only.
+	{
+		proxy.SetReadOnly(true)
+		_, err := client.FetchAll("rename table test.g3 to test.g4", -1)
+		assert.Equal(t, "The MySQL server is running with the --read-only option so it cannot execute this statement (errno 1290) (sqlstate 42000)", err.Error())
+		proxy.SetReadOnly(false)
+	}
+}
@@ -0,0 +1,737 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"config"
+	"executor"
+	"optimizer"
+	"planner"
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// The states of the resharding.
+const (
+	reshardCreating  = "creating"
+	reshardCopying   = "copying"
+	reshardVerifying = "verifying"
+	reshardSwapping  = "swapping"
+	reshardDone      = "done"
+	reshardFailed    = "failed"
+)
+
+const (
+	// reshardShadowSuffix is the suffix of the shadow table name.
+	reshardShadowSuffix = "_reshard"
+	// reshardVerifyRetries is the times the row counts are compared, the writes between the two counts make them differ.
+	reshardVerifyRetries = 3
+)
+
+// ReshardStatus tuple, the progress of the resharding of the table.
+type ReshardStatus struct {
+	Database   string `json:"database"`
+	Table      string `json:"table"`
+	Shadow     string `json:"shadow"`
+	ShardKey   string `json:"shard-key"`
+	Partitions int    `json:"partitions"`
+	State      string `json:"state"`
+	// Segments is the segments of the table to copy, Copied is the segments copied.
+	Segments int       `json:"segments"`
+	Copied   int       `json:"copied"`
+	Rows     uint64    `json:"rows"`
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+
+	end time.Time
+}
+
+// Reshards keeps the status of the latest resharding of the tables in memory.
+type Reshards struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	done     chan struct{}
+	statuses map[string]*ReshardStatus
+}
+
+// NewReshards creates the new Reshards.
+func NewReshards() *Reshards {
+	return &Reshards{
+		done:     make(chan struct{}),
+		statuses: make(map[string]*ReshardStatus),
+	}
+}
+
+// Close used to abort the reshardings in progress and wait for them.
+func (rs *Reshards) Close() {
+	close(rs.done)
+	rs.wg.Wait()
+}
+
+// aborted returns true if the reshardings are aborted by the closing.
+func (rs *Reshards) aborted() bool {
+	select {
+	case <-rs.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// begin used to add the status of the new resharding, the table can't be resharded twice at the same time.
+func (rs *Reshards) begin(status *ReshardStatus) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	key := status.Database + "." + status.Table
+	if old, ok := rs.statuses[key]; ok && old.State != reshardDone && old.State != reshardFailed {
+		return errors.Errorf("spanner.reshard.table[%s].is.in.resharding", key)
+	}
+	rs.statuses[key] = status
+	rs.wg.Add(1)
+	return nil
+}
+
+// update used to change the status under the lock.
+func (rs *Reshards) update(status *ReshardStatus, fn func(status *ReshardStatus)) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	fn(status)
+}
+
+// snapshot returns the copy of the status.
+func (rs *Reshards) snapshot(status *ReshardStatus) *ReshardStatus {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return status.copy()
+}
+
+// Statuses returns the statuses of the reshardings, sorted by the database and the table.
+func (rs *Reshards) Statuses() []*ReshardStatus {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	var keys []string
+	for key := range rs.statuses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	statuses := make([]*ReshardStatus, 0, len(keys))
+	for _, key := range keys {
+		statuses = append(statuses, rs.statuses[key].copy())
+	}
+	return statuses
+}
+
+// copy returns the copy of the status with the duration till now if it's not finished.
+func (s *ReshardStatus) copy() *ReshardStatus {
+	c := *s
+	end := c.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	c.Duration = end.Sub(c.Start).String()
+	return &c
+}
+
+// Reshards returns the reshardings of the tables.
+func (spanner *Spanner) Reshards() *Reshards {
+	return spanner.reshards
+}
+
+// Reshard used to change the shard key or the segments number of the HASH or CHASH table online, the shard key is kept if
+// it's empty and the segments number is kept if the partitions is 0. The resharding runs in the background:
+//  1. Create the shadow table of the new layout with the SHOW CREATE TABLE of the table.
+//  2. Mirror the INSERT, UPDATE and DELETE of the table to the shadow table in the same 2pc transaction.
+//  3. Copy the rows segment by segment in the primary key ranges, the rows of the range are locked by the SELECT ... FOR UPDATE
+//     and REPLACEd into the shadow table in one XA transaction, so the copy doesn't overwrite the mirrored writes.
+//  4. Compare the row counts of the two tables.
+//  5. Swap the layout of the table with the shadow table's in the router and drop the old segments.
+//
+// If it fails, the mirroring is stopped and the shadow table is dropped, the table is unchanged.
+func (spanner *Spanner) Reshard(database string, table string, shardKey string, partitions int) (*ReshardStatus, error) {
+	route := spanner.router
+
+	tconf, err := route.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tconf.ShardType != "HASH" && tconf.ShardType != "CHASH":
+		return nil, errors.Errorf("spanner.reshard.table[%s.%s].must.be.the.HASH.or.CHASH.table", database, table)
+	case len(tconf.Lookups) > 0 || tconf.LookupOf != "":
+		return nil, errors.Errorf("spanner.reshard.table[%s.%s].has.lookups.or.is.a.lookup.table", database, table)
+	case len(tconf.Triggers) > 0:
+		// The triggers on the shadow segments would fire for the copied and mirrored rows again.
+		return nil, errors.Errorf("spanner.reshard.table[%s.%s].has.triggers", database, table)
+	case tconf.ReshardTo != "" || tconf.ReshardOf != "":
+		return nil, errors.Errorf("spanner.reshard.table[%s.%s].is.in.resharding", database, table)
+	case partitions < 0:
+		return nil, errors.Errorf("spanner.reshard.partitions[%d].can't.be.negative", partitions)
+	}
+	if shardKey == "" {
+		shardKey = tconf.ShardKey
+	}
+	if partitions == 0 {
+		partitions = len(tconf.Partitions)
+	}
+	if strings.EqualFold(shardKey, tconf.ShardKey) && partitions == len(tconf.Partitions) {
+		return nil, errors.Errorf("spanner.reshard.table[%s.%s].layout.is.unchanged", database, table)
+	}
+	shadow := reshardShadow(tconf)
+	if _, err := route.TableConfig(database, shadow); err == nil {
+		return nil, errors.Errorf("spanner.reshard.shadow.table[%s.%s].already.exists", database, shadow)
+	}
+
+	status := &ReshardStatus{
+		Database:   database,
+		Table:      table,
+		Shadow:     shadow,
+		ShardKey:   shardKey,
+		Partitions: partitions,
+		State:      reshardCreating,
+		Segments:   len(tconf.Partitions),
+		Start:      time.Now(),
+	}
+	if err := spanner.reshards.begin(status); err != nil {
+		return nil, err
+	}
+	go func() {
+		defer spanner.reshards.wg.Done()
+		spanner.reshard(status, tconf)
+	}()
+	return spanner.reshards.snapshot(status), nil
+}
+
+// reshardShadow returns the name of the shadow table, the segments of the table resharded before are named by its
+// shadow table, the new shadow table takes the other name so its segments don't collide with them.
+func reshardShadow(tconf *config.TableConfig) string {
+	for i := 1; ; i++ {
+		shadow := tconf.Name + reshardShadowSuffix
+		if i > 1 {
+			shadow = fmt.Sprintf("%s%d", shadow, i)
+		}
+		used := false
+		for _, part := range tconf.Partitions {
+			if strings.HasPrefix(part.Table, shadow+"_") {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return shadow
+		}
+	}
+}
+
+// reshard used to run the resharding of the status.
+func (spanner *Spanner) reshard(status *ReshardStatus, tconf *config.TableConfig) {
+	log := spanner.log
+	route := spanner.router
+	reshards := spanner.reshards
+	database, table, shadow := status.Database, status.Table, status.Shadow
+
+	setState := func(state string) {
+		log.Warning("spanner.reshard[%s.%s].to[%s].state[%s]", database, table, shadow, state)
+		reshards.update(status, func(status *ReshardStatus) { status.State = state })
+	}
+	fail := func(err error) {
+		log.Error("spanner.reshard[%s.%s].to[%s].state[%s].error:%+v", database, table, shadow, status.State, err)
+		reshards.update(status, func(status *ReshardStatus) {
+			status.State = reshardFailed
+			status.Error = err.Error()
+			status.end = time.Now()
+		})
+	}
+
+	// 1. Create the shadow table.
+	keys, err := spanner.createReshardShadow(status, tconf)
+	if err != nil {
+		fail(err)
+		return
+	}
+	// cleanup used to stop the mirroring and drop the shadow table, the errors are only logged.
+	cleanup := func() {
+		if err := route.CancelReshard(database, table); err != nil {
+			log.Error("spanner.reshard[%s.%s].cancel.error:%+v", database, table, err)
+		}
+		spanner.dropReshardShadow(database, shadow)
+	}
+
+	// 2. Mirror the writes.
+	if err := route.StartReshard(database, table, shadow); err != nil {
+		spanner.dropReshardShadow(database, shadow)
+		fail(err)
+		return
+	}
+
+	// 3. Copy the rows.
+	setState(reshardCopying)
+	for _, part := range tconf.Partitions {
+		if reshards.aborted() {
+			cleanup()
+			fail(errors.New("spanner.reshard.aborted.by.the.closing"))
+			return
+		}
+		rows, err := spanner.copyReshardSegment(database, shadow, part, keys)
+		if err != nil {
+			cleanup()
+			fail(err)
+			return
+		}
+		reshards.update(status, func(status *ReshardStatus) {
+			status.Copied++
+			status.Rows += rows
+		})
+	}
+
+	// 4. Verify the row counts.
+	setState(reshardVerifying)
+	if err := spanner.verifyReshard(database, table, shadow); err != nil {
+		cleanup()
+		fail(err)
+		return
+	}
+
+	// 5. Swap the layouts.
+	setState(reshardSwapping)
+	olds, err := route.SwapReshard(database, table)
+	if err != nil {
+		cleanup()
+		fail(err)
+		return
+	}
+	spanner.dropSegments(database, olds)
+	spanner.autoAnalyze(database, table)
+	reshards.update(status, func(status *ReshardStatus) {
+		status.State = reshardDone
+		status.end = time.Now()
+	})
+	log.Warning("spanner.reshard[%s.%s].shard.key[%s].partitions[%d].rows[%d].done", database, table, status.ShardKey, status.Partitions, status.Rows)
+}
+
+// createReshardShadow used to create the shadow table of the new layout on the backends and in the router,
+// the segments are created by the SHOW CREATE TABLE of the first segment of the table.
+// It returns the primary key columns of the table, the rows are copied in their ranges.
+func (spanner *Spanner) createReshardShadow(status *ReshardStatus, tconf *config.TableConfig) ([]string, error) {
+	route := spanner.router
+	database, shadow := status.Database, status.Shadow
+
+	first := tconf.Partitions[0]
+	segment := fmt.Sprintf("%s.%s", sqlparser.Backtick(database), sqlparser.Backtick(first.Table))
+	qr, err := spanner.ExecuteOnThisBackend(first.Backend, fmt.Sprintf("show columns from %s", segment))
+	if err != nil {
+		return nil, err
+	}
+	// The shard key column must be in the table, its type decides the shard-key-type.
+	keyType := ""
+	found := false
+	for _, row := range qr.Rows {
+		if len(row) > 1 && strings.EqualFold(row[0].String(), status.ShardKey) {
+			found = true
+			keyType = shardKeyTypeOf(row[1].String())
+			break
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("spanner.reshard.shard.key[%s].not.in.table[%s.%s]", status.ShardKey, database, status.Table)
+	}
+	qr, err = spanner.ExecuteOnThisBackend(first.Backend, fmt.Sprintf("show keys from %s where key_name = 'PRIMARY'", segment))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, row := range qr.Rows {
+		if len(row) > 4 {
+			keys = append(keys, row[4].String())
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.Errorf("spanner.reshard.table[%s.%s].must.have.the.primary.key", database, status.Table)
+	}
+	qr, err = spanner.ExecuteOnThisBackend(first.Backend, fmt.Sprintf("show create table %s", segment))
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) == 0 || len(qr.Rows[0]) < 2 {
+		return nil, errors.Errorf("spanner.reshard.table[%s.%s].show.create.table.is.empty", database, status.Table)
+	}
+	create := qr.Rows[0][1].String()
+
+	tableType := router.TableTypePartition
+	if tconf.ShardType == "CHASH" {
+		tableType = router.TableTypeCHash
+	}
+	backends := spanner.scatter.Backends()
+	extra := &router.Extra{Partitions: status.Partitions, ShardKeyType: keyType}
+	preview, err := route.PreviewTable(database, shadow, status.ShardKey, tableType, backends, extra)
+	if err != nil {
+		return nil, err
+	}
+	sconf, err := preview.TableConfig(database, shadow)
+	if err != nil {
+		return nil, err
+	}
+	var created []*config.PartitionConfig
+	for _, part := range sconf.Partitions {
+		query := strings.Replace(create, sqlparser.Backtick(first.Table), fmt.Sprintf("%s.%s", sqlparser.Backtick(database), sqlparser.Backtick(part.Table)), 1)
+		if _, err := spanner.ExecuteOnThisBackend(part.Backend, query); err != nil {
+			spanner.dropSegments(database, created)
+			return nil, err
+		}
+		created = append(created, part)
+	}
+	if err := route.CreateTable(database, shadow, status.ShardKey, tableType, backends, extra); err != nil {
+		spanner.dropSegments(database, created)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// dropReshardShadow used to drop the shadow table on the backends and in the router, the errors are only logged.
+func (spanner *Spanner) dropReshardShadow(database string, shadow string) {
+	log := spanner.log
+	route := spanner.router
+
+	sconf, err := route.TableConfig(database, shadow)
+	if err != nil {
+		log.Error("spanner.reshard.drop.shadow[%s.%s].error:%+v", database, shadow, err)
+		return
+	}
+	if err := route.DropTable(database, shadow); err != nil {
+		log.Error("spanner.reshard.drop.shadow[%s.%s].error:%+v", database, shadow, err)
+	}
+	spanner.dropSegments(database, sconf.Partitions)
+}
+
+// dropSegments used to drop the segments on the backends, the errors are only logged.
+func (spanner *Spanner) dropSegments(database string, parts []*config.PartitionConfig) {
+	log := spanner.log
+	for _, part := range parts {
+		query := fmt.Sprintf("drop table if exists %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(part.Table))
+		if _, err := spanner.ExecuteOnThisBackend(part.Backend, query); err != nil {
+			log.Error("spanner.drop.segment[%s].on[%s].error:%+v", query, part.Backend, err)
+		}
+	}
+}
+
+// copyReshardSegment used to copy the rows of the segment to the shadow table in the ranges of the primary keys,
+// each range of at most backupBatchRows rows is read by the SELECT ... FOR UPDATE and REPLACEd into the shadow table
+// in one XA transaction, so only the rows of the range are locked and kept in memory.
+func (spanner *Spanner) copyReshardSegment(database string, shadow string, part *config.PartitionConfig, keys []string) (uint64, error) {
+	keyList := make([]string, len(keys))
+	for i, key := range keys {
+		keyList[i] = sqlparser.Backtick(key)
+	}
+	order := strings.Join(keyList, ", ")
+
+	var rows uint64
+	var last []sqltypes.Value
+	for {
+		var where bytes.Buffer
+		if last != nil {
+			where.WriteString(fmt.Sprintf(" where (%s) > (", order))
+			for i, v := range last {
+				if i > 0 {
+					where.WriteString(", ")
+				}
+				v.EncodeSQL(&where)
+			}
+			where.WriteByte(')')
+		}
+		query := fmt.Sprintf("select * from %s.%s%s order by %s limit %d for update", sqlparser.Backtick(database), sqlparser.Backtick(part.Table), where.String(), order, backupBatchRows)
+		qr, err := spanner.copyReshardRange(database, shadow, part, query)
+		if err != nil {
+			return 0, err
+		}
+		rows += uint64(len(qr.Rows))
+		if len(qr.Rows) < backupBatchRows {
+			return rows, nil
+		}
+
+		// The next range starts after the keys of the last row.
+		row := qr.Rows[len(qr.Rows)-1]
+		last = make([]sqltypes.Value, 0, len(keys))
+		for _, key := range keys {
+			for i, field := range qr.Fields {
+				if strings.EqualFold(field.Name, key) {
+					last = append(last, row[i])
+					break
+				}
+			}
+		}
+		if len(last) != len(keys) {
+			return 0, errors.Errorf("spanner.reshard.copy.segment[%s].primary.keys%v.not.in.the.result", part.Table, keys)
+		}
+	}
+}
+
+// copyReshardRange used to read the rows of the query with the locks and REPLACE them into the shadow table in one XA transaction.
+func (spanner *Spanner) copyReshardRange(database string, shadow string, part *config.PartitionConfig, query string) (*sqltypes.Result, error) {
+	log := spanner.log
+	route := spanner.router
+
+	txn, err := spanner.scatter.CreateTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Finish()
+	txn.SetMultiStmtTxn()
+	if err := txn.BeginScatter(); err != nil {
+		return nil, err
+	}
+	rollback := func() {
+		if x := txn.RollbackScatter(); x != nil {
+			log.Error("spanner.reshard.copy.segment[%s].rollback.error:%+v", part.Table, x)
+		}
+	}
+
+	qr, err := txn.ExecuteOnThisBackend(part.Backend, query)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	if len(qr.Rows) > 0 {
+		columns := make([]string, len(qr.Fields))
+		for i, field := range qr.Fields {
+			columns[i] = sqlparser.Backtick(field.Name)
+		}
+		var buf bytes.Buffer
+		buf.WriteString(fmt.Sprintf("replace into %s.%s(%s) values ", sqlparser.Backtick(database), sqlparser.Backtick(shadow), strings.Join(columns, ",")))
+		for i, row := range qr.Rows {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('(')
+			for j, v := range row {
+				if j > 0 {
+					buf.WriteByte(',')
+				}
+				v.EncodeSQL(&buf)
+			}
+			buf.WriteByte(')')
+		}
+		replace := buf.String()
+		node, err := sqlparser.Parse(replace)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		plans, err := optimizer.NewSimpleOptimizer(log, database, replace, node, route).BuildPlanTree()
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if _, err := executor.NewTree(log, plans, txn).Execute(); err != nil {
+			rollback()
+			return nil, err
+		}
+	}
+	if err := txn.CommitScatter(); err != nil {
+		return nil, err
+	}
+	return qr, nil
+}
+
+// verifyReshard used to compare the row counts of the table and the shadow table, they're counted again if they differ
+// since the writes between the two counts.
+func (spanner *Spanner) verifyReshard(database string, table string, shadow string) error {
+	count := func(table string) (uint64, error) {
+		tconf, err := spanner.router.TableConfig(database, table)
+		if err != nil {
+			return 0, err
+		}
+		var rows uint64
+		for _, part := range tconf.Partitions {
+			qr, err := spanner.ExecuteOnThisBackend(part.Backend, fmt.Sprintf("select count(*) from %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(part.Table)))
+			if err != nil {
+				return 0, err
+			}
+			if len(qr.Rows) > 0 && len(qr.Rows[0]) > 0 {
+				n, err := qr.Rows[0][0].ParseUint64()
+				if err != nil {
+					return 0, err
+				}
+				rows += n
+			}
+		}
+		return rows, nil
+	}
+
+	var rows, shadowRows uint64
+	for i := 0; i < reshardVerifyRetries; i++ {
+		var err error
+		if rows, err = count(table); err != nil {
+			return err
+		}
+		if shadowRows, err = count(shadow); err != nil {
+			return err
+		}
+		if rows == shadowRows {
+			return nil
+		}
+	}
+	return errors.Errorf("spanner.reshard.table[%s.%s].rows[%d].shadow.rows[%d].differ", database, table, rows, shadowRows)
+}
+
+// executeReshardDML used to execute the INSERT, UPDATE or DELETE on the table in the resharding, it returns false if the
+// table isn't in the resharding. The statement is mirrored to the shadow table in the same 2pc transaction.
+func (spanner *Spanner) executeReshardDML(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, bool, error) {
+	route := spanner.router
+
+	resharding := func(tb sqlparser.TableName) (string, *config.TableConfig) {
+		db := database
+		if !tb.Qualifier.IsEmpty() {
+			db = tb.Qualifier.String()
+		}
+		tconf, err := route.TableConfig(db, tb.Name.String())
+		if err != nil || tconf.ReshardTo == "" {
+			return db, nil
+		}
+		return db, tconf
+	}
+	if planner.IsMultiTableDML(query) {
+		dml, err := planner.ParseMultiTableDML(query)
+		if err != nil {
+			return nil, false, nil
+		}
+		for _, tb := range dml.Tables() {
+			if db, tconf := resharding(tb); tconf != nil {
+				return nil, true, errors.Errorf("unsupported: the.multi-table.dml.on.table[%s.%s].in.resharding", db, tconf.Name)
+			}
+		}
+		return nil, false, nil
+	}
+
+	tb, ok := dmlTable(node)
+	if !ok {
+		return nil, false, nil
+	}
+	db, tconf := resharding(tb)
+	if tconf == nil {
+		return nil, false, nil
+	}
+	if txSession := spanner.sessions.getTxnSession(session); txSession != nil && txSession.shardKeyValue != nil {
+		return nil, true, errors.Errorf("unsupported: the.session.shard.key.value.on.table[%s.%s].in.resharding", db, tconf.Name)
+	}
+	switch node := node.(type) {
+	case *sqlparser.Insert:
+		if _, ok := node.Rows.(sqlparser.Values); !ok {
+			return nil, true, errors.Errorf("unsupported: the.insert.select.on.table[%s.%s].in.resharding", db, tconf.Name)
+		}
+	case *sqlparser.Update:
+		if node.Limit != nil {
+			return nil, true, errors.Errorf("unsupported: the.limit.on.table[%s.%s].in.resharding", db, tconf.Name)
+		}
+	case *sqlparser.Delete:
+		if node.Limit != nil {
+			return nil, true, errors.Errorf("unsupported: the.limit.on.table[%s.%s].in.resharding", db, tconf.Name)
+		}
+	}
+
+	mirror, err := reshardMirror(node, tb.Name.String(), db, tconf.ReshardTo)
+	if err != nil {
+		return nil, true, err
+	}
+	qr, err := spanner.executeLookupTxn(session, database, query, node, func(exec lookupExec) (*sqltypes.Result, error) {
+		qr, err := exec(node)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := exec(mirror); err != nil {
+			return nil, err
+		}
+		return qr, nil
+	})
+	return qr, true, err
+}
+
+// reshardMirror returns the copy of the DML on the shadow table, the qualifiers of the columns of the table are removed
+// since the planner doesn't rewrite them to the segments.
+func reshardMirror(node sqlparser.Statement, table string, database string, shadow string) (sqlparser.Statement, error) {
+	mirror, err := sqlparser.Parse(sqlparser.String(node))
+	if err != nil {
+		return nil, err
+	}
+	name := sqlparser.TableName{Name: sqlparser.NewTableIdent(shadow), Qualifier: sqlparser.NewTableIdent(database)}
+	switch mirror := mirror.(type) {
+	case *sqlparser.Insert:
+		mirror.Table = name
+	case *sqlparser.Update:
+		mirror.Table = name
+	case *sqlparser.Delete:
+		mirror.Table = name
+	}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok && col.Qualifier.Name.String() == table {
+			col.Qualifier = sqlparser.TableName{}
+		}
+		return true, nil
+	}, mirror)
+	return mirror, nil
+}
+
+// checkReshardDDL returns the error if the DDL changes the table in the resharding or its shadow table,
+// the DROP DATABASE is refused if one of its tables is in the resharding.
+func (spanner *Spanner) checkReshardDDL(database string, ddl *sqlparser.DDL) error {
+	var tables []sqlparser.TableName
+	switch ddl.Action {
+	case sqlparser.CreateDBStr, sqlparser.CreateTableStr:
+		return nil
+	case sqlparser.DropDBStr:
+		db := database
+		if !ddl.Database.IsEmpty() {
+			db = ddl.Database.String()
+		}
+		return spanner.checkReshardDatabase(db)
+	case sqlparser.DropTableStr:
+		tables = ddl.Tables
+	default:
+		tables = []sqlparser.TableName{ddl.Table}
+	}
+	for _, tb := range tables {
+		db := database
+		if !tb.Qualifier.IsEmpty() {
+			db = tb.Qualifier.String()
+		}
+		if err := spanner.checkReshardTable(db, tb.Name.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReshardDatabase returns the error if one of the tables of the database is in the resharding.
+func (spanner *Spanner) checkReshardDatabase(database string) error {
+	for _, table := range spanner.router.Tables()[database] {
+		if err := spanner.checkReshardTable(database, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReshardTable returns the error if the table is in the resharding or it's the shadow table.
+func (spanner *Spanner) checkReshardTable(database string, table string) error {
+	tconf, err := spanner.router.TableConfig(database, table)
+	if err == nil && (tconf.ReshardTo != "" || tconf.ReshardOf != "") {
+		return errors.Errorf("unsupported: the.table[%s.%s].is.in.resharding", database, tconf.Name)
+	}
+	return nil
+}
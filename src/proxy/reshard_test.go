@@ -0,0 +1,305 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// waitReshard used to wait for the resharding of the table to finish.
+func waitReshard(t *testing.T, spanner *Spanner, table string) *ReshardStatus {
+	for i := 0; i < 500; i++ {
+		for _, status := range spanner.Reshards().Statuses() {
+			if status.Table == table && (status.State == reshardDone || status.State == reshardFailed) {
+				return status
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("reshard.table[%s].timeout", table)
+	return nil
+}
+
+func TestProxyReshard(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+	route := proxy.Router()
+
+	columnsResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Field", Type: querypb.Type_VARCHAR},
+			{Name: "Type", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("int(11)")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("name")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("varchar(10)")),
+			},
+		},
+	}
+	createResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Table", Type: querypb.Type_VARCHAR},
+			{Name: "Create Table", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `t1_0000` (\n  `id` int(11) DEFAULT NULL,\n  `name` varchar(10) DEFAULT NULL\n) ENGINE=InnoDB")),
+			},
+		},
+	}
+	keysResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Table", Type: querypb.Type_VARCHAR},
+			{Name: "Non_unique", Type: querypb.Type_INT64},
+			{Name: "Key_name", Type: querypb.Type_VARCHAR},
+			{Name: "Seq_in_index", Type: querypb.Type_INT64},
+			{Name: "Column_name", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1_0000")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("PRIMARY")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("id")),
+			},
+		},
+	}
+	countResult := func(n string) *sqltypes.Result {
+		return &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "count(*)", Type: querypb.Type_INT64},
+			},
+			Rows: [][]sqltypes.Value{
+				{sqltypes.MakeTrusted(querypb.Type_INT64, []byte(n))},
+			},
+		}
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show columns from .*", columnsResult)
+		fakedbs.AddQueryPattern("show create table .*", createResult)
+		fakedbs.AddQueryPattern("show keys from .*", keysResult)
+		fakedbs.AddQuery("show keys from `test`.`t5_0000` where key_name = 'primary'", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select \\* from .* for update", fakedb.Result1)
+		// 30 segments of 2 rows and 10 segments of 6 rows.
+		fakedbs.AddQueryPattern("select count\\(\\*\\) from `test`.`t1_reshard_.*`", countResult("6"))
+		fakedbs.AddQueryPattern("select count\\(\\*\\) from .*", countResult("2"))
+		fakedbs.AddQueryPattern("replace into .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("insert .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("update .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("delete .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryErrorPattern("replace into test.t3_reshard_.*", errors.New("mock.replace.error"))
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, name varchar(10)) partition by hash(id)",
+		"create table test.t2(id int, b int, c int) partition by hash(id)",
+		"create table test.t3(id int, name varchar(10)) partition by hash(id)",
+		"create table test.t4(id int, name varchar(10)) partition by hash(id)",
+		"create table test.t5(id int, name varchar(10)) partition by hash(id)",
+		"create table test.g1(id int) global",
+		"create trigger test.trg1 before insert on test.t4 for each row set new.name='x'",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// Reshard errors.
+	{
+		tests := []struct {
+			table      string
+			shardKey   string
+			partitions int
+			err        string
+		}{
+			{"t9", "", 8, "Table 't9' doesn't exist (errno 1146) (sqlstate 42S02)"},
+			{"g1", "", 8, "spanner.reshard.table[test.g1].must.be.the.HASH.or.CHASH.table"},
+			{"t1", "", -1, "spanner.reshard.partitions[-1].can't.be.negative"},
+			{"t1", "id", 0, "spanner.reshard.table[test.t1].layout.is.unchanged"},
+			{"t4", "", 8, "spanner.reshard.table[test.t4].has.triggers"},
+		}
+		for _, test := range tests {
+			_, err := spanner.Reshard("test", test.table, test.shardKey, test.partitions)
+			assert.NotNil(t, err)
+			assert.Equal(t, test.err, err.Error())
+		}
+	}
+
+	// Reshard t1 to 10 segments.
+	{
+		status, err := spanner.Reshard("test", "t1", "", 10)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_reshard", status.Shadow)
+		assert.Equal(t, "id", status.ShardKey)
+		assert.Equal(t, 30, status.Segments)
+
+		status = waitReshard(t, spanner, "t1")
+		assert.Equal(t, reshardDone, status.State, status.Error)
+		assert.Equal(t, 30, status.Copied)
+		assert.Equal(t, uint64(60), status.Rows)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create table `test`.`t1_reshard_0009` (\n  `id` int(11) default null,\n  `name` varchar(10) default null\n) engine=innodb"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("drop table if exists `test`.`t1_0029`"))
+
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(tconf.Partitions))
+		assert.Equal(t, "t1_reshard_0000", tconf.Partitions[0].Table)
+		assert.Equal(t, "", tconf.ReshardTo)
+		_, err = route.TableConfig("test", "t1_reshard")
+		assert.NotNil(t, err)
+	}
+
+	// Reshard t1 again, the shadow takes the other name and the segment is copied in the primary key ranges.
+	{
+		fields := []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "name", Type: querypb.Type_VARCHAR},
+		}
+		full := &sqltypes.Result{Fields: fields}
+		for i := 1; i <= backupBatchRows; i++ {
+			full.Rows = append(full.Rows, []sqltypes.Value{
+				sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%d", i))),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("x")),
+			})
+		}
+		fakedbs.AddQuery(fmt.Sprintf("select * from `test`.`t1_reshard_0000` order by `id` limit %d for update", backupBatchRows), full)
+
+		status, err := spanner.Reshard("test", "t1", "", 30)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_reshard2", status.Shadow)
+		status = waitReshard(t, spanner, "t1")
+		assert.Equal(t, reshardDone, status.State, status.Error)
+		assert.Equal(t, 10, status.Copied)
+		assert.Equal(t, uint64(9*2+backupBatchRows+2), status.Rows)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("select * from `test`.`t1_reshard_0000` where (`id`) > (%d) order by `id` limit %d for update", backupBatchRows, backupBatchRows)))
+
+		tconf, err := route.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, 30, len(tconf.Partitions))
+		assert.Equal(t, "t1_reshard2_0000", tconf.Partitions[0].Table)
+	}
+
+	// Reshard t5 without the primary key fails.
+	{
+		_, err := spanner.Reshard("test", "t5", "", 10)
+		assert.Nil(t, err)
+		status := waitReshard(t, spanner, "t5")
+		assert.Equal(t, reshardFailed, status.State)
+		assert.Equal(t, "spanner.reshard.table[test.t5].must.have.the.primary.key", status.Error)
+		_, err = route.TableConfig("test", "t5_reshard")
+		assert.NotNil(t, err)
+	}
+
+	// Reshard t3 fails, the table is unchanged.
+	{
+		_, err := spanner.Reshard("test", "t3", "", 10)
+		assert.Nil(t, err)
+		status := waitReshard(t, spanner, "t3")
+		assert.Equal(t, reshardFailed, status.State)
+		assert.Equal(t, 0, status.Copied)
+		assert.Contains(t, status.Error, "mock.replace.error")
+
+		tconf, err := route.TableConfig("test", "t3")
+		assert.Nil(t, err)
+		assert.Equal(t, 30, len(tconf.Partitions))
+		assert.Equal(t, "id", tconf.ShardKey)
+		assert.Equal(t, "", tconf.ReshardTo)
+		_, err = route.TableConfig("test", "t3_reshard")
+		assert.NotNil(t, err)
+	}
+
+	// The writes to t2 in the resharding are mirrored.
+	{
+		_, err := client.FetchAll("create table test.t2_reshard(id int, b int, c int) partition by hash(b)", -1)
+		assert.Nil(t, err)
+		err = route.StartReshard("test", "t2", "t2_reshard")
+		assert.Nil(t, err)
+
+		querys := []string{
+			"insert into test.t2(id, b) values(1, 1)",
+			"update test.t2 set c=2 where t2.id=1",
+			"delete from test.t2 where id=1",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+		sconf, err := route.TableConfig("test", "t2_reshard")
+		assert.Nil(t, err)
+		inserts, updates, deletes := 0, 0, 0
+		for _, part := range sconf.Partitions {
+			inserts += fakedbs.GetQueryCalledNum(fmt.Sprintf("insert into test.%s(id, b) values (1, 1)", part.Table))
+			updates += fakedbs.GetQueryCalledNum(fmt.Sprintf("update test.%s set c = 2 where id = 1", part.Table))
+			deletes += fakedbs.GetQueryCalledNum(fmt.Sprintf("delete from test.%s where id = 1", part.Table))
+		}
+		assert.Equal(t, 1, inserts)
+		assert.Equal(t, len(sconf.Partitions), updates)
+		assert.Equal(t, len(sconf.Partitions), deletes)
+
+		unsupporteds := []string{
+			"insert into test.t2(id, b) select id, b from test.t1",
+			"update test.t2 set c=2 where id=1 limit 1",
+			"delete from test.t2 where id=1 limit 1",
+			"delete t2 from test.t2 join test.t1 on t2.id=t1.id",
+			"alter table test.t2 engine=tokudb",
+			"drop table test.t2_reshard",
+			"alter table test.t2 add column(d int) /*+ radon_backends(backend0) */",
+			"rename table test.t2 to test.t6",
+			"rename table test.t2_reshard to test.t6",
+			"rename database test to test2",
+			"drop database test",
+		}
+		for _, query := range unsupporteds {
+			_, err := client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			assert.Contains(t, err.Error(), "unsupported:", query)
+		}
+		_, err = spanner.ApplyDDLBatch("mock", "test", []string{"create table t7(id int) partition by hash(id)", "alter table t2 engine=tokudb"})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "unsupported: the.table[test.t2].is.in.resharding")
+		_, err = route.TableConfig("test", "t7")
+		assert.NotNil(t, err)
+
+		err = route.CancelReshard("test", "t2")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("alter table test.t2 engine=tokudb", -1)
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// rollupBatchRows is the max rows of an insert when refreshing the rollup.
+	rollupBatchRows = 1000
+
+	// rollupWatermark is replaced by the max watermark of the rollup table in the incremental query.
+	rollupWatermark = ":watermark"
+)
+
+type rollup struct {
+	conf *config.RollupConfig
+
+	// query is the normalized query used to match the rewrite.
+	query string
+
+	// columns are the columns of the last refresh, nil if never refreshed.
+	columns []string
+}
+
+// Rollups maintains the aggregation results in the GLOBAL or SINGLE tables, the refreshes are run
+// by the scheduler as the jobs named 'rollup.<name>'.
+type Rollups struct {
+	log     *xlog.Log
+	spanner *Spanner
+	rollups []*rollup
+	mu      sync.RWMutex
+}
+
+// NewRollups creates the new rollups.
+func NewRollups(log *xlog.Log, spanner *Spanner, confs []*config.RollupConfig) *Rollups {
+	r := &Rollups{
+		log:     log,
+		spanner: spanner,
+	}
+	for _, conf := range confs {
+		ru := &rollup{conf: conf}
+		if node, err := sqlparser.Parse(conf.Query); err == nil {
+			ru.query = sqlparser.String(node)
+		}
+		r.rollups = append(r.rollups, ru)
+	}
+	return r
+}
+
+// Register used to add the refreshes of the rollups to the scheduler.
+func (r *Rollups) Register(scheduler *Scheduler) {
+	for _, ru := range r.rollups {
+		name := ru.conf.Name
+		scheduler.Add("rollup."+name, ru.conf.Schedule, func() (*sqltypes.Result, error) {
+			return r.Refresh(name)
+		})
+	}
+}
+
+// Refresh used to refresh the rollup, the rows affected is the rows written to the rollup table.
+func (r *Rollups) Refresh(name string) (*sqltypes.Result, error) {
+	var ru *rollup
+	for _, x := range r.rollups {
+		if x.conf.Name == name {
+			ru = x
+		}
+	}
+	if ru == nil {
+		return nil, errors.Errorf("rollup[%s].not.found", name)
+	}
+	conf := ru.conf
+	spanner := r.spanner
+
+	tconf, err := spanner.router.TableConfig(conf.Database, conf.Table)
+	if err != nil {
+		return nil, err
+	}
+	if tconf.ShardType != "GLOBAL" && tconf.ShardType != "SINGLE" {
+		return nil, errors.Errorf("rollup[%s].table[%s.%s].must.be.global.or.single", name, conf.Database, conf.Table)
+	}
+	table := fmt.Sprintf("%s.%s", sqlparser.Backtick(conf.Database), sqlparser.Backtick(conf.Table))
+
+	query := conf.Query
+	// The planner denies the DML without the where clause.
+	deleteQuery := fmt.Sprintf("delete from %s where 1 = 1", table)
+	if conf.Watermark != "" {
+		qr, err := spanner.ExecuteJob(conf.User, conf.Database, fmt.Sprintf("select max(%s) from %s", sqlparser.Backtick(conf.Watermark), table))
+		if err != nil {
+			return nil, err
+		}
+		// The watermark of the empty rollup table is null, it's refreshed fully.
+		watermark := "null"
+		if len(qr.Rows) > 0 && !qr.Rows[0][0].IsNull() {
+			var buf bytes.Buffer
+			qr.Rows[0][0].EncodeSQL(&buf)
+			watermark = buf.String()
+			deleteQuery = fmt.Sprintf("delete from %s where %s >= %s", table, sqlparser.Backtick(conf.Watermark), watermark)
+		}
+		query = strings.Replace(query, rollupWatermark, watermark, -1)
+	}
+
+	qr, err := spanner.ExecuteJob(conf.User, conf.Database, query)
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(qr.Fields))
+	for i, field := range qr.Fields {
+		columns[i] = sqlparser.Backtick(field.Name)
+	}
+	rows := len(qr.Rows)
+	querys := append([]string{deleteQuery}, rollupInserts(table, columns, qr.Rows)...)
+	if qr, err = spanner.ExecuteJob(conf.User, conf.Database, querys...); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	ru.columns = columns
+	r.mu.Unlock()
+	r.log.Info("rollup[%s].refreshed.rows[%d]", name, rows)
+	spanner.autoAnalyze(conf.Database, conf.Table)
+	return qr, nil
+}
+
+// rollupInserts returns the inserts of the rows in batches.
+func rollupInserts(table string, columns []string, rows [][]sqltypes.Value) []string {
+	var querys []string
+	var buf bytes.Buffer
+	for i, row := range rows {
+		if i%rollupBatchRows == 0 {
+			if buf.Len() > 0 {
+				querys = append(querys, buf.String())
+				buf.Reset()
+			}
+			fmt.Fprintf(&buf, "insert into %s(%s) values ", table, strings.Join(columns, ","))
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('(')
+		for j, v := range row {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			v.EncodeSQL(&buf)
+		}
+		buf.WriteByte(')')
+	}
+	if buf.Len() > 0 {
+		querys = append(querys, buf.String())
+	}
+	return querys
+}
+
+// Rewrite returns the query reads the rollup table if the select is the same as the query of a rollup
+// with the rewrite in the database, and the rollup was refreshed.
+// The select is normalized only if there is such a rollup, it's the hot path of every SELECT.
+func (r *Rollups) Rewrite(database string, node *sqlparser.Select) (string, sqlparser.Statement, bool) {
+	rewritable := func(ru *rollup) bool {
+		return ru.conf.Rewrite && ru.columns != nil && ru.conf.Database == database
+	}
+
+	found := false
+	r.mu.RLock()
+	for _, ru := range r.rollups {
+		if found = rewritable(ru); found {
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if !found {
+		return "", nil, false
+	}
+
+	query := ""
+	normalized := sqlparser.String(node)
+	r.mu.RLock()
+	for _, ru := range r.rollups {
+		if rewritable(ru) && ru.query == normalized {
+			query = fmt.Sprintf("select %s from %s.%s", strings.Join(ru.columns, ","), sqlparser.Backtick(ru.conf.Database), sqlparser.Backtick(ru.conf.Table))
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if query == "" {
+		return "", nil, false
+	}
+
+	rewritten, err := sqlparser.Parse(query)
+	if err != nil {
+		r.log.Error("rollup.rewrite.query[%s].parser.error:%v", query, err)
+		return "", nil, false
+	}
+	return query, rewritten, true
+}
@@ -0,0 +1,138 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyRollup(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.Rollups = []*config.RollupConfig{
+		{Name: "daily", Schedule: "@hourly", User: "mock", Database: "test", Table: "r1", Query: "select day, count(*) as cnt from t1 group by day", Rewrite: true},
+		{Name: "incr", Schedule: "@hourly", User: "mock", Database: "test", Table: "r2", Query: "select day, count(*) as cnt from t1 where day >= :watermark group by day", Watermark: "day"},
+		{Name: "hash", Schedule: "@hourly", User: "mock", Database: "test", Table: "t1", Query: "select 1"},
+	}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	rollups := proxy.Spanner().rollups
+
+	dayResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "day", Type: querypb.Type_INT32},
+			{Name: "cnt", Type: querypb.Type_INT64},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("20190315")), sqltypes.MakeTrusted(querypb.Type_INT64, []byte("2"))},
+		},
+	}
+	rollupResult := &sqltypes.Result{
+		Fields: dayResult.Fields,
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("20190314")), sqltypes.MakeTrusted(querypb.Type_INT64, []byte("7"))},
+		},
+	}
+	maxResult := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "max(`day`)", Type: querypb.Type_INT32}},
+		Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("20190315"))}},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("use .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select day, count\\(\\*\\) as cnt from test.t1_.* as t1 group by day order by day asc", dayResult)
+		fakedbs.AddQueryPattern("select day, count\\(\\*\\) as cnt from test.t1_.* as t1 where day >= 20190315 group by day order by day asc", dayResult)
+		fakedbs.AddQueryPattern("select max\\(day\\) from test.r2", maxResult)
+		fakedbs.AddQueryPattern("select day, cnt from test.r1", rollupResult)
+		fakedbs.AddQuery("delete from test.r1 where 1 = 1", &sqltypes.Result{})
+		fakedbs.AddQuery("delete from test.r2 where day >= 20190315", &sqltypes.Result{})
+		fakedbs.AddQuery("insert into test.r1(day, cnt) values (20190315, 60)", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQuery("insert into test.r2(day, cnt) values (20190315, 60)", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"use test",
+		"create table t1(id int, day int) partition by hash(id)",
+		"create table r1(day int, cnt bigint) global",
+		"create table r2(day int, cnt bigint) single",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// Not rewritten before the refresh.
+	{
+		qr, err := client.FetchAll("select day, count(*) as cnt from t1 group by day", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "60", qr.Rows[0][1].String())
+	}
+
+	// Full refresh.
+	{
+		_, err := rollups.Refresh("daily")
+		assert.Nil(t, err)
+
+		qr, err := client.FetchAll("select day, count(*) as cnt from t1 group by day", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, rollupResult.Rows, qr.Rows)
+
+		// Not the same query.
+		qr, err = client.FetchAll("select day, count(*) as cnt from t1 group by day order by day", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "60", qr.Rows[0][1].String())
+	}
+
+	// Incremental refresh.
+	{
+		qr, err := rollups.Refresh("incr")
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), qr.RowsAffected)
+	}
+
+	// Errors.
+	{
+		_, err := rollups.Refresh("hash")
+		assert.Equal(t, "rollup[hash].table[test.t1].must.be.global.or.single", err.Error())
+
+		_, err = rollups.Refresh("xx")
+		assert.Equal(t, "rollup[xx].not.found", err.Error())
+
+		fakedbs.ResetAll()
+		fakedbs.AddQueryErrorPattern("select .*", errors.New("mock.select.error"))
+		_, err = rollups.Refresh("daily")
+		assert.NotNil(t, err)
+	}
+
+	// Run by the scheduler.
+	{
+		fakedbs.AddQuery("select get_lock('radon.job.rollup.daily', 0)", jobLeaseResult("1"))
+		run := runJob(t, proxy.Spanner().Scheduler(), "rollup.daily")
+		assert.Equal(t, jobFailed, run.Result)
+		assert.Contains(t, run.Error, "mock.select.error")
+	}
+}
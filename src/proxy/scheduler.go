@@ -0,0 +1,327 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sync"
+	"time"
+
+	"config"
+	"monitor"
+	"xbase"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// maxJobRuns is the max runs kept in the history of a job.
+	maxJobRuns = 16
+
+	// maxJobLockName is the max length of the MySQL user-level lock name.
+	maxJobLockName = 64
+)
+
+// The results of the job runs.
+const (
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobSkipped   = "skipped"
+)
+
+// JobRun tuple.
+type JobRun struct {
+	Start        time.Time `json:"start"`
+	Duration     string    `json:"duration"`
+	Result       string    `json:"result"`
+	RowsAffected uint64    `json:"rows-affected"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// JobStatus tuple, the runs are the latest first.
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+	Running  bool      `json:"running"`
+	Runs     []*JobRun `json:"runs"`
+}
+
+type scheduledJob struct {
+	name     string
+	schedule string
+	cron     *xbase.Cron
+	exec     func() (*sqltypes.Result, error)
+	// local is true if the job runs on every radon, otherwise it runs under the lease.
+	local   bool
+	running bool
+	runs    []*JobRun
+}
+
+// Scheduler runs the jobs of the proxy config and the rollup refreshes on their schedules through the planner.
+// The run of a job is skipped if its last run is not finished, the failed runs are logged as errors
+// and counted by the job_run_total metric with the result 'failed' for the alerts.
+// The radons sharing the backends run a job under its lease, so only one of them runs it at a time,
+// the run is skipped on the others.
+type Scheduler struct {
+	log     *xlog.Log
+	spanner *Spanner
+	jobs    []*scheduledJob
+	lease   func(name string) (func(), error)
+	done    chan bool
+	wake    chan bool
+	clock   xbase.AtomicClock
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// NewScheduler creates the new scheduler.
+func NewScheduler(log *xlog.Log, spanner *Spanner, confs []*config.JobConfig) *Scheduler {
+	s := &Scheduler{
+		log:     log,
+		spanner: spanner,
+		lease:   spanner.jobLease,
+		done:    make(chan bool),
+		wake:    make(chan bool, 1),
+	}
+	for _, conf := range confs {
+		conf := conf
+		s.Add(conf.Name, conf.Schedule, func() (*sqltypes.Result, error) {
+			return spanner.ExecuteJob(conf.User, conf.Database, conf.Query)
+		})
+	}
+	return s
+}
+
+// Add used to add the job runs the exec on the schedule under the lease, it must be called before the Init.
+func (s *Scheduler) Add(name string, schedule string, exec func() (*sqltypes.Result, error)) {
+	s.jobs = append(s.jobs, &scheduledJob{name: name, schedule: schedule, exec: exec})
+}
+
+// AddLocal used to add the job runs the exec on the schedule on every radon, such as the one works on the stats
+// of this radon, it must be called before the Init.
+func (s *Scheduler) AddLocal(name string, schedule string, exec func() (*sqltypes.Result, error)) {
+	s.jobs = append(s.jobs, &scheduledJob{name: name, schedule: schedule, exec: exec, local: true})
+}
+
+// SetClock used to set the clock of the schedules, the scheduler waits for the next minute on the new clock.
+func (s *Scheduler) SetClock(clock xbase.Clock) {
+	s.clock.Set(clock)
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+// Init used to parse the schedules and start the scheduler.
+func (s *Scheduler) Init() error {
+	for _, job := range s.jobs {
+		cron, err := xbase.ParseCron(job.schedule)
+		if err != nil {
+			return errors.Errorf("scheduler.job[%s].schedule.error:%v", job.name, err)
+		}
+		job.cron = cron
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.schedule()
+	}()
+	s.log.Info("scheduler.init.done.jobs[%d]", len(s.jobs))
+	return nil
+}
+
+// Close used to stop the scheduler and wait for the running jobs.
+func (s *Scheduler) Close() {
+	close(s.done)
+	s.wg.Wait()
+	s.log.Info("scheduler.closed...")
+}
+
+// schedule wakes up at every minute to run the jobs match it.
+func (s *Scheduler) schedule() {
+	for {
+		clock := s.clock.Get()
+		now := clock.Now()
+		select {
+		case t := <-clock.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+			s.tick(t)
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) tick(now time.Time) {
+	for _, job := range s.jobs {
+		if !job.cron.Match(now) {
+			continue
+		}
+		if !s.acquire(job) {
+			s.log.Warning("scheduler.job[%s].skipped.the.last.run.is.not.finished", job.name)
+			s.record(job, &JobRun{Start: now, Result: jobSkipped})
+			continue
+		}
+		s.wg.Add(1)
+		go func(j *scheduledJob) {
+			defer s.wg.Done()
+			s.run(j)
+		}(job)
+	}
+}
+
+// Run used to start the run of the job now without waiting for it, it's used by the admin api.
+// The run is recorded in the status when it's finished.
+func (s *Scheduler) Run(name string) error {
+	for _, job := range s.jobs {
+		if job.name == name {
+			if !s.acquire(job) {
+				return errors.Errorf("scheduler.job[%s].is.running", name)
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.run(job)
+			}()
+			return nil
+		}
+	}
+	return errors.Errorf("scheduler.job[%s].not.found", name)
+}
+
+// Status returns the status of all the jobs.
+func (s *Scheduler) Status() []*JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Get().Now()
+	status := make([]*JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		runs := make([]*JobRun, len(job.runs))
+		for i, run := range job.runs {
+			runs[len(job.runs)-1-i] = run
+		}
+		status = append(status, &JobStatus{
+			Name:     job.name,
+			Schedule: job.schedule,
+			Next:     job.cron.Next(now),
+			Running:  job.running,
+			Runs:     runs,
+		})
+	}
+	return status
+}
+
+func (s *Scheduler) acquire(job *scheduledJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.running {
+		return false
+	}
+	job.running = true
+	return true
+}
+
+// run executes the acquired job under the lease and records the run.
+func (s *Scheduler) run(job *scheduledJob) *JobRun {
+	log := s.log
+
+	clock := s.clock.Get()
+	start := clock.Now()
+	if !job.local {
+		release, err := s.lease(job.name)
+		if err != nil || release == nil {
+			run := &JobRun{Start: start, Duration: clock.Since(start).String(), Result: jobSkipped}
+			if err != nil {
+				log.Error("scheduler.job[%s].lease.error:%+v", job.name, err)
+				run.Result, run.Error = jobFailed, err.Error()
+			} else {
+				log.Warning("scheduler.job[%s].skipped.the.lease.is.held.by.another.radon", job.name)
+			}
+			s.mu.Lock()
+			job.running = false
+			s.mu.Unlock()
+			s.record(job, run)
+			return run
+		}
+		defer release()
+	}
+	qr, err := job.exec()
+	run := &JobRun{
+		Start:    start,
+		Duration: clock.Since(start).String(),
+		Result:   jobSucceeded,
+	}
+	if err != nil {
+		log.Error("scheduler.job[%s].error:%+v", job.name, err)
+		run.Result = jobFailed
+		run.Error = err.Error()
+	} else {
+		log.Info("scheduler.job[%s].done.rows.affected[%d].duration[%s]", job.name, qr.RowsAffected, run.Duration)
+		run.RowsAffected = qr.RowsAffected
+	}
+
+	s.mu.Lock()
+	job.running = false
+	s.mu.Unlock()
+	s.record(job, run)
+	return run
+}
+
+func (s *Scheduler) record(job *scheduledJob, run *JobRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	monitor.JobRunInc(job.name, run.Result)
+	job.runs = append(job.runs, run)
+	if len(job.runs) > maxJobRuns {
+		job.runs = job.runs[len(job.runs)-maxJobRuns:]
+	}
+}
+
+// jobLease used to take the lease of the job by the MySQL user-level lock on the first normal backend, the radons
+// sharing the backends take the same lock. The lock is held by the connection and released by closing it,
+// so the lease of the radon gone is released by the backend. The release fn is nil if the lease is held by another radon.
+func (spanner *Spanner) jobLease(name string) (func(), error) {
+	scatter := spanner.scatter
+
+	backends := scatter.Backends()
+	if len(backends) == 0 {
+		return nil, errors.Errorf("scheduler.job[%s].lease.no.backend", name)
+	}
+	pool, ok := scatter.PoolClone()[backends[0]]
+	if !ok {
+		return nil, errors.Errorf("scheduler.job[%s].lease.can.not.find.backend[%s]", name, backends[0])
+	}
+	conn, err := pool.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	lock := "radon.job." + name
+	if len(lock) > maxJobLockName {
+		lock = fmt.Sprintf("radon.job.%x", md5.Sum([]byte(name)))
+	}
+	qr, err := conn.Execute(fmt.Sprintf("select get_lock(%s, 0)", sqlparser.String(sqlparser.NewStrVal([]byte(lock)))))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) != 1 || qr.Rows[0][0].String() != "1" {
+		conn.Recycle()
+		return nil, nil
+	}
+	return conn.Close, nil
+}
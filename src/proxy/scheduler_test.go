@@ -0,0 +1,151 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyScheduler(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.Jobs = []*config.JobConfig{
+		{Name: "retention", Schedule: "* * * * *", User: "mock", Database: "test", Query: "delete from t1 where id<10"},
+		{Name: "refresh", Schedule: "0 3 * * *", User: "mock", Database: "test", Query: "update t1 set b=1 where id=1"},
+		{Name: "ddl", Schedule: "@daily", User: "mock", Database: "test", Query: "drop table t1"},
+	}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	scheduler := proxy.Spanner().Scheduler()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("select get_lock\\('radon.job..*', 0\\)", jobLeaseResult("1"))
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("delete .*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryErrorPattern("update .*", errors.New("mock.update.error"))
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	// Run now.
+	{
+		run := runJob(t, scheduler, "retention")
+		assert.Equal(t, jobSucceeded, run.Result)
+		assert.Equal(t, uint64(30), run.RowsAffected)
+
+		run = runJob(t, scheduler, "refresh")
+		assert.Equal(t, jobFailed, run.Result)
+		assert.Contains(t, run.Error, "mock.update.error")
+
+		run = runJob(t, scheduler, "ddl")
+		assert.Equal(t, "This version of MySQL doesn't yet support 'the job query except SELECT, INSERT, REPLACE, UPDATE and DELETE' (errno 1235) (sqlstate 42000)", run.Error)
+
+		err := scheduler.Run("xx")
+		assert.Equal(t, "scheduler.job[xx].not.found", err.Error())
+	}
+
+	// Run on the schedule.
+	{
+		now := time.Date(2019, 3, 15, 10, 30, 0, 0, time.Local)
+		scheduler.tick(now)
+		for scheduler.Status()[0].Running {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		status := scheduler.Status()
+		assert.Equal(t, 3, len(status))
+		assert.Equal(t, 2, len(status[0].Runs))
+		assert.Equal(t, 1, len(status[1].Runs))
+		assert.Equal(t, time.Date(2019, 3, 16, 3, 0, 0, 0, time.Local), scheduler.jobs[1].cron.Next(now))
+	}
+
+	// Run without waiting.
+	{
+		fakedbs.AddQueryDelay("delete from test.t1_0000 where id < 10", &sqltypes.Result{RowsAffected: 1}, 200)
+		err := scheduler.Run("retention")
+		assert.Nil(t, err)
+		err = scheduler.Run("retention")
+		assert.Equal(t, "scheduler.job[retention].is.running", err.Error())
+		run := runJob(t, scheduler, "refresh")
+		assert.Equal(t, jobFailed, run.Result)
+		for scheduler.Status()[0].Running {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, jobSucceeded, scheduler.Status()[0].Runs[0].Result)
+		fakedbs.AddQuery("delete from test.t1_0000 where id < 10", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	// The lease is held by another radon.
+	{
+		fakedbs.AddQuery("select get_lock('radon.job.retention', 0)", jobLeaseResult("0"))
+		run := runJob(t, scheduler, "retention")
+		assert.Equal(t, jobSkipped, run.Result)
+		fakedbs.AddQuery("select get_lock('radon.job.retention', 0)", jobLeaseResult("1"))
+	}
+
+	// Readonly.
+	{
+		proxy.SetReadOnly(true)
+		run := runJob(t, scheduler, "retention")
+		assert.Equal(t, jobFailed, run.Result)
+		proxy.SetReadOnly(false)
+	}
+
+	// The history is limited.
+	{
+		for i := 0; i < maxJobRuns; i++ {
+			runJob(t, scheduler, "retention")
+		}
+		runs := scheduler.Status()[0].Runs
+		assert.Equal(t, maxJobRuns, len(runs))
+		assert.Equal(t, jobSucceeded, runs[0].Result)
+	}
+}
+
+// runJob runs the job now and returns the run when it's finished.
+func runJob(t *testing.T, scheduler *Scheduler, name string) *JobRun {
+	err := scheduler.Run(name)
+	assert.Nil(t, err)
+	for {
+		for _, status := range scheduler.Status() {
+			if status.Name == name && !status.Running {
+				return status.Runs[0]
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// jobLeaseResult returns the result of the GET_LOCK taking the job lease.
+func jobLeaseResult(got string) *sqltypes.Result {
+	return &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "get_lock", Type: querypb.Type_INT64}},
+		Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_INT64, []byte(got))}},
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"config"
+	"router"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// RenameSegments used to rename the segments of the HASH table to the naming on the backends and in the metadata.
+// The segments on one backend are renamed in one RENAME TABLE statement, if one backend fails,
+// the backends already renamed are renamed back.
+// The querys on the table fail during the renaming, it should be done in the maintenance window.
+func (spanner *Spanner) RenameSegments(database string, table string, naming *config.SegmentNaming) ([]router.SegmentRename, error) {
+	route := spanner.router
+
+	renames, err := route.SegmentRenames(database, table, naming)
+	if err != nil {
+		return nil, err
+	}
+
+	rollback, err := spanner.renameOnBackends(database, database, renames)
+	if err != nil {
+		return nil, err
+	}
+	if err := route.RenameSegments(database, table, naming, renames); err != nil {
+		rollback()
+		return nil, err
+	}
+	return renames, nil
+}
+
+// renameOnBackends used to rename the segments from the database to the toDatabase on the backends,
+// the segments on one backend are renamed in one RENAME TABLE statement. If one backend fails,
+// the backends already renamed are renamed back, otherwise the function to rename all of them back is returned.
+func (spanner *Spanner) renameOnBackends(database string, toDatabase string, renames []router.SegmentRename) (func(), error) {
+	log := spanner.log
+
+	byBackend := make(map[string][]router.SegmentRename)
+	for _, rename := range renames {
+		byBackend[rename.Backend] = append(byBackend[rename.Backend], rename)
+	}
+	var backends []string
+	for backend := range byBackend {
+		backends = append(backends, backend)
+	}
+	sort.Strings(backends)
+
+	renameQuery := func(renames []router.SegmentRename, reverse bool) string {
+		var pairs []string
+		for _, rename := range renames {
+			fromDB, from, toDB, to := database, rename.From, toDatabase, rename.To
+			if reverse {
+				fromDB, from, toDB, to = toDB, to, fromDB, from
+			}
+			pairs = append(pairs, fmt.Sprintf("%s.%s to %s.%s", sqlparser.Backtick(fromDB), sqlparser.Backtick(from), sqlparser.Backtick(toDB), sqlparser.Backtick(to)))
+		}
+		return fmt.Sprintf("rename table %s", strings.Join(pairs, ", "))
+	}
+	rollback := func(done []string) {
+		for _, backend := range done {
+			query := renameQuery(byBackend[backend], true)
+			if _, err := spanner.ExecuteOnThisBackend(backend, query); err != nil {
+				log.Error("spanner.rename.segments.rollback[%s].on[%s].error:%+v", query, backend, err)
+			}
+		}
+	}
+
+	var done []string
+	for _, backend := range backends {
+		query := renameQuery(byBackend[backend], false)
+		log.Warning("spanner.rename.segments.execute[%s].on[%s]", query, backend)
+		if _, err := spanner.ExecuteOnThisBackend(backend, query); err != nil {
+			log.Error("spanner.rename.segments.execute[%s].on[%s].error:%+v", query, backend, err)
+			rollback(done)
+			return nil, err
+		}
+		done = append(done, backend)
+	}
+	return func() { rollback(done) }, nil
+}
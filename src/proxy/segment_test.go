@@ -0,0 +1,92 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyRenameSegments(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rename table .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	renameQuery := func(from string, to string, start int, end int) string {
+		var pairs []string
+		for i := start; i < end; i++ {
+			pairs = append(pairs, fmt.Sprintf("`test`.`t1%s%04d` to `test`.`t1%s%04d`", from, i, to, i))
+		}
+		return "rename table " + strings.Join(pairs, ", ")
+	}
+
+	// Backend error, the renamed backends are rolled back.
+	{
+		fakedbs.AddQueryError(renameQuery("_", "_p", 24, 30), errors.New("mock.rename.error"))
+		naming := &config.SegmentNaming{Prefix: "_p", Width: 4}
+		_, err := spanner.RenameSegments("test", "t1", naming)
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(renameQuery("_", "_p", 0, 6)))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(renameQuery("_p", "_", 0, 6)))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(renameQuery("_p", "_", 18, 24)))
+
+		segments, err := spanner.router.Lookup("test", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_0000", segments[0].Table)
+	}
+
+	// Rename.
+	{
+		naming := &config.SegmentNaming{Prefix: "_s", Width: 4}
+		renames, err := spanner.RenameSegments("test", "t1", naming)
+		assert.Nil(t, err)
+		assert.Equal(t, 30, len(renames))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(renameQuery("_", "_s", 24, 30)))
+
+		segments, err := spanner.router.Lookup("test", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_s0000", segments[0].Table)
+		assert.Equal(t, "t1_s0029", segments[29].Table)
+	}
+
+	// Table not exists.
+	{
+		naming := &config.SegmentNaming{Prefix: "_p", Width: 4}
+		_, err := spanner.RenameSegments("test", "t9", naming)
+		assert.NotNil(t, err)
+	}
+}
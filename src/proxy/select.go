@@ -9,6 +9,8 @@
 package proxy
 
 import (
+	"planner"
+
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
@@ -24,3 +26,27 @@ func (spanner *Spanner) handleSelectStream(session *driver.Session, query string
 	database := session.Schema()
 	return spanner.ExecuteStreamFetch(session, database, query, node, callback)
 }
+
+// cursorStreamable returns true if the select executed by the read-only cursor can be streamed, its rows must
+// be sent as they are received from the backends: out of the transaction, and planned to one merge without the
+// ORDER BY, LIMIT, aggregation and the others merged by the proxy.
+// The select is planned on its own parsed node, the node to be executed is left untouched.
+func (spanner *Spanner) cursorStreamable(session *driver.Session, query string) bool {
+	if txSession := spanner.sessions.getTxnSession(session); txSession == nil || txSession.transaction != nil {
+		return false
+	}
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return false
+	}
+	sel, ok := node.(*sqlparser.Select)
+	if !ok {
+		return false
+	}
+	plan := planner.NewSelectPlan(spanner.log, session.Schema(), query, sel, spanner.router)
+	if err := plan.Build(); err != nil {
+		return false
+	}
+	m, ok := plan.Root.(*planner.MergeNode)
+	return ok && len(m.Children().Plans()) == 0
+}
@@ -0,0 +1,169 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// wideResult returns a result with cols columns and n rows, some of the values are NULL or empty.
+func wideResult(cols int, n int) *sqltypes.Result {
+	qr := &sqltypes.Result{}
+	for i := 0; i < cols; i++ {
+		typ := querypb.Type_VARCHAR
+		if i%2 == 0 {
+			typ = querypb.Type_INT32
+		}
+		qr.Fields = append(qr.Fields, &querypb.Field{Name: fmt.Sprintf("c%d", i), Type: typ})
+	}
+	for r := 0; r < n; r++ {
+		row := make([]sqltypes.Value, cols)
+		for i, field := range qr.Fields {
+			switch {
+			case (r+i)%7 == 0:
+				row[i] = sqltypes.NULL
+			case field.Type == querypb.Type_INT32:
+				row[i] = sqltypes.MakeTrusted(field.Type, []byte(fmt.Sprintf("%d", r*cols+i)))
+			case (r+i)%5 == 0:
+				row[i] = sqltypes.MakeTrusted(field.Type, []byte(""))
+			default:
+				row[i] = sqltypes.MakeTrusted(field.Type, []byte(fmt.Sprintf("value-%d-%d", r, i)))
+			}
+		}
+		qr.Rows = append(qr.Rows, row)
+	}
+	qr.RowsAffected = uint64(n)
+	return qr
+}
+
+func TestProxySelectWideRows(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	want := wideResult(320, 10)
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", want)
+	}
+
+	// create database and table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	// The merge-only rows are passed through, the limit rows are encoded again.
+	querys := []string{
+		"select * from test.t1",
+		"select * from test.t1 limit 100000",
+	}
+	for _, query := range querys {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 30*len(want.Rows), len(qr.Rows))
+		assert.Equal(t, len(want.Fields), len(qr.Fields))
+		for i, row := range qr.Rows {
+			wrow := want.Rows[i%len(want.Rows)]
+			for j := range row {
+				assert.Equal(t, wrow[j].IsNull(), row[j].IsNull(), query)
+				assert.Equal(t, wrow[j].String(), row[j].String(), query)
+			}
+		}
+	}
+}
+
+func BenchmarkProxySelectWideRows(b *testing.B) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("select .*", wideResult(320, 20))
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.FetchAll("create database test", -1); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1); err != nil {
+		b.Fatal(err)
+	}
+
+	benchs := []struct {
+		name  string
+		query string
+	}{
+		{"passthrough", "select * from test.t1"},
+		{"encode", "select * from test.t1 limit 100000"},
+	}
+	for _, bench := range benchs {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.FetchAll(bench.query, -1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkProxySelectPoint(b *testing.B) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	fakedbs.AddQueryPattern("select .*", wideResult(4, 1))
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.FetchAll("create database test", -1); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.FetchAll("select * from test.t1 where id=1", -1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
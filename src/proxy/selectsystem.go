@@ -9,8 +9,11 @@
 package proxy
 
 import (
+	"fmt"
 	"strings"
 
+	"router"
+
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
@@ -40,70 +43,175 @@ func (spanner *Spanner) handleSelectSystem(session *driver.Session, query string
 // > select * from information_schema.COLUMNS where TABLE_NAME='t1' and TABLE_SCHEMA='test'
 // The TABLE_NAME value must be replaced by the partition table:
 // > select * from information_schema.COLUMNS where TABLE_NAME='t1_0000' and TABLE_SCHEMA='test'
+// The COLUMNS and TABLES selecting the TABLE_NAME without the filters are sent to all the backends.
+// The segments in the TABLE_NAME of the results are renamed back to the tables, so the comments of
+// the tables and the columns are read as the ones of the tables.
 func (spanner *Spanner) handleSelectInformationschema(query string, tbl string, node *sqlparser.Select) (*sqltypes.Result, error) {
 	router := spanner.router
 
-	if strings.EqualFold(tbl, "COLUMNS") {
-		if node.Where != nil {
-			var tblName *sqlparser.SQLVal
-			var tblSchema *sqlparser.SQLVal
-
-			_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
-				if comparison, ok := node.(*sqlparser.ComparisonExpr); ok {
-					switch comparison.Operator {
-					case sqlparser.EqualStr:
-						colname, ok := comparison.Left.(*sqlparser.ColName)
-						if ok {
-							if strings.EqualFold(colname.Name.String(), "TABLE_NAME") {
-								tblName, _ = comparison.Right.(*sqlparser.SQLVal)
-							}
-
-							if strings.EqualFold(colname.Name.String(), "TABLE_SCHEMA") {
-								tblSchema, _ = comparison.Right.(*sqlparser.SQLVal)
-							}
+	view := strings.ToUpper(tbl)
+	if view != "COLUMNS" && view != "TABLES" {
+		return spanner.ExecuteSingle(query)
+	}
+
+	var tblName *sqlparser.SQLVal
+	var tblSchema *sqlparser.SQLVal
+	if node.Where != nil {
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+			if comparison, ok := node.(*sqlparser.ComparisonExpr); ok {
+				switch comparison.Operator {
+				case sqlparser.EqualStr:
+					colname, ok := comparison.Left.(*sqlparser.ColName)
+					if ok {
+						if strings.EqualFold(colname.Name.String(), "TABLE_NAME") {
+							tblName, _ = comparison.Right.(*sqlparser.SQLVal)
+						}
+
+						if strings.EqualFold(colname.Name.String(), "TABLE_SCHEMA") {
+							tblSchema, _ = comparison.Right.(*sqlparser.SQLVal)
 						}
 					}
 				}
-				return true, nil
-			}, node.Where)
+			}
+			return true, nil
+		}, node.Where)
+	}
 
-			if tblName != nil && tblSchema != nil {
-				name := common.BytesToString(tblName.Val)
-				schema := common.BytesToString(tblSchema.Val)
+	schema := ""
+	if tblSchema != nil {
+		schema = common.BytesToString(tblSchema.Val)
+	}
+	if tblName != nil && tblSchema != nil {
+		name := common.BytesToString(tblName.Val)
 
-				// Get one partition table from the router.
-				parts, err := router.Lookup(schema, name, nil, nil)
-				if err != nil {
-					return nil, err
-				}
-				partTable := parts[0].Table
-				backend := parts[0].Backend
-
-				// Replace TABLE_NAME value to partition table.
-				_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
-					if comparison, ok := node.(*sqlparser.ComparisonExpr); ok {
-						switch comparison.Operator {
-						case sqlparser.EqualStr:
-							colname, ok := comparison.Left.(*sqlparser.ColName)
-							if ok {
-								if strings.EqualFold(colname.Name.String(), "TABLE_NAME") {
-									comparison.Right = sqlparser.NewStrVal([]byte(partTable))
-									return false, nil
-								}
-							}
+		// Get one partition table from the router.
+		parts, err := router.Lookup(schema, name, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		partTable := parts[0].Table
+		backend := parts[0].Backend
+
+		// Replace TABLE_NAME value to partition table.
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+			if comparison, ok := node.(*sqlparser.ComparisonExpr); ok {
+				switch comparison.Operator {
+				case sqlparser.EqualStr:
+					colname, ok := comparison.Left.(*sqlparser.ColName)
+					if ok {
+						if strings.EqualFold(colname.Name.String(), "TABLE_NAME") {
+							comparison.Right = sqlparser.NewStrVal([]byte(partTable))
+							return false, nil
 						}
 					}
-					return true, nil
-				}, node.Where)
-
-				// The final sql.
-				sqlbuf := sqlparser.NewTrackedBuffer(nil)
-				node.Format(sqlbuf)
-				rewritten := sqlbuf.String()
-				spanner.log.Debug("---:%s", rewritten)
-				return spanner.ExecuteOnThisBackend(backend, rewritten)
+				}
 			}
+			return true, nil
+		}, node.Where)
+
+		// The final sql.
+		sqlbuf := sqlparser.NewTrackedBuffer(nil)
+		node.Format(sqlbuf)
+		rewritten := sqlbuf.String()
+		spanner.log.Debug("---:%s", rewritten)
+		qr, err := spanner.ExecuteOnThisBackend(backend, rewritten)
+		if err != nil {
+			return nil, err
+		}
+		return spanner.renameSegments(qr, view, schema), nil
+	}
+
+	if tblName == nil && selectsTableName(node) {
+		qr, err := spanner.ExecuteScatter(query)
+		if err != nil {
+			return nil, err
 		}
+		return spanner.renameSegments(qr, view, schema), nil
 	}
 	return spanner.ExecuteSingle(query)
 }
+
+// selectsTableName returns true if the TABLE_NAME is in the select expressions.
+func selectsTableName(node *sqlparser.Select) bool {
+	for _, expr := range node.SelectExprs {
+		switch expr := expr.(type) {
+		case *sqlparser.StarExpr:
+			return true
+		case *sqlparser.AliasedExpr:
+			if col, ok := expr.Expr.(*sqlparser.ColName); ok && strings.EqualFold(col.Name.String(), "TABLE_NAME") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renameSegments used to rename the segments in the TABLE_NAME column of the INFORMATION_SCHEMA result to their tables,
+// the schema is used if the TABLE_SCHEMA isn't selected. The rows of the same table from the segments are merged to the
+// first one, the TABLES rows are the same if they are of the same table, and the COLUMNS rows if all the values are the same.
+func (spanner *Spanner) renameSegments(qr *sqltypes.Result, view string, schema string) *sqltypes.Result {
+	router := spanner.router
+
+	schemaIdx, nameIdx := -1, -1
+	for i, field := range qr.Fields {
+		switch strings.ToUpper(field.Name) {
+		case "TABLE_SCHEMA":
+			schemaIdx = i
+		case "TABLE_NAME":
+			nameIdx = i
+		}
+	}
+	if nameIdx == -1 {
+		return qr
+	}
+
+	// Key is the database, the value is the tables of its segments.
+	databases := make(map[string]map[string]string)
+	seen := make(map[string]bool)
+	rows := make([][]sqltypes.Value, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		database := schema
+		if schemaIdx != -1 {
+			database = row[schemaIdx].String()
+		}
+		segments, ok := databases[database]
+		if !ok {
+			segments = segmentTables(router, database)
+			databases[database] = segments
+		}
+		if table, ok := segments[row[nameIdx].String()]; ok {
+			row = append([]sqltypes.Value{}, row...)
+			row[nameIdx] = sqltypes.MakeTrusted(row[nameIdx].Type(), []byte(table))
+		}
+
+		key := fmt.Sprintf("%s.%s", database, row[nameIdx].String())
+		if view == "COLUMNS" {
+			for _, v := range row {
+				key += "\x00" + v.String()
+			}
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		rows = append(rows, row)
+	}
+	qr.Rows = rows
+	qr.RowsAffected = uint64(len(rows))
+	return qr
+}
+
+// segmentTables returns the tables of the segments in the database, the key is the segment.
+func segmentTables(route *router.Router, database string) map[string]string {
+	segments := make(map[string]string)
+	for _, table := range route.Tables()[database] {
+		tconf, err := route.TableConfig(database, table)
+		if err != nil {
+			continue
+		}
+		for _, partition := range tconf.Partitions {
+			segments[partition.Table] = table
+		}
+	}
+	return segments
+}
@@ -9,6 +9,7 @@
 package proxy
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -24,6 +25,7 @@ type bitmask uint32
 // session variables capabilities.
 const (
 	cap_streaming_fetch bitmask = 1 << iota // streaming fetch for this session
+	cap_consistent_read                     // consistent snapshots of the reads to the multiple backends
 )
 
 type session struct {
@@ -35,6 +37,29 @@ type session struct {
 	timestamp    int64
 	capabilities bitmask
 	transaction  backend.Transaction
+	waitTimeout  uint32 // session wait_timeout(seconds), 0 means using the global one.
+	analyst      bool   // session of the analyst endpoint.
+
+	// shardKeyValue forces the unrouted statements to its segments, nil means not set.
+	shardKeyValue *sqlparser.SQLVal
+
+	// readConsistency of the session, '' means using the global one.
+	readConsistency string
+	// readAsOf is the GTID watermark the reads are as of, 'latest' or the id, '' means not set.
+	readAsOf string
+	// writes are the last write times of the tables('db.table') written by the session,
+	// pendingWrites are the tables written in the transaction, they are recorded when it ends.
+	writes        map[string]time.Time
+	pendingWrites []string
+	// lastWrite is the time of the last write of the session, the writes in the transaction are at its end.
+	lastWrite time.Time
+	txnWrote  bool
+
+	// cancel cancels the context of the executing query, nil if there's none.
+	cancel context.CancelFunc
+
+	// prepared are the prepared statements cached by the session, nil if there's none.
+	prepared *preparedStmts
 }
 
 func (s *session) setStreamingFetchVar(r bool) {
@@ -49,12 +74,110 @@ func (s *session) getStreamingFetchVar() bool {
 	return s.capabilities&cap_streaming_fetch != 0
 }
 
-func newSession(log *xlog.Log, s *driver.Session) *session {
+func (s *session) setConsistentReadVar(r bool) {
+	if r {
+		s.capabilities |= cap_consistent_read
+	} else {
+		s.capabilities &= ^cap_consistent_read
+	}
+}
+
+func (s *session) getConsistentReadVar() bool {
+	return s.capabilities&cap_consistent_read != 0
+}
+
+func (s *session) setWaitTimeoutVar(timeout uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waitTimeout = timeout
+}
+
+func (s *session) setReadConsistencyVar(consistency string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readConsistency = consistency
+}
+
+// getReadConsistencyVar returns the read consistency of the session and whether it's in the transaction.
+func (s *session) getReadConsistencyVar() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readConsistency, s.transaction != nil
+}
+
+func (s *session) setReadAsOfVar(asOf string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readAsOf = asOf
+}
+
+// getReadAsOfVar returns the watermark the reads of the session are as of and whether it's in the transaction.
+func (s *session) getReadAsOfVar() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readAsOf, s.transaction != nil
+}
+
+func (s *session) recordWrites(tables []string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transaction != nil {
+		s.txnWrote = true
+		s.pendingWrites = append(s.pendingWrites, tables...)
+		return
+	}
+	s.lastWrite = now
+	if s.writes == nil {
+		s.writes = make(map[string]time.Time)
+	}
+	for _, table := range tables {
+		s.writes[table] = now
+	}
+}
+
+// flushWrites records the pending writes of the ended transaction, the caller must hold the s.mu.
+func (s *session) flushWrites(now time.Time) {
+	if s.txnWrote {
+		s.lastWrite = now
+		s.txnWrote = false
+	}
+	if len(s.pendingWrites) == 0 {
+		return
+	}
+	if s.writes == nil {
+		s.writes = make(map[string]time.Time)
+	}
+	for _, table := range s.pendingWrites {
+		s.writes[table] = now
+	}
+	s.pendingWrites = nil
+}
+
+// getLastWrite returns the time of the last write of the session, zero if it has never written.
+func (s *session) getLastWrite() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastWrite
+}
+
+// wroteSince returns true if one of the tables was written by the session after the since.
+func (s *session) wroteSince(tables []string, since time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, table := range tables {
+		if last, ok := s.writes[table]; ok && last.After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+func newSession(log *xlog.Log, s *driver.Session, now time.Time) *session {
 	log.Debug("session[%v].created", s.ID())
 	return &session{
 		log:       log,
 		session:   s,
-		timestamp: time.Now().Unix(),
+		timestamp: now.Unix(),
 	}
 }
 
@@ -9,13 +9,16 @@
 package proxy
 
 import (
+	"context"
 	"sort"
 	"sync"
 	"time"
 
 	"backend"
+	"xbase"
 
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -30,6 +33,12 @@ type Sessions struct {
 	mu  sync.RWMutex
 	// Key is session ID.
 	sessions map[uint32]*session
+	// analysts is the count of the analyst endpoint sessions in the map.
+	analysts int
+	// clock is the xbase.Clock of the session timestamps and the idle times.
+	clock xbase.AtomicClock
+	// migrated are the session states imported from the other radon, key is 'user@host'.
+	migrated map[string][]*migratedState
 }
 
 // NewSessions creates new session.
@@ -40,11 +49,30 @@ func NewSessions(log *xlog.Log) *Sessions {
 	}
 }
 
+// SetClock used to set the clock of the sessions.
+func (ss *Sessions) SetClock(clock xbase.Clock) {
+	ss.clock.Set(clock)
+}
+
+func (ss *Sessions) now() time.Time {
+	return ss.clock.Get().Now()
+}
+
 // Add used to add the session to map when session created.
 func (ss *Sessions) Add(s *driver.Session) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
-	ss.sessions[s.ID()] = newSession(ss.log, s)
+	ss.sessions[s.ID()] = newSession(ss.log, s, ss.now())
+}
+
+// AddAnalyst used to add the session of the analyst endpoint.
+func (ss *Sessions) AddAnalyst(s *driver.Session) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	session := newSession(ss.log, s, ss.now())
+	session.analyst = true
+	ss.sessions[s.ID()] = session
+	ss.analysts++
 }
 
 // Remove used to remove the session from the map when session exit.
@@ -55,7 +83,7 @@ func (ss *Sessions) Remove(s *driver.Session) {
 		ss.mu.Unlock()
 		return
 	}
-	delete(ss.sessions, s.ID())
+	ss.delete(s.ID(), session)
 	ss.mu.Unlock()
 
 	session.close()
@@ -73,18 +101,67 @@ func (ss *Sessions) Kill(id uint32, reason string) {
 		ss.mu.Unlock()
 		return
 	}
-	delete(ss.sessions, id)
+	ss.delete(id, session)
 	ss.mu.Unlock()
 	log.Warning("session.id[%v].killed.reason:%s", id, reason)
 
 	session.close()
 }
 
-// Reaches used to check whether the sessions count reaches(>=) the quota.
+// Cancel used to cancel the executing querys of the session on the backends, the session is kept.
+func (ss *Sessions) Cancel(s *driver.Session, reason string) {
+	log := ss.log
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	transaction := session.transaction
+	cancel := session.cancel
+	session.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if transaction != nil {
+		log.Warning("session.id[%v].cancelled.reason:%s", s.ID(), reason)
+		if err := transaction.Cancel(reason); err != nil {
+			log.Error("session.id[%v].cancel.txn.error:%+v", s.ID(), err)
+		}
+	}
+}
+
+// delete used to delete the session from the map, the caller must hold the lock.
+func (ss *Sessions) delete(id uint32, session *session) {
+	delete(ss.sessions, id)
+	if session.analyst {
+		ss.analysts--
+	}
+}
+
+// Reaches used to check whether the sessions count reaches(>=) the quota,
+// the analyst endpoint sessions are not counted.
 func (ss *Sessions) Reaches(quota int) bool {
 	ss.mu.RLock()
 	defer ss.mu.RUnlock()
-	return (len(ss.sessions) >= quota)
+	return (len(ss.sessions)-ss.analysts >= quota)
+}
+
+// AnalystReaches used to check whether the analyst endpoint sessions count reaches(>=) the quota.
+func (ss *Sessions) AnalystReaches(quota int) bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return (ss.analysts >= quota)
+}
+
+// isAnalyst returns true if the session is of the analyst endpoint.
+func (ss *Sessions) isAnalyst(s *driver.Session) bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	session, ok := ss.sessions[s.ID()]
+	return ok && session.analyst
 }
 
 // getTxnSession used to get current connection session.
@@ -101,6 +178,28 @@ func (ss *Sessions) getSession(id uint32) *session {
 	return ss.sessions[id]
 }
 
+// QueryContext returns the context of the executing query of the session, it's cancelled
+// by the Cancel or the returned cancel once the query is done.
+func (ss *Sessions) QueryContext(s *driver.Session) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return ctx, cancel
+	}
+
+	session.mu.Lock()
+	session.cancel = cancel
+	session.mu.Unlock()
+	return ctx, func() {
+		session.mu.Lock()
+		session.cancel = nil
+		session.mu.Unlock()
+		cancel()
+	}
+}
+
 // TxnBinding used to bind txn to the session.
 func (ss *Sessions) TxnBinding(s *driver.Session, txn backend.Transaction, node sqlparser.Statement, query string) {
 
@@ -124,7 +223,7 @@ func (ss *Sessions) TxnBinding(s *driver.Session, txn backend.Transaction, node
 	// Bind sid to txn.
 	txn.SetSessionID(s.ID())
 	session.transaction = txn
-	session.timestamp = time.Now().Unix()
+	session.timestamp = ss.now().Unix()
 }
 
 // TxnUnBinding used to set transaction and node to nil.
@@ -142,7 +241,7 @@ func (ss *Sessions) TxnUnBinding(s *driver.Session) {
 	session.node = nil
 	session.query = ""
 	session.transaction = nil
-	session.timestamp = time.Now().Unix()
+	session.timestamp = ss.now().Unix()
 }
 
 // MultiStmtTxnBinding used to bind txn, node, query to the session
@@ -170,7 +269,7 @@ func (ss *Sessions) MultiStmtTxnBinding(s *driver.Session, txn backend.Transacti
 		txn.SetSessionID(s.ID())
 		session.transaction = txn
 	}
-	session.timestamp = time.Now().Unix()
+	session.timestamp = ss.now().Unix()
 }
 
 // MultiStmtTxnUnBinding used to set transaction by isEnd
@@ -190,8 +289,9 @@ func (ss *Sessions) MultiStmtTxnUnBinding(s *driver.Session, isEnd bool) {
 	// If multiple-statement transaction is end or some errors happen, set transaction to be nil
 	if isEnd {
 		session.transaction = nil
+		session.flushWrites(ss.now())
 	}
-	session.timestamp = time.Now().Unix()
+	session.timestamp = ss.now().Unix()
 }
 
 // Close used to close all sessions.
@@ -227,6 +327,8 @@ type SessionInfo struct {
 	Info         string
 	RowsSent     uint64
 	RowsExamined uint64
+	// Backends are the backend connections held by the transaction of the session.
+	Backends []backend.ConnectionInfo
 }
 
 // Sort by id.
@@ -245,7 +347,7 @@ func (q sessionInfos) Less(i, j int) bool { return q[i].ID < q[j].ID }
 func (ss *Sessions) Snapshot() []SessionInfo {
 	var infos sessionInfos
 
-	now := time.Now().Unix()
+	now := ss.now().Unix()
 	ss.mu.Lock()
 	for _, v := range ss.sessions {
 		v.mu.Lock()
@@ -266,6 +368,7 @@ func (ss *Sessions) Snapshot() []SessionInfo {
 		if v.transaction != nil {
 			// https://dev.mysql.com/doc/refman/5.7/en/general-thread-states.html about state.
 			info.State = sessionStateInTransaction
+			info.Backends = v.transaction.Connections()
 		}
 
 		infos = append(infos, info)
@@ -280,7 +383,7 @@ func (ss *Sessions) Snapshot() []SessionInfo {
 func (ss *Sessions) SnapshotTxn() []SessionInfo {
 	var infos sessionInfos
 
-	now := time.Now().Unix()
+	now := ss.now().Unix()
 	ss.mu.Lock()
 	for _, v := range ss.sessions {
 		v.mu.Lock()
@@ -312,11 +415,59 @@ func (ss *Sessions) SnapshotTxn() []SessionInfo {
 	return infos
 }
 
+// SnapshotIdle returns all sessions info which are idle for longer than the wait timeout.
+// The session wait_timeout takes precedence, then interactiveTimeout for the interactive clients, then waitTimeout.
+func (ss *Sessions) SnapshotIdle(waitTimeout uint32, interactiveTimeout uint32) []SessionInfo {
+	var infos sessionInfos
+
+	now := ss.now().Unix()
+	ss.mu.Lock()
+	for _, v := range ss.sessions {
+		v.mu.Lock()
+		if v.node != nil {
+			v.mu.Unlock()
+			continue
+		}
+
+		timeout := waitTimeout
+		if (v.session.ClientFlags() & sqldb.CLIENT_INTERACTIVE) != 0 {
+			timeout = interactiveTimeout
+		}
+		if v.waitTimeout > 0 {
+			timeout = v.waitTimeout
+		}
+
+		idle := uint32(now - (int64)(v.session.LastQueryTime().Unix()))
+		if timeout == 0 || idle <= timeout {
+			v.mu.Unlock()
+			continue
+		}
+
+		info := SessionInfo{
+			ID:      v.session.ID(),
+			User:    v.session.User(),
+			Host:    v.session.Addr(),
+			DB:      v.session.Schema(),
+			Command: "Sleep",
+			Time:    idle,
+		}
+		if v.transaction != nil {
+			info.State = sessionStateInTransaction
+		}
+
+		infos = append(infos, info)
+		v.mu.Unlock()
+	}
+	ss.mu.Unlock()
+	sort.Sort(infos)
+	return infos
+}
+
 // Snapshot returns all session info about the user.
 func (ss *Sessions) SnapshotUser(user string) []SessionInfo {
 	var infos sessionInfos
 
-	now := time.Now().Unix()
+	now := ss.now().Unix()
 	ss.mu.Lock()
 	for _, v := range ss.sessions {
 		if v.session.User() != user {
@@ -341,6 +492,7 @@ func (ss *Sessions) SnapshotUser(user string) []SessionInfo {
 		if v.transaction != nil {
 			// https://dev.mysql.com/doc/refman/5.7/en/general-thread-states.html about state.
 			info.State = sessionStateInTransaction
+			info.Backends = v.transaction.Connections()
 		}
 
 		infos = append(infos, info)
@@ -10,25 +10,83 @@ package proxy
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
 const (
 	var_radon_streaming_fetch = "radon_streaming_fetch"
+	var_radon_consistent_read = "radon_consistent_read"
+	var_radon_shard_key_value = "radon_shard_key_value"
+	var_wait_timeout          = "wait_timeout"
+)
+
+// The global variables, same as the settings of the REST api.
+const (
+	var_radon_audit_mode            = "radon_audit_mode"
+	var_radon_auto_analyze          = "radon_auto_analyze"
+	var_radon_auto_analyze_interval = "radon_auto_analyze_interval"
+	var_radon_long_query_time       = "radon_long_query_time"
+	var_radon_query_timeout         = "radon_query_timeout"
+	var_radon_readonly              = "radon_readonly"
+	var_radon_throttle              = "radon_throttle"
+)
+
+var (
+	globalVars = map[string]struct{}{
+		var_radon_audit_mode:            struct{}{},
+		var_radon_auto_analyze:          struct{}{},
+		var_radon_auto_analyze_interval: struct{}{},
+		var_radon_long_query_time:       struct{}{},
+		var_radon_query_timeout:         struct{}{},
+		var_radon_readonly:              struct{}{},
+		var_radon_throttle:              struct{}{},
+	}
+
+	// sessionVars are the session variables applied by radon, the others are accepted and ignored.
+	sessionVars = map[string]struct{}{
+		var_radon_streaming_fetch:  struct{}{},
+		var_radon_consistent_read:  struct{}{},
+		var_radon_shard_key_value:  struct{}{},
+		var_radon_read_consistency: struct{}{},
+		var_radon_read_as_of:       struct{}{},
+		var_wait_timeout:           struct{}{},
+	}
+
+	// The parser drops the GLOBAL keyword.
+	setGlobalRegexp = regexp.MustCompile(`(?is)^set\s+global\s`)
 )
 
 // handleSet used to handle the SET command.
 func (spanner *Spanner) handleSet(session *driver.Session, query string, node *sqlparser.Set) (*sqltypes.Result, error) {
+	var tracks [][2]string
 	txSession := spanner.sessions.getTxnSession(session)
+	global := setGlobalRegexp.MatchString(query)
 	for _, expr := range node.Exprs {
 		name := expr.Name.Lowered()
 		if strings.HasPrefix(name, "@@session.") {
 			name = strings.TrimPrefix(name, "@@session.")
 		}
+		if strings.HasPrefix(name, "@@global.") {
+			name = strings.TrimPrefix(name, "@@global.")
+			global = true
+		}
+
+		if _, ok := globalVars[name]; ok {
+			if err := spanner.setGlobalVar(session, name, global, expr.Expr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, ok := sessionVars[name]; ok {
+			tracks = append(tracks, [2]string{name, varValue(expr.Expr)})
+		}
 
 		switch name {
 		case var_radon_streaming_fetch:
@@ -53,8 +111,139 @@ func (spanner *Spanner) handleSet(session *driver.Session, query string, node *s
 					txSession.setStreamingFetchVar(false)
 				}
 			}
+		case var_radon_consistent_read:
+			switch expr := expr.Expr.(type) {
+			case *sqlparser.SQLVal:
+				switch expr.Type {
+				case sqlparser.StrVal:
+					val := strings.ToLower(string(expr.Val))
+					switch val {
+					case "on":
+						txSession.setConsistentReadVar(true)
+					case "off":
+						txSession.setConsistentReadVar(false)
+					}
+				default:
+					return nil, fmt.Errorf("Invalid value type: %v", sqlparser.String(expr))
+				}
+			case sqlparser.BoolVal:
+				txSession.setConsistentReadVar(bool(expr))
+			}
+		case var_radon_shard_key_value:
+			if err := spanner.setShardKeyValue(session, txSession, expr.Expr); err != nil {
+				return nil, err
+			}
+		case var_radon_read_consistency:
+			if err := spanner.setReadConsistency(txSession, expr.Expr); err != nil {
+				return nil, err
+			}
+		case var_radon_read_as_of:
+			if err := spanner.setReadAsOf(txSession, expr.Expr); err != nil {
+				return nil, err
+			}
+		case var_wait_timeout:
+			switch expr := expr.Expr.(type) {
+			case *sqlparser.SQLVal:
+				switch expr.Type {
+				case sqlparser.IntVal:
+					timeout, err := strconv.ParseUint(string(expr.Val), 10, 32)
+					if err != nil {
+						return nil, fmt.Errorf("Invalid value: %v", sqlparser.String(expr))
+					}
+					txSession.setWaitTimeoutVar(uint32(timeout))
+				default:
+					return nil, fmt.Errorf("Invalid value type: %v", sqlparser.String(expr))
+				}
+			}
 		}
 	}
+
+	for _, track := range tracks {
+		session.TrackSystemVariable(track[0], track[1])
+	}
 	qr := &sqltypes.Result{Warnings: 1}
 	return qr, nil
 }
+
+// setGlobalVar used to set the radon global variable by the proxy setter as the REST api does,
+// the value is not flushed to the config file.
+func (spanner *Spanner) setGlobalVar(session *driver.Session, name string, global bool, expr sqlparser.Expr) error {
+	log := spanner.log
+	proxy := spanner.proxy
+
+	if !global {
+		return sqldb.NewSQLError(sqldb.ER_GLOBAL_VARIABLE, name)
+	}
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return sqldb.NewSQLError(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "SUPER")
+	}
+
+	value := varValue(expr)
+	wrong := sqldb.NewSQLError(sqldb.ER_WRONG_VALUE_FOR_VAR, name, value)
+	switch name {
+	case var_radon_readonly:
+		switch strings.ToLower(value) {
+		case "on", "true", "1":
+			proxy.SetReadOnly(true)
+		case "off", "false", "0":
+			proxy.SetReadOnly(false)
+		default:
+			return wrong
+		}
+	case var_radon_auto_analyze:
+		switch strings.ToLower(value) {
+		case "on", "true", "1":
+			proxy.SetAutoAnalyze(true)
+		case "off", "false", "0":
+			proxy.SetAutoAnalyze(false)
+		default:
+			return wrong
+		}
+	case var_radon_audit_mode:
+		mode := strings.ToUpper(value)
+		switch mode {
+		case "N", "R", "W", "A":
+			proxy.SetAuditMode(mode)
+		default:
+			return wrong
+		}
+	default:
+		val, ok := expr.(*sqlparser.SQLVal)
+		if !ok || val.Type != sqlparser.IntVal {
+			return wrong
+		}
+		n, err := strconv.ParseUint(string(val.Val), 10, 31)
+		if err != nil {
+			return wrong
+		}
+		switch name {
+		case var_radon_throttle:
+			proxy.SetThrottle(int(n))
+		case var_radon_query_timeout:
+			proxy.SetQueryTimeout(int(n))
+		case var_radon_long_query_time:
+			proxy.SetLongQueryTime(int(n))
+		case var_radon_auto_analyze_interval:
+			proxy.SetAutoAnalyzeInterval(int(n))
+		}
+	}
+	log.Warning("proxy.set.global[%s=%s].from.session[%v]", name, value, session.ID())
+	return nil
+}
+
+// varValue returns the value without quotes, the unquoted word such as OFF is parsed as column.
+func varValue(expr sqlparser.Expr) string {
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		return string(expr.Val)
+	case *sqlparser.ColName:
+		return expr.Name.String()
+	case sqlparser.BoolVal:
+		if expr {
+			return "true"
+		}
+		return "false"
+	}
+	return sqlparser.String(expr)
+}
@@ -9,10 +9,17 @@
 package proxy
 
 import (
+	"net"
 	"testing"
 
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/packet"
+	"github.com/xelabs/go-mysqlstack/proto"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -75,5 +82,189 @@ func TestProxySet(t *testing.T) {
 			_, err := client.FetchAll(query, -1)
 			assert.NotNil(t, err)
 		}
+		{
+			query := "set @@SESSION.wait_timeout=100"
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err)
+		}
+		{
+			query := "set wait_timeout='100'"
+			_, err := client.FetchAll(query, -1)
+			assert.NotNil(t, err)
+		}
+	}
+}
+
+func TestProxySetGlobal(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	conf := proxy.Config()
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// set global.
+	{
+		querys := []string{
+			"set global radon_readonly = 'ON', radon_audit_mode = 'a'",
+			"set @@GLOBAL.radon_throttle = 100",
+			"set global radon_query_timeout = 3000, radon_long_query_time = 2",
+			"set global radon_auto_analyze = 'ON', radon_auto_analyze_interval = 500",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+		assert.True(t, proxy.Spanner().ReadOnly())
+		assert.Equal(t, "A", conf.Audit.Mode)
+		assert.Equal(t, 100, proxy.throttle.Limits())
+		assert.Equal(t, 3000, conf.Proxy.QueryTimeout)
+		assert.Equal(t, 2, conf.Proxy.LongQueryTime)
+		assert.True(t, conf.Proxy.AutoAnalyze)
+		assert.Equal(t, 500, conf.Proxy.AutoAnalyzeInterval)
+
+		// Works on readonly.
+		_, err := client.FetchAll("set global radon_readonly = off", -1)
+		assert.Nil(t, err)
+		assert.False(t, proxy.Spanner().ReadOnly())
+		_, err = client.FetchAll("set global radon_readonly = 1", -1)
+		assert.Nil(t, err)
+		assert.True(t, proxy.Spanner().ReadOnly())
+	}
+
+	// error.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{"set radon_throttle = 100", "Variable 'radon_throttle' is a GLOBAL variable and should be set with SET GLOBAL (errno 1229) (sqlstate HY000)"},
+			{"set @@session.radon_readonly = 1", "Variable 'radon_readonly' is a GLOBAL variable and should be set with SET GLOBAL (errno 1229) (sqlstate HY000)"},
+			{"set global radon_readonly = 'xx'", "Variable 'radon_readonly' can't be set to the value of 'xx' (errno 1231) (sqlstate 42000)"},
+			{"set global radon_audit_mode = 'X'", "Variable 'radon_audit_mode' can't be set to the value of 'X' (errno 1231) (sqlstate 42000)"},
+			{"set global radon_throttle = '10'", "Variable 'radon_throttle' can't be set to the value of '10' (errno 1231) (sqlstate 42000)"},
+			{"set global radon_query_timeout = -1", "Variable 'radon_query_timeout' can't be set to the value of '-1' (errno 1231) (sqlstate 42000)"},
+			{"set global radon_auto_analyze = 'xx'", "Variable 'radon_auto_analyze' can't be set to the value of 'xx' (errno 1231) (sqlstate 42000)"},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+		assert.Equal(t, 100, proxy.throttle.Limits())
+		assert.Equal(t, 3000, conf.Proxy.QueryTimeout)
+	}
+}
+
+func TestProxySetGlobalPrivilege(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxyPrivilegeNotSuper(log, MockDefaultConfig())
+	defer cleanup()
+	address := proxy.Address()
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	_, err = client.FetchAll("set global radon_readonly = 1", -1)
+	want := "Access denied; you need (at least one of) the SUPER privilege(s) for this operation (errno 1227) (sqlstate 42000)"
+	assert.Equal(t, want, err.Error())
+	assert.False(t, proxy.Spanner().ReadOnly())
+}
+
+// mockSessionTrackConn used to connect to the proxy with CLIENT_SESSION_TRACK, it returns
+// the function to query, which returns the OK packet or the error of the query.
+func mockSessionTrackConn(t *testing.T, address string) (func(query string) (*proto.OK, error), func()) {
+	conn, err := net.Dial("tcp", address)
+	assert.Nil(t, err)
+	packets := packet.NewPackets(conn)
+
+	data, err := packets.Next()
+	assert.Nil(t, err)
+	greeting := proto.NewGreeting(0, "")
+	err = greeting.UnPack(data)
+	assert.Nil(t, err)
+
+	auth := proto.NewAuth()
+	flags := proto.DefaultClientCapability | sqldb.CLIENT_SESSION_TRACK
+	err = packets.Write(auth.Pack(flags, sqldb.CharacterSetUtf8, "mock", "mock", greeting.Salt, ""))
+	assert.Nil(t, err)
+	err = packets.ReadOK()
+	assert.Nil(t, err)
+
+	query := func(query string) (*proto.OK, error) {
+		err := packets.WriteCommand(sqldb.COM_QUERY, []byte(query))
+		assert.Nil(t, err)
+		ok, _, myerr, err := packets.ReadComQueryResponse()
+		assert.Nil(t, err)
+		return ok, myerr
+	}
+	return query, func() { conn.Close() }
+}
+
+func TestProxySetSessionTrack(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	proxy.SetTwoPC(true)
+
+	fakedbs.AddQuery("use test", fakedb.Result3)
+	fakedbs.AddQueryPattern("XA .*", result1)
+
+	query, closeConn := mockSessionTrackConn(t, proxy.Address())
+	defer closeConn()
+
+	// The greeting advertises the capability.
+	{
+		ok, err := query("use test")
+		assert.Nil(t, err)
+		want := []proto.SessionState{
+			{Type: sqldb.SESSION_TRACK_SCHEMA, Value: "test"},
+			{Type: sqldb.SESSION_TRACK_STATE_CHANGE, Value: "1"},
+		}
+		assert.Equal(t, want, ok.SessionStates)
+	}
+
+	// The session variables.
+	{
+		ok, err := query("set autocommit=0, names 'utf8mb4', @a=1, @@session.radon_streaming_fetch='ON', wait_timeout=100")
+		assert.Nil(t, err)
+		want := []proto.SessionState{
+			{Type: sqldb.SESSION_TRACK_SYSTEM_VARIABLES, Name: "radon_streaming_fetch", Value: "ON"},
+			{Type: sqldb.SESSION_TRACK_STATE_CHANGE, Value: "1"},
+			{Type: sqldb.SESSION_TRACK_SYSTEM_VARIABLES, Name: "wait_timeout", Value: "100"},
+		}
+		assert.Equal(t, want, ok.SessionStates)
+	}
+
+	// The variables radon ignores are not tracked.
+	{
+		ok, err := query("set autocommit=1, names 'utf8'")
+		assert.Nil(t, err)
+		assert.Nil(t, ok.SessionStates)
+	}
+
+	// The transaction state.
+	{
+		ok, err := query("begin")
+		assert.Nil(t, err)
+		want := []proto.SessionState{{Type: sqldb.SESSION_TRACK_TRANSACTION_STATE, Value: "T_______"}}
+		assert.Equal(t, want, ok.SessionStates)
+
+		ok, err = query("commit")
+		assert.Nil(t, err)
+		want = []proto.SessionState{{Type: sqldb.SESSION_TRACK_TRANSACTION_STATE, Value: "________"}}
+		assert.Equal(t, want, ok.SessionStates)
+	}
+
+	// Nothing changed.
+	{
+		ok, err := query("use test")
+		assert.Nil(t, err)
+		assert.Nil(t, ok.SessionStates)
 	}
 }
@@ -0,0 +1,195 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"optimizer"
+	"planner"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// setShardKeyValue used to handle the 'SET radon_shard_key_value = value', the unrouted SELECT, UPDATE and DELETE
+// of the session are forced to the segments of the value for debugging the data placement.
+// NULL or the empty string resets it, only the super user can set it.
+func (spanner *Spanner) setShardKeyValue(session *driver.Session, txSession *session, expr sqlparser.Expr) error {
+	log := spanner.log
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	if !privilegePlug.IsSuperPriv(session.User()) {
+		return sqldb.NewSQLError(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "SUPER")
+	}
+
+	switch expr := expr.(type) {
+	case *sqlparser.NullVal:
+		txSession.shardKeyValue = nil
+	case *sqlparser.SQLVal:
+		switch expr.Type {
+		case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+			if len(expr.Val) == 0 {
+				txSession.shardKeyValue = nil
+			} else {
+				txSession.shardKeyValue = expr
+			}
+		default:
+			return sqldb.NewSQLError(sqldb.ER_WRONG_VALUE_FOR_VAR, var_radon_shard_key_value, sqlparser.String(expr))
+		}
+	default:
+		return sqldb.NewSQLError(sqldb.ER_WRONG_VALUE_FOR_VAR, var_radon_shard_key_value, sqlparser.String(expr))
+	}
+	log.Warning("proxy.session[%v].user[%s].set.shard.key.value[%s]", session.ID(), session.User(), sqlparser.String(expr))
+	return nil
+}
+
+// executeShardKeyValue used to execute the unrouted statement on the segments of the session shard key value,
+// it returns false if the value is not set, the session is in transaction or the planner routes the statement
+// to one segment.
+// The sharded tables are rewritten to their segments of the value, which must be on the same backend,
+// and the GLOBAL tables are kept.
+func (spanner *Spanner) executeShardKeyValue(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, bool, error) {
+	log := spanner.log
+	txSession := spanner.sessions.getTxnSession(session)
+	if txSession == nil || txSession.shardKeyValue == nil || txSession.transaction != nil {
+		return nil, false, nil
+	}
+	switch node.(type) {
+	case *sqlparser.Select, *sqlparser.Update, *sqlparser.Delete:
+	default:
+		return nil, false, nil
+	}
+	// The multi-table DML is not rewritten, it's routed by the planner.
+	if planner.IsMultiTableDML(query) {
+		return nil, false, nil
+	}
+
+	unrouted, err := spanner.isUnrouted(database, query)
+	if err != nil {
+		return nil, true, err
+	}
+	if !unrouted {
+		return nil, false, nil
+	}
+
+	// Rewrite a copy, the node may be planned again.
+	stmt, err := sqlparser.Parse(query)
+	if err != nil {
+		return nil, true, err
+	}
+	backend, err := spanner.forceSegments(database, stmt, txSession.shardKeyValue)
+	if err != nil {
+		return nil, true, err
+	}
+	if backend == "" {
+		return nil, false, nil
+	}
+	rewritten := sqlparser.String(stmt)
+	log.Warning("proxy.session[%v].shard.key.value[%s].forces.query[%s].to.backend[%s].as[%s]",
+		session.ID(), sqlparser.String(txSession.shardKeyValue), query, backend, rewritten)
+	qr, err := spanner.ExecuteOnThisBackend(backend, rewritten)
+	return qr, true, err
+}
+
+// isUnrouted returns true if the planner sends the statement to more than one segment.
+func (spanner *Spanner) isUnrouted(database string, query string) (bool, error) {
+	node, err := sqlparser.Parse(query)
+	if err != nil {
+		return false, err
+	}
+	plans, err := optimizer.NewSimpleOptimizer(spanner.log, database, query, node, spanner.router).BuildPlanTree()
+	if err != nil {
+		return false, err
+	}
+	for _, plan := range plans.Plans() {
+		switch plan := plan.(type) {
+		case *planner.SelectPlan:
+			m, ok := plan.Root.(*planner.MergeNode)
+			return !ok || len(m.GetQuery()) > 1, nil
+		case *planner.UpdatePlan:
+			return len(plan.Querys) > 1, nil
+		case *planner.DeletePlan:
+			return len(plan.Querys) > 1, nil
+		}
+	}
+	return false, nil
+}
+
+// forceSegments used to rewrite the non-GLOBAL tables of the statement to their segments of the value,
+// it returns the backend of the segments.
+func (spanner *Spanner) forceSegments(database string, stmt sqlparser.Statement, val *sqlparser.SQLVal) (string, error) {
+	route := spanner.router
+	var backend string
+
+	segment := func(tb sqlparser.TableName) (sqlparser.TableName, bool, error) {
+		db := database
+		if !tb.Qualifier.IsEmpty() {
+			db = tb.Qualifier.String()
+		}
+		table := tb.Name.String()
+		conf, err := route.TableConfig(db, table)
+		if err != nil {
+			return tb, false, err
+		}
+		if conf.ShardType == "GLOBAL" {
+			return tb, false, nil
+		}
+		segments, err := route.Lookup(db, table, val, val)
+		if err != nil {
+			return tb, false, err
+		}
+		if len(segments) != 1 {
+			return tb, false, errors.Errorf("shard.key.value[%s].table[%s.%s].has.%d.segments", sqlparser.String(val), db, table, len(segments))
+		}
+		if backend != "" && backend != segments[0].Backend {
+			return tb, false, errors.Errorf("shard.key.value[%s].segments.are.on.the.different.backends[%s, %s]", sqlparser.String(val), backend, segments[0].Backend)
+		}
+		backend = segments[0].Backend
+		return sqlparser.TableName{Name: sqlparser.NewTableIdent(segments[0].Table), Qualifier: sqlparser.NewTableIdent(db)}, true, nil
+	}
+
+	var err error
+	switch stmt := stmt.(type) {
+	case *sqlparser.Update:
+		stmt.Table, _, err = segment(stmt.Table)
+	case *sqlparser.Delete:
+		stmt.Table, _, err = segment(stmt.Table)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		aliased, ok := node.(*sqlparser.AliasedTableExpr)
+		if !ok {
+			return true, nil
+		}
+		tb, ok := aliased.Expr.(sqlparser.TableName)
+		if !ok {
+			return true, nil
+		}
+		seg, rewritten, err := segment(tb)
+		if err != nil {
+			return false, err
+		}
+		if rewritten {
+			// Keep the qualifiers of the columns.
+			if aliased.As.IsEmpty() {
+				aliased.As = tb.Name
+			}
+			aliased.Expr = seg
+		}
+		return true, nil
+	}, stmt)
+	if err != nil {
+		return "", err
+	}
+	return backend, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyShardKeyValue(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	route := proxy.Spanner().router
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+		fakedbs.AddQueryPattern("update .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.g1(id int, b int) global",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	segments, err := route.Lookup("test", "t1", sqlparser.NewIntVal([]byte("7")), sqlparser.NewIntVal([]byte("7")))
+	assert.Nil(t, err)
+	segment := segments[0].Table
+
+	_, err = client.FetchAll("set radon_shard_key_value = 7", -1)
+	assert.Nil(t, err)
+
+	// The unrouted statements are forced to the segment.
+	{
+		qr, err := client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(qr.Rows))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("select * from test.%s as t1", segment)))
+
+		_, err = client.FetchAll("select t1.id from test.t1 join test.g1 on t1.id = g1.id", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("select t1.id from test.%s as t1 join test.g1 on t1.id = g1.id", segment)))
+
+		_, err = client.FetchAll("update test.t1 set b = 1 where b = 2", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("update test.%s set b = 1 where b = 2", segment)))
+	}
+
+	// The routed statements are not forced.
+	{
+		qr, err := client.FetchAll("select * from test.t1 where id = 1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(qr.Rows))
+
+		qr, err = client.FetchAll("select * from test.g1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(qr.Rows))
+	}
+
+	// Reset.
+	{
+		_, err = client.FetchAll("set radon_shard_key_value = NULL", -1)
+		assert.Nil(t, err)
+		qr, err := client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 60, len(qr.Rows))
+	}
+
+	// Errors.
+	{
+		_, err := client.FetchAll("set radon_shard_key_value = now()", -1)
+		assert.Equal(t, "Variable 'radon_shard_key_value' can't be set to the value of 'now()' (errno 1231) (sqlstate 42000)", err.Error())
+	}
+}
+
+func TestProxyShardKeyValuePrivilege(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxyPrivilegeNotSuper(log, MockDefaultConfig())
+	defer cleanup()
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	_, err = client.FetchAll("set radon_shard_key_value = 7", -1)
+	want := "Access denied; you need (at least one of) the SUPER privilege(s) for this operation (errno 1227) (sqlstate 42000)"
+	assert.Equal(t, want, err.Error())
+}
@@ -14,50 +14,58 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"build"
+	"config"
 
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
-	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
-// handleShowDatabases used to handle the 'SHOW DATABASES' command.
+// handleShowDatabases used to handle the 'SHOW DATABASES [EXTENDED] [LIKE 'pattern' | WHERE expr] [LIMIT [offset,] row_count]' command,
+// the databases are served by the router metadata without touching the backends.
+// The EXTENDED adds the data size(in byte) last polled from the backends and the quota of the databases, 0 means no quota.
 func (spanner *Spanner) handleShowDatabases(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
-	qr, err := spanner.ExecuteSingle(query)
-	if err != nil {
-		return nil, err
+	var err error
+	columns := []string{"Database"}
+	filter := &showFilter{columns: columns, count: -1}
+	extended := false
+	if matches := showDatabasesRegexp.FindStringSubmatch(strings.TrimSpace(query)); matches != nil {
+		if extended = matches[1] != ""; extended {
+			columns = append(columns, "Data_length", "Quota")
+		}
+		if filter, err = parseShowFilter(columns, matches[2:]); err != nil {
+			return nil, err
+		}
 	}
 
 	privilegePlug := spanner.plugins.PlugPrivilege()
-	isSuper := privilegePlug.IsSuperPriv(session.User())
-	if isSuper {
-		return qr, nil
-	} else {
-		isSet := privilegePlug.CheckUserPrivilegeIsSet(session.User())
-		if isSet {
-			return qr, nil
-		} else {
-			newqr := &sqltypes.Result{}
-			for _, row := range qr.Rows {
-				db := string(row[0].Raw())
-				if isExist := privilegePlug.CheckDBinUserPrivilege(session.User(), db); isExist {
-					newqr.RowsAffected++
-					newqr.Rows = append(newqr.Rows, row)
-				}
-			}
-
-			newqr.Fields = []*querypb.Field{
-				{Name: "Database", Type: querypb.Type_VARCHAR},
-			}
-			return newqr, nil
+	all := privilegePlug.IsSuperPriv(session.User()) || privilegePlug.CheckUserPrivilegeIsSet(session.User())
+	var rows [][]string
+	for _, db := range spanner.router.Databases() {
+		if !all && !privilegePlug.CheckDBinUserPrivilege(session.User(), db) {
+			continue
+		}
+		row := []string{db}
+		if extended {
+			usage := spanner.quotas.Usage(db)
+			row = append(row, fmt.Sprintf("%d", usage.DataLength), fmt.Sprintf("%d", usage.Quota))
+		}
+		ok, err := filter.match(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
 		}
 	}
+	return showFilterResult(filter, filter.limit(rows)), nil
 }
 
 // handleShowEngines used to handle the 'SHOW ENGINES' command.
@@ -91,7 +99,7 @@ func (spanner *Spanner) handleShowTableStatus(session *driver.Session, query str
 		return nil, err
 	}
 
-	rewritten := fmt.Sprintf("SHOW TABLE STATUS from %s", database)
+	rewritten := fmt.Sprintf("SHOW TABLE STATUS from %s", sqlparser.Backtick(database))
 	qr, err := spanner.ExecuteScatter(rewritten)
 	if err != nil {
 		return nil, err
@@ -191,6 +199,15 @@ func (spanner *Spanner) handleShowTableStatus(session *driver.Session, query str
 		}
 	}
 
+	// The MariaDB backends return the extra Max_index_length and Temporary columns,
+	// align the rows to the fields if the MySQL and MariaDB backends are mixed.
+	for i, row := range newqr.Rows {
+		for len(row) < len(qr.Fields) {
+			row = append(row, sqltypes.NULL)
+		}
+		newqr.Rows[i] = row[:len(qr.Fields)]
+	}
+
 	len := len(newqr.Rows)
 	qr.RowsAffected = uint64(len)
 	qr.Rows = qr.Rows[0:0]
@@ -198,14 +215,28 @@ func (spanner *Spanner) handleShowTableStatus(session *driver.Session, query str
 	return qr, nil
 }
 
-// handleShowTables used to handle the 'SHOW TABLES' command.
+// handleShowTables used to handle the 'SHOW [FULL] TABLES [FROM db_name] [LIKE 'pattern' | WHERE expr] [LIMIT [offset,] row_count]'
+// command, the tables are served by the router metadata without touching the backends, the Table_type of the FULL is the
+// GLOBAL, SINGLE, HASH or VIEW.
 func (spanner *Spanner) handleShowTables(session *driver.Session, query string, node *sqlparser.Show) (*sqltypes.Result, error) {
 	router := spanner.router
 	ast := node
 
+	// The node is nil if the query is handled before the parser.
 	database := session.Schema()
-	if !ast.Database.IsEmpty() {
-		database = ast.Database.Name.String()
+	full := false
+	if ast != nil {
+		if !ast.Database.IsEmpty() {
+			database = ast.Database.Name.String()
+		}
+		full = ast.Type == sqlparser.ShowFullTablesStr
+	}
+	matches := showTablesRegexp.FindStringSubmatch(strings.TrimSpace(query))
+	if matches != nil {
+		full = matches[1] != ""
+		if matches[2] != "" {
+			database = strings.Trim(matches[2], "`")
+		}
 	}
 	if database == "" {
 		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
@@ -214,29 +245,72 @@ func (spanner *Spanner) handleShowTables(session *driver.Session, query string,
 	if err := router.DatabaseACL(database); err != nil {
 		return nil, err
 	}
+	schema, ok := router.Schemas()[database]
+	if !ok {
+		return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+	}
 
-	// For validating the query works, we send it to the backend and check the error.
-	rewritten := fmt.Sprintf("SHOW TABLES FROM %s", database)
-	_, err := spanner.ExecuteScatter(rewritten)
-	if err != nil {
-		return nil, err
+	var err error
+	columns := []string{fmt.Sprintf("Tables_in_%s", database)}
+	if full {
+		columns = append(columns, "Table_type")
+	}
+	filter := &showFilter{columns: columns, count: -1}
+	if matches != nil {
+		if filter, err = parseShowFilter(columns, matches[3:]); err != nil {
+			return nil, err
+		}
 	}
 
-	qr := &sqltypes.Result{}
-	tblList := router.Tables()
-	tables, ok := tblList[database]
-	if ok {
-		qr.Fields = []*querypb.Field{
-			{Name: fmt.Sprintf("Tables_in_%s", database), Type: querypb.Type_VARCHAR},
+	tables := make([]string, 0, len(schema.Tables))
+	for table := range schema.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	var rows [][]string
+	for _, table := range tables {
+		row := []string{table}
+		if full {
+			tconf, err := router.TableConfig(database, table)
+			if err != nil {
+				return nil, err
+			}
+			if tconf.View != nil {
+				row = append(row, "VIEW")
+			} else {
+				row = append(row, tconf.ShardType)
+			}
 		}
-		for _, table := range tables {
-			row := []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(table))}
-			qr.Rows = append(qr.Rows, row)
+		ok, err := filter.match(row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
 		}
 	}
-	return qr, nil
+	return showFilterResult(filter, filter.limit(rows)), nil
 }
 
+// showFilterResult returns the result of the rows filtered by the filter.
+func showFilterResult(filter *showFilter, rows [][]string) *sqltypes.Result {
+	qr := &sqltypes.Result{}
+	for i := range filter.columns {
+		qr.Fields = append(qr.Fields, &querypb.Field{Name: filter.name(i), Type: querypb.Type_VARCHAR})
+	}
+	for _, row := range rows {
+		values := make([]sqltypes.Value, 0, len(row))
+		for _, v := range row {
+			values = append(values, sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(v)))
+		}
+		qr.Rows = append(qr.Rows, values)
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr
+}
+
+// handleShowCreateTable used to handle the 'SHOW CREATE TABLE' command,
+// the CREATE TABLE of the first segment is rewritten to the logical table by logicalCreateTable.
 func (spanner *Spanner) handleShowCreateTable(session *driver.Session, query string, node *sqlparser.Show) (*sqltypes.Result, error) {
 	router := spanner.router
 	ast := node
@@ -254,87 +328,119 @@ func (spanner *Spanner) handleShowCreateTable(session *driver.Session, query str
 		return nil, err
 	}
 
-	var qr *sqltypes.Result
-	var err error
+	tconf, err := router.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	// The single table just on the first backend, the global and hash tables are the same on all the segments.
+	parts, err := router.Lookup(database, table, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	partTable := parts[0].Table
+	backend := parts[0].Backend
 
-	shardKey, err := router.ShardKey(database, table)
+	// If the elapsed > pool.maxIdleTime, the new connection without database, add the database.
+	rewritten := fmt.Sprintf("SHOW CREATE TABLE %s.%s", sqlparser.Backtick(database), sqlparser.Backtick(partTable))
+	qr, err := spanner.ExecuteOnThisBackend(backend, rewritten)
 	if err != nil {
 		return nil, err
 	}
+	// The view is returned by the backend as the SHOW CREATE VIEW does.
+	if tconf.View != nil {
+		return qr, nil
+	}
 
-	// If shardType is GLOBAL or SINGLE, add the tableType to the end of c2;
-	// if shardType is HASH, rewrite the query Result.
-	if shardKey == "" {
-		segments, err := router.Lookup(database, table, nil, nil)
-		if err != nil {
-			return nil, err
-		}
-		// single table just on the first backend
-		backend := segments[0].Backend
+	// 'show create table' has two columns.
+	c1 := qr.Rows[0][0]
+	c2 := qr.Rows[0][1]
+	create := logicalCreateTable(string(c2.Raw()), table, tconf)
+	qr.Rows[0][0] = sqltypes.MakeTrusted(c1.Type(), []byte(table))
+	qr.Rows[0][1] = sqltypes.MakeTrusted(c2.Type(), []byte(create))
+	return qr, nil
+}
 
-		// If the elapsed > pool.maxIdleTime, the new connection without database, add the database.
-		rewritten := fmt.Sprintf("SHOW CREATE TABLE %s.%s", database, table)
-		qr, err = spanner.ExecuteOnThisBackend(backend, rewritten)
-		if err != nil {
-			return nil, err
-		}
+var (
+	createTablePrefix   = regexp.MustCompile("(?i)^\\s*create\\s+table\\s+(`(?:[^`]|``)+`|[^\\s(]+)")
+	createTableAutoIncr = regexp.MustCompile(`(?i)\s+AUTO_INCREMENT=\d+`)
+)
 
-		tableConfig, err := router.TableConfig(database, table)
-		if err != nil {
-			return nil, err
+// logicalCreateTable used to rewrite the segment CREATE TABLE from the backend to the logical table:
+// 1. The segment name after the CREATE TABLE is replaced by the table.
+// 2. The AUTO_INCREMENT table option of the segment is removed.
+// 3. The radon clause of the shard type is appended, with the PARTITIONS of the HASH/CHASH and the backend of the SINGLE.
+// So the output can be executed by radon to create the same table.
+func logicalCreateTable(create string, table string, tconf *config.TableConfig) string {
+	if loc := createTablePrefix.FindStringSubmatchIndex(create); loc != nil {
+		create = create[:loc[2]] + sqlparser.Backtick(table) + create[loc[3]:]
+	}
+	create = createTableAutoIncr.ReplaceAllString(create, "")
+
+	switch tconf.ShardType {
+	case "GLOBAL":
+		return fmt.Sprintf("%s\nGLOBAL", create)
+	case "SINGLE":
+		if len(tconf.Partitions) == 0 {
+			return fmt.Sprintf("%s\nSINGLE", create)
 		}
-		tableType := tableConfig.ShardType
-		// 'show create table' has two columns.
-		c2 := qr.Rows[0][1]
-		// Add tableType to the end of c2Val
-		c2Buf := common.NewBuffer(0)
-		c2Buf.WriteString(string(c2.Raw()))
-		partInfo := fmt.Sprintf("\n/*!%s*/", tableType)
-		c2Buf.WriteString(partInfo)
-		qr.Rows[0][1] = sqltypes.MakeTrusted(c2.Type(), c2Buf.Datas())
-	} else {
-		// Get one table from the router.
-		parts, err := router.Lookup(database, table, nil, nil)
-		if err != nil {
-			return nil, err
-		}
-		partTable := parts[0].Table
-		backend := parts[0].Backend
-		rewritten := fmt.Sprintf("SHOW CREATE TABLE %s.%s", database, partTable)
-		qr, err = spanner.ExecuteOnThisBackend(backend, rewritten)
-		if err != nil {
-			return nil, err
-		}
-
-		// 'show create table' has two columns.
-		c1 := qr.Rows[0][0]
-		c2 := qr.Rows[0][1]
-
-		// Replace the partition table to raw table.
-		c1Val := strings.Replace(string(c1.Raw()), partTable, table, 1)
-		c2Val := strings.Replace(string(c2.Raw()), partTable, table, 1)
-
-		// Add partition info to the end of c2Val
-		c2Buf := common.NewBuffer(0)
-		c2Buf.WriteString(c2Val)
-		partInfo := fmt.Sprintf("\n/*!50100 PARTITION BY HASH (%s) */", shardKey)
-		c2Buf.WriteString(partInfo)
+		backend := sqlparser.String(sqlparser.NewStrVal([]byte(tconf.Partitions[0].Backend)))
+		return fmt.Sprintf("%s\nSINGLE ON %s", create, backend)
+	case "HASH", "CHASH":
+		return fmt.Sprintf("%s\nPARTITION BY %s(%s) PARTITIONS %d", create, tconf.ShardType, sqlparser.Backtick(tconf.ShardKey), len(tconf.Partitions))
+	case "LIST":
+		return fmt.Sprintf("%s\n%s", create, listPartitionOptions(tconf))
+	}
+	return create
+}
 
-		qr.Rows[0][0] = sqltypes.MakeTrusted(c1.Type(), []byte(c1Val))
-		qr.Rows[0][1] = sqltypes.MakeTrusted(c2.Type(), c2Buf.Datas())
+// listPartitionOptions returns the PARTITION BY LIST clause of the LIST table, the values are the canonical ones.
+func listPartitionOptions(tconf *config.TableConfig) string {
+	parts := make([]string, 0, len(tconf.Partitions))
+	for _, part := range tconf.Partitions {
+		vals := make([]string, 0, len(part.ListValues))
+		for _, val := range part.ListValues {
+			if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+				vals = append(vals, val)
+			} else if _, err := strconv.ParseUint(val, 10, 64); err == nil {
+				vals = append(vals, val)
+			} else {
+				vals = append(vals, sqlparser.String(sqlparser.NewStrVal([]byte(val))))
+			}
+		}
+		parts = append(parts, fmt.Sprintf("PARTITION %s VALUES IN (%s)", sqlparser.Backtick(part.Backend), strings.Join(vals, ",")))
 	}
-	return qr, nil
+	return fmt.Sprintf("PARTITION BY LIST(%s) (\n%s\n)", sqlparser.Backtick(tconf.ShardKey), strings.Join(parts, ",\n"))
 }
 
 // handleShowColumns used to handle the 'SHOW COLUMNS' command.
 func (spanner *Spanner) handleShowColumns(session *driver.Session, query string, node *sqlparser.Show) (*sqltypes.Result, error) {
 	router := spanner.router
-	ast := node
 
-	table := ast.Table.Name.String()
+	// The node is nil if the query is handled before the parser, see showColumnsRegexp.
+	var tbl sqlparser.TableName
+	full, filter := "", ""
+	if node != nil {
+		tbl = node.Table
+	}
+	if matches := showColumnsRegexp.FindStringSubmatch(strings.TrimSpace(query)); matches != nil {
+		stmt, err := sqlparser.Parse("select 1 from " + matches[2])
+		if err != nil {
+			return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+		}
+		tbl, _ = stmt.(*sqlparser.Select).From[0].(*sqlparser.AliasedTableExpr).Expr.(sqlparser.TableName)
+		if matches[3] != "" {
+			tbl.Qualifier = sqlparser.NewTableIdent(strings.Trim(matches[3], "`"))
+		}
+		if matches[1] != "" {
+			full = "FULL "
+		}
+		filter = matches[4]
+	}
+
+	table := tbl.Name.String()
 	database := session.Schema()
-	if !ast.Table.Qualifier.IsEmpty() {
-		database = ast.Table.Qualifier.String()
+	if !tbl.Qualifier.IsEmpty() {
+		database = tbl.Qualifier.String()
 	}
 	if database == "" {
 		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
@@ -351,7 +457,7 @@ func (spanner *Spanner) handleShowColumns(session *driver.Session, query string,
 	}
 	partTable := parts[0].Table
 	backend := parts[0].Backend
-	rewritten := fmt.Sprintf("SHOW COLUMNS FROM %s.%s", database, partTable)
+	rewritten := fmt.Sprintf("SHOW %sCOLUMNS FROM %s.%s%s", full, sqlparser.Backtick(database), sqlparser.Backtick(partTable), filter)
 	qr, err := spanner.ExecuteOnThisBackend(backend, rewritten)
 	if err != nil {
 		return nil, err
@@ -360,9 +466,13 @@ func (spanner *Spanner) handleShowColumns(session *driver.Session, query string,
 	return qr, nil
 }
 
-// handleShowProcesslist used to handle the query "SHOW PROCESSLIST".
+// handleShowProcesslist used to handle the query "SHOW [FULL] PROCESSLIST".
+// The SHOW FULL PROCESSLIST has one row for every backend connection held by the session with the backend columns,
+// the backend command is Query if the connection is executing the backend info, the backend time is the seconds it
+// has been executing or idle. The session holding no backend connection has one row with the NULL backend columns.
 func (spanner *Spanner) handleShowProcesslist(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	sessions := spanner.sessions
+	full := showFullProcesslistRegexp.MatchString(strings.TrimSpace(query))
 	qr := &sqltypes.Result{}
 	qr.Fields = []*querypb.Field{
 		{Name: "Id", Type: querypb.Type_INT64},
@@ -376,6 +486,16 @@ func (spanner *Spanner) handleShowProcesslist(session *driver.Session, query str
 		{Name: "Rows_sent", Type: querypb.Type_INT64},
 		{Name: "Rows_examined", Type: querypb.Type_INT64},
 	}
+	if full {
+		qr.Fields = append(qr.Fields, []*querypb.Field{
+			{Name: "Backend", Type: querypb.Type_VARCHAR},
+			{Name: "Backend_address", Type: querypb.Type_VARCHAR},
+			{Name: "Backend_thread_id", Type: querypb.Type_INT64},
+			{Name: "Backend_command", Type: querypb.Type_VARCHAR},
+			{Name: "Backend_time", Type: querypb.Type_INT64},
+			{Name: "Backend_info", Type: querypb.Type_VARCHAR},
+		}...)
+	}
 
 	var sessionInfos []SessionInfo
 	privilegePlug := spanner.plugins.PlugPrivilege()
@@ -398,7 +518,29 @@ func (spanner *Spanner) handleShowProcesslist(session *driver.Session, query str
 			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", 0))),
 			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", 0))),
 		}
-		qr.Rows = append(qr.Rows, row)
+		if !full {
+			qr.Rows = append(qr.Rows, row)
+			continue
+		}
+		if len(info.Backends) == 0 {
+			qr.Rows = append(qr.Rows, append(row, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL, sqltypes.NULL))
+			continue
+		}
+		for _, conn := range info.Backends {
+			command := "Sleep"
+			if conn.Executing {
+				command = "Query"
+			}
+			backendRow := append(append([]sqltypes.Value{}, row...),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(conn.Backend)),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(conn.Address)),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", conn.ID))),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(command)),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", conn.Time))),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(conn.Query)),
+			)
+			qr.Rows = append(qr.Rows, backendRow)
+		}
 	}
 	return qr, nil
 }
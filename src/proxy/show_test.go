@@ -15,32 +15,17 @@ import (
 	"testing"
 	"time"
 
+	"config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
 var (
-	showDatabasesResult = &sqltypes.Result{
-		RowsAffected: 2,
-		Fields: []*querypb.Field{
-			{
-				Name: "Database",
-				Type: querypb.Type_VARCHAR,
-			},
-		},
-		Rows: [][]sqltypes.Value{
-			{
-				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test")),
-			},
-			{
-				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test1")),
-			},
-		},
-	}
-
 	showTableStatusResult1 = &sqltypes.Result{
 		RowsAffected: 13,
 		Fields: []*querypb.Field{
@@ -246,8 +231,10 @@ func TestProxyShowDatabases(t *testing.T) {
 	// fakedbs.
 	{
 		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
-		fakedbs.AddQueryPattern("show databases", showDatabasesResult)
 	}
+	route := proxy.Spanner().router
+	route.CreateDatabase("test")
+	route.CreateDatabase("test1")
 
 	// show databases.
 	{
@@ -257,8 +244,81 @@ func TestProxyShowDatabases(t *testing.T) {
 		query := "show databases"
 		qr, err := client.FetchAll(query, -1)
 		assert.Nil(t, err)
-		// the user with super privilege can see all databases.
-		assert.EqualValues(t, 2, len(qr.Rows))
+		// the user with super privilege can see all databases, the system databases included.
+		assert.EqualValues(t, 6, len(qr.Rows))
+	}
+}
+
+func TestProxyShowFilter(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create database test1",
+		"create table test.t1(a int, b int) partition by hash(a)",
+		"create table test.t2(a int, b int) global",
+		"create table test.t3(a int, b int) single",
+		"create table test.a1(a int, b int) global",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+	// The backends aren't touched.
+	fakedbs.ResetAll()
+
+	tests := []struct {
+		query  string
+		fields string
+		rows   string
+	}{
+		{"show databases like 'test%'", "Database (test%)", "[[test] [test1]]"},
+		{"show databases where `Database` in ('test1', 'mysql')", "Database", "[[mysql] [test1]]"},
+		{"show databases like 'test_' limit 1", "Database (test_)", "[[test1]]"},
+		{"show tables from test", "Tables_in_test", "[[a1] [t1] [t2] [t3]]"},
+		{"show tables from `test` like 't%'", "Tables_in_test (t%)", "[[t1] [t2] [t3]]"},
+		{"show tables from test like 't\\\\_%'", "Tables_in_test (t\\_%)", "[]"},
+		{"show tables from test like '_1'", "Tables_in_test (_1)", "[[a1] [t1]]"},
+		{"show full tables from test", "Tables_in_test,Table_type", "[[a1 GLOBAL] [t1 HASH] [t2 GLOBAL] [t3 SINGLE]]"},
+		{"show full tables from test where Table_type = 'GLOBAL' and Tables_in_test not like 'a%'", "Tables_in_test,Table_type", "[[t2 GLOBAL]]"},
+		{"show full tables from test where Table_type != 'GLOBAL' or Tables_in_test = 'a1'", "Tables_in_test,Table_type", "[[a1 GLOBAL] [t1 HASH] [t3 SINGLE]]"},
+		{"show tables from test limit 1, 2", "Tables_in_test", "[[t1] [t2]]"},
+		{"show tables from test limit 2 offset 3", "Tables_in_test", "[[t3]]"},
+		{"show tables from test1", "Tables_in_test1", "[]"},
+	}
+	for _, test := range tests {
+		qr, err := client.FetchAll(test.query, -1)
+		assert.Nil(t, err, test.query)
+		var fields []string
+		for _, field := range qr.Fields {
+			fields = append(fields, field.Name)
+		}
+		assert.Equal(t, test.fields, strings.Join(fields, ","), test.query)
+		assert.Equal(t, test.rows, fmt.Sprintf("%+v", qr.Rows), test.query)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"show tables from test where Table_type = 'HASH'",
+			"show full tables from test where length(Tables_in_test) = 2",
+			"show databases where `Database` =",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+		}
 	}
 }
 
@@ -271,8 +331,10 @@ func TestProxyShowDatabasesPrivilege(t *testing.T) {
 	// fakedbs.
 	{
 		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
-		fakedbs.AddQueryPattern("show databases", showDatabasesResult)
 	}
+	route := proxy.Spanner().router
+	route.CreateDatabase("test")
+	route.CreateDatabase("test1")
 
 	// show databases.
 	{
@@ -282,7 +344,7 @@ func TestProxyShowDatabasesPrivilege(t *testing.T) {
 		query := "show databases"
 		qr, err := client.FetchAll(query, -1)
 		assert.Nil(t, err)
-		assert.EqualValues(t, 2, len(qr.Rows))
+		assert.EqualValues(t, 6, len(qr.Rows))
 	}
 }
 
@@ -295,8 +357,10 @@ func TestProxyShowDatabasesPrivilegeDB(t *testing.T) {
 	// fakedbs.
 	{
 		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
-		fakedbs.AddQueryPattern("show databases", showDatabasesResult)
 	}
+	route := proxy.Spanner().router
+	route.CreateDatabase("test")
+	route.CreateDatabase("test1")
 
 	// show databases.
 	{
@@ -369,6 +433,7 @@ func TestProxyShowTables(t *testing.T) {
 	}
 
 	// show tables.
+	proxy.Spanner().router.CreateDatabase("test")
 	{
 		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
 		assert.Nil(t, err)
@@ -397,6 +462,16 @@ func TestProxyShowTables(t *testing.T) {
 		_, err = client.FetchAll(query, -1)
 		assert.NotNil(t, err)
 	}
+
+	// show tables error with unknown database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		query := "show tables from xx"
+		_, err = client.FetchAll(query, -1)
+		assert.Equal(t, "Unknown database 'xx' (errno 1049) (sqlstate 42000)", err.Error())
+	}
 }
 
 func TestProxyShowTableStatus(t *testing.T) {
@@ -454,6 +529,80 @@ func TestProxyShowTableStatus(t *testing.T) {
 	}
 }
 
+func TestLogicalCreateTable(t *testing.T) {
+	create := "CREATE TABLE `t1_0003` (\n" +
+		"  `id` bigint(20) NOT NULL AUTO_INCREMENT,\n" +
+		"  `t1_0003_b` int(11) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=17 DEFAULT CHARSET=utf8"
+	partitions := func(backends ...string) []*config.PartitionConfig {
+		parts := make([]*config.PartitionConfig, 0, len(backends))
+		for _, backend := range backends {
+			parts = append(parts, &config.PartitionConfig{Backend: backend})
+		}
+		return parts
+	}
+	backends := []string{"backend0", "backend1", "backend2"}
+	tests := []struct {
+		tconf      *config.TableConfig
+		typ        string
+		suffix     string
+		partitions int
+		backends   []string
+	}{
+		{
+			&config.TableConfig{ShardType: "HASH", ShardKey: "id", Partitions: partitions("backend0", "backend0", "backend1")},
+			sqlparser.PartitionTableType,
+			"\nPARTITION BY HASH(`id`) PARTITIONS 3",
+			3,
+			backends,
+		},
+		{
+			&config.TableConfig{ShardType: "GLOBAL", Partitions: partitions(backends...)},
+			sqlparser.GlobalTableType,
+			"\nGLOBAL",
+			0,
+			backends,
+		},
+		{
+			&config.TableConfig{ShardType: "SINGLE", Partitions: partitions("backend2")},
+			sqlparser.SingleTableType,
+			"\nSINGLE ON 'backend2'",
+			0,
+			[]string{"backend2"},
+		},
+	}
+	for _, test := range tests {
+		got := logicalCreateTable(create, "t1", test.tconf)
+		want := "CREATE TABLE `t1` (\n" +
+			"  `id` bigint(20) NOT NULL AUTO_INCREMENT,\n" +
+			"  `t1_0003_b` int(11) DEFAULT NULL,\n" +
+			"  PRIMARY KEY (`id`)\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8" + test.suffix
+		assert.Equal(t, want, got)
+
+		// Round trip through radon.
+		var ddl *sqlparser.DDL
+		node, err := sqlparser.Parse(got)
+		if err != nil {
+			node, err = parseCreateTable(got, err)
+		}
+		assert.Nil(t, err)
+		ddl = node.(*sqlparser.DDL)
+		assert.Equal(t, "t1", ddl.Table.Name.String())
+		assert.Equal(t, test.typ, ddl.TableSpec.Options.Type)
+		spec, err := planCreateTable(got, ddl, backends)
+		assert.Nil(t, err)
+		assert.Equal(t, test.tconf.ShardKey, spec.shardKey)
+		assert.Equal(t, test.partitions, spec.extra.Partitions)
+		assert.Equal(t, test.backends, spec.backends)
+	}
+
+	// The quoted segment name.
+	got := logicalCreateTable("create table `a``b_0000` (`id` int)", "a`b", &config.TableConfig{ShardType: "GLOBAL"})
+	assert.Equal(t, "create table `a``b` (`id` int)\nGLOBAL", got)
+}
+
 func TestProxyShowCreateTable(t *testing.T) {
 	r1 := &sqltypes.Result{
 		Fields: []*querypb.Field{
@@ -521,13 +670,13 @@ func TestProxyShowCreateTable(t *testing.T) {
 	{
 		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
 		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
-		fakedbs.AddQuerys("show create table test.t1_0000", r1)
+		fakedbs.AddQuerys("show create table `test`.`t1_0000`", r1)
 		fakedbs.AddQuerys("show create table test.t1", r1)
 		fakedbs.AddQuerys("show create table t1", r1)
 		fakedbs.AddQuerys("show create table MYSQL.t1", r1)
 		fakedbs.AddQuerys("show create table xxx.t1", r1)
-		fakedbs.AddQuerys("show create table test.g_t1", r2)
-		fakedbs.AddQuerys("show create table test.s_t1", r3)
+		fakedbs.AddQuerys("show create table `test`.`g_t1`", r2)
+		fakedbs.AddQuerys("show create table `test`.`s_t1`", r3)
 	}
 
 	// create database.
@@ -557,7 +706,7 @@ func TestProxyShowCreateTable(t *testing.T) {
 		query := "show create table test.t1"
 		qr, err := client.FetchAll(query, -1)
 		assert.Nil(t, err)
-		want := "[t1 create table t1\n/*!50100 PARTITION BY HASH (id) */]"
+		want := "[t1 create table `t1`\nPARTITION BY HASH(`id`) PARTITIONS 30]"
 		got := fmt.Sprintf("%+v", qr.Rows[0])
 		assert.Equal(t, want, got)
 	}
@@ -580,7 +729,7 @@ func TestProxyShowCreateTable(t *testing.T) {
 		query := "show create table test.g_t1"
 		qr, err := client.FetchAll(query, -1)
 		assert.Nil(t, err)
-		want := "[g_t1 create table g_t1\n/*!GLOBAL*/]"
+		want := "[g_t1 create table `g_t1`\nGLOBAL]"
 		got := fmt.Sprintf("%+v", qr.Rows[0])
 		assert.Equal(t, want, got)
 	}
@@ -603,7 +752,7 @@ func TestProxyShowCreateTable(t *testing.T) {
 		query := "show create table test.s_t1"
 		qr, err := client.FetchAll(query, -1)
 		assert.Nil(t, err)
-		want := "[s_t1 create table s_t1\n/*!SINGLE*/]"
+		want := "[s_t1 create table `s_t1`\nSINGLE ON 'backend0']"
 		got := fmt.Sprintf("%+v", qr.Rows[0])
 		assert.Equal(t, want, got)
 	}
@@ -738,7 +887,7 @@ func TestProxyShowColumns(t *testing.T) {
 		query := "show create table test.t1"
 		qr, err := client.FetchAll(query, -1)
 		assert.Nil(t, err)
-		want := "[t1 create table t1\n/*!50100 PARTITION BY HASH (id) */]"
+		want := "[t1 create table `t1`\nPARTITION BY HASH(`id`) PARTITIONS 30]"
 		got := fmt.Sprintf("%+v", qr.Rows[0])
 		assert.Equal(t, want, got)
 	}
@@ -950,6 +1099,77 @@ func TestProxyShowProcesslistPrivilege(t *testing.T) {
 	wg.Wait()
 }
 
+func TestProxyShowFullProcesslist(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select * .*", &sqltypes.Result{})
+		fakedbs.AddQueryDelay("select * from test.t1_0002 as t1", &sqltypes.Result{}, 2000)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	var wg sync.WaitGroup
+	slow, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer slow.Close()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := slow.FetchAll("select * from t1", -1)
+		assert.Nil(t, err)
+	}()
+	time.Sleep(time.Millisecond * 500)
+
+	qr, err := client.FetchAll("show full processlist", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, len(qr.Fields))
+	assert.Equal(t, "Backend_info", qr.Fields[15].Name)
+	executing, idle := 0, 0
+	for _, row := range qr.Rows {
+		switch row[7].String() {
+		case "select * from t1":
+			// The segment querys done are on the idle connections.
+			switch row[13].String() {
+			case "Query":
+				executing++
+				assert.Equal(t, "select * from test.t1_0002 as t1", row[15].String())
+			case "Sleep":
+				idle++
+			}
+		case "show full processlist":
+			assert.True(t, row[10].IsNull())
+		}
+	}
+	assert.Equal(t, 1, executing)
+	assert.True(t, idle > 0)
+
+	// SHOW PROCESSLIST has one row for every session.
+	{
+		qr, err := client.FetchAll("show processlist", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(qr.Fields))
+		assert.Equal(t, 2, len(qr.Rows))
+	}
+	wg.Wait()
+}
+
 func TestProxyShowStatus(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	fakedbs, proxy, cleanup := MockProxy(log)
@@ -1141,3 +1361,76 @@ func TestProxyShowTxnzPrivilege(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+func TestProxyShowFullColumns(t *testing.T) {
+	r := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Field", Type: querypb.Type_VARCHAR},
+			{Name: "Type", Type: querypb.Type_VARCHAR},
+			{Name: "Comment", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("b")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("int(11)")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("the b")),
+			},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show full columns from `test`.`t1_0000`.*", r)
+		fakedbs.AddQueryPattern("show columns from `test`.`t1_0000` where .*", &sqltypes.Result{Fields: r.Fields[:2]})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int comment 'the b') partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	tests := []struct {
+		query   string
+		backend string
+	}{
+		{"show full columns from t1", "SHOW FULL COLUMNS FROM `test`.`t1_0000`"},
+		{"SHOW FULL FIELDS IN t1 FROM test LIKE 'b%'", "SHOW FULL COLUMNS FROM `test`.`t1_0000` LIKE 'b%'"},
+		{"show full columns from `test`.`t1`;", "SHOW FULL COLUMNS FROM `test`.`t1_0000`"},
+	}
+	for _, test := range tests {
+		qr, err := client.FetchAll(test.query, -1)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, "[[b int(11) the b]]", fmt.Sprintf("%+v", qr.Rows), test.query)
+		assert.True(t, fakedbs.GetQueryCalledNum(test.backend) > 0, test.backend)
+	}
+
+	// The WHERE is sent to the backend.
+	{
+		qr, err := client.FetchAll("show columns from t1 where `Key` = 'PRI'", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(qr.Rows))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("SHOW COLUMNS FROM `test`.`t1_0000` where `Key` = 'PRI'"))
+	}
+
+	// Errors.
+	{
+		_, err := client.FetchAll("show full columns from t2", -1)
+		assert.NotNil(t, err)
+		_, err = client.FetchAll("show full columns from xxx.t1", -1)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+var (
+	// showTablesRegexp matches SHOW [FULL] TABLES [FROM db_name] [LIKE 'pattern' | WHERE expr] [LIMIT [offset,] row_count].
+	showTablesRegexp = regexp.MustCompile(`(?is)^show\s+(full\s+)?tables(?:\s+from\s+(\S+?))?` + showFilterPattern)
+	// showDatabasesRegexp matches SHOW DATABASES [EXTENDED] [LIKE 'pattern' | WHERE expr] [LIMIT [offset,] row_count].
+	showDatabasesRegexp = regexp.MustCompile(`(?is)^show\s+databases(\s+extended)?` + showFilterPattern)
+	// showFullProcesslistRegexp matches SHOW FULL PROCESSLIST, the parser supports the SHOW PROCESSLIST only.
+	showFullProcesslistRegexp = regexp.MustCompile(`(?is)^show\s+full\s+processlist\s*;?\s*$`)
+	// showColumnsRegexp matches SHOW [FULL] {COLUMNS | FIELDS} {FROM | IN} tbl_name [{FROM | IN} db_name] [LIKE 'pattern' | WHERE expr],
+	// the filter is sent to the backend since the columns of the segment are the same as the table.
+	showColumnsRegexp = regexp.MustCompile(`(?is)^show\s+(full\s+)?(?:columns|fields)\s+(?:from|in)\s+(\S+?)(?:\s+(?:from|in)\s+(\S+?))?(\s+(?:like|where)\s+.+?)?\s*;?\s*$`)
+)
+
+const showFilterPattern = `(?:\s+(like|where)\s+(.+?))?(?:\s+limit\s+(\d+)(?:\s*,\s*(\d+)|\s+offset\s+(\d+))?)?\s*;?\s*$`
+
+// isShowFilter returns true if the query is the SHOW TABLES/DATABASES with the LIKE, WHERE or LIMIT,
+// or the SHOW DATABASES EXTENDED, they are not supported by the parser.
+func isShowFilter(query string) bool {
+	for _, re := range []*regexp.Regexp{showTablesRegexp, showDatabasesRegexp} {
+		if matches := re.FindStringSubmatch(query); matches != nil {
+			if re == showDatabasesRegexp && matches[1] != "" {
+				return true
+			}
+			filter := matches[len(matches)-5:]
+			return filter[0] != "" || filter[2] != ""
+		}
+	}
+	return false
+}
+
+// showFilter is the filter of the SHOW TABLES/DATABASES served by the router metadata,
+// the rows are the names and the types of the metadata, the backends aren't touched.
+type showFilter struct {
+	// columns of the rows, the first is the name.
+	columns []string
+	// where is the LIKE or WHERE expr, nil if no filter.
+	where sqlparser.Expr
+	// like is the pattern of the LIKE, the first column is named as 'Tables_in_db (pattern)' like MySQL does.
+	like string
+	// the rows in [offset, offset+count) are returned, count is -1 if no limit.
+	offset, count int
+}
+
+// parseShowFilter parses the filter from the submatches of showFilterPattern:
+// kind, expr, limit, the row count of 'LIMIT offset, row_count' and the offset of 'LIMIT row_count OFFSET offset'.
+func parseShowFilter(columns []string, matches []string) (*showFilter, error) {
+	filter := &showFilter{columns: columns, count: -1}
+	kind, expr := strings.ToLower(matches[0]), matches[1]
+	if kind != "" {
+		if kind == "like" {
+			expr = fmt.Sprintf("%s like %s", sqlparser.Backtick(columns[0]), expr)
+		}
+		node, err := sqlparser.Parse("select 1 from dual where " + expr)
+		if err != nil {
+			return nil, err
+		}
+		filter.where = node.(*sqlparser.Select).Where.Expr
+		if kind == "like" {
+			cmp, ok := filter.where.(*sqlparser.ComparisonExpr)
+			if !ok {
+				return nil, errors.Errorf("unsupported: show.like.pattern[%s]", matches[1])
+			}
+			val, ok := cmp.Right.(*sqlparser.SQLVal)
+			if !ok || val.Type != sqlparser.StrVal {
+				return nil, errors.Errorf("unsupported: show.like.pattern[%s]", matches[1])
+			}
+			filter.like = string(val.Val)
+		}
+	}
+	if matches[2] != "" {
+		filter.count, _ = strconv.Atoi(matches[2])
+		switch {
+		case matches[3] != "":
+			filter.offset = filter.count
+			filter.count, _ = strconv.Atoi(matches[3])
+		case matches[4] != "":
+			filter.offset, _ = strconv.Atoi(matches[4])
+		}
+	}
+	return filter, nil
+}
+
+// name returns the name of the column i, the first is suffixed with the LIKE pattern.
+func (f *showFilter) name(i int) string {
+	if i == 0 && f.like != "" {
+		return fmt.Sprintf("%s (%s)", f.columns[0], f.like)
+	}
+	return f.columns[i]
+}
+
+// match returns true if the row passes the LIKE or WHERE filter.
+func (f *showFilter) match(row []string) (bool, error) {
+	if f.where == nil {
+		return true, nil
+	}
+	return f.evalBool(f.where, row)
+}
+
+// limit returns the rows in the LIMIT.
+func (f *showFilter) limit(rows [][]string) [][]string {
+	if f.offset >= len(rows) {
+		return nil
+	}
+	rows = rows[f.offset:]
+	if f.count >= 0 && f.count < len(rows) {
+		rows = rows[:f.count]
+	}
+	return rows
+}
+
+func (f *showFilter) evalBool(expr sqlparser.Expr, row []string) (bool, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, err := f.evalBool(expr.Left, row)
+		if err != nil || !left {
+			return false, err
+		}
+		return f.evalBool(expr.Right, row)
+	case *sqlparser.OrExpr:
+		left, err := f.evalBool(expr.Left, row)
+		if err != nil || left {
+			return left, err
+		}
+		return f.evalBool(expr.Right, row)
+	case *sqlparser.NotExpr:
+		ok, err := f.evalBool(expr.Expr, row)
+		return !ok, err
+	case *sqlparser.ParenExpr:
+		return f.evalBool(expr.Expr, row)
+	case *sqlparser.ComparisonExpr:
+		left, err := f.evalValue(expr.Left, row)
+		if err != nil {
+			return false, err
+		}
+		switch expr.Operator {
+		case sqlparser.InStr, sqlparser.NotInStr:
+			tuple, ok := expr.Right.(sqlparser.ValTuple)
+			if !ok {
+				return false, errors.Errorf("unsupported: show.filter.expr[%s]", sqlparser.String(expr))
+			}
+			for _, e := range tuple {
+				val, err := f.evalValue(e, row)
+				if err != nil {
+					return false, err
+				}
+				if val == left {
+					return expr.Operator == sqlparser.InStr, nil
+				}
+			}
+			return expr.Operator == sqlparser.NotInStr, nil
+		}
+		right, err := f.evalValue(expr.Right, row)
+		if err != nil {
+			return false, err
+		}
+		switch expr.Operator {
+		case sqlparser.EqualStr:
+			return left == right, nil
+		case sqlparser.NotEqualStr:
+			return left != right, nil
+		case sqlparser.LessThanStr:
+			return left < right, nil
+		case sqlparser.LessEqualStr:
+			return left <= right, nil
+		case sqlparser.GreaterThanStr:
+			return left > right, nil
+		case sqlparser.GreaterEqualStr:
+			return left >= right, nil
+		case sqlparser.LikeStr, sqlparser.NotLikeStr:
+			ok := likeRegexp(right).MatchString(left)
+			return ok == (expr.Operator == sqlparser.LikeStr), nil
+		}
+	}
+	return false, errors.Errorf("unsupported: show.filter.expr[%s]", sqlparser.String(expr))
+}
+
+func (f *showFilter) evalValue(expr sqlparser.Expr, row []string) (string, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.ColName:
+		for i, column := range f.columns {
+			if strings.EqualFold(column, expr.Name.String()) {
+				return row[i], nil
+			}
+		}
+		return "", errors.Errorf("unsupported: unknown.column.'%s'.in.show.filter", expr.Name.String())
+	case *sqlparser.SQLVal:
+		switch expr.Type {
+		case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+			return string(expr.Val), nil
+		}
+	}
+	return "", errors.Errorf("unsupported: show.filter.expr[%s]", sqlparser.String(expr))
+}
+
+// likeRegexp returns the regexp of the LIKE pattern, '%' matches any string, '_' matches any character
+// and '\' escapes the next one.
+func likeRegexp(pattern string) *regexp.Regexp {
+	var buf strings.Builder
+	buf.WriteString("(?s)^")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '%':
+			buf.WriteString(".*")
+		case c == '_':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if escaped {
+		buf.WriteString(regexp.QuoteMeta("\\"))
+	}
+	buf.WriteString("$")
+	return regexp.MustCompile(buf.String())
+}
@@ -0,0 +1,70 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyShowFilterParse(t *testing.T) {
+	tests := []struct {
+		query  string
+		ok     bool
+		offset int
+		count  int
+	}{
+		{"show tables", false, 0, -1},
+		{"show full tables from test", false, 0, -1},
+		{"show tables like 't%'", true, 0, -1},
+		{"show full tables from `test` where Table_type = 'HASH' limit 10", true, 0, 10},
+		{"SHOW DATABASES LIMIT 5, 10", true, 5, 10},
+		{"show databases like 'a' limit 10 offset 20", true, 20, 10},
+		{"show databases extended", true, 0, -1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.ok, isShowFilter(test.query), test.query)
+		matches := showTablesRegexp.FindStringSubmatch(test.query)
+		if matches != nil {
+			matches = matches[3:]
+		} else {
+			matches = showDatabasesRegexp.FindStringSubmatch(test.query)[2:]
+		}
+		filter, err := parseShowFilter([]string{"name"}, matches)
+		assert.Nil(t, err)
+		assert.Equal(t, test.offset, filter.offset, test.query)
+		assert.Equal(t, test.count, filter.count, test.query)
+	}
+
+	// The LIKE pattern must be the string.
+	_, err := parseShowFilter([]string{"name"}, []string{"like", "1", "", "", ""})
+	assert.Equal(t, "unsupported: show.like.pattern[1]", err.Error())
+}
+
+func TestProxyLikeRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"t%", "t1", true},
+		{"t%", "a1", false},
+		{"t_", "t1", true},
+		{"t_", "t12", false},
+		{"t\\_%", "t_1", true},
+		{"t\\_%", "t11", false},
+		{"a.b", "axb", false},
+		{"%\\", "a\\", true},
+		{"", "", true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.match, likeRegexp(test.pattern).MatchString(test.s), test.pattern)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"backend"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// SingleMove tuple, the result of moving the SINGLE table.
+type SingleMove struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Rows     int    `json:"rows"`
+}
+
+// MoveSingleTable used to move the SINGLE table to the backend, the table is created on the backend and the rows are copied,
+// then the rule is shifted to the backend and the table on the old backend is dropped.
+// The writes to the table during the moving are lost, it should be done in the maintenance window.
+func (spanner *Spanner) MoveSingleTable(database string, table string, to string) (*SingleMove, error) {
+	log := spanner.log
+	route := spanner.router
+	scatter := spanner.scatter
+
+	tconf, err := route.TableConfig(database, table)
+	if err != nil {
+		return nil, err
+	}
+	if tconf.ShardType != "SINGLE" || len(tconf.Partitions) != 1 {
+		return nil, errors.Errorf("spanner.move.single.table[%s.%s].is.not.the.single.table", database, table)
+	}
+	from := tconf.Partitions[0].Backend
+	if from == to {
+		return nil, errors.Errorf("spanner.move.single.table[%s.%s].already.on.the.backend[%s]", database, table, to)
+	}
+	found := false
+	for _, backend := range scatter.Backends() {
+		if backend == to {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.Errorf("spanner.move.single.table.backend[%s].not.exists", to)
+	}
+	pool, ok := scatter.PoolClone()[from]
+	if !ok {
+		return nil, errors.Errorf("spanner.move.single.table.can.not.find.backend[%s]", from)
+	}
+
+	move := &SingleMove{Database: database, Table: table, From: from, To: to}
+	log.Warning("spanner.move.single.table[%s.%s].from[%s].to[%s].prepare", database, table, from, to)
+	name := fmt.Sprintf("%s.%s", sqlparser.Backtick(database), sqlparser.Backtick(table))
+	qr, err := spanner.ExecuteOnThisBackend(from, fmt.Sprintf("show create table %s", name))
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) == 0 || len(qr.Rows[0]) < 2 {
+		return nil, errors.Errorf("spanner.move.single.table[%s.%s].show.create.table.is.empty", database, table)
+	}
+	create := strings.Replace(qr.Rows[0][1].String(), sqlparser.Backtick(table), name, 1)
+	if _, err := spanner.ExecuteOnThisBackend(to, fmt.Sprintf("create database if not exists %s", sqlparser.Backtick(database))); err != nil {
+		return nil, err
+	}
+	if _, err := spanner.ExecuteOnThisBackend(to, create); err != nil {
+		return nil, err
+	}
+	// dropOn used to drop the table on the backend, the errors are only logged.
+	dropOn := func(on string) {
+		if _, err := spanner.ExecuteOnThisBackend(on, fmt.Sprintf("drop table if exists %s", name)); err != nil {
+			log.Error("spanner.move.single.table[%s.%s].drop.on[%s].error:%+v", database, table, on, err)
+		}
+	}
+
+	if move.Rows, err = spanner.copySingleRows(pool, name, to); err != nil {
+		log.Error("spanner.move.single.table[%s.%s].copy.to[%s].error:%+v", database, table, to, err)
+		dropOn(to)
+		return nil, err
+	}
+	if err := route.PartitionRuleShift(from, to, database, table); err != nil {
+		log.Error("spanner.move.single.table[%s.%s].shift.to[%s].error:%+v", database, table, to, err)
+		dropOn(to)
+		return nil, err
+	}
+	dropOn(from)
+	spanner.autoAnalyze(database, table)
+	log.Warning("spanner.move.single.table[%s.%s].from[%s].to[%s].rows[%d].done", database, table, from, to, move.Rows)
+	return move, nil
+}
+
+// copySingleRows used to copy the rows of the table from the pool to the backend, the rows are inserted in batches.
+func (spanner *Spanner) copySingleRows(pool *backend.Pool, name string, to string) (int, error) {
+	var buf bytes.Buffer
+	rows, batch := 0, 0
+	flush := func() error {
+		if batch == 0 {
+			return nil
+		}
+		if _, err := spanner.ExecuteOnThisBackend(to, fmt.Sprintf("insert into %s values %s", name, buf.String())); err != nil {
+			return err
+		}
+		buf.Reset()
+		batch = 0
+		return nil
+	}
+	err := streamRows(pool, fmt.Sprintf("select * from %s", name), func(row []sqltypes.Value) error {
+		if batch > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('(')
+		for i, v := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			v.EncodeSQL(&buf)
+		}
+		buf.WriteByte(')')
+		batch++
+		rows++
+		if batch == backupBatchRows {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
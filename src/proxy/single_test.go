@@ -0,0 +1,113 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyMoveSingleTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	spanner := proxy.Spanner()
+	route := proxy.Router()
+
+	createResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "Table", Type: querypb.Type_VARCHAR},
+			{Name: "Create Table", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("s1")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("CREATE TABLE `s1` (\n  `id` int(11) DEFAULT NULL\n) ENGINE=InnoDB")),
+			},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create table .*", createResult)
+		fakedbs.AddQueryPattern("select \\* from .*", fakedb.Result1)
+		fakedbs.AddQueryPattern("insert into .*", &sqltypes.Result{RowsAffected: 2})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		querys := []string{
+			"create database test",
+			"create table test.s1(id int, name varchar(10)) single on 'backend1'",
+			"create table test.t1(id int, b int) partition by hash(id)",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+	}
+
+	// Move.
+	{
+		move, err := spanner.MoveSingleTable("test", "s1", "backend3")
+		assert.Nil(t, err)
+		assert.Equal(t, &SingleMove{Database: "test", Table: "s1", From: "backend1", To: "backend3", Rows: 2}, move)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create table `test`.`s1` (\n  `id` int(11) default null\n) engine=innodb"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("insert into `test`.`s1` values (11,'1nice name'),(12,null)"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("drop table if exists `test`.`s1`"))
+
+		tconf, err := route.TableConfig("test", "s1")
+		assert.Nil(t, err)
+		assert.Equal(t, "backend3", tconf.Partitions[0].Backend)
+	}
+
+	// Errors.
+	{
+		tests := []struct {
+			table string
+			to    string
+			err   string
+		}{
+			{"s1", "backend3", "spanner.move.single.table[test.s1].already.on.the.backend[backend3]"},
+			{"s1", "backend9", "spanner.move.single.table.backend[backend9].not.exists"},
+			{"t1", "backend3", "spanner.move.single.table[test.t1].is.not.the.single.table"},
+			{"s2", "backend3", "Table 's2' doesn't exist (errno 1146) (sqlstate 42S02)"},
+		}
+		for _, test := range tests {
+			_, err := spanner.MoveSingleTable("test", test.table, test.to)
+			assert.Equal(t, test.err, err.Error(), test.table)
+		}
+	}
+
+	// The copy fails, the table on the backend is dropped and the rule isn't shifted.
+	{
+		fakedbs.AddQueryErrorPattern("insert into .*", errors.New("mock.insert.error"))
+		_, err := spanner.MoveSingleTable("test", "s1", "backend2")
+		assert.NotNil(t, err)
+		assert.Equal(t, 2, fakedbs.GetQueryCalledNum("drop table if exists `test`.`s1`"))
+
+		tconf, err := route.TableConfig("test", "s1")
+		assert.Nil(t, err)
+		assert.Equal(t, "backend3", tconf.Partitions[0].Backend)
+	}
+}
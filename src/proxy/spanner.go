@@ -19,13 +19,16 @@ import (
 	"xbase/sync2"
 
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
 // Spanner tuple.
 type Spanner struct {
 	log           *xlog.Log
+	proxy         *Proxy
 	audit         *audit.Audit
+	access        *audit.Access // nil means the access log disabled.
 	conf          *config.Config
 	router        *router.Router
 	scatter       *backend.Scatter
@@ -35,23 +38,39 @@ type Spanner struct {
 	plugins       *plugins.Plugin
 	diskChecker   *DiskCheck
 	manager       *Manager
+	scheduler     *Scheduler
+	rollups       *Rollups
+	advisor       *Advisor
+	analyzer      *Analyzer
+	quotas        *Quotas
+	coalescer     *Coalescer
+	ddlLog        *DDLLog
+	ddlJournal    *DDLJournal
+	reshards      *Reshards
+	workloads     *Workloads
 	readonly      sync2.AtomicBool
 	serverVersion string
 }
 
 // NewSpanner creates a new spanner.
 func NewSpanner(log *xlog.Log, conf *config.Config,
-	iptable *IPTable, router *router.Router, scatter *backend.Scatter, sessions *Sessions, audit *audit.Audit, throttle *xbase.Throttle, plugins *plugins.Plugin, serverVersion string) *Spanner {
+	iptable *IPTable, router *router.Router, scatter *backend.Scatter, sessions *Sessions, audit *audit.Audit, access *audit.Access, throttle *xbase.Throttle, plugins *plugins.Plugin, serverVersion string) *Spanner {
 	return &Spanner{
 		log:           log,
 		conf:          conf,
 		audit:         audit,
+		access:        access,
 		iptable:       iptable,
 		router:        router,
 		scatter:       scatter,
 		sessions:      sessions,
 		throttle:      throttle,
 		plugins:       plugins,
+		workloads:     NewWorkloads(log, conf.Proxy),
+		coalescer:     NewCoalescer(),
+		ddlLog:        NewDDLLog(),
+		ddlJournal:    NewDDLJournal(log, conf.Proxy.DDLJournalDir),
+		reshards:      NewReshards(),
 		serverVersion: serverVersion,
 	}
 }
@@ -67,22 +86,79 @@ func (spanner *Spanner) Init() error {
 	}
 	spanner.diskChecker = diskChecker
 
-	mgr := NewManager(log, spanner.sessions, conf.Proxy)
+	mgr := NewManager(log, spanner.sessions, spanner.scatter, spanner.router, conf.Proxy)
 	if err := mgr.Init(); err != nil {
 		return err
 	}
 	spanner.manager = mgr
+
+	rollups := NewRollups(log, spanner, conf.Proxy.Rollups)
+	scheduler := NewScheduler(log, spanner, conf.Proxy.Jobs)
+	rollups.Register(scheduler)
+	advisor := NewAdvisor(log, spanner, conf.Proxy.Advisor)
+	advisor.Register(scheduler)
+	if err := scheduler.Init(); err != nil {
+		return err
+	}
+	spanner.scheduler = scheduler
+	spanner.rollups = rollups
+	spanner.advisor = advisor
+
+	analyzer := NewAnalyzer(log, spanner, conf.Proxy)
+	analyzer.Init()
+	spanner.analyzer = analyzer
+
+	quotas := NewQuotas(log, spanner, conf.Proxy)
+	quotas.Init()
+	spanner.quotas = quotas
+
+	if err := spanner.ddlJournal.Init(); err != nil {
+		return err
+	}
+	if conf.Proxy.DDLJournalReplay {
+		spanner.replayDDLJournal()
+	}
 	return nil
 }
 
 // Close used to close spanner.
 func (spanner *Spanner) Close() error {
+	spanner.reshards.Close()
+	spanner.scheduler.Close()
+	spanner.analyzer.Close()
+	spanner.quotas.Close()
 	spanner.diskChecker.Close()
 	spanner.manager.Close()
 	spanner.log.Info("spanner.closed...")
 	return nil
 }
 
+// Scheduler returns the scheduler of the jobs.
+func (spanner *Spanner) Scheduler() *Scheduler {
+	return spanner.scheduler
+}
+
+// Advisor returns the index advisor.
+func (spanner *Spanner) Advisor() *Advisor {
+	return spanner.advisor
+}
+
+// SetClock used to set the clock of the sessions, the workloads, the scheduler, the analyzer, the quotas and the backends.
+func (spanner *Spanner) SetClock(clock xbase.Clock) {
+	spanner.sessions.SetClock(clock)
+	spanner.workloads.SetClock(clock)
+	spanner.scatter.SetClock(clock)
+	if spanner.scheduler != nil {
+		spanner.scheduler.SetClock(clock)
+	}
+	if spanner.analyzer != nil {
+		spanner.analyzer.SetClock(clock)
+	}
+	if spanner.quotas != nil {
+		spanner.quotas.SetClock(clock)
+	}
+}
+
 // ReadOnly returns the readonly or not.
 func (spanner *Spanner) ReadOnly() bool {
 	return spanner.readonly.Get()
@@ -103,9 +179,11 @@ func (spanner *Spanner) SessionClosed(s *driver.Session) {
 	spanner.sessions.Remove(s)
 }
 
-// SessionInc increase client connection metrics, it need the user is assigned
+// SessionInc increase client connection metrics, it need the user is assigned.
+// The state migrated from the other radon is restored here after the login.
 func (spanner *Spanner) SessionInc(s *driver.Session) {
 	monitor.ClientConnectionInc(s.User())
+	spanner.restoreSession(s)
 }
 
 // SessionDec decrease client connection metrics.
@@ -124,3 +202,18 @@ func (spanner *Spanner) ServerVersion() string {
 func (spanner *Spanner) isTwoPC() bool {
 	return spanner.conf.Proxy.TwopcEnable
 }
+
+// maxResultSize returns the max result size of the query by its workload class.
+func (spanner *Spanner) maxResultSize(user string, node sqlparser.Statement) int {
+	return spanner.workloads.MaxResultSize(spanner.workloads.Classify(user, node))
+}
+
+// maxResultRows returns the max result rows limits of the user,
+// the user-max-result-rows overrides the global max-result-rows.
+func (spanner *Spanner) maxResultRows(user string) int {
+	conf := spanner.conf.Proxy
+	if rows, ok := conf.UserMaxResultRows[user]; ok {
+		return rows
+	}
+	return conf.MaxResultRows
+}
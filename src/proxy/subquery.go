@@ -0,0 +1,39 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"planner"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// subqueryRewrite used to execute the uncorrelated IN and EXISTS subqueries of the select first and replace them by
+// their results, so the select is planned with the constant values and routed to the segments of them.
+// The subqueries are executed by the session as the normal selects, in its transaction if there's one.
+func (spanner *Spanner) subqueryRewrite(session *driver.Session, database string, node sqlparser.Statement) error {
+	log := spanner.log
+	sel, ok := node.(*sqlparser.Select)
+	if !ok {
+		return nil
+	}
+	for _, sub := range planner.Subqueries(sel) {
+		query := sub.Query()
+		qr, err := spanner.ExecuteDML(session, database, query, sub.Select)
+		if err != nil {
+			log.Error("spanner.subquery[%s].error:%v", query, err)
+			return err
+		}
+		if err := sub.Bind(qr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxySubquery(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+
+	idResult := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("7"))},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select id from test.t2_.*", idResult)
+		fakedbs.AddQueryPattern("select 1 from test.t2_.*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+		"create table test.t2(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// segmentOf returns the segment of the id.
+	segmentOf := func(id string) string {
+		val := sqlparser.NewIntVal([]byte(id))
+		segments, err := route.Lookup("test", "t1", val, val)
+		assert.Nil(t, err)
+		return segments[0].Table
+	}
+
+	// The select is routed by the values of the IN subquery.
+	{
+		_, err := client.FetchAll("select * from test.t1 where id in (select id from test.t2 where b=1)", -1)
+		assert.Nil(t, err)
+		backend := fmt.Sprintf("select * from test.%s as t1 where id in (7)", segmentOf("7"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+	}
+
+	// The EXISTS subquery and the empty result.
+	{
+		querys := []string{
+			"select * from test.t1 where b=2 and exists (select 1 from test.t2 where b=2)",
+			"select * from test.t1 where id=7 or id not in (select 1 from test.t2)",
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query, -1)
+			assert.Nil(t, err, query)
+		}
+		backend := fmt.Sprintf("select * from test.%s as t1 where b = 2 and false", segmentOf("7"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+	}
+
+	// The subquery correlated on the shard key is pushed down to the segments.
+	{
+		_, err := client.FetchAll("select * from test.t1 where id=7 and exists (select 1 from test.t2 where t2.id=t1.id)", -1)
+		assert.Nil(t, err)
+		segment := segmentOf("7")
+		backend := fmt.Sprintf("select * from test.%s as t1 where id = 7 and exists (select 1 from test.%s as t2 where t2.id = t1.id)", segment, "t2"+segment[len("t1"):])
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(backend), backend)
+	}
+
+	// The subquery correlated on the other columns is unsupported.
+	{
+		_, err := client.FetchAll("select * from test.t1 where exists (select 1 from test.t2 where t2.b=t1.b)", -1)
+		assert.NotNil(t, err)
+	}
+
+	// The error of the subquery.
+	{
+		fakedbs.AddQueryErrorPattern("select id from test.t2_.*", errors.New("mock.subquery.select.error"))
+		_, err := client.FetchAll("select * from test.t1 where id in (select id from test.t2)", -1)
+		assert.NotNil(t, err)
+		fakedbs.ResetPatternErrors()
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"config"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+var (
+	createTriggerRegexp = regexp.MustCompile("(?is)^create\\s+(definer\\s*=\\s*\\S+\\s+)?trigger\\s+(`?(\\w+)`?\\s*\\.\\s*)?`?(\\w+)`?\\s+(before|after)\\s+(insert|update|delete)\\s+on\\s+(`?(\\w+)`?\\s*\\.\\s*)?`?(\\w+)`?\\s+for\\s+each\\s+row\\s+(.+)$")
+	dropTriggerRegexp   = regexp.MustCompile("(?is)^drop\\s+trigger\\s+(if\\s+exists\\s+)?(`?(\\w+)`?\\s*\\.\\s*)?`?(\\w+)`?$")
+
+	// The trigger order refers to the other triggers by name, it can't be kept per segment.
+	triggerOrderRegexp = regexp.MustCompile(`(?is)^(follows|precedes)\s`)
+)
+
+// isTrigger returns true if the query is a CREATE TRIGGER or DROP TRIGGER statement, they are not supported by the parser.
+func isTrigger(query string) bool {
+	if matches := createTriggerRegexp.FindStringSubmatch(query); matches != nil {
+		return !triggerOrderRegexp.MatchString(matches[10])
+	}
+	return dropTriggerRegexp.MatchString(query)
+}
+
+// handleTrigger used to handle the CREATE TRIGGER and DROP TRIGGER on the radon tables.
+// The trigger is created on every segment of the table, it's named with the segment suffix,
+// such as 'trg1_0001' on the segment 't1_0001', and recorded in the table metadata.
+// The triggers are dropped by the backends with the segments when the table is dropped.
+func (spanner *Spanner) handleTrigger(session *driver.Session, query string) (*sqltypes.Result, error) {
+	router := spanner.router
+	privilegePlug := spanner.plugins.PlugPrivilege()
+
+	var db, name string
+	create := createTriggerRegexp.FindStringSubmatch(query)
+	drop := dropTriggerRegexp.FindStringSubmatch(query)
+	if create != nil {
+		db, name = create[3], create[4]
+		if db == "" {
+			db = create[8]
+		}
+	} else {
+		db, name = drop[3], drop[4]
+	}
+	if db == "" {
+		db = session.Schema()
+	}
+	if db == "" {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+	}
+
+	if err := router.DatabaseACL(db); err != nil {
+		return nil, err
+	}
+	if !privilegePlug.CheckPrivilege(db, session.User(), &sqlparser.DDL{}) {
+		return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'@'%%' to database '%v'", session.User(), db)
+	}
+	if spanner.ReadOnly() {
+		return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+	}
+	txSession := spanner.sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
+	}
+
+	if create != nil {
+		trigger := &config.TriggerConfig{
+			Name:   name,
+			Timing: strings.ToUpper(create[5]),
+			Event:  strings.ToUpper(create[6]),
+			Body:   create[10],
+		}
+		return spanner.createTrigger(db, create[9], create[1], trigger)
+	}
+	return spanner.dropTrigger(db, name, drop[1] != "")
+}
+
+// createTrigger creates the trigger on all the segments, the metadata is changed only if all of them succeed.
+func (spanner *Spanner) createTrigger(db string, table string, definer string, trigger *config.TriggerConfig) (*sqltypes.Result, error) {
+	router := spanner.router
+
+	if _, err := router.TriggerTable(db, trigger.Name); err == nil {
+		return nil, sqldb.NewSQLError(sqldb.ER_TRG_ALREADY_EXISTS)
+	}
+	if err := checkBaseTable(router, db, table); err != nil {
+		return nil, err
+	}
+	segments, err := router.GetSegments(db, table, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var querys []xcontext.QueryTuple
+	for _, segment := range segments {
+		query := fmt.Sprintf("create %strigger %s.%s %s %s on %s.%s for each row %s", definer,
+			sqlparser.Backtick(db), sqlparser.Backtick(trigger.Name+strings.TrimPrefix(segment.Table, table)),
+			trigger.Timing, trigger.Event, sqlparser.Backtick(db), sqlparser.Backtick(segment.Table), trigger.Body)
+		querys = append(querys, xcontext.QueryTuple{Query: query, Backend: segment.Backend, Table: segment.Table})
+	}
+	if err := spanner.executeSegmentsDDL(querys); err != nil {
+		return nil, err
+	}
+	if err := router.CreateTrigger(db, table, trigger); err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// dropTrigger drops the trigger from all the segments, the segments lack of it are skipped.
+func (spanner *Spanner) dropTrigger(db string, name string, ifExists bool) (*sqltypes.Result, error) {
+	router := spanner.router
+
+	table, err := router.TriggerTable(db, name)
+	if err != nil {
+		if ifExists {
+			return &sqltypes.Result{Warnings: 1}, nil
+		}
+		return nil, err
+	}
+	segments, err := router.GetSegments(db, table, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var querys []xcontext.QueryTuple
+	for _, segment := range segments {
+		query := fmt.Sprintf("drop trigger if exists %s.%s", sqlparser.Backtick(db), sqlparser.Backtick(name+strings.TrimPrefix(segment.Table, table)))
+		querys = append(querys, xcontext.QueryTuple{Query: query, Backend: segment.Backend, Table: segment.Table})
+	}
+	if err := spanner.executeSegmentsDDL(querys); err != nil {
+		return nil, err
+	}
+	if err := router.DropTrigger(db, name); err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// executeSegmentsDDL executes the per-segment querys of the triggers and views with the ddl timeout.
+func (spanner *Spanner) executeSegmentsDDL(querys []xcontext.QueryTuple) error {
+	txn, err := spanner.scatter.CreateTransaction()
+	if err != nil {
+		spanner.log.Error("spanner.execute.trigger.txn.create.error:[%v]", err)
+		return err
+	}
+	defer txn.Finish()
+
+	txn.SetTimeout(spanner.conf.Proxy.DDLTimeout)
+	rctx := &xcontext.RequestContext{
+		Mode:   xcontext.ReqNormal,
+		Querys: querys,
+	}
+	_, err = txn.Execute(rctx)
+	return err
+}
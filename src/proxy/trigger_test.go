@@ -0,0 +1,100 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyTrigger(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("drop .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create database test", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	// Created on every segment.
+	{
+		_, err := client.FetchAll("CREATE DEFINER=`root`@`%` TRIGGER test.trg1 BEFORE INSERT ON `t1` FOR EACH ROW SET new.b=1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create definer=`root`@`%` trigger `test`.`trg1_0000` BEFORE INSERT on `test`.`t1_0000` for each row SET new.b=1"))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create definer=`root`@`%` trigger `test`.`trg1_0029` BEFORE INSERT on `test`.`t1_0029` for each row SET new.b=1"))
+
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		want := []*config.TriggerConfig{{Name: "trg1", Timing: "BEFORE", Event: "INSERT", Body: "SET new.b=1"}}
+		assert.Equal(t, want, tconf.Triggers)
+	}
+
+	// Errors.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{
+				"create trigger test.trg1 after update on test.t1 for each row set @a=1",
+				"Trigger already exists (errno 1359) (sqlstate HY000)",
+			},
+			{
+				"create trigger trg2 after update on t1 for each row set @a=1",
+				"No database selected (errno 1046) (sqlstate 3D000)",
+			},
+			{
+				"create trigger test.trg2 after update on test.t2 for each row set @a=1",
+				"Table 't2' doesn't exist (errno 1146) (sqlstate 42S02)",
+			},
+			{
+				"drop trigger test.trg2",
+				"Trigger does not exist (errno 1360) (sqlstate HY000)",
+			},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			assert.Equal(t, query.err, err.Error())
+		}
+	}
+
+	// Dropped from every segment.
+	{
+		_, err := client.FetchAll("drop trigger test.trg1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("drop trigger if exists `test`.`trg1_0029`"))
+
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Nil(t, tconf.Triggers)
+
+		_, err = client.FetchAll("drop trigger if exists test.trg1", -1)
+		assert.Nil(t, err)
+	}
+}
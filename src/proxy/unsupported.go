@@ -0,0 +1,76 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"regexp"
+
+	"monitor"
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/sqldb"
+)
+
+// unsupportedSQL is a construct known to be unsupported, the limitation and the workaround
+// are returned instead of the syntax error.
+type unsupportedSQL struct {
+	construct  string
+	regexp     *regexp.Regexp
+	limitation string
+	workaround string
+}
+
+var (
+	// The first matched wins, the recursive cte must be before the cte.
+	unsupportedSQLs = []unsupportedSQL{
+		{
+			construct:  "procedure",
+			regexp:     regexp.MustCompile(`(?is)^((create|alter|drop)\s+(definer\s*=\s*\S+\s+)?(procedure|function)|call)\s`),
+			limitation: "stored procedures and functions are not supported",
+			workaround: "move the routine logic to the application",
+		},
+		{
+			construct:  "trigger",
+			regexp:     regexp.MustCompile(`(?is)^(create|drop)\s+(definer\s*=\s*\S+\s+)?trigger\s`),
+			limitation: "only the triggers FOR EACH ROW without the order are supported on the radon tables",
+			workaround: "move the trigger logic to the application",
+		},
+		{
+			construct:  "event",
+			regexp:     regexp.MustCompile(`(?is)^(create|alter|drop)\s+(definer\s*=\s*\S+\s+)?event\s`),
+			limitation: "events are not supported",
+			workaround: "schedule the job outside radon, such as cron",
+		},
+		{
+			construct:  "recursive cte",
+			regexp:     regexp.MustCompile(`(?is)^with\s+recursive\s`),
+			limitation: "recursive common table expressions are not supported",
+			workaround: "iterate the query in the application",
+		},
+		{
+			construct:  "cte",
+			regexp:     regexp.MustCompile(`(?is)^with\s`),
+			limitation: "common table expressions are not supported",
+			workaround: "split the query, or rewrite the expression as a subquery",
+		},
+	}
+)
+
+// unsupportedSQLError returns the radon error describing the limitation and the workaround if the query
+// is a known-unsupported construct, the construct is counted by the monitor. It returns nil for the others.
+func unsupportedSQLError(query string) *sqldb.SQLError {
+	for _, unsupported := range unsupportedSQLs {
+		if unsupported.regexp.MatchString(query) {
+			monitor.UnsupportedSQLInc(unsupported.construct)
+			return xbase.NewRadonError(xbase.ER_RADON_UNSUPPORTED_SQL, "Unsupported %s: %s, workaround: %s",
+				unsupported.construct, unsupported.limitation, unsupported.workaround)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyUnsupportedSQL(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	querys := []struct {
+		query string
+		err   string
+	}{
+		{
+			"create procedure p1() begin select 1; end",
+			"Unsupported procedure: stored procedures and functions are not supported, workaround: move the routine logic to the application (errno 9003) (sqlstate HY000)",
+		},
+		{
+			"CREATE DEFINER=`root`@`%` FUNCTION f1() RETURNS int RETURN 1",
+			"Unsupported procedure: stored procedures and functions are not supported, workaround: move the routine logic to the application (errno 9003) (sqlstate HY000)",
+		},
+		{
+			"call p1()",
+			"Unsupported procedure: stored procedures and functions are not supported, workaround: move the routine logic to the application (errno 9003) (sqlstate HY000)",
+		},
+		{
+			"create trigger trg1 before insert on t1 for each row follows trg0 set @a=1",
+			"Unsupported trigger: only the triggers FOR EACH ROW without the order are supported on the radon tables, workaround: move the trigger logic to the application (errno 9003) (sqlstate HY000)",
+		},
+		{
+			"drop event if exists e1",
+			"Unsupported event: events are not supported, workaround: schedule the job outside radon, such as cron (errno 9003) (sqlstate HY000)",
+		},
+		{
+			"with recursive c(n) as (select 1 union all select n+1 from c where n<3) select * from c",
+			"Unsupported recursive cte: recursive common table expressions are not supported, workaround: iterate the query in the application (errno 9003) (sqlstate HY000)",
+		},
+		{
+			"with c as (select 1) select * from c",
+			"Unsupported cte: common table expressions are not supported, workaround: split the query, or rewrite the expression as a subquery (errno 9003) (sqlstate HY000)",
+		},
+		{
+			"select * frm t1",
+			"You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use, syntax error at position 13 near 'frm' (errno 1149) (sqlstate 42000)",
+		},
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query.query, -1)
+		assert.NotNil(t, err, query.query)
+		assert.Equal(t, query.err, err.Error())
+	}
+}
@@ -9,7 +9,10 @@
 package proxy
 
 import (
+	"config"
+
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
@@ -19,15 +22,60 @@ import (
 func (spanner *Spanner) handleUseDB(session *driver.Session, query string, node *sqlparser.Use) (*sqltypes.Result, error) {
 	usedb := node
 	db := usedb.DBName.String()
+	if err := spanner.useDatabase(session, db, query); err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// useDatabase used to check and set the session database, it's shared by USE and COM_INIT_DB.
+// The database unknown to radon is handled by the unknown-db-policy:
+// backend: the USE is sent to one backend, the database is used as the backend does.
+// import: the USE is sent to all the backends, then the database is imported into the metadata.
+// error: the unknown database error is returned.
+func (spanner *Spanner) useDatabase(session *driver.Session, db string, query string) error {
+	log := spanner.log
 	router := spanner.router
+
 	// Check the database ACL.
 	if err := router.DatabaseACL(db); err != nil {
-		return nil, err
+		return err
 	}
 
-	if _, err := spanner.ExecuteSingle(query); err != nil {
-		return nil, err
+	privilegePlug := spanner.plugins.PlugPrivilege()
+	isSet := privilegePlug.CheckUserPrivilegeIsSet(session.User())
+	if !isSet {
+		isSuper := privilegePlug.IsSuperPriv(session.User())
+		if !isSuper {
+			if isExist := privilegePlug.CheckDBinUserPrivilege(session.User(), db); !isExist {
+				error := sqldb.NewSQLErrorf(sqldb.ER_DBACCESS_DENIED_ERROR, "Access denied for user '%v'@'%%' to database '%v'",
+					session.User(), db)
+				return error
+			}
+		}
+	}
+
+	policy := spanner.conf.Proxy.UnknownDBPolicy
+	if router.DatabaseExists(db) {
+		policy = config.UnknownDBBackend
+	}
+	switch policy {
+	case config.UnknownDBError:
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	case config.UnknownDBImport:
+		if _, err := spanner.ExecuteScatter(query); err != nil {
+			return err
+		}
+		// The concurrent USE may have imported it.
+		if err := router.CreateDatabase(db); err != nil && !router.DatabaseExists(db) {
+			return err
+		}
+		log.Warning("proxy.use.database[%s].imported.from.session[%v]", db, session.ID())
+	default:
+		if _, err := spanner.ExecuteSingle(query); err != nil {
+			return err
+		}
 	}
 	session.SetSchema(db)
-	return &sqltypes.Result{}, nil
+	return nil
 }
@@ -12,6 +12,7 @@ import (
 	"errors"
 	"testing"
 
+	"config"
 	"fakedb"
 
 	"github.com/stretchr/testify/assert"
@@ -55,9 +56,9 @@ func TestProxyUseDB(t *testing.T) {
 		query := "use test"
 		fakedbs.AddQueryError(query, errors.New("mock use test error"))
 		_, err := client.FetchAll(query, -1)
-		want := "mock use test error (errno 1105) (sqlstate HY000)"
+		want := `^mock use test error \(backend:backend\d, phase:execute\) \(errno 1105\) \(sqlstate HY000\)$`
 		got := err.Error()
-		assert.Equal(t, want, got)
+		assert.Regexp(t, want, got)
 	}
 
 	// test db not exists.
@@ -66,3 +67,67 @@ func TestProxyUseDB(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestProxyUseDBUnknownPolicy(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Policy error.
+	{
+		conf := MockDefaultConfig()
+		conf.Proxy.UnknownDBPolicy = config.UnknownDBError
+		fakedbs, proxy, cleanup := MockProxy1(log, conf)
+		defer cleanup()
+		fakedbs.AddQuery("use test", fakedb.Result3)
+		fakedbs.AddQuery("use `test`", fakedb.Result3)
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+
+		client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+
+		want := "Unknown database 'test' (errno 1049) (sqlstate 42000)"
+		_, err = client.FetchAll("use test", -1)
+		assert.Equal(t, want, err.Error())
+		_, err = driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+		assert.Equal(t, want, err.Error())
+
+		// The database known to radon.
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("use test", -1)
+		assert.Nil(t, err)
+		client1, err := driver.NewConn("mock", "mock", proxy.Address(), "test", "utf8")
+		assert.Nil(t, err)
+		client1.Close()
+	}
+
+	// Policy import.
+	{
+		conf := MockDefaultConfig()
+		conf.Proxy.UnknownDBPolicy = config.UnknownDBImport
+		fakedbs, proxy, cleanup := MockProxy1(log, conf)
+		defer cleanup()
+		fakedbs.AddQuery("use test", fakedb.Result3)
+		fakedbs.AddQueryError("use xx", errors.New("mock.use.xx.error"))
+
+		client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+
+		// Imported on the first USE, check all the backends.
+		assert.False(t, proxy.Router().DatabaseExists("test"))
+		_, err = client.FetchAll("use test", -1)
+		assert.Nil(t, err)
+		assert.True(t, proxy.Router().DatabaseExists("test"))
+		assert.Equal(t, 5, fakedbs.GetQueryCalledNum("use test"))
+
+		// Known now, check one backend.
+		_, err = client.FetchAll("use test", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 6, fakedbs.GetQueryCalledNum("use test"))
+
+		_, err = client.FetchAll("use xx", -1)
+		assert.NotNil(t, err)
+		assert.False(t, proxy.Router().DatabaseExists("xx"))
+	}
+}
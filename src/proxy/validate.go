@@ -0,0 +1,46 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"backend"
+	"config"
+	"router"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// ValidateConfig used to cross-check the config, backends and tables metadata, all the problems are returned.
+// If online is true, the backends are connected to check the address and privileges.
+func ValidateConfig(log *xlog.Log, conf *config.Config, online bool) []error {
+	errs := conf.Validate()
+	if conf.Proxy == nil || conf.Proxy.MetaDir == "" {
+		return errs
+	}
+	metadir := conf.Proxy.MetaDir
+
+	backends, berrs := backend.ValidateConfig(metadir)
+	errs = append(errs, berrs...)
+	names := make([]string, 0, len(backends))
+	for _, b := range backends {
+		names = append(names, b.Name)
+	}
+	if conf.Router != nil {
+		errs = append(errs, router.ValidateConfig(log, metadir, conf.Router, names)...)
+	}
+
+	if online {
+		for _, b := range backends {
+			if err := backend.CheckBackend(b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,76 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"path"
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyValidateConfig(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	conf := proxy.Config()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("create database test", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create table test.t1(id int, b int) partition by hash(id)", -1)
+		assert.Nil(t, err)
+	}
+
+	// Offline.
+	{
+		errs := ValidateConfig(log, conf, false)
+		assert.Equal(t, 0, len(errs))
+	}
+
+	// Online, the backend users can't read the mysql.user.
+	{
+		errs := ValidateConfig(log, conf, true)
+		assert.Equal(t, len(fakedbs.Addrs()), len(errs))
+
+		fakedbs.AddQuery("select user from mysql.user limit 1", &sqltypes.Result{})
+		errs = ValidateConfig(log, conf, true)
+		assert.Equal(t, 0, len(errs))
+	}
+
+	// The table references the missing backend.
+	{
+		tconf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		bad := *tconf
+		bad.Name = "t2"
+		bad.Partitions = append([]*config.PartitionConfig{}, tconf.Partitions...)
+		bad.Partitions[0] = &config.PartitionConfig{Table: "t2_0000", Segment: bad.Partitions[0].Segment, Backend: "backendx"}
+		err = config.WriteConfig(path.Join(conf.Proxy.MetaDir, "test", "t2.json"), &bad)
+		assert.Nil(t, err)
+
+		errs := ValidateConfig(log, conf, false)
+		assert.Equal(t, 1, len(errs))
+	}
+}
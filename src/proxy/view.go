@@ -0,0 +1,339 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"config"
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// erWrongObject is the MySQL ER_WRONG_OBJECT, such as the table DDL on the view, it's not in the sqldb.
+const erWrongObject = 1347
+
+var (
+	createViewRegexp     = regexp.MustCompile("(?is)^create\\s+(or\\s+replace\\s+)?((?:algorithm\\s*=\\s*\\w+\\s+)?(?:definer\\s*=\\s*\\S+\\s+)?(?:sql\\s+security\\s+\\w+\\s+)?)view\\s+(`?(\\w+)`?\\s*\\.\\s*)?`?(\\w+)`?\\s*(\\([^)]*\\)\\s*)?as\\s+(.+?)(\\s+with\\s+(?:cascaded\\s+|local\\s+)?check\\s+option)?$")
+	dropViewRegexp       = regexp.MustCompile("(?is)^drop\\s+view\\s+(if\\s+exists\\s+)?(.+?)(\\s+(?:restrict|cascade))?$")
+	showCreateViewRegexp = regexp.MustCompile("(?is)^show\\s+create\\s+view\\s+(`?(\\w+)`?\\s*\\.\\s*)?`?(\\w+)`?$")
+	viewNameRegexp       = regexp.MustCompile("^(`?(\\w+)`?\\s*\\.\\s*)?`?(\\w+)`?$")
+)
+
+// isView returns true if the query is a CREATE VIEW or DROP VIEW statement, they are not supported by the parser.
+func isView(query string) bool {
+	return createViewRegexp.MatchString(query) || dropViewRegexp.MatchString(query)
+}
+
+// isShowCreateView returns true if the query is a SHOW CREATE VIEW statement, it's not supported by the parser.
+func isShowCreateView(query string) bool {
+	return showCreateViewRegexp.MatchString(query)
+}
+
+// errNotBaseTable returns the error of the table DDL on the view as MySQL does.
+func errNotBaseTable(db, table string) error {
+	return sqldb.NewSQLError1(erWrongObject, "HY000", "'%s.%s' is not BASE TABLE", db, table)
+}
+
+// checkBaseTable returns the error if the table is a view, the DDL of the tables can't be done on it.
+func checkBaseTable(route *router.Router, db, table string) error {
+	if tconf, err := route.TableConfig(db, table); err == nil && tconf.View != nil {
+		return errNotBaseTable(db, table)
+	}
+	return nil
+}
+
+// handleView used to handle the CREATE VIEW and DROP VIEW.
+// The view is created on the backends of the tables it selects from: the SINGLE table's backend,
+// or all the backends of the GLOBAL tables. It's registered in the metadata as the SINGLE or GLOBAL
+// table of the same name, so the querys on it are routed as the table.
+func (spanner *Spanner) handleView(session *driver.Session, query string) (*sqltypes.Result, error) {
+	route := spanner.router
+	privilegePlug := spanner.plugins.PlugPrivilege()
+
+	var dbs []string
+	create := createViewRegexp.FindStringSubmatch(query)
+	drop := dropViewRegexp.FindStringSubmatch(query)
+	var names []sqlparser.TableName
+	if create != nil {
+		names = append(names, sqlparser.TableName{Qualifier: sqlparser.NewTableIdent(create[4]), Name: sqlparser.NewTableIdent(create[5])})
+	} else {
+		for _, name := range strings.Split(drop[2], ",") {
+			matches := viewNameRegexp.FindStringSubmatch(strings.TrimSpace(name))
+			if matches == nil {
+				return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, fmt.Sprintf("near '%s'", strings.TrimSpace(name)))
+			}
+			names = append(names, sqlparser.TableName{Qualifier: sqlparser.NewTableIdent(matches[2]), Name: sqlparser.NewTableIdent(matches[3])})
+		}
+	}
+	// The names without the database are in the current database as MySQL does.
+	for i := range names {
+		if names[i].Qualifier.IsEmpty() {
+			names[i].Qualifier = sqlparser.NewTableIdent(session.Schema())
+		}
+		db := names[i].Qualifier.String()
+		if db == "" {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+		}
+		dbs = append(dbs, db)
+	}
+
+	for _, db := range dbs {
+		if err := route.DatabaseACL(db); err != nil {
+			return nil, err
+		}
+		if !privilegePlug.CheckPrivilege(db, session.User(), &sqlparser.DDL{}) {
+			return nil, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'@'%%' to database '%v'", session.User(), db)
+		}
+	}
+	if spanner.ReadOnly() {
+		return nil, sqldb.NewSQLError(sqldb.ER_OPTION_PREVENTS_STATEMENT, "--read-only")
+	}
+	txSession := spanner.sessions.getTxnSession(session)
+	if spanner.isTwoPC() && txSession.transaction != nil {
+		return nil, errors.Errorf("in.multiStmtTrans.unsupported.DDL:%v.", query)
+	}
+
+	if create != nil {
+		return spanner.createView(session, names[0].Qualifier.String(), names[0].Name.String(), create)
+	}
+	return spanner.dropViews(names, drop[1] != "")
+}
+
+// createView creates the view on the backends, the metadata is changed only if all of them succeed.
+// The views already created are dropped if one backend fails, except the replaced ones.
+func (spanner *Spanner) createView(session *driver.Session, db string, name string, create []string) (*sqltypes.Result, error) {
+	log := spanner.log
+	route := spanner.router
+	replace := create[1] != ""
+
+	if !checkDatabaseExists(db, route) {
+		return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	// The replaced view is dropped from the backends it's no longer on.
+	var stale []*config.PartitionConfig
+	if checkTableExists(db, name, route) {
+		if err := checkBaseTable(route, db, name); err == nil || !replace {
+			return nil, sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, name)
+		}
+		tconf, err := route.TableConfig(db, name)
+		if err != nil {
+			return nil, err
+		}
+		stale = tconf.Partitions
+	}
+	stmt, err := sqlparser.Parse(create[7])
+	if err != nil {
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, err.Error())
+	}
+	sel, ok := stmt.(sqlparser.SelectStatement)
+	if !ok {
+		return nil, sqldb.NewSQLError(sqldb.ER_SYNTAX_ERROR, fmt.Sprintf("near '%s'", create[7]))
+	}
+	tableType, backends, err := spanner.viewRoute(session, db, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	definition := sqlparser.String(sel)
+	query := fmt.Sprintf("create %s%sview %s.%s %sas %s%s", create[1], create[2], sqlparser.Backtick(db), sqlparser.Backtick(name),
+		create[6], definition, create[8])
+	var querys []xcontext.QueryTuple
+	for _, backend := range backends {
+		querys = append(querys, xcontext.QueryTuple{Query: query, Backend: backend, Table: name})
+	}
+	dropQuerys := func(backends []string) []xcontext.QueryTuple {
+		var drops []xcontext.QueryTuple
+		for _, backend := range backends {
+			drops = append(drops, xcontext.QueryTuple{Query: fmt.Sprintf("drop view if exists %s.%s", sqlparser.Backtick(db), sqlparser.Backtick(name)), Backend: backend, Table: name})
+		}
+		return drops
+	}
+	cleanup := func() {
+		if replace {
+			return
+		}
+		if x := spanner.executeSegmentsDDL(dropQuerys(backends)); x != nil {
+			log.Error("spanner.create.view[%s.%s].cleanup.error:%+v", db, name, x)
+		}
+	}
+	if err := spanner.executeSegmentsDDL(querys); err != nil {
+		cleanup()
+		return nil, err
+	}
+	if err := route.CreateView(db, name, tableType, backends, &config.ViewConfig{Definition: definition}, replace); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	on := make(map[string]bool)
+	for _, backend := range backends {
+		on[backend] = true
+	}
+	var olds []string
+	for _, part := range stale {
+		if !on[part.Backend] {
+			olds = append(olds, part.Backend)
+		}
+	}
+	if len(olds) > 0 {
+		if err := spanner.executeSegmentsDDL(dropQuerys(olds)); err != nil {
+			log.Error("spanner.create.view[%s.%s].drop.stale.error:%+v", db, name, err)
+		}
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// viewRoute returns the table type and the backends of the view by the tables it selects from, the tables without
+// the database are qualified by the database of the view since the backends execute the view without the current one.
+// The view can only select from the SINGLE tables on the same backend and the GLOBAL tables, it's SINGLE on the
+// backend if any SINGLE table, or GLOBAL on the backends all the GLOBAL tables are on. The view of no tables is GLOBAL.
+func (spanner *Spanner) viewRoute(session *driver.Session, database string, sel sqlparser.SelectStatement) (string, []string, error) {
+	route := spanner.router
+	privilegePlug := spanner.plugins.PlugPrivilege()
+
+	var single string
+	var globals map[string]bool
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		aliased, ok := node.(*sqlparser.AliasedTableExpr)
+		if !ok {
+			return true, nil
+		}
+		table, ok := aliased.Expr.(sqlparser.TableName)
+		if !ok || table.Name.String() == "dual" {
+			return true, nil
+		}
+		if table.Qualifier.IsEmpty() {
+			table.Qualifier = sqlparser.NewTableIdent(database)
+			aliased.Expr = table
+		}
+		db, name := table.Qualifier.String(), table.Name.String()
+		if db != database {
+			if err := route.DatabaseACL(db); err != nil {
+				return false, err
+			}
+			if !privilegePlug.CheckPrivilege(db, session.User(), sel) {
+				return false, sqldb.NewSQLErrorf(sqldb.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'@'%%' to database '%v'", session.User(), db)
+			}
+		}
+		tconf, err := route.TableConfig(db, name)
+		if err != nil {
+			return false, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, db+"."+name)
+		}
+		switch tconf.ShardType {
+		case "SINGLE":
+			if single != "" && single != tconf.Partitions[0].Backend {
+				return false, errors.New("unsupported: view.on.the.tables.not.co-located")
+			}
+			single = tconf.Partitions[0].Backend
+		case "GLOBAL":
+			on := make(map[string]bool)
+			for _, part := range tconf.Partitions {
+				if globals == nil || globals[part.Backend] {
+					on[part.Backend] = true
+				}
+			}
+			globals = on
+		default:
+			return false, errors.Errorf("unsupported: view.on.the.partitioned.table[%s.%s]", db, name)
+		}
+		return true, nil
+	}, sel)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case single != "":
+		if globals != nil && !globals[single] {
+			return "", nil, errors.New("unsupported: view.on.the.tables.not.co-located")
+		}
+		return router.TableTypeSingle, []string{single}, nil
+	case globals != nil:
+		var backends []string
+		for backend := range globals {
+			backends = append(backends, backend)
+		}
+		if len(backends) == 0 {
+			return "", nil, errors.New("unsupported: view.on.the.tables.not.co-located")
+		}
+		sort.Strings(backends)
+		return router.TableTypeGlobal, backends, nil
+	}
+	return router.TableTypeGlobal, spanner.scatter.Backends(), nil
+}
+
+// dropViews drops the views from their backends, the views not exist are skipped if ifExists.
+func (spanner *Spanner) dropViews(names []sqlparser.TableName, ifExists bool) (*sqltypes.Result, error) {
+	route := spanner.router
+
+	qr := &sqltypes.Result{}
+	for _, name := range names {
+		db, view := name.Qualifier.String(), name.Name.String()
+		tconf, err := route.TableConfig(db, view)
+		if err != nil {
+			if ifExists {
+				qr.Warnings++
+				continue
+			}
+			return nil, sqldb.NewSQLError1(sqldb.ER_BAD_TABLE_ERROR, "42S02", "Unknown table '%s.%s'", db, view)
+		}
+		if tconf.View == nil {
+			return nil, sqldb.NewSQLError1(erWrongObject, "HY000", "'%s.%s' is not VIEW", db, view)
+		}
+
+		var querys []xcontext.QueryTuple
+		for _, part := range tconf.Partitions {
+			query := fmt.Sprintf("drop view if exists %s.%s", sqlparser.Backtick(db), sqlparser.Backtick(part.Table))
+			querys = append(querys, xcontext.QueryTuple{Query: query, Backend: part.Backend, Table: part.Table})
+		}
+		if err := spanner.executeSegmentsDDL(querys); err != nil {
+			return nil, err
+		}
+		if err := route.DropView(db, view); err != nil {
+			return nil, err
+		}
+	}
+	return qr, nil
+}
+
+// handleShowCreateView used to handle the 'SHOW CREATE VIEW', it's served by the first backend of the view.
+func (spanner *Spanner) handleShowCreateView(session *driver.Session, query string) (*sqltypes.Result, error) {
+	route := spanner.router
+
+	matches := showCreateViewRegexp.FindStringSubmatch(query)
+	db, view := matches[2], matches[3]
+	if db == "" {
+		db = session.Schema()
+	}
+	if db == "" {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
+	}
+	if err := route.DatabaseACL(db); err != nil {
+		return nil, err
+	}
+	tconf, err := route.TableConfig(db, view)
+	if err != nil {
+		return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, db+"."+view)
+	}
+	if tconf.View == nil {
+		return nil, sqldb.NewSQLError1(erWrongObject, "HY000", "'%s.%s' is not VIEW", db, view)
+	}
+	part := tconf.Partitions[0]
+	return spanner.ExecuteOnThisBackend(part.Backend, fmt.Sprintf("SHOW CREATE VIEW %s.%s", sqlparser.Backtick(db), sqlparser.Backtick(part.Table)))
+}
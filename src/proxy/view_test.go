@@ -0,0 +1,158 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyView(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("drop .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("SHOW CREATE VIEW .*", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.s1(id int, b int) single",
+		"create table test.g1(id int, b int) global",
+		"create table test.h1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err := client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+	single, err := proxy.Router().TableConfig("test", "s1")
+	assert.Nil(t, err)
+	global, err := proxy.Router().TableConfig("test", "g1")
+	assert.Nil(t, err)
+
+	// The view on the single table is created on its backend.
+	{
+		_, err := client.FetchAll("CREATE ALGORITHM=MERGE VIEW test.v1 (a) AS select s1.id from s1, g1 where s1.id=g1.id", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("create ALGORITHM=MERGE view `test`.`v1` (a) as select s1.id from test.s1, test.g1 where s1.id = g1.id"))
+
+		tconf, err := proxy.Router().TableConfig("test", "v1")
+		assert.Nil(t, err)
+		assert.Equal(t, "SINGLE", tconf.ShardType)
+		assert.Equal(t, single.Partitions[0].Backend, tconf.Partitions[0].Backend)
+		assert.Equal(t, "select s1.id from test.s1, test.g1 where s1.id = g1.id", tconf.View.Definition)
+
+		qr, err := client.FetchAll("show full tables from test", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "[[g1 GLOBAL] [h1 HASH] [s1 SINGLE] [v1 VIEW]]", fmt.Sprintf("%v", qr.Rows))
+
+		_, err = client.FetchAll("select * from test.v1", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("show create view test.v1", -1)
+		assert.Nil(t, err)
+	}
+
+	// The view on the global tables is created on all their backends, it's replaced.
+	{
+		_, err := client.FetchAll("create or replace view test.v1 as select * from test.g1 with check option", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, len(global.Partitions), fakedbs.GetQueryCalledNum("create or replace view `test`.`v1` as select * from test.g1 with check option"))
+
+		tconf, err := proxy.Router().TableConfig("test", "v1")
+		assert.Nil(t, err)
+		assert.Equal(t, "GLOBAL", tconf.ShardType)
+		assert.Equal(t, len(global.Partitions), len(tconf.Partitions))
+	}
+
+	// Errors.
+	{
+		querys := []struct {
+			query string
+			err   string
+		}{
+			{
+				"create view v2 as select * from t1",
+				"No database selected (errno 1046) (sqlstate 3D000)",
+			},
+			{
+				"create view test.v2 as select * from test.h1",
+				"unsupported: view.on.the.partitioned.table[test.h1] (errno 1105) (sqlstate HY000)",
+			},
+			{
+				"create view test.v2 as select * from test.xx",
+				"Table 'test.xx' doesn't exist (errno 1146) (sqlstate 42S02)",
+			},
+			{
+				"create view test.v1 as select * from test.g1",
+				"Table 'v1' already exists (errno 1050) (sqlstate 42S01)",
+			},
+			{
+				"create or replace view test.s1 as select * from test.g1",
+				"Table 's1' already exists (errno 1050) (sqlstate 42S01)",
+			},
+			{
+				"drop view test.s1",
+				"'test.s1' is not VIEW (errno 1347) (sqlstate HY000)",
+			},
+			{
+				"drop view test.xx",
+				"Unknown table 'test.xx' (errno 1051) (sqlstate 42S02)",
+			},
+			{
+				"drop table test.v1",
+				"Unknown table 'test.v1' (errno 1051) (sqlstate 42S02)",
+			},
+			{
+				"truncate table test.v1",
+				"'test.v1' is not BASE TABLE (errno 1347) (sqlstate HY000)",
+			},
+			{
+				"create table test.t2 like test.v1",
+				"'test.v1' is not BASE TABLE (errno 1347) (sqlstate HY000)",
+			},
+			{
+				"show create view test.s1",
+				"'test.s1' is not VIEW (errno 1347) (sqlstate HY000)",
+			},
+		}
+		for _, query := range querys {
+			_, err := client.FetchAll(query.query, -1)
+			assert.NotNil(t, err, query.query)
+			if err != nil {
+				assert.Equal(t, query.err, err.Error(), query.query)
+			}
+		}
+	}
+
+	// Dropped from all the backends.
+	{
+		_, err := client.FetchAll("drop view if exists test.v1, test.xx", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, len(global.Partitions), fakedbs.GetQueryCalledNum("drop view if exists `test`.`v1`"))
+		_, err = proxy.Router().TableConfig("test", "v1")
+		assert.NotNil(t, err)
+	}
+}
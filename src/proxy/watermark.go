@@ -0,0 +1,98 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"strconv"
+	"strings"
+
+	"backend"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+const (
+	var_radon_read_as_of = "radon_read_as_of"
+
+	// readAsOfLatest reads as of the latest watermark.
+	readAsOfLatest = "latest"
+)
+
+// setReadAsOf used to set the GTID watermark the reads of the session are as of, it's 'latest' or the id of
+// a recent watermark, the empty string or NULL resets it.
+func (spanner *Spanner) setReadAsOf(txSession *session, expr sqlparser.Expr) error {
+	switch expr := expr.(type) {
+	case *sqlparser.NullVal:
+		txSession.setReadAsOfVar("")
+		return nil
+	case *sqlparser.SQLVal:
+		val := strings.ToLower(string(expr.Val))
+		switch expr.Type {
+		case sqlparser.StrVal:
+			if val == "" || val == readAsOfLatest {
+				txSession.setReadAsOfVar(val)
+				return nil
+			}
+			if _, err := strconv.ParseUint(val, 10, 64); err == nil {
+				txSession.setReadAsOfVar(val)
+				return nil
+			}
+		case sqlparser.IntVal:
+			if _, err := strconv.ParseUint(val, 10, 64); err == nil {
+				txSession.setReadAsOfVar(val)
+				return nil
+			}
+		}
+	}
+	return sqldb.NewSQLError(sqldb.ER_WRONG_VALUE_FOR_VAR, var_radon_read_as_of, sqlparser.String(expr))
+}
+
+// readWatermark returns the GTID watermark the read is as of, nil if the radon_read_as_of of the session isn't set.
+// The read must be out of the transaction and without the locking.
+func (spanner *Spanner) readWatermark(session *driver.Session, node sqlparser.Statement) (*backend.Watermark, error) {
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if node.Lock != "" {
+			return nil, nil
+		}
+	case *sqlparser.Union:
+		if node.Lock != "" {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	txSession := spanner.sessions.getTxnSession(session)
+	if txSession == nil {
+		return nil, nil
+	}
+	asOf, transaction := txSession.getReadAsOfVar()
+	if asOf == "" || transaction {
+		return nil, nil
+	}
+
+	watermarks := spanner.scatter.Watermarks()
+	if asOf == readAsOfLatest {
+		watermark := watermarks.Latest()
+		if watermark == nil {
+			return nil, errors.New("spanner.watermark.is.not.captured.yet")
+		}
+		return watermark, nil
+	}
+	id, _ := strconv.ParseUint(asOf, 10, 64)
+	watermark := watermarks.Get(id)
+	if watermark == nil {
+		return nil, errors.Errorf("spanner.watermark[%d].can.not.be.found, it's not captured or expired", id)
+	}
+	return watermark, nil
+}
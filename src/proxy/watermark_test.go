@@ -0,0 +1,113 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"testing"
+
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyReadAsOf(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	backends := len(proxy.Spanner().scatter.Backends())
+
+	// value returns the result of the one value query.
+	value := func(val string) *sqltypes.Result {
+		return &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "val", Type: querypb.Type_VARCHAR}},
+			Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(val))}},
+		}
+	}
+	wait := "SELECT WAIT_FOR_EXECUTED_GTID_SET('uuid:1-10', 1)"
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+		fakedbs.AddQuery("SELECT @@GLOBAL.gtid_executed", value("uuid:1-10"))
+		fakedbs.AddQuery(wait, value("0"))
+		fakedbs.AddQuery("START TRANSACTION WITH CONSISTENT SNAPSHOT", fakedb.Result3)
+		fakedbs.AddQuery("ROLLBACK", fakedb.Result3)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// The value is checked.
+	{
+		_, err = client.FetchAll("set radon_read_as_of = 'yesterday'", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "Variable 'radon_read_as_of' can't be set to the value of ''yesterday'' (errno 1231) (sqlstate 42000)", err.Error())
+	}
+
+	// No watermark captured.
+	{
+		_, err = client.FetchAll("set radon_read_as_of = 'LATEST'", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select * from test.t1", -1)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "spanner.watermark.is.not.captured.yet")
+	}
+
+	watermark, err := proxy.Scatter().CaptureWatermark()
+	assert.Nil(t, err)
+	assert.Equal(t, backends, len(watermark.GTIDs))
+
+	// The latest.
+	{
+		_, err = client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, backends, fakedbs.GetQueryCalledNum(wait))
+		assert.Equal(t, backends, fakedbs.GetQueryCalledNum("START TRANSACTION WITH CONSISTENT SNAPSHOT"))
+	}
+
+	// The id.
+	{
+		_, err = client.FetchAll(fmt.Sprintf("set radon_read_as_of = %d", watermark.ID), -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select /*+ radon_stream */ * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.True(t, fakedbs.GetQueryCalledNum(wait) > backends)
+
+		_, err = client.FetchAll("set radon_read_as_of = '100'", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select * from test.t1", -1)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "spanner.watermark[100].can.not.be.found")
+	}
+
+	// Reset.
+	{
+		_, err = client.FetchAll("set radon_read_as_of = NULL", -1)
+		assert.Nil(t, err)
+		called := fakedbs.GetQueryCalledNum(wait)
+		_, err = client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, called, fakedbs.GetQueryCalledNum(wait))
+	}
+}
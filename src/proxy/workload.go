@@ -0,0 +1,161 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"time"
+
+	"config"
+	"monitor"
+	"planner"
+	"xbase"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// The admission results of the workload querys.
+const (
+	workloadAdmitted = "admitted"
+	workloadRejected = "rejected"
+)
+
+type workload struct {
+	conf *config.WorkloadConfig
+
+	// slots is nil if the concurrency is not limited.
+	slots chan struct{}
+}
+
+// Workloads classifies the querys into the workload classes oltp, olap and batch by the 'radon_workload' hint
+// or the user-workloads, and admits them with the limits of the class. The olap and batch querys are usually
+// limited to a lower concurrency and max result size, so they can't crowd out the oltp querys.
+type Workloads struct {
+	log     *xlog.Log
+	conf    *config.ProxyConfig
+	classes map[string]*workload
+	clock   xbase.AtomicClock
+}
+
+// NewWorkloads creates the new workloads.
+func NewWorkloads(log *xlog.Log, conf *config.ProxyConfig) *Workloads {
+	w := &Workloads{
+		log:     log,
+		conf:    conf,
+		classes: make(map[string]*workload),
+	}
+	for class, wconf := range conf.Workloads {
+		if wconf == nil {
+			continue
+		}
+		wl := &workload{conf: wconf}
+		if wconf.MaxConcurrency > 0 {
+			wl.slots = make(chan struct{}, wconf.MaxConcurrency)
+		}
+		w.classes[class] = wl
+	}
+	return w
+}
+
+// SetClock used to set the clock of the queue times.
+func (w *Workloads) SetClock(clock xbase.Clock) {
+	w.clock.Set(clock)
+}
+
+// Classify returns the workload class of the query, the hint overrides the class of the user.
+// It returns empty for the statements except SELECT, UNION, INSERT, REPLACE, UPDATE and DELETE, they're not admitted.
+func (w *Workloads) Classify(user string, node sqlparser.Statement) string {
+	var comments sqlparser.Comments
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		comments = node.Comments
+	case *sqlparser.Union:
+		comments = unionComments(node)
+	case *sqlparser.Insert:
+		comments = node.Comments
+	case *sqlparser.Update:
+		comments = node.Comments
+	case *sqlparser.Delete:
+		comments = node.Comments
+	default:
+		return ""
+	}
+
+	hints, _ := planner.ParseHints(comments)
+	switch hints.Workload {
+	case config.WorkloadOLTP, config.WorkloadOLAP, config.WorkloadBatch:
+		return hints.Workload
+	}
+	if class, ok := w.conf.UserWorkloads[user]; ok {
+		return class
+	}
+	return config.WorkloadOLTP
+}
+
+// unionComments returns the comments of the leftmost select.
+func unionComments(node *sqlparser.Union) sqlparser.Comments {
+	var left sqlparser.SelectStatement = node
+	for {
+		switch n := left.(type) {
+		case *sqlparser.Union:
+			left = n.Left
+		case *sqlparser.ParenSelect:
+			left = n.Select
+		case *sqlparser.Select:
+			return n.Comments
+		default:
+			return nil
+		}
+	}
+}
+
+// Admit used to wait for the query of the class to run, it returns the function to call when the query is done.
+// The query is rejected if it has waited for the max-queue-time of the class.
+func (w *Workloads) Admit(class string) (func(), error) {
+	if class == "" {
+		return func() {}, nil
+	}
+
+	clock := w.clock.Get()
+	start := clock.Now()
+	if wl, ok := w.classes[class]; ok && wl.slots != nil {
+		monitor.WorkloadQueuedAdd(class, 1)
+		var timeout <-chan time.Time
+		if wl.conf.MaxQueueTime > 0 {
+			timeout = clock.After(time.Duration(wl.conf.MaxQueueTime) * time.Millisecond)
+		}
+		select {
+		case wl.slots <- struct{}{}:
+			monitor.WorkloadQueuedAdd(class, -1)
+		case <-timeout:
+			monitor.WorkloadQueuedAdd(class, -1)
+			monitor.WorkloadQueryInc(class, workloadRejected)
+			w.log.Warning("workload[%s].query.rejected.queue.timeout[%dms].exceeded", class, wl.conf.MaxQueueTime)
+			return nil, xbase.NewRadonError(xbase.ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, the %s workload max queue time[%dms] exceeded", class, wl.conf.MaxQueueTime)
+		}
+	}
+	monitor.WorkloadQueryInc(class, workloadAdmitted)
+	monitor.WorkloadRunningAdd(class, 1)
+
+	return func() {
+		if wl, ok := w.classes[class]; ok && wl.slots != nil {
+			<-wl.slots
+		}
+		monitor.WorkloadRunningAdd(class, -1)
+		monitor.WorkloadQueryObserve(class, clock.Since(start))
+	}, nil
+}
+
+// MaxResultSize returns the max result size of the class, the max-result-size of the class overrides the global one.
+func (w *Workloads) MaxResultSize(class string) int {
+	if wl, ok := w.classes[class]; ok && wl.conf.MaxResultSize > 0 {
+		return wl.conf.MaxResultSize
+	}
+	return w.conf.MaxResultSize
+}
@@ -0,0 +1,107 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyWorkloadClassify(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.UserWorkloads = map[string]string{"analyst": config.WorkloadOLAP}
+	workloads := NewWorkloads(log, conf.Proxy)
+
+	tests := []struct {
+		user  string
+		query string
+		class string
+	}{
+		{"mock", "select * from t1", "oltp"},
+		{"analyst", "select * from t1", "olap"},
+		{"analyst", "select /*+ radon_workload(oltp) */ * from t1", "oltp"},
+		{"mock", "select /*+ RADON_WORKLOAD(Batch) */ * from t1", "batch"},
+		{"mock", "select /*+ radon_workload(adhoc) */ * from t1", "oltp"},
+		{"mock", "select /*+ radon_workload(olap) */ a from t1 union select b from t2", "olap"},
+		{"mock", "insert /*+ radon_workload(batch) */ into t1 values(1)", "batch"},
+		{"mock", "update /*+ radon_workload(batch) */ t1 set a=1", "batch"},
+		{"analyst", "delete from t1 where a=1", "olap"},
+		{"analyst", "set autocommit=1", ""},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err, test.query)
+		assert.Equal(t, test.class, workloads.Classify(test.user, node), test.query)
+	}
+}
+
+func TestProxyWorkload(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.Workloads = map[string]*config.WorkloadConfig{
+		config.WorkloadOLAP:  {MaxConcurrency: 1, MaxQueueTime: 100},
+		config.WorkloadBatch: {MaxResultSize: 8},
+	}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	workloads := proxy.Spanner().workloads
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create .*", fakedb.Result3)
+		fakedbs.AddQueryPattern("select .*", fakedb.Result1)
+	}
+
+	client, err := driver.NewConn("mock", "mock", proxy.Address(), "", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	querys := []string{
+		"create database test",
+		"create table test.t1(id int, b int) partition by hash(id)",
+	}
+	for _, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+	}
+
+	// The olap query waits for the running one.
+	{
+		release, err := workloads.Admit(config.WorkloadOLAP)
+		assert.Nil(t, err)
+
+		_, err = client.FetchAll("select /*+ radon_workload(olap) */ * from test.t1", -1)
+		assert.Equal(t, "Query execution was interrupted, the olap workload max queue time[100ms] exceeded (errno 9002) (sqlstate HY000)", err.Error())
+
+		// The oltp is not limited.
+		_, err = client.FetchAll("select * from test.t1", -1)
+		assert.Nil(t, err)
+
+		release()
+		_, err = client.FetchAll("select /*+ radon_workload(olap) */ * from test.t1", -1)
+		assert.Nil(t, err)
+	}
+
+	// The batch max result size.
+	{
+		_, err := client.FetchAll("select /*+ radon_workload(batch) */ * from test.t1", -1)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "max memory usage[8 bytes] exceeded"), err.Error())
+	}
+}
@@ -26,16 +26,18 @@ import (
 )
 
 var (
-	flagConf string
+	flagConf     string
+	flagValidate bool
 )
 
 func init() {
 	flag.StringVar(&flagConf, "c", "", "radon config file")
 	flag.StringVar(&flagConf, "config", "", "radon config file")
+	flag.BoolVar(&flagValidate, "validate-config", false, "validate the config and metadata, print all the problems and exit")
 }
 
 func usage() {
-	fmt.Println("Usage: " + os.Args[0] + " [-c|--config] <radon-config-file>")
+	fmt.Println("Usage: " + os.Args[0] + " [-c|--config] <radon-config-file> [--validate-config]")
 }
 
 func main() {
@@ -59,6 +61,19 @@ func main() {
 	}
 	log.SetLevel(conf.Log.Level)
 
+	if flagValidate {
+		errs := proxy.ValidateConfig(log, conf, true)
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+		if len(errs) > 0 {
+			fmt.Printf("radon.validate.config[%s]:%d.problems.found\n", flagConf, len(errs))
+			os.Exit(1)
+		}
+		fmt.Printf("radon.validate.config[%s]:ok\n", flagConf)
+		os.Exit(0)
+	}
+
 	// Monitor
 	monitor.Start(log, conf)
 
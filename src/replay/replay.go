@@ -0,0 +1,65 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"audit"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	flagDir      string
+	flagAddress  string
+	flagUser     string
+	flagPassword string
+	flagDatabase string
+	flagSpeed    float64
+)
+
+func init() {
+	flag.StringVar(&flagDir, "dir", "", "the audit log dir")
+	flag.StringVar(&flagAddress, "address", "127.0.0.1:3306", "the radon address to replay to")
+	flag.StringVar(&flagUser, "user", "", "the user")
+	flag.StringVar(&flagPassword, "password", "", "the password")
+	flag.StringVar(&flagDatabase, "database", "", "the default database of the sessions")
+	flag.Float64Var(&flagSpeed, "speed", 1, "the pace factor, 1 is the recorded pace, 2 is twice as fast, 0 is as fast as possible")
+}
+
+func usage() {
+	fmt.Println("Usage: " + os.Args[0] + " --dir <audit-log-dir> --address <radon-address> --user <user> --password <password> [--database <db>] [--speed <factor>]")
+}
+
+func main() {
+	log := xlog.NewStdLog(xlog.Level(xlog.INFO))
+
+	flag.Usage = func() { usage() }
+	flag.Parse()
+	if flagDir == "" || flagUser == "" {
+		usage()
+		os.Exit(0)
+	}
+
+	conf := &audit.ReplayConfig{
+		Address:  flagAddress,
+		User:     flagUser,
+		Password: flagPassword,
+		Database: flagDatabase,
+		Speed:    flagSpeed,
+	}
+	stats, err := audit.NewReplayer(log, conf).Replay(flagDir)
+	if err != nil {
+		log.Panic("replay.error[%v]", err)
+	}
+	fmt.Printf("sessions:%d, querys:%d, errors:%d, elapsed:%v\n", stats.Sessions, stats.Querys, stats.Errors, stats.Elapsed)
+}
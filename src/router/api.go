@@ -9,9 +9,12 @@
 package router
 
 import (
+	"strings"
+
 	"config"
 
 	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 )
 
 // RDatabase tuple.
@@ -27,14 +30,17 @@ type Rule struct {
 
 // Rules returns router's schemas.
 func (r *Router) Rules() *Rule {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
 	rule := &Rule{}
 
-	for key, schema := range r.Schemas {
+	for key, schema := range r.Schemas() {
 		rdb := RDatabase{DB: key}
 		for _, v := range schema.Tables {
-			rdb.Tables = append(rdb.Tables, v)
+			table, err := r.resolve(key, v)
+			if err != nil {
+				r.log.Error("router.rules.table[%s.%s].load.error:%+v", key, v.Name, err)
+				table = v
+			}
+			rdb.Tables = append(rdb.Tables, table)
 		}
 		rule.Schemas = append(rule.Schemas, rdb)
 	}
@@ -85,7 +91,7 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 		return "", errors.Errorf("router.rule.change.from[%s].cant.equal.to[%s]", fromBackend, toBackend)
 	}
 
-	schema, ok := r.Schemas[database]
+	schema, ok := r.schemas[database]
 	if !ok {
 		return "", errors.Errorf("router.rule.change.cant.found.database:%s", database)
 	}
@@ -96,6 +102,10 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 		if found {
 			break
 		}
+		v, err := r.resolve(database, v)
+		if err != nil {
+			return "", err
+		}
 		for _, partition := range v.TableConfig.Partitions {
 			if (partition.Backend == fromBackend) && (partition.Table == partitionTable) {
 				log.Warning("router.rule[%s:%s].change.from[%s].to[%s].found:%+v", database, partitionTable, fromBackend, toBackend, partition)
@@ -112,30 +122,29 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 		return "", errors.Errorf("router.rule.change.cant.found.backend[%s]+table:[%s]", fromBackend, partitionTable)
 	}
 
-	// 2. Change the backend to to-backend.
-	if tableConfig.ShardType == "GLOBAL" {
-		for _, partition := range tableConfig.Partitions {
-			if partition.Backend == toBackend {
-				return "", errors.Errorf("the.table:[%s].already.exists.in.the.backend[%s]", partitionTable, toBackend)
-			}
+	// 2. Change the backend to to-backend on a copy, the memory config is updated by the reloading.
+	tconf := *tableConfig
+	tconf.Partitions = make([]*config.PartitionConfig, 0, len(tableConfig.Partitions)+1)
+	for _, partition := range tableConfig.Partitions {
+		if tableConfig.ShardType == "GLOBAL" && partition.Backend == toBackend {
+			return "", errors.Errorf("the.table:[%s].already.exists.in.the.backend[%s]", partitionTable, toBackend)
 		}
+		p := *partition
+		if tableConfig.ShardType != "GLOBAL" && partition == partitionConfig {
+			p.Backend = toBackend
+		}
+		tconf.Partitions = append(tconf.Partitions, &p)
+	}
+	if tableConfig.ShardType == "GLOBAL" {
 		partConf := &config.PartitionConfig{
 			Table:   table,
 			Backend: toBackend,
 		}
-		tableConfig.Partitions = append(tableConfig.Partitions, partConf)
-	} else {
-		partitionConfig.Backend = toBackend
+		tconf.Partitions = append(tconf.Partitions, partConf)
 	}
 
 	// 3. Flush table config to disk.
-	if err := r.writeTableFrmData(database, table, tableConfig); err != nil {
-		// Memory config reset.
-		if tableConfig.ShardType == "GLOBAL" {
-			tableConfig.Partitions = append(tableConfig.Partitions[:(len(tableConfig.Partitions) - 1)])
-		} else {
-			partitionConfig.Backend = fromBackend
-		}
+	if err := r.writeTableFrmData(database, table, &tconf); err != nil {
 		return "", err
 	}
 
@@ -147,15 +156,227 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 	return table, nil
 }
 
+// SegmentRename tuple.
+type SegmentRename struct {
+	Backend string `json:"backend"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// SegmentRenames used to compute the segment renames of the HASH table to the naming,
+// the segments which already have the new names are skipped.
+func (r *Router) SegmentRenames(database string, tableName string, naming *config.SegmentNaming) ([]SegmentRename, error) {
+	if err := naming.Validate(); err != nil {
+		return nil, err
+	}
+	table, err := r.getTable(database, tableName)
+	if err != nil {
+		return nil, err
+	}
+	tconf := table.TableConfig
+	if tconf.ShardType != methodTypeHash {
+		return nil, errors.Errorf("router.segment.rename.table[%s.%s].shardtype[%s].must.be.HASH", database, tableName, tconf.ShardType)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tables := r.schemas[database].Tables
+
+	var renames []SegmentRename
+	for i, part := range tconf.Partitions {
+		to := naming.Name(tableName, i)
+		if len(to) > 64 {
+			return nil, errors.Errorf("router.segment.rename.name[%s].too.long:[max:64]", to)
+		}
+		if _, ok := tables[to]; ok && to != tableName {
+			return nil, errors.Errorf("router.segment.rename.name[%s].conflicts.with.table[%s.%s]", to, database, to)
+		}
+		if to == part.Table {
+			continue
+		}
+		renames = append(renames, SegmentRename{Backend: part.Backend, From: part.Table, To: to})
+	}
+	return renames, nil
+}
+
+// RenameSegments used to apply the renames and the naming to the table config.
+// The processes as:
+// 1. flush the renamed table config to disk.
+// 2. reload the config to memory.
+// Note:
+// The segments must be renamed on the backends first.
+func (r *Router) RenameSegments(database string, tableName string, naming *config.SegmentNaming, renames []SegmentRename) error {
+	log := r.log
+
+	log.Warning("router.segment.rename.database[%s].table[%s].naming[%+v].renames[%d]", database, tableName, naming, len(renames))
+	if err := r.writeRenamedTable(database, tableName, naming, renames); err != nil {
+		log.Error("router.segment.rename.write.table.error:%+v", err)
+		return err
+	}
+
+	if err := r.RefreshTable(database, tableName); err != nil {
+		log.Panic("router.segment.rename.RefreshTable.error:%+v", err)
+		return err
+	}
+	log.Warning("router.segment.rename.RefreshTable.done")
+	return nil
+}
+
+func (r *Router) writeRenamedTable(database string, tableName string, naming *config.SegmentNaming, renames []SegmentRename) error {
+	table, err := r.getTable(database, tableName)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// Write a copy, the memory config is updated by the reloading.
+	names := make(map[string]string)
+	for _, rename := range renames {
+		names[rename.From] = rename.To
+	}
+	tconf := *table.TableConfig
+	tconf.SegmentNaming = naming
+	tconf.Partitions = make([]*config.PartitionConfig, 0, len(table.TableConfig.Partitions))
+	for _, part := range table.TableConfig.Partitions {
+		p := *part
+		if to, ok := names[p.Table]; ok {
+			p.Table = to
+		}
+		tconf.Partitions = append(tconf.Partitions, &p)
+	}
+	tconf.ShardMap = tconf.ShardMap.Rename(names)
+
+	if err := r.writeTableFrmData(database, tableName, &tconf); err != nil {
+		return err
+	}
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		r.log.Panicf("segment.rename.table.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// TableRenames used to compute the segment renames to move the table to the database with the new name,
+// the segment is renamed by replacing the table name prefix, such as 't1_0001' to 't2_0001'.
+// The table with triggers and the view can't be moved to the other database as MySQL does,
+// the tables with the lookups and the lookup tables can't be renamed.
+func (r *Router) TableRenames(database string, tableName string, toDatabase string, toTable string) ([]SegmentRename, error) {
+	table, err := r.getTable(database, tableName)
+	if err != nil {
+		return nil, err
+	}
+	tconf := table.TableConfig
+	if database != toDatabase && len(tconf.Triggers) > 0 {
+		return nil, errors.Errorf("router.table.move[%s.%s].has.triggers.can't.move.to.database[%s]", database, tableName, toDatabase)
+	}
+	if database != toDatabase && tconf.View != nil {
+		return nil, errors.Errorf("router.table.move[%s.%s].is.a.view.can't.move.to.database[%s]", database, tableName, toDatabase)
+	}
+	if len(tconf.Lookups) > 0 || tconf.LookupOf != "" {
+		return nil, errors.Errorf("router.table.rename[%s.%s].has.lookups.or.is.a.lookup.table", database, tableName)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schema, ok := r.schemas[toDatabase]
+	if !ok {
+		return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, toDatabase)
+	}
+	if _, ok := schema.Tables[toTable]; ok {
+		return nil, sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, toTable)
+	}
+
+	var renames []SegmentRename
+	for _, part := range tconf.Partitions {
+		to := part.Table
+		if strings.HasPrefix(part.Table, tableName) {
+			to = toTable + strings.TrimPrefix(part.Table, tableName)
+		}
+		if len(to) > 64 {
+			return nil, errors.Errorf("router.table.move.name[%s].too.long:[max:64]", to)
+		}
+		if _, ok := schema.Tables[to]; ok {
+			return nil, errors.Errorf("router.table.move.name[%s].conflicts.with.table[%s.%s]", to, toDatabase, to)
+		}
+		renames = append(renames, SegmentRename{Backend: part.Backend, From: part.Table, To: to})
+	}
+	return renames, nil
+}
+
+// RenameTable used to move the table config to the database with the new name and the renamed segments.
+// The processes as:
+// 1. flush the moved table config to disk.
+// 2. move the table in memory.
+// 3. remove the old table config file.
+// Note:
+// The segments must be renamed on the backends first.
+// Lock.
+func (r *Router) RenameTable(database string, tableName string, toDatabase string, toTable string, renames []SegmentRename) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	log.Warning("router.table.move[%s.%s].to[%s.%s].renames[%d]", database, tableName, toDatabase, toTable, len(renames))
+	schema, ok := r.schemas[database]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
+	}
+	table, ok := schema.Tables[tableName]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, tableName)
+	}
+	table, err := r.resolve(database, table)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]string)
+	for _, rename := range renames {
+		names[rename.From] = rename.To
+	}
+	tconf := *table.TableConfig
+	tconf.Name = toTable
+	tconf.Partitions = make([]*config.PartitionConfig, 0, len(table.TableConfig.Partitions))
+	for _, part := range table.TableConfig.Partitions {
+		p := *part
+		if to, ok := names[p.Table]; ok {
+			p.Table = to
+		}
+		tconf.Partitions = append(tconf.Partitions, &p)
+	}
+	tconf.ShardMap = tconf.ShardMap.Rename(names)
+
+	if err := r.writeTableFrmData(toDatabase, toTable, &tconf); err != nil {
+		log.Error("router.table.move.write.table.error:%+v", err)
+		return err
+	}
+	if err := r.addTable(toDatabase, &tconf); err != nil {
+		log.Error("router.table.move.add.table.error:%+v", err)
+		return err
+	}
+	if err := r.removeTable(database, tableName); err != nil {
+		log.Error("router.table.move.remove.table.error:%+v", err)
+		return err
+	}
+	if err := r.removeTableFrmData(database, tableName); err != nil {
+		log.Error("router.table.move.remove.frmdata.error:%+v", err)
+		return err
+	}
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("router.table.move.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
 // ReLoad used to re-load the config files from disk to cache.
 func (r *Router) ReLoad() error {
 	log := r.log
 
-	// Clear the cache.
-	log.Warning("router.reload.clear...")
-	r.clear()
-
-	// ReLoad the meta from disk.
+	// ReLoad the meta from disk, the cache is cleared by the loading under the lock,
+	// the querys read the old snapshot until the loading is done.
 	log.Warning("router.reload.load.meta.from.disk...")
 	return r.LoadConfig()
 }
@@ -11,6 +11,8 @@ package router
 import (
 	"testing"
 
+	"config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -24,6 +26,7 @@ func TestApiRules(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		tConf, err := router.TableConfig("sbtest", "A")
 		assert.Nil(t, err)
@@ -46,6 +49,7 @@ func TestApiPartitionRuleShift(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		tConf, err := router.TableConfig("sbtest", "A")
 		assert.Nil(t, err)
@@ -130,6 +134,7 @@ func TestApiPartitionRuleShiftGlobal(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableGConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		tConf, err := router.TableConfig("sbtest", "G")
 		assert.Nil(t, err)
@@ -243,6 +248,7 @@ func TestApiPartitionRuleShiftErrors(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		tConf, err := router.TableConfig("sbtest", "A")
 		assert.Nil(t, err)
@@ -289,6 +295,7 @@ func TestApiPartitionRuleShiftErrors(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableGConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		tConf, err := router.TableConfig("sbtest", "G")
 		assert.Nil(t, err)
@@ -353,3 +360,140 @@ func TestApiReLoad(t *testing.T) {
 	got := rules.Schemas[0].DB
 	assert.Equal(t, want, got)
 }
+
+func TestApiRenameSegments(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("sbtest")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("sbtest", "t1", "id", TableTypePartition, backends, nil)
+	assert.Nil(t, err)
+	naming := &config.SegmentNaming{Prefix: "_p", Width: 3}
+
+	// Renames.
+	renames, err := router.SegmentRenames("sbtest", "t1", naming)
+	assert.Nil(t, err)
+	assert.Equal(t, 32, len(renames))
+	assert.Equal(t, SegmentRename{Backend: "backend1", From: "t1_0000", To: "t1_p000"}, renames[0])
+	assert.Equal(t, SegmentRename{Backend: "backend2", From: "t1_0031", To: "t1_p031"}, renames[31])
+
+	// Rename.
+	{
+		err := router.RenameSegments("sbtest", "t1", naming, renames)
+		assert.Nil(t, err)
+		segments, err := router.Lookup("sbtest", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_p000", segments[0].Table)
+		assert.Equal(t, "t1_p031", segments[31].Table)
+
+		tconf, err := router.readTableFrmData(router.metadir + "/sbtest/t1.json")
+		assert.Nil(t, err)
+		assert.Equal(t, naming, tconf.SegmentNaming)
+		assert.Equal(t, "t1_p001", tconf.Partitions[1].Table)
+
+		// Already renamed.
+		renames, err := router.SegmentRenames("sbtest", "t1", naming)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(renames))
+	}
+
+	// Errors.
+	{
+		err := router.CreateTable("sbtest", "t2", "", TableTypeGlobal, backends, nil)
+		assert.Nil(t, err)
+		err = router.CreateTable("sbtest", "t1_x000", "", TableTypeGlobal, backends, nil)
+		assert.Nil(t, err)
+
+		tests := []struct {
+			table  string
+			naming *config.SegmentNaming
+		}{
+			{"t2", naming},
+			{"t9", naming},
+			{"t1", &config.SegmentNaming{Width: 4}},
+			{"t1", &config.SegmentNaming{Prefix: "_", Width: 0}},
+			{"t1", &config.SegmentNaming{Prefix: "`", Width: 4}},
+			{"t1", &config.SegmentNaming{Prefix: "_x", Width: 3}},
+			{"t1", &config.SegmentNaming{Prefix: "_0123456789012345678901234567890123456789012345678901234567890123", Width: 3}},
+		}
+		for _, test := range tests {
+			_, err := router.SegmentRenames("sbtest", test.table, test.naming)
+			assert.NotNil(t, err, "%+v", test)
+		}
+	}
+}
+
+func TestApiRenameTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("sbtest")
+	router.CreateDatabase("db2")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("sbtest", "t1", "id", TableTypePartition, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("sbtest", "g1", "", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+	err = router.SetShardMap("sbtest", "t1", &config.ShardMapConfig{Keys: []*config.ShardMapKey{{Key: "1", Segment: "t1_0031"}}})
+	assert.Nil(t, err)
+
+	// Move to the other database with the new name.
+	{
+		renames, err := router.TableRenames("sbtest", "t1", "db2", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, 32, len(renames))
+		assert.Equal(t, SegmentRename{Backend: "backend1", From: "t1_0000", To: "t2_0000"}, renames[0])
+
+		err = router.RenameTable("sbtest", "t1", "db2", "t2", renames)
+		assert.Nil(t, err)
+		_, err = router.TableConfig("sbtest", "t1")
+		assert.NotNil(t, err)
+		segments, err := router.Lookup("db2", "t2", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "t2_0031", segments[31].Table)
+
+		tconf, err := router.readTableFrmData(router.metadir + "/db2/t2.json")
+		assert.Nil(t, err)
+		assert.Equal(t, "t2", tconf.Name)
+		assert.Equal(t, "t2_0001", tconf.Partitions[1].Table)
+		assert.Equal(t, "t2_0031", tconf.ShardMap.Keys[0].Segment)
+	}
+
+	// Move the global table.
+	{
+		renames, err := router.TableRenames("sbtest", "g1", "db2", "g1")
+		assert.Nil(t, err)
+		assert.Equal(t, SegmentRename{Backend: "backend2", From: "g1", To: "g1"}, renames[1])
+		err = router.RenameTable("sbtest", "g1", "db2", "g1", renames)
+		assert.Nil(t, err)
+	}
+
+	// Errors.
+	{
+		err := router.CreateTable("sbtest", "t3", "id", TableTypePartition, backends, nil)
+		assert.Nil(t, err)
+		err = router.CreateTrigger("sbtest", "t3", &config.TriggerConfig{Name: "trg1", Timing: "BEFORE", Event: "INSERT", Body: "set @a=1"})
+		assert.Nil(t, err)
+
+		tests := []struct {
+			db, table, toDB, toTable string
+		}{
+			{"sbtest", "t9", "db2", "t9"},
+			{"sbtest", "t3", "db9", "t3"},
+			{"sbtest", "t3", "db2", "t2"},
+			{"sbtest", "t3", "db2", "t3"},
+			{"sbtest", "t3", "sbtest", "t3_0000_0123456789012345678901234567890123456789012345678901234567890123"},
+		}
+		for _, test := range tests {
+			_, err := router.TableRenames(test.db, test.table, test.toDB, test.toTable)
+			assert.NotNil(t, err, "%+v", test)
+		}
+
+		// The trigger is kept in the same database.
+		_, err = router.TableRenames("sbtest", "t3", "sbtest", "t4")
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"monitor"
+)
+
+type tableEntry struct {
+	stub  *Table
+	table *Table
+}
+
+type tableLoad struct {
+	done  chan struct{}
+	table *Table
+	err   error
+}
+
+// tableCache is the LRU of the tables loaded from the stubs in the lazy mode.
+// The entries are keyed by the stub, so the entry of a dropped or reloaded table
+// is never returned for the new table with the same name.
+type tableCache struct {
+	mu      sync.Mutex
+	size    int
+	epoch   int
+	lru     *list.List
+	entries map[*Table]*list.Element
+	// loading is the loads in flight, the concurrent accesses of a stub wait for the same load.
+	loading map[*Table]*tableLoad
+}
+
+// newTableCache creates the new cache, the size 0 means no limit.
+func newTableCache(size int) *tableCache {
+	return &tableCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[*Table]*list.Element),
+		loading: make(map[*Table]*tableLoad),
+	}
+}
+
+// get returns the loaded table of the stub, the load is called on the miss.
+func (c *tableCache) get(stub *Table, load func() (*Table, error)) (*Table, error) {
+	c.mu.Lock()
+	if elem, ok := c.entries[stub]; ok {
+		c.lru.MoveToFront(elem)
+		c.mu.Unlock()
+		monitor.RouterTableCacheInc("hit")
+		return elem.Value.(*tableEntry).table, nil
+	}
+	if l, ok := c.loading[stub]; ok {
+		c.mu.Unlock()
+		<-l.done
+		monitor.RouterTableCacheInc("hit")
+		return l.table, l.err
+	}
+	l := &tableLoad{done: make(chan struct{})}
+	c.loading[stub] = l
+	epoch := c.epoch
+	c.mu.Unlock()
+
+	monitor.RouterTableCacheInc("miss")
+	start := time.Now()
+	l.table, l.err = load()
+	monitor.RouterTableLoadObserve(time.Since(start))
+
+	c.mu.Lock()
+	// The purged stubs are not cached.
+	if epoch == c.epoch {
+		delete(c.loading, stub)
+		if l.err == nil {
+			c.add(stub, l.table)
+		}
+	}
+	c.mu.Unlock()
+	close(l.done)
+	return l.table, l.err
+}
+
+// add used to add the entry and evict the least recently used, it must be called with the lock held.
+func (c *tableCache) add(stub *Table, table *Table) {
+	c.entries[stub] = c.lru.PushFront(&tableEntry{stub: stub, table: table})
+	for c.size > 0 && c.lru.Len() > c.size {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*tableEntry).stub)
+	}
+	monitor.RouterTableCachedSet(float64(c.lru.Len()))
+}
+
+// remove used to remove the entry of the stub.
+func (c *tableCache) remove(stub *Table) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[stub]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, stub)
+		monitor.RouterTableCachedSet(float64(c.lru.Len()))
+	}
+}
+
+// purge used to remove all the entries and returns the new epoch, the loads in flight are not cached.
+func (c *tableCache) purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.lru.Init()
+	c.entries = make(map[*Table]*list.Element)
+	c.loading = make(map[*Table]*tableLoad)
+	monitor.RouterTableCachedSet(0)
+	return c.epoch
+}
+
+// full returns true if the cache is full or purged since the epoch, the prefetch stops then.
+func (c *tableCache) full(epoch int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return epoch != c.epoch || (c.size > 0 && c.lru.Len() >= c.size)
+}
+
+// cached returns true if the stub is loaded.
+func (c *tableCache) cached(stub *Table) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[stub]
+	return ok
+}
+
+// len returns the number of the loaded tables.
+func (c *tableCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
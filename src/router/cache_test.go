@@ -0,0 +1,93 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableCache(t *testing.T) {
+	cache := newTableCache(2)
+	stubs := []*Table{{Name: "t1", file: "t1.json"}, {Name: "t2", file: "t2.json"}, {Name: "t3", file: "t3.json"}}
+	var loads int32
+	load := func(stub *Table) func() (*Table, error) {
+		return func() (*Table, error) {
+			atomic.AddInt32(&loads, 1)
+			return &Table{Name: stub.Name}, nil
+		}
+	}
+
+	for _, stub := range stubs {
+		table, err := cache.get(stub, load(stub))
+		assert.Nil(t, err)
+		assert.Equal(t, stub.Name, table.Name)
+	}
+	assert.EqualValues(t, 3, loads)
+	assert.Equal(t, 2, cache.len())
+	assert.False(t, cache.cached(stubs[0]))
+
+	// Hit.
+	_, err := cache.get(stubs[1], load(stubs[1]))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, loads)
+
+	// Miss the evicted and evict the t3.
+	_, err = cache.get(stubs[0], load(stubs[0]))
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, loads)
+	assert.True(t, cache.cached(stubs[1]))
+	assert.False(t, cache.cached(stubs[2]))
+
+	// The error is not cached.
+	_, err = cache.get(stubs[2], func() (*Table, error) { return nil, errors.New("mock.load.error") })
+	assert.NotNil(t, err)
+	assert.False(t, cache.cached(stubs[2]))
+
+	cache.remove(stubs[0])
+	assert.Equal(t, 1, cache.len())
+	epoch := cache.purge()
+	assert.Equal(t, 0, cache.len())
+	assert.False(t, cache.full(epoch))
+	assert.True(t, cache.full(epoch-1))
+}
+
+func TestTableCacheConcurrentLoad(t *testing.T) {
+	cache := newTableCache(0)
+	stub := &Table{Name: "t1", file: "t1.json"}
+	var loads int32
+	release := make(chan struct{})
+	load := func() (*Table, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return &Table{Name: "t1"}, nil
+	}
+
+	var wg sync.WaitGroup
+	tables := make([]*Table, 8)
+	for i := range tables {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tables[i], _ = cache.get(stub, load)
+		}(i)
+	}
+	for atomic.LoadInt32(&loads) == 0 {
+	}
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 1, loads)
+	for _, table := range tables {
+		assert.Equal(t, tables[0], table)
+	}
+}
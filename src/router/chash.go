@@ -0,0 +1,212 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// chashVirtualNodes is the positions of one segment on the ring.
+	chashVirtualNodes = 64
+)
+
+// CHashRange for Segment.Range, the positions of the segment on the ring.
+type CHashRange struct {
+	Ring []uint32
+}
+
+// String returns the positions info.
+func (r *CHashRange) String() string {
+	return fmt.Sprintf("ring[%d]", len(r.Ring))
+}
+
+// Less impl.
+func (r *CHashRange) Less(b KeyRange) bool {
+	return false
+}
+
+type ringPoint struct {
+	position uint32
+	index    int
+}
+
+// CHash for the CHASH table router, the segments are placed on the hash ring by their positions and
+// the key is on the segment of the first position at or after the position of the key.
+// The segments of the table are fixed once it's created, there's no operation to add a backend to it.
+type CHash struct {
+	log *xlog.Log
+
+	// chash method.
+	typ MethodType
+
+	// table config.
+	conf *config.TableConfig
+
+	// Segments slice.
+	Segments []Segment `json:",omitempty"`
+
+	// ring is the positions of all the segments sorted.
+	ring []ringPoint
+
+	// binary and temporal are the same as the Hash.
+	binary   bool
+	temporal bool
+	loc      *time.Location
+}
+
+// NewCHash creates new chash.
+func NewCHash(log *xlog.Log, conf *config.TableConfig) *CHash {
+	return &CHash{
+		log:      log,
+		conf:     conf,
+		typ:      methodTypeCHash,
+		Segments: make([]Segment, 0, 16),
+		binary:   isBinaryShardKey(conf),
+		temporal: isTemporalShardKey(conf),
+	}
+}
+
+// Build used to build the Segments and the ring from schema config.
+func (c *CHash) Build() error {
+	var err error
+	if c.temporal {
+		if c.loc, err = config.ParseTimeZone(c.conf.TimeZone); err != nil {
+			return err
+		}
+	}
+
+	positions := make(map[uint32]string)
+	for i, part := range c.conf.Partitions {
+		if len(part.Ring) == 0 {
+			return errors.Errorf("chash.partition[%v].ring.can't.be.empty", part.Table)
+		}
+		for _, position := range part.Ring {
+			if table, ok := positions[position]; ok {
+				return errors.Errorf("chash.partition[%v].position[%v].overlapped.with[%v]", part.Table, position, table)
+			}
+			positions[position] = part.Table
+			c.ring = append(c.ring, ringPoint{position: position, index: i})
+		}
+		c.Segments = append(c.Segments, Segment{
+			Table:   part.Table,
+			Backend: part.Backend,
+			Range:   &CHashRange{Ring: part.Ring},
+		})
+	}
+	if len(c.ring) == 0 {
+		return errors.Errorf("chash.table[%v].ring.can't.be.empty", c.conf.Name)
+	}
+	sort.Slice(c.ring, func(i, j int) bool { return c.ring[i].position < c.ring[j].position })
+	return nil
+}
+
+// Lookup used to lookup partition(s) through the sharding-key range,
+// the equal one is on the segment of its position and the range is on all the segments.
+func (c *CHash) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment, error) {
+	if start == nil || end == nil {
+		return c.Segments, nil
+	}
+	if start.Type != end.Type {
+		return nil, errors.Errorf("chash.lookup.key.type.must.be.same:[%v!=%v]", start.Type, end.Type)
+	}
+	if bytes.Equal(start.Val, end.Val) {
+		idx, err := c.GetIndex(start)
+		if err != nil {
+			return nil, err
+		}
+		segment, err := c.GetSegment(idx)
+		if err != nil {
+			return nil, err
+		}
+		return []Segment{segment}, nil
+	}
+	return c.Segments, nil
+}
+
+// Type returns the chash type.
+func (c *CHash) Type() MethodType {
+	return c.typ
+}
+
+// GetIndex returns the index of the segment which the sqlval is on, the key is the same canonical one as the Hash.
+func (c *CHash) GetIndex(sqlval *sqlparser.SQLVal) (int, error) {
+	var key hashKey
+	var err error
+	switch {
+	case c.binary:
+		key, err = binaryHashKey(sqlval)
+	case c.temporal:
+		var t time.Time
+		if t, err = temporalKey(sqlval, c.conf.ShardKeyType, c.loc); err == nil {
+			key = temporalHashKey(t)
+		}
+	default:
+		key, err = canonicalHashKey(sqlval)
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	position := ringPosition(key)
+	i := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].position >= position })
+	// The ring wraps around to the first position.
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.ring[i].index, nil
+}
+
+// GetSegments returns Segments.
+func (c *CHash) GetSegments() []Segment {
+	return c.Segments
+}
+
+// GetSegment returns the segment of the index.
+func (c *CHash) GetSegment(index int) (Segment, error) {
+	if index < 0 || index >= len(c.Segments) {
+		return Segment{}, errors.Errorf("chash.getsegment.index.[%d].out.of.range", index)
+	}
+	return c.Segments[index], nil
+}
+
+// ringPosition returns the position of the key on the ring.
+func ringPosition(key hashKey) uint32 {
+	var data []byte
+	if key.isInt {
+		data = make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, key.uval)
+	} else {
+		data = []byte(key.str)
+	}
+	sum := md5.Sum(data)
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// ringPositions returns the positions of the n-th node of the ring, the tables created on the same backends
+// have the same positions so their segments of the same key are on the same backend.
+func ringPositions(node int) []uint32 {
+	positions := make([]uint32, 0, chashVirtualNodes)
+	for i := 0; i < chashVirtualNodes; i++ {
+		sum := md5.Sum([]byte(fmt.Sprintf("node%d-%d", node, i)))
+		positions = append(positions, binary.BigEndian.Uint32(sum[:4]))
+	}
+	return positions
+}
@@ -0,0 +1,215 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestCHash(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	chash := NewCHash(log, MockTableCHConfig())
+	{
+		err := chash.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, string(chash.Type()), methodTypeCHash)
+		assert.Equal(t, 2, len(chash.GetSegments()))
+		assert.Equal(t, "ring[64]", chash.Segments[0].Range.String())
+		assert.Equal(t, 128, len(chash.ring))
+	}
+
+	// GetIndex, the equal keys are on the same segment.
+	{
+		tests := []struct {
+			x *sqlparser.SQLVal
+			y *sqlparser.SQLVal
+		}{
+			{sqlparser.NewIntVal([]byte("1")), sqlparser.NewStrVal([]byte("01"))},
+			{sqlparser.NewIntVal([]byte("2")), sqlparser.NewFloatVal([]byte("2.0"))},
+			{sqlparser.NewStrVal([]byte("BeiJing ")), sqlparser.NewStrVal([]byte("beijing"))},
+		}
+		for _, test := range tests {
+			x, err := chash.GetIndex(test.x)
+			assert.Nil(t, err)
+			y, err := chash.GetIndex(test.y)
+			assert.Nil(t, err)
+			assert.Equal(t, x, y, string(test.x.Val))
+		}
+
+		// The keys are on both segments.
+		counts := make([]int, 2)
+		for i := 0; i < 1000; i++ {
+			idx, err := chash.GetIndex(sqlparser.NewIntVal([]byte(fmt.Sprintf("%d", i))))
+			assert.Nil(t, err)
+			counts[idx]++
+		}
+		assert.True(t, counts[0] > 300 && counts[1] > 300, fmt.Sprintf("%v", counts))
+
+		_, err := chash.GetIndex(sqlparser.NewValArg([]byte("::arg")))
+		assert.NotNil(t, err)
+	}
+
+	// Lookup.
+	{
+		one := sqlparser.NewIntVal([]byte("1"))
+		two := sqlparser.NewIntVal([]byte("2"))
+		idx, err := chash.GetIndex(one)
+		assert.Nil(t, err)
+		parts, err := chash.Lookup(one, one)
+		assert.Nil(t, err)
+		assert.Equal(t, []Segment{chash.Segments[idx]}, parts)
+
+		parts, err = chash.Lookup(one, two)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(parts))
+
+		parts, err = chash.Lookup(nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(parts))
+
+		_, err = chash.Lookup(one, sqlparser.NewStrVal([]byte("1")))
+		assert.NotNil(t, err)
+
+		_, err = chash.GetSegment(2)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestCHashError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Empty ring.
+	{
+		conf := MockTableCHConfig()
+		conf.Partitions[1].Ring = nil
+		chash := NewCHash(log, conf)
+		assert.Equal(t, "chash.partition[CH_0001].ring.can't.be.empty", chash.Build().Error())
+	}
+
+	// Overlapped.
+	{
+		conf := MockTableCHConfig()
+		conf.Partitions[1].Ring = []uint32{conf.Partitions[0].Ring[3]}
+		chash := NewCHash(log, conf)
+		assert.Equal(t, fmt.Sprintf("chash.partition[CH_0001].position[%d].overlapped.with[CH_0000]", conf.Partitions[0].Ring[3]), chash.Build().Error())
+	}
+
+	// No partitions.
+	{
+		conf := MockTableCHConfig()
+		conf.Partitions = nil
+		chash := NewCHash(log, conf)
+		assert.Equal(t, "chash.table[CH].ring.can't.be.empty", chash.Build().Error())
+	}
+}
+
+func TestCHashAddBackend(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	// The segments of the 5th backend are the next nodes of the ring.
+	conf, err := router.CHashUniform("t1", "id", []string{"backend1", "backend2", "backend3", "backend4"})
+	assert.Nil(t, err)
+	from := NewCHash(log, conf)
+	assert.Nil(t, from.Build())
+
+	expanded := *conf
+	expanded.Partitions = append([]*config.PartitionConfig{}, conf.Partitions...)
+	nodes := len(conf.Partitions)
+	for i := 0; i < nodes/4; i++ {
+		expanded.Partitions = append(expanded.Partitions, &config.PartitionConfig{
+			Table:   fmt.Sprintf("t1_%04d", nodes+i),
+			Backend: "backend5",
+			Ring:    ringPositions(nodes + i),
+		})
+	}
+	to := NewCHash(log, &expanded)
+	assert.Nil(t, to.Build())
+
+	keys, moved := 10000, 0
+	for i := 0; i < keys; i++ {
+		val := sqlparser.NewIntVal([]byte(fmt.Sprintf("%d", i)))
+		x, err := from.GetIndex(val)
+		assert.Nil(t, err)
+		y, err := to.GetIndex(val)
+		assert.Nil(t, err)
+		if x != y {
+			// The moved keys all go to the new backend.
+			assert.Equal(t, "backend5", to.Segments[y].Backend)
+			moved++
+		}
+	}
+	// About 1/5 of the keys are moved.
+	assert.True(t, moved > keys/10 && moved < keys*3/10, fmt.Sprintf("moved:%d", moved))
+}
+
+func TestRouterCHash(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	backends := []string{"backend1", "backend2"}
+	err = router.CreateTable("sbtest", "t1", "id", TableTypeCHash, backends, &Extra{})
+	assert.Nil(t, err)
+	err = router.CreateTable("sbtest", "t2", "id", TableTypeCHash, backends, &Extra{})
+	assert.Nil(t, err)
+
+	tconf, err := router.TableConfig("sbtest", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "CHASH", tconf.ShardType)
+	assert.Equal(t, 32, len(tconf.Partitions))
+	assert.Equal(t, "t1_0000", tconf.Partitions[0].Table)
+	assert.Equal(t, "backend1", tconf.Partitions[0].Backend)
+	assert.Equal(t, ringPositions(0), tconf.Partitions[0].Ring)
+	assert.Equal(t, "backend2", tconf.Partitions[31].Backend)
+
+	// The ring is in the JSON.
+	assert.True(t, strings.Contains(router.JSON(), `"Ring": [`))
+
+	// The same key is on the same backend of the tables.
+	for i := 0; i < 100; i++ {
+		val := sqlparser.NewIntVal([]byte(fmt.Sprintf("%d", i)))
+		x, err := router.Lookup("sbtest", "t1", val, val)
+		assert.Nil(t, err)
+		y, err := router.Lookup("sbtest", "t2", val, val)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(x))
+		assert.Equal(t, x[0].Backend, y[0].Backend)
+		assert.Equal(t, strings.TrimPrefix(x[0].Table, "t1"), strings.TrimPrefix(y[0].Table, "t2"))
+	}
+
+	// Reload from the frm files.
+	val := sqlparser.NewStrVal([]byte("x"))
+	idx, err := router.GetIndex("sbtest", "t1", val)
+	assert.Nil(t, err)
+	err = router.ReLoad()
+	assert.Nil(t, err)
+	got, err := router.GetIndex("sbtest", "t1", val)
+	assert.Nil(t, err)
+	assert.Equal(t, idx, got)
+
+	// Errors.
+	_, err = router.CHashUniform("t1", "", backends)
+	assert.Equal(t, "shard.key.cant.be.null", err.Error())
+	_, err = router.CHashUniform("", "id", backends)
+	assert.Equal(t, "table.cant.be.null", err.Error())
+	_, err = router.CHashUniform("t1", "id", nil)
+	assert.Equal(t, "router.compute.backends.is.null", err.Error())
+}
@@ -19,6 +19,12 @@ import (
 
 // HashUniform used to uniform the hash slots to backends.
 func (r *Router) HashUniform(table, shardkey string, backends []string) (*config.TableConfig, error) {
+	return r.hashUniform(table, shardkey, backends, r.conf.Partitions)
+}
+
+// hashUniform used to uniform the hash slots to the partitions segments of the backends,
+// 0 partitions means the segments of the blocks slots.
+func (r *Router) hashUniform(table, shardkey string, backends []string, partitions int) (*config.TableConfig, error) {
 	if table == "" {
 		return nil, errors.New("table.cant.be.null")
 	}
@@ -36,15 +42,43 @@ func (r *Router) HashUniform(table, shardkey string, backends []string) (*config
 		return nil, errors.Errorf("router.compute.backends[%d].too.many:[max:%d]", nums, slots)
 	}
 
+	naming := r.conf.SegmentNaming
+	if naming == nil {
+		naming = config.DefaultSegmentNaming()
+	}
+
 	// sort backends.
 	sort.Strings(backends)
 	tableConf := &config.TableConfig{
-		Name:       table,
-		Slots:      r.conf.Slots,
-		Blocks:     r.conf.Blocks,
-		ShardKey:   shardkey,
-		ShardType:  methodTypeHash,
-		Partitions: make([]*config.PartitionConfig, 0, 16),
+		Name:          table,
+		Slots:         r.conf.Slots,
+		Blocks:        r.conf.Blocks,
+		ShardKey:      shardkey,
+		ShardType:     methodTypeHash,
+		Partitions:    make([]*config.PartitionConfig, 0, 16),
+		SegmentNaming: r.conf.SegmentNaming,
+	}
+
+	// The slots are divided to the partitions evenly.
+	if partitions > 0 {
+		counts, err := r.partitionCounts(nums, partitions)
+		if err != nil {
+			return nil, err
+		}
+		tableConf.Blocks = slots / partitions
+		name := 0
+		for s, count := range counts {
+			for i := 0; i < count; i++ {
+				partConf := &config.PartitionConfig{
+					Table:   naming.Name(table, name),
+					Segment: fmt.Sprintf("%d-%d", name*slots/partitions, (name+1)*slots/partitions),
+					Backend: backends[s],
+				}
+				tableConf.Partitions = append(tableConf.Partitions, partConf)
+				name++
+			}
+		}
+		return tableConf, nil
 	}
 
 	slotsPerShard := slots / nums
@@ -63,7 +97,7 @@ func (r *Router) HashUniform(table, shardkey string, backends []string) (*config
 			}
 			name := s*tablesPerShard + i
 			partConf := &config.PartitionConfig{
-				Table:   fmt.Sprintf("%s_%04d", table, name),
+				Table:   naming.Name(table, name),
 				Segment: fmt.Sprintf("%d-%d", min, max),
 				Backend: backends[s],
 			}
@@ -73,6 +107,99 @@ func (r *Router) HashUniform(table, shardkey string, backends []string) (*config
 	return tableConf, nil
 }
 
+// CHashUniform used to place the segments of the CHASH table on the ring, the backends have the same segments
+// as the HashUniform and the n-th segment is the n-th node of the ring. The segments are assigned to the backends
+// in the name order, so the same backends give the same placement.
+func (r *Router) CHashUniform(table, shardkey string, backends []string) (*config.TableConfig, error) {
+	return r.chashUniform(table, shardkey, backends, r.conf.Partitions)
+}
+
+// chashUniform used to place the partitions segments of the backends on the ring,
+// 0 partitions means the same segments as the HashUniform of the blocks.
+func (r *Router) chashUniform(table, shardkey string, backends []string, partitions int) (*config.TableConfig, error) {
+	if table == "" {
+		return nil, errors.New("table.cant.be.null")
+	}
+	if shardkey == "" {
+		return nil, errors.New("shard.key.cant.be.null")
+	}
+
+	nums := len(backends)
+	if nums == 0 {
+		return nil, errors.New("router.compute.backends.is.null")
+	}
+	var counts []int
+	if partitions > 0 {
+		var err error
+		if counts, err = r.partitionCounts(nums, partitions); err != nil {
+			return nil, err
+		}
+	} else {
+		tablesPerShard := r.conf.Slots / nums / r.conf.Blocks
+		if tablesPerShard == 0 {
+			return nil, errors.Errorf("router.compute.backends[%d].too.many:[max:%d]", nums, r.conf.Slots/r.conf.Blocks)
+		}
+		counts = make([]int, nums)
+		for s := range counts {
+			counts[s] = tablesPerShard
+		}
+	}
+
+	naming := r.conf.SegmentNaming
+	if naming == nil {
+		naming = config.DefaultSegmentNaming()
+	}
+
+	// sort backends.
+	sort.Strings(backends)
+	tableConf := &config.TableConfig{
+		Name:          table,
+		ShardKey:      shardkey,
+		ShardType:     methodTypeCHash,
+		Partitions:    make([]*config.PartitionConfig, 0, 16),
+		SegmentNaming: r.conf.SegmentNaming,
+	}
+
+	// The positions taken by the former nodes are skipped.
+	positions := make(map[uint32]bool)
+	name := 0
+	for s, count := range counts {
+		for i := 0; i < count; i++ {
+			ring := make([]uint32, 0, chashVirtualNodes)
+			for _, position := range ringPositions(name) {
+				if !positions[position] {
+					positions[position] = true
+					ring = append(ring, position)
+				}
+			}
+			partConf := &config.PartitionConfig{
+				Table:   naming.Name(table, name),
+				Backend: backends[s],
+				Ring:    ring,
+			}
+			tableConf.Partitions = append(tableConf.Partitions, partConf)
+			name++
+		}
+	}
+	return tableConf, nil
+}
+
+// partitionCounts returns the number of the segments of each backend, the partitions are spread evenly
+// and the former backends have one more if they are not divisible.
+func (r *Router) partitionCounts(nums, partitions int) ([]int, error) {
+	if partitions < nums || partitions > r.conf.Slots {
+		return nil, errors.Errorf("router.compute.partitions[%d].out.of.range:[min:%d, max:%d]", partitions, nums, r.conf.Slots)
+	}
+	counts := make([]int, nums)
+	for s := range counts {
+		counts[s] = partitions / nums
+		if s < partitions%nums {
+			counts[s]++
+		}
+	}
+	return counts, nil
+}
+
 // GlobalUniform used to uniform the global table to backends.
 func (r *Router) GlobalUniform(table string, backends []string) (*config.TableConfig, error) {
 	if table == "" {
@@ -120,3 +247,58 @@ func (r *Router) SingleUniform(table string, backends []string) (*config.TableCo
 		}},
 	}, nil
 }
+
+// ListUniform used to place the list partitions on their backends, every partition is one segment.
+func (r *Router) ListUniform(table, shardkey string, backends []string, partitions []ListPartition) (*config.TableConfig, error) {
+	if table == "" {
+		return nil, errors.New("table.cant.be.null")
+	}
+	if shardkey == "" {
+		return nil, errors.New("shard.key.cant.be.null")
+	}
+	if len(partitions) == 0 {
+		return nil, errors.New("router.compute.list.partitions.is.null")
+	}
+	known := make(map[string]bool, len(backends))
+	for _, backend := range backends {
+		known[backend] = true
+	}
+
+	naming := r.conf.SegmentNaming
+	if naming == nil {
+		naming = config.DefaultSegmentNaming()
+	}
+	tableConf := &config.TableConfig{
+		Name:          table,
+		ShardKey:      shardkey,
+		ShardType:     methodTypeList,
+		Partitions:    make([]*config.PartitionConfig, 0, len(partitions)),
+		SegmentNaming: r.conf.SegmentNaming,
+	}
+	seen := make(map[string]bool)
+	for i, part := range partitions {
+		if !known[part.Backend] {
+			return nil, errors.Errorf("router.compute.list.partition.backend[%s].can.not.be.found", part.Backend)
+		}
+		if len(part.Values) == 0 {
+			return nil, errors.Errorf("router.compute.list.partition.backend[%s].values.is.null", part.Backend)
+		}
+		partConf := &config.PartitionConfig{
+			Table:   naming.Name(table, i),
+			Backend: part.Backend,
+		}
+		for _, val := range part.Values {
+			key, err := canonicalHashKey(val)
+			if err != nil {
+				return nil, err
+			}
+			if seen[key.String()] {
+				return nil, errors.Errorf("router.compute.list.value[%s].duplicate", key.String())
+			}
+			seen[key.String()] = true
+			partConf.ListValues = append(partConf.ListValues, key.String())
+		}
+		tableConf.Partitions = append(tableConf.Partitions, partConf)
+	}
+	return tableConf, nil
+}
@@ -15,6 +15,7 @@ import (
 	"config"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -355,3 +356,111 @@ func TestRouterComputeSingleError(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestRouterComputeHashSegmentNaming(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockNewRouterConfig()
+	conf.SegmentNaming = &config.SegmentNaming{Prefix: "_p", Suffix: "_old", Width: 2}
+	router := NewRouter(log, "", conf)
+
+	got, err := router.HashUniform("t1", "id", []string{"backend1", "backend2"})
+	assert.Nil(t, err)
+	assert.Equal(t, conf.SegmentNaming, got.SegmentNaming)
+	assert.Equal(t, 32, len(got.Partitions))
+	assert.Equal(t, "t1_p00_old", got.Partitions[0].Table)
+	assert.Equal(t, "t1_p31_old", got.Partitions[31].Table)
+}
+
+func TestRouterComputeListError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	backends := []string{"backend1", "backend2"}
+	one := sqlparser.NewIntVal([]byte("1"))
+	tests := []struct {
+		table      string
+		shardKey   string
+		partitions []ListPartition
+		err        string
+	}{
+		{"", "id", []ListPartition{{Backend: "backend1", Values: []*sqlparser.SQLVal{one}}}, "table.cant.be.null"},
+		{"t1", "", []ListPartition{{Backend: "backend1", Values: []*sqlparser.SQLVal{one}}}, "shard.key.cant.be.null"},
+		{"t1", "id", nil, "router.compute.list.partitions.is.null"},
+		{"t1", "id", []ListPartition{{Backend: "backend3", Values: []*sqlparser.SQLVal{one}}}, "router.compute.list.partition.backend[backend3].can.not.be.found"},
+		{"t1", "id", []ListPartition{{Backend: "backend1"}}, "router.compute.list.partition.backend[backend1].values.is.null"},
+		{"t1", "id", []ListPartition{{Backend: "backend1", Values: []*sqlparser.SQLVal{one}}, {Backend: "backend2", Values: []*sqlparser.SQLVal{sqlparser.NewStrVal([]byte("01"))}}}, "router.compute.list.value[1].duplicate"},
+	}
+	for _, test := range tests {
+		_, err := router.ListUniform(test.table, test.shardKey, backends, test.partitions)
+		assert.Equal(t, test.err, err.Error())
+	}
+}
+
+func TestRouterComputePartitions(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+	backends := []string{"backend2", "backend1"}
+
+	// HASH.
+	{
+		got, err := router.hashUniform("t1", "id", backends, 5)
+		assert.Nil(t, err)
+		assert.Equal(t, 819, got.Blocks)
+		want := []string{
+			"t1_0000:0-819@backend1",
+			"t1_0001:819-1638@backend1",
+			"t1_0002:1638-2457@backend1",
+			"t1_0003:2457-3276@backend2",
+			"t1_0004:3276-4096@backend2",
+		}
+		var parts []string
+		for _, part := range got.Partitions {
+			parts = append(parts, fmt.Sprintf("%s:%s@%s", part.Table, part.Segment, part.Backend))
+		}
+		assert.Equal(t, want, parts)
+	}
+
+	// CHASH.
+	{
+		got, err := router.chashUniform("t1", "id", backends, 3)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(got.Partitions))
+		assert.Equal(t, "backend1", got.Partitions[1].Backend)
+		assert.Equal(t, "backend2", got.Partitions[2].Backend)
+	}
+
+	// Out of range.
+	{
+		_, err := router.hashUniform("t1", "id", backends, 1)
+		assert.Equal(t, "router.compute.partitions[1].out.of.range:[min:2, max:4096]", err.Error())
+		_, err = router.chashUniform("t1", "id", backends, 4097)
+		assert.Equal(t, "router.compute.partitions[4097].out.of.range:[min:2, max:4096]", err.Error())
+	}
+
+	// The PARTITIONS of the CREATE TABLE overrides the router config.
+	{
+		err := router.CreateDatabase("test")
+		assert.Nil(t, err)
+		router.conf.Partitions = 4
+		err = router.CreateTable("test", "t2", "id", "", backends, nil)
+		assert.Nil(t, err)
+		err = router.CreateTable("test", "t3", "id", TableTypeCHash, backends, &Extra{Partitions: 6})
+		assert.Nil(t, err)
+		router.conf.Partitions = 0
+
+		t2, err := router.TableConfig("test", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, 4, len(t2.Partitions))
+		t3, err := router.TableConfig("test", "t3")
+		assert.Nil(t, err)
+		assert.Equal(t, 6, len(t3.Partitions))
+
+		// The keys are routed to the segments.
+		for i := 0; i < 100; i++ {
+			_, err := router.Lookup("test", "t2", sqlparser.NewIntVal([]byte(fmt.Sprintf("%d", i))), nil)
+			assert.Nil(t, err)
+		}
+	}
+}
@@ -13,16 +13,21 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"config"
 
 	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 )
 
 const (
 	TableTypeSingle    = "single"
 	TableTypeGlobal    = "global"
 	TableTypePartition = "partition"
+	TableTypeList      = "list"
+	TableTypeCHash     = "chash"
 	TableTypeUnknow    = "unknow"
 )
 
@@ -113,7 +118,7 @@ func (r *Router) writeDatabaseFrmData(db string) error {
 
 func (r *Router) CreateDatabase(db string) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.unlock()
 
 	log := r.log
 	if err := r.addDatabase(db); err != nil {
@@ -135,7 +140,7 @@ func (r *Router) CreateDatabase(db string) error {
 // and remove all the table-schema files who belongs to this database.
 func (r *Router) DropDatabase(db string) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.unlock()
 
 	log := r.log
 	// Drop database from route.
@@ -163,79 +168,675 @@ func (r *Router) DropDatabase(db string) error {
 // Lock.
 func (r *Router) CreateTable(db, table, shardKey string, tableType string, backends []string, extra *Extra) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.unlock()
 
+	log := r.log
+	tableConf, err := r.tableUniform(table, shardKey, tableType, backends, extra)
+	if err != nil {
+		return err
+	}
+
+	// add config to router.
+	if err = r.addTable(db, tableConf); err != nil {
+		log.Error("frm.create.add.route.error:%v", err)
+		return err
+	}
+	if err = r.writeTableFrmData(db, table, tableConf); err != nil {
+		log.Error("frm.create.table[db:%v, table:%v].file.error:%+v", db, tableConf.Name, err)
+		return err
+	}
+
+	if err = config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.create.table.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// CreateTableLike used to add a table which has the same shard key, shard type and partition layout as the source table,
+// the segment is named by replacing the source table name prefix, such as 't1_0001' to 't2_0001'.
+// The triggers of the source table are not copied as MySQL does.
+// Lock.
+func (r *Router) CreateTableLike(db, table, fromDB, fromTable string) error {
+	from, err := r.getTable(fromDB, fromTable)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	naming := from.TableConfig.SegmentNaming
+	if naming == nil {
+		naming = config.DefaultSegmentNaming()
+	}
+	tableConf := *from.TableConfig
+	tableConf.Name = table
+	tableConf.Triggers = nil
+	tableConf.Partitions = make([]*config.PartitionConfig, 0, len(from.TableConfig.Partitions))
+	names := make(map[string]string)
+	for i, part := range from.TableConfig.Partitions {
+		p := *part
+		switch {
+		case p.Table == fromTable:
+			p.Table = table
+		case strings.HasPrefix(p.Table, fromTable):
+			p.Table = table + strings.TrimPrefix(p.Table, fromTable)
+		default:
+			p.Table = naming.Name(table, i)
+		}
+		if len(p.Table) > 64 {
+			return errors.Errorf("router.create.table.like.name[%s].too.long:[max:64]", p.Table)
+		}
+		if schema, ok := r.schemas[db]; ok && p.Table != table {
+			if _, ok := schema.Tables[p.Table]; ok {
+				return errors.Errorf("router.create.table.like.name[%s].conflicts.with.table[%s.%s]", p.Table, db, p.Table)
+			}
+		}
+		names[part.Table] = p.Table
+		tableConf.Partitions = append(tableConf.Partitions, &p)
+	}
+	tableConf.ShardMap = tableConf.ShardMap.Rename(names)
+	if tableConf.AutoIncrement != nil {
+		autoinc := *tableConf.AutoIncrement
+		tableConf.AutoIncrement = &autoinc
+	}
+
+	// add config to router.
+	if err = r.addTable(db, &tableConf); err != nil {
+		log.Error("frm.create.table.like.add.route.error:%v", err)
+		return err
+	}
+	if err = r.writeTableFrmData(db, table, &tableConf); err != nil {
+		log.Error("frm.create.table.like[db:%v, table:%v].file.error:%+v", db, table, err)
+		return err
+	}
+
+	if err = config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.create.table.like.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// PreviewTable used to build a new router which only has the table to be created,
+// the router and the schema files are not changed, used to plan the querys before the table is created.
+func (r *Router) PreviewTable(db, table, shardKey string, tableType string, backends []string, extra *Extra) (*Router, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if tbl, ok := r.schemas[db]; ok {
+		if _, ok := tbl.Tables[table]; ok {
+			return nil, errors.Errorf("router.add.db[%v].table[%v].exists", db, table)
+		}
+	}
+	tableConf, err := r.tableUniform(table, shardKey, tableType, backends, extra)
+	if err != nil {
+		return nil, err
+	}
+	preview := NewRouter(r.log, "", r.conf)
+	if err := preview.addTable(db, tableConf); err != nil {
+		return nil, err
+	}
+	preview.publish()
+	return preview, nil
+}
+
+func (r *Router) tableUniform(table, shardKey string, tableType string, backends []string, extra *Extra) (*config.TableConfig, error) {
 	var err error
 	var tableConf *config.TableConfig
-	log := r.log
 
+	partitions := r.conf.Partitions
+	if extra != nil && extra.Partitions > 0 {
+		partitions = extra.Partitions
+	}
 	switch tableType {
 	case TableTypeGlobal:
 		if tableConf, err = r.GlobalUniform(table, backends); err != nil {
-			return err
+			return nil, err
 		}
 	case TableTypeSingle:
 		if tableConf, err = r.SingleUniform(table, backends); err != nil {
-			return err
+			return nil, err
 		}
-	case TableTypePartition:
-		if tableConf, err = r.HashUniform(table, shardKey, backends); err != nil {
-			return err
+	case TableTypeList:
+		var partitions []ListPartition
+		if extra != nil {
+			partitions = extra.ListPartitions
+		}
+		if tableConf, err = r.ListUniform(table, shardKey, backends, partitions); err != nil {
+			return nil, err
+		}
+	case TableTypeCHash:
+		if tableConf, err = r.chashUniform(table, shardKey, backends, partitions); err != nil {
+			return nil, err
 		}
 	default:
-		if tableConf, err = r.HashUniform(table, shardKey, backends); err != nil {
-			return err
+		if tableConf, err = r.hashUniform(table, shardKey, backends, partitions); err != nil {
+			return nil, err
 		}
 	}
 
 	if extra != nil {
 		tableConf.AutoIncrement = extra.AutoIncrement
+		if tableConf.ShardType == methodTypeHash || tableConf.ShardType == methodTypeCHash {
+			tableConf.ShardKeyType = extra.ShardKeyType
+			if tableConf.ShardKeyType == config.ShardKeyTypeTimestamp {
+				tableConf.TimeZone = r.conf.TimeZone
+			}
+		}
 	}
+	return tableConf, nil
+}
 
-	// add config to router.
-	if err = r.addTable(db, tableConf); err != nil {
-		log.Error("frm.create.add.route.error:%v", err)
+// DropTable used to remove a table from router and remove the schema file from disk.
+func (r *Router) DropTable(db, table string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	if err := r.removeTable(db, table); err != nil {
+		log.Error("frm.drop.table[%s.%s].remove.route.error:%v", db, table, err)
 		return err
 	}
-	if err = r.writeTableFrmData(db, table, tableConf); err != nil {
-		log.Error("frm.create.table[db:%v, table:%v].file.error:%+v", db, tableConf.Name, err)
+	if err := r.removeTableFrmData(db, table); err != nil {
+		log.Error("frm.drop.table[%s.%s].remove.frmdata.error:%v", db, table, err)
 		return err
 	}
 
-	if err = config.UpdateVersion(r.metadir); err != nil {
-		log.Panicf("frm.create.table.update.version.error:%v", err)
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.drop.table.update.version.error:%v", err)
 		return err
 	}
 	return nil
 }
 
-// DropTable used to remove a table from router and remove the schema file from disk.
-func (r *Router) DropTable(db, table string) error {
+// CreateTrigger used to add the trigger to the table and flush the schema to disk.
+// The trigger name is unique in the database as MySQL does.
+// Lock.
+func (r *Router) CreateTrigger(db, table string, trigger *config.TriggerConfig) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.unlock()
 
 	log := r.log
-	if err := r.removeTable(db, table); err != nil {
-		log.Error("frm.drop.table[%s.%s].remove.route.error:%v", db, table, err)
+	if _, err := r.triggerTable(db, trigger.Name); err == nil {
+		return sqldb.NewSQLError(sqldb.ER_TRG_ALREADY_EXISTS)
+	}
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, db+"."+table)
+	}
+	tbl, ok := schema.Tables[table]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+	}
+	tbl, err := r.resolve(db, tbl)
+	if err != nil {
 		return err
 	}
-	if err := r.removeTableFrmData(db, table); err != nil {
-		log.Error("frm.drop.table[%s.%s].remove.frmdata.error:%v", db, table, err)
+
+	// Copy on write, the table is shared with the snapshot.
+	tconf := *tbl.TableConfig
+	tconf.Triggers = append(append([]*config.TriggerConfig{}, tbl.TableConfig.Triggers...), trigger)
+	if err := r.writeTableFrmData(db, table, &tconf); err != nil {
+		log.Error("frm.create.trigger[%s.%s].file.error:%+v", db, trigger.Name, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &tconf)
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.create.trigger.update.version.error:%v", err)
 		return err
 	}
+	return nil
+}
 
+// DropTrigger used to remove the trigger from its table and flush the schema to disk.
+// Lock.
+func (r *Router) DropTrigger(db, name string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	tbl, err := r.triggerTable(db, name)
+	if err != nil {
+		return err
+	}
+
+	var triggers []*config.TriggerConfig
+	for _, trigger := range tbl.TableConfig.Triggers {
+		if trigger.Name != name {
+			triggers = append(triggers, trigger)
+		}
+	}
+	tconf := *tbl.TableConfig
+	tconf.Triggers = triggers
+	if err := r.writeTableFrmData(db, tbl.Name, &tconf); err != nil {
+		log.Error("frm.drop.trigger[%s.%s].file.error:%+v", db, name, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &tconf)
 	if err := config.UpdateVersion(r.metadir); err != nil {
-		log.Panicf("frm.drop.table.update.version.error:%v", err)
+		log.Panicf("frm.drop.trigger.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// CreateView used to add the view routed as the SINGLE or GLOBAL table on the backends and flush the schema to disk,
+// the view of the same name is replaced if replace.
+// Lock.
+func (r *Router) CreateView(db, name string, tableType string, backends []string, view *config.ViewConfig, replace bool) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	if tableType != TableTypeSingle && tableType != TableTypeGlobal {
+		return errors.Errorf("frm.create.view[%s.%s].table.type[%s].must.be.single.or.global", db, name, tableType)
+	}
+	tableConf, err := r.tableUniform(name, "", tableType, backends, nil)
+	if err != nil {
+		return err
+	}
+	tableConf.View = view
+
+	if schema, ok := r.schemas[db]; ok {
+		if tbl, ok := schema.Tables[name]; ok {
+			tbl, err := r.resolve(db, tbl)
+			if err != nil {
+				return err
+			}
+			if !replace || tbl.TableConfig.View == nil {
+				return sqldb.NewSQLError(sqldb.ER_TABLE_EXISTS_ERROR, name)
+			}
+			if err := r.removeTable(db, name); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.addTable(db, tableConf); err != nil {
+		log.Error("frm.create.view.add.route.error:%v", err)
+		return err
+	}
+	if err := r.writeTableFrmData(db, name, tableConf); err != nil {
+		log.Error("frm.create.view[db:%v, view:%v].file.error:%+v", db, name, err)
+		return err
+	}
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.create.view.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// DropView used to remove the view from router and remove the schema file from disk.
+// Lock.
+func (r *Router) DropView(db, name string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	tbl, ok := schema.Tables[name]
+	if !ok {
+		return sqldb.NewSQLError1(sqldb.ER_BAD_TABLE_ERROR, "42S02", "Unknown table '%s.%s'", db, name)
+	}
+	tbl, err := r.resolve(db, tbl)
+	if err != nil {
+		return err
+	}
+	if tbl.TableConfig.View == nil {
+		return errors.Errorf("frm.drop.view[%s.%s].is.not.a.view", db, name)
+	}
+	if err := r.removeTable(db, name); err != nil {
+		log.Error("frm.drop.view[%s.%s].remove.route.error:%v", db, name, err)
+		return err
+	}
+	if err := r.removeTableFrmData(db, name); err != nil {
+		log.Error("frm.drop.view[%s.%s].remove.frmdata.error:%v", db, name, err)
+		return err
+	}
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.drop.view.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// AddLookup used to add the lookup table of the column to the table and flush the schemas of both to disk.
+// The lookup table must be a HASH table partitioned by the column, which isn't the shard key of the table.
+// Lock.
+func (r *Router) AddLookup(db, table string, lookup *config.LookupConfig) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	resolve := func(name string) (*Table, error) {
+		tbl, ok := schema.Tables[name]
+		if !ok {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, name)
+		}
+		return r.resolve(db, tbl)
+	}
+	tbl, err := resolve(table)
+	if err != nil {
+		return err
+	}
+	lookupTbl, err := resolve(lookup.Table)
+	if err != nil {
+		return err
+	}
+
+	tconf, lconf := tbl.TableConfig, lookupTbl.TableConfig
+	switch {
+	case tconf.ShardKey == "" || tconf.View != nil || tconf.LookupOf != "":
+		return errors.Errorf("frm.add.lookup.table[%s.%s].must.be.partitioned", db, table)
+	case strings.EqualFold(tconf.ShardKey, lookup.Column):
+		return errors.Errorf("frm.add.lookup.column[%s].is.the.shard.key.of.table[%s.%s]", lookup.Column, db, table)
+	case lookup.Table == table || lconf.ShardType != methodTypeHash || !strings.EqualFold(lconf.ShardKey, lookup.Column):
+		return errors.Errorf("frm.add.lookup.table[%s.%s].must.be.HASH.by.column[%s]", db, lookup.Table, lookup.Column)
+	case lconf.LookupOf != "" || len(lconf.Lookups) > 0:
+		return errors.Errorf("frm.add.lookup.table[%s.%s].is.already.a.lookup", db, lookup.Table)
+	}
+	for _, x := range tconf.Lookups {
+		if strings.EqualFold(x.Column, lookup.Column) {
+			return errors.Errorf("frm.add.lookup.table[%s.%s].column[%s].already.has.lookup[%s]", db, table, lookup.Column, x.Table)
+		}
+	}
+
+	// Copy on write, the tables are shared with the snapshot.
+	newTconf, newLconf := *tconf, *lconf
+	newTconf.Lookups = append(append([]*config.LookupConfig{}, tconf.Lookups...), lookup)
+	newLconf.LookupOf = table
+	if err := r.writeTableFrmData(db, lookup.Table, &newLconf); err != nil {
+		log.Error("frm.add.lookup[%s.%s].file.error:%+v", db, lookup.Table, err)
+		return err
+	}
+	r.setTableConfig(db, lookupTbl, &newLconf)
+	if err := r.writeTableFrmData(db, table, &newTconf); err != nil {
+		log.Error("frm.add.lookup[%s.%s].file.error:%+v", db, table, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &newTconf)
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.add.lookup.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// DropLookup used to remove the lookup of the column from the table and flush the schemas to disk,
+// the lookup table is kept as a normal table.
+// Lock.
+func (r *Router) DropLookup(db, table, column string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	tbl, ok := schema.Tables[table]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+	}
+	tbl, err := r.resolve(db, tbl)
+	if err != nil {
+		return err
+	}
+
+	var lookup *config.LookupConfig
+	var lookups []*config.LookupConfig
+	for _, x := range tbl.TableConfig.Lookups {
+		if strings.EqualFold(x.Column, column) {
+			lookup = x
+			continue
+		}
+		lookups = append(lookups, x)
+	}
+	if lookup == nil {
+		return errors.Errorf("frm.drop.lookup.table[%s.%s].column[%s].has.no.lookup", db, table, column)
+	}
+
+	tconf := *tbl.TableConfig
+	tconf.Lookups = lookups
+	if err := r.writeTableFrmData(db, table, &tconf); err != nil {
+		log.Error("frm.drop.lookup[%s.%s].file.error:%+v", db, table, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &tconf)
+	if lookupTbl, ok := schema.Tables[lookup.Table]; ok {
+		if lookupTbl, err = r.resolve(db, lookupTbl); err != nil {
+			return err
+		}
+		lconf := *lookupTbl.TableConfig
+		lconf.LookupOf = ""
+		if err := r.writeTableFrmData(db, lookup.Table, &lconf); err != nil {
+			log.Error("frm.drop.lookup[%s.%s].file.error:%+v", db, lookup.Table, err)
+			return err
+		}
+		r.setTableConfig(db, lookupTbl, &lconf)
+	}
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.drop.lookup.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// FinishLookup used to mark the lookup of the column as backfilled and flush the schema to disk,
+// the selects are routed by it then.
+// Lock.
+func (r *Router) FinishLookup(db, table, column string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	tbl, ok := schema.Tables[table]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+	}
+	tbl, err := r.resolve(db, tbl)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	lookups := make([]*config.LookupConfig, 0, len(tbl.TableConfig.Lookups))
+	for _, x := range tbl.TableConfig.Lookups {
+		if strings.EqualFold(x.Column, column) {
+			found = true
+			x = &config.LookupConfig{Column: x.Column, Table: x.Table}
+		}
+		lookups = append(lookups, x)
+	}
+	if !found {
+		return errors.Errorf("frm.finish.lookup.table[%s.%s].column[%s].has.no.lookup", db, table, column)
+	}
+
+	tconf := *tbl.TableConfig
+	tconf.Lookups = lookups
+	if err := r.writeTableFrmData(db, table, &tconf); err != nil {
+		log.Error("frm.finish.lookup[%s.%s].file.error:%+v", db, table, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &tconf)
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.finish.lookup.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// LookupOwner returns the table whose lookup table the table is, empty if it isn't a lookup table in use.
+func (r *Router) LookupOwner(db, table string) string {
+	tconf, err := r.TableConfig(db, table)
+	if err != nil || tconf.LookupOf == "" {
+		return ""
+	}
+	owner, err := r.TableConfig(db, tconf.LookupOf)
+	if err != nil {
+		return ""
+	}
+	for _, lookup := range owner.Lookups {
+		if lookup.Table == table {
+			return tconf.LookupOf
+		}
+	}
+	return ""
+}
+
+// SetShardMap used to set the shard map of the HASH table and flush the schema to disk, nil clears the map.
+// Note:
+// The rows already on the backends are not moved, the keys must be placed on the mapped segments by hand.
+// Lock.
+func (r *Router) SetShardMap(db, table string, shardMap *config.ShardMapConfig) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	tbl, ok := schema.Tables[table]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+	}
+	tbl, err := r.resolve(db, tbl)
+	if err != nil {
+		return err
+	}
+	if tbl.TableConfig.ShardType != methodTypeHash {
+		return errors.Errorf("frm.shard.map.table[%s.%s].shardtype[%s].must.be.HASH", db, table, tbl.TableConfig.ShardType)
+	}
+
+	tconf := *tbl.TableConfig
+	tconf.ShardMap = shardMap
+	partition, err := r.buildPartition(&tconf)
+	if err != nil {
+		return err
+	}
+	if err := r.writeTableFrmData(db, table, &tconf); err != nil {
+		log.Error("frm.shard.map[%s.%s].file.error:%+v", db, table, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &tconf)
+	schema.Tables[table].Partition = partition
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.shard.map.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// SetKeyNormalization used to set the shard key normalization of the HASH table and flush the schema to disk,
+// empty is the canonical one.
+// Note:
+// The rows already on the backends are not moved, the ones routed elsewhere by the new normalization must be
+// checked by the CanonicalPartition first.
+// Lock.
+func (r *Router) SetKeyNormalization(db, table, normalization string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	switch normalization {
+	case "", config.KeyNormalizationLegacy:
+	default:
+		return errors.Errorf("frm.key.normalization[%s].unsupported", normalization)
+	}
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	tbl, ok := schema.Tables[table]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+	}
+	tbl, err := r.resolve(db, tbl)
+	if err != nil {
+		return err
+	}
+	if tbl.TableConfig.ShardType != methodTypeHash {
+		return errors.Errorf("frm.key.normalization.table[%s.%s].shardtype[%s].must.be.HASH", db, table, tbl.TableConfig.ShardType)
+	}
+
+	tconf := *tbl.TableConfig
+	tconf.KeyNormalization = normalization
+	partition, err := r.buildPartition(&tconf)
+	if err != nil {
+		return err
+	}
+	if err := r.writeTableFrmData(db, table, &tconf); err != nil {
+		log.Error("frm.key.normalization[%s.%s].file.error:%+v", db, table, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &tconf)
+	schema.Tables[table].Partition = partition
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.key.normalization.update.version.error:%v", err)
 		return err
 	}
 	return nil
 }
 
+// setTableConfig used to replace the table with the copy of the new config, it must be called with the lock held.
+func (r *Router) setTableConfig(db string, tbl *Table, tconf *config.TableConfig) {
+	t := *tbl
+	t.TableConfig = tconf
+	r.uncache(r.schemas[db].Tables[tbl.Name])
+	r.schemas[db].Tables[tbl.Name] = &t
+	r.changed[db] = true
+}
+
+// TriggerTable returns the table name which the trigger is created on.
+func (r *Router) TriggerTable(db, name string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tbl, err := r.triggerTable(db, name)
+	if err != nil {
+		return "", err
+	}
+	return tbl.Name, nil
+}
+
+func (r *Router) triggerTable(db, name string) (*Table, error) {
+	if schema, ok := r.schemas[db]; ok {
+		for _, tbl := range schema.Tables {
+			// The table can't be loaded has no triggers in use.
+			tbl, err := r.resolve(db, tbl)
+			if err != nil {
+				continue
+			}
+			for _, trigger := range tbl.TableConfig.Triggers {
+				if trigger.Name == name {
+					return tbl, nil
+				}
+			}
+		}
+	}
+	return nil, sqldb.NewSQLError(sqldb.ER_TRG_DOES_NOT_EXIST)
+}
+
 // RefreshTable used to re-update the table from file.
 // Lock.
 func (r *Router) RefreshTable(db, table string) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.unlock()
 
 	log := r.log
 	if err := r.removeTable(db, table); err != nil {
@@ -251,13 +852,21 @@ func (r *Router) RefreshTable(db, table string) error {
 
 // LoadConfig used to load all schemas stored in metadir.
 // When an IO error occurs during the file reading, panic me.
+// In the lazy mode only the names of the tables are loaded, the tables are read from the files
+// on the first access and prefetched in the background if the prefetch is enabled.
 func (r *Router) LoadConfig() error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.unlock()
 
 	log := r.log
 	// Clear the router first.
 	r.clear()
+	if r.cache != nil {
+		epoch := r.cache.purge()
+		if r.conf.Prefetch {
+			defer func() { go r.prefetch(epoch) }()
+		}
+	}
 
 	// Check the schemadir, create it if not exists.
 	if _, err := os.Stat(r.metadir); os.IsNotExist(err) {
@@ -300,6 +909,10 @@ func (r *Router) LoadConfig() error {
 
 	for k, v := range frms {
 		for _, file := range v {
+			if r.cache != nil {
+				r.addStub(k, strings.TrimSuffix(path.Base(file), ".json"), file)
+				continue
+			}
 			if err := r.loadTableFromFile(k, file); err != nil {
 				log.Error("router.load.table..from.file[%v].error:%+v", file, err)
 				return err
@@ -309,10 +922,41 @@ func (r *Router) LoadConfig() error {
 	return nil
 }
 
+// prefetch used to load the stubs until the cache is full or purged since the epoch by the next loading.
+func (r *Router) prefetch(epoch int) {
+	log := r.log
+	r.mu.RLock()
+	var dbs []string
+	var stubs []*Table
+	for db, schema := range r.schemas {
+		for _, table := range schema.Tables {
+			if table.file != "" {
+				dbs = append(dbs, db)
+				stubs = append(stubs, table)
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	start := time.Now()
+	n := 0
+	for i, stub := range stubs {
+		if r.cache.full(epoch) {
+			break
+		}
+		if _, err := r.resolve(dbs[i], stub); err != nil {
+			log.Error("router.prefetch.table[%s.%s].error:%+v", dbs[i], stub.Name, err)
+			continue
+		}
+		n++
+	}
+	log.Info("router.prefetch.done.tables[%d].of[%d].cost[%v]", n, len(stubs), time.Since(start))
+}
+
 // AddForTest used to add table config for test.
 func (r *Router) AddForTest(db string, confs ...*config.TableConfig) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	defer r.unlock()
 
 	log := r.log
 	// add config to router.
@@ -324,3 +968,170 @@ func (r *Router) AddForTest(db string, confs ...*config.TableConfig) error {
 	}
 	return nil
 }
+
+// StartReshard used to mark the table resharded to the shadow table and flush the schemas to disk,
+// the writes to the table are mirrored to the shadow table from then on.
+// Lock.
+func (r *Router) StartReshard(db, table, shadow string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	schema, ok := r.schemas[db]
+	if !ok {
+		return sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	resolve := func(name string) (*Table, error) {
+		tbl, ok := schema.Tables[name]
+		if !ok {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, name)
+		}
+		return r.resolve(db, tbl)
+	}
+	tbl, err := resolve(table)
+	if err != nil {
+		return err
+	}
+	shadowTbl, err := resolve(shadow)
+	if err != nil {
+		return err
+	}
+
+	tconf, sconf := tbl.TableConfig, shadowTbl.TableConfig
+	switch {
+	case tconf.ShardKey == "" || tconf.View != nil:
+		return errors.Errorf("frm.start.reshard.table[%s.%s].must.be.partitioned", db, table)
+	case len(tconf.Lookups) > 0 || tconf.LookupOf != "":
+		return errors.Errorf("frm.start.reshard.table[%s.%s].has.lookups.or.is.a.lookup.table", db, table)
+	case len(tconf.Triggers) > 0:
+		return errors.Errorf("frm.start.reshard.table[%s.%s].has.triggers", db, table)
+	case tconf.ReshardTo != "" || tconf.ReshardOf != "":
+		return errors.Errorf("frm.start.reshard.table[%s.%s].is.already.in.resharding", db, table)
+	case shadow == table || sconf.ShardKey == "" || sconf.View != nil:
+		return errors.Errorf("frm.start.reshard.shadow.table[%s.%s].must.be.partitioned", db, shadow)
+	case sconf.ReshardTo != "" || sconf.ReshardOf != "" || len(sconf.Lookups) > 0 || sconf.LookupOf != "":
+		return errors.Errorf("frm.start.reshard.shadow.table[%s.%s].is.in.use", db, shadow)
+	}
+
+	// Copy on write, the tables are shared with the snapshot.
+	newTconf, newSconf := *tconf, *sconf
+	newTconf.ReshardTo = shadow
+	newSconf.ReshardOf = table
+	if err := r.writeTableFrmData(db, shadow, &newSconf); err != nil {
+		log.Error("frm.start.reshard[%s.%s].file.error:%+v", db, shadow, err)
+		return err
+	}
+	r.setTableConfig(db, shadowTbl, &newSconf)
+	if err := r.writeTableFrmData(db, table, &newTconf); err != nil {
+		log.Error("frm.start.reshard[%s.%s].file.error:%+v", db, table, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &newTconf)
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.start.reshard.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// CancelReshard used to stop mirroring the writes of the table to its shadow table and flush the schemas to disk,
+// the shadow table is kept as a normal table.
+// Lock.
+func (r *Router) CancelReshard(db, table string) error {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	tbl, shadowTbl, err := r.reshardTables(db, table)
+	if err != nil {
+		return err
+	}
+
+	tconf, sconf := *tbl.TableConfig, *shadowTbl.TableConfig
+	tconf.ReshardTo = ""
+	sconf.ReshardOf = ""
+	if err := r.writeTableFrmData(db, table, &tconf); err != nil {
+		log.Error("frm.cancel.reshard[%s.%s].file.error:%+v", db, table, err)
+		return err
+	}
+	r.setTableConfig(db, tbl, &tconf)
+	if err := r.writeTableFrmData(db, sconf.Name, &sconf); err != nil {
+		log.Error("frm.cancel.reshard[%s.%s].file.error:%+v", db, sconf.Name, err)
+		return err
+	}
+	r.setTableConfig(db, shadowTbl, &sconf)
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.cancel.reshard.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// SwapReshard used to replace the layout of the table with its shadow table's in one step and flush the schemas to disk,
+// the shadow table is removed. It returns the partitions of the old layout, which are to be dropped on the backends.
+// The table keeps its auto increment, the tables with triggers can't be resharded.
+// Lock.
+func (r *Router) SwapReshard(db, table string) ([]*config.PartitionConfig, error) {
+	r.mu.Lock()
+	defer r.unlock()
+
+	log := r.log
+	tbl, shadowTbl, err := r.reshardTables(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	old := tbl.TableConfig
+	tconf := *shadowTbl.TableConfig
+	tconf.Name = table
+	tconf.ReshardOf = ""
+	tconf.AutoIncrement = old.AutoIncrement
+	if err := r.writeTableFrmData(db, table, &tconf); err != nil {
+		log.Error("frm.swap.reshard[%s.%s].file.error:%+v", db, table, err)
+		return nil, err
+	}
+	if err := r.removeTable(db, table); err != nil {
+		return nil, err
+	}
+	if err := r.addTable(db, &tconf); err != nil {
+		log.Error("frm.swap.reshard[%s.%s].add.route.error:%+v", db, table, err)
+		return nil, err
+	}
+	if err := r.removeTable(db, shadowTbl.Name); err != nil {
+		return nil, err
+	}
+	if err := r.removeTableFrmData(db, shadowTbl.Name); err != nil {
+		log.Error("frm.swap.reshard[%s.%s].remove.frmdata.error:%+v", db, shadowTbl.Name, err)
+		return nil, err
+	}
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.swap.reshard.update.version.error:%v", err)
+		return nil, err
+	}
+	return old.Partitions, nil
+}
+
+// reshardTables returns the table in the resharding and its shadow table.
+func (r *Router) reshardTables(db, table string) (*Table, *Table, error) {
+	schema, ok := r.schemas[db]
+	if !ok {
+		return nil, nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, db)
+	}
+	tbl, ok := schema.Tables[table]
+	if !ok {
+		return nil, nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, table)
+	}
+	tbl, err := r.resolve(db, tbl)
+	if err != nil {
+		return nil, nil, err
+	}
+	shadow := tbl.TableConfig.ReshardTo
+	shadowTbl, ok := schema.Tables[shadow]
+	if shadow == "" || !ok {
+		return nil, nil, errors.Errorf("frm.reshard.table[%s.%s].is.not.in.resharding", db, table)
+	}
+	if shadowTbl, err = r.resolve(db, shadowTbl); err != nil {
+		return nil, nil, err
+	}
+	return tbl, shadowTbl, nil
+}
@@ -12,9 +12,14 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
+
+	"config"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -338,3 +343,690 @@ func TestFrmDatabaseNoTables(t *testing.T) {
 	err := router.CreateDatabase("test2")
 	assert.NotNil(t, err)
 }
+
+func TestFrmPreviewTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+
+	// Preview.
+	{
+		preview, err := router.PreviewTable("test", "t1", "id", TableTypePartition, backends, nil)
+		assert.Nil(t, err)
+		segments, err := preview.Lookup("test", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 32, len(segments))
+		assert.False(t, checkFileExistsForTest(router, "test", "t1"))
+		_, err = router.ShardKey("test", "t1")
+		assert.NotNil(t, err)
+	}
+
+	// Preview global table.
+	{
+		preview, err := router.PreviewTable("test", "t2", "", TableTypeGlobal, backends, nil)
+		assert.Nil(t, err)
+		segments, err := preview.Lookup("test", "t2", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(segments))
+	}
+
+	// Table exists.
+	{
+		err := router.CreateTable("test", "t1", "id", TableTypePartition, backends, nil)
+		assert.Nil(t, err)
+		_, err = router.PreviewTable("test", "t1", "id", TableTypePartition, backends, nil)
+		assert.NotNil(t, err)
+	}
+
+	// Shardkey is null.
+	{
+		_, err := router.PreviewTable("test", "t3", "", TableTypePartition, backends, nil)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestFrmCreateTableLike(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	router.CreateDatabase("db1")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", TableTypePartition, backends, &Extra{AutoIncrement: &config.AutoIncrement{Column: "id"}})
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "g1", "", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTrigger("test", "t1", &config.TriggerConfig{Name: "trg1", Timing: "before", Event: "insert", Body: "set new.b=1"})
+	assert.Nil(t, err)
+
+	// Partition table.
+	{
+		err := router.CreateTableLike("db1", "t2", "test", "t1")
+		assert.Nil(t, err)
+		from, err := router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("db1", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, "t2", tconf.Name)
+		assert.Equal(t, from.ShardKey, tconf.ShardKey)
+		assert.Equal(t, from.ShardType, tconf.ShardType)
+		assert.Equal(t, from.AutoIncrement, tconf.AutoIncrement)
+		assert.Nil(t, tconf.Triggers)
+		assert.Equal(t, len(from.Partitions), len(tconf.Partitions))
+		for i, part := range tconf.Partitions {
+			assert.Equal(t, "t2"+strings.TrimPrefix(from.Partitions[i].Table, "t1"), part.Table)
+			assert.Equal(t, from.Partitions[i].Segment, part.Segment)
+			assert.Equal(t, from.Partitions[i].Backend, part.Backend)
+		}
+		assert.True(t, checkFileExistsForTest(router, "db1", "t2"))
+	}
+
+	// Global table.
+	{
+		err := router.CreateTableLike("test", "g2", "test", "g1")
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "g2")
+		assert.Nil(t, err)
+		assert.Equal(t, "GLOBAL", tconf.ShardType)
+		assert.Equal(t, 2, len(tconf.Partitions))
+		assert.Equal(t, "g2", tconf.Partitions[0].Table)
+	}
+
+	// Errors.
+	{
+		err := router.CreateTableLike("test", "t3", "test", "xx")
+		assert.Equal(t, "Table 'xx' doesn't exist (errno 1146) (sqlstate 42S02)", err.Error())
+		err = router.CreateTableLike("test", "g1", "test", "t1")
+		assert.Equal(t, "router.add.db[test].table[g1].exists", err.Error())
+		err = router.CreateTable("test", "t3_0000", "", TableTypeGlobal, backends, nil)
+		assert.Nil(t, err)
+		err = router.CreateTableLike("test", "t3", "test", "t1")
+		assert.Equal(t, "router.create.table.like.name[t3_0000].conflicts.with.table[test.t3_0000]", err.Error())
+	}
+}
+
+func TestFrmTrigger(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", "", backends, nil)
+	assert.Nil(t, err)
+
+	trigger := &config.TriggerConfig{Name: "trg1", Timing: "before", Event: "insert", Body: "set new.b=1"}
+	err = router.CreateTrigger("test", "t1", trigger)
+	assert.Nil(t, err)
+	table, err := router.TriggerTable("test", "trg1")
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", table)
+
+	// Errors.
+	{
+		err := router.CreateTrigger("test", "t2", &config.TriggerConfig{Name: "trg1"})
+		assert.Equal(t, "Trigger already exists (errno 1359) (sqlstate HY000)", err.Error())
+		err = router.CreateTrigger("test", "t2", &config.TriggerConfig{Name: "trg2"})
+		assert.Equal(t, "Table 't2' doesn't exist (errno 1146) (sqlstate 42S02)", err.Error())
+		err = router.DropTrigger("test", "trg2")
+		assert.Equal(t, "Trigger does not exist (errno 1360) (sqlstate HY000)", err.Error())
+	}
+
+	// The trigger is loaded.
+	{
+		router1, cleanup1 := MockNewRouter(log)
+		defer cleanup1()
+		err := router1.LoadConfig()
+		assert.Nil(t, err)
+		tconf, err := router1.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, []*config.TriggerConfig{trigger}, tconf.Triggers)
+	}
+
+	err = router.DropTrigger("test", "trg1")
+	assert.Nil(t, err)
+	_, err = router.TriggerTable("test", "trg1")
+	assert.NotNil(t, err)
+}
+
+func TestFrmView(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	router.CreateDatabase("db1")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "", TableTypeSingle, backends, nil)
+	assert.Nil(t, err)
+
+	view := &config.ViewConfig{Definition: "select * from `test`.`t1`"}
+	err = router.CreateView("test", "v1", TableTypeSingle, backends[1:], view, false)
+	assert.Nil(t, err)
+	tconf, err := router.TableConfig("test", "v1")
+	assert.Nil(t, err)
+	assert.Equal(t, "SINGLE", tconf.ShardType)
+	assert.Equal(t, view, tconf.View)
+	assert.Equal(t, []*config.PartitionConfig{{Table: "v1", Backend: "backend2"}}, tconf.Partitions)
+	assert.True(t, checkFileExistsForTest(router, "test", "v1"))
+
+	// Replace.
+	{
+		err := router.CreateView("test", "v1", TableTypeGlobal, backends, view, true)
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "v1")
+		assert.Nil(t, err)
+		assert.Equal(t, "GLOBAL", tconf.ShardType)
+		assert.Equal(t, 2, len(tconf.Partitions))
+	}
+
+	// Reload.
+	{
+		err := router.LoadConfig()
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "v1")
+		assert.Nil(t, err)
+		assert.Equal(t, view, tconf.View)
+	}
+
+	// Errors.
+	{
+		err := router.CreateView("test", "v1", TableTypeGlobal, backends, view, false)
+		assert.Equal(t, "Table 'v1' already exists (errno 1050) (sqlstate 42S01)", err.Error())
+		err = router.CreateView("test", "t1", TableTypeGlobal, backends, view, true)
+		assert.Equal(t, "Table 't1' already exists (errno 1050) (sqlstate 42S01)", err.Error())
+		err = router.CreateView("test", "v2", TableTypePartition, backends, view, false)
+		assert.Equal(t, "frm.create.view[test.v2].table.type[partition].must.be.single.or.global", err.Error())
+		err = router.DropView("test", "t1")
+		assert.Equal(t, "frm.drop.view[test.t1].is.not.a.view", err.Error())
+		err = router.DropView("test", "v2")
+		assert.Equal(t, "Unknown table 'test.v2' (errno 1051) (sqlstate 42S02)", err.Error())
+		_, err = router.TableRenames("test", "v1", "db1", "v1")
+		assert.Equal(t, "router.table.move[test.v1].is.a.view.can't.move.to.database[db1]", err.Error())
+	}
+
+	err = router.DropView("test", "v1")
+	assert.Nil(t, err)
+	assert.False(t, checkFileExistsForTest(router, "test", "v1"))
+	_, err = router.TableConfig("test", "v1")
+	assert.NotNil(t, err)
+}
+
+func TestFrmLookup(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", TableTypePartition, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t1_email", "email", TableTypePartition, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t2", "id", TableTypePartition, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "g1", "", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+
+	lookup := &config.LookupConfig{Column: "email", Table: "t1_email"}
+	err = router.AddLookup("test", "t1", lookup)
+	assert.Nil(t, err)
+	tconf, err := router.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.LookupConfig{lookup}, tconf.Lookups)
+	assert.Equal(t, "t1", router.LookupOwner("test", "t1_email"))
+	assert.Equal(t, "", router.LookupOwner("test", "t1"))
+
+	// Reload.
+	{
+		err := router.LoadConfig()
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, []*config.LookupConfig{lookup}, tconf.Lookups)
+		assert.Equal(t, "t1", router.LookupOwner("test", "t1_email"))
+	}
+
+	// Errors.
+	{
+		errs := []struct {
+			table  string
+			lookup *config.LookupConfig
+			err    string
+		}{
+			{"g1", &config.LookupConfig{Column: "email", Table: "t2"}, "frm.add.lookup.table[test.g1].must.be.partitioned"},
+			{"t2", &config.LookupConfig{Column: "ID", Table: "t1_email"}, "frm.add.lookup.column[ID].is.the.shard.key.of.table[test.t2]"},
+			{"t2", &config.LookupConfig{Column: "email", Table: "g1"}, "frm.add.lookup.table[test.g1].must.be.HASH.by.column[email]"},
+			{"t2", &config.LookupConfig{Column: "email", Table: "t1_email"}, "frm.add.lookup.table[test.t1_email].is.already.a.lookup"},
+			{"t1", &config.LookupConfig{Column: "EMAIL", Table: "t1_email"}, "frm.add.lookup.table[test.t1_email].is.already.a.lookup"},
+			{"t2", &config.LookupConfig{Column: "email", Table: "xx"}, "Table 'xx' doesn't exist (errno 1146) (sqlstate 42S02)"},
+		}
+		for _, x := range errs {
+			err := router.AddLookup("test", x.table, x.lookup)
+			assert.Equal(t, x.err, err.Error())
+		}
+		err := router.DropLookup("test", "t1", "name")
+		assert.Equal(t, "frm.drop.lookup.table[test.t1].column[name].has.no.lookup", err.Error())
+		_, err = router.TableRenames("test", "t1_email", "test", "t3")
+		assert.Equal(t, "router.table.rename[test.t1_email].has.lookups.or.is.a.lookup.table", err.Error())
+	}
+
+	// Backfilled.
+	{
+		err := router.DropLookup("test", "t1", "email")
+		assert.Nil(t, err)
+		err = router.AddLookup("test", "t1", &config.LookupConfig{Column: "email", Table: "t1_email", Backfilling: true})
+		assert.Nil(t, err)
+		err = router.FinishLookup("test", "t1", "email")
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, []*config.LookupConfig{lookup}, tconf.Lookups)
+		err = router.FinishLookup("test", "t1", "name")
+		assert.Equal(t, "frm.finish.lookup.table[test.t1].column[name].has.no.lookup", err.Error())
+	}
+
+	err = router.DropLookup("test", "t1", "EMAIL")
+	assert.Nil(t, err)
+	tconf, err = router.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Nil(t, tconf.Lookups)
+	assert.Equal(t, "", router.LookupOwner("test", "t1_email"))
+	lconf, err := router.TableConfig("test", "t1_email")
+	assert.Nil(t, err)
+	assert.Equal(t, "", lconf.LookupOf)
+}
+
+func TestFrmReshard(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", TableTypePartition, backends, &Extra{AutoIncrement: &config.AutoIncrement{Column: "id"}})
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t1_reshard", "b", TableTypePartition, backends, &Extra{Partitions: 8})
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t2", "id", TableTypePartition, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "g1", "", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t3", "id", TableTypePartition, backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTrigger("test", "t3", &config.TriggerConfig{Name: "trg1", Timing: "before", Event: "insert", Body: "set new.b=1"})
+	assert.Nil(t, err)
+
+	err = router.StartReshard("test", "t1", "t1_reshard")
+	assert.Nil(t, err)
+	tconf, err := router.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "t1_reshard", tconf.ReshardTo)
+	sconf, err := router.TableConfig("test", "t1_reshard")
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", sconf.ReshardOf)
+
+	// Errors.
+	{
+		errs := []struct {
+			table  string
+			shadow string
+			err    string
+		}{
+			{"g1", "t2", "frm.start.reshard.table[test.g1].must.be.partitioned"},
+			{"t1", "t2", "frm.start.reshard.table[test.t1].is.already.in.resharding"},
+			{"t3", "t2", "frm.start.reshard.table[test.t3].has.triggers"},
+			{"t2", "g1", "frm.start.reshard.shadow.table[test.g1].must.be.partitioned"},
+			{"t2", "t2", "frm.start.reshard.shadow.table[test.t2].must.be.partitioned"},
+			{"t2", "t1_reshard", "frm.start.reshard.shadow.table[test.t1_reshard].is.in.use"},
+			{"t2", "xx", "Table 'xx' doesn't exist (errno 1146) (sqlstate 42S02)"},
+		}
+		for _, x := range errs {
+			err := router.StartReshard("test", x.table, x.shadow)
+			assert.Equal(t, x.err, err.Error())
+		}
+		err := router.CancelReshard("test", "t2")
+		assert.Equal(t, "frm.reshard.table[test.t2].is.not.in.resharding", err.Error())
+		_, err = router.SwapReshard("test", "t2")
+		assert.Equal(t, "frm.reshard.table[test.t2].is.not.in.resharding", err.Error())
+	}
+
+	// Cancel.
+	{
+		err := router.CancelReshard("test", "t1")
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "", tconf.ReshardTo)
+		sconf, err := router.TableConfig("test", "t1_reshard")
+		assert.Nil(t, err)
+		assert.Equal(t, "", sconf.ReshardOf)
+	}
+
+	// Swap.
+	{
+		err := router.StartReshard("test", "t1", "t1_reshard")
+		assert.Nil(t, err)
+		olds, err := router.SwapReshard("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, 32, len(olds))
+		assert.Equal(t, "t1_0000", olds[0].Table)
+
+		check := func(router *Router) {
+			tconf, err := router.TableConfig("test", "t1")
+			assert.Nil(t, err)
+			assert.Equal(t, "b", tconf.ShardKey)
+			assert.Equal(t, 8, len(tconf.Partitions))
+			assert.Equal(t, "t1_reshard_0000", tconf.Partitions[0].Table)
+			assert.Equal(t, "", tconf.ReshardTo)
+			assert.Equal(t, &config.AutoIncrement{Column: "id"}, tconf.AutoIncrement)
+			_, err = router.TableConfig("test", "t1_reshard")
+			assert.NotNil(t, err)
+
+			val := sqlparser.NewIntVal([]byte("1"))
+			parts, err := router.Lookup("test", "t1", val, val)
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(parts))
+			assert.True(t, strings.HasPrefix(parts[0].Table, "t1_reshard_"))
+		}
+		check(router)
+		assert.False(t, checkFileExistsForTest(router, "test", "t1_reshard"))
+
+		// Reload.
+		router1, cleanup1 := MockNewRouter(log)
+		defer cleanup1()
+		err = router1.LoadConfig()
+		assert.Nil(t, err)
+		check(router1)
+	}
+}
+
+func TestFrmShardMap(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", "", backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "g1", "", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+
+	shardMap := &config.ShardMapConfig{
+		Keys:   []*config.ShardMapKey{{Key: "1", Segment: "t1_0031"}},
+		Ranges: []*config.ShardMapRange{{Start: 100, End: 200, Segment: "t1_0000"}},
+	}
+	err = router.SetShardMap("test", "t1", shardMap)
+	assert.Nil(t, err)
+
+	check := func(router *Router, key string, table string) {
+		val := sqlparser.NewIntVal([]byte(key))
+		parts, err := router.Lookup("test", "t1", val, val)
+		assert.Nil(t, err)
+		assert.Equal(t, table, parts[0].Table)
+	}
+	check(router, "1", "t1_0031")
+	check(router, "150", "t1_0000")
+
+	// The shard map is loaded.
+	{
+		router1, cleanup1 := MockNewRouter(log)
+		defer cleanup1()
+		err := router1.LoadConfig()
+		assert.Nil(t, err)
+		tconf, err := router1.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, shardMap, tconf.ShardMap)
+		check(router1, "1", "t1_0031")
+	}
+
+	// Errors.
+	{
+		err := router.SetShardMap("test", "g1", shardMap)
+		assert.Equal(t, "frm.shard.map.table[test.g1].shardtype[GLOBAL].must.be.HASH", err.Error())
+		err = router.SetShardMap("test", "t2", shardMap)
+		assert.Equal(t, "Table 't2' doesn't exist (errno 1146) (sqlstate 42S02)", err.Error())
+		err = router.SetShardMap("test", "t1", &config.ShardMapConfig{Keys: []*config.ShardMapKey{{Key: "1", Segment: "t9"}}})
+		assert.Equal(t, "hash.shard.map.key[1].segment[t9].not.found", err.Error())
+		// The old map is kept.
+		check(router, "1", "t1_0031")
+	}
+
+	// Clear.
+	err = router.SetShardMap("test", "t1", nil)
+	assert.Nil(t, err)
+	tconf, err := router.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Nil(t, tconf.ShardMap)
+}
+
+func TestFrmKeyNormalization(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", "", backends, nil)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "g1", "", TableTypeGlobal, backends, nil)
+	assert.Nil(t, err)
+
+	lookup := func(router *Router, key string) string {
+		val := sqlparser.NewStrVal([]byte(key))
+		parts, err := router.Lookup("test", "t1", val, val)
+		assert.Nil(t, err)
+		return parts[0].Table
+	}
+	canonical := func(key string) string {
+		partition, err := router.CanonicalPartition("test", "t1")
+		assert.Nil(t, err)
+		idx, err := partition.GetIndex(sqlparser.NewStrVal([]byte(key)))
+		assert.Nil(t, err)
+		segment, err := partition.GetSegment(idx)
+		assert.Nil(t, err)
+		return segment.Table
+	}
+
+	// The new table is canonical.
+	assert.Equal(t, lookup(router, "abc"), lookup(router, "ABC "))
+
+	err = router.SetKeyNormalization("test", "t1", config.KeyNormalizationLegacy)
+	assert.Nil(t, err)
+	assert.NotEqual(t, lookup(router, "abc"), lookup(router, "ABC"))
+	assert.Equal(t, lookup(router, "abc"), canonical("abc"))
+	assert.NotEqual(t, lookup(router, "ABC"), canonical("ABC"))
+
+	// The normalization is loaded.
+	{
+		router1, cleanup1 := MockNewRouter(log)
+		defer cleanup1()
+		err := router1.LoadConfig()
+		assert.Nil(t, err)
+		tconf, err := router1.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, config.KeyNormalizationLegacy, tconf.KeyNormalization)
+		assert.Equal(t, lookup(router, "ABC"), lookup(router1, "ABC"))
+	}
+
+	// Errors.
+	{
+		err := router.SetKeyNormalization("test", "g1", "")
+		assert.Equal(t, "frm.key.normalization.table[test.g1].shardtype[GLOBAL].must.be.HASH", err.Error())
+		err = router.SetKeyNormalization("test", "t1", "binary")
+		assert.Equal(t, "frm.key.normalization[binary].unsupported", err.Error())
+		_, err = router.CanonicalPartition("test", "g1")
+		assert.Equal(t, "router.canonical.partition.table[test.g1].shardtype[GLOBAL].must.be.HASH", err.Error())
+	}
+
+	// Back to canonical.
+	err = router.SetKeyNormalization("test", "t1", "")
+	assert.Nil(t, err)
+	assert.Equal(t, canonical("ABC"), lookup(router, "ABC"))
+}
+
+func TestFrmShardKeyType(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	extra := &Extra{ShardKeyType: config.ShardKeyTypeBinary}
+	err := router.CreateTable("test", "t1", "id", "", backends, extra)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "g1", "", TableTypeGlobal, backends, extra)
+	assert.Nil(t, err)
+
+	tconf, err := router.TableConfig("test", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, config.ShardKeyTypeBinary, tconf.ShardKeyType)
+	tconf, err = router.TableConfig("test", "g1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", tconf.ShardKeyType)
+
+	// The hex literal is routed as the bytes.
+	hexVal := sqlparser.NewHexVal([]byte("0102"))
+	strVal := sqlparser.NewStrVal([]byte("\x01\x02"))
+	parts1, err := router.Lookup("test", "t1", hexVal, hexVal)
+	assert.Nil(t, err)
+	parts2, err := router.Lookup("test", "t1", strVal, strVal)
+	assert.Nil(t, err)
+	assert.Equal(t, parts1, parts2)
+
+	// The shard key type is loaded.
+	{
+		router1, cleanup1 := MockNewRouter(log)
+		defer cleanup1()
+		err := router1.LoadConfig()
+		assert.Nil(t, err)
+		tconf, err := router1.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, config.ShardKeyTypeBinary, tconf.ShardKeyType)
+	}
+
+	// The time zone of the router is stamped on the TIMESTAMP shard key table.
+	{
+		router.conf.TimeZone = "+08:00"
+		defer func() { router.conf.TimeZone = "" }()
+		err := router.CreateTable("test", "t2", "ts", "", backends, &Extra{ShardKeyType: config.ShardKeyTypeTimestamp})
+		assert.Nil(t, err)
+		err = router.CreateTable("test", "t3", "d", "", backends, &Extra{ShardKeyType: config.ShardKeyTypeDate})
+		assert.Nil(t, err)
+		tconf, err := router.TableConfig("test", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, "+08:00", tconf.TimeZone)
+		tconf, err = router.TableConfig("test", "t3")
+		assert.Nil(t, err)
+		assert.Equal(t, "", tconf.TimeZone)
+	}
+}
+
+func TestFrmLazyLoad(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	for _, table := range []string{"t1", "t2", "t3"} {
+		err := router.CreateTable("test", table, "id", "", backends, nil)
+		assert.Nil(t, err)
+	}
+	makeFileBrokenForTest(router, "test", "t3")
+
+	conf := MockNewRouterConfig()
+	conf.LazyLoad = true
+	conf.TableCacheSize = 2
+	lazy := NewRouter(log, router.metadir, conf)
+	err := lazy.LoadConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(lazy.Tables()["test"]))
+	assert.Equal(t, 0, lazy.cache.len())
+
+	// Load on the access.
+	{
+		stub := lazy.Schemas()["test"].Tables["t1"]
+		assert.Nil(t, stub.Partition)
+		segments, err := lazy.Lookup("test", "t1", nil, nil)
+		assert.Nil(t, err)
+		want, err := router.Lookup("test", "t1", nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, want, segments)
+		assert.True(t, lazy.cache.cached(stub))
+
+		_, err = lazy.ShardKey("test", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, lazy.cache.len())
+	}
+
+	// The broken file fails the access only.
+	{
+		_, err := lazy.Lookup("test", "t3", nil, nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, 2, lazy.cache.len())
+	}
+
+	// Evict the least recently used.
+	{
+		err := lazy.CreateTable("test", "t4", "id", "", backends, nil)
+		assert.Nil(t, err)
+		err = lazy.ReLoad()
+		assert.Nil(t, err)
+		for _, table := range []string{"t1", "t2", "t4"} {
+			_, err := lazy.TableConfig("test", table)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, 2, lazy.cache.len())
+		assert.False(t, lazy.cache.cached(lazy.Schemas()["test"].Tables["t1"]))
+		assert.True(t, lazy.cache.cached(lazy.Schemas()["test"].Tables["t4"]))
+	}
+
+	// The DDL on the stubs.
+	{
+		trigger := &config.TriggerConfig{Name: "trg1", Timing: "before", Event: "insert", Body: "set new.b=1"}
+		err := lazy.CreateTrigger("test", "t1", trigger)
+		assert.Nil(t, err)
+		table, err := lazy.TriggerTable("test", "trg1")
+		assert.Nil(t, err)
+		assert.Equal(t, "t1", table)
+
+		stub := lazy.Schemas()["test"].Tables["t4"]
+		err = lazy.DropTable("test", "t4")
+		assert.Nil(t, err)
+		assert.False(t, lazy.cache.cached(stub))
+		assert.Equal(t, 3, len(lazy.Rules().Schemas[0].Tables))
+	}
+}
+
+func TestFrmLazyPrefetch(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	router.CreateDatabase("test")
+	backends := []string{"backend1", "backend2"}
+	for _, table := range []string{"t1", "t2", "t3"} {
+		err := router.CreateTable("test", table, "id", "", backends, nil)
+		assert.Nil(t, err)
+	}
+
+	conf := MockNewRouterConfig()
+	conf.LazyLoad = true
+	conf.TableCacheSize = 2
+	conf.Prefetch = true
+	lazy := NewRouter(log, router.metadir, conf)
+	err := lazy.LoadConfig()
+	assert.Nil(t, err)
+	for lazy.cache.len() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// Stop at the cache size.
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 2, lazy.cache.len())
+}
@@ -14,6 +14,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"config"
 
@@ -59,6 +60,28 @@ type Hash struct {
 	// Partition map
 	partitions map[int]Segment
 	Segments   []Segment `json:",omitempty"`
+
+	// The shard map of the keys and ranges placed by hand, the value is the index of the segment
+	// in the Segments, the index of the shard map is slots + the index of the segment.
+	mapKeys   map[string]int
+	mapRanges []shardMapRange
+
+	// legacy is true if the table is on the legacy key normalization.
+	legacy bool
+
+	// binary is true if the shard key is hashed by the raw bytes, it takes precedence over the legacy.
+	binary bool
+
+	// temporal is true if the shard key is hashed by the canonical time, it takes precedence over the legacy.
+	// loc is the time zone of the TIMESTAMP literals.
+	temporal bool
+	loc      *time.Location
+}
+
+type shardMapRange struct {
+	start int64
+	end   int64
+	index int
 }
 
 // NewHash creates new hash.
@@ -70,6 +93,9 @@ func NewHash(log *xlog.Log, slots int, conf *config.TableConfig) *Hash {
 		typ:        methodTypeHash,
 		partitions: make(map[int]Segment),
 		Segments:   make([]Segment, 0, 16),
+		legacy:     isLegacyKeyNormalization(conf),
+		binary:     isBinaryShardKey(conf),
+		temporal:   isTemporalShardKey(conf),
 	}
 }
 
@@ -78,6 +104,11 @@ func (h *Hash) Build() error {
 	var err error
 	var start, end int
 
+	if h.temporal {
+		if h.loc, err = config.ParseTimeZone(h.conf.TimeZone); err != nil {
+			return err
+		}
+	}
 	for _, part := range h.conf.Partitions {
 		segments := strings.Split(part.Segment, "-")
 		if len(segments) != 2 {
@@ -120,9 +151,116 @@ func (h *Hash) Build() error {
 		return errors.Errorf("hash.partition.last.segment[%v].upper.bound.must.be[%v]", len(h.partitions), h.slots)
 	}
 	sort.Sort(Segments(h.Segments))
+	return h.buildShardMap()
+}
+
+// buildShardMap used to build the shard map of the table config, the segments must be sorted.
+func (h *Hash) buildShardMap() error {
+	shardMap := h.conf.ShardMap
+	if shardMap == nil {
+		return nil
+	}
+
+	indexes := make(map[string]int, len(h.Segments))
+	for i, segment := range h.Segments {
+		indexes[segment.Table] = i
+	}
+	h.mapKeys = make(map[string]int, len(shardMap.Keys))
+	for _, key := range shardMap.Keys {
+		idx, ok := indexes[key.Segment]
+		if !ok {
+			return errors.Errorf("hash.shard.map.key[%v].segment[%v].not.found", key.Key, key.Segment)
+		}
+		mapKey := key.Key
+		switch {
+		case h.binary:
+			k, err := binaryShardMapKey(key.Key)
+			if err != nil {
+				return err
+			}
+			mapKey = k
+		case h.temporal:
+			k, err := h.temporalHashKey(sqlparser.NewStrVal([]byte(key.Key)))
+			if err != nil {
+				return err
+			}
+			mapKey = k.String()
+		case !h.legacy:
+			k, err := canonicalHashKey(sqlparser.NewStrVal([]byte(key.Key)))
+			if err != nil {
+				return err
+			}
+			mapKey = k.String()
+		}
+		if _, ok := h.mapKeys[mapKey]; ok {
+			return errors.Errorf("hash.shard.map.key[%v].duplicate", key.Key)
+		}
+		h.mapKeys[mapKey] = idx
+	}
+	for _, r := range shardMap.Ranges {
+		idx, ok := indexes[r.Segment]
+		if !ok {
+			return errors.Errorf("hash.shard.map.range[%v-%v).segment[%v].not.found", r.Start, r.End, r.Segment)
+		}
+		if r.End <= r.Start {
+			return errors.Errorf("hash.shard.map.range[%v-%v).start>=end", r.Start, r.End)
+		}
+		h.mapRanges = append(h.mapRanges, shardMapRange{start: r.Start, end: r.End, index: idx})
+	}
+	sort.Slice(h.mapRanges, func(i, j int) bool { return h.mapRanges[i].start < h.mapRanges[j].start })
+	for i := 1; i < len(h.mapRanges); i++ {
+		prev, r := h.mapRanges[i-1], h.mapRanges[i]
+		if r.start < prev.end {
+			return errors.Errorf("hash.shard.map.range[%v-%v).overlapped.with[%v-%v)", r.start, r.end, prev.start, prev.end)
+		}
+	}
 	return nil
 }
 
+// lookupShardMap returns the index of the canonical key in the shard map, or -1 if it's not mapped.
+func (h *Hash) lookupShardMap(key hashKey) int {
+	if h.mapKeys == nil {
+		return -1
+	}
+	if idx, ok := h.mapKeys[key.String()]; ok {
+		return h.slots + idx
+	}
+	if key.isInt && !key.big {
+		i := sort.Search(len(h.mapRanges), func(i int) bool { return h.mapRanges[i].end > key.ival })
+		if i < len(h.mapRanges) && h.mapRanges[i].start <= key.ival {
+			return h.slots + h.mapRanges[i].index
+		}
+	}
+	return -1
+}
+
+// lookupLegacyShardMap returns the index of the key of the legacy table in the shard map, or -1 if it's not mapped.
+func (h *Hash) lookupLegacyShardMap(sqlval *sqlparser.SQLVal, valStr string) int {
+	if h.mapKeys == nil {
+		return -1
+	}
+	key := valStr
+	var ival int64
+	isInt := false
+	if sqlval.Type == sqlparser.IntVal {
+		v, err := strconv.ParseInt(valStr, 0, 64)
+		if err != nil {
+			return -1
+		}
+		key, ival, isInt = strconv.FormatInt(v, 10), v, true
+	}
+	if idx, ok := h.mapKeys[key]; ok {
+		return h.slots + idx
+	}
+	if isInt {
+		i := sort.Search(len(h.mapRanges), func(i int) bool { return h.mapRanges[i].end > ival })
+		if i < len(h.mapRanges) && h.mapRanges[i].start <= ival {
+			return h.slots + h.mapRanges[i].index
+		}
+	}
+	return -1
+}
+
 // Clear used to clean hash partitions
 func (h *Hash) Clear() error {
 	for k := range h.partitions {
@@ -150,7 +288,11 @@ func (h *Hash) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment
 		if err != nil {
 			return nil, err
 		}
-		return []Segment{h.partitions[idx]}, nil
+		segment, err := h.GetSegment(idx)
+		if err != nil {
+			return nil, err
+		}
+		return []Segment{segment}, nil
 	}
 	return h.Segments, nil
 }
@@ -160,10 +302,98 @@ func (h *Hash) Type() MethodType {
 	return h.typ
 }
 
-// GetIndex returns index based on sqlval.
+// GetIndex returns index based on sqlval, the keys in the shard map are indexed after the slots.
 func (h *Hash) GetIndex(sqlval *sqlparser.SQLVal) (int, error) {
+	var key hashKey
+	var err error
+	switch {
+	case h.binary:
+		key, err = binaryHashKey(sqlval)
+	case h.temporal:
+		key, err = h.temporalHashKey(sqlval)
+	case h.legacy:
+		return h.getLegacyIndex(sqlval)
+	default:
+		key, err = canonicalHashKey(sqlval)
+	}
+	if err != nil {
+		return -1, err
+	}
+	if idx := h.lookupShardMap(key); idx >= 0 {
+		return idx, nil
+	}
+	return key.index(h.slots), nil
+}
+
+// temporalHashKey returns the key of the canonical time of the temporal shard key value.
+func (h *Hash) temporalHashKey(sqlval *sqlparser.SQLVal) (hashKey, error) {
+	t, err := temporalKey(sqlval, h.conf.ShardKeyType, h.loc)
+	if err != nil {
+		return hashKey{}, err
+	}
+	return temporalHashKey(t), nil
+}
+
+// GetRangeIndex returns the indexes of the segments which the shard key values in [start, end] are on,
+// ok is false if the range can't be pruned and all the segments must be scanned.
+// Only the temporal shard key is pruned:
+// 1. The range within one range of the shard map is on its segment and the segments of the mapped keys in the range.
+// 2. The DATE range of at most maxRangeDays days is on the segments of the days.
+func (h *Hash) GetRangeIndex(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]int, bool, error) {
+	if !h.temporal {
+		return nil, false, nil
+	}
+	lo, err := temporalKey(start, h.conf.ShardKeyType, h.loc)
+	if err != nil {
+		return nil, false, err
+	}
+	hi, err := temporalKey(end, h.conf.ShardKeyType, h.loc)
+	if err != nil {
+		return nil, false, err
+	}
+	if hi.Before(lo) {
+		return nil, false, nil
+	}
+
+	loKey, hiKey := temporalHashKey(lo), temporalHashKey(hi)
+	for _, r := range h.mapRanges {
+		if r.start <= loKey.ival && hiKey.ival < r.end {
+			indexes := []int{h.slots + r.index}
+			for key, idx := range h.mapKeys {
+				if v, err := strconv.ParseInt(key, 10, 64); err == nil && v >= loKey.ival && v <= hiKey.ival {
+					indexes = append(indexes, h.slots+idx)
+				}
+			}
+			sort.Ints(indexes[1:])
+			return indexes, true, nil
+		}
+	}
+
+	if h.conf.ShardKeyType != config.ShardKeyTypeDate {
+		return nil, false, nil
+	}
+	var indexes []int
+	for t := lo; !t.After(hi); t = t.AddDate(0, 0, 1) {
+		if len(indexes) == maxRangeDays {
+			return nil, false, nil
+		}
+		key := temporalHashKey(t)
+		idx := h.lookupShardMap(key)
+		if idx < 0 {
+			idx = key.index(h.slots)
+		}
+		indexes = append(indexes, idx)
+	}
+	return indexes, true, nil
+}
+
+// getLegacyIndex returns the index of the legacy table, the strings are hashed as they are.
+func (h *Hash) getLegacyIndex(sqlval *sqlparser.SQLVal) (int, error) {
 	idx := -1
 	valStr := common.BytesToString(sqlval.Val)
+	if idx = h.lookupLegacyShardMap(sqlval, valStr); idx >= 0 {
+		return idx, nil
+	}
 	switch sqlval.Type {
 	case sqlparser.IntVal:
 		unsigned, err := strconv.ParseInt(valStr, 0, 64)
@@ -191,6 +421,9 @@ func (h *Hash) GetSegments() []Segment {
 }
 
 func (h *Hash) GetSegment(index int) (Segment, error) {
+	if index >= h.slots && index < h.slots+len(h.Segments) && h.mapKeys != nil {
+		return h.Segments[index-h.slots], nil
+	}
 	if index < 0 || index >= h.slots {
 		return Segment{}, errors.Errorf("hash.getsegment.index.[%d].out.of.range", index)
 	}
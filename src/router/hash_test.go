@@ -13,6 +13,8 @@ import (
 	"testing"
 	"time"
 
+	"config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -223,6 +225,375 @@ func TestHashLookupError(t *testing.T) {
 	}
 }
 
+func TestHashKeyNormalization(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockTableAConfig()
+	hash := NewHash(log, _mockHashSlots, conf)
+	err := hash.Build()
+	assert.Nil(t, err)
+
+	// The values equal in MySQL are on the same slot.
+	tests := [][]*sqlparser.SQLVal{
+		{sqlparser.NewIntVal([]byte("-1")), sqlparser.NewStrVal([]byte("-1")), sqlparser.NewStrVal([]byte(" -01 ")), sqlparser.NewFloatVal([]byte("-1.4"))},
+		{sqlparser.NewIntVal([]byte("-2")), sqlparser.NewFloatVal([]byte("-1.5")), sqlparser.NewFloatVal([]byte("-2.49999999999999999999"))},
+		{sqlparser.NewIntVal([]byte("5")), sqlparser.NewIntVal([]byte("+5")), sqlparser.NewFloatVal([]byte("5.0")), sqlparser.NewStrVal([]byte("5.00")), sqlparser.NewFloatVal([]byte("4.5"))},
+		{sqlparser.NewIntVal([]byte("6")), sqlparser.NewFloatVal([]byte("5.5")), sqlparser.NewFloatVal([]byte(".55e1")), sqlparser.NewFloatVal([]byte("6.5e0"))},
+		{sqlparser.NewIntVal([]byte("1")), sqlparser.NewFloatVal([]byte(".5")), sqlparser.NewFloatVal([]byte("0.50"))},
+		{sqlparser.NewIntVal([]byte("0")), sqlparser.NewIntVal([]byte("-0")), sqlparser.NewStrVal([]byte("-0"))},
+		{sqlparser.NewIntVal([]byte("18446744073709551615")), sqlparser.NewStrVal([]byte("18446744073709551615"))},
+		{sqlparser.NewStrVal([]byte("abc")), sqlparser.NewStrVal([]byte("ABC")), sqlparser.NewStrVal([]byte("Abc   "))},
+	}
+	for _, test := range tests {
+		want, err := hash.GetIndex(test[0])
+		assert.Nil(t, err)
+		for _, val := range test[1:] {
+			got, err := hash.GetIndex(val)
+			assert.Nil(t, err)
+			assert.Equal(t, want, got, string(val.Val))
+		}
+	}
+
+	// The signed integers are hashed as the legacy.
+	{
+		conf.KeyNormalization = config.KeyNormalizationLegacy
+		legacy := NewHash(log, _mockHashSlots, conf)
+		err := legacy.Build()
+		assert.Nil(t, err)
+		for _, val := range []string{"-1", "0", "65536", "-9223372036854775808"} {
+			want, err := legacy.GetIndex(sqlparser.NewIntVal([]byte(val)))
+			assert.Nil(t, err)
+			got, err := hash.GetIndex(sqlparser.NewIntVal([]byte(val)))
+			assert.Nil(t, err)
+			assert.Equal(t, want, got)
+		}
+
+		// The legacy strings are hashed as they are.
+		idx1, err := legacy.GetIndex(sqlparser.NewStrVal([]byte("abc")))
+		assert.Nil(t, err)
+		idx2, err := legacy.GetIndex(sqlparser.NewStrVal([]byte("ABC")))
+		assert.Nil(t, err)
+		assert.NotEqual(t, idx1, idx2)
+	}
+
+	// Errors.
+	{
+		_, err := hash.GetIndex(sqlparser.NewIntVal([]byte("18446744073709551616")))
+		assert.Equal(t, "hash.getindex.val.key.parser.uint64.error:[strconv.ParseInt: parsing \"18446744073709551616\": value out of range]", err.Error())
+		_, err = hash.GetIndex(sqlparser.NewFloatVal([]byte("1e19")))
+		assert.Equal(t, "hash.getindex.val.key.float[1e19].out.of.range", err.Error())
+		_, err = hash.GetIndex(sqlparser.NewFloatVal([]byte("9223372036854775807.5")))
+		assert.Equal(t, "hash.getindex.val.key.float[9223372036854775807.5].out.of.range", err.Error())
+	}
+}
+
+func TestHashBinaryKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockTableAConfig()
+	conf.ShardKeyType = config.ShardKeyTypeBinary
+	conf.ShardMap = &config.ShardMapConfig{
+		Keys: []*config.ShardMapKey{
+			{Key: "0x0a0b0c", Segment: "A4"},
+			{Key: "raw", Segment: "A4"},
+		},
+	}
+	hash := NewHash(log, _mockHashSlots, conf)
+	err := hash.Build()
+	assert.Nil(t, err)
+
+	// The string and the hex literals of the same bytes are on the same slot.
+	tests := [][]*sqlparser.SQLVal{
+		{sqlparser.NewStrVal([]byte("\x01\xfe\x00")), sqlparser.NewHexVal([]byte("01FE00")), sqlparser.NewHexNum([]byte("0x01fe00"))},
+		{sqlparser.NewStrVal([]byte("\x01")), sqlparser.NewHexNum([]byte("0x1"))},
+		{sqlparser.NewStrVal([]byte("12")), sqlparser.NewIntVal([]byte("12")), sqlparser.NewHexVal([]byte("3132"))},
+	}
+	for _, test := range tests {
+		want, err := hash.GetIndex(test[0])
+		assert.Nil(t, err)
+		for _, val := range test[1:] {
+			got, err := hash.GetIndex(val)
+			assert.Nil(t, err)
+			assert.Equal(t, want, got, string(val.Val))
+		}
+	}
+
+	// The bytes are hashed as they are, whatever the key normalization is.
+	{
+		idx1, err := hash.GetIndex(sqlparser.NewStrVal([]byte("abc")))
+		assert.Nil(t, err)
+		idx2, err := hash.GetIndex(sqlparser.NewStrVal([]byte("ABC")))
+		assert.Nil(t, err)
+		assert.NotEqual(t, idx1, idx2)
+
+		conf.KeyNormalization = config.KeyNormalizationLegacy
+		legacy := NewHash(log, _mockHashSlots, conf)
+		err = legacy.Build()
+		assert.Nil(t, err)
+		got, err := legacy.GetIndex(sqlparser.NewHexVal([]byte("414243")))
+		assert.Nil(t, err)
+		assert.Equal(t, idx2, got)
+	}
+
+	// Shard map.
+	{
+		segments, err := hash.Lookup(sqlparser.NewHexVal([]byte("0A0B0C")), sqlparser.NewHexVal([]byte("0A0B0C")))
+		assert.Nil(t, err)
+		assert.Equal(t, "A4", segments[0].Table)
+		segments, err = hash.Lookup(sqlparser.NewStrVal([]byte("raw")), sqlparser.NewStrVal([]byte("raw")))
+		assert.Nil(t, err)
+		assert.Equal(t, "A4", segments[0].Table)
+	}
+
+	// Errors.
+	{
+		_, err := hash.GetIndex(sqlparser.NewHexVal([]byte("0G")))
+		assert.Equal(t, "hash.getindex.val.key.hex[0G].malformed", err.Error())
+		_, err = hash.GetIndex(sqlparser.NewValArg([]byte(":v1")))
+		assert.Equal(t, "hash.unsupported.key.type:[5]", err.Error())
+
+		conf.ShardMap = &config.ShardMapConfig{Keys: []*config.ShardMapKey{{Key: "0xZZ", Segment: "A4"}}}
+		bad := NewHash(log, _mockHashSlots, conf)
+		err = bad.Build()
+		assert.Equal(t, "hash.getindex.val.key.hex[0xZZ].malformed", err.Error())
+	}
+
+	// The hex literals aren't supported on the other shard keys.
+	{
+		other := NewHash(log, _mockHashSlots, MockTableAConfig())
+		err := other.Build()
+		assert.Nil(t, err)
+		_, err = other.GetIndex(sqlparser.NewHexVal([]byte("01")))
+		assert.Equal(t, "hash.unsupported.key.type:[4]", err.Error())
+	}
+}
+
+func TestHashTemporalKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	str := func(s string) *sqlparser.SQLVal { return sqlparser.NewStrVal([]byte(s)) }
+
+	// The same time in the different forms is on the same slot.
+	{
+		conf := MockTableAConfig()
+		conf.ShardKeyType = config.ShardKeyTypeDatetime
+		hash := NewHash(log, _mockHashSlots, conf)
+		err := hash.Build()
+		assert.Nil(t, err)
+
+		tests := [][]*sqlparser.SQLVal{
+			{str("2020-01-02"), str("2020/1/2 00:00:00"), str("2020-01-02T00:00:00.999"), sqlparser.NewIntVal([]byte("20200102"))},
+			{str("2020-01-02 03:04:05"), str("20200102030405"), sqlparser.NewIntVal([]byte("20200102030405")), str("2020-01-02 04:04:05+01:00")},
+		}
+		for _, test := range tests {
+			want, err := hash.GetIndex(test[0])
+			assert.Nil(t, err)
+			for _, val := range test[1:] {
+				got, err := hash.GetIndex(val)
+				assert.Nil(t, err)
+				assert.Equal(t, want, got, string(val.Val))
+			}
+		}
+	}
+
+	// The TIMESTAMP is hashed by the UTC time, the DATE by the date part.
+	{
+		conf := MockTableAConfig()
+		conf.ShardKeyType = config.ShardKeyTypeTimestamp
+		conf.TimeZone = "+08:00"
+		hash := NewHash(log, _mockHashSlots, conf)
+		err := hash.Build()
+		assert.Nil(t, err)
+		idx1, err := hash.GetIndex(str("2020-01-02 08:00:00"))
+		assert.Nil(t, err)
+		idx2, err := hash.GetIndex(str("2020-01-02 00:00:00+00:00"))
+		assert.Nil(t, err)
+		assert.Equal(t, idx1, idx2)
+
+		conf = MockTableAConfig()
+		conf.ShardKeyType = config.ShardKeyTypeDate
+		date := NewHash(log, _mockHashSlots, conf)
+		err = date.Build()
+		assert.Nil(t, err)
+		idx1, err = date.GetIndex(str("2020-01-02"))
+		assert.Nil(t, err)
+		idx2, err = date.GetIndex(str("2020-01-02 23:59:59"))
+		assert.Nil(t, err)
+		assert.Equal(t, idx1, idx2)
+	}
+
+	// Range.
+	{
+		conf := MockTableAConfig()
+		conf.ShardKeyType = config.ShardKeyTypeDate
+		conf.ShardMap = &config.ShardMapConfig{
+			Keys: []*config.ShardMapKey{
+				{Key: "2019-06-01", Segment: "A4"},
+			},
+			Ranges: []*config.ShardMapRange{
+				{Start: 20190101000000, End: 20200101000000, Segment: "A2"},
+			},
+		}
+		hash := NewHash(log, _mockHashSlots, conf)
+		err := hash.Build()
+		assert.Nil(t, err)
+
+		// Within the range of the shard map.
+		indexes, ok, err := hash.GetRangeIndex(str("2019-03-01"), str("2019-12-31"))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 2, len(indexes))
+		segment, err := hash.GetSegment(indexes[0])
+		assert.Nil(t, err)
+		assert.Equal(t, "A2", segment.Table)
+		segment, err = hash.GetSegment(indexes[1])
+		assert.Nil(t, err)
+		assert.Equal(t, "A4", segment.Table)
+
+		// The days are enumerated.
+		indexes, ok, err = hash.GetRangeIndex(str("2020-01-30"), str("2020-02-02"))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, 4, len(indexes))
+		idx, err := hash.GetIndex(str("2020-01-31"))
+		assert.Nil(t, err)
+		assert.Equal(t, idx, indexes[1])
+
+		// Too many days, or the empty range.
+		_, ok, err = hash.GetRangeIndex(str("2020-01-01"), str("2020-12-31"))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		_, ok, err = hash.GetRangeIndex(str("2020-02-02"), str("2020-01-30"))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+
+		// The other shard keys can't be pruned.
+		other := NewHash(log, _mockHashSlots, MockTableAConfig())
+		err = other.Build()
+		assert.Nil(t, err)
+		_, ok, err = other.GetRangeIndex(str("2020-01-30"), str("2020-02-02"))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+
+	// Errors.
+	{
+		conf := MockTableAConfig()
+		conf.ShardKeyType = config.ShardKeyTypeDate
+		hash := NewHash(log, _mockHashSlots, conf)
+		err := hash.Build()
+		assert.Nil(t, err)
+		_, err = hash.GetIndex(str("2020-02-30"))
+		assert.Equal(t, "hash.getindex.val.key.date[2020-02-30].out.of.range", err.Error())
+		_, err = hash.GetIndex(str("yesterday"))
+		assert.Equal(t, "hash.getindex.val.key.date[yesterday].malformed", err.Error())
+		_, _, err = hash.GetRangeIndex(str("2020-01-01"), str("tomorrow"))
+		assert.Equal(t, "hash.getindex.val.key.date[tomorrow].malformed", err.Error())
+
+		conf.TimeZone = "Mars/Olympus"
+		bad := NewHash(log, _mockHashSlots, conf)
+		err = bad.Build()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestHashShardMap(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockTableAConfig()
+	conf.ShardMap = &config.ShardMapConfig{
+		Keys: []*config.ShardMapKey{
+			{Key: "-65536", Segment: "A2"},
+			{Key: "shardkey", Segment: "A4"},
+		},
+		Ranges: []*config.ShardMapRange{
+			{Start: 100, End: 200, Segment: "A0"},
+			{Start: 200, End: 300, Segment: "A2"},
+		},
+	}
+	hash := NewHash(log, _mockHashSlots, conf)
+	err := hash.Build()
+	assert.Nil(t, err)
+
+	tests := []struct {
+		val   *sqlparser.SQLVal
+		table string
+	}{
+		{sqlparser.NewIntVal([]byte("-65536")), "A2"},
+		{sqlparser.NewStrVal([]byte("shardkey")), "A4"},
+		{sqlparser.NewIntVal([]byte("100")), "A0"},
+		{sqlparser.NewIntVal([]byte("199")), "A0"},
+		{sqlparser.NewIntVal([]byte("200")), "A2"},
+		// Not mapped, by the hash.
+		{sqlparser.NewIntVal([]byte("300")), "A8"},
+		// The canonical keys.
+		{sqlparser.NewStrVal([]byte("100")), "A0"},
+		{sqlparser.NewStrVal([]byte("ShardKey  ")), "A4"},
+	}
+	for _, test := range tests {
+		parts, err := hash.Lookup(test.val, test.val)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(parts))
+		assert.Equal(t, test.table, parts[0].Table, string(test.val.Val))
+
+		idx, err := hash.GetIndex(test.val)
+		assert.Nil(t, err)
+		segment, err := hash.GetSegment(idx)
+		assert.Nil(t, err)
+		assert.Equal(t, test.table, segment.Table)
+	}
+
+	// The legacy table maps the keys as they are.
+	conf.KeyNormalization = config.KeyNormalizationLegacy
+	hash = NewHash(log, _mockHashSlots, conf)
+	err = hash.Build()
+	assert.Nil(t, err)
+	idx, err := hash.GetIndex(sqlparser.NewStrVal([]byte("100")))
+	assert.Nil(t, err)
+	segment, err := hash.GetSegment(idx)
+	assert.Nil(t, err)
+	assert.Equal(t, "A8", segment.Table)
+
+	// The shard map is cleared.
+	hash = NewHash(log, _mockHashSlots, MockTableAConfig())
+	err = hash.Build()
+	assert.Nil(t, err)
+	_, err = hash.GetSegment(_mockHashSlots)
+	assert.NotNil(t, err)
+}
+
+func TestHashShardMapError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tests := []struct {
+		shardMap *config.ShardMapConfig
+		err      string
+	}{
+		{
+			&config.ShardMapConfig{Keys: []*config.ShardMapKey{{Key: "1", Segment: "A9"}}},
+			"hash.shard.map.key[1].segment[A9].not.found",
+		},
+		{
+			&config.ShardMapConfig{Keys: []*config.ShardMapKey{{Key: "1", Segment: "A0"}, {Key: "1", Segment: "A2"}}},
+			"hash.shard.map.key[1].duplicate",
+		},
+		{
+			&config.ShardMapConfig{Ranges: []*config.ShardMapRange{{Start: 1, End: 2, Segment: "A9"}}},
+			"hash.shard.map.range[1-2).segment[A9].not.found",
+		},
+		{
+			&config.ShardMapConfig{Ranges: []*config.ShardMapRange{{Start: 2, End: 2, Segment: "A0"}}},
+			"hash.shard.map.range[2-2).start>=end",
+		},
+		{
+			&config.ShardMapConfig{Ranges: []*config.ShardMapRange{{Start: 10, End: 20, Segment: "A0"}, {Start: 1, End: 11, Segment: "A2"}}},
+			"hash.shard.map.range[10-20).overlapped.with[1-11)",
+		},
+	}
+	for _, test := range tests {
+		conf := MockTableAConfig()
+		conf.ShardMap = test.shardMap
+		hash := NewHash(log, _mockHashSlots, conf)
+		err := hash.Build()
+		assert.Equal(t, test.err, err.Error())
+	}
+}
+
 func TestHashLookupBench(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	hash := NewHash(log, _mockHashSlots, MockTableAConfig())
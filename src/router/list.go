@@ -0,0 +1,154 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"bytes"
+	"strings"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// ListPartition tuple, the rows whose shard key is one of the values are on the backend.
+type ListPartition struct {
+	Backend string
+	Values  []*sqlparser.SQLVal
+}
+
+// ListRange for Segment.Range, the values of the partition.
+type ListRange struct {
+	str string
+}
+
+// String returns the values, such as '{1,3,5}'.
+func (r *ListRange) String() string {
+	return r.str
+}
+
+// Less impl.
+func (r *ListRange) Less(b KeyRange) bool {
+	return false
+}
+
+// List for the LIST table router, the shard key values are listed to the partitions by hand.
+type List struct {
+	log *xlog.Log
+
+	// list method.
+	typ MethodType
+
+	// table config.
+	conf *config.TableConfig
+
+	// Segments slice.
+	Segments []Segment `json:",omitempty"`
+
+	// values is the canonical value to the index of the segment.
+	values map[string]int
+}
+
+// NewList creates new list.
+func NewList(log *xlog.Log, conf *config.TableConfig) *List {
+	return &List{
+		log:      log,
+		conf:     conf,
+		typ:      methodTypeList,
+		Segments: make([]Segment, 0, 16),
+		values:   make(map[string]int),
+	}
+}
+
+// Build used to build Segments and the values from schema config.
+func (l *List) Build() error {
+	if l.conf == nil {
+		return errors.New("table.config..can't.be.nil")
+	}
+	for i, part := range l.conf.Partitions {
+		if len(part.ListValues) == 0 {
+			return errors.Errorf("list.partition[%v].values.can't.be.empty", part.Table)
+		}
+		for _, value := range part.ListValues {
+			key, err := canonicalHashKey(sqlparser.NewStrVal([]byte(value)))
+			if err != nil {
+				return err
+			}
+			if _, ok := l.values[key.String()]; ok {
+				return errors.Errorf("list.partition[%v].value[%v].duplicate", part.Table, value)
+			}
+			l.values[key.String()] = i
+		}
+		l.Segments = append(l.Segments, Segment{
+			Table:   part.Table,
+			Backend: part.Backend,
+			Range: &ListRange{
+				str: "{" + strings.Join(part.ListValues, ",") + "}",
+			},
+		})
+	}
+	return nil
+}
+
+// Lookup used to lookup partition(s) through the sharding-key range,
+// the equal one is on the segment of the value and the range is on all the segments.
+func (l *List) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment, error) {
+	if start == nil || end == nil {
+		return l.Segments, nil
+	}
+	if start.Type != end.Type {
+		return nil, errors.Errorf("list.lookup.key.type.must.be.same:[%v!=%v]", start.Type, end.Type)
+	}
+	if bytes.Equal(start.Val, end.Val) {
+		idx, err := l.GetIndex(start)
+		if err != nil {
+			return nil, err
+		}
+		segment, err := l.GetSegment(idx)
+		if err != nil {
+			return nil, err
+		}
+		return []Segment{segment}, nil
+	}
+	return l.Segments, nil
+}
+
+// Type returns the list type.
+func (l *List) Type() MethodType {
+	return l.typ
+}
+
+// GetIndex returns the index of the segment whose values have the sqlval, the values are compared
+// in the canonical form as the HASH shard keys, such as '01' is 1.
+func (l *List) GetIndex(sqlval *sqlparser.SQLVal) (int, error) {
+	key, err := canonicalHashKey(sqlval)
+	if err != nil {
+		return -1, err
+	}
+	idx, ok := l.values[key.String()]
+	if !ok {
+		return -1, errors.Errorf("list.table[%v].has.no.partition.for.value[%v]", l.conf.Name, common.BytesToString(sqlval.Val))
+	}
+	return idx, nil
+}
+
+// GetSegments returns Segments based on index.
+func (l *List) GetSegments() []Segment {
+	return l.Segments
+}
+
+func (l *List) GetSegment(index int) (Segment, error) {
+	if index < 0 || index >= len(l.Segments) {
+		return Segment{}, errors.Errorf("list.getsegment.index.[%d].out.of.range", index)
+	}
+	return l.Segments[index], nil
+}
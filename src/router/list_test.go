@@ -0,0 +1,138 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestList(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	list := NewList(log, MockTableLConfig())
+	{
+		err := list.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, string(list.Type()), methodTypeList)
+		assert.Equal(t, 2, len(list.GetSegments()))
+		assert.Equal(t, "{1,3,beijing}", list.Segments[0].Range.String())
+	}
+
+	// GetIndex.
+	{
+		tests := []struct {
+			val *sqlparser.SQLVal
+			idx int
+		}{
+			{sqlparser.NewIntVal([]byte("1")), 0},
+			{sqlparser.NewIntVal([]byte("-4")), 1},
+			{sqlparser.NewStrVal([]byte("03")), 0},
+			{sqlparser.NewFloatVal([]byte("2.0")), 1},
+			{sqlparser.NewStrVal([]byte("BeiJing ")), 0},
+		}
+		for _, test := range tests {
+			idx, err := list.GetIndex(test.val)
+			assert.Nil(t, err)
+			assert.Equal(t, test.idx, idx, string(test.val.Val))
+		}
+
+		_, err := list.GetIndex(sqlparser.NewIntVal([]byte("5")))
+		assert.Equal(t, "list.table[L].has.no.partition.for.value[5]", err.Error())
+	}
+
+	// Lookup.
+	{
+		one := sqlparser.NewIntVal([]byte("1"))
+		two := sqlparser.NewIntVal([]byte("2"))
+		parts, err := list.Lookup(one, one)
+		assert.Nil(t, err)
+		assert.Equal(t, []Segment{list.Segments[0]}, parts)
+
+		parts, err = list.Lookup(one, two)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(parts))
+
+		parts, err = list.Lookup(nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(parts))
+
+		_, err = list.Lookup(one, sqlparser.NewStrVal([]byte("1")))
+		assert.NotNil(t, err)
+
+		_, err = list.GetSegment(2)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestListError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	{
+		list := NewList(log, nil)
+		assert.NotNil(t, list.Build())
+	}
+
+	// Duplicate value.
+	{
+		conf := MockTableLConfig()
+		conf.Partitions[1].ListValues = []string{"2", "01"}
+		list := NewList(log, conf)
+		assert.Equal(t, "list.partition[L_0001].value[01].duplicate", list.Build().Error())
+	}
+
+	// Empty values.
+	{
+		conf := MockTableLConfig()
+		conf.Partitions[1].ListValues = nil
+		list := NewList(log, conf)
+		assert.NotNil(t, list.Build())
+	}
+}
+
+func TestRouterList(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	err = router.CreateTable("sbtest", "t1", "id", TableTypeList, []string{"backend1", "backend2"}, &Extra{
+		ListPartitions: []ListPartition{
+			{Backend: "backend2", Values: []*sqlparser.SQLVal{sqlparser.NewIntVal([]byte("1")), sqlparser.NewStrVal([]byte("SH"))}},
+			{Backend: "backend1", Values: []*sqlparser.SQLVal{sqlparser.NewIntVal([]byte("2"))}},
+		},
+	})
+	assert.Nil(t, err)
+
+	tconf, err := router.TableConfig("sbtest", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, "LIST", tconf.ShardType)
+	assert.Equal(t, []*config.PartitionConfig{
+		{Table: "t1_0000", Backend: "backend2", ListValues: []string{"1", "sh"}},
+		{Table: "t1_0001", Backend: "backend1", ListValues: []string{"2"}},
+	}, tconf.Partitions)
+
+	val := sqlparser.NewStrVal([]byte("sh"))
+	segments, err := router.Lookup("sbtest", "t1", val, val)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(segments))
+	assert.Equal(t, "t1_0000", segments[0].Table)
+	assert.Equal(t, "backend2", segments[0].Backend)
+
+	// Reload from the frm files.
+	err = router.ReLoad()
+	assert.Nil(t, err)
+	idx, err := router.GetIndex("sbtest", "t1", sqlparser.NewIntVal([]byte("2")))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, idx)
+}
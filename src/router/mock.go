@@ -345,6 +345,48 @@ func MockTableSConfig() *config.TableConfig {
 	}
 }
 
+// MockTableLConfig config, list shardtype.
+func MockTableLConfig() *config.TableConfig {
+	return &config.TableConfig{
+		Name:      "L",
+		ShardType: "LIST",
+		ShardKey:  "id",
+		Partitions: []*config.PartitionConfig{
+			&config.PartitionConfig{
+				Table:      "L_0000",
+				Backend:    "backend1",
+				ListValues: []string{"1", "3", "beijing"},
+			},
+			&config.PartitionConfig{
+				Table:      "L_0001",
+				Backend:    "backend2",
+				ListValues: []string{"2", "-4"},
+			},
+		},
+	}
+}
+
+// MockTableCHConfig config, chash shardtype.
+func MockTableCHConfig() *config.TableConfig {
+	return &config.TableConfig{
+		Name:      "CH",
+		ShardType: "CHASH",
+		ShardKey:  "id",
+		Partitions: []*config.PartitionConfig{
+			&config.PartitionConfig{
+				Table:   "CH_0000",
+				Backend: "backend1",
+				Ring:    ringPositions(0),
+			},
+			&config.PartitionConfig{
+				Table:   "CH_0001",
+				Backend: "backend2",
+				Ring:    ringPositions(1),
+			},
+		},
+	}
+}
+
 // mockTmpDir is only used for MockNewRouter()
 var (
 	log        = xlog.NewStdLog(xlog.Level(xlog.PANIC))
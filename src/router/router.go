@@ -10,7 +10,10 @@ package router
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"config"
 
@@ -23,6 +26,12 @@ import (
 // Extra -- router extra params.
 type Extra struct {
 	AutoIncrement *config.AutoIncrement
+	// ShardKeyType is the shard-key-type of the HASH table.
+	ShardKeyType string
+	// ListPartitions are the partitions of the LIST table.
+	ListPartitions []ListPartition
+	// Partitions is the number of the segments of the HASH or CHASH table, 0 means the router config.
+	Partitions int
 }
 
 // Table tuple.
@@ -35,6 +44,10 @@ type Table struct {
 	Partition Partition `json:",omitempty"`
 	// table config.
 	TableConfig *config.TableConfig `json:"-"`
+
+	// file is the frm file of the stub in the lazy mode, the stub only has the name
+	// and is loaded by the cache on the access.
+	file string
 }
 
 // Schema tuple.
@@ -46,6 +59,8 @@ type Schema struct {
 }
 
 // Router tuple.
+// The querys read the snapshot of the schemas without locks, the DDL and admin changes
+// are made on the schemas under the lock and install a new snapshot at the unlock.
 type Router struct {
 	log     *xlog.Log
 	mu      sync.RWMutex
@@ -53,8 +68,16 @@ type Router struct {
 	dbACL   *DatabaseACL
 	conf    *config.RouterConfig
 
-	// schemas map, key is database name
-	Schemas map[string]*Schema `json:",omitempty"`
+	// schemas map, key is database name, guarded by the mu.
+	schemas map[string]*Schema
+	// changed is the databases changed since the last publish, guarded by the mu.
+	changed map[string]bool
+
+	// snapshot is the map[string]*Schema copied from the schemas at the last change.
+	snapshot atomic.Value
+
+	// cache is the loaded tables of the stubs in the lazy mode, nil if all the tables are loaded at the startup.
+	cache *tableCache
 }
 
 // NewRouter creates the new router.
@@ -64,11 +87,52 @@ func NewRouter(log *xlog.Log, metadir string, conf *config.RouterConfig) *Router
 		metadir: metadir,
 		conf:    conf,
 		dbACL:   NewDatabaseACL(),
-		Schemas: make(map[string]*Schema),
+		schemas: make(map[string]*Schema),
+		changed: make(map[string]bool),
 	}
+	if conf.LazyLoad {
+		route.cache = newTableCache(conf.TableCacheSize)
+	}
+	route.publish()
 	return route
 }
 
+// publish used to install the snapshot of the schemas, it must be called with the lock held.
+// Only the tables maps of the changed databases are copied, the others are shared with the last snapshot,
+// the tables are shared since they're not changed once added.
+func (r *Router) publish() {
+	last, _ := r.snapshot.Load().(map[string]*Schema)
+	if last != nil && len(r.changed) == 0 {
+		return
+	}
+	snapshot := make(map[string]*Schema, len(r.schemas))
+	for db, schema := range r.schemas {
+		if published, ok := last[db]; ok && !r.changed[db] {
+			snapshot[db] = published
+			continue
+		}
+		tables := make(map[string]*Table, len(schema.Tables))
+		for name, table := range schema.Tables {
+			tables[name] = table
+		}
+		snapshot[db] = &Schema{DB: schema.DB, Tables: tables}
+	}
+	r.snapshot.Store(snapshot)
+	r.changed = make(map[string]bool)
+}
+
+// unlock used to publish the changes and release the write lock.
+func (r *Router) unlock() {
+	r.publish()
+	r.mu.Unlock()
+}
+
+// Schemas returns the current snapshot of the schemas, key is database name, it must not be changed.
+// In the lazy mode the tables not loaded yet are the stubs only have the name.
+func (r *Router) Schemas() map[string]*Schema {
+	return r.snapshot.Load().(map[string]*Schema)
+}
+
 // addTable -- used to add a table router to schema map.
 func (r *Router) addTable(db string, tbl *config.TableConfig) error {
 	var ok bool
@@ -83,10 +147,11 @@ func (r *Router) addTable(db string, tbl *config.TableConfig) error {
 	}
 
 	// schema
-	if schema, ok = r.Schemas[db]; !ok {
+	if schema, ok = r.schemas[db]; !ok {
 		schema = &Schema{DB: db, Tables: make(map[string]*Table)}
-		r.Schemas[db] = schema
+		r.schemas[db] = schema
 	}
+	r.changed[db] = true
 
 	// table
 	if _, ok = schema.Tables[tbl.Name]; !ok {
@@ -101,6 +166,16 @@ func (r *Router) addTable(db string, tbl *config.TableConfig) error {
 	}
 
 	// methods
+	partition, err := r.buildPartition(tbl)
+	if err != nil {
+		return err
+	}
+	table.Partition = partition
+	return nil
+}
+
+// buildPartition used to build the partition of the table config.
+func (r *Router) buildPartition(tbl *config.TableConfig) (Partition, error) {
 	switch tbl.ShardType {
 	case methodTypeHash:
 		slots := tbl.Slots
@@ -109,25 +184,61 @@ func (r *Router) addTable(db string, tbl *config.TableConfig) error {
 		}
 		hash := NewHash(r.log, slots, tbl)
 		if err := hash.Build(); err != nil {
-			return err
+			return nil, err
 		}
-		table.Partition = hash
+		return hash, nil
 	case methodTypeGlobal:
 		global := NewGlobal(r.log, tbl)
 		if err := global.Build(); err != nil {
-			return err
+			return nil, err
 		}
-		table.Partition = global
+		return global, nil
 	case methodTypeSingle:
 		single := NewSingle(r.log, tbl)
 		if err := single.Build(); err != nil {
-			return err
+			return nil, err
+		}
+		return single, nil
+	case methodTypeList:
+		list := NewList(r.log, tbl)
+		if err := list.Build(); err != nil {
+			return nil, err
 		}
-		table.Partition = single
+		return list, nil
+	case methodTypeCHash:
+		chash := NewCHash(r.log, tbl)
+		if err := chash.Build(); err != nil {
+			return nil, err
+		}
+		return chash, nil
 	default:
-		return errors.Errorf("router.unsupport.shardtype:[%v]", tbl.ShardType)
+		return nil, errors.Errorf("router.unsupport.shardtype:[%v]", tbl.ShardType)
 	}
-	return nil
+}
+
+// addStub used to add the stub of the table read on the access, it must be called with the lock held.
+func (r *Router) addStub(db string, name string, file string) {
+	r.schemas[db].Tables[name] = &Table{Name: name, file: file}
+	r.changed[db] = true
+}
+
+// resolve returns the table with the partition, the stub is loaded by the cache.
+func (r *Router) resolve(db string, table *Table) (*Table, error) {
+	if table.file == "" {
+		return table, nil
+	}
+	return r.cache.get(table, func() (*Table, error) {
+		conf, err := r.readTableFrmData(table.file)
+		if err != nil {
+			return nil, err
+		}
+		partition, err := r.buildPartition(conf)
+		if err != nil {
+			r.log.Error("router.load.table[%s.%s].error:%+v", db, table.Name, err)
+			return nil, err
+		}
+		return &Table{Name: conf.Name, ShardKey: conf.ShardKey, Partition: partition, TableConfig: conf}, nil
+	})
 }
 
 // removeTable -- used to remvoe a table router from schema map.
@@ -136,7 +247,7 @@ func (r *Router) removeTable(db string, table string) error {
 	var schema *Schema
 
 	// schema
-	if schema, ok = r.Schemas[db]; !ok {
+	if schema, ok = r.schemas[db]; !ok {
 		return errors.Errorf("router.can.not.find.db[%v]", db)
 	}
 	// table
@@ -144,30 +255,48 @@ func (r *Router) removeTable(db string, table string) error {
 		return errors.Errorf("router.can.not.find.table[%v]", table)
 	}
 	// remove
+	r.uncache(schema.Tables[table])
 	delete(schema.Tables, table)
+	r.changed[db] = true
 	return nil
 }
 
 func (r *Router) addDatabase(db string) error {
-	if _, ok := r.Schemas[db]; !ok {
+	if _, ok := r.schemas[db]; !ok {
 		schema := &Schema{DB: db, Tables: make(map[string]*Table)}
-		r.Schemas[db] = schema
+		r.schemas[db] = schema
+		r.changed[db] = true
 		return nil
 	}
 	return errors.Errorf("router.database.exists")
 }
 
 func (r *Router) dropDatabase(db string) error {
-	if _, ok := r.Schemas[db]; !ok {
+	schema, ok := r.schemas[db]
+	if !ok {
 		return errors.Errorf("router.can.not.find.db[%v]", db)
 	}
-	delete(r.Schemas, db)
+	for _, table := range schema.Tables {
+		r.uncache(table)
+	}
+	delete(r.schemas, db)
+	r.changed[db] = true
 	return nil
 }
 
+// uncache used to remove the loaded table of the stub from the cache.
+func (r *Router) uncache(table *Table) {
+	if table.file != "" {
+		r.cache.remove(table)
+	}
+}
+
 // clear used to reset Schemas to new.
 func (r *Router) clear() {
-	r.Schemas = make(map[string]*Schema)
+	for db := range r.schemas {
+		r.changed[db] = true
+	}
+	r.schemas = make(map[string]*Schema)
 }
 
 // DatabaseACL used to check wheather the database is a system database.
@@ -179,6 +308,12 @@ func (r *Router) DatabaseACL(database string) error {
 	return nil
 }
 
+// DatabaseExists used to check whether the database is in the metadata.
+func (r *Router) DatabaseExists(database string) bool {
+	_, ok := r.Schemas()[database]
+	return ok
+}
+
 // IsSystemDB used to check wheather the database is a system database.
 func (r *Router) IsSystemDB(database string) bool {
 	return r.dbACL.IsSystemDB(database)
@@ -189,10 +324,6 @@ func (r *Router) getTable(database string, tableName string) (*Table, error) {
 	var schema *Schema
 	var table *Table
 
-	// lock
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	if database == "" {
 		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
 	}
@@ -201,7 +332,7 @@ func (r *Router) getTable(database string, tableName string) (*Table, error) {
 	}
 
 	// schema
-	if schema, ok = r.Schemas[database]; !ok {
+	if schema, ok = r.Schemas()[database]; !ok {
 		r.log.Error("router.can.not.find.db[%v]", database)
 		return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, database+"."+tableName)
 	}
@@ -211,7 +342,7 @@ func (r *Router) getTable(database string, tableName string) (*Table, error) {
 		r.log.Error("router.can.not.find.table[%v]", tableName)
 		return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, tableName)
 	}
-	return table, nil
+	return r.resolve(database, table)
 }
 
 // ShardKey used to lookup shardkey from given database and table name
@@ -232,6 +363,21 @@ func (r *Router) TableConfig(database string, tableName string) (*config.TableCo
 	return table.TableConfig, nil
 }
 
+// CanonicalPartition returns the partition of the HASH table on the canonical key normalization,
+// it's used to find the rows of the legacy table which the canonical one routes to the other segments.
+func (r *Router) CanonicalPartition(database string, tableName string) (Partition, error) {
+	table, err := r.getTable(database, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if table.TableConfig.ShardType != methodTypeHash {
+		return nil, errors.Errorf("router.canonical.partition.table[%s.%s].shardtype[%s].must.be.HASH", database, tableName, table.TableConfig.ShardType)
+	}
+	tconf := *table.TableConfig
+	tconf.KeyNormalization = ""
+	return r.buildPartition(&tconf)
+}
+
 // Lookup used to lookup a router(partition table name and backend) through db&table
 func (r *Router) Lookup(database string, tableName string, startKey *sqlparser.SQLVal, endKey *sqlparser.SQLVal) ([]Segment, error) {
 	var ok bool
@@ -239,10 +385,6 @@ func (r *Router) Lookup(database string, tableName string, startKey *sqlparser.S
 	var schema *Schema
 	var table *Table
 
-	// lock
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	if database == "" {
 		return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR)
 	}
@@ -251,7 +393,7 @@ func (r *Router) Lookup(database string, tableName string, startKey *sqlparser.S
 	}
 
 	// schema
-	if schema, ok = r.Schemas[database]; !ok {
+	if schema, ok = r.Schemas()[database]; !ok {
 		r.log.Error("router.can.not.find.db[%v]", database)
 		return nil, sqldb.NewSQLError(sqldb.ER_BAD_DB_ERROR, database)
 	}
@@ -261,6 +403,9 @@ func (r *Router) Lookup(database string, tableName string, startKey *sqlparser.S
 		r.log.Error("router.can.not.find.table[%v]", tableName)
 		return nil, sqldb.NewSQLError(sqldb.ER_NO_SUCH_TABLE, tableName)
 	}
+	if table, err = r.resolve(database, table); err != nil {
+		return nil, err
+	}
 
 	// router info
 	partInfos, err := table.Partition.Lookup(startKey, endKey)
@@ -273,11 +418,8 @@ func (r *Router) Lookup(database string, tableName string, startKey *sqlparser.S
 
 // Tables returns all the tables.
 func (r *Router) Tables() map[string][]string {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	list := make(map[string][]string)
-	for _, schema := range r.Schemas {
+	for _, schema := range r.Schemas() {
 		db := schema.DB
 		tables := make([]string, 0, 16)
 		for _, table := range schema.Tables {
@@ -288,9 +430,54 @@ func (r *Router) Tables() map[string][]string {
 	return list
 }
 
+// SegmentTable returns the table of the segment by the segment naming of the tables, both are named as 'db.table',
+// and the number of the table segments. The tables not loaded yet in the lazy mode are matched by the default naming
+// and the number is 0. The table is empty if it's not found.
+func (r *Router) SegmentTable(segment string) (string, int) {
+	i := strings.IndexByte(segment, '.')
+	if i < 0 {
+		return "", 0
+	}
+	database, name := segment[:i], segment[i+1:]
+	schema, ok := r.Schemas()[database]
+	if !ok {
+		return "", 0
+	}
+	for _, table := range schema.Tables {
+		naming, segments := config.DefaultSegmentNaming(), 0
+		if tconf := table.TableConfig; tconf != nil {
+			if tconf.SegmentNaming != nil {
+				naming = tconf.SegmentNaming
+			}
+			segments = len(tconf.Partitions)
+		}
+		if naming.Named(table.Name, name) {
+			return database + "." + table.Name, segments
+		}
+	}
+	return "", 0
+}
+
+// Databases returns the sorted names of the databases in the metadata and the system databases.
+func (r *Router) Databases() []string {
+	schemas := r.Schemas()
+	dbs := make([]string, 0, len(schemas)+len(systemDatabases))
+	for _, db := range systemDatabases {
+		dbs = append(dbs, strings.ToLower(db))
+	}
+	for db := range schemas {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+	return dbs
+}
+
 // JSON returns the info of router.
 func (r *Router) JSON() string {
-	bout, err := json.MarshalIndent(r, "", "\t")
+	snapshot := struct {
+		Schemas map[string]*Schema `json:",omitempty"`
+	}{r.Schemas()}
+	bout, err := json.MarshalIndent(snapshot, "", "\t")
 	if err != nil {
 		return err.Error()
 	}
@@ -312,6 +499,20 @@ func (r *Router) GetIndex(database, tableName string, sqlval *sqlparser.SQLVal)
 	return index, nil
 }
 
+// GetRangeIndex returns the indexes of the segments which the shard key values in [start, end] are on,
+// ok is false if the range of the table can't be pruned.
+func (r *Router) GetRangeIndex(database, tableName string, start, end *sqlparser.SQLVal) ([]int, bool, error) {
+	table, err := r.getTable(database, tableName)
+	if err != nil {
+		return nil, false, err
+	}
+	hash, ok := table.Partition.(*Hash)
+	if !ok {
+		return nil, false, nil
+	}
+	return hash.GetRangeIndex(start, end)
+}
+
 // GetSegments returns Segments based on index.
 func (r *Router) GetSegments(database, tableName string, index []int) ([]Segment, error) {
 	table, err := r.getTable(database, tableName)
@@ -9,8 +9,11 @@
 package router
 
 import (
+	"sync"
 	"testing"
 
+	"config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -82,6 +85,7 @@ func TestRouterAdd(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 		want := results[0]
 		got := router.JSON()
 		log.Debug(got)
@@ -141,6 +145,7 @@ func TestRouteraddGlobal(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableGConfig())
 		assert.Nil(t, err)
+		router.publish()
 		want := results[0]
 		got := router.JSON()
 		log.Debug(got)
@@ -179,6 +184,7 @@ func TestRouteraddSingle(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableSConfig())
 		assert.Nil(t, err)
+		router.publish()
 		want := results[0]
 		got := router.JSON()
 		log.Debug(got)
@@ -204,6 +210,7 @@ func TestRouterRemove(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableMConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		strVal := sqlparser.NewStrVal([]byte("shardkey"))
 		_, err = router.Lookup("sbtest", "A", strVal, strVal)
@@ -230,6 +237,7 @@ func TestRouterRemove(t *testing.T) {
 	{
 		err := router.removeTable("sbtest", MockTableAConfig().Name)
 		assert.Nil(t, err)
+		router.publish()
 
 		strVal := sqlparser.NewStrVal([]byte("shardkey"))
 		_, err = router.Lookup("sbtest", "A", strVal, strVal)
@@ -249,6 +257,7 @@ func TestRouterLookup(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		strVal := sqlparser.NewStrVal([]byte("shardkey"))
 		_, err = router.Lookup("sbtest", "A", strVal, strVal)
@@ -266,6 +275,7 @@ func TestRouterLookupError(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		// database error
 		{
@@ -297,6 +307,7 @@ func TestRouterShardKey(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		shardKey, err := router.ShardKey("sbtest", "A")
 		assert.Nil(t, err)
@@ -314,6 +325,7 @@ func TestRouterShardKeyError(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		// database error
 		{
@@ -391,6 +403,20 @@ func TestRouterIsSystemDB(t *testing.T) {
 	}
 }
 
+func TestRouterDatabases(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+	assert.NotNil(t, router)
+
+	err := router.CreateDatabase("test")
+	assert.Nil(t, err)
+	err = router.CreateDatabase("abc")
+	assert.Nil(t, err)
+	want := []string{"abc", "information_schema", "mysql", "performance_schema", "sys", "test"}
+	assert.Equal(t, want, router.Databases())
+}
+
 func TestRouterTableConfig(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	router, cleanup := MockNewRouter(log)
@@ -401,6 +427,7 @@ func TestRouterTableConfig(t *testing.T) {
 	{
 		err := router.addTable("sbtest", MockTableAConfig())
 		assert.Nil(t, err)
+		router.publish()
 
 		tConf, err := router.TableConfig("sbtest", "A")
 		assert.Nil(t, err)
@@ -592,3 +619,137 @@ func TestRouterTables(t *testing.T) {
 	got := router.Tables()
 	assert.Equal(t, want, got)
 }
+
+func TestRouterSegmentTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	backends := []string{"backend0", "backend1"}
+	t1, err := router.HashUniform("t1", "id", backends)
+	assert.Nil(t, err)
+	t2, err := router.HashUniform("t2", "id", backends)
+	assert.Nil(t, err)
+	t2.SegmentNaming = &config.SegmentNaming{Suffix: "_old", Width: 2}
+	t2.Partitions[0].Table = "t200_old"
+	err = router.AddForTest("sbtest", t1, t2)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		segment  string
+		table    string
+		segments int
+	}{
+		{"sbtest.t1_0001", "sbtest.t1", len(t1.Partitions)},
+		{"sbtest.t200_old", "sbtest.t2", len(t2.Partitions)},
+		{"sbtest.t2_0000", "", 0},
+		{"sbtest.t3_0000", "", 0},
+		{"xx.t1_0000", "", 0},
+		{"t1_0000", "", 0},
+	}
+	for _, test := range tests {
+		table, segments := router.SegmentTable(test.segment)
+		assert.Equal(t, test.table, table, test.segment)
+		assert.Equal(t, test.segments, segments, test.segment)
+	}
+}
+
+func TestRouterDatabaseExists(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+	assert.NotNil(t, router)
+
+	assert.False(t, router.DatabaseExists("sbtest"))
+	err := router.CreateDatabase("sbtest")
+	assert.Nil(t, err)
+	assert.True(t, router.DatabaseExists("sbtest"))
+}
+
+func TestRouterSnapshot(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateDatabase("test")
+	assert.Nil(t, err)
+	backends := []string{"backend1", "backend2"}
+	err = router.CreateTable("test", "t1", "id", "", backends, nil)
+	assert.Nil(t, err)
+
+	// The snapshot is not changed by the DDL.
+	snapshot := router.Schemas()
+	{
+		err := router.CreateTable("test", "t2", "id", "", backends, nil)
+		assert.Nil(t, err)
+		err = router.CreateTrigger("test", "t1", &config.TriggerConfig{Name: "trg1", Timing: "before", Event: "insert", Body: "set new.b=1"})
+		assert.Nil(t, err)
+		err = router.CreateDatabase("test1")
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, len(snapshot))
+		assert.Equal(t, 1, len(snapshot["test"].Tables))
+		assert.Equal(t, 0, len(snapshot["test"].Tables["t1"].TableConfig.Triggers))
+
+		schemas := router.Schemas()
+		assert.Equal(t, 2, len(schemas))
+		assert.Equal(t, 2, len(schemas["test"].Tables))
+		assert.Equal(t, 1, len(schemas["test"].Tables["t1"].TableConfig.Triggers))
+	}
+
+	// Only the changed database is copied, the others are shared with the last snapshot.
+	{
+		last := router.Schemas()
+		err := router.CreateTable("test1", "t1", "id", "", backends, nil)
+		assert.Nil(t, err)
+		schemas := router.Schemas()
+		assert.True(t, last["test"] == schemas["test"])
+		assert.False(t, last["test1"] == schemas["test1"])
+		assert.Equal(t, 0, len(last["test1"].Tables))
+		assert.Equal(t, 1, len(schemas["test1"].Tables))
+
+		err = router.DropDatabase("test1")
+		assert.Nil(t, err)
+		schemas = router.Schemas()
+		assert.Equal(t, 1, len(schemas))
+		assert.True(t, last["test"] == schemas["test"])
+	}
+
+	// The lookups run while the tables are created and dropped.
+	{
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					segments, err := router.Lookup("test", "t1", nil, nil)
+					assert.Nil(t, err)
+					assert.Equal(t, 32, len(segments))
+				}
+			}()
+		}
+		for i := 0; i < 20; i++ {
+			err := router.CreateTable("test", "t3", "id", "", backends, nil)
+			assert.Nil(t, err)
+			err = router.DropTable("test", "t3")
+			assert.Nil(t, err)
+		}
+		close(done)
+		wg.Wait()
+	}
+
+	// The reloading installs the same snapshot.
+	{
+		err := router.ReLoad()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(router.Schemas()["test"].Tables))
+		assert.Equal(t, 1, len(router.Schemas()["test"].Tables["t1"].TableConfig.Triggers))
+	}
+}
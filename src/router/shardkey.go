@@ -0,0 +1,285 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"encoding/hex"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"config"
+
+	"github.com/pkg/errors"
+	jump "github.com/renstrom/go-jump-consistent-hash"
+
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/common"
+)
+
+const (
+	// maxRangeDays is the max days of the DATE shard key range enumerated to prune the segments.
+	maxRangeDays = 64
+)
+
+var (
+	// numericKeyRegexp matches the string keys equal to an integer in MySQL, such as ' 01', '-5' and '5.00'.
+	numericKeyRegexp = regexp.MustCompile(`^\s*([+-]?[0-9]+)(\.0*)?\s*$`)
+
+	// temporalKeyRegexp matches the DATE/DATETIME literals such as '2020-01-02', '2020/1/2 03:04:05.123' and
+	// '2020-01-02T03:04:05+08:00'.
+	temporalKeyRegexp = regexp.MustCompile(`^\s*([0-9]{4})[-/.]([0-9]{1,2})[-/.]([0-9]{1,2})(?:[ T]([0-9]{1,2}):([0-9]{1,2}):([0-9]{1,2})(?:\.[0-9]{0,6})?)?\s*([+-][0-9]{2}:[0-9]{2})?\s*$`)
+
+	// compactTemporalKeyRegexp matches the YYYYMMDD and YYYYMMDDhhmmss literals, the integers and strings.
+	compactTemporalKeyRegexp = regexp.MustCompile(`^\s*([0-9]{4})([0-9]{2})([0-9]{2})(?:([0-9]{2})([0-9]{2})([0-9]{2})(?:\.[0-9]*)?)?\s*$`)
+)
+
+// hashKey tuple, the shard key value to hash.
+type hashKey struct {
+	isInt bool
+	big   bool  // the integer overflows the BIGINT, it's in uval only.
+	ival  int64 // the signed ones are hashed by their two's complement.
+	uval  uint64
+	str   string
+}
+
+// String returns the key of the shard map.
+func (k hashKey) String() string {
+	switch {
+	case k.big:
+		return strconv.FormatUint(k.uval, 10)
+	case k.isInt:
+		return strconv.FormatInt(k.ival, 10)
+	}
+	return k.str
+}
+
+// index returns the slot of the key.
+func (k hashKey) index(slots int) int {
+	if k.isInt {
+		return int(jump.Hash(k.uval, int32(slots)))
+	}
+	return int(jump.HashString(k.str, int32(slots), jump.CRC64))
+}
+
+func intHashKey(v int64) hashKey {
+	return hashKey{isInt: true, ival: v, uval: uint64(v)}
+}
+
+// canonicalHashKey returns the canonical form of the shard key value, the values equal in MySQL have the same form
+// whichever code path they come from:
+//  1. The integers are signed unless they overflow the BIGINT, '-0' is 0.
+//  2. The floats are rounded to the integers as MySQL stores them into the integer column, the integral ones such as 1.0
+//     are equal to the integers. The decimals are rounded half away from zero exactly, the ones with the exponent are
+//     approximate values and rounded to the nearest even.
+//  3. The strings are trimmed the trailing spaces(PAD SPACE) and lower-cased(the _ci collations),
+//     the ones equal to an integer such as '01' are the integer.
+func canonicalHashKey(sqlval *sqlparser.SQLVal) (hashKey, error) {
+	valStr := common.BytesToString(sqlval.Val)
+	switch sqlval.Type {
+	case sqlparser.IntVal:
+		v, err := strconv.ParseInt(valStr, 10, 64)
+		if err == nil {
+			return intHashKey(v), nil
+		}
+		if u, x := strconv.ParseUint(strings.TrimPrefix(valStr, "+"), 10, 64); x == nil {
+			return hashKey{isInt: true, big: true, uval: u}, nil
+		}
+		return hashKey{}, errors.Errorf("hash.getindex.val.key.parser.uint64.error:[%v]", err)
+	case sqlparser.FloatVal:
+		f, err := strconv.ParseFloat(valStr, 64)
+		if err != nil {
+			return hashKey{}, errors.Errorf("hash.getindex.val.key.parser.float.error:[%v]", err)
+		}
+		if !strings.ContainsAny(valStr, "eE") {
+			if v, ok := roundDecimal(valStr); ok {
+				return intHashKey(v), nil
+			}
+			return hashKey{}, errors.Errorf("hash.getindex.val.key.float[%v].out.of.range", valStr)
+		}
+		f = math.RoundToEven(f)
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return hashKey{}, errors.Errorf("hash.getindex.val.key.float[%v].out.of.range", valStr)
+		}
+		return intHashKey(int64(f)), nil
+	case sqlparser.StrVal:
+		if m := numericKeyRegexp.FindStringSubmatch(valStr); m != nil {
+			if v, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+				return intHashKey(v), nil
+			}
+			if v, err := strconv.ParseUint(strings.TrimPrefix(m[1], "+"), 10, 64); err == nil {
+				return hashKey{isInt: true, big: true, uval: v}, nil
+			}
+		}
+		return hashKey{str: strings.ToLower(strings.TrimRight(valStr, " "))}, nil
+	}
+	return hashKey{}, errors.Errorf("hash.unsupported.key.type:[%v]", sqlval.Type)
+}
+
+// roundDecimal rounds the decimal such as '-1.5' half away from zero on its digits, so it's exact at any precision.
+// It returns false if the result overflows the BIGINT.
+func roundDecimal(s string) (int64, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	v, err := strconv.ParseUint(intPart, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if frac != "" && frac[0] >= '5' {
+		if v == math.MaxUint64 {
+			return 0, false
+		}
+		v++
+	}
+	switch {
+	case neg && v <= 1<<63:
+		return int64(-v), true
+	case !neg && v < 1<<63:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// binaryHashKey returns the key of the BINARY/VARBINARY shard key value, the raw bytes compared byte by byte:
+// the strings are the bytes as they are, the hex literals are decoded and the numbers are the text they're
+// stored as when inserted to the binary column.
+func binaryHashKey(sqlval *sqlparser.SQLVal) (hashKey, error) {
+	switch sqlval.Type {
+	case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+		return hashKey{str: string(sqlval.Val)}, nil
+	case sqlparser.HexVal, sqlparser.HexNum:
+		b, err := decodeHexLiteral(sqlval)
+		if err != nil {
+			return hashKey{}, err
+		}
+		return hashKey{str: string(b)}, nil
+	}
+	return hashKey{}, errors.Errorf("hash.unsupported.key.type:[%v]", sqlval.Type)
+}
+
+// decodeHexLiteral returns the bytes of the X'..' or 0x.. literal, the 0x.. one with the odd digits has
+// a leading 0 as MySQL pads.
+func decodeHexLiteral(sqlval *sqlparser.SQLVal) ([]byte, error) {
+	digits := string(sqlval.Val)
+	if sqlval.Type == sqlparser.HexNum {
+		digits = digits[2:]
+		if len(digits)%2 == 1 {
+			digits = "0" + digits
+		}
+	}
+	b, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, errors.Errorf("hash.getindex.val.key.hex[%s].malformed", sqlval.Val)
+	}
+	return b, nil
+}
+
+// binaryShardMapKey returns the key of the shard map key of the binary shard key, the key
+// with the 0x prefix is the bytes it encodes.
+func binaryShardMapKey(key string) (string, error) {
+	if !strings.HasPrefix(key, "0x") {
+		return key, nil
+	}
+	k, err := binaryHashKey(sqlparser.NewHexNum([]byte(key)))
+	if err != nil {
+		return "", err
+	}
+	return k.String(), nil
+}
+
+// temporalKey returns the canonical time of the DATE/DATETIME/TIMESTAMP shard key value, the fractional seconds are dropped:
+// 1. The TIMESTAMP is the UTC time of the literal in the loc, or in the offset of the literal if it has.
+// 2. The DATETIME is the time as it is written, the literal with the offset is converted to the loc as MySQL does.
+// 3. The DATE is the date part.
+// The time returned is in UTC whichever it is, the DATETIME and DATE are the wall clock.
+func temporalKey(sqlval *sqlparser.SQLVal, keyType string, loc *time.Location) (time.Time, error) {
+	switch sqlval.Type {
+	case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+	default:
+		return time.Time{}, errors.Errorf("hash.unsupported.key.type:[%v]", sqlval.Type)
+	}
+	valStr := common.BytesToString(sqlval.Val)
+	m := temporalKeyRegexp.FindStringSubmatch(valStr)
+	if m == nil {
+		if m = compactTemporalKeyRegexp.FindStringSubmatch(valStr); m != nil {
+			m = append(m, "")
+		}
+	}
+	if m == nil {
+		return time.Time{}, errors.Errorf("hash.getindex.val.key.%s[%s].malformed", keyType, valStr)
+	}
+	var parts [6]int
+	for i := range parts {
+		if m[i+1] != "" {
+			parts[i], _ = strconv.Atoi(m[i+1])
+		}
+	}
+
+	zone := time.UTC
+	if keyType == config.ShardKeyTypeTimestamp {
+		zone = loc
+	}
+	if offset := m[7]; offset != "" {
+		z, err := config.ParseTimeZone(offset)
+		if err != nil {
+			return time.Time{}, errors.Errorf("hash.getindex.val.key.%s[%s].malformed", keyType, valStr)
+		}
+		zone = z
+	}
+	t := time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, zone)
+	if t.Month() != time.Month(parts[1]) || t.Day() != parts[2] || t.Hour() != parts[3] || t.Minute() != parts[4] || t.Second() != parts[5] {
+		return time.Time{}, errors.Errorf("hash.getindex.val.key.%s[%s].out.of.range", keyType, valStr)
+	}
+
+	switch {
+	case keyType == config.ShardKeyTypeTimestamp:
+		return t.UTC(), nil
+	case m[7] != "":
+		t = t.In(loc)
+	}
+	if keyType == config.ShardKeyTypeDate {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC), nil
+}
+
+// temporalHashKey returns the key of the canonical time, the YYYYMMDDhhmmss integer.
+func temporalHashKey(t time.Time) hashKey {
+	date := int64(t.Year())*10000 + int64(t.Month())*100 + int64(t.Day())
+	clock := int64(t.Hour())*10000 + int64(t.Minute())*100 + int64(t.Second())
+	return intHashKey(date*1000000 + clock)
+}
+
+// isTemporalShardKey returns true if the table is hashed by the canonical time of the shard key.
+func isTemporalShardKey(conf *config.TableConfig) bool {
+	switch conf.ShardKeyType {
+	case config.ShardKeyTypeDate, config.ShardKeyTypeDatetime, config.ShardKeyTypeTimestamp:
+		return true
+	}
+	return false
+}
+
+// isBinaryShardKey returns true if the table is hashed by the raw bytes of the shard key.
+func isBinaryShardKey(conf *config.TableConfig) bool {
+	return conf.ShardKeyType == config.ShardKeyTypeBinary
+}
+
+// isLegacyKeyNormalization returns true if the table is on the legacy key normalization.
+func isLegacyKeyNormalization(conf *config.TableConfig) bool {
+	return conf.KeyNormalization == config.KeyNormalizationLegacy
+}
@@ -16,4 +16,6 @@ const (
 	methodTypeHash   = "HASH"
 	methodTypeGlobal = "GLOBAL"
 	methodTypeSingle = "SINGLE"
+	methodTypeList   = "LIST"
+	methodTypeCHash  = "CHASH"
 )
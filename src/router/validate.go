@@ -0,0 +1,122 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"config"
+
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// ValidateConfig used to check the tables metadata under the metadir without loading it,
+// all the problems are returned, backends is the names of the backends which the partitions can reference.
+func ValidateConfig(log *xlog.Log, metadir string, conf *config.RouterConfig, backends []string) []error {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, err := os.Stat(metadir); os.IsNotExist(err) {
+		return nil
+	}
+	dirs, err := ioutil.ReadDir(metadir)
+	if err != nil {
+		report("router: can not read the meta-dir[%s]:%v", metadir, err)
+		return errs
+	}
+
+	known := make(map[string]bool)
+	for _, name := range backends {
+		known[name] = true
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		db := dir.Name()
+		files, err := ioutil.ReadDir(path.Join(metadir, db))
+		if err != nil {
+			report("router: can not read the database dir[%s]:%v", path.Join(metadir, db), err)
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() {
+				continue
+			}
+			file := path.Join(metadir, db, f.Name())
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				report("router: can not read the table file[%s]:%v", file, err)
+				continue
+			}
+			tconf, err := config.ReadTableConfig(string(data))
+			if err != nil {
+				report("router: table file[%s] is not a valid json:%v", file, err)
+				continue
+			}
+			errs = append(errs, validateTable(log, conf, db, file, tconf, known)...)
+		}
+	}
+	return errs
+}
+
+func validateTable(log *xlog.Log, conf *config.RouterConfig, db string, file string, tconf *config.TableConfig, backends map[string]bool) []error {
+	var errs []error
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	name := fmt.Sprintf("%s.%s", db, tconf.Name)
+
+	if want := strings.TrimSuffix(path.Base(file), ".json"); tconf.Name != want {
+		report("router: table file[%s] has the name[%s], it must be the file name[%s]", file, tconf.Name, want)
+	}
+	if tconf.ShardType == methodTypeHash {
+		if tconf.ShardKey == "" {
+			report("router: table[%s] is HASH but the shardkey is empty", name)
+		}
+		if tconf.Slots != 0 && tconf.Slots != conf.Slots {
+			report("router: table[%s] has slots[%d], but the router slots is %d", name, tconf.Slots, conf.Slots)
+		}
+	}
+	if tconf.ShardType == methodTypeList && tconf.ShardKey == "" {
+		report("router: table[%s] is LIST but the shardkey is empty", name)
+	}
+	if tconf.ShardType == methodTypeCHash && tconf.ShardKey == "" {
+		report("router: table[%s] is CHASH but the shardkey is empty", name)
+	}
+	if len(tconf.Partitions) == 0 {
+		report("router: table[%s] has no partitions", name)
+	}
+
+	segments := make(map[string]bool)
+	for _, part := range tconf.Partitions {
+		if !backends[part.Backend] {
+			report("router: table[%s] partition[%s] references the missing backend[%s], add the backend or shift the partition", name, part.Table, part.Backend)
+		}
+		if segments[part.Table] {
+			report("router: table[%s] has the duplicate partition table[%s]", name, part.Table)
+		}
+		segments[part.Table] = true
+	}
+
+	// Shardtype, segment ranges and overlaps are checked by the partition builder,
+	// the scratch router is never flushed.
+	scratch := NewRouter(log, "", conf)
+	if err := scratch.addTable(db, tconf); err != nil {
+		report("router: table[%s] partitions are invalid:%v", name, err)
+	}
+	return errs
+}
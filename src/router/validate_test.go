@@ -0,0 +1,82 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"config"
+	"fakedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestRouterValidateConfig(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	metadir := fakedb.GetTmpDir("", "radon_router_", log)
+	defer os.RemoveAll(metadir)
+	conf := MockNewRouterConfig()
+
+	// Not exists.
+	{
+		errs := ValidateConfig(log, path.Join(metadir, "none"), conf, nil)
+		assert.Equal(t, 0, len(errs))
+	}
+
+	dir := path.Join(metadir, "db1")
+	err := os.MkdirAll(dir, 0755)
+	assert.Nil(t, err)
+	backends := []string{"backend0", "backend2", "backend4", "backend8"}
+
+	// Valid.
+	{
+		err := config.WriteConfig(path.Join(dir, "A.json"), MockTableAConfig())
+		assert.Nil(t, err)
+		errs := ValidateConfig(log, metadir, conf, backends)
+		assert.Equal(t, 0, len(errs))
+	}
+
+	// All the problems are reported.
+	{
+		// Missing backend.
+		errs := ValidateConfig(log, metadir, conf, backends[1:])
+		assert.Equal(t, 1, len(errs))
+
+		// Name mismatch and overlapped.
+		err := config.WriteConfig(path.Join(dir, "B.json"), MockTableOverlapConfig())
+		assert.Nil(t, err)
+		// Broken json.
+		err = ioutil.WriteFile(path.Join(dir, "C.json"), []byte("wtf"), 0644)
+		assert.Nil(t, err)
+		// Empty shardkey.
+		tconf := MockTableAConfig()
+		tconf.Name = "D"
+		tconf.ShardKey = ""
+		err = config.WriteConfig(path.Join(dir, "D.json"), tconf)
+		assert.Nil(t, err)
+
+		errs = ValidateConfig(log, metadir, conf, backends)
+		want := []string{
+			"router: table file[" + path.Join(dir, "B.json") + "] has the name[A], it must be the file name[B]",
+			"router: table[db1.A] partition[A1] references the missing backend[backend1], add the backend or shift the partition",
+			"router: table[db1.A] partitions are invalid:router.unsupport.shardtype:[]",
+			"router: table file[" + path.Join(dir, "C.json") + "] is not a valid json:invalid character 'w' looking for beginning of value",
+			"router: table[db1.D] is HASH but the shardkey is empty",
+		}
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		assert.Equal(t, want, got)
+	}
+}
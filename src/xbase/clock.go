@@ -0,0 +1,151 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xbase
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of the time for the timeouts, the retentions and the stats,
+// so the tests can move the time by the FakeClock instead of sleeping.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+// Now impl.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Since impl.
+func (systemClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// After impl.
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// AtomicClock is the clock can be set while it's used, the zero value is the SystemClock.
+type AtomicClock struct {
+	v atomic.Value
+}
+
+type clockValue struct {
+	Clock
+}
+
+// Set used to set the clock.
+func (a *AtomicClock) Set(clock Clock) {
+	a.v.Store(clockValue{clock})
+}
+
+// Get returns the clock.
+func (a *AtomicClock) Get() Clock {
+	if v, ok := a.v.Load().(clockValue); ok {
+		return v.Clock
+	}
+	return SystemClock
+}
+
+type clockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// FakeClock is the clock only moved by Advance and Set, the channels of After
+// receive the time when the clock reaches their deadlines.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []clockWaiter
+}
+
+// NewFakeClock creates the new fake clock at the time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now impl.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since impl.
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After impl, the channel receives at once if the duration is not greater than 0.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, clockWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance used to move the clock forward by the duration.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set used to set the clock to the time, the waiters whose deadlines are reached fire in order.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	fired := 0
+	for _, w := range c.waiters {
+		if w.at.After(now) {
+			break
+		}
+		w.ch <- now
+		fired++
+	}
+	c.waiters = c.waiters[fired:]
+}
+
+// Waiters returns the number of the After channels not fired, the tests use it to wait for
+// the code under test blocking on the clock before advancing it.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// WaitForWaiters used to wait until the number of the waiters reaches n or the real timeout.
+func (c *FakeClock) WaitForWaiters(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for c.Waiters() < n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
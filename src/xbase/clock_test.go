@@ -0,0 +1,72 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xbase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemClock(t *testing.T) {
+	start := SystemClock.Now()
+	<-SystemClock.After(time.Millisecond)
+	assert.True(t, SystemClock.Since(start) >= time.Millisecond)
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2019, 3, 15, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	c1 := clock.After(time.Second)
+	c2 := clock.After(time.Minute)
+	assert.Equal(t, 2, clock.Waiters())
+
+	// Not reached.
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-c1:
+		assert.Fail(t, "c1.fired")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-c1)
+	assert.Equal(t, 1, clock.Waiters())
+	assert.Equal(t, time.Second, clock.Since(start))
+
+	clock.Set(start.Add(time.Hour))
+	assert.Equal(t, start.Add(time.Hour), <-c2)
+	assert.Equal(t, 0, clock.Waiters())
+
+	// Fire at once.
+	assert.Equal(t, start.Add(time.Hour), <-clock.After(0))
+
+	// Wait for the waiters.
+	go func() {
+		<-clock.After(time.Second)
+	}()
+	assert.True(t, clock.WaitForWaiters(1, time.Second))
+	assert.False(t, clock.WaitForWaiters(2, 10*time.Millisecond))
+	clock.Advance(time.Second)
+}
+
+func TestAtomicClock(t *testing.T) {
+	var clock AtomicClock
+	assert.Equal(t, SystemClock, clock.Get())
+
+	fake := NewFakeClock(time.Unix(1552608000, 0))
+	clock.Set(fake)
+	assert.Equal(t, time.Unix(1552608000, 0), clock.Get().Now())
+
+	clock.Set(SystemClock)
+	assert.Equal(t, SystemClock, clock.Get())
+}
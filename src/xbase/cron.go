@@ -0,0 +1,161 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xbase
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is the parsed cron schedule 'minute hour day-of-month month day-of-week'.
+// The field supports '*', 'a-b', 'a,b' and the step '/n', the day-of-week is 0-7 and both 0 and 7 are Sunday.
+// If both the day-of-month and day-of-week are restricted, the day matches either of them as the cron does.
+type Cron struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// ParseCron parses the cron schedule, the macros @yearly, @monthly, @weekly, @daily and @hourly are supported.
+func ParseCron(spec string) (*Cron, error) {
+	spec = strings.TrimSpace(spec)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron[%s].must.have.5.fields", spec)
+	}
+
+	var err error
+	cron := &Cron{
+		anyDom: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}
+	if cron.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if cron.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if cron.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if cron.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if cron.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// Sunday is both 0 and 7.
+	if cron.dow&(1<<7) > 0 {
+		cron.dow |= 1
+	}
+	return cron, nil
+}
+
+// parseCronField returns the bits of the values in [min, max] the field matches.
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		var err error
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("cron.field[%s].step.invalid", field)
+			}
+			item = item[:i]
+		}
+
+		lo, hi := min, max
+		if item != "*" {
+			parts := strings.SplitN(item, "-", 2)
+			if lo, err = strconv.Atoi(parts[0]); err != nil {
+				return 0, fmt.Errorf("cron.field[%s].value.invalid", field)
+			}
+			hi = lo
+			if len(parts) == 2 {
+				if hi, err = strconv.Atoi(parts[1]); err != nil {
+					return 0, fmt.Errorf("cron.field[%s].value.invalid", field)
+				}
+			} else if step > 1 {
+				// 'a/n' means from a to the max.
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron.field[%s].out.of.range[%d-%d]", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) > 0
+	dow := c.dow&(1<<uint(t.Weekday())) > 0
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// Match returns true if the minute of the time matches the schedule.
+func (c *Cron) Match(t time.Time) bool {
+	return c.month&(1<<uint(t.Month())) > 0 && c.matchDay(t) &&
+		c.hour&(1<<uint(t.Hour())) > 0 && c.minute&(1<<uint(t.Minute())) > 0
+}
+
+// Next returns the first minute after the time matches the schedule,
+// the zero time is returned if nothing matches in 5 years, such as '0 0 31 2 *'.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
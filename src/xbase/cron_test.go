@@ -0,0 +1,64 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xbase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2019-03-15 10:30 is Friday.
+	now := time.Date(2019, 3, 15, 10, 30, 20, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2019, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2019, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"@daily", time.Date(2019, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2019, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1-5", time.Date(2019, 3, 18, 2, 30, 0, 0, time.UTC)},
+		{"0 3 1,15 * *", time.Date(2019, 4, 1, 3, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2019, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 6", time.Date(2019, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * 3 *", time.Date(2019, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		cron, err := ParseCron(test.spec)
+		assert.Nil(t, err, test.spec)
+		assert.Equal(t, test.next, cron.Next(now), test.spec)
+		if !test.next.IsZero() {
+			assert.True(t, cron.Match(test.next), test.spec)
+		}
+	}
+}
+
+func TestCronParseError(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	}
+	for _, spec := range specs {
+		_, err := ParseCron(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package xbase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xelabs/go-mysqlstack/sqldb"
+)
+
+// The radon error codes.
+// The errors originated by radon itself are in the range [9000, 9999], it's never used by MySQL
+// and the codes are stable across the releases, the others are the MySQL error codes.
+const (
+	// ER_RADON_BACKEND_UNAVAILABLE is the backend can't be connected or the connection is lost.
+	ER_RADON_BACKEND_UNAVAILABLE = 9001
+
+	// ER_RADON_QUERY_INTERRUPTED is the query interrupted by the radon limits, such as the timeout and max result.
+	ER_RADON_QUERY_INTERRUPTED = 9002
+
+	// ER_RADON_UNSUPPORTED_SQL is the known-unsupported construct, such as the stored procedure.
+	ER_RADON_UNSUPPORTED_SQL = 9003
+
+	// ER_RADON_QUOTA_EXCEEDED is the write rejected by the database quota.
+	ER_RADON_QUOTA_EXCEEDED = 9004
+)
+
+// NewRadonError creates the radon error, the sqlstate is HY000.
+func NewRadonError(num uint16, format string, args ...interface{}) *sqldb.SQLError {
+	return &sqldb.SQLError{
+		Num:     num,
+		State:   sqldb.SSUnknownSQLState,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// NewContextError creates the error of the request whose context is done, nil if it's not done.
+func NewContextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return NewRadonError(ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, the deadline exceeded")
+	}
+	return NewRadonError(ER_RADON_QUERY_INTERRUPTED, "Query execution was interrupted, the query is cancelled")
+}
@@ -42,4 +42,10 @@ const (
 
 	// CHECKSUM type.
 	CHECKSUM = "CHECKSUM"
+
+	// FLUSH type.
+	FLUSH = "FLUSH"
+
+	// CALL type.
+	CALL = "CALL"
 )
@@ -34,6 +34,7 @@ type RotateFile interface {
 	Write(b []byte) (int, error)
 	Sync() error
 	Close()
+	Rotate() error
 	Name() string
 	GetOldLogInfos() ([]LogInfo, error)
 	GetNextLogInfo(logName string) (LogInfo, error)
@@ -85,6 +86,21 @@ func (f *rotateFile) rotate() error {
 	return f.openNew()
 }
 
+// Rotate used to close the current file, the next write opens a new one.
+func (f *rotateFile) Rotate() error {
+	if f.file == nil {
+		return nil
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	return nil
+}
+
 // Name returns the current writing file base name.
 func (f *rotateFile) Name() string {
 	return path.Base(f.name.Get())
@@ -9,6 +9,7 @@
 package xbase
 
 import (
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -227,3 +228,34 @@ func TestFileGetNextLogInfoWithEmpty(t *testing.T) {
 	assert.Equal(t, "", info.Name)
 	xfile.Name()
 }
+
+func TestFileRotate(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tmpDir := getTmpDir("", "radon_xbase_", log)
+	defer os.RemoveAll(tmpDir)
+
+	xfile := NewRotateFile(tmpDir, mockPrefix, mockExtension, 1024*512)
+	defer xfile.Close()
+
+	// Nothing opened.
+	err := xfile.Rotate()
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := xfile.Write([]byte("rotate.me"))
+		assert.Nil(t, err)
+		err = xfile.Rotate()
+		assert.Nil(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The rotated files are old, no current file.
+	logInfos, err := xfile.GetOldLogInfos()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(logInfos))
+	for _, info := range logInfos {
+		datas, err := ioutil.ReadFile(filepath.Join(tmpDir, info.Name))
+		assert.Nil(t, err)
+		assert.Equal(t, "rotate.me", string(datas))
+	}
+}
@@ -9,6 +9,8 @@
 package xcontext
 
 import (
+	"context"
+
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
@@ -40,14 +42,53 @@ const (
 	TxnWrite
 )
 
+// PlanType type, used for the metrics.
+type PlanType string
+
+const (
+	// PlanSelect enum.
+	PlanSelect PlanType = "select"
+
+	// PlanInsert enum.
+	PlanInsert PlanType = "insert"
+
+	// PlanUpdate enum.
+	PlanUpdate PlanType = "update"
+
+	// PlanDelete enum.
+	PlanDelete PlanType = "delete"
+
+	// PlanDDL enum.
+	PlanDDL PlanType = "ddl"
+
+	// PlanOthers enum.
+	PlanOthers PlanType = "others"
+)
+
 // ResultContext tuple.
 type ResultContext struct {
 	Results *sqltypes.Result
+
+	// Ctx is the context of the request, the executors stop once it's done.
+	Ctx context.Context
 }
 
 // NewResultContext returns the result context.
 func NewResultContext() *ResultContext {
-	return &ResultContext{}
+	return &ResultContext{Ctx: context.Background()}
+}
+
+// Context returns the context of the request, never nil.
+func (r *ResultContext) Context() context.Context {
+	if r.Ctx == nil {
+		return context.Background()
+	}
+	return r.Ctx
+}
+
+// Child returns a new result context of the same request, used by the sub executors.
+func (r *ResultContext) Child() *ResultContext {
+	return &ResultContext{Ctx: r.Context()}
 }
 
 // RequestContext tuple.
@@ -56,12 +97,31 @@ type RequestContext struct {
 	Mode     RequestMode
 	TxnMode  TxnMode
 	Querys   []QueryTuple
+	PlanType PlanType
+
+	// RawRows used to keep the row packets in the results, the rows must be untouched.
+	RawRows bool
+
+	// Limit is the rows the request is satisfied with, the backend querys still running are cancelled once
+	// so many rows are received. It's only set for the unordered read whose any rows are correct, 0 means no limit.
+	Limit int
+
+	// Ctx is the context of the request, the backend querys are interrupted once it's done.
+	Ctx context.Context
 }
 
 // NewRequestContext creates RequestContext
 // The default Mode is ReqNormal
 func NewRequestContext() *RequestContext {
-	return &RequestContext{}
+	return &RequestContext{Ctx: context.Background()}
+}
+
+// Context returns the context of the request, never nil.
+func (r *RequestContext) Context() context.Context {
+	if r.Ctx == nil {
+		return context.Background()
+	}
+	return r.Ctx
 }
 
 // QueryTuple tuple.
@@ -74,6 +134,9 @@ type QueryTuple struct {
 
 	// Range info.
 	Range string
+
+	// Segment table name with database, such as 'db.t1_0000', used for the skew detection.
+	Table string `json:"-"`
 }
 
 // QueryTuples represents the query tuple slice.